@@ -48,3 +48,35 @@ export const updateBlockedServices = (values: any) => async (dispatch: any) => {
         dispatch(updateBlockedServicesFailure());
     }
 };
+
+export const getBlockedTldsRequest = createAction('GET_BLOCKED_TLDS_REQUEST');
+export const getBlockedTldsFailure = createAction('GET_BLOCKED_TLDS_FAILURE');
+export const getBlockedTldsSuccess = createAction('GET_BLOCKED_TLDS_SUCCESS');
+
+export const getBlockedTlds = () => async (dispatch: any) => {
+    dispatch(getBlockedTldsRequest());
+    try {
+        const data = await apiClient.getBlockedTlds();
+        dispatch(getBlockedTldsSuccess(data));
+    } catch (error) {
+        dispatch(addErrorToast({ error }));
+        dispatch(getBlockedTldsFailure());
+    }
+};
+
+export const updateBlockedTldsRequest = createAction('UPDATE_BLOCKED_TLDS_REQUEST');
+export const updateBlockedTldsFailure = createAction('UPDATE_BLOCKED_TLDS_FAILURE');
+export const updateBlockedTldsSuccess = createAction('UPDATE_BLOCKED_TLDS_SUCCESS');
+
+export const updateBlockedTlds = (values: any) => async (dispatch: any) => {
+    dispatch(updateBlockedTldsRequest());
+    try {
+        await apiClient.updateBlockedTlds(values);
+        dispatch(updateBlockedTldsSuccess());
+        dispatch(getBlockedTlds());
+        dispatch(addSuccessToast('blocked_tlds_saved'));
+    } catch (error) {
+        dispatch(addErrorToast({ error }));
+        dispatch(updateBlockedTldsFailure());
+    }
+};
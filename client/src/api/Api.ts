@@ -564,6 +564,25 @@ class Api {
         return this.makeRequest(path, method, parameters);
     }
 
+    // Blocked top-level domains
+    BLOCKED_TLDS_GET = { path: 'blocked_tlds/get', method: 'GET' };
+
+    BLOCKED_TLDS_UPDATE = { path: 'blocked_tlds/update', method: 'PUT' };
+
+    getBlockedTlds() {
+        const { path, method } = this.BLOCKED_TLDS_GET;
+
+        return this.makeRequest(path, method);
+    }
+
+    updateBlockedTlds(config: any) {
+        const { path, method } = this.BLOCKED_TLDS_UPDATE;
+        const parameters = {
+            data: config,
+        };
+        return this.makeRequest(path, method, parameters);
+    }
+
     // Settings for statistics
     GET_STATS = { path: 'stats', method: 'GET' };
 
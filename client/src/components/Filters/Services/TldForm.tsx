@@ -0,0 +1,115 @@
+import React from 'react';
+
+import { Trans, useTranslation } from 'react-i18next';
+
+import { Controller, useForm } from 'react-hook-form';
+
+import { Checkbox } from '../../ui/Controls/Checkbox';
+import { Textarea } from '../../ui/Controls/Textarea';
+import { BlockedTlds } from '../../../initialState';
+
+const TLD_CATEGORIES = ['country_code', 'private', 'unlisted'];
+
+type FormValues = {
+    enabled: boolean;
+    suffixes: string;
+    categories: Record<string, boolean>;
+};
+
+interface TldFormProps {
+    tlds: BlockedTlds;
+    processing: boolean;
+    onSubmit: (values: BlockedTlds) => void;
+}
+
+export const TldForm = ({ tlds, processing, onSubmit }: TldFormProps) => {
+    const { t } = useTranslation();
+
+    const {
+        handleSubmit,
+        control,
+        watch,
+        formState: { isSubmitting },
+    } = useForm<FormValues>({
+        mode: 'onBlur',
+        defaultValues: {
+            enabled: tlds.enabled,
+            suffixes: tlds.suffixes.join('\n'),
+            categories: Object.fromEntries(TLD_CATEGORIES.map((c) => [c, tlds.categories.includes(c)])),
+        },
+    });
+
+    const enabled = watch('enabled');
+
+    const handleFormSubmit = (values: FormValues) => {
+        onSubmit({
+            enabled: values.enabled,
+            suffixes: values.suffixes
+                .split('\n')
+                .map((s) => s.trim())
+                .filter(Boolean),
+            categories: TLD_CATEGORIES.filter((c) => values.categories[c]),
+        });
+    };
+
+    return (
+        <form onSubmit={handleSubmit(handleFormSubmit)}>
+            <div className="form__group form__group--checkbox">
+                <Controller
+                    name="enabled"
+                    control={control}
+                    render={({ field }) => (
+                        <Checkbox
+                            {...field}
+                            data-testid="blocked_tlds_enabled"
+                            title={t('blocked_tlds_enable')}
+                            disabled={processing}
+                        />
+                    )}
+                />
+            </div>
+
+            <Controller
+                name="suffixes"
+                control={control}
+                render={({ field }) => (
+                    <Textarea
+                        {...field}
+                        data-testid="blocked_tlds_suffixes"
+                        placeholder={t('blocked_tlds_suffixes')}
+                        disabled={processing || !enabled}
+                        trimOnBlur
+                    />
+                )}
+            />
+
+            {TLD_CATEGORIES.map((category) => (
+                <div key={category} className="form__group form__group--checkbox">
+                    <Controller
+                        name={`categories.${category}`}
+                        control={control}
+                        render={({ field }) => (
+                            <Checkbox
+                                {...field}
+                                data-testid={`blocked_tlds_${category}`}
+                                title={t(`blocked_tlds_category_${category}`)}
+                                subtitle={t(`blocked_tlds_category_${category}_desc`)}
+                                disabled={processing || !enabled}
+                            />
+                        )}
+                    />
+                </div>
+            ))}
+
+            <div className="btn-list">
+                <button
+                    type="submit"
+                    data-testid="blocked_tlds_save"
+                    className="btn btn-success btn-standard btn-large"
+                    disabled={processing || isSubmitting}>
+                    <Trans>save_btn</Trans>
+                </button>
+            </div>
+        </form>
+    );
+};
@@ -6,11 +6,18 @@ import { useDispatch, useSelector } from 'react-redux';
 import { Form } from './Form';
 
 import Card from '../../ui/Card';
-import { getBlockedServices, getAllBlockedServices, updateBlockedServices } from '../../../actions/services';
+import {
+    getBlockedServices,
+    getAllBlockedServices,
+    updateBlockedServices,
+    getBlockedTlds,
+    updateBlockedTlds,
+} from '../../../actions/services';
 
 import PageTitle from '../../ui/PageTitle';
 
 import { ScheduleForm } from './ScheduleForm';
+import { TldForm } from './TldForm';
 import { RootState } from '../../../initialState';
 
 const getInitialDataForServices = (initial: any) =>
@@ -33,6 +40,7 @@ const Services = () => {
     useEffect(() => {
         dispatch(getBlockedServices());
         dispatch(getAllBlockedServices());
+        dispatch(getBlockedTlds());
     }, []);
 
     const handleSubmit = (values: any) => {
@@ -61,6 +69,10 @@ const Services = () => {
         );
     };
 
+    const handleTldsSubmit = (values: any) => {
+        dispatch(updateBlockedTlds(values));
+    };
+
     const initialValues = getInitialDataForServices(services.list.ids);
 
     if (!initialValues) {
@@ -91,6 +103,20 @@ const Services = () => {
             >
                 <ScheduleForm schedule={services.list.schedule} onScheduleSubmit={handleScheduleSubmit} />
             </Card>
+
+            {services.tlds && (
+                <Card
+                    title={t('blocked_tlds')}
+                    subtitle={t('blocked_tlds_desc')}
+                    bodyType="card-body box-body--settings"
+                >
+                    <TldForm
+                        tlds={services.tlds}
+                        processing={services.processingTlds || services.processingSetTlds}
+                        onSubmit={handleTldsSubmit}
+                    />
+                </Card>
+            )}
         </>
     );
 };
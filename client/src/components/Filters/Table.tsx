@@ -85,6 +85,20 @@ class Table extends Component<TableProps> {
             minWidth: 100,
             Cell: (props: any) => props.value.toLocaleString(),
         },
+        {
+            Header: <Trans>hits_table_header</Trans>,
+            accessor: 'hits',
+            className: 'text-center',
+            minWidth: 100,
+            Cell: ({ value, original }: any) =>
+                value === 0 && original.enabled ? (
+                    <span className="text-muted" title={this.props.t('zero_hits_desc')}>
+                        <Trans>zero_hits</Trans>
+                    </span>
+                ) : (
+                    value.toLocaleString()
+                ),
+        },
         {
             Header: <Trans>last_time_updated_table_header</Trans>,
             accessor: 'lastUpdated',
@@ -6,7 +6,14 @@ import { useTranslation } from 'react-i18next';
 
 import { Link, useHistory } from 'react-router-dom';
 
-import { checkFiltered, getBlockingClientName } from '../../../helpers/helpers';
+import {
+    checkFiltered,
+    ClientDevice,
+    ClientIdentity,
+    formatClientDevice,
+    formatClientIdentity,
+    getBlockingClientName,
+} from '../../../helpers/helpers';
 import { BLOCK_ACTIONS } from '../../../helpers/constants';
 
 import { toggleBlocking, toggleBlockingForClient } from '../../../actions';
@@ -30,6 +37,8 @@ interface ClientCellProps {
             city?: string;
             orgname?: string;
         };
+        device?: ClientDevice;
+        identity?: ClientIdentity;
         disallowed: boolean;
         disallowed_rule: string;
     };
@@ -70,6 +79,8 @@ const ClientCell = ({ client, client_id, client_info, domain, reason }: ClientCe
         city: client_info?.whois?.city,
         network: client_info?.whois?.orgname,
         source_label: source,
+        client_device: formatClientDevice(client_info?.device),
+        client_identity: formatClientIdentity(client_info?.identity),
     };
 
     const processedData = Object.entries(data);
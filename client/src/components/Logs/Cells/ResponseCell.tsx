@@ -2,7 +2,14 @@ import { useTranslation } from 'react-i18next';
 import { shallowEqual, useSelector } from 'react-redux';
 import classNames from 'classnames';
 import React from 'react';
-import { getRulesToFilterList, formatElapsedMs, getFilterNames, getServiceName } from '../../../helpers/helpers';
+import {
+    getRulesToFilterList,
+    formatElapsedMs,
+    getFilterNames,
+    getServiceName,
+    formatDecisionTrace,
+    TraceStep,
+} from '../../../helpers/helpers';
 import { FILTERED_STATUS, FILTERED_STATUS_TO_META_MAP } from '../../../helpers/constants';
 
 import IconTooltip from './IconTooltip';
@@ -21,6 +28,7 @@ interface ResponseCellProps {
         filter_list_id: number;
     }[];
     service_name?: string;
+    trace?: TraceStep[];
 }
 
 const ResponseCell = ({
@@ -33,6 +41,7 @@ const ResponseCell = ({
     rules,
     service_name,
     cached,
+    trace,
 }: ResponseCellProps) => {
     const { t } = useTranslation();
 
@@ -90,6 +99,7 @@ const ResponseCell = ({
         ...(service_name &&
             services.allServices && { service_name: getServiceName(services.allServices, service_name) }),
         ...(rules.length > 0 && { rule_label: getRulesToFilterList(rules, filters, whitelistFilters) }),
+        ...(trace?.length > 0 && { decision_trace: formatDecisionTrace(trace) }),
         response_table_header: renderResponses(response),
         original_response: renderResponses(originalResponse),
     };
@@ -13,6 +13,8 @@ import {
     getBlockingClientName,
     getServiceName,
     processContent,
+    formatDecisionTrace,
+    TraceStep,
 } from '../../../helpers/helpers';
 import {
     BLOCK_ACTIONS,
@@ -78,6 +80,7 @@ interface RowProps {
         originalResponse?: unknown[];
         status: string;
         service_name?: string;
+        trace?: TraceStep[];
     };
     isSmallScreen: boolean;
     setDetailedDataCurrent: Dispatch<SetStateAction<any>>;
@@ -136,6 +139,7 @@ const Row = memo(
                 status,
                 service_name,
                 cached,
+                trace,
             } = rowProps;
 
             const hasTracker = !!tracker;
@@ -256,6 +260,7 @@ const Row = memo(
                 }),
                 elapsed: formattedElapsedMs,
                 ...(rules.length > 0 && { rule_label: getRulesToFilterList(rules, filters, whitelistFilters) }),
+                ...(trace?.length > 0 && { decision_trace: formatDecisionTrace(trace) }),
                 response_table_header: response?.join('\n'),
                 response_code: status,
                 client_details: 'title',
@@ -12,7 +12,7 @@ import whoisCell from './whoisCell';
 
 import LogsSearchLink from '../../ui/LogsSearchLink';
 
-import { sortIp, formatNumber } from '../../../helpers/helpers';
+import { sortIp, formatNumber, formatClientDevice } from '../../../helpers/helpers';
 import { LocalStorageHelper, LOCAL_STORAGE_KEYS } from '../../../helpers/localStorageHelper';
 import { TABLES_MIN_ROWS } from '../../../helpers/constants';
 
@@ -45,6 +45,13 @@ class AutoClients extends Component<AutoClientsProps> {
             minWidth: COLUMN_MIN_WIDTH,
             Cell: CellWrap,
         },
+        {
+            Header: this.props.t('client_device'),
+            accessor: (row: any) => formatClientDevice(row.device),
+            id: 'device',
+            minWidth: COLUMN_MIN_WIDTH,
+            Cell: CellWrap,
+        },
         {
             Header: this.props.t('whois'),
             accessor: 'whois_info',
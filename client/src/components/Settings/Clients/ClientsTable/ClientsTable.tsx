@@ -105,6 +105,12 @@ const ClientsTable = ({
                 config.upstreams = [];
             }
 
+            if (values.allowlist && typeof values.allowlist === 'string') {
+                config.allowlist = splitByNewLine(values.allowlist);
+            } else {
+                config.allowlist = [];
+            }
+
             if (values.tags) {
                 config.tags = values.tags.map((tag: any) => tag.value);
             } else {
@@ -143,9 +149,10 @@ const ClientsTable = ({
         const client = clients.find((item: any) => name === item.name);
 
         if (client) {
-            const { upstreams, tags, ...values } = client;
+            const { upstreams, allowlist, tags, ...values } = client;
             return {
                 upstreams: (upstreams && upstreams.join('\n')) || '',
+                allowlist: (allowlist && allowlist.join('\n')) || '',
                 tags: (tags && getOptionsWithLabels(tags)) || [],
                 ...values,
             };
@@ -0,0 +1,50 @@
+import React from 'react';
+import { useTranslation } from 'react-i18next';
+
+import { Controller, useFormContext } from 'react-hook-form';
+import { Textarea } from '../../../../ui/Controls/Textarea';
+import { ClientForm } from '../types';
+import { Checkbox } from '../../../../ui/Controls/Checkbox';
+
+export const AllowlistOnly = () => {
+    const { t } = useTranslation();
+
+    const { control, watch } = useFormContext<ClientForm>();
+
+    const allowlistOnly = watch('allowlist_only');
+
+    return (
+        <div title={t('allowlist_only')}>
+            <div className="form__desc mb-3">{t('allowlist_only_desc')}</div>
+
+            <div className="form__group mb-3">
+                <Controller
+                    name="allowlist_only"
+                    control={control}
+                    render={({ field }) => (
+                        <Checkbox
+                            {...field}
+                            data-testid="clients_allowlist_only"
+                            title={t('allowlist_only_enable')}
+                        />
+                    )}
+                />
+            </div>
+
+            <Controller
+                name="allowlist"
+                control={control}
+                render={({ field }) => (
+                    <Textarea
+                        {...field}
+                        data-testid="clients_allowlist"
+                        className="form-control form-control--textarea"
+                        placeholder={t('allowlist_only_domains')}
+                        disabled={!allowlistOnly}
+                        trimOnBlur
+                    />
+                )}
+            />
+        </div>
+    );
+};
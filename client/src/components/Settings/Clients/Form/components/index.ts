@@ -1,3 +1,4 @@
+export { AllowlistOnly } from './AllowlistOnly';
 export { BlockedServices } from './BlockedServices';
 export { ClientIds } from './ClientIds';
 export { ScheduleServices } from './ScheduleServices';
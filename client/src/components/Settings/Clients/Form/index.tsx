@@ -10,7 +10,7 @@ import { RootState } from '../../../../initialState';
 import { Input } from '../../../ui/Controls/Input';
 import { validateRequiredValue } from '../../../../helpers/validators';
 import { ClientForm } from './types';
-import { BlockedServices, ClientIds, MainSettings, ScheduleServices, UpstreamDns } from './components';
+import { AllowlistOnly, BlockedServices, ClientIds, MainSettings, ScheduleServices, UpstreamDns } from './components';
 
 import '../Service.css';
 
@@ -29,6 +29,8 @@ const defaultFormValues: ClientForm = {
     upstreams: '',
     upstreams_cache_enabled: false,
     upstreams_cache_size: 0,
+    allowlist_only: false,
+    allowlist: '',
     use_global_blocked_services: false,
     blocked_services_schedule: {
         time_zone: LOCAL_TIMEZONE_VALUE,
@@ -77,6 +79,7 @@ export const Form = ({
     const { safe_search } = initialValues;
     const safeSearchServices = { ...safe_search };
     delete safeSearchServices.enabled;
+    delete safeSearchServices.custom_rewrites;
 
     const [activeTabLabel, setActiveTabLabel] = useState('settings');
 
@@ -97,6 +100,10 @@ export const Form = ({
             title: 'upstream_dns',
             component: <UpstreamDns />,
         },
+        allowlist_only: {
+            title: 'allowlist_only',
+            component: <AllowlistOnly />,
+        },
     };
 
     const activeTab = tabs[activeTabLabel].component;
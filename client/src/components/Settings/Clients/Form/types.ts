@@ -14,6 +14,8 @@ export type ClientForm = {
     upstreams: string;
     upstreams_cache_enabled: boolean;
     upstreams_cache_size: number;
+    allowlist_only: boolean;
+    allowlist: string;
     blocked_services: Record<string, boolean>;
     filtering_enabled: boolean;
     safebrowsing_enabled: boolean;
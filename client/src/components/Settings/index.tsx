@@ -118,6 +118,7 @@ class Settings extends Component<SettingsProps> {
         const { enabled } = safesearch || {};
         const searches = { ...(safesearch || {}) };
         delete searches.enabled;
+        delete searches.custom_rewrites;
 
         return (
             <>
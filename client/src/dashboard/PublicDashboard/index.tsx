@@ -0,0 +1,124 @@
+import React, { useEffect, useState } from 'react';
+import { Trans } from 'react-i18next';
+
+import StatsCard from '../../components/Dashboard/StatsCard';
+import { Logo } from '../../components/ui/svg/logo';
+import { getPercent, normalizeHistory } from '../../helpers/helpers';
+
+import './PublicDashboard.css';
+
+const PUBLIC_STATS_URL = 'control/stats/public';
+
+const REFRESH_INTERVAL_MS = 60 * 1000;
+
+type PublicStats = {
+    dns_queries: number[];
+    blocked_filtering: number[];
+    replaced_safebrowsing: number[];
+    replaced_parental: number[];
+    num_dns_queries: number;
+    num_blocked_filtering: number;
+    num_replaced_safebrowsing: number;
+    num_replaced_safesearch: number;
+    num_replaced_parental: number;
+    avg_processing_time: number;
+};
+
+const getLineData = (data: number[], id: string) => [{ data: normalizeHistory(data), id }];
+
+/**
+ * Passes the token of the page, if there is one, to the HTTP API.
+ */
+const getStatsUrl = () => {
+    const token = new URLSearchParams(window.location.search).get('token');
+    if (!token) {
+        return PUBLIC_STATS_URL;
+    }
+
+    return `${PUBLIC_STATS_URL}?${new URLSearchParams({ token })}`;
+};
+
+export const PublicDashboard = () => {
+    const [stats, setStats] = useState<PublicStats | null>(null);
+    const [isUnavailable, setIsUnavailable] = useState(false);
+
+    useEffect(() => {
+        const url = getStatsUrl();
+
+        const update = async () => {
+            try {
+                const resp = await fetch(url, { credentials: 'same-origin' });
+                if (!resp.ok) {
+                    throw new Error(`status ${resp.status}`);
+                }
+
+                setStats(await resp.json());
+                setIsUnavailable(false);
+            } catch (e) {
+                setIsUnavailable(true);
+            }
+        };
+
+        update();
+        const id = window.setInterval(update, REFRESH_INTERVAL_MS);
+
+        return () => window.clearInterval(id);
+    }, []);
+
+    return (
+        <div className="public-dashboard container">
+            <div className="public-dashboard__header">
+                <Logo className="h-6" />
+            </div>
+
+            {isUnavailable && (
+                <div className="public-dashboard__message">
+                    <Trans>public_dashboard_unavailable</Trans>
+                </div>
+            )}
+
+            {stats && (
+                <div className="row">
+                    <div className="col-sm-6 col-lg-3">
+                        <StatsCard
+                            total={stats.num_dns_queries}
+                            lineData={getLineData(stats.dns_queries, 'dnsQuery')}
+                            title={<Trans>dns_query</Trans>}
+                            color="blue"
+                        />
+                    </div>
+
+                    <div className="col-sm-6 col-lg-3">
+                        <StatsCard
+                            total={stats.num_blocked_filtering}
+                            lineData={getLineData(stats.blocked_filtering, 'blockedFiltering')}
+                            percent={getPercent(stats.num_dns_queries, stats.num_blocked_filtering)}
+                            title={<Trans components={[<span key="0">text</span>]}>blocked_by</Trans>}
+                            color="red"
+                        />
+                    </div>
+
+                    <div className="col-sm-6 col-lg-3">
+                        <StatsCard
+                            total={stats.num_replaced_safebrowsing}
+                            lineData={getLineData(stats.replaced_safebrowsing, 'replacedSafebrowsing')}
+                            percent={getPercent(stats.num_dns_queries, stats.num_replaced_safebrowsing)}
+                            title={<Trans>stats_malware_phishing</Trans>}
+                            color="green"
+                        />
+                    </div>
+
+                    <div className="col-sm-6 col-lg-3">
+                        <StatsCard
+                            total={stats.num_replaced_parental}
+                            lineData={getLineData(stats.replaced_parental, 'replacedParental')}
+                            percent={getPercent(stats.num_dns_queries, stats.num_replaced_parental)}
+                            title={<Trans>stats_adult</Trans>}
+                            color="yellow"
+                        />
+                    </div>
+                </div>
+            )}
+        </div>
+    );
+};
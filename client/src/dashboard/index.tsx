@@ -0,0 +1,11 @@
+import React from 'react';
+import ReactDOM from 'react-dom';
+
+import '../components/App/index.css';
+import '../components/ui/Tabler.css';
+import '../components/Dashboard/Dashboard.css';
+import '../i18n';
+
+import { PublicDashboard } from './PublicDashboard';
+
+ReactDOM.render(<PublicDashboard />, document.getElementById('root'));
@@ -373,6 +373,15 @@ export const SPECIAL_FILTER_ID = {
     PARENTAL: -3,
     SAFE_BROWSING: -4,
     SAFE_SEARCH: -5,
+    THREAT_FEEDS: -6,
+    ALLOWLIST_ONLY: -7,
+    BLOCKED_TLDS: -8,
+    GEO_BLOCKING: -9,
+    NEW_DOMAINS: -10,
+    DGA: -11,
+    QTYPE_POLICY: -12,
+    HOMOGRAPH: -13,
+    CLIENT_QUOTA: -14,
 };
 
 export const BLOCK_ACTIONS = {
@@ -79,6 +79,7 @@ export const normalizeLogs = (logs: any) =>
             upstream,
             cached,
             ecs,
+            trace,
         } = log;
 
         const { name: domain, unicode_name: unicodeName, type } = question;
@@ -125,6 +126,7 @@ export const normalizeLogs = (logs: any) =>
             upstream,
             cached,
             ecs,
+            trace,
         };
     });
 
@@ -163,7 +165,7 @@ export const addClientInfo = (data: any, clients: any, ...params: any[]) =>
 export const normalizeFilters = (filters: any) =>
     filters
         ? filters.map((filter: any) => {
-              const { id, url, enabled, last_updated, name = 'Default name', rules_count = 0 } = filter;
+              const { id, url, enabled, last_updated, name = 'Default name', rules_count = 0, hits = 0 } = filter;
 
               return {
                   id,
@@ -172,6 +174,7 @@ export const normalizeFilters = (filters: any) =>
                   lastUpdated: last_updated,
                   name,
                   rulesCount: rules_count,
+                  hits,
               };
           })
         : [];
@@ -852,6 +855,24 @@ export const getSpecialFilterName = (filterId: any) => {
             return i18n.t('safe_browsing');
         case SPECIAL_FILTER_ID.SAFE_SEARCH:
             return i18n.t('safe_search');
+        case SPECIAL_FILTER_ID.THREAT_FEEDS:
+            return i18n.t('threat_feeds');
+        case SPECIAL_FILTER_ID.ALLOWLIST_ONLY:
+            return i18n.t('allowlist_only');
+        case SPECIAL_FILTER_ID.BLOCKED_TLDS:
+            return i18n.t('blocked_tlds');
+        case SPECIAL_FILTER_ID.GEO_BLOCKING:
+            return i18n.t('geo_blocking');
+        case SPECIAL_FILTER_ID.NEW_DOMAINS:
+            return i18n.t('new_domains');
+        case SPECIAL_FILTER_ID.DGA:
+            return i18n.t('dga_detection');
+        case SPECIAL_FILTER_ID.QTYPE_POLICY:
+            return i18n.t('qtype_policy');
+        case SPECIAL_FILTER_ID.HOMOGRAPH:
+            return i18n.t('homograph_detection');
+        case SPECIAL_FILTER_ID.CLIENT_QUOTA:
+            return i18n.t('client_quota');
         default:
             return i18n.t('unknown_filter', { filterId });
     }
@@ -863,6 +884,7 @@ export type Filter = {
     lastUpdated: string;
     name: string;
     rulesCount: number;
+    hits: number;
     url: string;
 };
 
@@ -935,6 +957,62 @@ export const getRulesToFilterList = (
     );
 };
 
+export type TraceStep = {
+    name: string;
+    reason: string;
+    rules: Rule[];
+};
+
+/**
+ * @param trace {TraceStep[]} steps of the filtering decision
+ * @returns {string} steps of the decision, one per line, with the matched rules
+ */
+export const formatDecisionTrace = (trace: TraceStep[]) =>
+    trace
+        .map(({ name, reason, rules }) => {
+            const matched = rules.map(({ text }) => text).join(', ');
+
+            return matched ? `${name}: ${reason} (${matched})` : `${name}: ${reason}`;
+        })
+        .join('\n');
+
+export type ClientDevice = {
+    vendor?: string;
+    os?: string;
+    type?: string;
+};
+
+/**
+ * @param device {ClientDevice} classification of the device of a client
+ * @returns {string} known properties of the device separated by commas or an
+ * empty string
+ */
+export const formatClientDevice = (device?: ClientDevice) =>
+    device ? [device.vendor, device.os, device.type].filter(Boolean).join(', ') : '';
+
+export type ClientIdentity = {
+    user?: string;
+    computer?: string;
+    groups?: string[];
+};
+
+/**
+ * @param identity {ClientIdentity} identity of the user and the computer of a
+ * client
+ * @returns {string} user and computer separated by "@", followed by the groups
+ * in parentheses, or an empty string
+ */
+export const formatClientIdentity = (identity?: ClientIdentity) => {
+    if (!identity) {
+        return '';
+    }
+
+    const name = [identity.user, identity.computer].filter(Boolean).join('@');
+    const groups = identity.groups?.length ? `(${identity.groups.join(', ')})` : '';
+
+    return [name, groups].filter(Boolean).join(' ');
+};
+
 /**
  * @param ip {string}
  * @param gateway_ip {string}
@@ -383,6 +383,15 @@ export type ServicesData = {
     list: any;
     allServices: any[];
     allGroups: any[];
+    processingTlds: boolean;
+    processingSetTlds: boolean;
+    tlds: BlockedTlds | null;
+};
+
+export type BlockedTlds = {
+    enabled: boolean;
+    suffixes: string[];
+    categories: string[];
 };
 
 export type RootState = {
@@ -597,6 +606,9 @@ export const initialState: RootState = {
         list: {},
         allServices: [],
         allGroups: [],
+        processingTlds: true,
+        processingSetTlds: false,
+        tlds: null,
     },
     settings: {
         processing: true,
@@ -45,6 +45,33 @@ const services = handleActions(
             ...state,
             processingSet: false,
         }),
+
+        [actions.getBlockedTldsRequest.toString()]: (state: any) => ({
+            ...state,
+            processingTlds: true,
+        }),
+        [actions.getBlockedTldsFailure.toString()]: (state: any) => ({
+            ...state,
+            processingTlds: false,
+        }),
+        [actions.getBlockedTldsSuccess.toString()]: (state, { payload }: any) => ({
+            ...state,
+            tlds: payload,
+            processingTlds: false,
+        }),
+
+        [actions.updateBlockedTldsRequest.toString()]: (state: any) => ({
+            ...state,
+            processingSetTlds: true,
+        }),
+        [actions.updateBlockedTldsFailure.toString()]: (state: any) => ({
+            ...state,
+            processingSetTlds: false,
+        }),
+        [actions.updateBlockedTldsSuccess.toString()]: (state: any) => ({
+            ...state,
+            processingSetTlds: false,
+        }),
     },
     {
         processing: true,
@@ -53,6 +80,9 @@ const services = handleActions(
         list: {},
         allServices: [],
         allGroups: [],
+        processingTlds: true,
+        processingSetTlds: false,
+        tlds: null,
     },
 );
 
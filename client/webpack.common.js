@@ -13,9 +13,11 @@ const RESOURCES_PATH = path.resolve(__dirname);
 const ENTRY_REACT = path.resolve(RESOURCES_PATH, 'src/index.tsx');
 const ENTRY_INSTALL = path.resolve(RESOURCES_PATH, 'src/install/index.tsx');
 const ENTRY_LOGIN = path.resolve(RESOURCES_PATH, 'src/login/index.tsx');
+const ENTRY_DASHBOARD = path.resolve(RESOURCES_PATH, 'src/dashboard/index.tsx');
 const HTML_PATH = path.resolve(RESOURCES_PATH, 'public/index.html');
 const HTML_INSTALL_PATH = path.resolve(RESOURCES_PATH, 'public/install.html');
 const HTML_LOGIN_PATH = path.resolve(RESOURCES_PATH, 'public/login.html');
+const HTML_DASHBOARD_PATH = path.resolve(RESOURCES_PATH, 'public/dashboard.html');
 const ASSETS_PATH = path.resolve(RESOURCES_PATH, 'public/assets');
 
 const PUBLIC_PATH = path.resolve(__dirname, '../build/static');
@@ -33,6 +35,7 @@ const config = {
         main: ENTRY_REACT,
         install: ENTRY_INSTALL,
         login: ENTRY_LOGIN,
+        dashboard: ENTRY_DASHBOARD,
     },
     output: {
         path: PUBLIC_PATH,
@@ -101,6 +104,13 @@ const config = {
             filename: 'login.html',
             template: HTML_LOGIN_PATH,
         }),
+        new HtmlWebpackPlugin({
+            inject: true,
+            cache: false,
+            chunks: ['dashboard'],
+            filename: 'dashboard.html',
+            template: HTML_DASHBOARD_PATH,
+        }),
         new MiniCssExtractPlugin({
             filename: isDev ? '[name].css' : '[name].[hash].css',
             chunkFilename: isDev ? '[id].css' : '[id].[hash].css',
@@ -0,0 +1,165 @@
+package aghnet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// NewBoundDialer returns a dialer, which connects from the source address src
+// or, if ifaceName isn't empty, from an address of the network interface with
+// this name of the same IP version as the remote address.  Exactly one of
+// ifaceName and src must be set.  The addresses of the interface are looked up
+// on each dial, so that the changes of them are taken into account.  timeout is
+// the timeout of connecting.
+//
+// Note that binding to a source address only affects the routing of the
+// connections if the system is configured to route them by the source address.
+func NewBoundDialer(ifaceName string, src netip.Addr, timeout time.Duration) (d ContextDialer, err error) {
+	switch {
+	case ifaceName == "" && !src.IsValid():
+		return nil, fmt.Errorf("interface and source address: %w", errors.ErrNoValue)
+	case ifaceName != "" && src.IsValid():
+		return nil, errors.Error("interface and source address are mutually exclusive")
+	}
+
+	return &boundDialer{
+		resolver:  net.DefaultResolver,
+		ifaceName: ifaceName,
+		src:       src.Unmap(),
+		timeout:   timeout,
+	}, nil
+}
+
+// boundDialer is a [ContextDialer] connecting from a particular source address
+// or network interface.
+type boundDialer struct {
+	// resolver resolves the host names of the remote addresses.  It must not
+	// be nil.
+	resolver *net.Resolver
+
+	// ifaceName is the name of the network interface.  It's empty if src is
+	// set.
+	ifaceName string
+
+	// src is the source address.  It's invalid if ifaceName is set.
+	src netip.Addr
+
+	// timeout is the timeout of connecting.
+	timeout time.Duration
+}
+
+// type check
+var _ ContextDialer = (*boundDialer)(nil)
+
+// DialContext implements the [ContextDialer] interface for *boundDialer.
+func (d *boundDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (conn net.Conn, err error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("parsing port: %w", err)
+	}
+
+	remote, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %q: %w", host, err)
+	}
+
+	local, err := d.localAddr(remote)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	nd := &net.Dialer{Timeout: d.timeout}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		nd.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(local, 0))
+	case "udp", "udp4", "udp6":
+		nd.LocalAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(local, 0))
+	default:
+		return nil, fmt.Errorf("network: %w: %q", errors.ErrBadEnumValue, network)
+	}
+
+	return nd.DialContext(ctx, network, netip.AddrPortFrom(remote, uint16(port)).String())
+}
+
+// resolve returns the IP address of host.  If the source address is set, the
+// address of the same IP version is preferred.
+func (d *boundDialer) resolve(ctx context.Context, host string) (ip netip.Addr, err error) {
+	ip, err = netip.ParseAddr(host)
+	if err == nil {
+		return ip.Unmap(), nil
+	}
+
+	network := "ip"
+	if d.src.IsValid() {
+		network = "ip6"
+		if d.src.Is4() {
+			network = "ip4"
+		}
+	}
+
+	ips, err := d.resolver.LookupNetIP(ctx, network, host)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return netip.Addr{}, err
+	} else if len(ips) == 0 {
+		return netip.Addr{}, errors.ErrNoValue
+	}
+
+	return ips[0].Unmap(), nil
+}
+
+// localAddr returns the source address for the connection to remote.
+func (d *boundDialer) localAddr(remote netip.Addr) (local netip.Addr, err error) {
+	if d.src.IsValid() {
+		if d.src.Is4() != remote.Is4() {
+			return netip.Addr{}, fmt.Errorf(
+				"source address %s and remote address %s have different ip versions",
+				d.src,
+				remote,
+			)
+		}
+
+		return d.src, nil
+	}
+
+	iface, err := net.InterfaceByName(d.ifaceName)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("interface %q: %w", d.ifaceName, err)
+	}
+
+	ipv := IPVersion6
+	if remote.Is4() {
+		ipv = IPVersion4
+	}
+
+	ips, err := IfaceIPAddrs(iface, ipv)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("interface %q: getting addresses: %w", d.ifaceName, err)
+	}
+
+	for _, ip := range ips {
+		local, ok := netip.AddrFromSlice(ip)
+		if ok && !local.IsLinkLocalUnicast() {
+			return local.Unmap(), nil
+		}
+	}
+
+	return netip.Addr{}, fmt.Errorf("interface %q: no ipv%d addresses", d.ifaceName, ipv)
+}
@@ -0,0 +1,100 @@
+package aghnet_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loopbackIfaceName returns the name of a loopback interface with an IPv4
+// address or skips the test if there is none.
+func loopbackIfaceName(t *testing.T) (name string) {
+	t.Helper()
+
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 {
+			continue
+		}
+
+		ips, ipsErr := aghnet.IfaceIPAddrs(&iface, aghnet.IPVersion4)
+		if ipsErr == nil && len(ips) > 0 {
+			return iface.Name
+		}
+	}
+
+	t.Skip("no loopback interface with ipv4 address")
+
+	return ""
+}
+
+func TestNewBoundDialer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	go func() {
+		for {
+			conn, acceptErr := l.Accept()
+			if acceptErr != nil {
+				return
+			}
+
+			_ = conn.Close()
+		}
+	}()
+
+	addr := l.Addr().String()
+	loopback := netip.MustParseAddr("127.0.0.1")
+
+	t.Run("source", func(t *testing.T) {
+		d, dErr := aghnet.NewBoundDialer("", loopback, testTimeout)
+		require.NoError(t, dErr)
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		conn, dErr := d.DialContext(ctx, "tcp", addr)
+		require.NoError(t, dErr)
+		testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+		local := testutil.RequireTypeAssert[*net.TCPAddr](t, conn.LocalAddr())
+		assert.Equal(t, loopback, local.AddrPort().Addr().Unmap())
+	})
+
+	t.Run("interface", func(t *testing.T) {
+		d, dErr := aghnet.NewBoundDialer(loopbackIfaceName(t), netip.Addr{}, testTimeout)
+		require.NoError(t, dErr)
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		conn, dErr := d.DialContext(ctx, "tcp", addr)
+		require.NoError(t, dErr)
+		testutil.CleanupAndRequireSuccess(t, conn.Close)
+	})
+
+	t.Run("ip_version_mismatch", func(t *testing.T) {
+		d, dErr := aghnet.NewBoundDialer("", netip.IPv6Loopback(), testTimeout)
+		require.NoError(t, dErr)
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		_, dErr = d.DialContext(ctx, "tcp", addr)
+		testutil.AssertErrorMsg(
+			t,
+			"source address ::1 and remote address 127.0.0.1 have different ip versions",
+			dErr,
+		)
+	})
+}
+
+func TestNewBoundDialer_errors(t *testing.T) {
+	_, err := aghnet.NewBoundDialer("", netip.Addr{}, testTimeout)
+	testutil.AssertErrorMsg(t, "interface and source address: no value", err)
+
+	_, err = aghnet.NewBoundDialer("eth0", netip.MustParseAddr("192.0.2.1"), testTimeout)
+	testutil.AssertErrorMsg(t, "interface and source address are mutually exclusive", err)
+}
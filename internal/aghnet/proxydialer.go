@@ -0,0 +1,150 @@
+package aghnet
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/net/proxy"
+)
+
+// ContextDialer dials network connections.
+type ContextDialer = proxy.ContextDialer
+
+// NewProxyDialer returns a dialer, which connects through the proxy server set
+// by u.  The supported schemes are "socks5", "socks5h", and "http", for the
+// HTTP CONNECT method.  The user information of u, if any, is used for
+// authentication.  timeout is the timeout of connecting to the proxy server.
+func NewProxyDialer(u *url.URL, timeout time.Duration) (d ContextDialer, err error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy url: host: %w", errors.ErrEmptyValue)
+	}
+
+	fwd := &net.Dialer{Timeout: timeout}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			pass, _ := u.User.Password()
+			auth = &proxy.Auth{
+				User:     u.User.Username(),
+				Password: pass,
+			}
+		}
+
+		var pd proxy.Dialer
+		pd, err = proxy.SOCKS5("tcp", u.Host, auth, fwd)
+		if err != nil {
+			return nil, fmt.Errorf("creating socks5 dialer: %w", err)
+		}
+
+		// The SOCKS5 dialer of package proxy implements ContextDialer.
+		return pd.(ContextDialer), nil
+	case "http":
+		return &httpConnectDialer{
+			fwd:   fwd,
+			user:  u.User,
+			proxy: u.Host,
+		}, nil
+	default:
+		return nil, fmt.Errorf("proxy url: scheme: %w: %q", errors.ErrBadEnumValue, u.Scheme)
+	}
+}
+
+// httpConnectDialer dials connections through an HTTP proxy server using the
+// CONNECT method.
+type httpConnectDialer struct {
+	// fwd dials the connections to the proxy server.
+	fwd *net.Dialer
+
+	// user is the optional user information for the basic authentication.
+	user *url.Userinfo
+
+	// proxy is the address of the proxy server.
+	proxy string
+}
+
+// type check
+var _ ContextDialer = (*httpConnectDialer)(nil)
+
+// DialContext implements the [ContextDialer] interface for
+// *httpConnectDialer.  network must be "tcp", "tcp4", or "tcp6".
+func (d *httpConnectDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (conn net.Conn, err error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		// Go on.
+	default:
+		return nil, fmt.Errorf("network: %w: %q", errors.ErrBadEnumValue, network)
+	}
+
+	conn, err = d.fwd.DialContext(ctx, "tcp", d.proxy)
+	if err != nil {
+		return nil, fmt.Errorf("dialing proxy: %w", err)
+	}
+
+	err = d.connect(ctx, conn, addr)
+	if err != nil {
+		return nil, errors.WithDeferred(err, conn.Close())
+	}
+
+	return conn, nil
+}
+
+// connect sends the CONNECT request for addr to conn and reads the response.
+func (d *httpConnectDialer) connect(ctx context.Context, conn net.Conn, addr string) (err error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return fmt.Errorf("setting deadline: %w", err)
+		}
+
+		defer func() { err = errors.WithDeferred(err, conn.SetDeadline(time.Time{})) }()
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+
+	if d.user != nil {
+		pass, _ := d.user.Password()
+		cred := base64.StdEncoding.EncodeToString([]byte(d.user.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+cred)
+	}
+
+	err = req.Write(conn)
+	if err != nil {
+		return fmt.Errorf("writing connect request: %w", err)
+	}
+
+	// The server doesn't send anything after the response until the client
+	// does, so the buffered data can be dropped.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return fmt.Errorf("reading connect response: %w", err)
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("closing connect response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("connect to %s: unexpected status %q", addr, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package aghnet_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startConnectProxy starts a fake HTTP proxy, which accepts a single CONNECT
+// request and echoes the data after it.  It returns the address of the proxy
+// and the channel receiving the request.
+func startConnectProxy(t *testing.T, status int) (addr string, reqCh <-chan *http.Request) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	ch := make(chan *http.Request, 1)
+	go func() {
+		conn, acceptErr := l.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		r, readErr := http.ReadRequest(bufio.NewReader(conn))
+		if readErr != nil {
+			return
+		}
+
+		ch <- r
+
+		resp := &http.Response{
+			StatusCode: status,
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+		}
+		if resp.Write(conn) != nil || status != http.StatusOK {
+			return
+		}
+
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	return l.Addr().String(), ch
+}
+
+func TestNewProxyDialer_http(t *testing.T) {
+	const target = "dns.example:853"
+
+	t.Run("success", func(t *testing.T) {
+		addr, reqCh := startConnectProxy(t, http.StatusOK)
+
+		d, err := aghnet.NewProxyDialer(&url.URL{
+			Scheme: "http",
+			User:   url.UserPassword("user", "pass"),
+			Host:   addr,
+		}, testTimeout)
+		require.NoError(t, err)
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		conn, err := d.DialContext(ctx, "tcp", target)
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+		r := <-reqCh
+		assert.Equal(t, http.MethodConnect, r.Method)
+		assert.Equal(t, target, r.Host)
+		assert.Equal(t, "Basic dXNlcjpwYXNz", r.Header.Get("Proxy-Authorization"))
+
+		data := []byte("test")
+		_, err = conn.Write(data)
+		require.NoError(t, err)
+
+		got := make([]byte, len(data))
+		_, err = io.ReadFull(conn, got)
+		require.NoError(t, err)
+
+		assert.Equal(t, data, got)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		addr, _ := startConnectProxy(t, http.StatusForbidden)
+
+		d, err := aghnet.NewProxyDialer(&url.URL{Scheme: "http", Host: addr}, testTimeout)
+		require.NoError(t, err)
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		_, err = d.DialContext(ctx, "tcp", target)
+		testutil.AssertErrorMsg(t, `connect to dns.example:853: unexpected status "403 Forbidden"`, err)
+	})
+
+	t.Run("udp", func(t *testing.T) {
+		d, err := aghnet.NewProxyDialer(&url.URL{Scheme: "http", Host: "127.0.0.1:1"}, testTimeout)
+		require.NoError(t, err)
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		_, err = d.DialContext(ctx, "udp", target)
+		testutil.AssertErrorMsg(t, `network: bad enum value: "udp"`, err)
+	})
+}
+
+func TestNewProxyDialer_errors(t *testing.T) {
+	testCases := []struct {
+		url        *url.URL
+		name       string
+		wantErrMsg string
+	}{{
+		url:        &url.URL{Scheme: "socks5", Host: "127.0.0.1:1080"},
+		name:       "socks5",
+		wantErrMsg: "",
+	}, {
+		url:        &url.URL{Scheme: "ftp", Host: "127.0.0.1:21"},
+		name:       "bad_scheme",
+		wantErrMsg: `proxy url: scheme: bad enum value: "ftp"`,
+	}, {
+		url:        &url.URL{Scheme: "http"},
+		name:       "no_host",
+		wantErrMsg: "proxy url: host: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := aghnet.NewProxyDialer(tc.url, testTimeout)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
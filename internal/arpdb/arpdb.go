@@ -37,6 +37,17 @@ type Interface interface {
 	Neighbors() (ns []Neighbor)
 }
 
+// Watcher reports the changes of the network neighborhood as soon as the OS
+// reports them, so that an [Interface] can be refreshed without waiting for the
+// next periodic refresh.
+type Watcher interface {
+	// Watch sends a value to updates each time the network neighborhood
+	// changes until ctx is canceled.  It must not block on sending, so that
+	// the changes, which happen while the previous value isn't received yet,
+	// are coalesced.  err is nil if ctx is canceled.
+	Watch(ctx context.Context, updates chan<- struct{}) (err error)
+}
+
 // New returns the [Interface] properly initialized for the OS.
 func New(logger *slog.Logger) (arp Interface) {
 	return newARPDB(logger, executil.SystemCommandConstructor{})
@@ -0,0 +1,110 @@
+//go:build linux
+
+package arpdb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// NewWatcher returns the [Watcher] properly initialized for the OS.  On Linux,
+// it receives the notifications about the changes of the neighbor tables from
+// the kernel via rtnetlink.
+func NewWatcher(logger *slog.Logger) (w Watcher, err error) {
+	return &netlinkWatcher{
+		logger: logger,
+	}, nil
+}
+
+// netlinkWatcher is the [Watcher] that subscribes to the rtnetlink multicast
+// group of the neighbor tables.
+type netlinkWatcher struct {
+	logger *slog.Logger
+}
+
+// type check
+var _ Watcher = (*netlinkWatcher)(nil)
+
+// Watch implements the [Watcher] interface for *netlinkWatcher.
+func (w *netlinkWatcher) Watch(ctx context.Context, updates chan<- struct{}) (err error) {
+	conn, err := netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{
+		Groups: unix.RTMGRP_NEIGH,
+	})
+	if err != nil {
+		return fmt.Errorf("dialing rtnetlink: %w", err)
+	}
+
+	// Closing the connection unblocks the receiving.
+	stop := context.AfterFunc(ctx, func() {
+		closeErr := conn.Close()
+		if closeErr != nil {
+			w.logger.DebugContext(ctx, "closing rtnetlink", slogutil.KeyError, closeErr)
+		}
+	})
+	defer func() {
+		if stop() {
+			err = errors.WithDeferred(err, conn.Close())
+		}
+	}()
+
+	for {
+		var msgs []netlink.Message
+		msgs, err = conn.Receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("receiving from rtnetlink: %w", err)
+		}
+
+		for _, msg := range msgs {
+			if isNeighborChange(msg) {
+				notify(updates)
+
+				break
+			}
+		}
+	}
+}
+
+// notify sends a value to updates unless there is one already.
+func notify(updates chan<- struct{}) {
+	select {
+	case updates <- struct{}{}:
+	default:
+	}
+}
+
+// ndmsgLenFamily is the minimum length of the data of an rtnetlink neighbor
+// message, which contains the address family.  See man 7 rtnetlink.
+const ndmsgLenFamily = 1
+
+// isNeighborChange returns true if msg is a notification about an added,
+// changed, or removed entry of the IPv4 ARP or the IPv6 NDP neighbor table.
+// Other families, such as the forwarding database of bridges, are ignored.
+func isNeighborChange(msg netlink.Message) (ok bool) {
+	switch msg.Header.Type {
+	case unix.RTM_NEWNEIGH, unix.RTM_DELNEIGH:
+		// Go on.
+	default:
+		return false
+	}
+
+	if len(msg.Data) < ndmsgLenFamily {
+		return false
+	}
+
+	switch msg.Data[0] {
+	case unix.AF_INET, unix.AF_INET6:
+		return true
+	default:
+		return false
+	}
+}
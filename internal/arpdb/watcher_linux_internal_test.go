@@ -0,0 +1,58 @@
+//go:build linux
+
+package arpdb
+
+import (
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestIsNeighborChange(t *testing.T) {
+	testCases := []struct {
+		name string
+		data []byte
+		typ  netlink.HeaderType
+		want bool
+	}{{
+		name: "new_inet",
+		data: []byte{unix.AF_INET, 0, 0, 0},
+		typ:  unix.RTM_NEWNEIGH,
+		want: true,
+	}, {
+		name: "del_inet6",
+		data: []byte{unix.AF_INET6, 0, 0, 0},
+		typ:  unix.RTM_DELNEIGH,
+		want: true,
+	}, {
+		name: "bridge",
+		data: []byte{unix.AF_BRIDGE, 0, 0, 0},
+		typ:  unix.RTM_NEWNEIGH,
+		want: false,
+	}, {
+		name: "route",
+		data: []byte{unix.AF_INET, 0, 0, 0},
+		typ:  unix.RTM_NEWROUTE,
+		want: false,
+	}, {
+		name: "empty",
+		data: nil,
+		typ:  unix.RTM_NEWNEIGH,
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := netlink.Message{
+				Header: netlink.Header{
+					Type: tc.typ,
+				},
+				Data: tc.data,
+			}
+
+			assert.Equal(t, tc.want, isNeighborChange(msg))
+		})
+	}
+}
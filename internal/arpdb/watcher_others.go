@@ -0,0 +1,17 @@
+//go:build !linux
+
+package arpdb
+
+import (
+	"log/slog"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// NewWatcher returns the [Watcher] properly initialized for the OS.  It
+// returns [errors.ErrUnsupported] on the OSes, which don't notify about the
+// changes of the network neighborhood, so that it can only be refreshed
+// periodically.
+func NewWatcher(_ *slog.Logger) (w Watcher, err error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
+)
+
+// arpBindings stores the hardware addresses of the network neighbors reported
+// by ARP, which are used to find the persistent clients by the MAC addresses
+// when there is no DHCP lease.  It's safe for concurrent use.
+type arpBindings struct {
+	// mu protects macs.
+	mu *sync.RWMutex
+
+	// macs maps the IP addresses of the neighbors to their hardware addresses.
+	macs map[netip.Addr]net.HardwareAddr
+}
+
+// newARPBindings returns a new properly initialized *arpBindings.
+func newARPBindings() (b *arpBindings) {
+	return &arpBindings{
+		mu:   &sync.RWMutex{},
+		macs: map[netip.Addr]net.HardwareAddr{},
+	}
+}
+
+// macByIP returns the hardware address of the neighbor with the IP address ip,
+// if any.
+func (b *arpBindings) macByIP(ip netip.Addr) (mac net.HardwareAddr) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.macs[ip]
+}
+
+// bindingChange is a change of the hardware address of a network neighbor.
+type bindingChange struct {
+	// prev is the previous hardware address.
+	prev net.HardwareAddr
+
+	// curr is the current hardware address.
+	curr net.HardwareAddr
+
+	// ip is the IP address of the neighbor.
+	ip netip.Addr
+}
+
+// update replaces the bindings with the ones from ns and returns the changes
+// of the hardware addresses of the neighbors, which have already been known.
+// The neighbors without hardware addresses are ignored.
+func (b *arpBindings) update(ns []arpdb.Neighbor) (changes []bindingChange) {
+	macs := make(map[netip.Addr]net.HardwareAddr, len(ns))
+	for _, n := range ns {
+		if len(n.MAC) > 0 {
+			macs[n.IP] = slices.Clone(n.MAC)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ip, curr := range macs {
+		prev, ok := b.macs[ip]
+		if ok && !slices.Equal(prev, curr) {
+			changes = append(changes, bindingChange{
+				prev: prev,
+				curr: curr,
+				ip:   ip,
+			})
+		}
+	}
+
+	b.macs = macs
+
+	slices.SortFunc(changes, func(a, b bindingChange) (res int) {
+		return a.ip.Compare(b.ip)
+	})
+
+	return changes
+}
@@ -10,6 +10,7 @@ import (
 	"net/netip"
 	"slices"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/netutil"
@@ -47,8 +48,11 @@ type Source uint8
 const (
 	SourceWHOIS Source = iota + 1
 	SourceARP
+	SourceDiscovery
 	SourceRDNS
+	SourceRouter
 	SourceDHCP
+	SourceVPN
 	SourceHostsFile
 	SourcePersistent
 )
@@ -63,10 +67,16 @@ func (cs Source) String() (s string) {
 		return "WHOIS"
 	case SourceARP:
 		return "ARP"
+	case SourceDiscovery:
+		return "discovery"
 	case SourceRDNS:
 		return "rDNS"
+	case SourceRouter:
+		return "router"
 	case SourceDHCP:
 		return "DHCP"
+	case SourceVPN:
+		return "VPN"
 	case SourceHostsFile:
 		return "etc/hosts"
 	default:
@@ -90,21 +100,42 @@ type Runtime struct {
 	// whois is the filtered WHOIS information of a client.
 	whois *whois.Info
 
+	// device is the classification of the device of a client by its DHCP
+	// fingerprint and hardware address.  It's set along with the dhcp
+	// information.
+	device *fingerprint.Device
+
 	// arp is the ARP information of a client.  nil indicates that there is no
 	// information from the source.  Empty non-nil slice indicates that the data
 	// from the source is present, but empty.
 	arp []string
 
+	// discovery is the information from the active discovery of the devices.
+	// nil indicates that there is no information from the source.  Empty
+	// non-nil slice indicates that the data from the source is present, but
+	// empty.
+	discovery []string
+
 	// rdns is the RDNS information of a client.  nil indicates that there is no
 	// information from the source.  Empty non-nil slice indicates that the data
 	// from the source is present, but empty.
 	rdns []string
 
+	// router is the information from the upstream router.  nil indicates that
+	// there is no information from the source.  Empty non-nil slice indicates
+	// that the data from the source is present, but empty.
+	router []string
+
 	// dhcp is the DHCP information of a client.  nil indicates that there is no
 	// information from the source.  Empty non-nil slice indicates that the data
 	// from the source is present, but empty.
 	dhcp []string
 
+	// vpn is the information from the peers of the VPN.  nil indicates that
+	// there is no information from the source.  Empty non-nil slice indicates
+	// that the data from the source is present, but empty.
+	vpn []string
+
 	// hostsFile is the information from the hosts file.  nil indicates that
 	// there is no information from the source.  Empty non-nil slice indicates
 	// that the data from the source is present, but empty.
@@ -127,10 +158,16 @@ func (r *Runtime) Info() (cs Source, host string) {
 	switch {
 	case r.hostsFile != nil:
 		cs, info = SourceHostsFile, r.hostsFile
+	case r.vpn != nil:
+		cs, info = SourceVPN, r.vpn
 	case r.dhcp != nil:
 		cs, info = SourceDHCP, r.dhcp
+	case r.router != nil:
+		cs, info = SourceRouter, r.router
 	case r.rdns != nil:
 		cs, info = SourceRDNS, r.rdns
+	case r.discovery != nil:
+		cs, info = SourceDiscovery, r.discovery
 	case r.arp != nil:
 		cs, info = SourceARP, r.arp
 	case r.whois != nil:
@@ -155,10 +192,16 @@ func (r *Runtime) setInfo(cs Source, hosts []string) {
 	switch cs {
 	case SourceARP:
 		r.arp = hosts
+	case SourceDiscovery:
+		r.discovery = hosts
 	case SourceRDNS:
 		r.rdns = hosts
+	case SourceRouter:
+		r.router = hosts
 	case SourceDHCP:
 		r.dhcp = hosts
+	case SourceVPN:
+		r.vpn = hosts
 	case SourceHostsFile:
 		r.hostsFile = hosts
 	}
@@ -174,6 +217,17 @@ func (r *Runtime) setWHOIS(info *whois.Info) {
 	r.whois = info
 }
 
+// Device returns a copy of the device classification of the client.  d is nil
+// if the device is unknown.
+func (r *Runtime) Device() (d *fingerprint.Device) {
+	return r.device.Clone()
+}
+
+// setDevice sets the device classification of the client.  d may be nil.
+func (r *Runtime) setDevice(d *fingerprint.Device) {
+	r.device = d
+}
+
 // unset clears a cs information.
 func (r *Runtime) unset(cs Source) {
 	switch cs {
@@ -181,10 +235,17 @@ func (r *Runtime) unset(cs Source) {
 		r.whois = nil
 	case SourceARP:
 		r.arp = nil
+	case SourceDiscovery:
+		r.discovery = nil
 	case SourceRDNS:
 		r.rdns = nil
+	case SourceRouter:
+		r.router = nil
 	case SourceDHCP:
 		r.dhcp = nil
+		r.device = nil
+	case SourceVPN:
+		r.vpn = nil
 	case SourceHostsFile:
 		r.hostsFile = nil
 	}
@@ -194,8 +255,11 @@ func (r *Runtime) unset(cs Source) {
 func (r *Runtime) isEmpty() (ok bool) {
 	return r.whois == nil &&
 		r.arp == nil &&
+		r.discovery == nil &&
 		r.rdns == nil &&
+		r.router == nil &&
 		r.dhcp == nil &&
+		r.vpn == nil &&
 		r.hostsFile == nil
 }
 
@@ -213,9 +277,13 @@ func (r *Runtime) clone() (c *Runtime) {
 	return &Runtime{
 		ip:        r.ip,
 		whois:     r.whois.Clone(),
+		device:    r.device.Clone(),
 		arp:       slices.Clone(r.arp),
+		discovery: slices.Clone(r.discovery),
 		rdns:      slices.Clone(r.rdns),
+		router:    slices.Clone(r.router),
 		dhcp:      slices.Clone(r.dhcp),
+		vpn:       slices.Clone(r.vpn),
 		hostsFile: slices.Clone(r.hostsFile),
 	}
 }
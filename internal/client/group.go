@@ -0,0 +1,264 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghslog"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// Group is a named group of persistent clients.  The member clients, which have
+// no own settings, inherit the settings of the group.  A nil or empty field
+// means that the setting is inherited from the parent group or, if there is
+// none, from the tags of the client or the global settings.
+type Group struct {
+	// BlockedServices is the configuration of the blocked services for the
+	// members, which use the global blocked services.
+	BlockedServices *filtering.BlockedServices `yaml:"blocked_services,omitempty"`
+
+	// FilteringEnabled defines if the filtering is enabled.
+	FilteringEnabled *bool `yaml:"filtering_enabled,omitempty"`
+
+	// SafeBrowsingEnabled defines if the safe browsing is enabled.
+	SafeBrowsingEnabled *bool `yaml:"safebrowsing_enabled,omitempty"`
+
+	// ParentalEnabled defines if the parental control is enabled.
+	ParentalEnabled *bool `yaml:"parental_enabled,omitempty"`
+
+	// SafeSearchEnabled defines if the safe search is enabled.
+	SafeSearchEnabled *bool `yaml:"safesearch_enabled,omitempty"`
+
+	// Name is the unique name of the group.  It must not be empty.
+	Name string `yaml:"name"`
+
+	// Parent is the name of the parent group, if any.
+	Parent string `yaml:"parent,omitempty"`
+
+	// Upstreams are the upstream DNS servers for the members without own
+	// upstreams.
+	Upstreams []string `yaml:"upstreams,omitempty"`
+
+	// FilterListIDs are the IDs of the blocklists applied to the requests of
+	// the members.
+	FilterListIDs []rules.ListID `yaml:"filter_list_ids,omitempty"`
+
+	// IgnoreQueryLog, if true, excludes the requests of the members and of the
+	// members of the descendant groups from the query log regardless of their
+	// own settings.
+	IgnoreQueryLog bool `yaml:"ignore_querylog,omitempty"`
+
+	// IgnoreStatistics, if true, excludes the requests of the members and of
+	// the members of the descendant groups from the statistics regardless of
+	// their own settings.
+	IgnoreStatistics bool `yaml:"ignore_statistics,omitempty"`
+}
+
+// groupIndex maps the names of the groups to the groups.  It must not be
+// modified after initialization.
+type groupIndex map[string]*Group
+
+// newGroupIndex validates groups and returns the index of their copies.  The
+// missing schedules of the blocked services are set to empty ones.  l must not
+// be nil.
+func newGroupIndex(ctx context.Context, l *slog.Logger, groups []*Group) (idx groupIndex, err error) {
+	idx = make(groupIndex, len(groups))
+	for i, g := range groups {
+		switch {
+		case g == nil:
+			return nil, fmt.Errorf("group at index %d: %w", i, errors.ErrNoValue)
+		case g.Name == "":
+			return nil, fmt.Errorf("group at index %d: name: %w", i, errors.ErrEmptyValue)
+		}
+
+		if _, ok := idx[g.Name]; ok {
+			return nil, fmt.Errorf("group %q: duplicate name", g.Name)
+		}
+
+		c := g.clone()
+		err = c.validate(ctx, l)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", g.Name, err)
+		}
+
+		idx[g.Name] = c
+	}
+
+	for _, g := range groups {
+		err = idx.validateParents(g.Name)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", g.Name, err)
+		}
+	}
+
+	return idx, nil
+}
+
+// clone returns a deep copy of g with a non-nil schedule of the blocked
+// services, if any.
+func (g *Group) clone() (c *Group) {
+	c = &Group{}
+	*c = *g
+
+	c.BlockedServices = g.BlockedServices.Clone()
+	if c.BlockedServices != nil && c.BlockedServices.Schedule == nil {
+		c.BlockedServices.Schedule = schedule.EmptyWeekly()
+	}
+
+	c.Upstreams = slices.Clone(g.Upstreams)
+	c.FilterListIDs = slices.Clone(g.FilterListIDs)
+
+	return c
+}
+
+// validate returns an error if the settings of g are invalid.  l must not be
+// nil.
+func (g *Group) validate(ctx context.Context, l *slog.Logger) (err error) {
+	if g.BlockedServices != nil {
+		err = g.BlockedServices.Validate()
+		if err != nil {
+			return fmt.Errorf("blocked services: %w", err)
+		}
+	}
+
+	conf, err := proxy.ParseUpstreamsConfig(g.Upstreams, &upstream.Options{
+		Logger: l.With(aghslog.KeyUpstreamType, aghslog.UpstreamTypeTest),
+	})
+	if err != nil {
+		return fmt.Errorf("invalid upstream servers: %w", err)
+	}
+
+	err = conf.Close()
+	if err != nil {
+		l.ErrorContext(ctx, "closing upstream config", "group", g.Name, slogutil.KeyError, err)
+	}
+
+	return nil
+}
+
+// validateParents returns an error if any of the ancestors of the group with
+// the given name doesn't exist or if the ancestors form a cycle.
+func (idx groupIndex) validateParents(name string) (err error) {
+	seen := map[string]struct{}{}
+	for g := idx[name]; g.Parent != ""; {
+		seen[g.Name] = struct{}{}
+
+		p, ok := idx[g.Parent]
+		if !ok {
+			return fmt.Errorf("parent: group %q is not found", g.Parent)
+		} else if _, ok = seen[p.Name]; ok {
+			return fmt.Errorf("parent: cycle at group %q", p.Name)
+		}
+
+		g = p
+	}
+
+	return nil
+}
+
+// validateMembership returns an error if the group of c doesn't exist.
+func (idx groupIndex) validateMembership(c *Persistent) (err error) {
+	if c.Group == "" {
+		return nil
+	}
+
+	if _, ok := idx[c.Group]; !ok {
+		return fmt.Errorf("group %q is not found", c.Group)
+	}
+
+	return nil
+}
+
+// chain returns the group with the given name followed by its ancestors.  It
+// returns nil if name is empty.  The groups must have been validated.
+func (idx groupIndex) chain(name string) (groups []*Group) {
+	for g := idx[name]; g != nil; g = idx[g.Parent] {
+		groups = append(groups, g)
+	}
+
+	return groups
+}
+
+// upstreams returns the upstreams of the nearest group in the chain of the
+// group with the given name, which has any.
+func (idx groupIndex) upstreams(name string) (ups []string) {
+	for _, g := range idx.chain(name) {
+		if len(stringutil.FilterOut(g.Upstreams, aghnet.IsCommentOrEmpty)) > 0 {
+			return g.Upstreams
+		}
+	}
+
+	return nil
+}
+
+// blockedServices returns the blocked services of the nearest group in the
+// chain of the group with the given name, which has them.
+func (idx groupIndex) blockedServices(name string) (svcs *filtering.BlockedServices) {
+	for _, g := range idx.chain(name) {
+		if g.BlockedServices != nil {
+			return g.BlockedServices
+		}
+	}
+
+	return nil
+}
+
+// ignores returns true for the query log and for the statistics, if any group
+// in the chain of the group with the given name excludes its members from them.
+func (idx groupIndex) ignores(name string) (queryLog, statistics bool) {
+	for _, g := range idx.chain(name) {
+		queryLog = queryLog || g.IgnoreQueryLog
+		statistics = statistics || g.IgnoreStatistics
+	}
+
+	return queryLog, statistics
+}
+
+// applySettings sets the filtering settings in setts from the chain of the
+// group with the given name.  Each setting is set from the nearest group,
+// which has it.  setts must not be nil.
+func (idx groupIndex) applySettings(name string, setts *filtering.Settings) {
+	var fe, sb, pc, ss *bool
+	var ids []rules.ListID
+	for _, g := range idx.chain(name) {
+		fe = cmp.Or(fe, g.FilteringEnabled)
+		sb = cmp.Or(sb, g.SafeBrowsingEnabled)
+		pc = cmp.Or(pc, g.ParentalEnabled)
+		ss = cmp.Or(ss, g.SafeSearchEnabled)
+
+		if ids == nil && len(g.FilterListIDs) > 0 {
+			ids = g.FilterListIDs
+		}
+	}
+
+	if fe != nil {
+		setts.FilteringEnabled = *fe
+	}
+
+	if sb != nil {
+		setts.SafeBrowsingEnabled = *sb
+	}
+
+	if pc != nil {
+		setts.ParentalEnabled = *pc
+	}
+
+	if ss != nil {
+		setts.SafeSearchEnabled = *ss
+	}
+
+	if ids != nil {
+		setts.FilterListIDs = slices.Clone(ids)
+	}
+}
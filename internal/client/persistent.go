@@ -10,12 +10,16 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghslog"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/google/uuid"
 )
 
@@ -68,6 +72,10 @@ type Persistent struct {
 	// Name of the persistent client.  Must not be empty.
 	Name string
 
+	// Group is the name of the group of the client, the settings of which the
+	// client inherits.  It may be empty.
+	Group string
+
 	// Tags is a list of client tags that categorize the client.
 	Tags []string
 
@@ -76,6 +84,21 @@ type Persistent struct {
 	// value of UpstreamsCacheEnabled.
 	Upstreams []string
 
+	// BootstrapDNS is a list of custom bootstrap DNS servers used to resolve
+	// the hostnames of the custom upstream DNS servers of the client.  If it's
+	// empty, the common bootstrap DNS servers are used.
+	BootstrapDNS []string
+
+	// FilterListIDs are the IDs of the blocklists applied to the requests of
+	// the client, if UseOwnSettings is true.  If it's empty, all enabled
+	// blocklists are applied.
+	FilterListIDs []rules.ListID
+
+	// Allowlist are the domain names the client may resolve, if AllowlistOnly
+	// is true.  Each domain name also allows its subdomains.  It's sorted and
+	// deduplicated after validation.
+	Allowlist []string
+
 	// IPs is a list of IP addresses that identify the client.  The client must
 	// have at least one ID (IP, subnet, MAC, or ClientID).
 	IPs []netip.Addr
@@ -119,6 +142,10 @@ type Persistent struct {
 	// UseOwnBlockedServices specifies whether custom services are blocked.
 	UseOwnBlockedServices bool
 
+	// AllowlistOnly specifies whether the client may only resolve the domain
+	// names from Allowlist.
+	AllowlistOnly bool
+
 	// IgnoreQueryLog specifies whether the client requests are logged.
 	IgnoreQueryLog bool
 
@@ -155,6 +182,11 @@ func (c *Persistent) validate(ctx context.Context, l *slog.Logger, allTags []str
 		l.ErrorContext(ctx, "client: closing upstream config", slogutil.KeyError, err)
 	}
 
+	err = validateBootstraps(ctx, l, c.BootstrapDNS)
+	if err != nil {
+		return fmt.Errorf("invalid bootstrap servers: %w", err)
+	}
+
 	for _, t := range c.Tags {
 		_, ok := slices.BinarySearch(allTags, t)
 		if !ok {
@@ -165,6 +197,56 @@ func (c *Persistent) validate(ctx context.Context, l *slog.Logger, allTags []str
 	// TODO(s.chzhen):  Move to the constructor.
 	slices.Sort(c.Tags)
 
+	c.Allowlist, err = normalizeAllowlist(c.Allowlist)
+	if err != nil {
+		return fmt.Errorf("invalid allowlist: %w", err)
+	}
+
+	return nil
+}
+
+// normalizeAllowlist returns the lowercased, sorted, and deduplicated domain
+// names from list.  It returns an error if any of them is invalid.
+func normalizeAllowlist(list []string) (normalized []string, err error) {
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	normalized = make([]string, 0, len(list))
+	for i, d := range list {
+		d = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), "."))
+		err = netutil.ValidateHostname(d)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		normalized = append(normalized, d)
+	}
+
+	slices.Sort(normalized)
+
+	return slices.Compact(normalized), nil
+}
+
+// validateBootstraps returns an error if any of the bootstrap DNS servers is
+// invalid.  l must not be nil.
+func validateBootstraps(ctx context.Context, l *slog.Logger, addrs []string) (err error) {
+	addrs = stringutil.FilterOut(addrs, aghnet.IsCommentOrEmpty)
+	boots, err := aghnet.ParseBootstraps(addrs, &upstream.Options{
+		Logger: l.With(aghslog.KeyUpstreamType, aghslog.UpstreamTypeTest),
+	})
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	for _, b := range boots {
+		err = b.Close()
+		if err != nil {
+			l.ErrorContext(ctx, "client: closing bootstrap", slogutil.KeyError, err)
+		}
+	}
+
 	return nil
 }
 
@@ -296,6 +378,9 @@ func (c *Persistent) ShallowClone() (clone *Persistent) {
 	clone.BlockedServices = c.BlockedServices.Clone()
 	clone.Tags = slices.Clone(c.Tags)
 	clone.Upstreams = slices.Clone(c.Upstreams)
+	clone.BootstrapDNS = slices.Clone(c.BootstrapDNS)
+	clone.FilterListIDs = slices.Clone(c.FilterListIDs)
+	clone.Allowlist = slices.Clone(c.Allowlist)
 
 	clone.IPs = slices.Clone(c.IPs)
 	clone.Subnets = slices.Clone(c.Subnets)
@@ -3,6 +3,7 @@ package client
 import (
 	"testing"
 
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -122,3 +123,38 @@ func TestPersistent_EqualIDs(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeAllowlist(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		in         []string
+		want       []string
+	}{{
+		name:       "empty",
+		wantErrMsg: "",
+		in:         nil,
+		want:       nil,
+	}, {
+		name:       "valid",
+		wantErrMsg: "",
+		in:         []string{"Kiosk.example.", "a.example", " kiosk.example"},
+		want:       []string{"a.example", "kiosk.example"},
+	}, {
+		name: "invalid",
+		wantErrMsg: `at index 1: bad hostname "bad host": ` +
+			`bad top-level domain name label "bad host": ` +
+			`bad top-level domain name label rune ' '`,
+		in:   []string{"a.example", "bad host"},
+		want: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeAllowlist(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
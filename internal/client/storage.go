@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"net/netip"
 	"slices"
@@ -12,7 +13,12 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/discovery"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
+	"github.com/AdguardTeam/AdGuardHome/internal/identity"
+	"github.com/AdguardTeam/AdGuardHome/internal/router"
+	"github.com/AdguardTeam/AdGuardHome/internal/vpn"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/golibs/errors"
@@ -110,14 +116,85 @@ type StorageConfig struct {
 	// ARPDB is used to update [SourceARP] runtime client information.
 	ARPDB arpdb.Interface
 
+	// ARPWatcher, if not nil, is used to refresh ARPDB as soon as the network
+	// neighborhood changes in addition to the periodic refreshing.
+	ARPWatcher arpdb.Watcher
+
+	// Discovery is used to update [SourceDiscovery] runtime client
+	// information.
+	Discovery discovery.Interface
+
+	// Router is used to update [SourceRouter] runtime client information and
+	// to match IPs against MACs of persistent clients, when there is no DHCP
+	// lease.
+	Router router.Interface
+
+	// VPN is used to update [SourceVPN] runtime client information and to
+	// match the tunnel addresses of the peers against the names of persistent
+	// clients.
+	VPN vpn.Interface
+
 	// InitialClients is a list of persistent clients parsed from the
 	// configuration file.  Each client must not be nil.
 	InitialClients []*Persistent
 
+	// TagUpstreams maps client tags to the custom upstream DNS servers used by
+	// the persistent clients with the tag, which have no own upstreams.  If a
+	// client has several such tags, the first one in alphabetical order is
+	// used.  It must not be modified after calling [NewStorage].
+	TagUpstreams map[string][]string
+
+	// TagProtection maps client tags to the configurations of the protection
+	// services for the persistent clients with the tag, which have no own
+	// settings.  If a client has several such tags, each service is configured
+	// by the first one in alphabetical order, which configures it.  It must not
+	// be modified after calling [NewStorage].
+	TagProtection map[string]*TagProtection
+
+	// Groups are the groups of the persistent clients.  The settings of a
+	// group take precedence over the settings of the tags of its members.
+	// Each group must not be nil.
+	Groups []*Group
+
+	// TagRules are the rules, which assign tags to the runtime clients.  Each
+	// rule must not be nil.
+	TagRules []*TagRule
+
+	// Identity, if not nil, is used to resolve the IP addresses of the clients
+	// to the identities of their users and computers.
+	Identity identity.Interface
+
+	// IdentityGroups maps the names of the directory groups from the
+	// identities to the names of the groups from Groups.  The clients, which
+	// aren't members of any group, get the settings of the group of the first
+	// directory group of their identity, which is mapped.  It must not be
+	// modified after calling [NewStorage].
+	IdentityGroups map[string]string
+
 	// ARPClientsUpdatePeriod defines how often [SourceARP] runtime client
 	// information is updated.
 	ARPClientsUpdatePeriod time.Duration
 
+	// ARPWatchDelay is the delay between the first change of the network
+	// neighborhood reported by ARPWatcher and the refreshing of ARPDB, so that
+	// a burst of changes causes a single refresh.  It must be greater than
+	// zero if ARPWatcher is not nil.
+	ARPWatchDelay time.Duration
+
+	// DiscoveryUpdatePeriod defines how often [SourceDiscovery] runtime client
+	// information is updated.  It must be greater than zero if Discovery is
+	// not nil.
+	DiscoveryUpdatePeriod time.Duration
+
+	// RouterUpdatePeriod defines how often [SourceRouter] runtime client
+	// information is updated.  It must be greater than zero if Router is not
+	// nil.
+	RouterUpdatePeriod time.Duration
+
+	// VPNUpdatePeriod defines how often [SourceVPN] runtime client information
+	// is updated.  It must be greater than zero if VPN is not nil.
+	VPNUpdatePeriod time.Duration
+
 	// RuntimeSourceDHCP specifies whether to update [SourceDHCP] information
 	// of runtime clients.
 	RuntimeSourceDHCP bool
@@ -150,9 +227,52 @@ type Storage struct {
 	// arpDB is used to update [SourceARP] runtime client information.
 	arpDB arpdb.Interface
 
+	// arpWatcher, if not nil, is used to refresh arpDB as soon as the network
+	// neighborhood changes.
+	arpWatcher arpdb.Watcher
+
+	// arpBindings stores the hardware addresses reported by arpDB.
+	arpBindings *arpBindings
+
+	// discovery is used to update [SourceDiscovery] runtime client
+	// information.
+	discovery discovery.Interface
+
+	// router is used to update [SourceRouter] runtime client information.
+	router router.Interface
+
+	// routerBindings stores the hardware addresses reported by router.
+	routerBindings *arpBindings
+
+	// vpn is used to update [SourceVPN] runtime client information.
+	vpn vpn.Interface
+
+	// vpnBindings stores the names of the peers reported by vpn.
+	vpnBindings *vpnBindings
+
 	// done is the shutdown signaling channel.
 	done chan struct{}
 
+	// tagProtection maps client tags to the configurations of the protection
+	// services.  It must not be modified after initialization.
+	tagProtection map[string]*TagProtection
+
+	// groups are the groups of the persistent clients.  It must not be
+	// modified after initialization.
+	groups groupIndex
+
+	// tagRules are the rules, which assign tags to the runtime clients.  It
+	// must not be modified after initialization.
+	tagRules []*tagRule
+
+	// identity is used to resolve the IP addresses of the clients to their
+	// identities.
+	identity identity.Interface
+
+	// identityGroups maps the names of the directory groups to the names of
+	// the groups.  It must not be modified after initialization.
+	identityGroups map[string]string
+
 	// allowedTags is a sorted list of all allowed tags.  It must not be
 	// modified after initialization.
 	//
@@ -163,6 +283,22 @@ type Storage struct {
 	// information is updated.  It must be greater than zero.
 	arpClientsUpdatePeriod time.Duration
 
+	// arpWatchDelay is the delay between the first change reported by
+	// arpWatcher and the refreshing of arpDB.
+	arpWatchDelay time.Duration
+
+	// discoveryUpdatePeriod defines how often [SourceDiscovery] runtime client
+	// information is updated.
+	discoveryUpdatePeriod time.Duration
+
+	// routerUpdatePeriod defines how often [SourceRouter] runtime client
+	// information is updated.
+	routerUpdatePeriod time.Duration
+
+	// vpnUpdatePeriod defines how often [SourceVPN] runtime client information
+	// is updated.
+	vpnUpdatePeriod time.Duration
+
 	// runtimeSourceDHCP specifies whether to update [SourceDHCP] information
 	// of runtime clients.
 	runtimeSourceDHCP bool
@@ -173,18 +309,65 @@ func NewStorage(ctx context.Context, conf *StorageConfig) (s *Storage, err error
 	tags := slices.Clone(allowedTags)
 	slices.Sort(tags)
 
+	err = validateTagUpstreams(ctx, conf.Logger, tags, conf.TagUpstreams)
+	if err != nil {
+		return nil, fmt.Errorf("tag upstreams: %w", err)
+	}
+
+	err = validateTagProtection(tags, conf.TagProtection)
+	if err != nil {
+		return nil, fmt.Errorf("tag protection: %w", err)
+	}
+
+	tagRules, err := newTagRules(tags, conf.TagRules)
+	if err != nil {
+		return nil, fmt.Errorf("tag rules: %w", err)
+	}
+
+	groups, err := newGroupIndex(ctx, conf.Logger, conf.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("groups: %w", err)
+	}
+
+	for dirGroup, g := range conf.IdentityGroups {
+		if _, ok := groups[g]; !ok {
+			return nil, fmt.Errorf("identity groups: %q: group %q is not found", dirGroup, g)
+		}
+	}
+
+	idSrc := conf.Identity
+	if idSrc == nil {
+		idSrc = identity.Empty{}
+	}
+
 	s = &Storage{
 		logger:                 conf.Logger,
 		mu:                     &sync.Mutex{},
 		index:                  newIndex(),
 		runtimeIndex:           newRuntimeIndex(),
-		upstreamManager:        newUpstreamManager(conf.BaseLogger, conf.Clock),
+		upstreamManager:        newUpstreamManager(conf.BaseLogger, conf.Clock, conf.TagUpstreams, groups),
 		dhcp:                   conf.DHCP,
 		etcHosts:               conf.EtcHosts,
 		arpDB:                  conf.ARPDB,
+		arpWatcher:             conf.ARPWatcher,
+		arpBindings:            newARPBindings(),
 		done:                   make(chan struct{}),
+		tagProtection:          conf.TagProtection,
+		groups:                 groups,
+		tagRules:               tagRules,
+		identity:               idSrc,
+		identityGroups:         conf.IdentityGroups,
 		allowedTags:            tags,
 		arpClientsUpdatePeriod: conf.ARPClientsUpdatePeriod,
+		arpWatchDelay:          conf.ARPWatchDelay,
+		discovery:              conf.Discovery,
+		discoveryUpdatePeriod:  conf.DiscoveryUpdatePeriod,
+		router:                 conf.Router,
+		routerBindings:         newARPBindings(),
+		routerUpdatePeriod:     conf.RouterUpdatePeriod,
+		vpn:                    conf.VPN,
+		vpnBindings:            newVPNBindings(),
+		vpnUpdatePeriod:        conf.VPNUpdatePeriod,
 		runtimeSourceDHCP:      conf.RuntimeSourceDHCP,
 	}
 
@@ -207,6 +390,22 @@ func (s *Storage) Start(ctx context.Context) (err error) {
 	go s.periodicARPUpdate(ctx)
 	go s.handleHostsUpdates(ctx)
 
+	if s.arpWatcher != nil {
+		go s.watchARP(ctx)
+	}
+
+	if s.discovery != nil {
+		go s.periodicDiscoveryUpdate(ctx)
+	}
+
+	if s.router != nil {
+		go s.periodicRouterUpdate(ctx)
+	}
+
+	if s.vpn != nil {
+		go s.periodicVPNUpdate(ctx)
+	}
+
 	return nil
 }
 
@@ -236,6 +435,49 @@ func (s *Storage) periodicARPUpdate(ctx context.Context) {
 	}
 }
 
+// watchARP reloads runtime clients from ARP each time s.arpWatcher reports a
+// change of the network neighborhood.  It is intended to be used as a
+// goroutine.
+func (s *Storage) watchARP(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	// Don't use the cancellation of the parent context, since the watching
+	// must only stop on shutdown.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	updates := make(chan struct{}, 1)
+	go func() {
+		defer slogutil.RecoverAndLog(ctx, s.logger)
+
+		err := s.arpWatcher.Watch(ctx, updates)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "watching arp changes", slogutil.KeyError, err)
+		}
+	}()
+
+	t := time.NewTimer(s.arpWatchDelay)
+	t.Stop()
+
+	pending := false
+	for {
+		select {
+		case <-updates:
+			if !pending {
+				pending = true
+				t.Reset(s.arpWatchDelay)
+			}
+		case <-t.C:
+			pending = false
+			s.ReloadARP(ctx)
+		case <-s.done:
+			t.Stop()
+
+			return
+		}
+	}
+}
+
 // ReloadARP reloads runtime clients from ARP, if configured.
 func (s *Storage) ReloadARP(ctx context.Context) {
 	if s.arpDB != nil {
@@ -263,6 +505,8 @@ func (s *Storage) addFromSystemARP(ctx context.Context) {
 		return
 	}
 
+	s.updateARPBindings(ctx, ns)
+
 	src := SourceARP
 	s.runtimeIndex.clearSource(src)
 
@@ -280,6 +524,232 @@ func (s *Storage) addFromSystemARP(ctx context.Context) {
 	)
 }
 
+// updateARPBindings updates the hardware addresses of the neighbors from ns
+// and logs the changed ones, since such a change means that the persistent
+// client matched by the IP address may have changed.
+func (s *Storage) updateARPBindings(ctx context.Context, ns []arpdb.Neighbor) {
+	for _, c := range s.arpBindings.update(ns) {
+		s.logger.InfoContext(
+			ctx,
+			"arp binding changed",
+			"ip", c.ip,
+			"prev_mac", c.prev,
+			"mac", c.curr,
+		)
+	}
+}
+
+// macByIP returns the hardware address of the client with the IP address ip
+// from the DHCP leases or, if there is none, from the upstream router or ARP.
+func (s *Storage) macByIP(ip netip.Addr) (mac net.HardwareAddr) {
+	mac = s.dhcp.MACByIP(ip)
+	if mac != nil {
+		return mac
+	}
+
+	mac = s.routerBindings.macByIP(ip)
+	if mac != nil {
+		return mac
+	}
+
+	return s.arpBindings.macByIP(ip)
+}
+
+// periodicDiscoveryUpdate reloads runtime clients from the active discovery
+// immediately and then periodically.  It is intended to be used as a
+// goroutine.
+func (s *Storage) periodicDiscoveryUpdate(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	s.ReloadDiscovery(ctx)
+
+	t := time.NewTicker(s.discoveryUpdatePeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.ReloadDiscovery(ctx)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// ReloadDiscovery probes the network and reloads runtime clients from the
+// discovered devices, if configured.  The storage isn't locked while probing,
+// since it may take a while.
+func (s *Storage) ReloadDiscovery(ctx context.Context) {
+	if s.discovery == nil {
+		return
+	}
+
+	err := s.discovery.Refresh(ctx)
+	if err != nil {
+		// Don't return, since the devices from the other interfaces may still
+		// be discovered.
+		s.logger.ErrorContext(ctx, "refreshing discovery", slogutil.KeyError, err)
+	}
+
+	ds := s.discovery.Devices()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src := SourceDiscovery
+	s.runtimeIndex.clearSource(src)
+
+	for _, d := range ds {
+		s.runtimeIndex.setInfo(d.IP, src, []string{d.Name})
+	}
+
+	removed := s.runtimeIndex.removeEmpty()
+
+	s.logger.DebugContext(
+		ctx,
+		"updating client aliases from discovery",
+		"added", len(ds),
+		"removed", removed,
+	)
+}
+
+// periodicRouterUpdate reloads runtime clients from the upstream router
+// immediately and then periodically.  It is intended to be used as a
+// goroutine.
+func (s *Storage) periodicRouterUpdate(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	s.ReloadRouter(ctx)
+
+	t := time.NewTicker(s.routerUpdatePeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.ReloadRouter(ctx)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// ReloadRouter requests the clients from the upstream router and reloads
+// runtime clients from them, if configured.  The previous information is kept,
+// if the router is unavailable.  The storage isn't locked while requesting.
+func (s *Storage) ReloadRouter(ctx context.Context) {
+	if s.router == nil {
+		return
+	}
+
+	err := s.router.Refresh(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "refreshing router clients", slogutil.KeyError, err)
+
+		return
+	}
+
+	cs := s.router.Clients()
+	ns := make([]arpdb.Neighbor, 0, len(cs))
+	for _, c := range cs {
+		ns = append(ns, arpdb.Neighbor{
+			Name: c.Name,
+			IP:   c.IP,
+			MAC:  c.MAC,
+		})
+	}
+
+	s.routerBindings.update(ns)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src := SourceRouter
+	s.runtimeIndex.clearSource(src)
+
+	for _, c := range cs {
+		s.runtimeIndex.setInfo(c.IP, src, []string{c.Name})
+	}
+
+	removed := s.runtimeIndex.removeEmpty()
+
+	s.logger.DebugContext(
+		ctx,
+		"updating client aliases from router",
+		"added", len(cs),
+		"removed", removed,
+	)
+}
+
+// periodicVPNUpdate reloads runtime clients from the VPN peers immediately and
+// then periodically.  It is intended to be used as a goroutine.
+func (s *Storage) periodicVPNUpdate(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	s.ReloadVPN(ctx)
+
+	t := time.NewTicker(s.vpnUpdatePeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.ReloadVPN(ctx)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// ReloadVPN reads the peers of the VPN and reloads runtime clients from them,
+// if configured.  The previous information is kept, if the peers can't be
+// read.  The storage isn't locked while reading.
+func (s *Storage) ReloadVPN(ctx context.Context) {
+	if s.vpn == nil {
+		return
+	}
+
+	err := s.vpn.Refresh(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "refreshing vpn peers", slogutil.KeyError, err)
+
+		return
+	}
+
+	ps := s.vpn.Peers()
+	s.vpnBindings.update(ps)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src := SourceVPN
+	s.runtimeIndex.clearSource(src)
+
+	for _, p := range ps {
+		s.runtimeIndex.setInfo(p.IP, src, []string{p.Name})
+	}
+
+	removed := s.runtimeIndex.removeEmpty()
+
+	s.logger.DebugContext(
+		ctx,
+		"updating client aliases from vpn",
+		"added", len(ps),
+		"removed", removed,
+	)
+}
+
+// findByVPN finds the persistent client with the name of the VPN peer with the
+// tunnel address addr.
+func (s *Storage) findByVPN(addr netip.Addr) (p *Persistent, ok bool) {
+	name := s.vpnBindings.nameByIP(addr)
+	if name == "" {
+		return nil, false
+	}
+
+	return s.index.findByName(name)
+}
+
 // handleHostsUpdates receives the updates from the hosts container and adds
 // them to the clients storage.  It is intended to be used as a goroutine.
 func (s *Storage) handleHostsUpdates(ctx context.Context) {
@@ -369,7 +839,8 @@ func (s *Storage) UpdateDHCP(ctx context.Context) {
 
 	added := 0
 	for _, l := range s.dhcp.Leases() {
-		s.runtimeIndex.setInfo(l.IP, src, []string{l.Hostname})
+		rc := s.runtimeIndex.setInfo(l.IP, src, []string{l.Hostname})
+		rc.setDevice(fingerprint.Classify(l.HWAddr, l.Fingerprint))
 		added++
 	}
 
@@ -416,6 +887,12 @@ func (s *Storage) Add(ctx context.Context, p *Persistent) (err error) {
 		return err
 	}
 
+	err = s.groups.validateMembership(p)
+	if err != nil {
+		// Don't wrap the error since there is already an annotation deferred.
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -567,12 +1044,15 @@ func (s *Storage) findByIP(addr netip.Addr) (p *Persistent, ok bool) {
 		return p, true
 	}
 
-	foundMAC := s.dhcp.MACByIP(addr)
+	foundMAC := s.macByIP(addr)
 	if foundMAC != nil {
-		return s.index.findByMAC(foundMAC)
+		p, ok = s.index.findByMAC(foundMAC)
+		if ok {
+			return p, true
+		}
 	}
 
-	return nil, false
+	return s.findByVPN(addr)
 }
 
 // FindLoose is like [Storage.Find] but it also tries to find a persistent
@@ -593,11 +1073,16 @@ func (s *Storage) FindLoose(ip netip.Addr, id string) (p *Persistent, ok bool) {
 		return p.ShallowClone(), ok
 	}
 
-	foundMAC := s.dhcp.MACByIP(ip)
+	foundMAC := s.macByIP(ip)
 	if foundMAC != nil {
 		return s.index.findByMAC(foundMAC)
 	}
 
+	p, ok = s.findByVPN(ip)
+	if ok {
+		return p.ShallowClone(), true
+	}
+
 	p = s.index.findByIPWithoutZone(ip)
 	if p != nil {
 		return p.ShallowClone(), true
@@ -606,6 +1091,20 @@ func (s *Storage) FindLoose(ip netip.Addr, id string) (p *Persistent, ok bool) {
 	return nil, false
 }
 
+// FindByName returns a shallow copy of the persistent client with the given
+// name.  ok is false if there is no such client.
+func (s *Storage) FindByName(name string) (p *Persistent, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok = s.index.findByName(name)
+	if !ok {
+		return nil, false
+	}
+
+	return p.ShallowClone(), true
+}
+
 // RemoveByName removes persistent client information.  ok is false if no such
 // client exists by that name.
 func (s *Storage) RemoveByName(ctx context.Context, name string) (ok bool) {
@@ -638,6 +1137,12 @@ func (s *Storage) Update(ctx context.Context, name string, p *Persistent) (err e
 		return err
 	}
 
+	err = s.groups.validateMembership(p)
+	if err != nil {
+		// Don't wrap the error since there is already an annotation deferred.
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -665,6 +1170,15 @@ func (s *Storage) Update(ctx context.Context, name string, p *Persistent) (err e
 	return nil
 }
 
+// GroupNames returns the sorted names of the groups of the persistent clients.
+// names is never nil.
+func (s *Storage) GroupNames() (names []string) {
+	names = slices.AppendSeq(make([]string, 0, len(s.groups)), maps.Keys(s.groups))
+	slices.Sort(names)
+
+	return names
+}
+
 // RangeByName calls f for each persistent client sorted by name, unless cont is
 // false.
 func (s *Storage) RangeByName(f func(c *Persistent) (cont bool)) {
@@ -774,27 +1288,45 @@ func (s *Storage) ApplyClientFiltering(id string, addr netip.Addr, setts *filter
 	}
 
 	if !ok {
-		foundMAC := s.dhcp.MACByIP(addr)
+		foundMAC := s.macByIP(addr)
 		if foundMAC != nil {
 			c, ok = s.index.findByMAC(foundMAC)
 		}
 	}
 
 	if !ok {
-		s.logger.Debug("no client filtering settings found", "clientid", id, "addr", addr)
+		c, ok = s.findByVPN(addr)
+	}
+
+	ctx := context.TODO()
+
+	if !ok {
+		s.applyRuntimeFiltering(ctx, addr, setts)
 
 		return
 	}
 
 	s.logger.Debug("applying custom client filtering settings", "client_name", c.Name)
 
+	group := c.Group
+	if group == "" {
+		group = s.identityGroup(ctx, addr)
+	}
+
 	if c.UseOwnBlockedServices {
 		setts.BlockedServices = c.BlockedServices.Clone()
+	} else if svcs := s.groups.blockedServices(group); svcs != nil {
+		setts.BlockedServices = svcs.Clone()
 	}
 
 	setts.ClientName = c.Name
 	setts.ClientTags = slices.Clone(c.Tags)
+	setts.AllowlistOnly = c.AllowlistOnly
+	setts.Allowlist = c.Allowlist
 	if !c.UseOwnSettings {
+		applyTagProtection(s.tagProtection, c.Tags, setts)
+		s.groups.applySettings(group, setts)
+
 		return
 	}
 
@@ -803,4 +1335,103 @@ func (s *Storage) ApplyClientFiltering(id string, addr netip.Addr, setts *filter
 	setts.ClientSafeSearch = c.SafeSearch
 	setts.SafeBrowsingEnabled = c.SafeBrowsingEnabled
 	setts.ParentalEnabled = c.ParentalEnabled
+	setts.FilterListIDs = slices.Clone(c.FilterListIDs)
+}
+
+// applyRuntimeFiltering applies the settings of the tags assigned by the tag
+// rules and then of the group of the identity of the client with the IP address
+// addr, which isn't a persistent client, to setts.
+func (s *Storage) applyRuntimeFiltering(ctx context.Context, addr netip.Addr, setts *filtering.Settings) {
+	tags := s.RuntimeTags(addr)
+	group := s.identityGroup(ctx, addr)
+	if len(tags) == 0 && group == "" {
+		s.logger.DebugContext(ctx, "no client filtering settings found", "addr", addr)
+
+		return
+	}
+
+	if len(tags) > 0 {
+		s.logger.DebugContext(ctx, "applying runtime client tags", "addr", addr, "tags", tags)
+
+		setts.ClientTags = tags
+		applyTagProtection(s.tagProtection, tags, setts)
+	}
+
+	if group == "" {
+		return
+	}
+
+	s.logger.DebugContext(ctx, "applying identity group filtering settings", "addr", addr, "group", group)
+
+	if svcs := s.groups.blockedServices(group); svcs != nil {
+		setts.BlockedServices = svcs.Clone()
+	}
+
+	s.groups.applySettings(group, setts)
+}
+
+// identityGroup returns the name of the group mapped from the first directory
+// group of the identity of the client with the IP address addr, which is
+// mapped.  group is empty if there is none.
+func (s *Storage) identityGroup(ctx context.Context, addr netip.Addr) (group string) {
+	if len(s.identityGroups) == 0 {
+		return ""
+	}
+
+	id := s.identity.Identity(ctx, addr)
+	if id == nil {
+		return ""
+	}
+
+	for _, dirGroup := range id.Groups {
+		if g, ok := s.identityGroups[dirGroup]; ok {
+			return g
+		}
+	}
+
+	return ""
+}
+
+// Identity returns the identity of the client with the IP address ip, if it's
+// known.
+func (s *Storage) Identity(ctx context.Context, ip netip.Addr) (id *identity.Identity) {
+	return s.identity.Identity(ctx, ip)
+}
+
+// RuntimeTags returns the sorted tags assigned by the tag rules to the runtime
+// client with the IP address ip.  tags is nil if there are none.
+func (s *Storage) RuntimeTags(ip netip.Addr) (tags []string) {
+	if len(s.tagRules) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &tagRuleParams{
+		mac: s.macByIP(ip),
+		ip:  ip,
+	}
+
+	if rc := s.runtimeIndex.client(ip); rc != nil {
+		_, p.host = rc.Info()
+		if d := rc.Device(); d != nil {
+			p.dhcpFingerprint = d.DHCPFingerprint
+		}
+	}
+
+	if p.host == "" && s.runtimeSourceDHCP {
+		p.host = s.dhcp.HostByIP(ip)
+	}
+
+	return matchTagRules(s.tagRules, p)
+}
+
+// Ignores returns true for the query log and for the statistics, if the
+// requests of p are excluded from them either by its own settings or by any of
+// its groups.  p must not be nil.
+func (s *Storage) Ignores(p *Persistent) (queryLog, statistics bool) {
+	queryLog, statistics = s.groups.ignores(p.Group)
+
+	return queryLog || p.IgnoreQueryLog, statistics || p.IgnoreStatistics
 }
@@ -14,7 +14,13 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/discovery"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
+	"github.com/AdguardTeam/AdGuardHome/internal/identity"
+	"github.com/AdguardTeam/AdGuardHome/internal/router"
+	"github.com/AdguardTeam/AdGuardHome/internal/vpn"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/hostsfile"
@@ -93,6 +99,89 @@ func (c *testARPDB) Neighbors() (ns []arpdb.Neighbor) {
 	return c.onNeighbors()
 }
 
+// testARPWatcher is a mock implementation of the [arpdb.Watcher].
+type testARPWatcher struct {
+	onWatch func(ctx context.Context, updates chan<- struct{}) (err error)
+}
+
+// type check
+var _ arpdb.Watcher = (*testARPWatcher)(nil)
+
+// Watch implements the [arpdb.Watcher] interface for *testARPWatcher.
+func (w *testARPWatcher) Watch(ctx context.Context, updates chan<- struct{}) (err error) {
+	return w.onWatch(ctx, updates)
+}
+
+// testIdentity is a mock implementation of the [identity.Interface].
+type testIdentity struct {
+	onIdentity func(ctx context.Context, ip netip.Addr) (id *identity.Identity)
+}
+
+// type check
+var _ identity.Interface = (*testIdentity)(nil)
+
+// Identity implements the [identity.Interface] interface for *testIdentity.
+func (i *testIdentity) Identity(ctx context.Context, ip netip.Addr) (id *identity.Identity) {
+	return i.onIdentity(ctx, ip)
+}
+
+// testDiscovery is a mock implementation of the [discovery.Interface].
+type testDiscovery struct {
+	onRefresh func(ctx context.Context) (err error)
+	onDevices func() (ds []discovery.Device)
+}
+
+// type check
+var _ discovery.Interface = (*testDiscovery)(nil)
+
+// Refresh implements the [discovery.Interface] interface for *testDiscovery.
+func (d *testDiscovery) Refresh(ctx context.Context) (err error) {
+	return d.onRefresh(ctx)
+}
+
+// Devices implements the [discovery.Interface] interface for *testDiscovery.
+func (d *testDiscovery) Devices() (ds []discovery.Device) {
+	return d.onDevices()
+}
+
+// testRouter is a mock implementation of the [router.Interface].
+type testRouter struct {
+	onRefresh func(ctx context.Context) (err error)
+	onClients func() (cs []router.Client)
+}
+
+// type check
+var _ router.Interface = (*testRouter)(nil)
+
+// Refresh implements the [router.Interface] interface for *testRouter.
+func (r *testRouter) Refresh(ctx context.Context) (err error) {
+	return r.onRefresh(ctx)
+}
+
+// Clients implements the [router.Interface] interface for *testRouter.
+func (r *testRouter) Clients() (cs []router.Client) {
+	return r.onClients()
+}
+
+// testVPN is a mock implementation of the [vpn.Interface].
+type testVPN struct {
+	onRefresh func(ctx context.Context) (err error)
+	onPeers   func() (ps []vpn.Peer)
+}
+
+// type check
+var _ vpn.Interface = (*testVPN)(nil)
+
+// Refresh implements the [vpn.Interface] interface for *testVPN.
+func (v *testVPN) Refresh(ctx context.Context) (err error) {
+	return v.onRefresh(ctx)
+}
+
+// Peers implements the [vpn.Interface] interface for *testVPN.
+func (v *testVPN) Peers() (ps []vpn.Peer) {
+	return v.onPeers()
+}
+
 // testDHCP is a mock implementation of the [client.DHCP].
 type testDHCP struct {
 	OnLeases func() (leases []*dhcpsvc.Lease)
@@ -275,6 +364,274 @@ func TestStorage_Add_arp(t *testing.T) {
 	})
 }
 
+func TestStorage_ARPWatcher(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		neighbors []arpdb.Neighbor
+
+		cliIP = netip.MustParseAddr("1.1.1.1")
+
+		mac1 = net.HardwareAddr{0x11, 0x11, 0x11, 0x11, 0x11, 0x11}
+		mac2 = net.HardwareAddr{0x22, 0x22, 0x22, 0x22, 0x22, 0x22}
+	)
+
+	setNeighbors := func(mac net.HardwareAddr) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		neighbors = []arpdb.Neighbor{{
+			IP:  cliIP,
+			MAC: mac,
+		}}
+	}
+
+	setNeighbors(mac1)
+
+	a := &testARPDB{
+		onRefresh: func(_ context.Context) (err error) { return nil },
+		onNeighbors: func() (ns []arpdb.Neighbor) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return neighbors
+		},
+	}
+
+	updates := make(chan chan<- struct{}, 1)
+	w := &testARPWatcher{
+		onWatch: func(ctx context.Context, upd chan<- struct{}) (err error) {
+			updates <- upd
+			<-ctx.Done()
+
+			return nil
+		},
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	storage, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		DHCP:       client.EmptyDHCP{},
+		ARPDB:      a,
+		ARPWatcher: w,
+		// Don't refresh periodically to check the watching.
+		ARPClientsUpdatePeriod: time.Hour,
+		ARPWatchDelay:          testTimeout / 10,
+		InitialClients: []*client.Persistent{{
+			Name: "client_one",
+			UID:  client.MustNewUID(),
+			MACs: []net.HardwareAddr{mac1},
+		}, {
+			Name: "client_two",
+			UID:  client.MustNewUID(),
+			MACs: []net.HardwareAddr{mac2},
+		}},
+	})
+	require.NoError(t, err)
+
+	servicetest.RequireRun(t, storage, testTimeout)
+
+	p, ok := storage.Find(&client.FindParams{RemoteIP: cliIP})
+	require.True(t, ok)
+
+	assert.Equal(t, "client_one", p.Name)
+
+	setNeighbors(mac2)
+
+	upd, ok := testutil.RequireReceive(t, updates, testTimeout)
+	require.True(t, ok)
+
+	upd <- struct{}{}
+
+	require.EventuallyWithT(t, func(ct *assert.CollectT) {
+		p, ok = storage.Find(&client.FindParams{RemoteIP: cliIP})
+		require.True(ct, ok)
+
+		assert.Equal(ct, "client_two", p.Name)
+	}, testTimeout, testTimeout/10)
+}
+
+func TestStorage_ReloadDiscovery(t *testing.T) {
+	var (
+		cliIP1   = netip.MustParseAddr("1.1.1.1")
+		cliName1 = "client_one"
+
+		cliIP2   = netip.MustParseAddr("2.2.2.2")
+		cliName2 = "client_two"
+	)
+
+	var devices []discovery.Device
+	d := &testDiscovery{
+		onRefresh: func(_ context.Context) (err error) {
+			return assert.AnError
+		},
+		onDevices: func() (ds []discovery.Device) { return devices },
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	storage, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		DHCP:       client.EmptyDHCP{},
+		Discovery:  d,
+	})
+	require.NoError(t, err)
+
+	storage.UpdateAddress(ctx, cliIP1, "", &whois.Info{
+		City: "City",
+	})
+
+	devices = []discovery.Device{{
+		IP:       cliIP1,
+		Name:     cliName1,
+		Protocol: discovery.ProtocolMDNS,
+	}}
+
+	storage.ReloadDiscovery(ctx)
+
+	cli1 := storage.ClientRuntime(cliIP1)
+	require.NotNil(t, cli1)
+
+	assert.True(t, compareRuntimeInfo(cli1, client.SourceDiscovery, cliName1))
+
+	devices = []discovery.Device{{
+		IP:       cliIP2,
+		Name:     cliName2,
+		Protocol: discovery.ProtocolNetBIOS,
+	}}
+
+	storage.ReloadDiscovery(ctx)
+
+	cli2 := storage.ClientRuntime(cliIP2)
+	require.NotNil(t, cli2)
+
+	assert.True(t, compareRuntimeInfo(cli2, client.SourceDiscovery, cliName2))
+
+	// The client with WHOIS information must be kept.
+	cli1 = storage.ClientRuntime(cliIP1)
+	require.NotNil(t, cli1)
+
+	src, _ := cli1.Info()
+	assert.Equal(t, client.SourceWHOIS, src)
+}
+
+func TestStorage_ReloadRouter(t *testing.T) {
+	var (
+		cliIP   = netip.MustParseAddr("1.1.1.1")
+		cliName = "client_one"
+		cliMAC  = net.HardwareAddr{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+	)
+
+	var refreshErr error
+	r := &testRouter{
+		onRefresh: func(_ context.Context) (err error) { return refreshErr },
+		onClients: func() (cs []router.Client) {
+			return []router.Client{{
+				MAC:  cliMAC,
+				IP:   cliIP,
+				Name: cliName,
+			}}
+		},
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	storage, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		DHCP:       client.EmptyDHCP{},
+		Router:     r,
+		InitialClients: []*client.Persistent{{
+			Name: "persistent",
+			UID:  client.MustNewUID(),
+			MACs: []net.HardwareAddr{cliMAC},
+		}},
+	})
+	require.NoError(t, err)
+
+	storage.ReloadRouter(ctx)
+
+	cli := storage.ClientRuntime(cliIP)
+	require.NotNil(t, cli)
+
+	assert.True(t, compareRuntimeInfo(cli, client.SourceRouter, cliName))
+
+	p, ok := storage.Find(&client.FindParams{RemoteIP: cliIP})
+	require.True(t, ok)
+
+	assert.Equal(t, "persistent", p.Name)
+
+	// The information must be kept, if the router is unavailable.
+	refreshErr = assert.AnError
+	storage.ReloadRouter(ctx)
+
+	cli = storage.ClientRuntime(cliIP)
+	require.NotNil(t, cli)
+
+	assert.True(t, compareRuntimeInfo(cli, client.SourceRouter, cliName))
+}
+
+func TestStorage_ReloadVPN(t *testing.T) {
+	var (
+		oldIP   = netip.MustParseAddr("10.8.0.2")
+		newIP   = netip.MustParseAddr("10.8.0.3")
+		cliName = "phone"
+	)
+
+	peerIP := oldIP
+	v := &testVPN{
+		onRefresh: func(_ context.Context) (err error) { return nil },
+		onPeers: func() (ps []vpn.Peer) {
+			return []vpn.Peer{{
+				IP:   peerIP,
+				Name: cliName,
+			}}
+		},
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	storage, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		DHCP:       client.EmptyDHCP{},
+		VPN:        v,
+		InitialClients: []*client.Persistent{{
+			Name:             cliName,
+			UID:              client.MustNewUID(),
+			ClientIDs:        []client.ClientID{"phone"},
+			UseOwnSettings:   true,
+			FilteringEnabled: true,
+		}},
+	})
+	require.NoError(t, err)
+
+	storage.ReloadVPN(ctx)
+
+	cli := storage.ClientRuntime(oldIP)
+	require.NotNil(t, cli)
+
+	assert.True(t, compareRuntimeInfo(cli, client.SourceVPN, cliName))
+
+	p, ok := storage.Find(&client.FindParams{RemoteIP: oldIP})
+	require.True(t, ok)
+
+	assert.Equal(t, cliName, p.Name)
+
+	// The persistent client must be found by the new tunnel address.
+	peerIP = newIP
+	storage.ReloadVPN(ctx)
+
+	assert.Nil(t, storage.ClientRuntime(oldIP))
+
+	_, ok = storage.Find(&client.FindParams{RemoteIP: oldIP})
+	assert.False(t, ok)
+
+	setts := &filtering.Settings{}
+	storage.ApplyClientFiltering("", newIP, setts)
+
+	assert.Equal(t, cliName, setts.ClientName)
+	assert.True(t, setts.FilteringEnabled)
+}
+
 func TestStorage_Add_whois(t *testing.T) {
 	var (
 		cliIP1 = netip.MustParseAddr("1.1.1.1")
@@ -333,6 +690,59 @@ func TestStorage_Add_whois(t *testing.T) {
 	})
 }
 
+func TestStorage_UpdateDHCP_device(t *testing.T) {
+	var (
+		cliIP1  = netip.MustParseAddr("1.1.1.1")
+		cliMAC1 = net.HardwareAddr{0xF0, 0x18, 0x98, 0x01, 0x02, 0x03}
+
+		cliIP2  = netip.MustParseAddr("2.2.2.2")
+		cliMAC2 = net.HardwareAddr{0xAA, 0xBB, 0xCC, 0x01, 0x02, 0x03}
+	)
+
+	leases := []*dhcpsvc.Lease{{
+		IP:       cliIP1,
+		Hostname: "phone.dhcp",
+		HWAddr:   cliMAC1,
+		Fingerprint: &fingerprint.DHCP{
+			ParameterRequestList: []uint8{1, 121, 3, 6, 15, 119, 252},
+		},
+	}, {
+		IP:       cliIP2,
+		Hostname: "unknown.dhcp",
+		HWAddr:   cliMAC2,
+	}}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	storage, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		DHCP: &testDHCP{
+			OnLeases: func() (ls []*dhcpsvc.Lease) { return leases },
+			OnHostBy: func(_ netip.Addr) (host string) { return "" },
+			OnMACBy:  func(_ netip.Addr) (mac net.HardwareAddr) { return nil },
+		},
+		RuntimeSourceDHCP: true,
+	})
+	require.NoError(t, err)
+
+	storage.UpdateDHCP(ctx)
+
+	cli1 := storage.ClientRuntime(cliIP1)
+	require.NotNil(t, cli1)
+
+	assert.Equal(t, &fingerprint.Device{
+		Vendor:          "Apple",
+		OS:              "iOS",
+		Type:            fingerprint.TypeMobile,
+		DHCPFingerprint: "1,121,3,6,15,119,252",
+	}, cli1.Device())
+
+	cli2 := storage.ClientRuntime(cliIP2)
+	require.NotNil(t, cli2)
+
+	assert.Nil(t, cli2.Device())
+}
+
 func TestClientsDHCP(t *testing.T) {
 	var (
 		cliIP1   = netip.MustParseAddr("1.1.1.1")
@@ -847,6 +1257,43 @@ func TestStorage_RemoveByName(t *testing.T) {
 	})
 }
 
+func TestStorage_FindByName(t *testing.T) {
+	const existingName = "existing_name"
+
+	existingClient := &client.Persistent{
+		Name: existingName,
+		IPs:  []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+		UID:  client.MustNewUID(),
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s := newTestStorage(t, timeutil.SystemClock{})
+	err := s.Add(ctx, existingClient)
+	require.NoError(t, err)
+
+	t.Run("existing_client", func(t *testing.T) {
+		p, ok := s.FindByName(existingName)
+		require.True(t, ok)
+
+		assert.Equal(t, existingName, p.Name)
+		assert.Equal(t, existingClient.IPs, p.IPs)
+
+		// Make sure that a copy is returned.
+		p.Name = "modified_name"
+
+		p, ok = s.FindByName(existingName)
+		require.True(t, ok)
+
+		assert.Equal(t, existingName, p.Name)
+	})
+
+	t.Run("non_existing_client", func(t *testing.T) {
+		p, ok := s.FindByName("non_existing_client")
+		assert.False(t, ok)
+		assert.Nil(t, p)
+	})
+}
+
 func TestStorage_Find(t *testing.T) {
 	const (
 		cliIPNone = "1.2.3.4"
@@ -1292,6 +1739,343 @@ func TestStorage_CustomUpstreamConfig(t *testing.T) {
 	})
 }
 
+func TestStorage_CustomUpstreamConfig_tags(t *testing.T) {
+	var (
+		laptopIP = netip.MustParseAddr("192.0.2.1")
+		phoneIP  = netip.MustParseAddr("192.0.2.2")
+		tvIP     = netip.MustParseAddr("192.0.2.3")
+	)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		Clock:      timeutil.SystemClock{},
+		TagUpstreams: map[string][]string{
+			"device_laptop": {"tls://dns.example"},
+		},
+	})
+	require.NoError(t, err)
+
+	s.UpdateCommonUpstreamConfig(&client.CommonUpstreamConfig{
+		UpstreamTimeout: time.Second,
+	})
+
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		return s.Shutdown(testutil.ContextWithTimeout(t, testTimeout))
+	})
+
+	err = s.Add(ctx, &client.Persistent{
+		Name:         "laptop",
+		IPs:          []netip.Addr{laptopIP},
+		UID:          client.MustNewUID(),
+		Tags:         []string{"device_laptop"},
+		BootstrapDNS: []string{"192.0.2.53"},
+	})
+	require.NoError(t, err)
+
+	err = s.Add(ctx, &client.Persistent{
+		Name: "phone",
+		IPs:  []netip.Addr{phoneIP},
+		UID:  client.MustNewUID(),
+		Tags: []string{"device_phone"},
+	})
+	require.NoError(t, err)
+
+	err = s.Add(ctx, &client.Persistent{
+		Name:      "tv",
+		IPs:       []netip.Addr{tvIP},
+		UID:       client.MustNewUID(),
+		Tags:      []string{"device_laptop"},
+		Upstreams: []string{"# comment"},
+	})
+	require.NoError(t, err)
+
+	assert.NotNil(t, s.CustomUpstreamConfig("", laptopIP))
+	assert.Nil(t, s.CustomUpstreamConfig("", phoneIP))
+	assert.NotNil(t, s.CustomUpstreamConfig("", tvIP))
+
+	t.Run("bad_bootstrap", func(t *testing.T) {
+		err = s.Add(ctx, &client.Persistent{
+			Name:         "bad_bootstrap",
+			IPs:          []netip.Addr{netip.MustParseAddr("192.0.2.4")},
+			UID:          client.MustNewUID(),
+			BootstrapDNS: []string{"dns.example"},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("bad_tag", func(t *testing.T) {
+		_, err = client.NewStorage(ctx, &client.StorageConfig{
+			BaseLogger: testLogger,
+			Logger:     testLogger,
+			Clock:      timeutil.SystemClock{},
+			TagUpstreams: map[string][]string{
+				"device_unknown": {"192.0.2.53"},
+			},
+		})
+		testutil.AssertErrorMsg(t, `tag upstreams: invalid tag: "device_unknown"`, err)
+	})
+}
+
+func TestStorage_ApplyClientFiltering_tagProtection(t *testing.T) {
+	var (
+		cameraIP = netip.MustParseAddr("192.0.2.1")
+		kidsIP   = netip.MustParseAddr("192.0.2.2")
+		ownIP    = netip.MustParseAddr("192.0.2.3")
+
+		enabled  = true
+		disabled = false
+	)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		Clock:      timeutil.SystemClock{},
+		DHCP:       client.EmptyDHCP{},
+		TagProtection: map[string]*client.TagProtection{
+			"device_camera": {
+				SafeBrowsingEnabled: &disabled,
+			},
+			"user_child": {
+				SafeBrowsingEnabled: &enabled,
+				ParentalEnabled:     &enabled,
+				SafeSearchEnabled:   &enabled,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, p := range []*client.Persistent{{
+		Name: "camera",
+		IPs:  []netip.Addr{cameraIP},
+		Tags: []string{"device_camera"},
+	}, {
+		Name: "kids_camera",
+		IPs:  []netip.Addr{kidsIP},
+		Tags: []string{"user_child", "device_camera"},
+	}, {
+		Name:           "own",
+		IPs:            []netip.Addr{ownIP},
+		Tags:           []string{"user_child"},
+		UseOwnSettings: true,
+	}} {
+		p.UID = client.MustNewUID()
+		require.NoError(t, s.Add(ctx, p))
+	}
+
+	testCases := []struct {
+		addr     netip.Addr
+		name     string
+		wantSB   bool
+		wantPC   bool
+		wantSS   bool
+		globalSB bool
+	}{{
+		addr:     cameraIP,
+		name:     "tag",
+		wantSB:   false,
+		wantPC:   false,
+		wantSS:   false,
+		globalSB: true,
+	}, {
+		addr:     kidsIP,
+		name:     "first_tag_wins",
+		wantSB:   false,
+		wantPC:   true,
+		wantSS:   true,
+		globalSB: true,
+	}, {
+		addr:     ownIP,
+		name:     "own_settings",
+		wantSB:   false,
+		wantPC:   false,
+		wantSS:   false,
+		globalSB: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setts := &filtering.Settings{
+				SafeBrowsingEnabled: tc.globalSB,
+			}
+			s.ApplyClientFiltering("", tc.addr, setts)
+
+			assert.Equal(t, tc.wantSB, setts.SafeBrowsingEnabled)
+			assert.Equal(t, tc.wantPC, setts.ParentalEnabled)
+			assert.Equal(t, tc.wantSS, setts.SafeSearchEnabled)
+		})
+	}
+
+	t.Run("bad_tag", func(t *testing.T) {
+		_, err = client.NewStorage(ctx, &client.StorageConfig{
+			BaseLogger: testLogger,
+			Logger:     testLogger,
+			Clock:      timeutil.SystemClock{},
+			TagProtection: map[string]*client.TagProtection{
+				"device_unknown": {},
+			},
+		})
+		testutil.AssertErrorMsg(t, `tag protection: invalid tag: "device_unknown"`, err)
+	})
+}
+
+func TestStorage_groups(t *testing.T) {
+	var (
+		kidIP   = netip.MustParseAddr("192.0.2.1")
+		ownIP   = netip.MustParseAddr("192.0.2.2")
+		adultIP = netip.MustParseAddr("192.0.2.3")
+
+		enabled  = true
+		disabled = false
+	)
+
+	groups := []*client.Group{{
+		Name:                "family",
+		SafeBrowsingEnabled: &enabled,
+		ParentalEnabled:     &disabled,
+		Upstreams:           []string{"tls://dns.example"},
+		BlockedServices: &filtering.BlockedServices{
+			IDs: []string{"youtube"},
+		},
+	}, {
+		Name:            "kids",
+		Parent:          "family",
+		ParentalEnabled: &enabled,
+	}}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	filtering.InitModule(ctx, testLogger)
+
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		Clock:      timeutil.SystemClock{},
+		DHCP:       client.EmptyDHCP{},
+		Groups:     groups,
+	})
+	require.NoError(t, err)
+
+	s.UpdateCommonUpstreamConfig(&client.CommonUpstreamConfig{
+		UpstreamTimeout: time.Second,
+	})
+
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		return s.Shutdown(testutil.ContextWithTimeout(t, testTimeout))
+	})
+
+	for _, p := range []*client.Persistent{{
+		Name:            "kid",
+		IPs:             []netip.Addr{kidIP},
+		Group:           "kids",
+		BlockedServices: &filtering.BlockedServices{},
+	}, {
+		Name:                  "own",
+		IPs:                   []netip.Addr{ownIP},
+		Group:                 "kids",
+		Upstreams:             []string{"192.0.2.53"},
+		UseOwnSettings:        true,
+		UseOwnBlockedServices: true,
+		BlockedServices:       &filtering.BlockedServices{},
+	}, {
+		Name:            "adult",
+		IPs:             []netip.Addr{adultIP},
+		Group:           "family",
+		BlockedServices: &filtering.BlockedServices{},
+	}} {
+		p.UID = client.MustNewUID()
+		require.NoError(t, s.Add(ctx, p))
+	}
+
+	assert.Equal(t, []string{"family", "kids"}, s.GroupNames())
+
+	testCases := []struct {
+		addr        netip.Addr
+		name        string
+		wantSvcs    []string
+		wantSB      bool
+		wantPC      bool
+		wantUpsConf bool
+	}{{
+		addr:        kidIP,
+		name:        "inherited",
+		wantSvcs:    []string{"youtube"},
+		wantSB:      true,
+		wantPC:      true,
+		wantUpsConf: true,
+	}, {
+		addr:        ownIP,
+		name:        "own_settings",
+		wantSvcs:    nil,
+		wantSB:      false,
+		wantPC:      false,
+		wantUpsConf: true,
+	}, {
+		addr:        adultIP,
+		name:        "parent",
+		wantSvcs:    []string{"youtube"},
+		wantSB:      true,
+		wantPC:      false,
+		wantUpsConf: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setts := &filtering.Settings{}
+			s.ApplyClientFiltering("", tc.addr, setts)
+
+			assert.Equal(t, tc.wantSB, setts.SafeBrowsingEnabled)
+			assert.Equal(t, tc.wantPC, setts.ParentalEnabled)
+
+			require.NotNil(t, setts.BlockedServices)
+
+			assert.Equal(t, tc.wantSvcs, setts.BlockedServices.IDs)
+			assert.Equal(t, tc.wantUpsConf, s.CustomUpstreamConfig("", tc.addr) != nil)
+		})
+	}
+
+	t.Run("unknown_group", func(t *testing.T) {
+		err = s.Add(ctx, &client.Persistent{
+			Name:  "unknown",
+			IPs:   []netip.Addr{netip.MustParseAddr("192.0.2.4")},
+			UID:   client.MustNewUID(),
+			Group: "unknown",
+		})
+		testutil.AssertErrorMsg(t, `adding client: group "unknown" is not found`, err)
+	})
+
+	badCases := []struct {
+		name       string
+		wantErrMsg string
+		groups     []*client.Group
+	}{{
+		name:       "unknown_parent",
+		wantErrMsg: `groups: group "a": parent: group "b" is not found`,
+		groups:     []*client.Group{{Name: "a", Parent: "b"}},
+	}, {
+		name:       "cycle",
+		wantErrMsg: `groups: group "a": parent: cycle at group "a"`,
+		groups:     []*client.Group{{Name: "a", Parent: "b"}, {Name: "b", Parent: "a"}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `groups: group "a": duplicate name`,
+		groups:     []*client.Group{{Name: "a"}, {Name: "a"}},
+	}}
+
+	for _, tc := range badCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err = client.NewStorage(ctx, &client.StorageConfig{
+				BaseLogger: testLogger,
+				Logger:     testLogger,
+				Clock:      timeutil.SystemClock{},
+				Groups:     tc.groups,
+			})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
 func BenchmarkFindParams_Set(b *testing.B) {
 	const (
 		testIPStr    = "192.0.2.1"
@@ -1470,3 +2254,266 @@ func BenchmarkStorage_Find(b *testing.B) {
 	//	BenchmarkStorage_Find/subnet-8            	 7209050	       167.5 ns/op	     256 B/op	       2 allocs/op
 	//	BenchmarkStorage_Find/mac_address-8       	 5776131	       199.7 ns/op	     256 B/op	       3 allocs/op
 }
+
+func TestStorage_ApplyClientFiltering_identity(t *testing.T) {
+	var (
+		staffIP   = netip.MustParseAddr("192.0.2.1")
+		guestIP   = netip.MustParseAddr("192.0.2.2")
+		managerIP = netip.MustParseAddr("192.0.2.3")
+
+		enabled = true
+	)
+
+	ids := &testIdentity{
+		onIdentity: func(_ context.Context, ip netip.Addr) (id *identity.Identity) {
+			switch ip {
+			case staffIP:
+				return &identity.Identity{
+					User:   "alice",
+					Groups: []string{"Domain Users", "Staff"},
+				}
+			case managerIP:
+				return &identity.Identity{
+					User:   "bob",
+					Groups: []string{"Staff"},
+				}
+			default:
+				return nil
+			}
+		},
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		Clock:      timeutil.SystemClock{},
+		DHCP:       client.EmptyDHCP{},
+		Groups: []*client.Group{{
+			Name:            "staff",
+			ParentalEnabled: &enabled,
+		}},
+		Identity: ids,
+		IdentityGroups: map[string]string{
+			"Staff": "staff",
+		},
+	})
+	require.NoError(t, err)
+
+	err = s.Add(ctx, &client.Persistent{
+		Name:            "manager",
+		UID:             client.MustNewUID(),
+		IPs:             []netip.Addr{managerIP},
+		UseOwnSettings:  true,
+		BlockedServices: &filtering.BlockedServices{},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		addr   netip.Addr
+		name   string
+		wantPC bool
+	}{{
+		addr:   staffIP,
+		name:   "runtime_mapped",
+		wantPC: true,
+	}, {
+		addr:   guestIP,
+		name:   "runtime_unknown",
+		wantPC: false,
+	}, {
+		addr:   managerIP,
+		name:   "persistent_own",
+		wantPC: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setts := &filtering.Settings{}
+			s.ApplyClientFiltering("", tc.addr, setts)
+
+			assert.Equal(t, tc.wantPC, setts.ParentalEnabled)
+		})
+	}
+
+	t.Run("unknown_group", func(t *testing.T) {
+		_, err = client.NewStorage(ctx, &client.StorageConfig{
+			BaseLogger: testLogger,
+			Logger:     testLogger,
+			DHCP:       client.EmptyDHCP{},
+			IdentityGroups: map[string]string{
+				"Staff": "staff",
+			},
+		})
+		testutil.AssertErrorMsg(
+			t,
+			`identity groups: "Staff": group "staff" is not found`,
+			err,
+		)
+	})
+}
+
+func TestStorage_RuntimeTags(t *testing.T) {
+	var (
+		camIP   = netip.MustParseAddr("192.168.2.10")
+		phoneIP = netip.MustParseAddr("192.168.1.20")
+		piIP    = netip.MustParseAddr("192.168.1.30")
+		otherIP = netip.MustParseAddr("10.0.0.1")
+
+		piMAC = net.HardwareAddr{0xB8, 0x27, 0xEB, 0x01, 0x02, 0x03}
+
+		enabled = true
+	)
+
+	dhcp := &testDHCP{
+		OnLeases: func() (leases []*dhcpsvc.Lease) { return nil },
+		OnHostBy: func(ip netip.Addr) (host string) {
+			if ip == phoneIP {
+				return "Alices-iPhone"
+			}
+
+			return ""
+		},
+		OnMACBy: func(ip netip.Addr) (mac net.HardwareAddr) {
+			if ip == piIP {
+				return piMAC
+			}
+
+			return nil
+		},
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger:        testLogger,
+		Logger:            testLogger,
+		DHCP:              dhcp,
+		RuntimeSourceDHCP: true,
+		TagProtection: map[string]*client.TagProtection{
+			"device_camera": {
+				SafeBrowsingEnabled: &enabled,
+			},
+		},
+		TagRules: []*client.TagRule{{
+			Tag:     "device_camera",
+			Subnets: []netip.Prefix{netip.MustParsePrefix("192.168.2.0/24")},
+		}, {
+			Tag:      "device_phone",
+			Hostname: "*-iphone",
+		}, {
+			Tag:     "device_other",
+			MACOUIs: []string{"b8:27:eb"},
+		}, {
+			Tag:      "os_linux",
+			Subnets:  []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+			MACOUIs:  []string{"b8:27:eb"},
+			Hostname: "*",
+		}},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		ip   netip.Addr
+		name string
+		want []string
+	}{{
+		ip:   camIP,
+		name: "subnet",
+		want: []string{"device_camera"},
+	}, {
+		ip:   phoneIP,
+		name: "hostname",
+		want: []string{"device_phone"},
+	}, {
+		ip:   piIP,
+		name: "mac_oui",
+		want: []string{"device_other", "os_linux"},
+	}, {
+		ip:   otherIP,
+		name: "none",
+		want: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, s.RuntimeTags(tc.ip))
+		})
+	}
+
+	t.Run("apply", func(t *testing.T) {
+		setts := &filtering.Settings{}
+		s.ApplyClientFiltering("", camIP, setts)
+
+		assert.Equal(t, []string{"device_camera"}, setts.ClientTags)
+		assert.True(t, setts.SafeBrowsingEnabled)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err = client.NewStorage(ctx, &client.StorageConfig{
+			BaseLogger: testLogger,
+			Logger:     testLogger,
+			DHCP:       client.EmptyDHCP{},
+			TagRules: []*client.TagRule{{
+				Tag: "device_camera",
+			}},
+		})
+		testutil.AssertErrorMsg(
+			t,
+			`tag rules: rule at index 0: tag "device_camera": conditions: empty value`,
+			err,
+		)
+	})
+}
+
+func TestStorage_Ignores(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		DHCP:       client.EmptyDHCP{},
+		Groups: []*client.Group{{
+			Name:           "employees",
+			IgnoreQueryLog: true,
+		}, {
+			Name:             "office",
+			Parent:           "employees",
+			IgnoreStatistics: true,
+		}},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		cli            *client.Persistent
+		name           string
+		wantQueryLog   bool
+		wantStatistics bool
+	}{{
+		cli:            &client.Persistent{},
+		name:           "none",
+		wantQueryLog:   false,
+		wantStatistics: false,
+	}, {
+		cli:            &client.Persistent{IgnoreStatistics: true},
+		name:           "own",
+		wantQueryLog:   false,
+		wantStatistics: true,
+	}, {
+		cli:            &client.Persistent{Group: "employees"},
+		name:           "group",
+		wantQueryLog:   true,
+		wantStatistics: false,
+	}, {
+		cli:            &client.Persistent{Group: "office"},
+		name:           "inherited",
+		wantQueryLog:   true,
+		wantStatistics: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			queryLog, statistics := s.Ignores(tc.cli)
+			assert.Equal(t, tc.wantQueryLog, queryLog)
+			assert.Equal(t, tc.wantStatistics, statistics)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+)
+
+// TagProtection is the configuration of the protection services for the
+// persistent clients with a tag, which have no own settings.  A nil field means
+// that the setting is inherited from the next tag of the client, which has it,
+// or from the global settings.
+type TagProtection struct {
+	// SafeBrowsingEnabled defines if the safe browsing is enabled.
+	SafeBrowsingEnabled *bool `yaml:"safebrowsing_enabled,omitempty"`
+
+	// ParentalEnabled defines if the parental control is enabled.
+	ParentalEnabled *bool `yaml:"parental_enabled,omitempty"`
+
+	// SafeSearchEnabled defines if the safe search is enabled.
+	SafeSearchEnabled *bool `yaml:"safesearch_enabled,omitempty"`
+}
+
+// validateTagProtection returns an error if any of the tags in tagProtection
+// isn't in allTags or if any of the configurations is nil.  allTags must be
+// sorted.
+func validateTagProtection(allTags []string, tagProtection map[string]*TagProtection) (err error) {
+	for _, t := range slices.Sorted(maps.Keys(tagProtection)) {
+		_, ok := slices.BinarySearch(allTags, t)
+		if !ok {
+			return fmt.Errorf("invalid tag: %q", t)
+		}
+
+		if tagProtection[t] == nil {
+			return fmt.Errorf("tag %q: no configuration", t)
+		}
+	}
+
+	return nil
+}
+
+// applyTagProtection sets the protection services in setts from the
+// configurations of tags.  Each service is set from the first tag, which has
+// the setting for it.  tags must be sorted.  setts must not be nil.
+func applyTagProtection(
+	tagProtection map[string]*TagProtection,
+	tags []string,
+	setts *filtering.Settings,
+) {
+	var sb, pc, ss *bool
+	for _, t := range tags {
+		p := tagProtection[t]
+		if p == nil {
+			continue
+		}
+
+		sb = cmp.Or(sb, p.SafeBrowsingEnabled)
+		pc = cmp.Or(pc, p.ParentalEnabled)
+		ss = cmp.Or(ss, p.SafeSearchEnabled)
+	}
+
+	if sb != nil {
+		setts.SafeBrowsingEnabled = *sb
+	}
+
+	if pc != nil {
+		setts.ParentalEnabled = *pc
+	}
+
+	if ss != nil {
+		setts.SafeSearchEnabled = *ss
+	}
+}
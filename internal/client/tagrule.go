@@ -0,0 +1,151 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// TagRule assigns a tag to the runtime clients, which match all of its
+// conditions.  At least one of the conditions must be set.
+type TagRule struct {
+	// Tag is the assigned tag.  It must be one of the allowed tags.
+	Tag string `yaml:"tag"`
+
+	// Subnets are the subnets, any of which must contain the IP address of the
+	// client.
+	Subnets []netip.Prefix `yaml:"subnets,omitempty"`
+
+	// Hostname is the shell pattern, see [path.Match], which the hostname of
+	// the client must match.  The matching is case-insensitive.
+	Hostname string `yaml:"hostname,omitempty"`
+
+	// DHCPFingerprint is the DHCP parameter request list of the client in the
+	// format of [fingerprint.DHCP.String], for example "1,3,6,15".
+	DHCPFingerprint string `yaml:"dhcp_fingerprint,omitempty"`
+
+	// MACOUIs are the organizationally unique identifiers, for example
+	// "b8:27:eb", any of which must be the prefix of the MAC address of the
+	// client.
+	MACOUIs []string `yaml:"mac_ouis,omitempty"`
+}
+
+// ouiLen is the length of an organizationally unique identifier.
+const ouiLen = 3
+
+// tagRule is the validated [TagRule].
+type tagRule struct {
+	tag             string
+	subnets         []netip.Prefix
+	hostname        string
+	dhcpFingerprint string
+	ouis            [][ouiLen]byte
+}
+
+// newTagRules validates rules and returns their validated versions.  allTags
+// must be sorted.
+func newTagRules(allTags []string, rules []*TagRule) (trs []*tagRule, err error) {
+	trs = make([]*tagRule, 0, len(rules))
+	for i, r := range rules {
+		var tr *tagRule
+		tr, err = r.toInternal(allTags)
+		if err != nil {
+			return nil, fmt.Errorf("rule at index %d: %w", i, err)
+		}
+
+		trs = append(trs, tr)
+	}
+
+	return trs, nil
+}
+
+// toInternal validates r and returns its validated version.  allTags must be
+// sorted.
+func (r *TagRule) toInternal(allTags []string) (tr *tagRule, err error) {
+	if r == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	if _, ok := slices.BinarySearch(allTags, r.Tag); !ok {
+		return nil, fmt.Errorf("invalid tag: %q", r.Tag)
+	}
+
+	if len(r.Subnets) == 0 && r.Hostname == "" && r.DHCPFingerprint == "" && len(r.MACOUIs) == 0 {
+		return nil, fmt.Errorf("tag %q: conditions: %w", r.Tag, errors.ErrEmptyValue)
+	}
+
+	hostname := strings.ToLower(r.Hostname)
+	if _, err = path.Match(hostname, ""); err != nil {
+		return nil, fmt.Errorf("tag %q: hostname: %w", r.Tag, err)
+	}
+
+	ouis := make([][ouiLen]byte, 0, len(r.MACOUIs))
+	for _, s := range r.MACOUIs {
+		var mac net.HardwareAddr
+		mac, err = net.ParseMAC(s + ":00:00:00")
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: mac oui %q: %w", r.Tag, s, err)
+		}
+
+		ouis = append(ouis, [ouiLen]byte(mac))
+	}
+
+	return &tagRule{
+		tag:             r.Tag,
+		subnets:         slices.Clone(r.Subnets),
+		hostname:        hostname,
+		dhcpFingerprint: r.DHCPFingerprint,
+		ouis:            ouis,
+	}, nil
+}
+
+// tagRuleParams are the properties of a runtime client matched by the tag
+// rules.  Any of the fields except ip may be empty.
+type tagRuleParams struct {
+	mac             net.HardwareAddr
+	host            string
+	dhcpFingerprint string
+	ip              netip.Addr
+}
+
+// match returns true if the client with the properties p matches all the
+// conditions of tr.
+func (tr *tagRule) match(p *tagRuleParams) (ok bool) {
+	if len(tr.subnets) > 0 && !slices.ContainsFunc(tr.subnets, func(s netip.Prefix) (c bool) {
+		return s.Contains(p.ip)
+	}) {
+		return false
+	}
+
+	if tr.hostname != "" {
+		matched, _ := path.Match(tr.hostname, strings.ToLower(p.host))
+		if !matched {
+			return false
+		}
+	}
+
+	if tr.dhcpFingerprint != "" && tr.dhcpFingerprint != p.dhcpFingerprint {
+		return false
+	}
+
+	return len(tr.ouis) == 0 || (len(p.mac) >= ouiLen && slices.Contains(tr.ouis, [ouiLen]byte(p.mac)))
+}
+
+// matchTagRules returns the sorted tags of the rules, which the client with the
+// properties p matches.  tags is nil if there are none.
+func matchTagRules(rules []*tagRule, p *tagRuleParams) (tags []string) {
+	for _, tr := range rules {
+		if tr.match(p) {
+			tags = append(tags, tr.tag)
+		}
+	}
+
+	slices.Sort(tags)
+
+	return slices.Compact(tags)
+}
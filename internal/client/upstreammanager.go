@@ -1,8 +1,10 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"slices"
 	"time"
 
@@ -34,6 +36,10 @@ type customUpstreamConfig struct {
 	// [newCustomUpstreamConfig].
 	proxyConf *proxy.CustomUpstreamConfig
 
+	// boots are the custom bootstrap resolvers used by proxyConf.  They must
+	// be closed together with proxyConf.
+	boots []*upstream.UpstreamResolver
+
 	// commonConfUpdate is the timestamp of the latest configuration update,
 	// used to check against [upstreamManager.confUpdate] to determine if the
 	// configuration is up to date.
@@ -43,6 +49,10 @@ type customUpstreamConfig struct {
 	// configuration of proxyConf.
 	upstreams []string
 
+	// bootstrap is the cached list of custom bootstrap DNS servers used for the
+	// configuration of proxyConf.
+	bootstrap []string
+
 	// upstreamsCacheSize is the cached value of the cache size of the
 	// upstreams, used for the configuration of proxyConf.
 	upstreamsCacheSize uint32
@@ -72,6 +82,15 @@ type upstreamManager struct {
 	// commonConf is the common upstream configuration.
 	commonConf *CommonUpstreamConfig
 
+	// tagUpstreams maps client tags to the upstream DNS servers used by the
+	// persistent clients with the tag, which have no own upstreams.  It must
+	// not be modified after initialization.
+	tagUpstreams map[string][]string
+
+	// groups are the groups of the persistent clients.  It must not be
+	// modified after initialization.
+	groups groupIndex
+
 	// clock is used to get the current time.  It must not be nil.
 	clock timeutil.Clock
 
@@ -80,12 +99,52 @@ type upstreamManager struct {
 	confUpdate time.Time
 }
 
+// validateTagUpstreams returns an error if any of the tags in tagUpstreams isn't
+// in allTags or if any of the upstreams is invalid.  allTags must be sorted.  l
+// must not be nil.
+func validateTagUpstreams(
+	ctx context.Context,
+	l *slog.Logger,
+	allTags []string,
+	tagUpstreams map[string][]string,
+) (err error) {
+	for _, t := range slices.Sorted(maps.Keys(tagUpstreams)) {
+		_, ok := slices.BinarySearch(allTags, t)
+		if !ok {
+			return fmt.Errorf("invalid tag: %q", t)
+		}
+
+		var conf *proxy.UpstreamConfig
+		conf, err = proxy.ParseUpstreamsConfig(tagUpstreams[t], &upstream.Options{
+			Logger: l.With(aghslog.KeyUpstreamType, aghslog.UpstreamTypeTest),
+		})
+		if err != nil {
+			return fmt.Errorf("tag %q: invalid upstream servers: %w", t, err)
+		}
+
+		err = conf.Close()
+		if err != nil {
+			l.ErrorContext(ctx, "closing upstream config", "tag", t, slogutil.KeyError, err)
+		}
+	}
+
+	return nil
+}
+
 // newUpstreamManager returns the new properly initialized upstream manager.
-func newUpstreamManager(baseLogger *slog.Logger, clock timeutil.Clock) (m *upstreamManager) {
+// tagUpstreams and groups must not be modified after calling this function.
+func newUpstreamManager(
+	baseLogger *slog.Logger,
+	clock timeutil.Clock,
+	tagUpstreams map[string][]string,
+	groups groupIndex,
+) (m *upstreamManager) {
 	return &upstreamManager{
 		baseLogger:      baseLogger,
 		logger:          baseLogger.With(slogutil.KeyPrefix, "upstream_manager"),
 		uidToCustomConf: make(map[UID]*customUpstreamConfig),
+		tagUpstreams:    tagUpstreams,
+		groups:          groups,
 		clock:           clock,
 	}
 }
@@ -112,12 +171,34 @@ func (m *upstreamManager) updateCustomUpstreamConfig(c *Persistent) {
 	}
 
 	// TODO(s.chzhen):  Compare before cloning.
-	cliConf.upstreams = slices.Clone(c.Upstreams)
+	cliConf.upstreams = slices.Clone(m.clientUpstreams(c))
+	cliConf.bootstrap = slices.Clone(c.BootstrapDNS)
 	cliConf.upstreamsCacheSize = c.UpstreamsCacheSize
 	cliConf.upstreamsCacheEnabled = c.UpstreamsCacheEnabled
 	cliConf.isChanged = true
 }
 
+// clientUpstreams returns the upstreams of the persistent client.  If the
+// client has no own upstreams, the upstreams of its group or of its ancestors
+// are returned and then the upstreams of the first of its tags, which has any.
+func (m *upstreamManager) clientUpstreams(c *Persistent) (upstreams []string) {
+	if len(stringutil.FilterOut(c.Upstreams, aghnet.IsCommentOrEmpty)) > 0 {
+		return c.Upstreams
+	}
+
+	if ups := m.groups.upstreams(c.Group); len(ups) > 0 {
+		return ups
+	}
+
+	for _, t := range c.Tags {
+		if ups := m.tagUpstreams[t]; len(ups) > 0 {
+			return ups
+		}
+	}
+
+	return c.Upstreams
+}
+
 // customUpstreamConfig returns the custom client upstream configuration.
 func (m *upstreamManager) customUpstreamConfig(
 	uid UID,
@@ -135,19 +216,17 @@ func (m *upstreamManager) customUpstreamConfig(
 		return cliConf.proxyConf
 	}
 
-	if cliConf.proxyConf != nil {
-		err := cliConf.proxyConf.Close()
-		if err != nil {
-			// TODO(s.chzhen):  Pass context.
-			m.logger.Debug("closing custom upstream config", slogutil.KeyError, err)
-		}
+	err := cliConf.closeProxyConf()
+	if err != nil {
+		// TODO(s.chzhen):  Pass context.
+		m.logger.Debug("closing custom upstream config", slogutil.KeyError, err)
 	}
 
 	cliLogger := aghslog.NewForUpstream(m.baseLogger, aghslog.UpstreamTypeCustom).With(
 		aghslog.KeyClientName,
 		clientName,
 	)
-	proxyConf = newCustomUpstreamConfig(cliConf, m.commonConf, cliLogger)
+	proxyConf, cliConf.boots = newCustomUpstreamConfig(cliConf, m.commonConf, cliLogger)
 	cliConf.proxyConf = proxyConf
 	cliConf.commonConfUpdate = m.confUpdate
 	cliConf.isChanged = false
@@ -182,50 +261,65 @@ func (m *upstreamManager) remove(uid UID) (err error) {
 
 	delete(m.uidToCustomConf, uid)
 
-	if cliConf.proxyConf != nil {
-		return cliConf.proxyConf.Close()
-	}
-
-	return nil
+	return cliConf.closeProxyConf()
 }
 
 // close shuts down each stored custom client upstream configuration.
 func (m *upstreamManager) close() (err error) {
 	var errs []error
 	for _, c := range m.uidToCustomConf {
-		if c.proxyConf == nil {
-			continue
-		}
+		errs = append(errs, c.closeProxyConf())
+	}
+
+	return errors.Join(errs...)
+}
 
+// closeProxyConf closes the proxy configuration and the custom bootstrap
+// resolvers, if any.
+func (c *customUpstreamConfig) closeProxyConf() (err error) {
+	var errs []error
+	if c.proxyConf != nil {
 		errs = append(errs, c.proxyConf.Close())
 	}
 
+	for _, b := range c.boots {
+		errs = append(errs, b.Close())
+	}
+
+	c.proxyConf, c.boots = nil, nil
+
 	return errors.Join(errs...)
 }
 
 // newCustomUpstreamConfig returns the new properly initialized custom proxy
-// upstream configuration for the client.  cliConf, conf, and cliLogger must not
-// be nil.
+// upstream configuration for the client as well as the custom bootstrap
+// resolvers, which should be closed after use.  cliConf, conf, and cliLogger
+// must not be nil.
 func newCustomUpstreamConfig(
 	cliConf *customUpstreamConfig,
 	conf *CommonUpstreamConfig,
 	cliLogger *slog.Logger,
-) (proxyConf *proxy.CustomUpstreamConfig) {
+) (proxyConf *proxy.CustomUpstreamConfig, boots []*upstream.UpstreamResolver) {
 	upstreams := stringutil.FilterOut(cliConf.upstreams, aghnet.IsCommentOrEmpty)
 	if len(upstreams) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	upsConf, err := proxy.ParseUpstreamsConfig(
-		upstreams,
-		&upstream.Options{
-			Logger:       cliLogger,
-			Bootstrap:    conf.Bootstrap,
-			Timeout:      conf.UpstreamTimeout,
-			HTTPVersions: aghnet.UpstreamHTTPVersions(conf.UseHTTP3Upstreams),
-			PreferIPv6:   conf.BootstrapPreferIPv6,
-		},
-	)
+	opts := &upstream.Options{
+		Logger:       cliLogger,
+		Timeout:      conf.UpstreamTimeout,
+		HTTPVersions: aghnet.UpstreamHTTPVersions(conf.UseHTTP3Upstreams),
+		PreferIPv6:   conf.BootstrapPreferIPv6,
+	}
+
+	bootstrap := stringutil.FilterOut(cliConf.bootstrap, aghnet.IsCommentOrEmpty)
+	if len(bootstrap) > 0 {
+		opts.Bootstrap, boots = newCustomBootstrap(bootstrap, opts.Clone())
+	} else {
+		opts.Bootstrap = conf.Bootstrap
+	}
+
+	upsConf, err := proxy.ParseUpstreamsConfig(upstreams, opts)
 	if err != nil {
 		// Should not happen because upstreams are already validated.  See
 		// [Persistent.validate].
@@ -237,5 +331,27 @@ func newCustomUpstreamConfig(
 		cliConf.upstreamsCacheEnabled,
 		int(cliConf.upstreamsCacheSize),
 		conf.EDNSClientSubnetEnabled,
-	)
+	), boots
+}
+
+// newCustomBootstrap returns the bootstrap resolver for the custom bootstrap
+// DNS servers of the client as well as the resolvers, which should be closed
+// after use.  addrs must not be empty.  opts must not be nil.
+func newCustomBootstrap(
+	addrs []string,
+	opts *upstream.Options,
+) (r upstream.Resolver, boots []*upstream.UpstreamResolver) {
+	boots, err := aghnet.ParseBootstraps(addrs, opts)
+	if err != nil {
+		// Should not happen because bootstraps are already validated.  See
+		// [Persistent.validate].
+		panic(fmt.Errorf("creating custom bootstrap: %w", err))
+	}
+
+	var parallel upstream.ParallelResolver
+	for _, b := range boots {
+		parallel = append(parallel, upstream.NewCachingResolver(b))
+	}
+
+	return parallel, boots
 }
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"net/netip"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/vpn"
+)
+
+// vpnBindings maps the tunnel addresses of the VPN peers to their names, which
+// are used to find the persistent clients with the same names regardless of
+// the current tunnel addresses of the peers.
+type vpnBindings struct {
+	// mu protects names.
+	mu *sync.RWMutex
+
+	// names maps the tunnel addresses to the names of the peers.
+	names map[netip.Addr]string
+}
+
+// newVPNBindings returns a new properly initialized *vpnBindings.
+func newVPNBindings() (b *vpnBindings) {
+	return &vpnBindings{
+		mu:    &sync.RWMutex{},
+		names: map[netip.Addr]string{},
+	}
+}
+
+// nameByIP returns the name of the peer with the tunnel address ip, if any.
+func (b *vpnBindings) nameByIP(ip netip.Addr) (name string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.names[ip]
+}
+
+// update replaces the bindings with the ones from ps.
+func (b *vpnBindings) update(ps []vpn.Peer) {
+	names := make(map[netip.Addr]string, len(ps))
+	for _, p := range ps {
+		names[p.IP] = p.Name
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.names = names
+}
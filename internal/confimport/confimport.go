@@ -0,0 +1,123 @@
+// Package confimport contains the importers of the configurations of other DNS
+// servers into the AdGuard Home terms.
+package confimport
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+)
+
+// Result is the result of an import.
+type Result struct {
+	// Filters are the imported blocklists.
+	Filters []filtering.FilterYAML
+
+	// WhitelistFilters are the imported allowlists.
+	WhitelistFilters []filtering.FilterYAML
+
+	// Rewrites are the imported DNS rewrites.
+	Rewrites []*filtering.LegacyRewrite
+
+	// UserRules are the imported custom filtering rules.
+	UserRules []string
+
+	// Upstreams are the imported upstream servers in the AdGuard Home format,
+	// including the domain-specific ones.
+	Upstreams []string
+
+	// StaticLeases are the imported static DHCP leases.
+	StaticLeases []*dhcpsvc.Lease
+
+	// Skipped are the entries, which haven't been imported.
+	Skipped []*Skipped
+}
+
+// Skipped is an entry of the imported configuration, which hasn't been
+// imported.
+type Skipped struct {
+	// File is the path to the file containing the entry.  It's empty if the
+	// configuration hasn't been read from a file.
+	File string
+
+	// Text is the text of the entry.
+	Text string
+
+	// Reason describes why the entry has been skipped.
+	Reason string
+
+	// Line is the number of the line of the entry, starting from 1.
+	Line int
+}
+
+// skip adds the skipped entry.
+func (res *Result) skip(file, text, reason string, line int) {
+	res.Skipped = append(res.Skipped, &Skipped{
+		File:   file,
+		Text:   text,
+		Reason: reason,
+		Line:   line,
+	})
+}
+
+// addFilter adds the blocklist or the allowlist, if white is true, unless
+// there already is a filter with the same URL.
+func (res *Result) addFilter(flt filtering.FilterYAML, white bool) {
+	sameURL := func(prev filtering.FilterYAML) (ok bool) { return prev.URL == flt.URL }
+	if flt.URL == "" ||
+		slices.ContainsFunc(res.Filters, sameURL) ||
+		slices.ContainsFunc(res.WhitelistFilters, sameURL) {
+		return
+	}
+
+	if white {
+		res.WhitelistFilters = append(res.WhitelistFilters, flt)
+	} else {
+		res.Filters = append(res.Filters, flt)
+	}
+}
+
+// addRewrite adds the rewrite of domain to answer, unless it's a duplicate.
+func (res *Result) addRewrite(domain, answer string) {
+	if slices.ContainsFunc(res.Rewrites, func(rw *filtering.LegacyRewrite) (ok bool) {
+		return rw.Domain == domain && rw.Answer == answer
+	}) {
+		return
+	}
+
+	res.Rewrites = append(res.Rewrites, &filtering.LegacyRewrite{
+		Domain:  domain,
+		Answer:  answer,
+		Enabled: true,
+	})
+}
+
+// addUserRule adds the filtering rule, unless it's a duplicate.
+func (res *Result) addUserRule(rule string) {
+	if !slices.Contains(res.UserRules, rule) {
+		res.UserRules = append(res.UserRules, rule)
+	}
+}
+
+// addUpstream adds the upstream, unless it's a duplicate.
+func (res *Result) addUpstream(ups string) {
+	if !slices.Contains(res.Upstreams, ups) {
+		res.Upstreams = append(res.Upstreams, ups)
+	}
+}
+
+// addStaticLease adds the static lease.  It returns false if there already is
+// a lease with the same hardware or IP address.
+func (res *Result) addStaticLease(l *dhcpsvc.Lease) (ok bool) {
+	if slices.ContainsFunc(res.StaticLeases, func(prev *dhcpsvc.Lease) (found bool) {
+		return bytes.Equal(prev.HWAddr, l.HWAddr) || prev.IP == l.IP
+	}) {
+		return false
+	}
+
+	res.StaticLeases = append(res.StaticLeases, l)
+
+	return true
+}
@@ -0,0 +1,416 @@
+package confimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// maxDnsmasqIncludeDepth is the maximum depth of the nested conf-file and
+// conf-dir options.
+const maxDnsmasqIncludeDepth = 8
+
+// ParseDnsmasq parses the dnsmasq configuration from r.  The conf-file and
+// conf-dir options are skipped.
+func ParseDnsmasq(r io.Reader) (res *Result, err error) {
+	p := &dnsmasqParser{
+		res: &Result{},
+	}
+
+	err = p.parseFile(r, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.res, nil
+}
+
+// ReadDnsmasq reads the dnsmasq configuration from the file or the directory,
+// such as /etc/dnsmasq.d, at path.  It follows the conf-file and conf-dir
+// options.
+func ReadDnsmasq(path string) (res *Result, err error) {
+	p := &dnsmasqParser{
+		res:         &Result{},
+		followFiles: true,
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		err = p.readDir(path, nil, 0)
+	} else {
+		err = p.readFile(path, 0)
+	}
+
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return p.res, nil
+}
+
+// dnsmasqParser parses the dnsmasq configuration files.
+type dnsmasqParser struct {
+	// res is the result of the import.
+	res *Result
+
+	// followFiles defines if the conf-file and conf-dir options are followed.
+	followFiles bool
+}
+
+// readFile reads the configuration file at path.  depth is the depth of the
+// nested includes.
+func (p *dnsmasqParser) readFile(path string, depth int) (err error) {
+	if depth > maxDnsmasqIncludeDepth {
+		return fmt.Errorf("file %q: too many nested includes", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	return p.parseFile(f, path, depth)
+}
+
+// readDir reads the configuration files from the directory at path in the
+// lexical order.  suffixes are the suffixes of the conf-dir option.  The
+// suffixes starting with "*" define the only files to read, the others define
+// the files to skip.
+func (p *dnsmasqParser) readDir(path string, suffixes []string, depth int) (err error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	var include, exclude []string
+	for _, s := range suffixes {
+		if s == "" {
+			continue
+		} else if after, ok := strings.CutPrefix(s, "*"); ok {
+			include = append(include, after)
+		} else {
+			exclude = append(exclude, s)
+		}
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !isDnsmasqConfFile(name, include, exclude) {
+			continue
+		}
+
+		err = p.readFile(filepath.Join(path, name), depth+1)
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isDnsmasqConfFile returns true if the file with name should be read as a part
+// of a conf-dir.  As dnsmasq does, it skips the hidden files, the backup files,
+// and the files of editors.
+func isDnsmasqConfFile(name string, include, exclude []string) (ok bool) {
+	if strings.HasPrefix(name, ".") ||
+		strings.HasSuffix(name, "~") ||
+		(strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#")) {
+		return false
+	}
+
+	hasSuffix := func(s string) (ok bool) { return strings.HasSuffix(name, s) }
+	if slices.ContainsFunc(exclude, hasSuffix) {
+		return false
+	}
+
+	return len(include) == 0 || slices.ContainsFunc(include, hasSuffix)
+}
+
+// parseFile parses the configuration from r.  file is the path to the file,
+// if any.
+func (p *dnsmasqParser) parseFile(r io.Reader, file string, depth int) (err error) {
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		reason := p.parseOption(line, depth)
+		if reason != "" {
+			p.res.skip(file, line, reason, lineNum)
+		}
+	}
+
+	err = s.Err()
+	if err != nil {
+		return fmt.Errorf("reading %q: %w", file, err)
+	}
+
+	return nil
+}
+
+// parseOption parses a single option of the configuration.  reason is not
+// empty if the option has been skipped.
+func (p *dnsmasqParser) parseOption(line string, depth int) (reason string) {
+	name, val, _ := strings.Cut(line, "=")
+	name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+
+	switch name {
+	case "address":
+		return p.parseAddress(val)
+	case "server":
+		return p.parseServer(val)
+	case "local":
+		return p.parseLocal(val)
+	case "dhcp-host":
+		return p.parseDHCPHost(val)
+	case "conf-file", "conf-dir":
+		return p.include(name, val, depth)
+	default:
+		return "unsupported option"
+	}
+}
+
+// include reads the files of the conf-file or conf-dir option.
+func (p *dnsmasqParser) include(name, val string, depth int) (reason string) {
+	if !p.followFiles {
+		return "including files is not supported"
+	}
+
+	var err error
+	if name == "conf-file" {
+		err = p.readFile(val, depth+1)
+	} else {
+		dir, suffixes, _ := strings.Cut(val, ",")
+		err = p.readDir(dir, strings.Split(suffixes, ","), depth)
+	}
+
+	if err != nil {
+		return fmt.Sprintf("including files: %s", err)
+	}
+
+	return ""
+}
+
+// splitDomains splits the value of the form "/domain1/domain2/value" into the
+// domains and the value.
+func splitDomains(val string) (domains []string, rest string, err error) {
+	if val == "" || val[0] != '/' {
+		return nil, val, nil
+	}
+
+	parts := strings.Split(val[1:], "/")
+	if len(parts) < 2 {
+		return nil, "", errors.Error("no closing slash")
+	}
+
+	domains, rest = parts[:len(parts)-1], parts[len(parts)-1]
+	for i, d := range domains {
+		d = strings.ToLower(strings.TrimSuffix(d, "."))
+		if d == "#" || d == "" {
+			return nil, "", errors.Error("matching all domains is not supported")
+		}
+
+		err = netutil.ValidateDomainName(d)
+		if err != nil {
+			return nil, "", fmt.Errorf("domain at index %d: %w", i, err)
+		}
+
+		domains[i] = d
+	}
+
+	return domains, rest, nil
+}
+
+// parseAddress parses the address option.  The domains with addresses are
+// converted into the rewrites.  Since dnsmasq also matches their subdomains,
+// both the domain and its wildcard are rewritten.  The "#" address is
+// converted into a blocking rule, the empty one into a local-only rule.
+func (p *dnsmasqParser) parseAddress(val string) (reason string) {
+	domains, answer, err := splitDomains(val)
+	if err != nil {
+		return err.Error()
+	} else if len(domains) == 0 {
+		return "no domains"
+	}
+
+	switch answer {
+	case "":
+		p.addLocal(domains)
+	case "#":
+		for _, d := range domains {
+			p.res.addUserRule(fmt.Sprintf("||%s^", d))
+		}
+	default:
+		ip, parseErr := netip.ParseAddr(answer)
+		if parseErr != nil {
+			return fmt.Sprintf("bad address: %s", parseErr)
+		}
+
+		for _, d := range domains {
+			p.res.addRewrite(d, ip.String())
+			p.res.addRewrite("*."+d, ip.String())
+		}
+	}
+
+	return ""
+}
+
+// parseLocal parses the local option.
+func (p *dnsmasqParser) parseLocal(val string) (reason string) {
+	domains, rest, err := splitDomains(val)
+	if err != nil {
+		return err.Error()
+	} else if len(domains) == 0 || rest != "" {
+		return "bad value"
+	}
+
+	p.addLocal(domains)
+
+	return ""
+}
+
+// addLocal adds the rules answering NXDOMAIN for the domains, which dnsmasq
+// only answers from the local data.  The hosts files, the DHCP leases, and the
+// rewrites still take precedence over these rules.
+func (p *dnsmasqParser) addLocal(domains []string) {
+	for _, d := range domains {
+		p.res.addUserRule(fmt.Sprintf("||%s^$dnsrewrite=NXDOMAIN", d))
+	}
+}
+
+// parseServer parses the server option.
+func (p *dnsmasqParser) parseServer(val string) (reason string) {
+	domains, addr, err := splitDomains(val)
+	if err != nil {
+		return err.Error()
+	}
+
+	if len(domains) > 0 {
+		switch addr {
+		case "":
+			p.addLocal(domains)
+
+			return ""
+		case "#":
+			p.res.addUpstream(fmt.Sprintf("[/%s/]#", strings.Join(domains, "/")))
+
+			return ""
+		}
+	}
+
+	ups, err := dnsmasqServerAddr(addr)
+	if err != nil {
+		return err.Error()
+	}
+
+	if len(domains) > 0 {
+		ups = fmt.Sprintf("[/%s/]%s", strings.Join(domains, "/"), ups)
+	}
+
+	p.res.addUpstream(ups)
+
+	return ""
+}
+
+// dnsmasqServerAddr converts the address of the server option of the form
+// "ip[#port][@source]" into the AdGuard Home upstream address.
+func dnsmasqServerAddr(addr string) (ups string, err error) {
+	addr, _, _ = strings.Cut(addr, "@")
+	host, portStr, hasPort := strings.Cut(addr, "#")
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return "", fmt.Errorf("bad address: %w", err)
+	}
+
+	if !hasPort {
+		return ip.String(), nil
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("bad port: %w", err)
+	}
+
+	return netip.AddrPortFrom(ip, uint16(port)).String(), nil
+}
+
+// parseDHCPHost parses the dhcp-host option.  Only the options with a hardware
+// address and an IPv4 address are imported.
+func (p *dnsmasqParser) parseDHCPHost(val string) (reason string) {
+	l := &dhcpsvc.Lease{
+		IsStatic: true,
+	}
+
+	for f := range strings.SplitSeq(val, ",") {
+		f = strings.TrimSpace(f)
+		if f == "ignore" {
+			return "ignored host"
+		}
+
+		if isDHCPHostAuxField(f) {
+			continue
+		}
+
+		if mac, err := net.ParseMAC(f); err == nil && len(mac) == 6 {
+			if l.HWAddr == nil {
+				l.HWAddr = mac
+			}
+		} else if ip, ipErr := netip.ParseAddr(f); ipErr == nil && ip.Is4() {
+			l.IP = ip
+		} else if netutil.ValidateHostname(f) == nil {
+			l.Hostname = strings.ToLower(f)
+		}
+	}
+
+	if l.HWAddr == nil || !l.IP.IsValid() {
+		return "no hardware address or ipv4 address"
+	} else if !p.res.addStaticLease(l) {
+		return "duplicated hardware address or ip address"
+	}
+
+	return ""
+}
+
+// isDHCPHostAuxField returns true if f is a field of the dhcp-host option,
+// which isn't used by the import, such as a tag, a client identifier, an IPv6
+// address, or a lease time.
+func isDHCPHostAuxField(f string) (ok bool) {
+	switch {
+	case
+		f == "",
+		f == "infinite",
+		strings.HasPrefix(f, "set:"),
+		strings.HasPrefix(f, "tag:"),
+		strings.HasPrefix(f, "id:"),
+		strings.HasPrefix(f, "["):
+		return true
+	}
+
+	_, err := strconv.ParseUint(strings.TrimRight(f, "smhdw"), 10, 64)
+
+	return err == nil
+}
@@ -0,0 +1,151 @@
+package confimport
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDnsmasq(t *testing.T) {
+	const conf = `# comment
+domain-needed
+address=/router.lan/192.168.1.1
+address=/ads.example/tracker.example/#
+address=/nx.example/
+address=/#/1.2.3.4
+local=/lan/
+server=8.8.8.8
+server=9.9.9.9#5353
+server=/corp.example/10.0.0.1
+server=/corp.example/other.example/#
+server=/bad.example/not-an-ip
+dhcp-host=00:11:22:33:44:55,192.168.1.10,printer,infinite
+dhcp-host=aa:bb:cc:dd:ee:ff,set:iot,laptop,192.168.1.11,12h
+dhcp-host=00:11:22:33:44:55,192.168.1.12
+dhcp-host=11:22:33:44:55:66,ignore
+conf-dir=/etc/dnsmasq.d
+`
+
+	res, err := ParseDnsmasq(strings.NewReader(conf))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*filtering.LegacyRewrite{{
+		Domain:  "router.lan",
+		Answer:  "192.168.1.1",
+		Enabled: true,
+	}, {
+		Domain:  "*.router.lan",
+		Answer:  "192.168.1.1",
+		Enabled: true,
+	}}, res.Rewrites)
+
+	assert.Equal(t, []string{
+		"||ads.example^",
+		"||tracker.example^",
+		"||nx.example^$dnsrewrite=NXDOMAIN",
+		"||lan^$dnsrewrite=NXDOMAIN",
+	}, res.UserRules)
+
+	assert.Equal(t, []string{
+		"8.8.8.8",
+		"9.9.9.9:5353",
+		"[/corp.example/]10.0.0.1",
+		"[/corp.example/other.example/]#",
+	}, res.Upstreams)
+
+	assert.Equal(t, []*dhcpsvc.Lease{{
+		IP:       netip.MustParseAddr("192.168.1.10"),
+		Hostname: "printer",
+		HWAddr:   net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		IsStatic: true,
+	}, {
+		IP:       netip.MustParseAddr("192.168.1.11"),
+		Hostname: "laptop",
+		HWAddr:   net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		IsStatic: true,
+	}}, res.StaticLeases)
+
+	wantSkipped := []*Skipped{{
+		Text:   "domain-needed",
+		Reason: "unsupported option",
+		Line:   2,
+	}, {
+		Text:   "address=/#/1.2.3.4",
+		Reason: "matching all domains is not supported",
+		Line:   6,
+	}, {
+		Text:   "server=/bad.example/not-an-ip",
+		Reason: `bad address: ParseAddr("not-an-ip"): unable to parse IP`,
+		Line:   12,
+	}, {
+		Text:   "dhcp-host=00:11:22:33:44:55,192.168.1.12",
+		Reason: "duplicated hardware address or ip address",
+		Line:   15,
+	}, {
+		Text:   "dhcp-host=11:22:33:44:55:66,ignore",
+		Reason: "ignored host",
+		Line:   16,
+	}, {
+		Text:   "conf-dir=/etc/dnsmasq.d",
+		Reason: "including files is not supported",
+		Line:   17,
+	}}
+	assert.Equal(t, wantSkipped, res.Skipped)
+}
+
+func TestReadDnsmasq(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "dnsmasq.d")
+
+	err := os.Mkdir(confDir, 0o700)
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"dnsmasq.conf":            "conf-dir=" + confDir + ",*.conf\nserver=1.1.1.1\n",
+		"dnsmasq.d/01-a.conf":     "server=/a.example/10.0.0.1\n",
+		"dnsmasq.d/02-b.conf":     "conf-file=" + filepath.Join(dir, "extra") + "\n",
+		"dnsmasq.d/03-c.conf~":    "server=/backup.example/10.0.0.3\n",
+		"dnsmasq.d/04-d.disabled": "server=/disabled.example/10.0.0.4\n",
+		"extra":                   "address=/extra.example/10.0.0.2\n",
+	}
+
+	for name, data := range files {
+		err = os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600)
+		require.NoError(t, err)
+	}
+
+	res, err := ReadDnsmasq(filepath.Join(dir, "dnsmasq.conf"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"[/a.example/]10.0.0.1", "1.1.1.1"}, res.Upstreams)
+	assert.Len(t, res.Rewrites, 2)
+	assert.Empty(t, res.Skipped)
+
+	t.Run("dir", func(t *testing.T) {
+		res, err = ReadDnsmasq(confDir)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{
+			"[/a.example/]10.0.0.1",
+			"[/disabled.example/]10.0.0.4",
+		}, res.Upstreams)
+	})
+
+	t.Run("not_exist", func(t *testing.T) {
+		_, err = ReadDnsmasq(filepath.Join(dir, "none"))
+		testutil.AssertErrorMsg(
+			t,
+			"stat "+filepath.Join(dir, "none")+": no such file or directory",
+			err,
+		)
+	})
+}
@@ -0,0 +1,320 @@
+package confimport
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// The names of the files of the Pi-hole configuration directory.
+const (
+	piholeFileGravity   = "gravity.db"
+	piholeFileAdlists   = "adlists.list"
+	piholeFileCustom    = "custom.list"
+	piholeFileWhitelist = "whitelist.txt"
+	piholeFileBlacklist = "blacklist.txt"
+	piholeFileRegex     = "regex.list"
+)
+
+// piholeWALSuffix is the suffix of the write-ahead log file of the gravity
+// database.
+const piholeWALSuffix = "-wal"
+
+// The types of the domainlist entries of the Pi-hole gravity database.
+const (
+	piholeDomainExactAllow int64 = 0
+	piholeDomainExactDeny  int64 = 1
+	piholeDomainRegexAllow int64 = 2
+	piholeDomainRegexDeny  int64 = 3
+)
+
+// The column indexes of the tables of the Pi-hole gravity database.  The
+// columns are only ever appended to the tables, so the indexes are the same in
+// all versions of Pi-hole.
+const (
+	piholeAdlistColAddress = 1
+	piholeAdlistColEnabled = 2
+	piholeAdlistColComment = 5
+	piholeAdlistColType    = 11
+
+	piholeDomainColType    = 1
+	piholeDomainColDomain  = 2
+	piholeDomainColEnabled = 3
+)
+
+// piholeAdlistTypeAllow is the type of the adlists, which are allowlists.
+const piholeAdlistTypeAllow int64 = 1
+
+// ReadPihole reads the Pi-hole configuration from the directory at path, such
+// as /etc/pihole, or from the gravity database file at path.  The adlists
+// become the filters, the domain lists become the custom filtering rules, and
+// the local DNS records from custom.list become the rewrites.
+func ReadPihole(path string) (res *Result, err error) {
+	res = &Result{}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		err = readPiholeGravity(res, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		return res, nil
+	}
+
+	files := []struct {
+		read func(res *Result, path string) (err error)
+		name string
+	}{{
+		read: readPiholeGravity,
+		name: piholeFileGravity,
+	}, {
+		read: readPiholeAdlists,
+		name: piholeFileAdlists,
+	}, {
+		read: readPiholeCustom,
+		name: piholeFileCustom,
+	}, {
+		read: piholeDomainsReader(piholeDomainExactAllow),
+		name: piholeFileWhitelist,
+	}, {
+		read: piholeDomainsReader(piholeDomainExactDeny),
+		name: piholeFileBlacklist,
+	}, {
+		read: piholeDomainsReader(piholeDomainRegexDeny),
+		name: piholeFileRegex,
+	}}
+
+	for _, f := range files {
+		p := filepath.Join(path, f.name)
+		err = f.read(res, p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+
+	return res, nil
+}
+
+// readPiholeGravity reads the adlists and the domain lists from the gravity
+// database at path.
+func readPiholeGravity(res *Result, path string) (err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	db, err := newSQLiteDB(data)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	// Pi-hole may keep the recent changes in the write-ahead log.
+	wal, err := os.ReadFile(path + piholeWALSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	err = db.applyWAL(wal)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	err = readSQLiteTable(db, "adlist", func(row []any) {
+		addPiholeAdlist(res, row)
+	})
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	return readSQLiteTable(db, "domainlist", func(row []any) {
+		typ, _ := sqliteColumn[int64](row, piholeDomainColType)
+		domain, _ := sqliteColumn[string](row, piholeDomainColDomain)
+		enabled, _ := sqliteColumn[int64](row, piholeDomainColEnabled)
+		if enabled == 0 {
+			res.skip(path, domain, "disabled entry", 0)
+
+			return
+		}
+
+		addPiholeDomain(res, path, typ, domain, 0)
+	})
+}
+
+// readSQLiteTable calls f for each row of the table with name, if there is
+// one.
+func readSQLiteTable(db *sqliteDB, name string, f func(row []any)) (err error) {
+	root, ok, err := db.tableRoot(name)
+	if err != nil {
+		return fmt.Errorf("reading schema: %w", err)
+	} else if !ok {
+		return nil
+	}
+
+	err = db.rows(root, func(row []any) (err error) {
+		f(row)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading table %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// sqliteColumn returns the value of the column with index i of row.  ok is
+// false if there is no such column or its value isn't of type T.
+func sqliteColumn[T int64 | string](row []any, i int) (val T, ok bool) {
+	if i >= len(row) {
+		return val, false
+	}
+
+	val, ok = row[i].(T)
+
+	return val, ok
+}
+
+// addPiholeAdlist adds the filter from the row of the adlist table.
+func addPiholeAdlist(res *Result, row []any) {
+	addr, _ := sqliteColumn[string](row, piholeAdlistColAddress)
+	enabled, _ := sqliteColumn[int64](row, piholeAdlistColEnabled)
+	comment, _ := sqliteColumn[string](row, piholeAdlistColComment)
+	typ, _ := sqliteColumn[int64](row, piholeAdlistColType)
+
+	res.addFilter(filtering.FilterYAML{
+		Enabled: enabled != 0,
+		URL:     strings.TrimSpace(addr),
+		Name:    strings.TrimSpace(comment),
+	}, typ == piholeAdlistTypeAllow)
+}
+
+// addPiholeDomain adds the custom filtering rule for the domain list entry of
+// the type.  file and line are used to report the skipped entries.
+func addPiholeDomain(res *Result, file string, typ int64, domain string, line int) {
+	domain = strings.TrimSpace(domain)
+
+	var rule string
+	switch typ {
+	case piholeDomainExactAllow, piholeDomainExactDeny:
+		host := strings.ToLower(domain)
+		if err := netutil.ValidateDomainName(host); err != nil {
+			res.skip(file, domain, err.Error(), line)
+
+			return
+		}
+
+		rule = fmt.Sprintf("|%s^", host)
+	case piholeDomainRegexAllow, piholeDomainRegexDeny:
+		if strings.Contains(domain, ";") {
+			// Pi-hole extends the regular expressions with options, such as
+			// ";querytype=A", which have no equivalent here.
+			res.skip(file, domain, "regular expression options are not supported", line)
+
+			return
+		}
+
+		rule = "/" + domain + "/"
+	default:
+		res.skip(file, domain, fmt.Sprintf("domain type %d is not supported", typ), line)
+
+		return
+	}
+
+	if typ == piholeDomainExactAllow || typ == piholeDomainRegexAllow {
+		rule = "@@" + rule
+	}
+
+	res.addUserRule(rule)
+}
+
+// readPiholeLines calls f for each non-empty line of the file at path, which
+// isn't a comment.
+func readPiholeLines(path string, f func(line string, num int)) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, file.Close()) }()
+
+	s := bufio.NewScanner(file)
+	for num := 1; s.Scan(); num++ {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && line[0] != '#' {
+			f(line, num)
+		}
+	}
+
+	return s.Err()
+}
+
+// readPiholeAdlists reads the adlists from the legacy adlists.list file at
+// path.
+func readPiholeAdlists(res *Result, path string) (err error) {
+	return readPiholeLines(path, func(line string, _ int) {
+		res.addFilter(filtering.FilterYAML{
+			Enabled: true,
+			URL:     line,
+		}, false)
+	})
+}
+
+// piholeDomainsReader returns a function reading the legacy domain list file
+// with the entries of the type.
+func piholeDomainsReader(typ int64) (read func(res *Result, path string) (err error)) {
+	return func(res *Result, path string) (err error) {
+		return readPiholeLines(path, func(line string, num int) {
+			addPiholeDomain(res, path, typ, line, num)
+		})
+	}
+}
+
+// readPiholeCustom reads the local DNS records from the custom.list file at
+// path, which has the hosts-file format.  Pi-hole answers only the listed
+// domains, so their subdomains aren't rewritten.
+func readPiholeCustom(res *Result, path string) (err error) {
+	return readPiholeLines(path, func(line string, num int) {
+		fields := strings.Fields(line)
+		ip, parseErr := netip.ParseAddr(fields[0])
+		if parseErr != nil {
+			res.skip(path, line, fmt.Sprintf("bad address: %s", parseErr), num)
+
+			return
+		} else if len(fields) < 2 {
+			res.skip(path, line, "no domains", num)
+
+			return
+		}
+
+		for _, d := range fields[1:] {
+			d = strings.ToLower(strings.TrimSuffix(d, "."))
+			if netutil.ValidateDomainName(d) != nil {
+				res.skip(path, line, fmt.Sprintf("bad domain %q", d), num)
+
+				continue
+			}
+
+			res.addRewrite(d, ip.String())
+		}
+	})
+}
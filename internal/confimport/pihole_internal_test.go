@@ -0,0 +1,107 @@
+package confimport
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPihole(t *testing.T) {
+	dir := filepath.Join("testdata", "pihole")
+
+	res, err := ReadPihole(dir)
+	require.NoError(t, err)
+
+	require.Len(t, res.Filters, 42)
+
+	long := res.Filters[0]
+	assert.Equal(t, "https://lists.example/long.txt", long.URL)
+	assert.True(t, long.Enabled)
+	assert.Equal(t, "List with a long comment "+strings.Repeat("x", 1200), long.Name)
+
+	for i, f := range res.Filters[1:41] {
+		assert.Equal(t, fmt.Sprintf("https://lists.example/%02d.txt", i), f.URL)
+		assert.Equal(t, fmt.Sprintf("List %02d", i), f.Name)
+		assert.Equal(t, i != 1, f.Enabled)
+	}
+
+	assert.Equal(t, filtering.FilterYAML{
+		Enabled: true,
+		URL:     "https://legacy.example/list.txt",
+	}, res.Filters[41])
+
+	assert.Equal(t, []filtering.FilterYAML{{
+		Enabled: true,
+		URL:     "https://lists.example/allow.txt",
+		Name:    "Allowlist",
+	}}, res.WhitelistFilters)
+
+	assert.Equal(t, []string{
+		"@@|allowed.example^",
+		"|blocked.example^",
+		`@@/(\.|^)good\.example$/`,
+		`/^ads[0-9]*\./`,
+	}, res.UserRules)
+
+	assert.Equal(t, []*filtering.LegacyRewrite{{
+		Domain:  "nas.lan",
+		Answer:  "192.168.1.2",
+		Enabled: true,
+	}, {
+		Domain:  "printer.lan",
+		Answer:  "192.168.1.3",
+		Enabled: true,
+	}, {
+		Domain:  "printer.home",
+		Answer:  "192.168.1.3",
+		Enabled: true,
+	}}, res.Rewrites)
+
+	gravity := filepath.Join(dir, "gravity.db")
+	custom := filepath.Join(dir, "custom.list")
+	assert.Equal(t, []*Skipped{{
+		File:   gravity,
+		Text:   "^q\\.example$;querytype=AAAA",
+		Reason: "regular expression options are not supported",
+	}, {
+		File:   gravity,
+		Text:   "disabled.example",
+		Reason: "disabled entry",
+	}, {
+		File:   custom,
+		Text:   "not-an-ip bad.lan",
+		Reason: `bad address: ParseAddr("not-an-ip"): unable to parse IP`,
+		Line:   4,
+	}}, res.Skipped)
+}
+
+func TestReadPihole_gravity(t *testing.T) {
+	res, err := ReadPihole(filepath.Join("testdata", "pihole", "gravity.db"))
+	require.NoError(t, err)
+
+	assert.Len(t, res.Filters, 41)
+	assert.Len(t, res.WhitelistFilters, 1)
+	assert.Len(t, res.UserRules, 4)
+	assert.Empty(t, res.Rewrites)
+
+	path := filepath.Join("testdata", "pihole", "custom.list")
+	_, err = ReadPihole(path)
+	testutil.AssertErrorMsg(t, path+": not an sqlite 3 database", err)
+}
+
+func TestReadPihole_gravityWAL(t *testing.T) {
+	res, err := ReadPihole(filepath.Join("testdata", "pihole", "gravity_wal.db"))
+	require.NoError(t, err)
+
+	require.Len(t, res.Filters, 2)
+
+	assert.Equal(t, "https://checkpointed.example/list.txt", res.Filters[0].URL)
+	assert.Equal(t, "https://wal.example/list.txt", res.Filters[1].URL)
+	assert.Len(t, res.UserRules, 1)
+}
@@ -0,0 +1,493 @@
+package confimport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// sqliteHeader is the magic string at the beginning of an SQLite database file.
+const sqliteHeader = "SQLite format 3\x00"
+
+// SQLite b-tree page types.
+const (
+	sqlitePageInteriorTable byte = 0x05
+	sqlitePageLeafTable     byte = 0x0d
+)
+
+// sqliteMinUsableSize is the minimum usable size of a page allowed by SQLite.
+const sqliteMinUsableSize = 480
+
+// sqliteDB is a minimal read-only reader of the tables of an SQLite 3 database
+// file.  It only supports the UTF-8 databases.  The write-ahead log, if any,
+// must be applied using [sqliteDB.applyWAL].  It's used instead of an
+// SQLite library to avoid a large dependency for the rarely used import.
+type sqliteDB struct {
+	data       []byte
+	pageSize   int
+	usableSize int
+}
+
+// newSQLiteDB returns a new reader of the SQLite database contained in data.
+func newSQLiteDB(data []byte) (db *sqliteDB, err error) {
+	if len(data) < 100 || string(data[:len(sqliteHeader)]) != sqliteHeader {
+		return nil, errors.Error("not an sqlite 3 database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = math.MaxUint16 + 1
+	}
+
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("bad page size %d", pageSize)
+	}
+
+	usableSize := pageSize - int(data[20])
+	if usableSize < sqliteMinUsableSize {
+		return nil, fmt.Errorf("bad usable page size %d", usableSize)
+	}
+
+	if enc := binary.BigEndian.Uint32(data[56:60]); enc != 0 && enc != 1 {
+		return nil, fmt.Errorf("text encoding %d: %w", enc, errors.ErrUnsupported)
+	}
+
+	return &sqliteDB{
+		data:       data,
+		pageSize:   pageSize,
+		usableSize: usableSize,
+	}, nil
+}
+
+// page returns the data of the page with the number n, starting from 1.
+func (db *sqliteDB) page(n uint32) (p []byte, err error) {
+	start := (int(n) - 1) * db.pageSize
+	if n == 0 || start+db.pageSize > len(db.data) {
+		return nil, fmt.Errorf("page %d: out of range", n)
+	}
+
+	return db.data[start : start+db.pageSize], nil
+}
+
+// rows calls f for each row of the table with the root page root.  The row ID
+// replaces the NULL value of the first column, which is how SQLite stores the
+// INTEGER PRIMARY KEY columns.
+func (db *sqliteDB) rows(root uint32, f func(row []any) (err error)) (err error) {
+	return db.walk(root, map[uint32]struct{}{}, f)
+}
+
+// walk calls f for each row of the table b-tree page n and its children.
+// visited are the numbers of the b-tree and overflow pages that have already
+// been read, since a page may only be a part of a table once.
+func (db *sqliteDB) walk(n uint32, visited map[uint32]struct{}, f func(row []any) (err error)) (err error) {
+	if _, ok := visited[n]; ok {
+		return fmt.Errorf("page %d: loop", n)
+	}
+
+	visited[n] = struct{}{}
+
+	p, err := db.page(n)
+	if err != nil {
+		return err
+	}
+
+	hdr := p
+	if n == 1 {
+		hdr = p[100:]
+	}
+
+	if len(hdr) < 12 {
+		return fmt.Errorf("page %d: too short", n)
+	}
+
+	numCells := int(binary.BigEndian.Uint16(hdr[3:5]))
+	switch hdr[0] {
+	case sqlitePageLeafTable:
+		return db.walkLeaf(p, hdr[8:], numCells, visited, f)
+	case sqlitePageInteriorTable:
+		ptrs := hdr[12:]
+		if len(ptrs) < 2*numCells {
+			return fmt.Errorf("page %d: too many cells", n)
+		}
+
+		for i := range numCells {
+			off := int(binary.BigEndian.Uint16(ptrs[2*i:]))
+			if off+4 > len(p) {
+				return fmt.Errorf("page %d: bad cell offset", n)
+			}
+
+			err = db.walk(binary.BigEndian.Uint32(p[off:]), visited, f)
+			if err != nil {
+				return err
+			}
+		}
+
+		return db.walk(binary.BigEndian.Uint32(hdr[8:12]), visited, f)
+	default:
+		return fmt.Errorf("page %d: unexpected type %#x", n, hdr[0])
+	}
+}
+
+// walkLeaf calls f for each row of the leaf table page p.  ptrs is the cell
+// pointer array.  visited is the same as in [sqliteDB.walk].
+func (db *sqliteDB) walkLeaf(
+	p []byte,
+	ptrs []byte,
+	numCells int,
+	visited map[uint32]struct{},
+	f func(row []any) (err error),
+) (err error) {
+	if len(ptrs) < 2*numCells {
+		return errors.Error("too many cells")
+	}
+
+	for i := range numCells {
+		off := int(binary.BigEndian.Uint16(ptrs[2*i:]))
+		if off >= len(p) {
+			return errors.Error("bad cell offset")
+		}
+
+		var payload []byte
+		var rowID int64
+		payload, rowID, err = db.leafCell(p[off:], visited)
+		if err != nil {
+			return fmt.Errorf("cell at index %d: %w", i, err)
+		}
+
+		var row []any
+		row, err = parseSQLiteRecord(payload)
+		if err != nil {
+			return fmt.Errorf("cell at index %d: %w", i, err)
+		}
+
+		if len(row) > 0 && row[0] == nil {
+			row[0] = rowID
+		}
+
+		err = f(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// leafCell returns the payload and the row ID of the table leaf cell c,
+// following the overflow pages.  visited is the same as in [sqliteDB.walk].
+func (db *sqliteDB) leafCell(
+	c []byte,
+	visited map[uint32]struct{},
+) (payload []byte, rowID int64, err error) {
+	size, n := sqliteVarint(c)
+	if n == 0 {
+		return nil, 0, errors.Error("bad payload size")
+	} else if size > uint64(len(db.data)) {
+		// The payload can't be larger than the database itself.  This also
+		// limits the memory allocated for a crafted database.
+		return nil, 0, fmt.Errorf("payload size %d: out of range", size)
+	}
+
+	c = c[n:]
+	id, n := sqliteVarint(c)
+	if n == 0 {
+		return nil, 0, errors.Error("bad row id")
+	}
+
+	c = c[n:]
+
+	total := int(size)
+	local := db.localPayloadSize(total)
+	if local > len(c) {
+		return nil, 0, errors.Error("payload out of range")
+	} else if local == total {
+		return c[:local], int64(id), nil
+	}
+
+	if local+4 > len(c) {
+		return nil, 0, errors.Error("overflow page out of range")
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, total))
+	buf.Write(c[:local])
+
+	next := binary.BigEndian.Uint32(c[local:])
+	for buf.Len() < total {
+		if _, ok := visited[next]; ok {
+			return nil, 0, fmt.Errorf("overflow page %d: loop", next)
+		}
+
+		visited[next] = struct{}{}
+
+		var p []byte
+		p, err = db.page(next)
+		if err != nil {
+			return nil, 0, fmt.Errorf("overflow: %w", err)
+		}
+
+		chunk := p[4:db.usableSize]
+		buf.Write(chunk[:min(len(chunk), total-buf.Len())])
+		next = binary.BigEndian.Uint32(p)
+	}
+
+	return buf.Bytes(), int64(id), nil
+}
+
+// localPayloadSize returns the size of the part of the payload of the size
+// total, which is stored on a table leaf page.
+func (db *sqliteDB) localPayloadSize(total int) (local int) {
+	u := db.usableSize
+	maxLocal := u - 35
+	if total <= maxLocal {
+		return total
+	}
+
+	minLocal := (u-12)*32/255 - 23
+	local = minLocal + (total-minLocal)%(u-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+
+	return local
+}
+
+// parseSQLiteRecord parses the record format of SQLite.  The values are nil,
+// int64, float64, string, or []byte.
+func parseSQLiteRecord(rec []byte) (row []any, err error) {
+	hdrSize, n := sqliteVarint(rec)
+	if n == 0 || hdrSize < uint64(n) || hdrSize > uint64(len(rec)) {
+		return nil, errors.Error("bad record header")
+	}
+
+	hdr, body := rec[n:hdrSize], rec[hdrSize:]
+	for len(hdr) > 0 {
+		var typ uint64
+		typ, n = sqliteVarint(hdr)
+		if n == 0 {
+			return nil, errors.Error("bad serial type")
+		}
+
+		hdr = hdr[n:]
+
+		var val any
+		val, body, err = parseSQLiteValue(typ, body)
+		if err != nil {
+			return nil, err
+		}
+
+		row = append(row, val)
+	}
+
+	return row, nil
+}
+
+// sqliteIntSizes are the sizes of the integer values by their serial types.
+var sqliteIntSizes = [...]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 6, 6: 8}
+
+// parseSQLiteValue parses the value of the serial type typ from the beginning
+// of body.
+func parseSQLiteValue(typ uint64, body []byte) (val any, rest []byte, err error) {
+	size := 0
+	switch {
+	case typ == 0, typ == 8, typ == 9:
+		// Go on.
+	case typ <= 6:
+		size = sqliteIntSizes[typ]
+	case typ == 7:
+		size = 8
+	case typ >= 12:
+		if (typ-12)/2 > uint64(len(body)) {
+			return nil, nil, errors.Error("value out of range")
+		}
+
+		size = int((typ - 12) / 2)
+	default:
+		return nil, nil, fmt.Errorf("serial type %d: %w", typ, errors.ErrBadEnumValue)
+	}
+
+	if size > len(body) {
+		return nil, nil, errors.Error("value out of range")
+	}
+
+	b, rest := body[:size], body[size:]
+	switch {
+	case typ == 0:
+		return nil, rest, nil
+	case typ == 8:
+		return int64(0), rest, nil
+	case typ == 9:
+		return int64(1), rest, nil
+	case typ <= 6:
+		var v int64
+		for _, c := range b {
+			v = v<<8 | int64(c)
+		}
+
+		// Sign-extend the value.
+		shift := 64 - 8*size
+
+		return v << shift >> shift, rest, nil
+	case typ == 7:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), rest, nil
+	case typ%2 == 0:
+		return bytes.Clone(b), rest, nil
+	default:
+		return string(b), rest, nil
+	}
+}
+
+// sqliteVarint decodes the big-endian variable-length integer of SQLite from
+// the beginning of b.  n is zero if b doesn't contain a valid varint.
+func sqliteVarint(b []byte) (v uint64, n int) {
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+
+	return 0, 0
+}
+
+// tableRoot returns the root page of the table with name.  ok is false if
+// there is no such table.
+func (db *sqliteDB) tableRoot(name string) (root uint32, ok bool, err error) {
+	// The columns of the schema table are type, name, tbl_name, rootpage, and
+	// sql.
+	err = db.rows(1, func(row []any) (err error) {
+		if len(row) < 4 || row[0] != "table" || row[1] != name {
+			return nil
+		}
+
+		page, isInt := row[3].(int64)
+		if !isInt || page <= 0 || page > math.MaxUint32 {
+			return fmt.Errorf("table %q: bad root page", name)
+		}
+
+		root, ok = uint32(page), true
+
+		return nil
+	})
+
+	return root, ok, err
+}
+
+// The sizes of the headers of the SQLite write-ahead log.
+const (
+	sqliteWALHeaderSize      = 32
+	sqliteWALFrameHeaderSize = 24
+)
+
+// The magic numbers of the SQLite write-ahead log.  The least significant bit
+// shows if the checksums use the big-endian byte order.
+const (
+	sqliteWALMagicLE uint32 = 0x377f0682
+	sqliteWALMagicBE uint32 = 0x377f0683
+)
+
+// applyWAL applies the committed frames of the write-ahead log wal to the
+// database the way SQLite does on a checkpoint.  The frames after the last
+// valid commit frame are ignored.
+func (db *sqliteDB) applyWAL(wal []byte) (err error) {
+	if len(wal) == 0 {
+		return nil
+	} else if len(wal) < sqliteWALHeaderSize {
+		return errors.Error("write-ahead log: too short")
+	}
+
+	var order binary.ByteOrder
+	switch magic := binary.BigEndian.Uint32(wal); magic {
+	case sqliteWALMagicLE:
+		order = binary.LittleEndian
+	case sqliteWALMagicBE:
+		order = binary.BigEndian
+	default:
+		return fmt.Errorf("write-ahead log: bad magic %#x", magic)
+	}
+
+	pageSize := db.pageSize
+	if walPageSize := binary.BigEndian.Uint32(wal[8:12]); walPageSize != uint32(pageSize) {
+		return fmt.Errorf("write-ahead log: page size %d, want %d", walPageSize, pageSize)
+	}
+
+	salts := wal[16:24]
+	s0, s1 := sqliteWALChecksum(order, 0, 0, wal[:24])
+	if s0 != binary.BigEndian.Uint32(wal[24:]) || s1 != binary.BigEndian.Uint32(wal[28:]) {
+		// The log has been reset or hasn't been written completely, so there
+		// is nothing to apply.
+		return nil
+	}
+
+	pages := map[uint32][]byte{}
+	committed := map[uint32][]byte{}
+	var numPages uint32
+
+	frameSize := sqliteWALFrameHeaderSize + pageSize
+	for off := sqliteWALHeaderSize; off+frameSize <= len(wal); off += frameSize {
+		hdr, page := wal[off:off+sqliteWALFrameHeaderSize], wal[off+sqliteWALFrameHeaderSize:off+frameSize]
+		if !bytes.Equal(hdr[8:16], salts) {
+			break
+		}
+
+		s0, s1 = sqliteWALChecksum(order, s0, s1, hdr[:8])
+		s0, s1 = sqliteWALChecksum(order, s0, s1, page)
+		if s0 != binary.BigEndian.Uint32(hdr[16:]) || s1 != binary.BigEndian.Uint32(hdr[20:]) {
+			break
+		}
+
+		pages[binary.BigEndian.Uint32(hdr)] = page
+		if size := binary.BigEndian.Uint32(hdr[4:]); size != 0 {
+			// This is a commit frame.
+			numPages = size
+			for n, p := range pages {
+				committed[n] = p
+			}
+
+			clear(pages)
+		}
+	}
+
+	if len(committed) == 0 {
+		return nil
+	} else if uint64(numPages)*uint64(pageSize) > uint64(len(db.data)+len(wal)) {
+		// The database can't grow by more than the size of the log.
+		return fmt.Errorf("write-ahead log: database size %d: out of range", numPages)
+	}
+
+	data := make([]byte, int(numPages)*pageSize)
+	copy(data, db.data)
+	for n, p := range committed {
+		if n == 0 || n > numPages {
+			continue
+		}
+
+		copy(data[int(n-1)*pageSize:], p)
+	}
+
+	if string(data[:len(sqliteHeader)]) != sqliteHeader {
+		return errors.Error("write-ahead log: bad first page")
+	}
+
+	db.data = data
+
+	return nil
+}
+
+// sqliteWALChecksum continues the checksum s0, s1 of the write-ahead log over
+// b, the length of which must be a multiple of 8.  order is the byte order of
+// the 32-bit words.
+func sqliteWALChecksum(order binary.ByteOrder, s0, s1 uint32, b []byte) (n0, n1 uint32) {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s0 += order.Uint32(b[i:]) + s1
+		s1 += order.Uint32(b[i+4:]) + s0
+	}
+
+	return s0, s1
+}
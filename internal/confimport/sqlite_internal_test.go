@@ -0,0 +1,93 @@
+package confimport
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// testSQLitePageSize is the page size of the crafted test databases.
+const testSQLitePageSize = 512
+
+// newTestSQLiteDB returns the data of a crafted SQLite database of numPages
+// pages with cell as the only cell of the leaf table page 1.
+func newTestSQLiteDB(tb testing.TB, numPages int, cell []byte) (data []byte) {
+	tb.Helper()
+
+	data = make([]byte, numPages*testSQLitePageSize)
+	copy(data, sqliteHeader)
+	binary.BigEndian.PutUint16(data[16:], testSQLitePageSize)
+	binary.BigEndian.PutUint32(data[56:], 1)
+
+	hdr := data[100:]
+	hdr[0] = sqlitePageLeafTable
+	binary.BigEndian.PutUint16(hdr[3:], 1)
+
+	off := testSQLitePageSize - len(cell)
+	require.Greater(tb, off, 100+8+2)
+
+	binary.BigEndian.PutUint16(hdr[8:], uint16(off))
+	copy(data[off:], cell)
+
+	return data
+}
+
+func TestSQLiteDB_rows_crafted(t *testing.T) {
+	t.Parallel()
+
+	// overflowCell is a cell with the payload of 1000 bytes, 39 of which are
+	// stored locally and the rest on the overflow pages starting from page 2.
+	overflowCell := append([]byte{0x87, 0x68, 0x01}, make([]byte, 39)...)
+	overflowCell = binary.BigEndian.AppendUint32(overflowCell, 2)
+
+	loopDB := newTestSQLiteDB(t, 2, overflowCell)
+	binary.BigEndian.PutUint32(loopDB[testSQLitePageSize:], 2)
+
+	testCases := []struct {
+		name       string
+		data       []byte
+		wantErrMsg string
+	}{{
+		name: "negative_size",
+		data: newTestSQLiteDB(t, 1, []byte{
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0x01,
+		}),
+		wantErrMsg: "cell at index 0: payload size 18446744073709551615: out of range",
+	}, {
+		name:       "large_size",
+		data:       newTestSQLiteDB(t, 1, []byte{0x81, 0x80, 0x80, 0x00, 0x01}),
+		wantErrMsg: "cell at index 0: payload size 2097152: out of range",
+	}, {
+		name:       "overflow_loop",
+		data:       loopDB,
+		wantErrMsg: "cell at index 0: overflow page 2: loop",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, err := newSQLiteDB(tc.data)
+			require.NoError(t, err)
+
+			err = db.rows(1, func(_ []any) (err error) { return nil })
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestSQLiteDB_applyWAL(t *testing.T) {
+	t.Parallel()
+
+	db, err := newSQLiteDB(newTestSQLiteDB(t, 1, []byte{0x01, 0x01, 0x01}))
+	require.NoError(t, err)
+
+	err = db.applyWAL(make([]byte, sqliteWALHeaderSize))
+	testutil.AssertErrorMsg(t, "write-ahead log: bad magic 0x0", err)
+
+	err = db.applyWAL([]byte{0x37})
+	testutil.AssertErrorMsg(t, "write-ahead log: too short", err)
+}
@@ -5,15 +5,18 @@ package dhcpd
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
 	"net/netip"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/google/renameio/v2/maybe"
@@ -38,11 +41,57 @@ type dataLeases struct {
 
 // dbLease is the structure of stored lease.
 type dbLease struct {
-	Expiry   string     `json:"expires"`
-	IP       netip.Addr `json:"ip"`
-	Hostname string     `json:"hostname"`
-	HWAddr   string     `json:"mac"`
-	IsStatic bool       `json:"static"`
+	Fingerprint *dbFingerprint `json:"fingerprint,omitempty"`
+	Expiry      string         `json:"expires"`
+	IP          netip.Addr     `json:"ip"`
+	Hostname    string         `json:"hostname"`
+	HWAddr      string         `json:"mac"`
+	IsStatic    bool           `json:"static"`
+}
+
+// dbFingerprint is the structure of stored DHCP fingerprint of a client.  The
+// parameter request list is stored as integers, since the byte slices are
+// encoded as strings.
+type dbFingerprint struct {
+	VendorClass          string `json:"vendor_class,omitempty"`
+	ParameterRequestList []int  `json:"parameter_request_list,omitempty"`
+}
+
+// fromFingerprint converts *fingerprint.DHCP to *dbFingerprint.  fp may be nil.
+func fromFingerprint(fp *fingerprint.DHCP) (dfp *dbFingerprint) {
+	if fp == nil {
+		return nil
+	}
+
+	list := make([]int, 0, len(fp.ParameterRequestList))
+	for _, c := range fp.ParameterRequestList {
+		list = append(list, int(c))
+	}
+
+	return &dbFingerprint{
+		VendorClass:          fp.VendorClass,
+		ParameterRequestList: list,
+	}
+}
+
+// toFingerprint converts *dbFingerprint to *fingerprint.DHCP.  dfp may be nil.
+// Invalid option codes are skipped.
+func (dfp *dbFingerprint) toFingerprint() (fp *fingerprint.DHCP) {
+	if dfp == nil {
+		return nil
+	}
+
+	fp = &fingerprint.DHCP{
+		VendorClass: dfp.VendorClass,
+	}
+
+	for _, c := range dfp.ParameterRequestList {
+		if c >= 0 && c <= math.MaxUint8 {
+			fp.ParameterRequestList = append(fp.ParameterRequestList, uint8(c))
+		}
+	}
+
+	return fp
 }
 
 // fromLease converts *dhcpsvc.Lease to *dbLease.
@@ -57,11 +106,12 @@ func fromLease(l *dhcpsvc.Lease) (dl *dbLease) {
 	}
 
 	return &dbLease{
-		Expiry:   expiryStr,
-		Hostname: l.Hostname,
-		HWAddr:   l.HWAddr.String(),
-		IP:       l.IP,
-		IsStatic: l.IsStatic,
+		Fingerprint: fromFingerprint(l.Fingerprint),
+		Expiry:      expiryStr,
+		Hostname:    l.Hostname,
+		HWAddr:      l.HWAddr.String(),
+		IP:          l.IP,
+		IsStatic:    l.IsStatic,
 	}
 }
 
@@ -81,11 +131,12 @@ func (dl *dbLease) toLease() (l *dhcpsvc.Lease, err error) {
 	}
 
 	return &dhcpsvc.Lease{
-		Expiry:   expiry,
-		IP:       dl.IP,
-		Hostname: dl.Hostname,
-		HWAddr:   mac,
-		IsStatic: dl.IsStatic,
+		Expiry:      expiry,
+		IP:          dl.IP,
+		Hostname:    dl.Hostname,
+		HWAddr:      mac,
+		Fingerprint: dl.Fingerprint.toFingerprint(),
+		IsStatic:    dl.IsStatic,
 	}, nil
 }
 
@@ -167,6 +218,44 @@ func (s *server) dbStore() (err error) {
 	return writeDB(s.conf.dbFilePath, leases)
 }
 
+// ImportStaticLeases adds the static leases to the database of the leases in
+// dataDir.  leases must be static.  The leases with the hardware or IP
+// addresses of the stored leases are skipped.  It must not be called while the
+// DHCP server is running.
+func ImportStaticLeases(dataDir string, leases []*dhcpsvc.Lease) (added int, err error) {
+	path := filepath.Join(dataDir, dataFilename)
+
+	dl := &dataLeases{}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, dl)
+		if err != nil {
+			return 0, fmt.Errorf("decoding db: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("reading db: %w", err)
+	}
+
+	stored := dl.Leases
+	for _, l := range leases {
+		mac := l.HWAddr.String()
+		if slices.ContainsFunc(stored, func(sl *dbLease) (ok bool) {
+			return sl.HWAddr == mac || sl.IP == l.IP
+		}) {
+			continue
+		}
+
+		stored = append(stored, fromLease(l))
+		added++
+	}
+
+	if added == 0 {
+		return 0, nil
+	}
+
+	return added, writeDB(path, stored)
+}
+
 // writeDB writes leases to file at path.
 func writeDB(path string, leases []*dbLease) (err error) {
 	defer func() { err = errors.Annotate(err, "writing db: %w") }()
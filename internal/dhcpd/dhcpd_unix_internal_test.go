@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -50,6 +51,10 @@ func TestDB(t *testing.T) {
 		Hostname: "static-1.local",
 		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
 		IP:       netip.MustParseAddr("192.168.10.100"),
+		Fingerprint: &fingerprint.DHCP{
+			VendorClass:          "MSFT 5.0",
+			ParameterRequestList: []uint8{1, 3, 6, 15},
+		},
 	}, {
 		Hostname: "static-2.local",
 		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xBB},
@@ -80,10 +85,12 @@ func TestDB(t *testing.T) {
 	assert.Equal(t, leases[0].HWAddr, ll[0].HWAddr)
 	assert.Equal(t, leases[0].IP, ll[0].IP)
 	assert.Equal(t, leases[0].Expiry.Unix(), ll[0].Expiry.Unix())
+	assert.Equal(t, leases[0].Fingerprint, ll[0].Fingerprint)
 
 	assert.Equal(t, leases[1].HWAddr, ll[1].HWAddr)
 	assert.Equal(t, leases[1].IP, ll[1].IP)
 	assert.True(t, ll[1].IsStatic)
+	assert.Nil(t, ll[1].Fingerprint)
 }
 
 func TestV4Server_badRange(t *testing.T) {
@@ -15,6 +15,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
@@ -976,6 +977,8 @@ func (s *v4Server) handleRequest(req, resp *dhcpv4.DHCPv4) (lease *dhcpsvc.Lease
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
 
+	lease.Fingerprint = dhcpFingerprint(req)
+
 	if lease.IsStatic {
 		if lease.Hostname != "" {
 			// TODO(e.burkov):  This option is used to update the server's DNS
@@ -996,6 +999,23 @@ func (s *v4Server) handleRequest(req, resp *dhcpv4.DHCPv4) (lease *dhcpsvc.Lease
 	return lease, needsReply
 }
 
+// dhcpFingerprint returns the fingerprint of the client from req.  fp is nil if
+// req has neither the parameter request list nor the vendor class identifier.
+func dhcpFingerprint(req *dhcpv4.DHCPv4) (fp *fingerprint.DHCP) {
+	// Use the raw option data, since the order of the requested options is
+	// significant.
+	prl := req.Options.Get(dhcpv4.OptionParameterRequestList)
+	vc := req.ClassIdentifier()
+	if len(prl) == 0 && vc == "" {
+		return nil
+	}
+
+	return &fingerprint.DHCP{
+		VendorClass:          vc,
+		ParameterRequestList: slices.Clone(prl),
+	}
+}
+
 // handleDecline is the handler for the DHCP Decline request.
 func (s *v4Server) handleDecline(req, resp *dhcpv4.DHCPv4) (err error) {
 	s.conf.notify(LeaseChangedDBStore)
@@ -7,6 +7,7 @@ import (
 	"slices"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/golibs/timeutil"
 )
 
@@ -30,6 +31,10 @@ type Lease struct {
 	// HWAddr is the physical hardware (MAC) address.  It must not be nil.
 	HWAddr net.HardwareAddr
 
+	// Fingerprint is the fingerprint of the client from its last DHCP
+	// request.  It may be nil.
+	Fingerprint *fingerprint.DHCP
+
 	// IsStatic defines if the lease is static.
 	IsStatic bool
 }
@@ -41,11 +46,12 @@ func (l *Lease) Clone() (clone *Lease) {
 	}
 
 	return &Lease{
-		Expiry:   l.Expiry,
-		Hostname: l.Hostname,
-		HWAddr:   slices.Clone(l.HWAddr),
-		IP:       l.IP,
-		IsStatic: l.IsStatic,
+		Expiry:      l.Expiry,
+		Hostname:    l.Hostname,
+		HWAddr:      slices.Clone(l.HWAddr),
+		Fingerprint: l.Fingerprint.Clone(),
+		IP:          l.IP,
+		IsStatic:    l.IsStatic,
 	}
 }
 
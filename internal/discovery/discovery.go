@@ -0,0 +1,281 @@
+// Package discovery implements the active discovery of the names of the devices
+// in the local network with multicast DNS, NetBIOS, and SSDP.
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/service"
+)
+
+// Interface discovers the devices in the local network.
+type Interface interface {
+	// Refresher probes the network and updates the stored data.  It must be
+	// safe for concurrent use.
+	service.Refresher
+
+	// Devices returns the last set of the discovered devices.  Both the method
+	// and it's result must be safe for concurrent use.
+	Devices() (ds []Device)
+}
+
+// Empty is the [Interface] implementation that does nothing.
+type Empty struct{}
+
+// type check
+var _ Interface = Empty{}
+
+// Refresh implements the [Interface] interface for Empty.  It does nothing and
+// always returns nil error.
+func (Empty) Refresh(_ context.Context) (err error) { return nil }
+
+// Devices implements the [Interface] interface for Empty.  It always returns
+// nil.
+func (Empty) Devices() (ds []Device) { return nil }
+
+// Protocol is the protocol, with which a device has been discovered.
+type Protocol string
+
+// Supported discovery protocols.  The order of the constants is the order of
+// probing, so the names from the earlier protocols take precedence.
+const (
+	ProtocolMDNS    Protocol = "mdns"
+	ProtocolNetBIOS Protocol = "netbios"
+	ProtocolSSDP    Protocol = "ssdp"
+)
+
+// Device is a device discovered in the local network.
+type Device struct {
+	// IP is the address of the device.
+	IP netip.Addr
+
+	// Name is the name of the device.  It is never empty.
+	Name string
+
+	// Protocol is the protocol, with which the device has been discovered.
+	Protocol Protocol
+}
+
+// Config is the configuration of the [Prober].
+type Config struct {
+	// Logger is used for logging the discovery.  It must not be nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used to fetch the descriptions of the SSDP devices.  If
+	// it's nil, a client with Timeout is used.
+	HTTPClient *http.Client
+
+	// Interfaces are the names of the network interfaces, in the IPv4 networks
+	// of which the devices are discovered.
+	Interfaces []string
+
+	// Timeout is the time to wait for the responses of each protocol in each
+	// network.  It must be positive.
+	Timeout time.Duration
+
+	// MDNS, if true, enables the discovery with multicast DNS.
+	MDNS bool
+
+	// NetBIOS, if true, enables the discovery with NetBIOS node status
+	// requests.
+	NetBIOS bool
+
+	// SSDP, if true, enables the discovery with SSDP.
+	SSDP bool
+}
+
+// Prober is the [Interface] implementation, which probes the networks of the
+// configured interfaces.
+type Prober struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+
+	// mu protects devices.
+	mu      *sync.Mutex
+	devices []Device
+
+	interfaces []string
+	timeout    time.Duration
+	mdns       bool
+	netbios    bool
+	ssdp       bool
+}
+
+// type check
+var _ Interface = (*Prober)(nil)
+
+// New returns a new properly initialized *Prober.  c must not be nil and must
+// be valid.
+func New(c *Config) (p *Prober) {
+	return &Prober{
+		logger:     c.Logger,
+		httpClient: cmp.Or(c.HTTPClient, &http.Client{Timeout: c.Timeout}),
+		mu:         &sync.Mutex{},
+		interfaces: slices.Clone(c.Interfaces),
+		timeout:    c.Timeout,
+		mdns:       c.MDNS,
+		netbios:    c.NetBIOS,
+		ssdp:       c.SSDP,
+	}
+}
+
+// Refresh implements the [Interface] interface for *Prober.
+func (p *Prober) Refresh(ctx context.Context) (err error) {
+	found := map[netip.Addr]Device{}
+
+	var errs []error
+	for _, name := range p.interfaces {
+		iface, prefixes, ifaceErr := interfacePrefixes(name)
+		if ifaceErr != nil {
+			errs = append(errs, fmt.Errorf("interface %q: %w", name, ifaceErr))
+
+			continue
+		}
+
+		for _, pref := range prefixes {
+			for _, d := range p.probe(ctx, iface, pref) {
+				if _, ok := found[d.IP]; !ok {
+					found[d.IP] = d
+				}
+			}
+		}
+	}
+
+	devices := make([]Device, 0, len(found))
+	for _, d := range found {
+		devices = append(devices, d)
+	}
+
+	slices.SortFunc(devices, func(a, b Device) (res int) { return a.IP.Compare(b.IP) })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.devices = devices
+
+	return errors.Join(errs...)
+}
+
+// Devices implements the [Interface] interface for *Prober.
+func (p *Prober) Devices() (ds []Device) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.devices)
+}
+
+// probe discovers the devices in pref of iface with all enabled protocols.
+// The errors are logged.
+func (p *Prober) probe(ctx context.Context, iface *net.Interface, pref netip.Prefix) (ds []Device) {
+	type probeFunc = func(
+		ctx context.Context,
+		iface *net.Interface,
+		pref netip.Prefix,
+	) (ds []Device, err error)
+
+	probes := []struct {
+		probe    probeFunc
+		protocol Protocol
+		enabled  bool
+	}{{
+		probe:    p.probeMDNS,
+		protocol: ProtocolMDNS,
+		enabled:  p.mdns,
+	}, {
+		probe:    p.probeNetBIOS,
+		protocol: ProtocolNetBIOS,
+		enabled:  p.netbios,
+	}, {
+		probe:    p.probeSSDP,
+		protocol: ProtocolSSDP,
+		enabled:  p.ssdp,
+	}}
+
+	for _, pr := range probes {
+		if !pr.enabled {
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		found, err := pr.probe(probeCtx, iface, pref)
+		cancel()
+		if err != nil {
+			p.logger.DebugContext(
+				ctx,
+				"probing",
+				"protocol", pr.protocol,
+				"iface", iface.Name,
+				"prefix", pref,
+				slogutil.KeyError, err,
+			)
+		}
+
+		ds = append(ds, found...)
+	}
+
+	return ds
+}
+
+// interfacePrefixes returns the interface with the given name and its IPv4
+// networks.
+func interfacePrefixes(name string) (iface *net.Interface, prefixes []netip.Prefix, err error) {
+	iface, err = net.InterfaceByName(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting addresses: %w", err)
+	}
+
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok || !ip.Unmap().Is4() || ip.IsLoopback() {
+			continue
+		}
+
+		ones, _ := ipNet.Mask.Size()
+		prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ones))
+	}
+
+	return iface, prefixes, nil
+}
+
+// maxNameLen is the maximum length of the name of a device.
+const maxNameLen = 255
+
+// normalizeName returns the name of a device suitable for a runtime client or
+// an empty string if name is not suitable.
+func normalizeName(name string) (norm string) {
+	norm = strings.TrimSpace(strings.Map(func(r rune) (res rune) {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+
+		return r
+	}, name))
+
+	if len(norm) > maxNameLen {
+		return ""
+	}
+
+	return norm
+}
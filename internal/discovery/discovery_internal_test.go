@@ -0,0 +1,246 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newNetBIOSStatusResponse returns a NetBIOS node status response with the
+// given names.  Each name is padded with spaces and suffixed with the given
+// suffix byte.
+func newNetBIOSStatusResponse(tb testing.TB, names []string, suffixes []byte, groups []bool) (b []byte) {
+	tb.Helper()
+
+	require.Len(tb, suffixes, len(names))
+	require.Len(tb, groups, len(names))
+
+	b = append(b, netbiosStatusRequest[:netbiosHeaderLen+1+netbiosEncodedLen+1]...)
+	b[2] |= 0x80
+	b = binary.BigEndian.AppendUint16(b, netbiosTypeNBSTAT)
+	b = binary.BigEndian.AppendUint16(b, netbiosClassIN)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = binary.BigEndian.AppendUint16(b, uint16(1+len(names)*netbiosEntryLen))
+	b = append(b, byte(len(names)))
+
+	for i, n := range names {
+		padded := n + strings.Repeat(" ", netbiosNameLen-1-len(n))
+		b = append(b, padded...)
+		b = append(b, suffixes[i])
+
+		var flags uint16
+		if groups[i] {
+			flags = netbiosGroupFlag
+		}
+
+		b = binary.BigEndian.AppendUint16(b, flags)
+	}
+
+	return b
+}
+
+func TestNewNetBIOSStatusRequest(t *testing.T) {
+	req := newNetBIOSStatusRequest()
+	require.Len(t, req, netbiosHeaderLen+1+netbiosEncodedLen+1+4)
+
+	assert.Equal(t, byte(netbiosEncodedLen), req[netbiosHeaderLen])
+
+	encoded := string(req[netbiosHeaderLen+1 : netbiosHeaderLen+1+netbiosEncodedLen])
+	assert.Equal(t, "CK"+strings.Repeat("AA", netbiosNameLen-1), encoded)
+}
+
+func TestParseNetBIOSStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		want     string
+		names    []string
+		suffixes []byte
+		groups   []bool
+	}{{
+		name:     "workstation",
+		want:     "desktop",
+		names:    []string{"DESKTOP"},
+		suffixes: []byte{netbiosWorkstation},
+		groups:   []bool{false},
+	}, {
+		name:     "skip_group_and_service",
+		want:     "nas",
+		names:    []string{"WORKGROUP", "NAS", "NAS"},
+		suffixes: []byte{netbiosWorkstation, 0x20, netbiosWorkstation},
+		groups:   []bool{true, false, false},
+	}, {
+		name:     "none",
+		want:     "",
+		names:    []string{"WORKGROUP"},
+		suffixes: []byte{netbiosWorkstation},
+		groups:   []bool{true},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newNetBIOSStatusResponse(t, tc.names, tc.suffixes, tc.groups)
+			assert.Equal(t, tc.want, parseNetBIOSStatus(b))
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		b := newNetBIOSStatusResponse(t, []string{"DESKTOP"}, []byte{0}, []bool{false})
+		assert.Empty(t, parseNetBIOSStatus(b[:len(b)-netbiosEntryLen]))
+		assert.Empty(t, parseNetBIOSStatus(b[:netbiosHeaderLen]))
+	})
+
+	t.Run("request", func(t *testing.T) {
+		assert.Empty(t, parseNetBIOSStatus(netbiosStatusRequest))
+	})
+}
+
+func TestMDNSHostName(t *testing.T) {
+	from := netip.MustParseAddr("192.168.1.2")
+
+	srv := &dns.SRV{
+		Hdr:    dns.RR_Header{Name: "printer._ipp._tcp.local.", Rrtype: dns.TypeSRV},
+		Target: "Printer.local.",
+	}
+	otherA := &dns.A{
+		Hdr: dns.RR_Header{Name: "other.local.", Rrtype: dns.TypeA},
+		A:   net.IP{192, 168, 1, 3},
+	}
+	fromA := &dns.A{
+		Hdr: dns.RR_Header{Name: "Laptop.local.", Rrtype: dns.TypeA},
+		A:   from.AsSlice(),
+	}
+
+	testCases := []struct {
+		name  string
+		want  string
+		extra []dns.RR
+	}{{
+		name:  "address",
+		want:  "laptop",
+		extra: []dns.RR{srv, otherA, fromA},
+	}, {
+		name:  "service",
+		want:  "printer",
+		extra: []dns.RR{otherA, srv},
+	}, {
+		name:  "none",
+		want:  "",
+		extra: []dns.RR{otherA},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &dns.Msg{
+				Extra: tc.extra,
+			}
+
+			assert.Equal(t, tc.want, mdnsHostName(resp, from))
+		})
+	}
+}
+
+func TestSSDPLocation(t *testing.T) {
+	from := netip.MustParseAddr("192.168.1.2")
+
+	newResp := func(status, loc string) (b []byte) {
+		return []byte("HTTP/1.1 " + status + "\r\n" +
+			"CACHE-CONTROL: max-age=1800\r\n" +
+			"LOCATION: " + loc + "\r\n" +
+			"ST: upnp:rootdevice\r\n" +
+			"\r\n")
+	}
+
+	testCases := []struct {
+		name string
+		want string
+		resp []byte
+	}{{
+		name: "valid",
+		want: "http://192.168.1.2:8080/desc.xml",
+		resp: newResp("200 OK", "http://192.168.1.2:8080/desc.xml"),
+	}, {
+		name: "other_host",
+		want: "",
+		resp: newResp("200 OK", "http://192.168.1.3:8080/desc.xml"),
+	}, {
+		name: "domain_host",
+		want: "",
+		resp: newResp("200 OK", "http://example.com/desc.xml"),
+	}, {
+		name: "bad_scheme",
+		want: "",
+		resp: newResp("200 OK", "file:///etc/passwd"),
+	}, {
+		name: "bad_status",
+		want: "",
+		resp: newResp("404 Not Found", "http://192.168.1.2:8080/desc.xml"),
+	}, {
+		name: "malformed",
+		want: "",
+		resp: []byte("NOTIFY * HTTP/1.1\r\n"),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := ssdpLocation(tc.resp, from)
+			if tc.want == "" {
+				assert.Nil(t, loc)
+
+				return
+			}
+
+			require.NotNil(t, loc)
+
+			assert.Equal(t, tc.want, loc.String())
+		})
+	}
+}
+
+func TestParseSSDPDescription(t *testing.T) {
+	const desc = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <friendlyName> Living Room TV </friendlyName>
+  </device>
+</root>`
+
+	name, err := parseSSDPDescription(strings.NewReader(desc))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Living Room TV", name)
+
+	_, err = parseSSDPDescription(strings.NewReader("not xml"))
+	assert.Error(t, err)
+}
+
+func TestNormalizeName(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   string
+		want string
+	}{{
+		name: "simple",
+		in:   "host",
+		want: "host",
+	}, {
+		name: "control",
+		in:   " ho\x00st\n",
+		want: "host",
+	}, {
+		name: "too_long",
+		in:   strings.Repeat("a", maxNameLen+1),
+		want: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, normalizeName(tc.in))
+		})
+	}
+}
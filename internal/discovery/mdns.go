@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// mdnsGroup is the multicast group of multicast DNS.  See RFC 6762.
+var mdnsGroup = netip.MustParseAddrPort("224.0.0.251:5353")
+
+// mdnsServicesName is the name for enumerating the DNS-SD services.  See
+// RFC 6763, section 9.
+const mdnsServicesName = "_services._dns-sd._udp.local."
+
+// probeMDNS discovers the devices in pref of iface, which respond to the
+// multicast DNS enumeration of the services.  The query is sent from an
+// ephemeral port, so that the responders answer with unicast.
+func (p *Prober) probeMDNS(
+	ctx context.Context,
+	iface *net.Interface,
+	pref netip.Prefix,
+) (ds []Device, err error) {
+	req := (&dns.Msg{}).SetQuestion(mdnsServicesName, dns.TypePTR)
+	packed, err := req.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing request: %w", err)
+	}
+
+	conn, err := listenUDP(ctx, iface, pref.Addr())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	_, err = conn.WriteToUDPAddrPort(packed, mdnsGroup)
+	if err != nil {
+		return nil, fmt.Errorf("writing request: %w", err)
+	}
+
+	seen := map[netip.Addr]struct{}{}
+	err = readAll(conn, pref, func(b []byte, from netip.Addr) {
+		if _, ok := seen[from]; ok {
+			return
+		}
+
+		resp := &dns.Msg{}
+		if resp.Unpack(b) != nil || !resp.Response {
+			return
+		}
+
+		if name := mdnsHostName(resp, from); name != "" {
+			seen[from] = struct{}{}
+			ds = append(ds, Device{
+				IP:       from,
+				Name:     name,
+				Protocol: ProtocolMDNS,
+			})
+		}
+	})
+
+	return ds, err
+}
+
+// mdnsHostName returns the host name of the responder at from from resp.  It
+// is the name of an address record for from or, if there are none, the target
+// of a service record.  name is empty if there are no such records.
+func mdnsHostName(resp *dns.Msg, from netip.Addr) (name string) {
+	var target string
+	for _, rr := range append(resp.Answer, resp.Extra...) {
+		switch rr := rr.(type) {
+		case *dns.A:
+			if ip, ok := netip.AddrFromSlice(rr.A); ok && ip.Unmap() == from {
+				return trimLocal(rr.Hdr.Name)
+			}
+		case *dns.SRV:
+			if target == "" {
+				target = rr.Target
+			}
+		}
+	}
+
+	return trimLocal(target)
+}
+
+// trimLocal returns the normalized name without the "local." domain.
+func trimLocal(fqdn string) (name string) {
+	name = strings.TrimSuffix(strings.ToLower(fqdn), ".")
+	name = strings.TrimSuffix(name, ".local")
+
+	return normalizeName(name)
+}
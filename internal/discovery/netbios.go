@@ -0,0 +1,143 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// netbiosPort is the port of the NetBIOS name service.  See RFC 1002.
+const netbiosPort = 137
+
+// netbiosMinPrefixBits is the minimum length of the prefix of the networks, in
+// which the hosts are probed with the NetBIOS node status requests, since each
+// address is probed.
+const netbiosMinPrefixBits = 22
+
+// NetBIOS name service constants.  See RFC 1002, section 4.2.
+const (
+	netbiosTypeNBSTAT  = 0x0021
+	netbiosClassIN     = 0x0001
+	netbiosNameLen     = 16
+	netbiosEncodedLen  = 2 * netbiosNameLen
+	netbiosHeaderLen   = 12
+	netbiosEntryLen    = netbiosNameLen + 2
+	netbiosGroupFlag   = 0x8000
+	netbiosWorkstation = 0x00
+)
+
+// netbiosStatusRequest is the NetBIOS node status request for the wildcard
+// name "*".
+var netbiosStatusRequest = newNetBIOSStatusRequest()
+
+// newNetBIOSStatusRequest returns a new NetBIOS node status request for the
+// wildcard name.
+func newNetBIOSStatusRequest() (req []byte) {
+	req = make([]byte, 0, netbiosHeaderLen+netbiosEncodedLen+6)
+
+	// Transaction ID, flags, one question, no other records.
+	req = append(req, 0x41, 0x47, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0)
+
+	name := make([]byte, netbiosNameLen)
+	name[0] = '*'
+
+	req = append(req, netbiosEncodedLen)
+	for _, c := range name {
+		req = append(req, 'A'+c>>4, 'A'+c&0x0f)
+	}
+
+	req = append(req, 0)
+	req = binary.BigEndian.AppendUint16(req, netbiosTypeNBSTAT)
+	req = binary.BigEndian.AppendUint16(req, netbiosClassIN)
+
+	return req
+}
+
+// probeNetBIOS discovers the devices in pref, which respond to the NetBIOS
+// node status request sent to each address of pref.  Networks larger than
+// [netbiosMinPrefixBits] aren't probed.
+func (p *Prober) probeNetBIOS(
+	ctx context.Context,
+	iface *net.Interface,
+	pref netip.Prefix,
+) (ds []Device, err error) {
+	if pref.Bits() < netbiosMinPrefixBits {
+		return nil, fmt.Errorf("network %s is too large", pref)
+	}
+
+	conn, err := listenUDP(ctx, iface, pref.Addr())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	// Skip the network and the broadcast addresses.
+	local := pref.Addr()
+	for ip := pref.Masked().Addr().Next(); pref.Contains(ip.Next()); ip = ip.Next() {
+		if ip == local {
+			continue
+		}
+
+		_, err = conn.WriteToUDPAddrPort(netbiosStatusRequest, netip.AddrPortFrom(ip, netbiosPort))
+		if err != nil {
+			return nil, fmt.Errorf("writing request to %s: %w", ip, err)
+		}
+	}
+
+	seen := map[netip.Addr]struct{}{}
+	err = readAll(conn, pref, func(b []byte, from netip.Addr) {
+		if _, ok := seen[from]; ok {
+			return
+		}
+
+		if name := parseNetBIOSStatus(b); name != "" {
+			seen[from] = struct{}{}
+			ds = append(ds, Device{
+				IP:       from,
+				Name:     name,
+				Protocol: ProtocolNetBIOS,
+			})
+		}
+	})
+
+	return ds, err
+}
+
+// parseNetBIOSStatus returns the unique workstation name from the NetBIOS node
+// status response b.  name is empty if there is none or b is malformed.
+func parseNetBIOSStatus(b []byte) (name string) {
+	// Header, encoded name, type, class, TTL, data length, and number of names.
+	const namesOffset = netbiosHeaderLen + 1 + netbiosEncodedLen + 1 + 2 + 2 + 4 + 2 + 1
+
+	if len(b) < namesOffset || b[2]&0x80 == 0 || b[netbiosHeaderLen] != netbiosEncodedLen {
+		return ""
+	}
+
+	typOffset := netbiosHeaderLen + 1 + netbiosEncodedLen + 1
+	if binary.BigEndian.Uint16(b[typOffset:]) != netbiosTypeNBSTAT {
+		return ""
+	}
+
+	num := int(b[namesOffset-1])
+	entries := b[namesOffset:]
+	for i := 0; i < num && len(entries) >= netbiosEntryLen; i++ {
+		e := entries[:netbiosEntryLen]
+		entries = entries[netbiosEntryLen:]
+
+		flags := binary.BigEndian.Uint16(e[netbiosNameLen:])
+		if e[netbiosNameLen-1] != netbiosWorkstation || flags&netbiosGroupFlag != 0 {
+			continue
+		}
+
+		if name = normalizeName(string(e[:netbiosNameLen-1])); name != "" {
+			return strings.ToLower(name)
+		}
+	}
+
+	return ""
+}
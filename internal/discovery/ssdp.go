@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/ioutil"
+)
+
+// ssdpGroup is the multicast group of SSDP.
+var ssdpGroup = netip.MustParseAddrPort("239.255.255.250:1900")
+
+// ssdpSearchRequest is the SSDP search request for all devices and services.
+var ssdpSearchRequest = []byte("M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 1\r\n" +
+	"ST: ssdp:all\r\n" +
+	"\r\n")
+
+// maxDescriptionSize is the maximum size of the description of an SSDP device.
+const maxDescriptionSize = 64 * 1024
+
+// probeSSDP discovers the devices in pref of iface, which respond to the SSDP
+// search request and have a friendly name in their descriptions.
+func (p *Prober) probeSSDP(
+	ctx context.Context,
+	iface *net.Interface,
+	pref netip.Prefix,
+) (ds []Device, err error) {
+	conn, err := listenUDP(ctx, iface, pref.Addr())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	_, err = conn.WriteToUDPAddrPort(ssdpSearchRequest, ssdpGroup)
+	if err != nil {
+		return nil, fmt.Errorf("writing request: %w", err)
+	}
+
+	locations := map[netip.Addr]*url.URL{}
+	var addrs []netip.Addr
+	err = readAll(conn, pref, func(b []byte, from netip.Addr) {
+		if _, ok := locations[from]; ok {
+			return
+		}
+
+		if loc := ssdpLocation(b, from); loc != nil {
+			locations[from] = loc
+			addrs = append(addrs, from)
+		}
+	})
+
+	// The search context is done by now, so fetch the descriptions within the
+	// timeout of the HTTP client.
+	fetchCtx := context.WithoutCancel(ctx)
+	for _, addr := range addrs {
+		name, fetchErr := p.ssdpFriendlyName(fetchCtx, locations[addr])
+		if fetchErr != nil {
+			err = errors.Join(err, fmt.Errorf("fetching description of %s: %w", addr, fetchErr))
+
+			continue
+		}
+
+		if name != "" {
+			ds = append(ds, Device{
+				IP:       addr,
+				Name:     name,
+				Protocol: ProtocolSSDP,
+			})
+		}
+	}
+
+	return ds, err
+}
+
+// ssdpLocation returns the URL of the description from the SSDP search
+// response b.  loc is nil if b is malformed or if the URL isn't an HTTP URL on
+// the address of the responder.
+func ssdpLocation(b []byte, from netip.Addr) (loc *url.URL) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), nil)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	loc, err = url.Parse(resp.Header.Get(httphdr.Location))
+	if err != nil || loc.Scheme != "http" {
+		return nil
+	}
+
+	// Don't let the responders make the requests on their behalf.
+	if host, hostErr := netip.ParseAddr(loc.Hostname()); hostErr != nil || host != from {
+		return nil
+	}
+
+	return loc
+}
+
+// ssdpDescription is the part of the description of an SSDP device.
+type ssdpDescription struct {
+	Device struct {
+		FriendlyName string `xml:"friendlyName"`
+	} `xml:"device"`
+}
+
+// ssdpFriendlyName fetches the description from loc and returns the friendly
+// name of the device.
+func (p *Prober) ssdpFriendlyName(ctx context.Context, loc *url.URL) (name string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loc.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	return parseSSDPDescription(ioutil.LimitReader(resp.Body, maxDescriptionSize))
+}
+
+// parseSSDPDescription returns the normalized friendly name from the SSDP
+// device description read from r.
+func parseSSDPDescription(r io.Reader) (name string, err error) {
+	desc := &ssdpDescription{}
+	err = xml.NewDecoder(r).Decode(desc)
+	if err != nil {
+		return "", fmt.Errorf("decoding description: %w", err)
+	}
+
+	return normalizeName(desc.Device.FriendlyName), nil
+}
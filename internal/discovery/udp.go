@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/net/ipv4"
+)
+
+// maxUDPSize is the maximum size of the received UDP datagrams.
+const maxUDPSize = 9000
+
+// listenUDP returns a UDP connection on an ephemeral port of the local address
+// of iface, which sends the multicast datagrams through iface.  The deadline of
+// the connection is set from ctx.
+func listenUDP(ctx context.Context, iface *net.Interface, local netip.Addr) (conn *net.UDPConn, err error) {
+	conn, err = net.ListenUDP("udp4", net.UDPAddrFromAddrPort(netip.AddrPortFrom(local, 0)))
+	if err != nil {
+		return nil, fmt.Errorf("listening: %w", err)
+	}
+
+	err = ipv4.NewPacketConn(conn).SetMulticastInterface(iface)
+	if err != nil {
+		return nil, errors.WithDeferred(fmt.Errorf("setting multicast interface: %w", err), conn.Close())
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Second)
+	}
+
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return nil, errors.WithDeferred(fmt.Errorf("setting deadline: %w", err), conn.Close())
+	}
+
+	return conn, nil
+}
+
+// readAll calls handle for each datagram received by conn from the addresses
+// within pref until the deadline of conn.
+func readAll(conn *net.UDPConn, pref netip.Prefix, handle func(b []byte, from netip.Addr)) (err error) {
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, from, readErr := conn.ReadFromUDPAddrPort(buf)
+		if errors.Is(readErr, os.ErrDeadlineExceeded) {
+			return nil
+		} else if readErr != nil {
+			return fmt.Errorf("reading: %w", readErr)
+		}
+
+		addr := from.Addr().Unmap()
+		if pref.Contains(addr) {
+			handle(buf[:n], addr)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package dnsforward
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/container"
+)
+
+// maxLearnedDomains is the maximum number of the domain names learned in a
+// single allowlist learning session.
+const maxLearnedDomains = 10_000
+
+// AllowlistLearning is a session of learning the domain names resolved by a
+// persistent client, which are the candidates for its allowlist.
+type AllowlistLearning struct {
+	// Until is the time when the learning ends.
+	Until time.Time `json:"until"`
+
+	// Client is the name of the persistent client.
+	Client string `json:"client"`
+
+	// Domains are the sorted learned domain names.
+	Domains []string `json:"domains"`
+
+	// Active is true if the domain names are still being learned.
+	Active bool `json:"active"`
+}
+
+// learningSession is the state of an allowlist learning session.
+type learningSession struct {
+	// until is the time when the learning ends.
+	until time.Time
+
+	// domains are the learned domain names.
+	domains *container.MapSet[string]
+}
+
+// allowlistLearning contains the allowlist learning sessions.  The sessions
+// aren't persisted, so they're reset on restart.
+type allowlistLearning struct {
+	// mu protects sessions.
+	mu *sync.Mutex
+
+	// sessions maps the names of the persistent clients to their sessions.
+	sessions map[string]*learningSession
+}
+
+// newAllowlistLearning returns a new properly initialized *allowlistLearning.
+func newAllowlistLearning() (l *allowlistLearning) {
+	return &allowlistLearning{
+		mu:       &sync.Mutex{},
+		sessions: map[string]*learningSession{},
+	}
+}
+
+// start starts a new session for client until the given time, discarding the
+// previous one, if any.
+func (l *allowlistLearning) start(client string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sessions[client] = &learningSession{
+		until:   until,
+		domains: container.NewMapSet[string](),
+	}
+}
+
+// stop ends the session for client at now keeping the learned domain names.
+// ok is false if there is no active session for client.
+func (l *allowlistLearning) stop(client string, now time.Time) (ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sess := l.sessions[client]
+	if sess == nil || !now.Before(sess.until) {
+		return false
+	}
+
+	sess.until = now
+
+	return true
+}
+
+// remove removes the session for client.
+func (l *allowlistLearning) remove(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.sessions, client)
+}
+
+// record adds domain to the active session for client, if any.
+func (l *allowlistLearning) record(client, domain string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sess := l.sessions[client]
+	if sess == nil || !now.Before(sess.until) || sess.domains.Len() >= maxLearnedDomains {
+		return
+	}
+
+	sess.domains.Add(domain)
+}
+
+// get returns the session for client at now.  s is nil if there is none.
+func (l *allowlistLearning) get(client string, now time.Time) (s *AllowlistLearning) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sess := l.sessions[client]
+	if sess == nil {
+		return nil
+	}
+
+	return sess.toExported(client, now)
+}
+
+// list returns all sessions at now sorted by the names of the clients.
+func (l *allowlistLearning) list(now time.Time) (sessions []*AllowlistLearning) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sessions = make([]*AllowlistLearning, 0, len(l.sessions))
+	for client, sess := range l.sessions {
+		sessions = append(sessions, sess.toExported(client, now))
+	}
+
+	slices.SortFunc(sessions, func(a, b *AllowlistLearning) (res int) {
+		return cmp.Compare(a.Client, b.Client)
+	})
+
+	return sessions
+}
+
+// toExported returns the exported version of sess for client at now.
+func (sess *learningSession) toExported(client string, now time.Time) (s *AllowlistLearning) {
+	domains := sess.domains.Values()
+	slices.Sort(domains)
+
+	return &AllowlistLearning{
+		Until:   sess.until,
+		Client:  client,
+		Domains: domains,
+		Active:  now.Before(sess.until),
+	}
+}
+
+// AllowlistLearning returns the allowlist learning session for the persistent
+// client with the given name.  s is nil if there is none.
+func (s *Server) AllowlistLearning(client string) (sess *AllowlistLearning) {
+	return s.allowlistLearning.get(client, time.Now())
+}
+
+// RemoveAllowlistLearning removes the allowlist learning session for the
+// persistent client with the given name, if any.
+func (s *Server) RemoveAllowlistLearning(client string) {
+	s.allowlistLearning.remove(client)
+}
+
+// processAllowlistLearning records the requested domain name for the
+// persistent client, for which an allowlist learning session is active.
+func (s *Server) processAllowlistLearning(_ context.Context, dctx *dnsContext) (rc resultCode) {
+	if dctx.setts == nil || dctx.setts.ClientName == "" {
+		return resultCodeSuccess
+	}
+
+	host := aghnet.NormalizeDomain(dctx.proxyCtx.Req.Question[0].Name)
+	if host != "" {
+		s.allowlistLearning.record(dctx.setts.ClientName, host, time.Now())
+	}
+
+	return resultCodeSuccess
+}
+
+// allowlistLearningListJSON is the response of the GET
+// /control/clients/learning HTTP API.
+type allowlistLearningListJSON struct {
+	// Sessions are the allowlist learning sessions sorted by the names of the
+	// clients.
+	Sessions []*AllowlistLearning `json:"sessions"`
+}
+
+// handleAllowlistLearningList is the handler for the GET
+// /control/clients/learning HTTP API.
+func (s *Server) handleAllowlistLearningList(w http.ResponseWriter, r *http.Request) {
+	aghhttp.WriteJSONResponseOK(r.Context(), s.logger, w, r, &allowlistLearningListJSON{
+		Sessions: s.allowlistLearning.list(time.Now()),
+	})
+}
+
+// handleAllowlistLearningStart is the handler for the POST
+// /control/clients/learning/start HTTP API.
+func (s *Server) handleAllowlistLearningStart(w http.ResponseWriter, r *http.Request) {
+	req := s.decodeClientPause(w, r, true)
+	if req == nil {
+		return
+	}
+
+	ctx := r.Context()
+	until := time.Now().Add(time.Duration(req.Duration) * time.Millisecond)
+	s.allowlistLearning.start(req.Client, until)
+
+	s.logger.InfoContext(ctx, "allowlist learning started", "client", req.Client, "until", until)
+
+	aghhttp.OK(ctx, s.logger, w)
+}
+
+// handleAllowlistLearningStop is the handler for the POST
+// /control/clients/learning/stop HTTP API.
+func (s *Server) handleAllowlistLearningStop(w http.ResponseWriter, r *http.Request) {
+	req := s.decodeClientPause(w, r, false)
+	if req == nil {
+		return
+	}
+
+	ctx := r.Context()
+	if !s.allowlistLearning.stop(req.Client, time.Now()) {
+		aghhttp.ErrorAndLog(
+			ctx,
+			s.logger,
+			r,
+			w,
+			http.StatusNotFound,
+			"allowlist learning isn't active for client %q",
+			req.Client,
+		)
+
+		return
+	}
+
+	s.logger.InfoContext(ctx, "allowlist learning stopped", "client", req.Client)
+
+	aghhttp.OK(ctx, s.logger, w)
+}
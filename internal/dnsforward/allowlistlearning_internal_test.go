@@ -0,0 +1,63 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_processAllowlistLearning(t *testing.T) {
+	s := &Server{
+		logger:            testLogger,
+		allowlistLearning: newAllowlistLearning(),
+	}
+
+	s.allowlistLearning.start("iot", time.Now().Add(time.Hour))
+
+	process := func(client, name string) {
+		dctx := &dnsContext{
+			proxyCtx: &proxy.DNSContext{
+				Req: (&dns.Msg{}).SetQuestion(name, dns.TypeA),
+			},
+			setts: &filtering.Settings{ClientName: client},
+		}
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		rc := s.processAllowlistLearning(ctx, dctx)
+		require.Equal(t, resultCodeSuccess, rc)
+	}
+
+	process("iot", "Time.Example.")
+	process("iot", "cloud.example.")
+	process("iot", "time.example.")
+	process("other", "other.example.")
+	process("", "anonymous.example.")
+
+	sess := s.AllowlistLearning("iot")
+	require.NotNil(t, sess)
+
+	assert.True(t, sess.Active)
+	assert.Equal(t, []string{"cloud.example", "time.example"}, sess.Domains)
+	assert.Nil(t, s.AllowlistLearning("other"))
+
+	now := time.Now()
+	require.True(t, s.allowlistLearning.stop("iot", now))
+	assert.False(t, s.allowlistLearning.stop("iot", now))
+
+	process("iot", "late.example.")
+
+	sess = s.AllowlistLearning("iot")
+	require.NotNil(t, sess)
+
+	assert.False(t, sess.Active)
+	assert.Equal(t, []string{"cloud.example", "time.example"}, sess.Domains)
+
+	s.RemoveAllowlistLearning("iot")
+	assert.Empty(t, s.allowlistLearning.list(now))
+}
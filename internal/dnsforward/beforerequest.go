@@ -34,7 +34,7 @@ func (s *Server) HandleBefore(
 	}
 
 	blocked, _ := s.IsBlockedClient(pctx.Addr.Addr(), clientID)
-	if blocked {
+	if blocked || !s.listeners.isAllowed(pctx.Proto, pctx.Addr.Addr()) {
 		return s.preBlockedResponse(pctx)
 	}
 
@@ -55,6 +55,12 @@ func (s *Server) HandleBefore(
 		}
 	}
 
+	err = s.checkCookie(pctx)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
 	if clientID != "" {
 		key := [8]byte{}
 		binary.BigEndian.PutUint64(key[:], pctx.RequestID)
@@ -73,7 +79,7 @@ func (s *Server) clientIDFromDNSContext(
 ) (clientID string, err error) {
 	proto := pctx.Proto
 	if proto == proxy.ProtoHTTPS {
-		clientID, err = clientIDFromDNSContextHTTPS(pctx)
+		clientID, err = clientIDFromDNSContextHTTPS(pctx, s.conf.DoHPaths)
 		if err != nil {
 			return "", fmt.Errorf("checking url: %w", err)
 		} else if clientID != "" {
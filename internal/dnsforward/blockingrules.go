@@ -0,0 +1,234 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// BlockingModeNODATA is the blocking mode, in which an empty response with the
+// SOA record is returned.  It's only supported by [BlockingRule].
+const BlockingModeNODATA filtering.BlockingMode = "nodata"
+
+// BlockingRule overrides the blocking mode for the requests of particular types
+// from particular clients.  The rules only apply to the requests blocked by the
+// filtering rules, and not to the ones blocked by Safe Browsing or Parental
+// Control.
+type BlockingRule struct {
+	// QTypes are the types of the requests, to which the rule applies, for
+	// example "A" or "HTTPS".  If empty, the rule applies to all types.
+	QTypes []string `yaml:"qtypes"`
+
+	// ClientTags are the tags of the persistent clients, to which the rule
+	// applies.  If empty, the rule applies to all clients from
+	// [BlockingRule.Subnets].
+	ClientTags []string `yaml:"client_tags"`
+
+	// Subnets are the subnets of the clients, to which the rule applies.  If
+	// empty, the rule applies to all clients with [BlockingRule.ClientTags].
+	Subnets []netutil.Prefix `yaml:"subnets"`
+
+	// Mode is the blocking mode.  In addition to the modes of
+	// [filtering.BlockingMode], [BlockingModeNODATA] is supported.
+	Mode filtering.BlockingMode `yaml:"mode"`
+
+	// IPv4 is the address returned for the A requests in the custom_ip mode.
+	// If not set, the response to such requests is empty.
+	IPv4 netip.Addr `yaml:"ipv4"`
+
+	// IPv6 is the address returned for the AAAA requests in the custom_ip
+	// mode.  If not set, the response to such requests is empty.
+	IPv6 netip.Addr `yaml:"ipv6"`
+}
+
+// blockingRule is the compiled version of [BlockingRule].
+type blockingRule struct {
+	// qtypes are the types of the requests.  If empty, the rule applies to all
+	// types.
+	qtypes []uint16
+
+	// tags are the tags of the clients.
+	tags []string
+
+	// subnets are the subnets of the clients.
+	subnets []netip.Prefix
+
+	// mode is the blocking mode.
+	mode filtering.BlockingMode
+
+	// ipv4 is the custom IPv4 address.
+	ipv4 netip.Addr
+
+	// ipv6 is the custom IPv6 address.
+	ipv6 netip.Addr
+}
+
+// newBlockingRules validates conf and returns the compiled rules.
+func newBlockingRules(conf []*BlockingRule) (rules []*blockingRule, err error) {
+	for i, c := range conf {
+		var r *blockingRule
+		r, err = newBlockingRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("blocking rule at index %d: %w", i, err)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// newBlockingRule validates c and returns the compiled rule.
+func newBlockingRule(c *BlockingRule) (r *blockingRule, err error) {
+	if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	switch c.Mode {
+	case
+		filtering.BlockingModeDefault,
+		filtering.BlockingModeNullIP,
+		filtering.BlockingModeNXDOMAIN,
+		filtering.BlockingModeREFUSED,
+		BlockingModeNODATA:
+		// Go on.
+	case filtering.BlockingModeCustomIP:
+		switch {
+		case !c.IPv4.IsValid() && !c.IPv6.IsValid():
+			return nil, fmt.Errorf("ipv4 and ipv6: %w", errors.ErrNoValue)
+		case c.IPv4.IsValid() && !c.IPv4.Is4():
+			return nil, fmt.Errorf("ipv4: not an ipv4 address: %s", c.IPv4)
+		case c.IPv6.IsValid() && !c.IPv6.Is6():
+			return nil, fmt.Errorf("ipv6: not an ipv6 address: %s", c.IPv6)
+		}
+	default:
+		return nil, fmt.Errorf("mode: %w: %q", errors.ErrBadEnumValue, c.Mode)
+	}
+
+	r = &blockingRule{
+		tags:    slices.Clone(c.ClientTags),
+		subnets: make([]netip.Prefix, 0, len(c.Subnets)),
+		mode:    c.Mode,
+		ipv4:    c.IPv4,
+		ipv6:    c.IPv6,
+	}
+
+	for i, qt := range c.QTypes {
+		t, ok := dns.StringToType[strings.ToUpper(qt)]
+		if !ok {
+			return nil, fmt.Errorf("qtypes: at index %d: %w: %q", i, errors.ErrBadEnumValue, qt)
+		}
+
+		r.qtypes = append(r.qtypes, t)
+	}
+
+	for _, p := range c.Subnets {
+		r.subnets = append(r.subnets, p.Prefix)
+	}
+
+	return r, nil
+}
+
+// matches returns true if r applies to the request of type qt from the client
+// with the address addr and the filtering settings setts.
+func (r *blockingRule) matches(qt uint16, addr netip.Addr, setts *filtering.Settings) (ok bool) {
+	if len(r.qtypes) > 0 && !slices.Contains(r.qtypes, qt) {
+		return false
+	}
+
+	return clientMatches(r.tags, r.subnets, addr, setts)
+}
+
+// clientMatches returns true if the client with the address addr and the
+// filtering settings setts has any of tags and belongs to any of subnets.
+// Empty tags and subnets match any client.
+func clientMatches(
+	tags []string,
+	subnets []netip.Prefix,
+	addr netip.Addr,
+	setts *filtering.Settings,
+) (ok bool) {
+	if len(tags) > 0 {
+		if setts == nil || !slices.ContainsFunc(setts.ClientTags, func(tag string) (has bool) {
+			return slices.Contains(tags, tag)
+		}) {
+			return false
+		}
+	}
+
+	if len(subnets) > 0 {
+		addr = addr.Unmap()
+		if !slices.ContainsFunc(subnets, func(p netip.Prefix) (has bool) {
+			return p.Contains(addr)
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// blockingRuleFor returns the first blocking rule applying to the request of
+// type qt from the client or nil if there is none.
+func (s *Server) blockingRuleFor(
+	qt uint16,
+	addr netip.Addr,
+	setts *filtering.Settings,
+) (r *blockingRule) {
+	for _, r = range s.blockingRules {
+		if r.matches(qt, addr, setts) {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// genForBlockingRule generates a filtered response to req based on r.  ips are
+// the addresses from the filtering rules, if any.
+func (s *Server) genForBlockingRule(
+	ctx context.Context,
+	req *dns.Msg,
+	r *blockingRule,
+	ips []netip.Addr,
+) (resp *dns.Msg) {
+	switch r.mode {
+	case BlockingModeNODATA:
+		return s.NewMsgNODATA(req)
+	case filtering.BlockingModeNXDOMAIN:
+		return s.NewMsgNXDOMAIN(req)
+	case filtering.BlockingModeREFUSED:
+		return s.makeResponseREFUSED(req)
+	}
+
+	qt := req.Question[0].Qtype
+	if qt != dns.TypeA && qt != dns.TypeAAAA {
+		return s.NewMsgNODATA(req)
+	}
+
+	switch r.mode {
+	case filtering.BlockingModeCustomIP:
+		if qt == dns.TypeA && r.ipv4.IsValid() {
+			return s.genARecord(req, r.ipv4)
+		} else if qt == dns.TypeAAAA && r.ipv6.IsValid() {
+			return s.genAAAARecord(req, r.ipv6)
+		}
+
+		return s.NewMsgNODATA(req)
+	case filtering.BlockingModeDefault:
+		if len(ips) > 0 {
+			return s.genResponseWithIPs(ctx, req, ips)
+		}
+
+		return s.makeResponseNullIP(ctx, req)
+	default:
+		return s.makeResponseNullIP(ctx, req)
+	}
+}
@@ -0,0 +1,163 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_GenDNSFilterMessage_blockingRules(t *testing.T) {
+	portalIPv4 := netip.MustParseAddr("192.168.0.1")
+
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeNXDOMAIN,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamDNS:      []string{"8.8.8.8:53"},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ClientsContainer: EmptyClientsContainer{},
+			BlockingRules: []*BlockingRule{{
+				QTypes:     []string{"https", "svcb"},
+				ClientTags: []string{"device_phone"},
+				Mode:       BlockingModeNODATA,
+			}, {
+				QTypes:  []string{"A", "AAAA"},
+				Subnets: []netutil.Prefix{{Prefix: netip.MustParsePrefix("192.168.0.0/24")}},
+				Mode:    filtering.BlockingModeCustomIP,
+				IPv4:    portalIPv4,
+			}},
+		},
+		ServePlainDNS: true,
+	})
+
+	local := netip.MustParseAddrPort("192.168.0.10:12345")
+	remote := netip.MustParseAddrPort("192.0.2.1:12345")
+	phone := &filtering.Settings{ClientTags: []string{"device_phone"}}
+
+	testCases := []struct {
+		setts     *filtering.Settings
+		wantAns   dns.RR
+		name      string
+		addr      netip.AddrPort
+		qtype     uint16
+		wantRcode int
+	}{{
+		setts:     phone,
+		wantAns:   nil,
+		name:      "nodata_https",
+		addr:      remote,
+		qtype:     dns.TypeHTTPS,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		setts:     &filtering.Settings{},
+		wantAns:   nil,
+		name:      "no_tag",
+		addr:      remote,
+		qtype:     dns.TypeHTTPS,
+		wantRcode: dns.RcodeNameError,
+	}, {
+		setts: &filtering.Settings{},
+		wantAns: &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "blocked.example.",
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    0,
+			},
+			A: portalIPv4.AsSlice(),
+		},
+		name:      "custom_a",
+		addr:      local,
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		setts:     &filtering.Settings{},
+		wantAns:   nil,
+		name:      "custom_no_aaaa",
+		addr:      local,
+		qtype:     dns.TypeAAAA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		setts:     &filtering.Settings{},
+		wantAns:   nil,
+		name:      "global",
+		addr:      remote,
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeNameError,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Req:  (&dns.Msg{}).SetQuestion("blocked.example.", tc.qtype),
+				Addr: tc.addr,
+			}
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			resp := s.genDNSFilterMessage(ctx, pctx, &filtering.Result{
+				Reason:     filtering.FilteredBlockList,
+				IsFiltered: true,
+			}, tc.setts)
+			require.NotNil(t, resp)
+
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+			if tc.wantAns == nil {
+				assert.Empty(t, resp.Answer)
+
+				return
+			}
+
+			require.Len(t, resp.Answer, 1)
+			assert.Equal(t, tc.wantAns.String(), resp.Answer[0].String())
+		})
+	}
+}
+
+func TestNewBlockingRules_errors(t *testing.T) {
+	testCases := []struct {
+		conf       *BlockingRule
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &BlockingRule{Mode: "bad"},
+		name:       "bad_mode",
+		wantErrMsg: `blocking rule at index 0: mode: bad enum value: "bad"`,
+	}, {
+		conf:       &BlockingRule{Mode: filtering.BlockingModeCustomIP},
+		name:       "no_ips",
+		wantErrMsg: "blocking rule at index 0: ipv4 and ipv6: no value",
+	}, {
+		conf: &BlockingRule{
+			Mode: filtering.BlockingModeCustomIP,
+			IPv4: netip.MustParseAddr("::1"),
+		},
+		name:       "bad_ipv4",
+		wantErrMsg: "blocking rule at index 0: ipv4: not an ipv4 address: ::1",
+	}, {
+		conf: &BlockingRule{
+			QTypes: []string{"BAD"},
+			Mode:   BlockingModeNODATA,
+		},
+		name:       "bad_qtype",
+		wantErrMsg: `blocking rule at index 0: qtypes: at index 0: bad enum value: "BAD"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newBlockingRules([]*BlockingRule{tc.conf})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
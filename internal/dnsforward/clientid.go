@@ -50,8 +50,12 @@ func clientIDFromClientServerName(
 }
 
 // clientIDFromDNSContextHTTPS extracts the ClientID from the path of the
-// client's DNS-over-HTTPS request.
-func clientIDFromDNSContextHTTPS(pctx *proxy.DNSContext) (clientID string, err error) {
+// client's DNS-over-HTTPS request.  dohPaths are the additional paths of the
+// DNS-over-HTTPS handler.
+func clientIDFromDNSContextHTTPS(
+	pctx *proxy.DNSContext,
+	dohPaths []string,
+) (clientID string, err error) {
 	r := pctx.HTTPRequest
 	if r == nil {
 		return "", fmt.Errorf(
@@ -66,13 +70,13 @@ func clientIDFromDNSContextHTTPS(pctx *proxy.DNSContext) (clientID string, err e
 		parts = parts[1:]
 	}
 
-	if len(parts) == 0 || parts[0] != "dns-query" {
+	if len(parts) == 0 || !isDoHPath(parts[0], dohPaths) {
 		return "", fmt.Errorf("clientid check: invalid path %q", origPath)
 	}
 
 	switch len(parts) {
 	case 1:
-		// Just /dns-query, no ClientID.
+		// Just /dns-query or another path, no ClientID.
 		return "", nil
 	case 2:
 		clientID = parts[1]
@@ -296,6 +296,18 @@ func TestClientIDFromDNSContextHTTPS(t *testing.T) {
 		cliSrvName:   "example.com",
 		wantClientID: "insensitive",
 		wantErrMsg:   ``,
+	}, {
+		name:         "custom_path",
+		path:         "/resolve",
+		cliSrvName:   "example.com",
+		wantClientID: "",
+		wantErrMsg:   "",
+	}, {
+		name:         "custom_path_clientid",
+		path:         "/resolve/cli",
+		cliSrvName:   "example.com",
+		wantClientID: "cli",
+		wantErrMsg:   "",
 	}, {
 		name:         "bad_url",
 		path:         "/foo",
@@ -340,7 +352,7 @@ func TestClientIDFromDNSContextHTTPS(t *testing.T) {
 				HTTPRequest: r,
 			}
 
-			clientID, err := clientIDFromDNSContextHTTPS(pctx)
+			clientID, err := clientIDFromDNSContextHTTPS(pctx, []string{"/resolve"})
 			assert.Equal(t, tc.wantClientID, clientID)
 
 			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
@@ -0,0 +1,236 @@
+package dnsforward
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// ClientPause is a temporary pause of the filtering for a client.
+type ClientPause struct {
+	// Until is the time when the filtering is resumed.
+	Until time.Time
+
+	// Client is the name of the persistent client, the ClientID, or the IP
+	// address of the client.
+	Client string
+}
+
+// clientPauses contains the temporary pauses of the filtering for clients.  The
+// pauses aren't persisted, so they're reset on restart.
+type clientPauses struct {
+	// mu protects until.
+	mu *sync.RWMutex
+
+	// until maps the client, see [ClientPause.Client], to the time when the
+	// filtering is resumed.
+	until map[string]time.Time
+}
+
+// newClientPauses returns a new properly initialized *clientPauses.
+func newClientPauses() (p *clientPauses) {
+	return &clientPauses{
+		mu:    &sync.RWMutex{},
+		until: map[string]time.Time{},
+	}
+}
+
+// pause pauses the filtering for client until the given time.
+func (p *clientPauses) pause(client string, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.until[client] = until
+}
+
+// resume resumes the filtering for client.  ok is false if the filtering
+// wasn't paused for client.
+func (p *clientPauses) resume(client string) (ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok = p.until[client]
+	delete(p.until, client)
+
+	return ok
+}
+
+// isPaused returns true if the filtering is paused at now for any of the
+// client identifiers.  Empty identifiers are ignored.
+func (p *clientPauses) isPaused(now time.Time, ids ...string) (ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.until) == 0 {
+		return false
+	}
+
+	for _, id := range ids {
+		if until, has := p.until[id]; has && id != "" && now.Before(until) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// list removes the pauses, which are expired at now, and returns the remaining
+// ones sorted by the time of the resumption.
+func (p *clientPauses) list(now time.Time) (pauses []*ClientPause) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pauses = make([]*ClientPause, 0, len(p.until))
+	for client, until := range p.until {
+		if !now.Before(until) {
+			delete(p.until, client)
+
+			continue
+		}
+
+		pauses = append(pauses, &ClientPause{
+			Until:  until,
+			Client: client,
+		})
+	}
+
+	slices.SortFunc(pauses, func(a, b *ClientPause) (res int) {
+		return cmp.Or(a.Until.Compare(b.Until), cmp.Compare(a.Client, b.Client))
+	})
+
+	return pauses
+}
+
+// PausedClients returns the clients, for which the filtering is temporarily
+// paused.
+func (s *Server) PausedClients() (pauses []*ClientPause) {
+	return s.clientPauses.list(time.Now())
+}
+
+// applyClientPause disables the protection in setts, if the filtering is
+// paused for the client with the given address, ClientID, and the name of the
+// persistent client from setts.  It returns true if it did.
+func (s *Server) applyClientPause(
+	setts *filtering.Settings,
+	addr netip.Addr,
+	clientID string,
+) (paused bool) {
+	var addrStr string
+	if addr.IsValid() {
+		addrStr = addr.String()
+	}
+
+	if !s.clientPauses.isPaused(time.Now(), setts.ClientName, clientID, addrStr) {
+		return false
+	}
+
+	setts.ProtectionEnabled = false
+
+	return true
+}
+
+// clientPauseJSON is the request of the POST /control/clients/pause and POST
+// /control/clients/resume HTTP APIs as well as of the allowlist learning ones.
+type clientPauseJSON struct {
+	// Client is the name of the persistent client, the ClientID, or the IP
+	// address of the client.
+	Client string `json:"client"`
+
+	// Duration is the duration of the pause or of the allowlist learning in
+	// milliseconds.  It's ignored by the POST /control/clients/resume and POST
+	// /control/clients/learning/stop HTTP APIs.
+	Duration uint `json:"duration"`
+}
+
+// decodeClientPause decodes and validates the request of the client pause and
+// the allowlist learning HTTP APIs.  It writes the error response and returns nil if the request is
+// invalid.
+func (s *Server) decodeClientPause(
+	w http.ResponseWriter,
+	r *http.Request,
+	needDuration bool,
+) (req *clientPauseJSON) {
+	ctx := r.Context()
+	l := s.logger
+
+	req = &clientPauseJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "reading req: %s", err)
+
+		return nil
+	}
+
+	if ip, parseErr := netip.ParseAddr(req.Client); parseErr == nil {
+		req.Client = ip.String()
+	}
+
+	switch {
+	case req.Client == "":
+		err = fmt.Errorf("client: %w", errors.ErrEmptyValue)
+	case needDuration && req.Duration == 0:
+		err = fmt.Errorf("duration: %w", errors.ErrNotPositive)
+	}
+
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return nil
+	}
+
+	return req
+}
+
+// handleClientPause is the handler for the POST /control/clients/pause HTTP
+// API.
+func (s *Server) handleClientPause(w http.ResponseWriter, r *http.Request) {
+	req := s.decodeClientPause(w, r, true)
+	if req == nil {
+		return
+	}
+
+	ctx := r.Context()
+	until := time.Now().Add(time.Duration(req.Duration) * time.Millisecond)
+	s.clientPauses.pause(req.Client, until)
+
+	s.logger.InfoContext(ctx, "filtering paused", "client", req.Client, "until", until)
+
+	aghhttp.OK(ctx, s.logger, w)
+}
+
+// handleClientResume is the handler for the POST /control/clients/resume HTTP
+// API.
+func (s *Server) handleClientResume(w http.ResponseWriter, r *http.Request) {
+	req := s.decodeClientPause(w, r, false)
+	if req == nil {
+		return
+	}
+
+	ctx := r.Context()
+	if !s.clientPauses.resume(req.Client) {
+		aghhttp.ErrorAndLog(
+			ctx,
+			s.logger,
+			r,
+			w,
+			http.StatusNotFound,
+			"filtering isn't paused for client %q",
+			req.Client,
+		)
+
+		return
+	}
+
+	s.logger.InfoContext(ctx, "filtering resumed", "client", req.Client)
+
+	aghhttp.OK(ctx, s.logger, w)
+}
@@ -0,0 +1,135 @@
+package dnsforward
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPauses(t *testing.T) {
+	const (
+		cliActive  = "active"
+		cliExpired = "expired"
+	)
+
+	now := time.Now()
+
+	p := newClientPauses()
+	p.pause(cliActive, now.Add(time.Minute))
+	p.pause(cliExpired, now.Add(-time.Minute))
+
+	assert.True(t, p.isPaused(now, "", "other", cliActive))
+	assert.False(t, p.isPaused(now, cliExpired))
+	assert.False(t, p.isPaused(now, ""))
+
+	pauses := p.list(now)
+	require.Len(t, pauses, 1)
+
+	assert.Equal(t, cliActive, pauses[0].Client)
+
+	assert.True(t, p.resume(cliActive))
+	assert.False(t, p.resume(cliExpired))
+	assert.Empty(t, p.list(now))
+}
+
+func TestServer_handleClientPause(t *testing.T) {
+	const cliIP = "192.168.0.1"
+
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode:      filtering.BlockingModeDefault,
+		ProtectionEnabled: true,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ClientsContainer: EmptyClientsContainer{},
+		},
+		ServePlainDNS: true,
+	})
+
+	check := func(t *testing.T) (resp *filteringCheckResp) {
+		t.Helper()
+
+		r := httptest.NewRequest(
+			http.MethodPost,
+			"/control/filtering/check",
+			bytes.NewBufferString(`{"name":"nxdomain.example.org","client":"`+cliIP+`"}`),
+		)
+		w := httptest.NewRecorder()
+		s.handleFilteringCheck(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp = &filteringCheckResp{}
+		err := json.NewDecoder(w.Body).Decode(resp)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	r := httptest.NewRequest(
+		http.MethodPost,
+		"/control/clients/pause",
+		bytes.NewBufferString(`{"client":"`+cliIP+`","duration":60000}`),
+	)
+	w := httptest.NewRecorder()
+	s.handleClientPause(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	pauses := s.PausedClients()
+	require.Len(t, pauses, 1)
+
+	assert.Equal(t, cliIP, pauses[0].Client)
+
+	resp := check(t)
+	assert.True(t, resp.ClientPaused)
+	assert.Equal(t, filteringDecisionForwarded, resp.Decision)
+
+	r = httptest.NewRequest(
+		http.MethodPost,
+		"/control/clients/resume",
+		bytes.NewBufferString(`{"client":"`+cliIP+`"}`),
+	)
+	w = httptest.NewRecorder()
+	s.handleClientResume(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	resp = check(t)
+	assert.False(t, resp.ClientPaused)
+	assert.Equal(t, filteringDecisionBlocked, resp.Decision)
+
+	t.Run("no_duration", func(t *testing.T) {
+		r = httptest.NewRequest(
+			http.MethodPost,
+			"/control/clients/pause",
+			bytes.NewBufferString(`{"client":"`+cliIP+`"}`),
+		)
+		w = httptest.NewRecorder()
+		s.handleClientPause(w, r)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, "validating: duration: not positive\n", w.Body.String())
+	})
+
+	t.Run("not_paused", func(t *testing.T) {
+		r = httptest.NewRequest(
+			http.MethodPost,
+			"/control/clients/resume",
+			bytes.NewBufferString(`{"client":"other"}`),
+		)
+		w = httptest.NewRecorder()
+		s.handleClientResume(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
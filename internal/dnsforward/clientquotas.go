@@ -0,0 +1,415 @@
+package dnsforward
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// QuotaAction is the action taken for the requests of the clients exceeding a
+// [ClientQuota].
+type QuotaAction string
+
+// Valid client quota actions.
+const (
+	// QuotaActionThrottle drops the requests exceeding the quota without a
+	// response, the same way as the rate limiter does.
+	QuotaActionThrottle QuotaAction = "throttle"
+
+	// QuotaActionRefuse responds to the requests exceeding the quota with the
+	// REFUSED response code.
+	QuotaActionRefuse QuotaAction = "refuse"
+
+	// QuotaActionNotify only logs a warning, when the client starts exceeding
+	// the quota, and processes the requests as usual.
+	QuotaActionNotify QuotaAction = "notify"
+)
+
+// ClientQuota limits the number of the requests of particular clients per day
+// and per second.  The limits apply to each matching client separately.  The
+// first matching quota is used.
+type ClientQuota struct {
+	// Clients are the names of the persistent clients, the ClientIDs, or the
+	// IP addresses of the clients, to which the quota applies.
+	Clients []string `yaml:"clients"`
+
+	// ClientTags are the tags of the persistent clients, to which the quota
+	// applies.  If both ClientTags and [ClientQuota.Clients] are empty, the
+	// quota applies to all clients.
+	ClientTags []string `yaml:"client_tags"`
+
+	// DailyQueries is the maximum number of the requests of a client per day
+	// in the local time zone.  If zero, the number isn't limited.
+	DailyQueries uint64 `yaml:"daily_queries"`
+
+	// Ratelimit is the maximum sustained number of the requests of a client per
+	// second.  If zero, the rate isn't limited.
+	Ratelimit uint32 `yaml:"ratelimit"`
+
+	// Burst is the number of requests a client can send at once in addition to
+	// [ClientQuota.Ratelimit].
+	Burst uint32 `yaml:"burst"`
+
+	// Action is the action for the requests exceeding the quota.
+	Action QuotaAction `yaml:"action"`
+}
+
+// clientQuota is the compiled version of [ClientQuota].
+type clientQuota struct {
+	// clients are the names, the ClientIDs, or the IP addresses of the
+	// clients.
+	clients *container.MapSet[string]
+
+	// tags are the tags of the clients.
+	tags []string
+
+	// daily is the maximum number of the requests per day.
+	daily uint64
+
+	// rate is the maximum number of the requests per second.
+	rate uint32
+
+	// burst is the number of additional requests allowed at once.
+	burst uint32
+
+	// action is the action for the requests exceeding the quota.
+	action QuotaAction
+}
+
+// newClientQuotas validates conf and returns the compiled quotas.
+func newClientQuotas(conf []*ClientQuota) (quotas []*clientQuota, err error) {
+	for i, c := range conf {
+		var q *clientQuota
+		q, err = newClientQuota(c)
+		if err != nil {
+			return nil, fmt.Errorf("client quota at index %d: %w", i, err)
+		}
+
+		quotas = append(quotas, q)
+	}
+
+	return quotas, nil
+}
+
+// newClientQuota validates c and returns the compiled quota.
+func newClientQuota(c *ClientQuota) (q *clientQuota, err error) {
+	switch {
+	case c == nil:
+		return nil, errors.ErrNoValue
+	case c.DailyQueries == 0 && c.Ratelimit == 0:
+		return nil, fmt.Errorf("daily_queries or ratelimit: %w", errors.ErrNoValue)
+	case c.Burst != 0 && c.Ratelimit == 0:
+		return nil, errors.New("burst: requires ratelimit")
+	}
+
+	switch c.Action {
+	case QuotaActionThrottle, QuotaActionRefuse, QuotaActionNotify:
+		// Go on.
+	default:
+		return nil, fmt.Errorf("action: %w: %q", errors.ErrBadEnumValue, c.Action)
+	}
+
+	q = &clientQuota{
+		clients: container.NewMapSet[string](),
+		tags:    slices.Clone(c.ClientTags),
+		daily:   c.DailyQueries,
+		rate:    c.Ratelimit,
+		burst:   c.Burst,
+		action:  c.Action,
+	}
+
+	for i, id := range c.Clients {
+		if id == "" {
+			return nil, fmt.Errorf("clients: at index %d: %w", i, errors.ErrEmptyValue)
+		}
+
+		q.clients.Add(id)
+	}
+
+	return q, nil
+}
+
+// matches returns true if q applies to the client with any of the identifiers
+// and the tags from setts.  Empty identifiers are ignored.
+func (q *clientQuota) matches(setts *filtering.Settings, ids ...string) (ok bool) {
+	if q.clients.Len() == 0 && len(q.tags) == 0 {
+		return true
+	}
+
+	if slices.ContainsFunc(ids, func(id string) (has bool) {
+		return id != "" && q.clients.Has(id)
+	}) {
+		return true
+	}
+
+	return len(q.tags) > 0 && clientMatches(q.tags, nil, netip.Addr{}, setts)
+}
+
+// quotaClient is the usage of the quota by a client within the current day.
+type quotaClient struct {
+	// last is the time of the last refill of tokens.
+	last time.Time
+
+	// exceededSince is the time when the client has started exceeding the
+	// quota.  It's zero if the client doesn't currently exceed it.
+	exceededSince time.Time
+
+	// tokens is the number of requests the client can currently send without
+	// exceeding the rate limit of the quota.
+	tokens float64
+
+	// queries is the number of the requests of the client within the day.
+	queries uint64
+
+	// exceeded is the number of the requests of the client exceeding the
+	// quota within the day.
+	exceeded uint64
+}
+
+// quotaUsage contains the usage of the client quotas.  It isn't reset on
+// reconfiguration, but isn't persisted either, so it's reset on restart.
+type quotaUsage struct {
+	clock timeutil.Clock
+
+	// mu protects day and clients.
+	mu *sync.Mutex
+
+	// day is the beginning of the current day in the local time zone.
+	day time.Time
+
+	// clients maps the client, see [Server.processClientQuotas], to its usage
+	// within the current day.
+	clients map[string]*quotaClient
+}
+
+// newQuotaUsage returns a new properly initialized *quotaUsage.
+func newQuotaUsage(clock timeutil.Clock) (u *quotaUsage) {
+	return &quotaUsage{
+		clock:   clock,
+		mu:      &sync.Mutex{},
+		clients: map[string]*quotaClient{},
+	}
+}
+
+// beginningOfDay returns the beginning of the day of t in its location.
+func beginningOfDay(t time.Time) (day time.Time) {
+	y, m, d := t.Date()
+
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// count counts the request of the client against q and returns true if the
+// client exceeds the quota.  l is used to log the changes of the status of the
+// client.  q must not be nil.
+func (u *quotaUsage) count(
+	ctx context.Context,
+	l *slog.Logger,
+	client string,
+	q *clientQuota,
+) (exceeded bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.clock.Now()
+	if day := beginningOfDay(now); !day.Equal(u.day) {
+		u.day = day
+		clear(u.clients)
+	}
+
+	capacity := float64(q.rate + q.burst)
+	c, ok := u.clients[client]
+	if !ok {
+		c = &quotaClient{
+			last:   now,
+			tokens: capacity,
+		}
+		u.clients[client] = c
+	}
+
+	c.queries++
+	exceeded = q.daily > 0 && c.queries > q.daily
+
+	c.tokens = min(capacity, c.tokens+now.Sub(c.last).Seconds()*float64(q.rate))
+	c.last = now
+	if q.rate > 0 {
+		if c.tokens >= 1 {
+			c.tokens--
+		} else {
+			exceeded = true
+		}
+	}
+
+	switch {
+	case exceeded:
+		c.exceeded++
+		if c.exceededSince.IsZero() {
+			lvl := slog.LevelInfo
+			if q.action == QuotaActionNotify {
+				lvl = slog.LevelWarn
+			}
+
+			l.Log(
+				ctx,
+				lvl,
+				"client exceeds query quota",
+				"client", client,
+				"queries", c.queries,
+				"action", q.action,
+			)
+			c.exceededSince = now
+		}
+	case !c.exceededSince.IsZero():
+		l.InfoContext(
+			ctx,
+			"client no longer exceeds query quota",
+			"client", client,
+			"duration", now.Sub(c.exceededSince),
+			"exceeded", c.exceeded,
+		)
+		c.exceededSince = time.Time{}
+	}
+
+	return exceeded
+}
+
+// clientQuotaFor returns the first quota applying to the client or nil if there
+// is none.
+func (s *Server) clientQuotaFor(setts *filtering.Settings, ids ...string) (q *clientQuota) {
+	for _, q = range s.clientQuotas {
+		if q.matches(setts, ids...) {
+			return q
+		}
+	}
+
+	return nil
+}
+
+// processClientQuotas counts the request against the quota applying to the
+// client and, if the client exceeds it, drops or refuses the request according
+// to the action of the quota.  The refused requests are recorded in the query
+// log as blocked.
+func (s *Server) processClientQuotas(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	if pctx.Res != nil || len(s.clientQuotas) == 0 {
+		return resultCodeSuccess
+	}
+
+	var addrStr string
+	if addr := pctx.Addr.Addr(); addr.IsValid() {
+		addrStr = addr.Unmap().String()
+	}
+
+	q := s.clientQuotaFor(dctx.setts, dctx.setts.ClientName, dctx.clientID, addrStr)
+	if q == nil {
+		return resultCodeSuccess
+	}
+
+	client := cmp.Or(dctx.setts.ClientName, dctx.clientID, addrStr)
+	if !s.quotaUsage.count(ctx, s.logger, client, q) {
+		return resultCodeSuccess
+	}
+
+	switch q.action {
+	case QuotaActionThrottle:
+		dctx.err = proxy.ErrDrop
+
+		return resultCodeError
+	case QuotaActionRefuse:
+		pctx.Res = s.makeResponseREFUSED(pctx.Req)
+		dctx.result = &filtering.Result{
+			Rules: []*filtering.ResultRule{{
+				Text:         "client quota: refuse",
+				FilterListID: rulelist.APIIDClientQuota,
+			}},
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		}
+	default:
+		// Go on, since the client has already been reported.
+	}
+
+	return resultCodeSuccess
+}
+
+// quotaClientJSON is the usage of the quota by a client.
+type quotaClientJSON struct {
+	// Client is the name of the persistent client, the ClientID, or the IP
+	// address of the client.
+	Client string `json:"client"`
+
+	// Queries is the number of the requests of the client today.
+	Queries uint64 `json:"queries"`
+
+	// Exceeded is the number of the requests of the client exceeding the quota
+	// today.
+	Exceeded uint64 `json:"exceeded"`
+
+	// Limited is true if the client currently exceeds the quota.
+	Limited bool `json:"limited"`
+}
+
+// quotaStatusJSON is the response for the GET /control/clients/quotas HTTP API.
+type quotaStatusJSON struct {
+	// Clients are the clients with quotas, which have sent any requests today,
+	// sorted by the number of the requests in descending order.
+	Clients []*quotaClientJSON `json:"clients"`
+
+	// Enabled is true if any client quotas are configured.
+	Enabled bool `json:"enabled"`
+}
+
+// toJSON returns the JSON representation of the usage of the quotas within the
+// current day.
+func (u *quotaUsage) toJSON() (clients []*quotaClientJSON) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	clients = []*quotaClientJSON{}
+	if !beginningOfDay(u.clock.Now()).Equal(u.day) {
+		return clients
+	}
+
+	for client, c := range u.clients {
+		clients = append(clients, &quotaClientJSON{
+			Client:   client,
+			Queries:  c.queries,
+			Exceeded: c.exceeded,
+			Limited:  !c.exceededSince.IsZero(),
+		})
+	}
+
+	slices.SortFunc(clients, func(a, b *quotaClientJSON) (res int) {
+		return cmp.Or(cmp.Compare(b.Queries, a.Queries), cmp.Compare(a.Client, b.Client))
+	})
+
+	return clients
+}
+
+// handleClientQuotas is the handler for the GET /control/clients/quotas HTTP
+// API.
+func (s *Server) handleClientQuotas(w http.ResponseWriter, r *http.Request) {
+	s.serverLock.RLock()
+	enabled := len(s.clientQuotas) > 0
+	s.serverLock.RUnlock()
+
+	resp := &quotaStatusJSON{
+		Clients: s.quotaUsage.toJSON(),
+		Enabled: enabled,
+	}
+
+	aghhttp.WriteJSONResponseOK(r.Context(), s.logger, w, r, resp)
+}
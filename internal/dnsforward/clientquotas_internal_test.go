@@ -0,0 +1,337 @@
+package dnsforward
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_processClientQuotas(t *testing.T) {
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamDNS:      []string{"8.8.8.8:53"},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ClientsContainer: EmptyClientsContainer{},
+			ClientQuotas: []*ClientQuota{{
+				ClientTags:   []string{"user_child"},
+				DailyQueries: 2,
+				Action:       QuotaActionRefuse,
+			}, {
+				Clients:   []string{"192.0.2.1"},
+				Ratelimit: 1,
+				Action:    QuotaActionThrottle,
+			}, {
+				Clients:      []string{"laptop"},
+				DailyQueries: 1,
+				Action:       QuotaActionNotify,
+			}},
+		},
+		ServePlainDNS: true,
+	})
+
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.Local)
+	s.quotaUsage = newQuotaUsage(&faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	})
+
+	child := &filtering.Settings{
+		ClientName: "tablet",
+		ClientTags: []string{"user_child"},
+	}
+	laptop := &filtering.Settings{
+		ClientName: "laptop",
+	}
+	anon := &filtering.Settings{}
+
+	addr := netip.MustParseAddrPort("192.0.2.1:12345")
+	otherAddr := netip.MustParseAddrPort("192.0.2.2:12345")
+
+	testCases := []struct {
+		setts       *filtering.Settings
+		addr        netip.AddrPort
+		wantErr     error
+		name        string
+		wantRcode   int
+		wantBlocked bool
+	}{{
+		setts:       child,
+		addr:        otherAddr,
+		wantErr:     nil,
+		name:        "child_first",
+		wantRcode:   -1,
+		wantBlocked: false,
+	}, {
+		setts:       child,
+		addr:        otherAddr,
+		wantErr:     nil,
+		name:        "child_second",
+		wantRcode:   -1,
+		wantBlocked: false,
+	}, {
+		setts:       child,
+		addr:        otherAddr,
+		wantErr:     nil,
+		name:        "child_refused",
+		wantRcode:   dns.RcodeRefused,
+		wantBlocked: true,
+	}, {
+		setts:       anon,
+		addr:        addr,
+		wantErr:     nil,
+		name:        "addr_first",
+		wantRcode:   -1,
+		wantBlocked: false,
+	}, {
+		setts:       anon,
+		addr:        addr,
+		wantErr:     proxy.ErrDrop,
+		name:        "addr_throttled",
+		wantRcode:   -1,
+		wantBlocked: false,
+	}, {
+		setts:       laptop,
+		addr:        otherAddr,
+		wantErr:     nil,
+		name:        "laptop_first",
+		wantRcode:   -1,
+		wantBlocked: false,
+	}, {
+		setts:       laptop,
+		addr:        otherAddr,
+		wantErr:     nil,
+		name:        "laptop_notified",
+		wantRcode:   -1,
+		wantBlocked: false,
+	}, {
+		setts:       anon,
+		addr:        otherAddr,
+		wantErr:     nil,
+		name:        "no_quota",
+		wantRcode:   -1,
+		wantBlocked: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:  (&dns.Msg{}).SetQuestion("host.example.", dns.TypeA),
+					Addr: tc.addr,
+				},
+				result: &filtering.Result{},
+				setts:  tc.setts,
+			}
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			rc := s.processClientQuotas(ctx, dctx)
+			if tc.wantErr != nil {
+				require.Equal(t, resultCodeError, rc)
+				assert.ErrorIs(t, dctx.err, tc.wantErr)
+
+				return
+			}
+
+			require.Equal(t, resultCodeSuccess, rc)
+
+			resp := dctx.proxyCtx.Res
+			if !tc.wantBlocked {
+				assert.Nil(t, resp)
+				assert.False(t, dctx.result.IsFiltered)
+
+				return
+			}
+
+			require.NotNil(t, resp)
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+
+			require.Len(t, dctx.result.Rules, 1)
+			assert.Equal(t, rulelist.APIIDClientQuota, dctx.result.Rules[0].FilterListID)
+		})
+	}
+
+	assert.Equal(t, []*quotaClientJSON{{
+		Client:   "tablet",
+		Queries:  3,
+		Exceeded: 1,
+		Limited:  true,
+	}, {
+		Client:   "192.0.2.1",
+		Queries:  2,
+		Exceeded: 1,
+		Limited:  true,
+	}, {
+		Client:   "laptop",
+		Queries:  2,
+		Exceeded: 1,
+		Limited:  true,
+	}}, s.quotaUsage.toJSON())
+
+	t.Run("refill", func(t *testing.T) {
+		now = now.Add(time.Second)
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		exceeded := s.quotaUsage.count(ctx, testLogger, "192.0.2.1", s.clientQuotas[1])
+		assert.False(t, exceeded)
+	})
+
+	t.Run("next_day", func(t *testing.T) {
+		now = now.Add(timeutil.Day)
+
+		assert.Empty(t, s.quotaUsage.toJSON())
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		exceeded := s.quotaUsage.count(ctx, testLogger, "tablet", s.clientQuotas[0])
+		assert.False(t, exceeded)
+	})
+}
+
+func TestServer_processClientQuotas_refusedKept(t *testing.T) {
+	const (
+		localDomainSuffix = "lan"
+		dhcpClient        = "example"
+	)
+
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamDNS:      []string{"8.8.8.8:53"},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ClientsContainer: EmptyClientsContainer{},
+			HandleDDR:        true,
+			ClientQuotas: []*ClientQuota{{
+				Clients:      []string{"192.0.2.1"},
+				DailyQueries: 1,
+				Action:       QuotaActionRefuse,
+			}},
+		},
+		ServePlainDNS: true,
+	})
+
+	s.localDomainSuffix = localDomainSuffix
+	s.dhcpServer = &testDHCP{
+		OnEnabled: func() (_ bool) { return true },
+		OnIPByHost: func(host string) (ip netip.Addr) {
+			if host == dhcpClient {
+				ip = netip.MustParseAddr("192.0.2.2")
+			}
+
+			return ip
+		},
+	}
+
+	// mods are the processors in the same order as in [Server.ServeDNS].
+	mods := []func(ctx context.Context, dctx *dnsContext) (rc resultCode){
+		s.processClientQuotas,
+		s.processDynamicUpdate,
+		s.processDDRQuery,
+		s.processDHCPHosts,
+	}
+
+	testCases := []struct {
+		name  string
+		host  string
+		qtype uint16
+	}{{
+		name:  "ddr",
+		host:  ddrHostFQDN,
+		qtype: dns.TypeSVCB,
+	}, {
+		name:  "dhcp_host",
+		host:  dhcpClient + "." + localDomainSuffix + ".",
+		qtype: dns.TypeA,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+			s.quotaUsage = newQuotaUsage(timeutil.SystemClock{})
+			exceeded := s.quotaUsage.count(ctx, testLogger, "192.0.2.1", s.clientQuotas[0])
+			require.False(t, exceeded)
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:             (&dns.Msg{}).SetQuestion(tc.host, tc.qtype),
+					Addr:            netip.MustParseAddrPort("192.0.2.1:12345"),
+					IsPrivateClient: true,
+				},
+				result: &filtering.Result{},
+				setts:  &filtering.Settings{},
+			}
+
+			for _, process := range mods {
+				if rc := process(ctx, dctx); rc != resultCodeSuccess {
+					break
+				}
+			}
+
+			resp := dctx.proxyCtx.Res
+			require.NotNil(t, resp)
+
+			assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+			assert.True(t, dctx.result.IsFiltered)
+		})
+	}
+}
+
+func TestNewClientQuotas_errors(t *testing.T) {
+	testCases := []struct {
+		conf       *ClientQuota
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "client quota at index 0: no value",
+	}, {
+		conf:       &ClientQuota{Action: QuotaActionRefuse},
+		name:       "no_limits",
+		wantErrMsg: "client quota at index 0: daily_queries or ratelimit: no value",
+	}, {
+		conf:       &ClientQuota{DailyQueries: 1, Burst: 1, Action: QuotaActionRefuse},
+		name:       "burst_without_ratelimit",
+		wantErrMsg: "client quota at index 0: burst: requires ratelimit",
+	}, {
+		conf:       &ClientQuota{DailyQueries: 1, Action: "bad"},
+		name:       "bad_action",
+		wantErrMsg: `client quota at index 0: action: bad enum value: "bad"`,
+	}, {
+		conf: &ClientQuota{
+			Clients:      []string{""},
+			DailyQueries: 1,
+			Action:       QuotaActionNotify,
+		},
+		name:       "empty_client",
+		wantErrMsg: "client quota at index 0: clients: at index 0: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newClientQuotas([]*ClientQuota{tc.conf})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
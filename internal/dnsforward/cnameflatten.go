@@ -0,0 +1,90 @@
+package dnsforward
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// flattenCNAME replaces the CNAME chain starting at the question name in the
+// answer section of resp with the records of the requested type owned by the
+// final canonical name.  The resulting records are owned by the question name
+// and have the minimum TTL of the chain.  resp is left unchanged if it's not a
+// response to an A or AAAA request or if the chain doesn't end with such
+// records.  It returns true if resp has been changed.
+func flattenCNAME(resp *dns.Msg) (ok bool) {
+	if len(resp.Question) == 0 {
+		return false
+	}
+
+	q := resp.Question[0]
+	if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA {
+		return false
+	}
+
+	targets := map[string]*dns.CNAME{}
+	for _, rr := range resp.Answer {
+		if c, isCNAME := rr.(*dns.CNAME); isCNAME {
+			targets[strings.ToLower(c.Hdr.Name)] = c
+		}
+	}
+
+	if len(targets) == 0 {
+		return false
+	}
+
+	name := strings.ToLower(q.Name)
+	ttl := ^uint32(0)
+	for range len(targets) {
+		c, has := targets[name]
+		if !has {
+			break
+		}
+
+		ttl = min(ttl, c.Hdr.Ttl)
+		name = strings.ToLower(c.Target)
+	}
+
+	var ans []dns.RR
+	for _, rr := range resp.Answer {
+		hdr := rr.Header()
+		if hdr.Rrtype != q.Qtype || strings.ToLower(hdr.Name) != name {
+			continue
+		}
+
+		rr = dns.Copy(rr)
+		hdr = rr.Header()
+		hdr.Name = q.Name
+		hdr.Ttl = min(hdr.Ttl, ttl)
+		ans = append(ans, rr)
+	}
+
+	if len(ans) == 0 {
+		return false
+	}
+
+	resp.Answer = ans
+
+	return true
+}
+
+// processCNAMEFlattening flattens the CNAME chain in the response, if it's
+// enabled globally or for the applied rewrite.
+func (s *Server) processCNAMEFlattening(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	res := dctx.proxyCtx.Res
+	if res == nil {
+		return resultCodeSuccess
+	}
+
+	fromRewrite := dctx.result != nil && dctx.result.FlattenCNAME
+	if !s.conf.FlattenCNAME && !fromRewrite {
+		return resultCodeSuccess
+	}
+
+	if flattenCNAME(res) {
+		s.logger.DebugContext(ctx, "flattened cname chain", "host", res.Question[0].Name)
+	}
+
+	return resultCodeSuccess
+}
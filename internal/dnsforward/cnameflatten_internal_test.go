@@ -0,0 +1,98 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenCNAME(t *testing.T) {
+	newCNAME := func(name, target string, ttl uint32) (rr dns.RR) {
+		return &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			Target: target,
+		}
+	}
+
+	newA := func(name, ip string, ttl uint32) (rr dns.RR) {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			A: net.ParseIP(ip),
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		qtype   uint16
+		answer  []dns.RR
+		want    []dns.RR
+		wantMod bool
+	}{{
+		name:  "chain",
+		qtype: dns.TypeA,
+		answer: []dns.RR{
+			newCNAME("www.example.com.", "cdn.example.net.", 300),
+			newCNAME("CDN.example.net.", "edge.example.org.", 60),
+			newA("edge.example.org.", "192.0.2.1", 120),
+			newA("edge.example.org.", "192.0.2.2", 30),
+		},
+		want: []dns.RR{
+			newA("www.example.com.", "192.0.2.1", 60),
+			newA("www.example.com.", "192.0.2.2", 30),
+		},
+		wantMod: true,
+	}, {
+		name:  "no_cname",
+		qtype: dns.TypeA,
+		answer: []dns.RR{
+			newA("www.example.com.", "192.0.2.1", 120),
+		},
+		want: []dns.RR{
+			newA("www.example.com.", "192.0.2.1", 120),
+		},
+		wantMod: false,
+	}, {
+		name:  "no_addresses",
+		qtype: dns.TypeA,
+		answer: []dns.RR{
+			newCNAME("www.example.com.", "cdn.example.net.", 300),
+		},
+		want: []dns.RR{
+			newCNAME("www.example.com.", "cdn.example.net.", 300),
+		},
+		wantMod: false,
+	}, {
+		name:  "other_type",
+		qtype: dns.TypeTXT,
+		answer: []dns.RR{
+			newCNAME("www.example.com.", "cdn.example.net.", 300),
+		},
+		want: []dns.RR{
+			newCNAME("www.example.com.", "cdn.example.net.", 300),
+		},
+		wantMod: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := (&dns.Msg{}).SetQuestion("www.example.com.", tc.qtype)
+			resp.Response = true
+			resp.Answer = tc.answer
+
+			assert.Equal(t, tc.wantMod, flattenCNAME(resp))
+			assert.Equal(t, tc.want, resp.Answer)
+		})
+	}
+}
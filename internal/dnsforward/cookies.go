@@ -0,0 +1,440 @@
+package dnsforward
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// DNSCookiesConfig is the configuration of the DNS Cookies.  See RFC 7873 and
+// RFC 9018.
+type DNSCookiesConfig struct {
+	// Secret is the hex-encoded 16-byte secret used to generate the server
+	// cookies.  If empty, a random secret is generated on each start, so the
+	// cookies issued before a restart become invalid.
+	Secret string `yaml:"secret"`
+
+	// Listeners are the addresses of the UDP listeners, on which the server
+	// cookies are issued and validated, for example "0.0.0.0:53".  If empty,
+	// all UDP listeners are used.
+	Listeners []netip.AddrPort `yaml:"listeners"`
+
+	// Enforce defines if the UDP requests with a client cookie and without a
+	// valid server cookie are answered with BADCOOKIE.  The requests without
+	// any cookies are always processed.
+	Enforce bool `yaml:"enforce"`
+
+	// UpstreamEnabled defines if the cookies are sent to the plain DNS
+	// upstreams and the server cookies returned by them are echoed back.
+	UpstreamEnabled bool `yaml:"upstream_enabled"`
+
+	// Enabled defines if the server cookies are issued and validated.
+	Enabled bool `yaml:"enabled"`
+}
+
+const (
+	// cookieSecretLen is the length of the secret for the server cookies.
+	cookieSecretLen = 16
+
+	// clientCookieLen is the length of a client cookie.
+	clientCookieLen = 8
+
+	// minServerCookieLen and maxServerCookieLen are the bounds of the length
+	// of a server cookie.
+	minServerCookieLen = 8
+	maxServerCookieLen = 32
+
+	// serverCookieLen is the length of the server cookies issued by
+	// AdGuard Home.
+	serverCookieLen = 16
+
+	// cookieVersion is the version of the server cookie format.  See RFC 9018.
+	cookieVersion = 1
+
+	// cookieMaxAge is the maximum age of a valid server cookie.
+	cookieMaxAge = 1 * time.Hour
+
+	// cookieMaxSkew is the maximum time, by which the timestamp of a valid
+	// server cookie may be in the future.
+	cookieMaxSkew = 5 * time.Minute
+)
+
+// validate returns an error if c isn't valid.  A nil c is valid.
+func (c *DNSCookiesConfig) validate() (err error) {
+	if c == nil || c.Secret == "" {
+		return nil
+	}
+
+	secret, err := hex.DecodeString(c.Secret)
+	if err != nil {
+		return fmt.Errorf("secret: %w", err)
+	}
+
+	if len(secret) != cookieSecretLen {
+		return fmt.Errorf("secret: got %d bytes, want %d", len(secret), cookieSecretLen)
+	}
+
+	return nil
+}
+
+// cookieServer issues and validates the server cookies.
+type cookieServer struct {
+	// clock is used to get the current time.  It must not be nil.
+	clock timeutil.Clock
+
+	// secret is the secret key of the server cookies.
+	secret []byte
+
+	// listeners are the addresses of the UDP listeners, on which the cookies
+	// are used.  If empty, all UDP listeners are used.
+	listeners []netip.AddrPort
+
+	// enforce defines if the requests without valid server cookies are
+	// answered with BADCOOKIE.
+	enforce bool
+}
+
+// newCookieServer returns a new *cookieServer or nil if the server cookies are
+// disabled.  conf must be valid.
+func newCookieServer(conf *DNSCookiesConfig, clock timeutil.Clock) (cs *cookieServer) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	var secret []byte
+	if conf.Secret != "" {
+		// The secret has been validated.
+		secret, _ = hex.DecodeString(conf.Secret)
+	} else {
+		secret = make([]byte, cookieSecretLen)
+		_, _ = rand.Read(secret)
+	}
+
+	return &cookieServer{
+		clock:     clock,
+		secret:    secret,
+		listeners: slices.Clone(conf.Listeners),
+		enforce:   conf.Enforce,
+	}
+}
+
+// applies returns true if the cookies should be used for the request in pctx.
+// cs may be nil.
+func (cs *cookieServer) applies(pctx *proxy.DNSContext) (ok bool) {
+	if cs == nil || pctx.Proto != proxy.ProtoUDP {
+		return false
+	} else if pctx.Req.Opcode == dns.OpcodeUpdate {
+		// The TSIG signatures of the dynamic updates cover the cookies, so
+		// the messages must not be changed.
+		return false
+	}
+
+	if len(cs.listeners) == 0 {
+		return true
+	}
+
+	if pctx.Conn == nil {
+		return false
+	}
+
+	laddr := netutil.NetAddrToAddrPort(pctx.Conn.LocalAddr())
+
+	return slices.ContainsFunc(cs.listeners, func(l netip.AddrPort) (eq bool) {
+		return l.Port() == laddr.Port() && l.Addr().Unmap() == laddr.Addr().Unmap()
+	})
+}
+
+// serverCookie returns the server cookie for the client cookie and the client
+// IP address at the time ts.  The layout is the one from RFC 9018, but the hash
+// is a truncated HMAC-SHA256, since the cookies are only validated by this
+// server.
+func (cs *cookieServer) serverCookie(client []byte, ip netip.Addr, ts uint32) (cookie []byte) {
+	cookie = make([]byte, 8, serverCookieLen)
+	cookie[0] = cookieVersion
+	binary.BigEndian.PutUint32(cookie[4:], ts)
+
+	mac := hmac.New(sha256.New, cs.secret)
+	_, _ = mac.Write(client)
+	_, _ = mac.Write(cookie)
+	_, _ = mac.Write(ip.Unmap().AsSlice())
+
+	return mac.Sum(cookie)[:serverCookieLen]
+}
+
+// isValid returns true if server is a valid server cookie for the client
+// cookie and the client IP address.
+func (cs *cookieServer) isValid(client, server []byte, ip netip.Addr) (ok bool) {
+	if len(server) != serverCookieLen || server[0] != cookieVersion {
+		return false
+	}
+
+	ts := binary.BigEndian.Uint32(server[4:])
+	issued := time.Unix(int64(ts), 0)
+	now := cs.clock.Now()
+	if issued.Before(now.Add(-cookieMaxAge)) || issued.After(now.Add(cookieMaxSkew)) {
+		return false
+	}
+
+	return hmac.Equal(server, cs.serverCookie(client, ip, ts))
+}
+
+// newCookieOption returns the cookie option with the client cookie and a new
+// server cookie for ip.
+func (cs *cookieServer) newCookieOption(client []byte, ip netip.Addr) (o *dns.EDNS0_COOKIE) {
+	ts := uint32(cs.clock.Now().Unix())
+	server := cs.serverCookie(client, ip, ts)
+
+	return &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: hex.EncodeToString(client) + hex.EncodeToString(server),
+	}
+}
+
+// cookieFromMsg returns the client and the server cookies from msg.  If msg
+// has no cookie option, client is nil.  err is not nil if the option is
+// malformed.
+func cookieFromMsg(msg *dns.Msg) (client, server []byte, err error) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil, nil, nil
+	}
+
+	for _, o := range opt.Option {
+		c, ok := o.(*dns.EDNS0_COOKIE)
+		if !ok {
+			continue
+		}
+
+		var data []byte
+		data, err = hex.DecodeString(c.Cookie)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding cookie: %w", err)
+		}
+
+		l := len(data)
+		if l != clientCookieLen &&
+			(l < clientCookieLen+minServerCookieLen || l > clientCookieLen+maxServerCookieLen) {
+			return nil, nil, fmt.Errorf("cookie length: %w: %d", errors.ErrOutOfRange, l)
+		}
+
+		return data[:clientCookieLen], data[clientCookieLen:], nil
+	}
+
+	return nil, nil, nil
+}
+
+// setCookie replaces the cookie option of resp with a new one for the client
+// cookie and ip.  It adds the OPT record to resp if necessary.
+func (cs *cookieServer) setCookie(resp, req *dns.Msg, client []byte, ip netip.Addr) {
+	opt := resp.IsEdns0()
+	if opt == nil {
+		reqOpt := req.IsEdns0()
+		resp.SetEdns0(reqOpt.UDPSize(), reqOpt.Do())
+		opt = resp.IsEdns0()
+	} else {
+		removeOption(opt, dns.EDNS0COOKIE)
+	}
+
+	opt.Option = append(opt.Option, cs.newCookieOption(client, ip))
+}
+
+// checkCookie validates the cookies of the request in pctx.  It returns a
+// [proxy.BeforeRequestError] with the response for the malformed cookies and,
+// if the cookies are enforced, for the invalid server cookies.
+func (s *Server) checkCookie(pctx *proxy.DNSContext) (err error) {
+	if !s.cookies.applies(pctx) {
+		return nil
+	}
+
+	req := pctx.Req
+	client, server, err := cookieFromMsg(req)
+	if err != nil {
+		return &proxy.BeforeRequestError{
+			Err:      fmt.Errorf("checking cookie: %w", err),
+			Response: s.reply(req, dns.RcodeFormatError),
+		}
+	}
+
+	ip := pctx.Addr.Addr()
+	if client == nil || !s.cookies.enforce || s.cookies.isValid(client, server, ip) {
+		return nil
+	}
+
+	resp := s.reply(req, dns.RcodeBadCookie)
+	s.cookies.setCookie(resp, req, client, ip)
+
+	return &proxy.BeforeRequestError{
+		Err:      errors.Error("bad server cookie"),
+		Response: resp,
+	}
+}
+
+// takeCookie returns the client cookie of the request in pctx, if any, and
+// removes the cookie option from the request, so that it isn't sent to the
+// upstreams.  The request must have been checked by [Server.checkCookie].
+func (s *Server) takeCookie(pctx *proxy.DNSContext) (client []byte) {
+	if !s.cookies.applies(pctx) {
+		return nil
+	}
+
+	client, _, err := cookieFromMsg(pctx.Req)
+	if err != nil || client == nil {
+		return nil
+	}
+
+	stripOption(pctx.Req, dns.EDNS0COOKIE, false)
+
+	return client
+}
+
+// setRespCookie adds a new server cookie for the client cookie to the response
+// in pctx.  client may be nil, in which case the response isn't changed.
+func (s *Server) setRespCookie(pctx *proxy.DNSContext, client []byte) {
+	if client == nil || pctx.Res == nil {
+		return
+	}
+
+	s.cookies.setCookie(pctx.Res, pctx.Req, client, pctx.Addr.Addr())
+}
+
+// errCookieMismatch is returned when the client cookie of an upstream response
+// doesn't match the one sent, which means that the response may be spoofed.
+const errCookieMismatch errors.Error = "client cookie mismatch"
+
+// cookieUpstream is an upstream, which sends the cookies to the wrapped plain
+// DNS upstream and remembers the server cookie returned by it.
+type cookieUpstream struct {
+	upstream.Upstream
+
+	// mu protects server.
+	mu *sync.Mutex
+
+	// client is the client cookie for this upstream.
+	client []byte
+
+	// server is the last server cookie returned by the upstream, if any.
+	server []byte
+}
+
+// newCookieUpstream returns a new *cookieUpstream wrapping u with a random
+// client cookie.
+func newCookieUpstream(u upstream.Upstream) (cu *cookieUpstream) {
+	client := make([]byte, clientCookieLen)
+	_, _ = rand.Read(client)
+
+	return &cookieUpstream{
+		Upstream: u,
+		mu:       &sync.Mutex{},
+		client:   client,
+	}
+}
+
+// type check
+var _ upstream.Upstream = (*cookieUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *cookieUpstream.
+// It retries the exchange once, if the upstream responds with BADCOOKIE.
+func (u *cookieUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	resp, err = u.exchange(req)
+	if err == nil && resp.Rcode == dns.RcodeBadCookie {
+		resp, err = u.exchange(req)
+	}
+
+	if err == nil && resp.Rcode == dns.RcodeBadCookie {
+		return nil, errors.Error("upstream rejected cookie")
+	}
+
+	return resp, err
+}
+
+// exchange sends req with the cookies to the upstream and processes the cookie
+// of the response.
+func (u *cookieUpstream) exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	withCookie := req.Copy()
+
+	u.mu.Lock()
+	cookie := hex.EncodeToString(u.client) + hex.EncodeToString(u.server)
+	u.mu.Unlock()
+
+	opt := withCookie.IsEdns0()
+	added := opt == nil
+	if added {
+		withCookie.SetEdns0(dns.DefaultMsgSize, false)
+		opt = withCookie.IsEdns0()
+	} else {
+		removeOption(opt, dns.EDNS0COOKIE)
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: cookie,
+	})
+
+	resp, err = u.Upstream.Exchange(withCookie)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	client, server, err := cookieFromMsg(resp)
+	if err != nil {
+		return nil, fmt.Errorf("response: %w", err)
+	} else if client != nil {
+		if !hmac.Equal(client, u.client) {
+			return nil, errCookieMismatch
+		}
+
+		u.mu.Lock()
+		u.server = slices.Clone(server)
+		u.mu.Unlock()
+	}
+
+	stripOption(resp, dns.EDNS0COOKIE, added)
+
+	return resp, nil
+}
+
+// isPlainUpstream returns true if the upstream with addr is a plain DNS one.
+// addr is the address returned by [upstream.Upstream.Address].
+func isPlainUpstream(addr string) (ok bool) {
+	scheme, _, found := strings.Cut(addr, "://")
+	if !found {
+		// Make sure that it's a host and port.
+		_, _, err := net.SplitHostPort(addr)
+
+		return err == nil
+	}
+
+	return scheme == "udp" || scheme == "tcp"
+}
+
+// wrapCookieUpstreams wraps the plain DNS upstreams of uc to send the cookies,
+// if enabled by conf.  conf and uc may be nil.
+func wrapCookieUpstreams(conf *DNSCookiesConfig, uc *proxy.UpstreamConfig) {
+	if conf == nil || !conf.UpstreamEnabled || uc == nil {
+		return
+	}
+
+	mapUpstreams(uc, func(u upstream.Upstream) (w upstream.Upstream) {
+		if !isPlainUpstream(u.Address()) {
+			return u
+		}
+
+		return newCookieUpstream(u)
+	})
+}
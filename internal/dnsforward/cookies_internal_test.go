@@ -0,0 +1,191 @@
+package dnsforward
+
+import (
+	"encoding/hex"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClientCookie is the client cookie for tests.
+var testClientCookie = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+// newCookieReq returns a new request with the cookie option containing the
+// hex-encoded cookie.
+func newCookieReq(cookie string) (req *dns.Msg) {
+	req = (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+	req.SetEdns0(1232, false)
+	req.IsEdns0().Option = append(req.IsEdns0().Option, &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: cookie,
+	})
+
+	return req
+}
+
+func TestCookieServer_IsValid(t *testing.T) {
+	var now time.Time
+	cs := newCookieServer(&DNSCookiesConfig{
+		Secret:  "000102030405060708090a0b0c0d0e0f",
+		Enabled: true,
+	}, &faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	})
+	require.NotNil(t, cs)
+
+	ip := netip.MustParseAddr("192.0.2.1")
+	now = time.Unix(1_700_000_000, 0)
+
+	o := cs.newCookieOption(testClientCookie, ip)
+	data, err := hex.DecodeString(o.Cookie)
+	require.NoError(t, err)
+	require.Len(t, data, clientCookieLen+serverCookieLen)
+
+	client, server := data[:clientCookieLen], data[clientCookieLen:]
+	assert.Equal(t, testClientCookie, client)
+	assert.True(t, cs.isValid(client, server, ip))
+
+	assert.False(t, cs.isValid(client, server, netip.MustParseAddr("192.0.2.2")))
+	assert.False(t, cs.isValid([]byte{8, 7, 6, 5, 4, 3, 2, 1}, server, ip))
+
+	now = now.Add(cookieMaxAge + time.Second)
+	assert.False(t, cs.isValid(client, server, ip))
+}
+
+func TestServer_CheckCookie(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := &Server{
+		cookies: newCookieServer(&DNSCookiesConfig{
+			Enforce: true,
+			Enabled: true,
+		}, &faketime.Clock{
+			OnNow: func() (n time.Time) { return now },
+		}),
+	}
+
+	addr := netip.MustParseAddrPort("192.0.2.1:12345")
+	valid := s.cookies.newCookieOption(testClientCookie, addr.Addr()).Cookie
+
+	testCases := []struct {
+		req        *dns.Msg
+		name       string
+		wantErrMsg string
+		wantRcode  int
+	}{{
+		req:        (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA),
+		name:       "no_cookie",
+		wantErrMsg: "",
+		wantRcode:  dns.RcodeSuccess,
+	}, {
+		req:        newCookieReq(valid),
+		name:       "valid",
+		wantErrMsg: "",
+		wantRcode:  dns.RcodeSuccess,
+	}, {
+		req:        newCookieReq(hex.EncodeToString(testClientCookie)),
+		name:       "client_only",
+		wantErrMsg: "bad server cookie; respond with BADCOOKIE",
+		wantRcode:  dns.RcodeBadCookie,
+	}, {
+		req:        newCookieReq("0102"),
+		name:       "malformed",
+		wantErrMsg: "checking cookie: cookie length: out of range: 2; respond with FORMERR",
+		wantRcode:  dns.RcodeFormatError,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := s.checkCookie(&proxy.DNSContext{
+				Proto: proxy.ProtoUDP,
+				Req:   tc.req,
+				Addr:  addr,
+			})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if err == nil {
+				return
+			}
+
+			brErr := testutil.RequireTypeAssert[*proxy.BeforeRequestError](t, err)
+			assert.Equal(t, tc.wantRcode, brErr.Response.Rcode)
+		})
+	}
+
+	t.Run("response", func(t *testing.T) {
+		req := newCookieReq(hex.EncodeToString(testClientCookie))
+		pctx := &proxy.DNSContext{
+			Proto: proxy.ProtoUDP,
+			Req:   req,
+			Addr:  addr,
+		}
+
+		client := s.takeCookie(pctx)
+		assert.Equal(t, testClientCookie, client)
+
+		got, _, err := cookieFromMsg(req)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+
+		pctx.Res = (&dns.Msg{}).SetReply(req)
+		s.setRespCookie(pctx, client)
+
+		got, server, err := cookieFromMsg(pctx.Res)
+		require.NoError(t, err)
+
+		assert.Equal(t, testClientCookie, got)
+		assert.True(t, s.cookies.isValid(got, server, addr.Addr()))
+	})
+}
+
+func TestCookieUpstream_Exchange(t *testing.T) {
+	serverCookie := []byte{9, 9, 9, 9, 9, 9, 9, 9}
+
+	var gotCookies []string
+	var spoof bool
+	u := &aghtest.UpstreamMock{
+		OnAddress: func() (addr string) { return "1.2.3.4:53" },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+			client, server, err := cookieFromMsg(req)
+			require.NoError(t, err)
+
+			gotCookies = append(gotCookies, hex.EncodeToString(server))
+
+			if spoof {
+				client = []byte{0, 0, 0, 0, 0, 0, 0, 0}
+			}
+
+			resp = (&dns.Msg{}).SetReply(req)
+			resp.SetEdns0(1232, false)
+			resp.IsEdns0().Option = append(resp.IsEdns0().Option, &dns.EDNS0_COOKIE{
+				Code:   dns.EDNS0COOKIE,
+				Cookie: hex.EncodeToString(client) + hex.EncodeToString(serverCookie),
+			})
+
+			return resp, nil
+		},
+	}
+
+	cu := newCookieUpstream(u)
+	req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+
+	resp, err := cu.Exchange(req)
+	require.NoError(t, err)
+	assert.Nil(t, resp.IsEdns0())
+	assert.Nil(t, req.IsEdns0())
+
+	_, err = cu.Exchange(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", hex.EncodeToString(serverCookie)}, gotCookies)
+
+	spoof = true
+	_, err = cu.Exchange(req)
+	assert.ErrorIs(t, err, errCookieMismatch)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"net/netip"
@@ -32,6 +33,7 @@ import (
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/netutil/sysresolv"
 	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/miekg/dns"
 )
 
@@ -137,6 +139,93 @@ type Server struct {
 	// access drops disallowed clients.
 	access *accessManager
 
+	// views are the split-horizon DNS views.  It must not be modified after
+	// the server is prepared.
+	views []*view
+
+	// blockingRules override the blocking mode.  It must not be modified after
+	// the server is prepared.
+	blockingRules []*blockingRule
+
+	// qtypePolicies refuse or strip the requests of particular types.  It must
+	// not be modified after the server is prepared.
+	qtypePolicies []*qtypePolicy
+
+	// clientQuotas limit the numbers of the requests of particular clients.  It
+	// must not be modified after the server is prepared.
+	clientQuotas []*clientQuota
+
+	// quotaUsage is the usage of clientQuotas, which is kept on
+	// reconfiguration.
+	quotaUsage *quotaUsage
+
+	// responseRewrites modify the upstream responses.  It must not be modified
+	// after the server is prepared.
+	responseRewrites []*responseRewrite
+
+	// geoBlocker blocks and flags the responses by the countries and the
+	// autonomous systems of their addresses.  It's nil if the geo-blocking is
+	// disabled.  It must not be modified after the server is prepared.
+	geoBlocker *geoBlocker
+
+	// mdnsBridge resolves the link-local host names with multicast DNS and
+	// LLMNR.  It's nil if it's disabled.
+	mdnsBridge *mdnsBridge
+
+	// svcbStripKeys are the keys of the parameters removed from the HTTPS and
+	// SVCB records in the upstream responses.  It must not be modified after
+	// the server is prepared.
+	svcbStripKeys []dns.SVCBKey
+
+	// upstreamTLS are the custom TLS settings of the encrypted upstreams by
+	// their addresses.  It must not be modified after the server is prepared.
+	upstreamTLS map[string]*upstreamTLS
+
+	// pooledUpstreams are the upstreams and the fallback upstreams reusing the
+	// connections.  It must not be modified after the server is prepared.
+	pooledUpstreams []*pooledUpstream
+
+	// tsigKeys are the keys for authenticating the dynamic updates of the
+	// local zones by their lowercased FQDNs.  It must not be modified after the
+	// server is prepared.
+	tsigKeys map[string]*tsigKey
+
+	// localZones are the zones served authoritatively.  It must not be
+	// modified after the server is prepared.
+	localZones []*localZone
+
+	// stale stores the upstream responses for serving them when the upstreams
+	// fail.  It is nil if serving the expired responses is disabled.
+	stale *staleCache
+
+	// prefetch refreshes the cached responses for the popular requests.  It is
+	// nil if refreshing is disabled.
+	prefetch *prefetcher
+
+	// cookies issues and validates the server cookies.  It is nil if the
+	// server cookies are disabled.
+	cookies *cookieServer
+
+	// rateLimiter drops the requests of the clients exceeding the rate limits.
+	// It's nil if the rate limiting is disabled.
+	rateLimiter *rateLimiter
+
+	// listeners apply the settings of the listeners of each protocol.  It's
+	// nil if there are none.
+	listeners *listeners
+
+	// listenerProfiles are the filtering profiles of the additional plain DNS
+	// listeners by their ports.  It's nil if there are none.
+	listenerProfiles map[uint16]*listenerProfile
+
+	// upstreamScores are the scores of the upstreams used by the selector
+	// upstream modes and the health checker.
+	upstreamScores *upstreamScores
+
+	// healthChecker probes the upstreams.  It is nil if the health checks are
+	// disabled.
+	healthChecker *healthChecker
+
 	// anonymizer masks the client's IP addresses if needed.
 	anonymizer *aghnet.IPMut
 
@@ -193,6 +282,13 @@ type Server struct {
 	// updating the protection configuration after a pause is running at a time.
 	protectionUpdateInProgress atomic.Bool
 
+	// clientPauses contains the temporary pauses of the filtering for clients.
+	clientPauses *clientPauses
+
+	// allowlistLearning contains the allowlist learning sessions of the
+	// persistent clients.
+	allowlistLearning *allowlistLearning
+
 	// isRunning is true if the DNS server is running.
 	isRunning bool
 
@@ -265,7 +361,10 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 			EnableLRU: true,
 			MaxCount:  defaultClientIDCacheCount,
 		}),
-		anonymizer: p.Anonymizer,
+		anonymizer:        p.Anonymizer,
+		clientPauses:      newClientPauses(),
+		allowlistLearning: newAllowlistLearning(),
+		quotaUsage:        newQuotaUsage(timeutil.SystemClock{}),
 		conf: ServerConfig{
 			ServePlainDNS: true,
 		},
@@ -312,6 +411,10 @@ func (s *Server) WriteDiskConfig(c *Config) {
 	sc := s.conf.Config
 	*c = sc
 	c.RatelimitWhitelist = slices.Clone(sc.RatelimitWhitelist)
+	c.RatelimitSubnets = slices.Clone(sc.RatelimitSubnets)
+	c.Listeners = maps.Clone(sc.Listeners)
+	c.DoHPaths = slices.Clone(sc.DoHPaths)
+	c.ListenerProfiles = slices.Clone(sc.ListenerProfiles)
 	c.BootstrapDNS = slices.Clone(sc.BootstrapDNS)
 	c.FallbackDNS = slices.Clone(sc.FallbackDNS)
 	c.AllowedClients = slices.Clone(sc.AllowedClients)
@@ -319,6 +422,68 @@ func (s *Server) WriteDiskConfig(c *Config) {
 	c.BlockedHosts = slices.Clone(sc.BlockedHosts)
 	c.TrustedProxies = slices.Clone(sc.TrustedProxies)
 	c.UpstreamDNS = slices.Clone(sc.UpstreamDNS)
+	c.Views = slices.Clone(sc.Views)
+	c.LocalZones = slices.Clone(sc.LocalZones)
+	c.TSIGKeys = slices.Clone(sc.TSIGKeys)
+	c.BlockingRules = slices.Clone(sc.BlockingRules)
+	c.QTypePolicies = slices.Clone(sc.QTypePolicies)
+	c.ClientQuotas = slices.Clone(sc.ClientQuotas)
+	c.ResponseRewrites = slices.Clone(sc.ResponseRewrites)
+	c.StripSVCBParams = slices.Clone(sc.StripSVCBParams)
+	c.UpstreamWeights = maps.Clone(sc.UpstreamWeights)
+	c.UpstreamProxies = maps.Clone(sc.UpstreamProxies)
+	c.UpstreamBindings = maps.Clone(sc.UpstreamBindings)
+	c.UpstreamTLS = maps.Clone(sc.UpstreamTLS)
+	c.UpstreamTimeouts = maps.Clone(sc.UpstreamTimeouts)
+	if sc.ServeStale != nil {
+		c.ServeStale = &ServeStaleConfig{}
+		*c.ServeStale = *sc.ServeStale
+	}
+
+	if sc.Prefetch != nil {
+		c.Prefetch = &PrefetchConfig{}
+		*c.Prefetch = *sc.Prefetch
+	}
+
+	if sc.UpstreamHealthCheck != nil {
+		c.UpstreamHealthCheck = &UpstreamHealthCheckConfig{}
+		*c.UpstreamHealthCheck = *sc.UpstreamHealthCheck
+	}
+
+	if sc.GeoBlocking != nil {
+		c.GeoBlocking = &GeoBlockingConfig{
+			Databases: slices.Clone(sc.GeoBlocking.Databases),
+			Rules:     slices.Clone(sc.GeoBlocking.Rules),
+		}
+	}
+
+	if sc.MDNSBridge != nil {
+		c.MDNSBridge = &MDNSBridgeConfig{}
+		*c.MDNSBridge = *sc.MDNSBridge
+	}
+
+	if sc.UpstreamConnections != nil {
+		c.UpstreamConnections = &UpstreamConnectionsConfig{}
+		*c.UpstreamConnections = *sc.UpstreamConnections
+	}
+
+	if sc.EDNSPadding != nil {
+		c.EDNSPadding = &EDNSPaddingConfig{}
+		*c.EDNSPadding = *sc.EDNSPadding
+	}
+
+	if sc.DomainUpstreams != nil {
+		c.DomainUpstreams = &DomainUpstreamsConfig{}
+		*c.DomainUpstreams = *sc.DomainUpstreams
+		c.DomainUpstreams.ECSDomains = slices.Clone(sc.DomainUpstreams.ECSDomains)
+		c.DomainUpstreams.Timeouts = maps.Clone(sc.DomainUpstreams.Timeouts)
+	}
+
+	if sc.DNSCookies != nil {
+		c.DNSCookies = &DNSCookiesConfig{}
+		*c.DNSCookies = *sc.DNSCookies
+		c.DNSCookies.Listeners = slices.Clone(sc.DNSCookies.Listeners)
+	}
 }
 
 // LocalPTRResolvers returns the current local PTR resolver configuration.
@@ -487,6 +652,7 @@ func (s *Server) startLocked(ctx context.Context) error {
 	err := s.dnsProxy.Start(ctx)
 	if err == nil {
 		s.isRunning = true
+		s.healthChecker.start(ctx)
 	}
 
 	return err
@@ -530,6 +696,79 @@ func (s *Server) Prepare(ctx context.Context, conf *ServerConfig) (err error) {
 		return fmt.Errorf("preparing access: %w", err)
 	}
 
+	s.views, err = newViews(s.conf.Views)
+	if err != nil {
+		return fmt.Errorf("preparing views: %w", err)
+	}
+
+	s.tsigKeys, err = newTSIGKeys(s.conf.TSIGKeys)
+	if err != nil {
+		return fmt.Errorf("preparing tsig keys: %w", err)
+	}
+
+	s.localZones, err = newLocalZones(s.conf.LocalZones, s.tsigKeys)
+	if err != nil {
+		return fmt.Errorf("preparing local zones: %w", err)
+	}
+
+	s.blockingRules, err = newBlockingRules(s.conf.BlockingRules)
+	if err != nil {
+		return fmt.Errorf("preparing blocking rules: %w", err)
+	}
+
+	s.qtypePolicies, err = newQTypePolicies(s.conf.QTypePolicies)
+	if err != nil {
+		return fmt.Errorf("preparing qtype policies: %w", err)
+	}
+
+	s.clientQuotas, err = newClientQuotas(s.conf.ClientQuotas)
+	if err != nil {
+		return fmt.Errorf("preparing client quotas: %w", err)
+	}
+
+	s.responseRewrites, err = newResponseRewrites(s.conf.ResponseRewrites)
+	if err != nil {
+		return fmt.Errorf("preparing response rewrites: %w", err)
+	}
+
+	s.geoBlocker, err = newGeoBlocker(s.conf.GeoBlocking)
+	if err != nil {
+		return fmt.Errorf("geo_blocking: %w", err)
+	}
+
+	err = s.conf.ServeStale.validate()
+	if err != nil {
+		return fmt.Errorf("serve_stale: %w", err)
+	}
+
+	s.stale = newStaleCache(s.conf.ServeStale, timeutil.SystemClock{})
+
+	err = s.conf.Prefetch.validate()
+	if err != nil {
+		return fmt.Errorf("prefetch: %w", err)
+	}
+
+	s.prefetch = newPrefetcher(s.conf.Prefetch, s.conf.CacheEnabled)
+
+	err = s.conf.DNSCookies.validate()
+	if err != nil {
+		return fmt.Errorf("dns_cookies: %w", err)
+	}
+
+	s.cookies = newCookieServer(s.conf.DNSCookies, timeutil.SystemClock{})
+
+	err = s.conf.MDNSBridge.validate()
+	if err != nil {
+		return fmt.Errorf("mdns_bridge: %w", err)
+	}
+
+	s.mdnsBridge = newMDNSBridge(s.conf.MDNSBridge, udpMulticastExchanger{})
+
+	s.svcbStripKeys, err = newSVCBStripKeys(s.conf.StripSVCBParams)
+	if err != nil {
+		return fmt.Errorf("strip_svcb_params: %w", err)
+	}
+
 	proxyConfig.Fallbacks, err = s.setupFallbackDNS()
 	if err != nil {
 		return fmt.Errorf("setting up fallback dns servers: %w", err)
@@ -558,7 +797,12 @@ func (s *Server) prepareUpstreamSettings(ctx context.Context, boot upstream.Reso
 		return fmt.Errorf("loading upstreams: %w", err)
 	}
 
-	uc, err := newUpstreamConfig(ctx, s.logger, upstreams, defaultDNS, &upstream.Options{
+	s.upstreamTLS, err = newUpstreamTLS(s.conf.UpstreamTLS)
+	if err != nil {
+		return fmt.Errorf("upstream_tls: %w", err)
+	}
+
+	opts := &upstream.Options{
 		Logger:       aghslog.NewForUpstream(s.baseLogger, aghslog.UpstreamTypeMain),
 		Bootstrap:    boot,
 		Timeout:      s.conf.UpstreamTimeout,
@@ -573,11 +817,94 @@ func (s *Server) prepareUpstreamSettings(ctx context.Context, boot upstream.Reso
 		// TODO(a.garipov): Investigate if that's true.
 		RootCAs:      s.conf.TLSv12Roots,
 		CipherSuites: s.conf.TLSCiphers,
-	})
+	}
+
+	uc, err := newUpstreamConfig(ctx, s.logger, upstreams, defaultDNS, opts)
 	if err != nil {
 		return fmt.Errorf("preparing upstream config: %w", err)
 	}
 
+	err = s.pinUpstreams(uc, opts)
+	if err != nil {
+		return fmt.Errorf("preparing upstream tls: %w", err)
+	}
+
+	err = s.proxyUpstreams(uc)
+	if err != nil {
+		return fmt.Errorf("preparing upstream proxy: %w", err)
+	}
+
+	err = s.bindUpstreams(uc)
+	if err != nil {
+		return fmt.Errorf("preparing upstream bindings: %w", err)
+	}
+
+	err = s.conf.UpstreamConnections.validate()
+	if err != nil {
+		return fmt.Errorf("upstream_connections: %w", err)
+	}
+
+	err = s.poolUpstreams(uc, opts)
+	if err != nil {
+		return fmt.Errorf("preparing upstream connections: %w", err)
+	}
+
+	err = validateUpstreamTimeouts(s.conf.UpstreamTimeouts)
+	if err != nil {
+		return fmt.Errorf("upstream_timeouts: %w", err)
+	}
+
+	err = s.conf.DomainUpstreams.validate()
+	if err != nil {
+		return fmt.Errorf("domain_upstreams: %w", err)
+	}
+
+	err = s.applyUpstreamTimeouts(uc, opts)
+	if err != nil {
+		return fmt.Errorf("preparing upstream timeouts: %w", err)
+	}
+
+	s.pooledUpstreams = pooledUpstreams(uc)
+
+	err = padUpstreams(s.conf.EDNSPadding, uc)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	randomizeQueryCase(s.conf.RandomizeQueryCase, uc)
+	wrapCookieUpstreams(s.conf.DNSCookies, uc)
+
+	err = validateNegativeCacheTTL(s.conf.CacheNegativeMinTTL, s.conf.CacheNegativeMaxTTL)
+	if err != nil {
+		return fmt.Errorf("validating negative cache ttl: %w", err)
+	}
+
+	newNegativeTTL(
+		s.conf.CacheNegativeMinTTL,
+		s.conf.CacheNegativeMaxTTL,
+		s.conf.CacheNegativeDisabled,
+	).wrap(uc)
+
+	err = s.conf.UpstreamHealthCheck.validate()
+	if err != nil {
+		return fmt.Errorf("upstream_health_check: %w", err)
+	}
+
+	s.upstreamScores = newUpstreamScores(s.conf.UpstreamWeights, timeutil.SystemClock{})
+	s.healthChecker = newHealthChecker(s.logger, s.conf.UpstreamHealthCheck, s.upstreamScores, uc)
+	wrapSelectors(s.upstreamScores, uc, s.conf.UpstreamMode, s.domainUpstreamMode())
+
+	s.listenerProfiles, err = s.newListenerProfiles(
+		ctx,
+		s.conf.ListenerProfiles,
+		s.conf.mainPlainPorts(),
+		opts.Clone(),
+	)
+	if err != nil {
+		return fmt.Errorf("listener_profiles: %w", err)
+	}
+
 	s.conf.UpstreamConfig = uc
 	s.conf.ClientsContainer.UpdateCommonUpstreamConfig(&client.CommonUpstreamConfig{
 		Bootstrap:               boot,
@@ -697,18 +1024,56 @@ func (s *Server) setupFallbackDNS() (uc *proxy.UpstreamConfig, err error) {
 		return nil, nil
 	}
 
-	uc, err = proxy.ParseUpstreamsConfig(fallbacks, &upstream.Options{
+	opts := &upstream.Options{
 		Logger: aghslog.NewForUpstream(s.baseLogger, aghslog.UpstreamTypeFallback),
 		// TODO(s.chzhen):  Investigate if other options are needed.
 		Timeout:    s.conf.UpstreamTimeout,
 		PreferIPv6: s.conf.BootstrapPreferIPv6,
 		// TODO(e.burkov):  Use bootstrap.
-	})
+	}
+
+	uc, err = proxy.ParseUpstreamsConfig(fallbacks, opts)
 	if err != nil {
 		// Do not wrap the error because it's informative enough as is.
 		return nil, err
 	}
 
+	err = s.pinUpstreams(uc, opts)
+	if err != nil {
+		return nil, fmt.Errorf("preparing upstream tls: %w", err)
+	}
+
+	err = s.proxyUpstreams(uc)
+	if err != nil {
+		return nil, fmt.Errorf("preparing upstream proxy: %w", err)
+	}
+
+	err = s.bindUpstreams(uc)
+	if err != nil {
+		return nil, fmt.Errorf("preparing upstream bindings: %w", err)
+	}
+
+	err = s.poolUpstreams(uc, opts)
+	if err != nil {
+		return nil, fmt.Errorf("preparing upstream connections: %w", err)
+	}
+
+	err = s.applyUpstreamTimeouts(uc, opts)
+	if err != nil {
+		return nil, fmt.Errorf("preparing upstream timeouts: %w", err)
+	}
+
+	s.pooledUpstreams = append(s.pooledUpstreams, pooledUpstreams(uc)...)
+
+	err = padUpstreams(s.conf.EDNSPadding, uc)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	randomizeQueryCase(s.conf.RandomizeQueryCase, uc)
+	wrapCookieUpstreams(s.conf.DNSCookies, uc)
+
 	return uc, nil
 }
 
@@ -807,6 +1172,8 @@ func (s *Server) stopLocked(ctx context.Context) {
 	// This will require filtering all the non-critical errors in
 	// [upstream.Upstream] implementations.
 
+	s.healthChecker.stop()
+
 	if s.dnsProxy != nil {
 		err := s.dnsProxy.Shutdown(ctx)
 		if err != nil {
@@ -818,6 +1185,8 @@ func (s *Server) stopLocked(ctx context.Context) {
 		logCloserErr(ctx, b, "closing bootstrap", s.logger.With("address", b.Address()))
 	}
 
+	s.closeListenerProfiles(ctx, s.listenerProfiles)
+
 	s.isRunning = false
 }
 
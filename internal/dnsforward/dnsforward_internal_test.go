@@ -1396,6 +1396,15 @@ func TestRewrite(t *testing.T) {
 
 		assert.Equal(t, "example.org.", reply.Answer[0].(*dns.CNAME).Target)
 		assert.Equal(t, dns.TypeA, reply.Answer[1].Header().Rrtype)
+
+		// The PTR record is synthesized from the rewrite.
+		req = createTestMessageWithType("4.3.2.1.in-addr.arpa.", dns.TypePTR)
+		reply, eerr = dns.Exchange(req, addr.String())
+		require.NoError(t, eerr)
+
+		require.Len(t, reply.Answer, 1)
+
+		assert.Equal(t, "test.com.", reply.Answer[0].(*dns.PTR).Ptr)
 	}
 
 	for _, protect := range []bool{true, false} {
@@ -0,0 +1,157 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// DomainUpstreamsConfig is the configuration of the domain-specific upstreams,
+// that is the ones set with the "[/domain/]upstream" syntax.
+type DomainUpstreamsConfig struct {
+	// Mode is the upstream mode for the domain-specific upstreams.  It must be
+	// either empty, in which case the general upstream mode is used, or one of
+	// [UpstreamModeWeighted], [UpstreamModeLatency], and
+	// [UpstreamModeFailover].
+	Mode UpstreamMode `yaml:"mode"`
+
+	// ECSDomains are the domain names, for requests for which and their
+	// subdomains the subnet of the client is sent to the upstreams in the EDNS
+	// Client Subnet option, when the option is disabled in general.  The
+	// option sent by the client, if any, is forwarded as is.  Note that the
+	// cached responses aren't separated by the subnets in this case.
+	ECSDomains []string `yaml:"ecs_domains"`
+
+	// Timeouts are the timeouts and the retry counts for the upstreams of
+	// particular domain names.  They override [Config.UpstreamTimeouts].
+	Timeouts map[string]*UpstreamTimeoutConfig `yaml:"timeouts"`
+}
+
+const (
+	// ecsPrefixLenV4 and ecsPrefixLenV6 are the lengths of the subnets sent in
+	// the EDNS Client Subnet option.
+	ecsPrefixLenV4 = 24
+	ecsPrefixLenV6 = 56
+)
+
+// validate returns an error if c isn't valid.  A nil c is valid.
+func (c *DomainUpstreamsConfig) validate() (err error) {
+	if c == nil {
+		return nil
+	}
+
+	if c.Mode != "" && !isSelectorMode(c.Mode) {
+		return fmt.Errorf("mode: %w: %q", errors.ErrBadEnumValue, c.Mode)
+	}
+
+	for i, d := range c.ECSDomains {
+		err = netutil.ValidateDomainName(aghnet.NormalizeDomain(d))
+		if err != nil {
+			return fmt.Errorf("ecs_domains: at index %d: %w", i, err)
+		}
+	}
+
+	for d := range c.Timeouts {
+		err = netutil.ValidateDomainName(aghnet.NormalizeDomain(d))
+		if err != nil {
+			return fmt.Errorf("timeouts: %q: %w", d, err)
+		}
+	}
+
+	err = validateUpstreamTimeouts(c.Timeouts)
+	if err != nil {
+		return fmt.Errorf("timeouts: %w", err)
+	}
+
+	return nil
+}
+
+// domainUpstreamMode returns the upstream mode for the domain-specific
+// upstreams.
+func (s *Server) domainUpstreamMode() (mode UpstreamMode) {
+	if c := s.conf.DomainUpstreams; c != nil && c.Mode != "" {
+		return c.Mode
+	}
+
+	return s.conf.UpstreamMode
+}
+
+// isECSDomain returns true if host, which must be normalized, is one of the
+// configured ECS domain names or their subdomains.
+func (s *Server) isECSDomain(host string) (ok bool) {
+	c := s.conf.DomainUpstreams
+	if c == nil {
+		return false
+	}
+
+	for _, d := range c.ECSDomains {
+		d = aghnet.NormalizeDomain(d)
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setDomainECS adds the subnet of the client to the request in pctx, if the
+// EDNS Client Subnet option is disabled in general and the requested domain
+// name is one of the ECS domain names.
+func (s *Server) setDomainECS(pctx *proxy.DNSContext) {
+	if s.conf.EDNSClientSubnet != nil && s.conf.EDNSClientSubnet.Enabled {
+		// The proxy sets the option itself.
+		return
+	}
+
+	req := pctx.Req
+	host := aghnet.NormalizeDomain(req.Question[0].Name)
+	if !s.isECSDomain(host) {
+		return
+	}
+
+	opt := req.IsEdns0()
+	if opt == nil {
+		req.SetEdns0(dns.DefaultMsgSize, false)
+		opt = req.IsEdns0()
+	} else {
+		for _, o := range opt.Option {
+			if _, ok := o.(*dns.EDNS0_SUBNET); ok {
+				// Forward the option set by the client.
+				return
+			}
+		}
+	}
+
+	opt.Option = append(opt.Option, newECSOption(pctx.Addr.Addr()))
+}
+
+// newECSOption returns the EDNS Client Subnet option with the subnet of ip.
+func newECSOption(ip netip.Addr) (o *dns.EDNS0_SUBNET) {
+	ip = ip.Unmap()
+
+	o = &dns.EDNS0_SUBNET{
+		Code: dns.EDNS0SUBNET,
+	}
+
+	bits := ecsPrefixLenV6
+	o.Family = 2
+	if ip.Is4() {
+		bits = ecsPrefixLenV4
+		o.Family = 1
+	}
+
+	// Errors are only returned for the bit lengths larger than the ones of
+	// the address, which isn't possible here.
+	p, _ := ip.Prefix(bits)
+	o.SourceNetmask = uint8(bits)
+	o.Address = net.IP(p.Addr().AsSlice())
+
+	return o
+}
@@ -0,0 +1,172 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_SetDomainECS(t *testing.T) {
+	s := &Server{
+		conf: ServerConfig{
+			Config: Config{
+				EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+				DomainUpstreams: &DomainUpstreamsConfig{
+					ECSDomains: []string{"corp.example"},
+				},
+			},
+		},
+	}
+
+	clientECS := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: 16,
+		Address:       net.IP{10, 1, 0, 0},
+	}
+
+	testCases := []struct {
+		req     *dns.Msg
+		want    *dns.EDNS0_SUBNET
+		name    string
+		addr    netip.Addr
+		enabled bool
+	}{{
+		req: (&dns.Msg{}).SetQuestion("host.corp.example.", dns.TypeA),
+		want: &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        1,
+			SourceNetmask: ecsPrefixLenV4,
+			Address:       net.IP{192, 0, 2, 0},
+		},
+		name: "v4",
+		addr: netip.MustParseAddr("192.0.2.10"),
+	}, {
+		req: (&dns.Msg{}).SetQuestion("corp.example.", dns.TypeAAAA),
+		want: &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        2,
+			SourceNetmask: ecsPrefixLenV6,
+			Address:       net.ParseIP("2001:db8:1:1200::"),
+		},
+		name: "v6",
+		addr: netip.MustParseAddr("2001:db8:1:1234::1"),
+	}, {
+		req: func() (req *dns.Msg) {
+			req = (&dns.Msg{}).SetQuestion("host.corp.example.", dns.TypeA)
+			req.SetEdns0(1232, false)
+			req.IsEdns0().Option = append(req.IsEdns0().Option, clientECS)
+
+			return req
+		}(),
+		want: clientECS,
+		name: "client",
+		addr: netip.MustParseAddr("192.0.2.10"),
+	}, {
+		req:  (&dns.Msg{}).SetQuestion("host.other.example.", dns.TypeA),
+		want: nil,
+		name: "other",
+		addr: netip.MustParseAddr("192.0.2.10"),
+	}, {
+		req:     (&dns.Msg{}).SetQuestion("host.corp.example.", dns.TypeA),
+		want:    nil,
+		name:    "enabled",
+		addr:    netip.MustParseAddr("192.0.2.10"),
+		enabled: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s.conf.EDNSClientSubnet.Enabled = tc.enabled
+
+			s.setDomainECS(&proxy.DNSContext{
+				Req:  tc.req,
+				Addr: netip.AddrPortFrom(tc.addr, 12345),
+			})
+
+			got := ecsOption(tc.req)
+			if tc.want == nil {
+				assert.Nil(t, got)
+
+				return
+			}
+
+			require.NotNil(t, got)
+
+			assert.Equal(t, tc.want.Family, got.Family)
+			assert.Equal(t, tc.want.SourceNetmask, got.SourceNetmask)
+			assert.True(t, tc.want.Address.Equal(got.Address))
+		})
+	}
+}
+
+func TestWrapSelectors_domainMode(t *testing.T) {
+	u := &aghtest.UpstreamMock{
+		OnAddress: func() (addr string) { return "dc1.corp.example:53" },
+	}
+	general := &aghtest.UpstreamMock{
+		OnAddress: func() (addr string) { return "1.1.1.1:53" },
+	}
+
+	uc := &proxy.UpstreamConfig{
+		Upstreams: []upstream.Upstream{general},
+		DomainReservedUpstreams: map[string][]upstream.Upstream{
+			"corp.example.": {u, u},
+		},
+	}
+
+	scores := newUpstreamScores(nil, &faketime.Clock{
+		OnNow: func() (n time.Time) { return time.Time{} },
+	})
+	wrapSelectors(scores, uc, UpstreamModeLoadBalance, UpstreamModeFailover)
+
+	require.Len(t, uc.Upstreams, 1)
+	assert.Same(t, general, uc.Upstreams[0])
+
+	ups := uc.DomainReservedUpstreams["corp.example."]
+	require.Len(t, ups, 1)
+	assert.Equal(t, "failover(dc1.corp.example:53, dc1.corp.example:53)", ups[0].Address())
+}
+
+func TestDomainUpstreamsConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *DomainUpstreamsConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf: &DomainUpstreamsConfig{
+			Mode:       UpstreamModeFailover,
+			ECSDomains: []string{"corp.example"},
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf:       &DomainUpstreamsConfig{Mode: UpstreamModeParallel},
+		name:       "bad_mode",
+		wantErrMsg: `mode: bad enum value: "parallel"`,
+	}, {
+		conf:       &DomainUpstreamsConfig{ECSDomains: []string{""}},
+		name:       "bad_domain",
+		wantErrMsg: `ecs_domains: at index 0: bad domain name "": domain name is empty`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
@@ -0,0 +1,548 @@
+package dnsforward
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// TSIGKey is a shared secret key for authenticating the dynamic updates of the
+// local zones with TSIG.  See RFC 8945.
+type TSIGKey struct {
+	// Name is the name of the key.  It must be a valid domain name and must be
+	// unique.
+	Name string `yaml:"name"`
+
+	// Algorithm is the name of the HMAC algorithm: "hmac-sha1", "hmac-sha224",
+	// "hmac-sha256", "hmac-sha384", or "hmac-sha512".  If empty,
+	// "hmac-sha256" is used.
+	Algorithm string `yaml:"algorithm"`
+
+	// Secret is the base64-encoded shared secret.  It must not be empty.
+	Secret string `yaml:"secret"`
+}
+
+// defaultTSIGAlgorithm is the name of the TSIG algorithm used when none is set.
+const defaultTSIGAlgorithm = "hmac-sha256"
+
+// tsigAlgorithms are the FQDNs of the supported TSIG algorithms by their names.
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// tsigFudge is the permitted difference in seconds between the time of signing
+// the responses and the time of their verification.  See RFC 8945, section 10.
+const tsigFudge = 300
+
+// tsigKey is the compiled version of [TSIGKey].
+type tsigKey struct {
+	// algorithm is the FQDN of the HMAC algorithm.
+	algorithm string
+
+	// secret is the base64-encoded shared secret.
+	secret string
+}
+
+// newTSIGKeys validates conf and returns the compiled keys by their lowercased
+// FQDNs.
+func newTSIGKeys(conf []*TSIGKey) (keys map[string]*tsigKey, err error) {
+	keys = make(map[string]*tsigKey, len(conf))
+	for i, c := range conf {
+		var name string
+		var k *tsigKey
+		name, k, err = newTSIGKey(c)
+		if err != nil {
+			return nil, fmt.Errorf("tsig key at index %d: %w", i, err)
+		}
+
+		if _, ok := keys[name]; ok {
+			return nil, fmt.Errorf("tsig key at index %d: duplicate name %q", i, name)
+		}
+
+		keys[name] = k
+	}
+
+	return keys, nil
+}
+
+// newTSIGKey validates c and returns the compiled key with its lowercased FQDN.
+func newTSIGKey(c *TSIGKey) (name string, k *tsigKey, err error) {
+	if c == nil {
+		return "", nil, errors.ErrNoValue
+	}
+
+	name = strings.ToLower(strings.TrimSuffix(c.Name, "."))
+	err = netutil.ValidateDomainName(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("name: %w", err)
+	}
+
+	alg, ok := tsigAlgorithms[cmp.Or(c.Algorithm, defaultTSIGAlgorithm)]
+	if !ok {
+		return "", nil, fmt.Errorf("algorithm: %w: %q", errors.ErrBadEnumValue, c.Algorithm)
+	}
+
+	if c.Secret == "" {
+		return "", nil, fmt.Errorf("secret: %w", errors.ErrEmptyValue)
+	}
+
+	_, err = base64.StdEncoding.DecodeString(c.Secret)
+	if err != nil {
+		return "", nil, fmt.Errorf("secret: %w", err)
+	}
+
+	return dns.Fqdn(name), &tsigKey{
+		algorithm: alg,
+		secret:    c.Secret,
+	}, nil
+}
+
+// processDynamicUpdate applies the dynamic updates of the local zones.  See
+// RFC 2136.  The updates of the other zones are processed further.
+func (s *Server) processDynamicUpdate(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	req := pctx.Req
+	if pctx.Res != nil || req.Opcode != dns.OpcodeUpdate || len(s.localZones) == 0 {
+		return resultCodeSuccess
+	}
+
+	q := req.Question[0]
+	z := s.localZoneFor(strings.ToLower(q.Name))
+	if z == nil {
+		return resultCodeSuccess
+	}
+
+	resp := s.replyCompressed(req)
+	if q.Qtype != dns.TypeSOA || z.name != strings.ToLower(q.Name) {
+		// The zone section must contain the name of the zone itself.
+		resp.Rcode = dns.RcodeFormatError
+		pctx.Res = resp
+
+		return resultCodeFinish
+	}
+
+	keyName, key, rcode := s.verifyUpdate(ctx, req, z)
+	if key != nil {
+		rcode = z.update(req)
+		s.logger.InfoContext(
+			ctx,
+			"dynamic update",
+			"zone", z.name,
+			"key", keyName,
+			"rcode", dns.RcodeToString[rcode],
+		)
+	}
+
+	resp.Rcode = rcode
+	pctx.Res = resp
+	if key == nil {
+		return resultCodeFinish
+	}
+
+	signed, err := signUpdateResponse(resp, keyName, key, req.IsTsig().MAC)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "signing dynamic update response", slogutil.KeyError, err)
+		resp.Rcode = dns.RcodeServerFailure
+	} else {
+		pctx.Res = signed
+	}
+
+	return resultCodeFinish
+}
+
+// verifyUpdate verifies the TSIG signature of req, which is an update of z.
+// key is nil if the update isn't authorized, in which case rcode is the code
+// of the response.
+func (s *Server) verifyUpdate(
+	ctx context.Context,
+	req *dns.Msg,
+	z *localZone,
+) (name string, key *tsigKey, rcode int) {
+	t := req.IsTsig()
+	if t == nil {
+		s.logger.DebugContext(ctx, "unsigned dynamic update", "zone", z.name)
+
+		return "", nil, dns.RcodeRefused
+	}
+
+	name = strings.ToLower(t.Hdr.Name)
+	key, ok := s.tsigKeys[name]
+	if !ok || !z.updateKeys.Has(name) || !strings.EqualFold(t.Algorithm, key.algorithm) {
+		s.logger.DebugContext(ctx, "unauthorized dynamic update", "zone", z.name, "key", name)
+
+		return "", nil, dns.RcodeNotAuth
+	}
+
+	err := verifyTSIG(req, key.secret)
+	if err != nil {
+		s.logger.DebugContext(
+			ctx,
+			"verifying dynamic update",
+			"zone", z.name,
+			"key", name,
+			slogutil.KeyError, err,
+		)
+
+		return "", nil, dns.RcodeNotAuth
+	}
+
+	return name, key, dns.RcodeSuccess
+}
+
+// verifyTSIG verifies the TSIG signature of req with secret.  Since the
+// original wire format of req isn't available, it's packed again both with and
+// without name compression, which covers the common clients.
+func verifyTSIG(req *dns.Msg, secret string) (err error) {
+	var errs []error
+	for _, compress := range []bool{true, false} {
+		m := req.Copy()
+		m.Compress = compress
+
+		var b []byte
+		b, err = m.Pack()
+		if err != nil {
+			return fmt.Errorf("packing: %w", err)
+		}
+
+		err = dns.TsigVerify(b, secret, "", false)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// signUpdateResponse returns a copy of resp signed with key.  reqMAC is the MAC
+// of the request in the hexadecimal format.
+func signUpdateResponse(
+	resp *dns.Msg,
+	name string,
+	key *tsigKey,
+	reqMAC string,
+) (signed *dns.Msg, err error) {
+	m := resp.Copy()
+	m.SetTsig(name, key.algorithm, tsigFudge, time.Now().Unix())
+
+	b, _, err := dns.TsigGenerate(m, key.secret, reqMAC, false)
+	if err != nil {
+		return nil, fmt.Errorf("generating tsig: %w", err)
+	}
+
+	signed = &dns.Msg{}
+	err = signed.Unpack(b)
+	if err != nil {
+		return nil, fmt.Errorf("unpacking signed response: %w", err)
+	}
+
+	// Keep the packing of the signed part of the message.
+	signed.Compress = resp.Compress
+
+	return signed, nil
+}
+
+// update applies the prerequisites and the updates from req to z and returns
+// the code of the response.  See RFC 2136, section 3.
+func (z *localZone) update(req *dns.Msg) (rcode int) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	rcode = z.checkPrerequisites(req.Answer)
+	if rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	rcode = z.prescanUpdates(req.Ns)
+	if rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	serial := z.soa.Serial
+	changed := false
+	for _, rr := range req.Ns {
+		changed = z.applyUpdate(rr) || changed
+	}
+
+	if changed && z.soa.Serial == serial {
+		z.soa.Serial++
+	}
+
+	return dns.RcodeSuccess
+}
+
+// rrsetKey is the key of a resource record set.
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+// checkPrerequisites returns the code of the response if any of prereqs isn't
+// satisfied by z.  See RFC 2136, section 3.2.  z.mu is expected to be locked.
+func (z *localZone) checkPrerequisites(prereqs []dns.RR) (rcode int) {
+	sets := map[rrsetKey][]dns.RR{}
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		name := strings.ToLower(hdr.Name)
+		switch {
+		case hdr.Ttl != 0:
+			return dns.RcodeFormatError
+		case !dns.IsSubDomain(z.name, name):
+			return dns.RcodeNotZone
+		}
+
+		rcode = z.checkPrerequisite(hdr, name)
+		if rcode != dns.RcodeSuccess {
+			return rcode
+		}
+
+		if hdr.Class == dns.ClassINET {
+			k := rrsetKey{name: name, rtype: hdr.Rrtype}
+			sets[k] = append(sets[k], rr)
+		}
+	}
+
+	for k, set := range sets {
+		if !equalRRsets(z.rrset(k.name, k.rtype), set) {
+			return dns.RcodeNXRrset
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// checkPrerequisite returns the code of the response if the prerequisite with
+// hdr, which has the lowercased name, isn't satisfied by z.  The value
+// dependent prerequisites are checked by the caller.  z.mu is expected to be
+// locked.
+func (z *localZone) checkPrerequisite(hdr *dns.RR_Header, name string) (rcode int) {
+	if hdr.Class == dns.ClassINET {
+		return dns.RcodeSuccess
+	} else if hdr.Rdlength != 0 || (hdr.Class != dns.ClassANY && hdr.Class != dns.ClassNONE) {
+		return dns.RcodeFormatError
+	}
+
+	inUse := len(z.records[name]) > 0
+	if hdr.Rrtype != dns.TypeANY {
+		inUse = len(z.rrset(name, hdr.Rrtype)) > 0
+	}
+
+	switch {
+	case hdr.Class == dns.ClassANY && !inUse && hdr.Rrtype == dns.TypeANY:
+		return dns.RcodeNameError
+	case hdr.Class == dns.ClassANY && !inUse:
+		return dns.RcodeNXRrset
+	case hdr.Class == dns.ClassNONE && inUse && hdr.Rrtype == dns.TypeANY:
+		return dns.RcodeYXDomain
+	case hdr.Class == dns.ClassNONE && inUse:
+		return dns.RcodeYXRrset
+	default:
+		return dns.RcodeSuccess
+	}
+}
+
+// prescanUpdates returns the code of the response if any of updates is
+// invalid.  See RFC 2136, section 3.4.1.3.
+func (z *localZone) prescanUpdates(updates []dns.RR) (rcode int) {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(z.name, strings.ToLower(hdr.Name)) {
+			return dns.RcodeNotZone
+		}
+
+		meta := isMetaType(hdr.Rrtype)
+		switch hdr.Class {
+		case dns.ClassINET:
+			if meta || hdr.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 || meta {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 || meta || hdr.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// isMetaType returns true if t is a type, which can't be used in the updates.
+func isMetaType(t uint16) (ok bool) {
+	switch t {
+	case dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG:
+		return true
+	default:
+		return false
+	}
+}
+
+// applyUpdate applies a single prescanned update to z and returns true if z has
+// been changed.  See RFC 2136, section 3.4.2.  z.mu is expected to be locked.
+func (z *localZone) applyUpdate(rr dns.RR) (changed bool) {
+	hdr := rr.Header()
+	name := strings.ToLower(hdr.Name)
+	switch hdr.Class {
+	case dns.ClassINET:
+		return z.addRR(rr, name)
+	case dns.ClassANY:
+		return z.deleteRRsets(name, hdr.Rrtype)
+	default:
+		return z.deleteRR(rr, name)
+	}
+}
+
+// addRR adds rr with the lowercased name to z, replacing the duplicate, CNAME,
+// and SOA records.  z.mu is expected to be locked.
+func (z *localZone) addRR(rr dns.RR, name string) (changed bool) {
+	rr = dns.Copy(rr)
+	hdr := rr.Header()
+	hdr.Name = name
+
+	rrs := z.records[name]
+	isCNAME := hdr.Rrtype == dns.TypeCNAME
+	for _, zrr := range rrs {
+		if (zrr.Header().Rrtype == dns.TypeCNAME) != isCNAME {
+			// CNAME records can't coexist with the other ones.
+			return false
+		}
+	}
+
+	soa, isSOA := rr.(*dns.SOA)
+	if isSOA && (name != z.name || int32(soa.Serial-z.soa.Serial) <= 0) {
+		// Only accept the SOA records with the greater serial numbers.  See
+		// RFC 1982.
+		return false
+	}
+
+	for i, zrr := range rrs {
+		if zrr.Header().Rrtype != hdr.Rrtype {
+			continue
+		}
+
+		if isSOA || isCNAME || dns.IsDuplicate(zrr, rr) {
+			rrs[i] = rr
+			if isSOA {
+				z.soa = soa
+			}
+
+			return true
+		}
+	}
+
+	z.records[name] = append(rrs, rr)
+
+	return true
+}
+
+// deleteRRsets deletes the resource record sets of type t with the lowercased
+// name from z.  The SOA and NS records of the zone itself are kept.  z.mu is
+// expected to be locked.
+func (z *localZone) deleteRRsets(name string, t uint16) (changed bool) {
+	return z.deleteFunc(name, func(rr dns.RR) (del bool) {
+		rt := rr.Header().Rrtype
+		if name == z.name && (rt == dns.TypeSOA || rt == dns.TypeNS) {
+			return false
+		}
+
+		return t == dns.TypeANY || rt == t
+	})
+}
+
+// deleteRR deletes the record equal to rr with the lowercased name from z.  The
+// SOA record and the last NS record of the zone itself are kept.  z.mu is
+// expected to be locked.
+func (z *localZone) deleteRR(rr dns.RR, name string) (changed bool) {
+	rr = dns.Copy(rr)
+	hdr := rr.Header()
+	hdr.Name = name
+	hdr.Class = dns.ClassINET
+
+	switch {
+	case hdr.Rrtype == dns.TypeSOA:
+		return false
+	case hdr.Rrtype == dns.TypeNS && name == z.name && len(z.rrset(name, dns.TypeNS)) == 1:
+		return false
+	default:
+		return z.deleteFunc(name, func(zrr dns.RR) (del bool) {
+			return dns.IsDuplicate(zrr, rr)
+		})
+	}
+}
+
+// deleteFunc deletes the records with the lowercased name, for which del
+// returns true, from z.  z.mu is expected to be locked.
+func (z *localZone) deleteFunc(name string, del func(rr dns.RR) (ok bool)) (changed bool) {
+	rrs := z.records[name]
+	kept := rrs[:0]
+	for _, rr := range rrs {
+		if !del(rr) {
+			kept = append(kept, rr)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(z.records, name)
+	} else {
+		z.records[name] = kept
+	}
+
+	return len(kept) != len(rrs)
+}
+
+// rrset returns the records of type t with the lowercased name.  z.mu is
+// expected to be locked.
+func (z *localZone) rrset(name string, t uint16) (rrs []dns.RR) {
+	for _, rr := range z.records[name] {
+		if rr.Header().Rrtype == t {
+			rrs = append(rrs, rr)
+		}
+	}
+
+	return rrs
+}
+
+// equalRRsets returns true if a and b contain the same records, regardless of
+// their order, TTLs, and the case of the names.
+func equalRRsets(a, b []dns.RR) (ok bool) {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, rrA := range a {
+		found := false
+		for _, rrB := range b {
+			rrB = dns.Copy(rrB)
+			rrB.Header().Name = rrA.Header().Name
+			if dns.IsDuplicate(rrA, rrB) {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
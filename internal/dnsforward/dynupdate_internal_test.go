@@ -0,0 +1,348 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Common TSIG keys for tests.
+const (
+	testTSIGKeyName    = "update.key."
+	testTSIGSecret     = "c2VjcmV0"
+	testTSIGBadSecret  = "YmFkc2VjcmV0"
+	testTSIGOtherKey   = "other.key."
+	testTSIGOtherValue = "b3RoZXI="
+)
+
+// newTestUpdate returns the update of zone built by f and signed with the key
+// with name and secret, as unpacked from the wire.  If name is empty, the
+// update isn't signed.
+func newTestUpdate(
+	t *testing.T,
+	zone string,
+	name string,
+	secret string,
+	compress bool,
+	f func(m *dns.Msg),
+) (req *dns.Msg) {
+	t.Helper()
+
+	m := (&dns.Msg{}).SetUpdate(zone)
+	m.Compress = compress
+	f(m)
+
+	var b []byte
+	var err error
+	if name == "" {
+		b, err = m.Pack()
+	} else {
+		m.SetTsig(name, dns.HmacSHA256, tsigFudge, time.Now().Unix())
+		b, _, err = dns.TsigGenerate(m, secret, "", false)
+	}
+	require.NoError(t, err)
+
+	req = &dns.Msg{}
+	require.NoError(t, req.Unpack(b))
+
+	return req
+}
+
+// newTestRR returns the resource record parsed from s.
+func newTestRR(t *testing.T, s string) (rr dns.RR) {
+	t.Helper()
+
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+
+	return rr
+}
+
+func TestServer_ProcessDynamicUpdate(t *testing.T) {
+	keys, err := newTSIGKeys([]*TSIGKey{{
+		Name:   testTSIGKeyName,
+		Secret: testTSIGSecret,
+	}, {
+		Name:      testTSIGOtherKey,
+		Algorithm: "hmac-sha256",
+		Secret:    testTSIGOtherValue,
+	}})
+	require.NoError(t, err)
+
+	zones, err := newLocalZones([]*LocalZone{{
+		Name: "home.lan",
+		Records: []string{
+			"@ IN SOA ns.home.lan. admin.home.lan. 1 3600 600 86400 60",
+			"@ IN NS ns.home.lan.",
+			"ns IN A 192.168.0.1",
+		},
+		UpdateKeys: []string{testTSIGKeyName},
+	}}, keys)
+	require.NoError(t, err)
+
+	s := &Server{
+		logger:     testLogger,
+		localZones: zones,
+		tsigKeys:   keys,
+	}
+
+	z := zones[0]
+	lookup := func(t *testing.T, name string, qtype uint16) (ans []dns.RR) {
+		t.Helper()
+
+		resp := &dns.Msg{}
+		z.answer(resp, dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET})
+
+		return resp.Answer
+	}
+
+	testCases := []struct {
+		req       *dns.Msg
+		check     func(t *testing.T)
+		name      string
+		wantRcode int
+		wantRes   bool
+		wantSig   bool
+	}{{
+		req: newTestUpdate(t, "home.lan.", testTSIGKeyName, testTSIGSecret, true, func(m *dns.Msg) {
+			m.Insert([]dns.RR{newTestRR(t, "printer.home.lan. 300 IN A 192.168.0.30")})
+		}),
+		check: func(t *testing.T) {
+			ans := lookup(t, "printer.home.lan.", dns.TypeA)
+			require.Len(t, ans, 1)
+
+			a := testutil.RequireTypeAssert[*dns.A](t, ans[0])
+			assert.Equal(t, net.IP{192, 168, 0, 30}, a.A.To4())
+			assert.Equal(t, uint32(2), z.soa.Serial)
+		},
+		name:      "insert",
+		wantRcode: dns.RcodeSuccess,
+		wantRes:   true,
+		wantSig:   true,
+	}, {
+		req: newTestUpdate(t, "home.lan.", testTSIGKeyName, testTSIGSecret, false, func(m *dns.Msg) {
+			m.Insert([]dns.RR{
+				newTestRR(t, `_acme-challenge.home.lan. 60 IN TXT "token"`),
+			})
+		}),
+		check: func(t *testing.T) {
+			ans := lookup(t, "_acme-challenge.home.lan.", dns.TypeTXT)
+			require.Len(t, ans, 1)
+
+			txt := testutil.RequireTypeAssert[*dns.TXT](t, ans[0])
+			assert.Equal(t, []string{"token"}, txt.Txt)
+		},
+		name:      "insert_uncompressed",
+		wantRcode: dns.RcodeSuccess,
+		wantRes:   true,
+		wantSig:   true,
+	}, {
+		req: newTestUpdate(t, "home.lan.", testTSIGKeyName, testTSIGSecret, true, func(m *dns.Msg) {
+			m.RRsetUsed([]dns.RR{newTestRR(t, "none.home.lan. 0 IN A 192.168.0.1")})
+			m.Insert([]dns.RR{newTestRR(t, "none.home.lan. 300 IN A 192.168.0.40")})
+		}),
+		check: func(t *testing.T) {
+			assert.Empty(t, lookup(t, "none.home.lan.", dns.TypeA))
+		},
+		name:      "prerequisite_nxrrset",
+		wantRcode: dns.RcodeNXRrset,
+		wantRes:   true,
+		wantSig:   true,
+	}, {
+		req: newTestUpdate(t, "home.lan.", testTSIGKeyName, testTSIGSecret, true, func(m *dns.Msg) {
+			m.NameNotUsed([]dns.RR{newTestRR(t, "printer.home.lan. 0 IN A 192.168.0.1")})
+		}),
+		check:     nil,
+		name:      "prerequisite_yxdomain",
+		wantRcode: dns.RcodeYXDomain,
+		wantRes:   true,
+		wantSig:   true,
+	}, {
+		req: newTestUpdate(t, "home.lan.", testTSIGKeyName, testTSIGSecret, true, func(m *dns.Msg) {
+			m.Used([]dns.RR{newTestRR(t, "printer.home.lan. 0 IN A 192.168.0.30")})
+			m.RemoveRRset([]dns.RR{newTestRR(t, "printer.home.lan. 0 IN A 192.168.0.30")})
+		}),
+		check: func(t *testing.T) {
+			assert.Empty(t, lookup(t, "printer.home.lan.", dns.TypeA))
+		},
+		name:      "remove_rrset",
+		wantRcode: dns.RcodeSuccess,
+		wantRes:   true,
+		wantSig:   true,
+	}, {
+		req: newTestUpdate(t, "home.lan.", testTSIGKeyName, testTSIGSecret, true, func(m *dns.Msg) {
+			m.RemoveName([]dns.RR{newTestRR(t, "home.lan. 0 IN A 192.168.0.1")})
+		}),
+		check: func(t *testing.T) {
+			assert.Len(t, lookup(t, "home.lan.", dns.TypeSOA), 1)
+			assert.Len(t, lookup(t, "home.lan.", dns.TypeNS), 1)
+		},
+		name:      "remove_apex",
+		wantRcode: dns.RcodeSuccess,
+		wantRes:   true,
+		wantSig:   true,
+	}, {
+		req: newTestUpdate(t, "home.lan.", testTSIGKeyName, testTSIGSecret, true, func(m *dns.Msg) {
+			m.Insert([]dns.RR{newTestRR(t, "printer.example.com. 300 IN A 192.168.0.30")})
+		}),
+		check:     nil,
+		name:      "not_zone",
+		wantRcode: dns.RcodeNotZone,
+		wantRes:   true,
+		wantSig:   true,
+	}, {
+		req: newTestUpdate(t, "home.lan.", "", "", true, func(m *dns.Msg) {
+			m.Insert([]dns.RR{newTestRR(t, "evil.home.lan. 300 IN A 192.168.0.66")})
+		}),
+		check: func(t *testing.T) {
+			assert.Empty(t, lookup(t, "evil.home.lan.", dns.TypeA))
+		},
+		name:      "unsigned",
+		wantRcode: dns.RcodeRefused,
+		wantRes:   true,
+		wantSig:   false,
+	}, {
+		req: newTestUpdate(t, "home.lan.", testTSIGKeyName, testTSIGBadSecret, true, func(m *dns.Msg) {
+			m.Insert([]dns.RR{newTestRR(t, "evil.home.lan. 300 IN A 192.168.0.66")})
+		}),
+		check: func(t *testing.T) {
+			assert.Empty(t, lookup(t, "evil.home.lan.", dns.TypeA))
+		},
+		name:      "bad_signature",
+		wantRcode: dns.RcodeNotAuth,
+		wantRes:   true,
+		wantSig:   false,
+	}, {
+		req: newTestUpdate(t, "home.lan.", testTSIGOtherKey, testTSIGOtherValue, true, func(m *dns.Msg) {
+			m.Insert([]dns.RR{newTestRR(t, "evil.home.lan. 300 IN A 192.168.0.66")})
+		}),
+		check: func(t *testing.T) {
+			assert.Empty(t, lookup(t, "evil.home.lan.", dns.TypeA))
+		},
+		name:      "key_not_allowed",
+		wantRcode: dns.RcodeNotAuth,
+		wantRes:   true,
+		wantSig:   false,
+	}, {
+		req: newTestUpdate(t, "sub.home.lan.", testTSIGKeyName, testTSIGSecret, true, func(m *dns.Msg) {
+			m.Insert([]dns.RR{newTestRR(t, "a.sub.home.lan. 300 IN A 192.168.0.50")})
+		}),
+		check:     nil,
+		name:      "not_zone_apex",
+		wantRcode: dns.RcodeFormatError,
+		wantRes:   true,
+		wantSig:   false,
+	}, {
+		req: newTestUpdate(t, "example.com.", testTSIGKeyName, testTSIGSecret, true, func(m *dns.Msg) {
+			m.Insert([]dns.RR{newTestRR(t, "www.example.com. 300 IN A 192.168.0.50")})
+		}),
+		check:     nil,
+		name:      "other_zone",
+		wantRcode: dns.RcodeSuccess,
+		wantRes:   false,
+		wantSig:   false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: tc.req,
+				},
+			}
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			rc := s.processDynamicUpdate(ctx, dctx)
+
+			res := dctx.proxyCtx.Res
+			if !tc.wantRes {
+				assert.Equal(t, resultCodeSuccess, rc)
+				assert.Nil(t, res)
+
+				return
+			}
+
+			assert.Equal(t, resultCodeFinish, rc)
+			require.NotNil(t, res)
+			assert.Equal(t, tc.wantRcode, res.Rcode)
+
+			if tc.wantSig {
+				b, pErr := res.Pack()
+				require.NoError(t, pErr)
+
+				vErr := dns.TsigVerify(b, testTSIGSecret, tc.req.IsTsig().MAC, false)
+				assert.NoError(t, vErr)
+			} else {
+				assert.Nil(t, res.IsTsig())
+			}
+
+			if tc.check != nil {
+				tc.check(t)
+			}
+		})
+	}
+}
+
+func TestNewTSIGKeys(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		conf       []*TSIGKey
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		conf: []*TSIGKey{{
+			Name:      "key.example",
+			Algorithm: "hmac-sha512",
+			Secret:    testTSIGSecret,
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "tsig key at index 0: no value",
+		conf:       []*TSIGKey{nil},
+	}, {
+		name:       "bad_algorithm",
+		wantErrMsg: `tsig key at index 0: algorithm: bad enum value: "hmac-md5"`,
+		conf: []*TSIGKey{{
+			Name:      "key.example",
+			Algorithm: "hmac-md5",
+			Secret:    testTSIGSecret,
+		}},
+	}, {
+		name:       "empty_secret",
+		wantErrMsg: "tsig key at index 0: secret: empty value",
+		conf: []*TSIGKey{{
+			Name: "key.example",
+		}},
+	}, {
+		name:       "bad_secret",
+		wantErrMsg: "tsig key at index 0: secret: illegal base64 data at input byte 3",
+		conf: []*TSIGKey{{
+			Name:   "key.example",
+			Secret: "bad!",
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `tsig key at index 1: duplicate name "key.example."`,
+		conf: []*TSIGKey{{
+			Name:   "key.example",
+			Secret: testTSIGSecret,
+		}, {
+			Name:   "KEY.example.",
+			Secret: testTSIGSecret,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newTSIGKeys(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
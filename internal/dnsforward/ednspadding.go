@@ -0,0 +1,132 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// EDNSPaddingConfig is the configuration of the EDNS(0) padding of the queries
+// sent to the encrypted upstreams.  See RFC 7830 and RFC 8467.
+type EDNSPaddingConfig struct {
+	// BlockSize is the block size, to a multiple of which the queries are
+	// padded.  RFC 8467 recommends 128.  It must be positive and not greater
+	// than [dns.MaxMsgSize].
+	BlockSize uint `yaml:"block_size"`
+
+	// Enabled defines if the queries are padded.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if c isn't valid.  A nil or disabled c is valid.
+func (c *EDNSPaddingConfig) validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	switch {
+	case c.BlockSize == 0:
+		return fmt.Errorf("block_size: %w", errors.ErrNotPositive)
+	case c.BlockSize > dns.MaxMsgSize:
+		return fmt.Errorf("block_size: %w: must be at most %d", errors.ErrOutOfRange, dns.MaxMsgSize)
+	default:
+		return nil
+	}
+}
+
+// isEncryptedUpstream returns true if the upstream with addr uses an encrypted
+// transport.  addr is the address returned by [upstream.Upstream.Address].
+func isEncryptedUpstream(addr string) (ok bool) {
+	scheme, _, found := strings.Cut(addr, "://")
+	if !found {
+		return false
+	}
+
+	switch scheme {
+	case "tls", "https", "quic", "h3":
+		return true
+	default:
+		return false
+	}
+}
+
+// padQuery returns a copy of req padded to a multiple of blockSize.  added is
+// true if req has no OPT record, so it has been added to the copy.
+func padQuery(req *dns.Msg, blockSize uint) (padded *dns.Msg, added bool) {
+	padded = req.Copy()
+
+	// Disable the compression, so that the length of the packed message is the
+	// one calculated below.
+	padded.Compress = false
+
+	opt := padded.IsEdns0()
+	if opt == nil {
+		added = true
+		padded.SetEdns0(dns.DefaultMsgSize, false)
+		opt = padded.IsEdns0()
+	} else {
+		removeOption(opt, dns.EDNS0PADDING)
+	}
+
+	// Account for the option code and length of the padding option itself.
+	const optHdrLen = 4
+
+	l := uint(padded.Len() + optHdrLen)
+	padLen := (blockSize - l%blockSize) % blockSize
+	opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, padLen)})
+
+	return padded, added
+}
+
+// paddingUpstream is an upstream, which pads the queries to the wrapped
+// encrypted upstream.
+type paddingUpstream struct {
+	upstream.Upstream
+
+	// blockSize is the block size of the padding.  It must be positive.
+	blockSize uint
+}
+
+// type check
+var _ upstream.Upstream = (*paddingUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *paddingUpstream.
+func (u *paddingUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	padded, added := padQuery(req, u.blockSize)
+
+	resp, err = u.Upstream.Exchange(padded)
+	if err == nil && resp != nil {
+		// Remove the padding, so that it isn't sent to the clients over the
+		// unencrypted transports.
+		stripOption(resp, dns.EDNS0PADDING, added)
+	}
+
+	return resp, err
+}
+
+// padUpstreams wraps the encrypted upstreams of uc to pad the queries according
+// to conf.  conf and uc may be nil.
+func padUpstreams(conf *EDNSPaddingConfig, uc *proxy.UpstreamConfig) (err error) {
+	err = conf.validate()
+	if err != nil {
+		return fmt.Errorf("edns_padding: %w", err)
+	}
+
+	if conf == nil || !conf.Enabled || uc == nil {
+		return nil
+	}
+
+	mapUpstreams(uc, func(u upstream.Upstream) (w upstream.Upstream) {
+		if !isEncryptedUpstream(u.Address()) {
+			return u
+		}
+
+		return &paddingUpstream{Upstream: u, blockSize: conf.BlockSize}
+	})
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPaddingBlockSize is the block size of the padding for tests.
+const testPaddingBlockSize = 128
+
+// paddingLen returns the length of the padding option of msg or -1 if there is
+// none.
+func paddingLen(msg *dns.Msg) (l int) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return -1
+	}
+
+	for _, o := range opt.Option {
+		if p, ok := o.(*dns.EDNS0_PADDING); ok {
+			return len(p.Padding)
+		}
+	}
+
+	return -1
+}
+
+func TestPaddingUpstream_Exchange(t *testing.T) {
+	var gotLen int
+	u := &aghtest.UpstreamMock{
+		OnAddress: func() (addr string) { return "tls://dns.example" },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+			packed, err := req.Pack()
+			require.NoError(t, err)
+
+			gotLen = len(packed)
+
+			resp = (&dns.Msg{}).SetReply(req)
+			resp.Extra = append(resp.Extra, dns.Copy(req.IsEdns0()))
+
+			return resp, nil
+		},
+		OnClose: func() (err error) { return nil },
+	}
+
+	pu := &paddingUpstream{Upstream: u, blockSize: testPaddingBlockSize}
+
+	t.Run("no_opt", func(t *testing.T) {
+		req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+		resp, err := pu.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Zero(t, gotLen%testPaddingBlockSize)
+		assert.Nil(t, req.IsEdns0())
+		assert.Nil(t, resp.IsEdns0())
+	})
+
+	t.Run("opt", func(t *testing.T) {
+		req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+		req.SetEdns0(1232, true)
+		req.IsEdns0().Option = append(req.IsEdns0().Option, &dns.EDNS0_PADDING{
+			Padding: make([]byte, 1),
+		})
+
+		req.Compress = true
+		resp, err := pu.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Zero(t, gotLen%testPaddingBlockSize)
+		assert.Equal(t, 1, paddingLen(req))
+
+		require.NotNil(t, resp.IsEdns0())
+		assert.Equal(t, -1, paddingLen(resp))
+		assert.True(t, resp.IsEdns0().Do())
+	})
+}
+
+func TestPadUpstreams(t *testing.T) {
+	newMock := func(addr string) (u upstream.Upstream) {
+		return &aghtest.UpstreamMock{
+			OnAddress: func() (a string) { return addr },
+		}
+	}
+
+	plain := newMock("1.2.3.4:53")
+	tls := newMock("tls://dns.example")
+	doh := newMock("https://dns.example/dns-query")
+
+	uc := &proxy.UpstreamConfig{
+		Upstreams: []upstream.Upstream{plain, tls, doh},
+		DomainReservedUpstreams: map[string][]upstream.Upstream{
+			"example.org.": {tls},
+		},
+	}
+
+	err := padUpstreams(&EDNSPaddingConfig{
+		BlockSize: testPaddingBlockSize,
+		Enabled:   true,
+	}, uc)
+	require.NoError(t, err)
+
+	require.Len(t, uc.Upstreams, 3)
+	assert.Same(t, plain, uc.Upstreams[0])
+	assert.IsType(t, (*paddingUpstream)(nil), uc.Upstreams[1])
+	assert.IsType(t, (*paddingUpstream)(nil), uc.Upstreams[2])
+	assert.Same(t, uc.Upstreams[1], uc.DomainReservedUpstreams["example.org."][0])
+
+	err = padUpstreams(&EDNSPaddingConfig{Enabled: true}, uc)
+	testutil.AssertErrorMsg(t, "edns_padding: block_size: not positive", err)
+}
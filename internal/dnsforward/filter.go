@@ -17,7 +17,13 @@ import (
 func (s *Server) clientRequestFilteringSettings(dctx *dnsContext) (setts *filtering.Settings) {
 	setts = s.dnsFilter.Settings()
 	setts.ProtectionEnabled = dctx.protectionEnabled
-	s.dnsFilter.ApplyAdditionalFiltering(dctx.proxyCtx.Addr.Addr(), dctx.clientID, setts)
+
+	addr := dctx.proxyCtx.Addr.Addr()
+	s.dnsFilter.ApplyAdditionalFiltering(addr, dctx.clientID, setts)
+	if s.applyClientPause(setts, addr, dctx.clientID) {
+		// Don't filter the responses either.
+		dctx.protectionEnabled = false
+	}
 
 	return setts
 }
@@ -48,9 +54,15 @@ func (s *Server) filterDNSRequest(
 		req.Question[0].Name = dns.Fqdn(res.CanonName)
 	case res.IsFiltered:
 		s.logger.DebugContext(ctx, "host is filtered", "host", host, "reason", res.Reason)
-		pctx.Res = s.genDNSFilterMessage(ctx, pctx, res)
+		pctx.Res = s.genDNSFilterMessage(ctx, pctx, res, dctx.setts)
+	case res.Reason == filtering.Rewritten && res.DNSRewriteResult != nil:
+		// The PTR records synthesized from the rewrites.
+		if err = s.filterDNSRewrite(ctx, req, res, pctx); err != nil {
+			return nil, err
+		}
 	case res.Reason.In(filtering.Rewritten, filtering.FilteredSafeSearch):
 		pctx.Res = s.getCNAMEWithIPs(ctx, req, res.IPList, res.CanonName)
+		setRewriteTTL(pctx.Res.Answer, res.TTL)
 	case res.Reason.In(filtering.RewrittenRule, filtering.RewrittenAutoHosts):
 		if err = s.filterDNSRewrite(ctx, req, res, pctx); err != nil {
 			return nil, err
@@ -60,6 +72,17 @@ func (s *Server) filterDNSRequest(
 	return res, err
 }
 
+// setRewriteTTL sets the TTL of the rewritten answers to ttl, unless it's zero.
+func setRewriteTTL(ans []dns.RR, ttl uint32) {
+	if ttl == 0 {
+		return
+	}
+
+	for _, rr := range ans {
+		rr.Header().Ttl = ttl
+	}
+}
+
 // isRewrittenCNAME returns true if the request considered to be rewritten with
 // CNAME and has no resolved IPs.
 func isRewrittenCNAME(res *filtering.Result) (ok bool) {
@@ -89,6 +112,38 @@ func (s *Server) checkHostRules(
 	return &res, err
 }
 
+// checkCanonicalName checks the canonical name host from the upstream response
+// to the request of qtype in the same way as the requested names.
+func (s *Server) checkCanonicalName(
+	host string,
+	qtype uint16,
+	setts *filtering.Settings,
+) (r *filtering.Result, err error) {
+	// The canonical names of the allowlisted domain names are allowed in the
+	// allowlist-only mode.
+	if setts.AllowlistOnly {
+		cnameSetts := *setts
+		cnameSetts.AllowlistOnly = false
+		setts = &cnameSetts
+	}
+
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	res, err := s.dnsFilter.CheckHost(host, qtype, setts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// isAllowlistedCNAME returns true if the canonical name with res is explicitly
+// allowlisted and the rest of the response shouldn't be inspected.
+func isAllowlistedCNAME(deep bool, rrtype rules.RRType, res *filtering.Result) (ok bool) {
+	return deep && rrtype == dns.TypeCNAME && res.Reason == filtering.NotFilteredAllowList
+}
+
 // filterDNSResponse checks each resource record of answer section of
 // dctx.proxyCtx.Res.  It sets dctx.result and dctx.origResp if at least one of
 // canonical names, IP addresses, or HTTPS RR hints in it matches the filtering
@@ -109,7 +164,11 @@ func (s *Server) filterDNSResponse(ctx context.Context, dctx *dnsContext) (err e
 			host = strings.TrimSuffix(a.Target, ".")
 			rrtype = dns.TypeCNAME
 
-			res, err = s.checkHostRules(host, rrtype, setts)
+			if s.conf.DeepCNAMEInspection {
+				res, err = s.checkCanonicalName(host, pctx.Req.Question[0].Qtype, setts)
+			} else {
+				res, err = s.checkHostRules(host, rrtype, setts)
+			}
 		case *dns.A:
 			host = a.A.String()
 			rrtype = dns.TypeA
@@ -121,7 +180,9 @@ func (s *Server) filterDNSResponse(ctx context.Context, dctx *dnsContext) (err e
 
 			res, err = s.checkHostRules(host, rrtype, setts)
 		case *dns.HTTPS:
-			res, err = s.filterHTTPSRecords(a, setts)
+			res, err = s.filterSVCBRecord(&a.SVCB, setts)
+		case *dns.SVCB:
+			res, err = s.filterSVCBRecord(a, setts)
 		default:
 			continue
 		}
@@ -136,10 +197,17 @@ func (s *Server) filterDNSResponse(ctx context.Context, dctx *dnsContext) (err e
 
 		if err != nil {
 			return fmt.Errorf("filtering answer at index %d: %w", i, err)
-		} else if res != nil && res.IsFiltered {
+		} else if res == nil {
+			continue
+		} else if isAllowlistedCNAME(s.conf.DeepCNAMEInspection, rrtype, res) {
+			s.logger.DebugContext(ctx, "allowlisted by response", "host", host)
+
+			break
+		} else if res.IsFiltered {
+			res.AppendTrace(dctx.result, "response "+dns.Type(a.Header().Rrtype).String())
 			dctx.result = res
 			dctx.origResp = pctx.Res
-			pctx.Res = s.genDNSFilterMessage(ctx, pctx, res)
+			pctx.Res = s.genDNSFilterMessage(ctx, pctx, res, setts)
 
 			s.logger.DebugContext(
 				ctx,
@@ -156,7 +224,7 @@ func (s *Server) filterDNSResponse(ctx context.Context, dctx *dnsContext) (err e
 }
 
 // removeIPv6Hints deletes IPv6 hints from RR values.
-func removeIPv6Hints(rr *dns.HTTPS) {
+func removeIPv6Hints(rr *dns.SVCB) {
 	rr.Value = slices.DeleteFunc(rr.Value, func(kv dns.SVCBKeyValue) (del bool) {
 		_, ok := kv.(*dns.SVCBIPv6Hint)
 
@@ -164,14 +232,16 @@ func removeIPv6Hints(rr *dns.HTTPS) {
 	})
 }
 
-// filterHTTPSRecords filters HTTPS answers information through all rule list
-// filters of the server filters.  Removes IPv6 hints if IPv6 resolving is
-// disabled.
-func (s *Server) filterHTTPSRecords(rr *dns.HTTPS, setts *filtering.Settings) (r *filtering.Result, err error) {
+// filterSVCBRecord filters HTTPS and SVCB answers information through all rule
+// list filters of the server filters.  Removes IPv6 hints if IPv6 resolving is
+// disabled, as well as the parameters set in [Config.StripSVCBParams].
+func (s *Server) filterSVCBRecord(rr *dns.SVCB, setts *filtering.Settings) (r *filtering.Result, err error) {
 	if s.conf.AAAADisabled {
 		removeIPv6Hints(rr)
 	}
 
+	stripSVCBParams(rr, s.svcbStripKeys)
+
 	for _, kv := range rr.Value {
 		var ips []net.IP
 		switch hint := kv.(type) {
@@ -178,6 +178,114 @@ func TestServer_filterDNSResponse(t *testing.T) {
 	}
 }
 
+func TestServer_filterDNSResponse_deepCNAME(t *testing.T) {
+	const (
+		reqFQDN     = "www.example.com."
+		trackerFQDN = "tracker.example."
+		allowedFQDN = "allowed.example."
+		trackerRule = "||tracker.example^$dnstype=A"
+	)
+
+	filters := []filtering.Filter{{
+		ID:   0,
+		Data: []byte(trackerRule + "\n@@||allowed.example^\n"),
+	}}
+
+	f, err := filtering.New(&filtering.Config{
+		Logger: testLogger,
+	}, filters)
+	require.NoError(t, err)
+
+	f.SetEnabled(true)
+
+	s, err := NewServer(DNSCreateParams{
+		DHCPServer:  &testDHCP{},
+		DNSFilter:   f,
+		PrivateNets: netutil.SubnetSetFunc(netutil.IsLocallyServed),
+		Logger:      testLogger,
+	})
+	require.NoError(t, err)
+
+	newCNAME := func(name, target string) (rr dns.RR) {
+		return &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+			},
+			Target: target,
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		wantRule string
+		respAns  []dns.RR
+		deep     bool
+	}{{
+		name:     "shallow",
+		wantRule: "",
+		respAns:  []dns.RR{newCNAME(reqFQDN, trackerFQDN)},
+		deep:     false,
+	}, {
+		name:     "deep",
+		wantRule: trackerRule,
+		respAns:  []dns.RR{newCNAME(reqFQDN, trackerFQDN)},
+		deep:     true,
+	}, {
+		name:     "deep_chain",
+		wantRule: trackerRule,
+		respAns: []dns.RR{
+			newCNAME(reqFQDN, "cdn.example."),
+			newCNAME("cdn.example.", trackerFQDN),
+		},
+		deep: true,
+	}, {
+		name:     "deep_allowlisted",
+		wantRule: "",
+		respAns: []dns.RR{
+			newCNAME(reqFQDN, allowedFQDN),
+			newCNAME(allowedFQDN, trackerFQDN),
+		},
+		deep: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s.conf.DeepCNAMEInspection = tc.deep
+
+			req := createTestMessageWithType(reqFQDN, dns.TypeA)
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Proto: proxy.ProtoUDP,
+					Req:   req,
+					Res:   newResp(dns.RcodeSuccess, req, tc.respAns),
+					Addr:  testClientAddrPort,
+				},
+				setts: &filtering.Settings{
+					ProtectionEnabled: true,
+					FilteringEnabled:  true,
+				},
+			}
+
+			fltErr := s.filterDNSResponse(testutil.ContextWithTimeout(t, testTimeout), dctx)
+			require.NoError(t, fltErr)
+
+			if tc.wantRule == "" {
+				assert.True(t, dctx.result == nil || !dctx.result.IsFiltered)
+
+				return
+			}
+
+			require.NotNil(t, dctx.result)
+			require.Len(t, dctx.result.Rules, 1)
+
+			assert.True(t, dctx.result.IsFiltered)
+			assert.Equal(t, tc.wantRule, dctx.result.Rules[0].Text)
+		})
+	}
+}
+
 // newSVCBHintsAnswer returns a test HTTPS answer RRs with SVCB hints.
 func newSVCBHintsAnswer(target string, hints []dns.SVCBKeyValue) (rrs []dns.RR) {
 	return []dns.RR{&dns.HTTPS{
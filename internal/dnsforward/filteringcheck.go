@@ -0,0 +1,342 @@
+package dnsforward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// filteringDecision is the final decision about a simulated request.
+type filteringDecision string
+
+// Valid filtering decisions.
+const (
+	// filteringDecisionBlocked means that the request is blocked.
+	filteringDecisionBlocked filteringDecision = "blocked"
+
+	// filteringDecisionAllowed means that the request is explicitly allowed by
+	// an allowlist rule and is sent to the upstream servers.
+	filteringDecisionAllowed filteringDecision = "allowed"
+
+	// filteringDecisionRewritten means that the response is replaced by
+	// a rewrite or a safe search result.
+	filteringDecisionRewritten filteringDecision = "rewritten"
+
+	// filteringDecisionLocal means that the request is answered by AdGuard Home
+	// itself, for example from the DHCP leases.
+	filteringDecisionLocal filteringDecision = "answered_locally"
+
+	// filteringDecisionForwarded means that nothing matched the request and it
+	// is sent to the upstream servers.
+	filteringDecisionForwarded filteringDecision = "forwarded"
+)
+
+// Names of the steps of the simulated processing, which are performed before
+// the filtering.
+const (
+	checkStepAccess       = "access"
+	checkStepAAAADisabled = "aaaa disabled"
+	checkStepDHCPHosts    = "dhcp hosts"
+)
+
+// filteringCheckReq is the request of the POST /control/filtering/check HTTP
+// API.
+type filteringCheckReq struct {
+	// Name is the requested domain name.
+	Name string `json:"name"`
+
+	// QType is the type of the request, such as "AAAA".  If empty, "A" is
+	// used.
+	QType string `json:"qtype"`
+
+	// Client is the optional ClientID or IP address of the client.
+	Client string `json:"client"`
+}
+
+// filteringCheckRule is a matched rule for the HTTP API.
+type filteringCheckRule struct {
+	Text string `json:"text"`
+
+	// FilterListName is the name of the filter list, if the list is a
+	// configured one.
+	FilterListName string `json:"filter_list_name,omitempty"`
+
+	FilterListID rulelist.APIID `json:"filter_list_id"`
+}
+
+// filteringCheckStep is a step of the simulated processing for the HTTP API.
+type filteringCheckStep struct {
+	Name   string                `json:"name"`
+	Reason string                `json:"reason"`
+	Rules  []*filteringCheckRule `json:"rules"`
+
+	// Matched is true if the step decided the outcome of the request.  It's
+	// always the last step.
+	Matched bool `json:"matched"`
+}
+
+// filteringCheckResp is the response of the POST /control/filtering/check HTTP
+// API.
+type filteringCheckResp struct {
+	Decision    filteringDecision     `json:"decision"`
+	Reason      string                `json:"reason"`
+	ClientName  string                `json:"client_name,omitempty"`
+	CanonName   string                `json:"cname,omitempty"`
+	ServiceName string                `json:"service_name,omitempty"`
+	IPList      []netip.Addr          `json:"ip_addrs,omitempty"`
+	Rules       []*filteringCheckRule `json:"rules"`
+	Trace       []*filteringCheckStep `json:"trace"`
+
+	// ProtectionEnabled is false if the protection is disabled globally.
+	ProtectionEnabled bool `json:"protection_enabled"`
+
+	// ClientPaused is true if the filtering is temporarily paused for the
+	// client.
+	ClientPaused bool `json:"client_paused"`
+}
+
+// handleFilteringCheck is the handler for the POST /control/filtering/check
+// HTTP API.  It simulates the processing of the request by the access
+// settings, the DHCP hosts, and the filtering for the client without sending
+// it to the upstream servers, so the responses aren't filtered.
+func (s *Server) handleFilteringCheck(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := s.logger
+
+	req := &filteringCheckReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	host := aghnet.NormalizeDomain(req.Name)
+	qtype, err := parseCheckQType(req.QType)
+	if err == nil && host == "" {
+		err = fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	}
+
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return
+	}
+
+	var addr netip.Addr
+	var clientID string
+	if ip, parseErr := netip.ParseAddr(req.Client); parseErr == nil {
+		addr = ip
+	} else {
+		clientID = req.Client
+	}
+
+	resp := &filteringCheckResp{
+		Rules: []*filteringCheckRule{},
+		Trace: []*filteringCheckStep{},
+	}
+	resp.ProtectionEnabled, _ = s.UpdatedProtectionStatus(ctx)
+
+	if s.checkBeforeFiltering(resp, host, qtype, addr, clientID) {
+		aghhttp.WriteJSONResponseOK(ctx, l, w, r, resp)
+
+		return
+	}
+
+	err = s.checkFiltering(resp, host, qtype, addr, clientID)
+	if err != nil {
+		aghhttp.ErrorAndLog(
+			ctx,
+			l,
+			r,
+			w,
+			http.StatusInternalServerError,
+			"checking %q: %s",
+			host,
+			err,
+		)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, resp)
+}
+
+// parseCheckQType parses the DNS type of the simulated request.
+func parseCheckQType(s string) (qtype uint16, err error) {
+	if s == "" {
+		return dns.TypeA, nil
+	}
+
+	qtype, ok := dns.StringToType[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("qtype: %q: %w", s, errors.ErrBadEnumValue)
+	}
+
+	return qtype, nil
+}
+
+// checkBeforeFiltering adds the steps, which are performed before the
+// filtering, to resp.  It returns true if one of them decided the outcome.
+func (s *Server) checkBeforeFiltering(
+	resp *filteringCheckResp,
+	host string,
+	qtype uint16,
+	addr netip.Addr,
+	clientID string,
+) (done bool) {
+	step := &filteringCheckStep{
+		Name:  checkStepAccess,
+		Rules: []*filteringCheckRule{},
+	}
+	resp.Trace = append(resp.Trace, step)
+
+	if blocked, rule := s.IsBlockedClient(addr, clientID); blocked {
+		return resp.finish(step, filteringDecisionBlocked, "blocked client: "+rule)
+	} else if s.access.isBlockedHost(host, qtype) {
+		return resp.finish(step, filteringDecisionBlocked, "blocked host")
+	}
+
+	if s.conf.AAAADisabled && qtype == dns.TypeAAAA {
+		step = &filteringCheckStep{
+			Name:  checkStepAAAADisabled,
+			Rules: []*filteringCheckRule{},
+		}
+		resp.Trace = append(resp.Trace, step)
+
+		return resp.finish(step, filteringDecisionLocal, "empty response to aaaa request")
+	}
+
+	dhcpHost := s.dhcpHostFromRequest(&dns.Question{Name: dns.Fqdn(host), Qtype: qtype})
+	if dhcpHost == "" {
+		return false
+	}
+
+	step = &filteringCheckStep{
+		Name:  checkStepDHCPHosts,
+		Rules: []*filteringCheckRule{},
+	}
+	resp.Trace = append(resp.Trace, step)
+
+	if addr.IsValid() && !s.privateNets.Contains(addr) {
+		return resp.finish(step, filteringDecisionBlocked, "dhcp host requested by public client")
+	}
+
+	ip := s.dhcpServer.IPByHost(dhcpHost)
+	if ip == (netip.Addr{}) {
+		step.Reason = "no dhcp lease"
+
+		return false
+	}
+
+	resp.IPList = []netip.Addr{ip}
+
+	return resp.finish(step, filteringDecisionLocal, "dhcp lease")
+}
+
+// finish marks step as the deciding one and sets the decision and the reason
+// of resp.  It always returns true.
+func (resp *filteringCheckResp) finish(
+	step *filteringCheckStep,
+	decision filteringDecision,
+	reason string,
+) (done bool) {
+	step.Matched = true
+	step.Reason = reason
+	resp.Decision = decision
+	resp.Reason = reason
+
+	return true
+}
+
+// checkFiltering adds the steps of the filtering with the settings of the
+// client to resp and sets the decision.
+func (s *Server) checkFiltering(
+	resp *filteringCheckResp,
+	host string,
+	qtype uint16,
+	addr netip.Addr,
+	clientID string,
+) (err error) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	setts := s.dnsFilter.Settings()
+	setts.ProtectionEnabled = resp.ProtectionEnabled
+	s.dnsFilter.ApplyAdditionalFiltering(addr, clientID, setts)
+	resp.ClientName = setts.ClientName
+	resp.ClientPaused = s.applyClientPause(setts, addr, clientID)
+
+	pref, extErr := netutil.ExtractReversedAddr(host)
+	if qtype == dns.TypePTR && extErr == nil && s.privateNets.Contains(pref.Addr()) {
+		// The requests for the locally served reverse DNS names aren't
+		// filtered by these features.
+		setts.ParentalEnabled = false
+		setts.SafeBrowsingEnabled = false
+		setts.SafeSearchEnabled = false
+		setts.ServicesRules = nil
+	}
+
+	res, steps, err := s.dnsFilter.CheckHostTrace(host, qtype, setts)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	for _, st := range steps {
+		resp.Trace = append(resp.Trace, &filteringCheckStep{
+			Name:    st.Name,
+			Reason:  st.Result.Reason.String(),
+			Rules:   s.checkRules(st.Result.Rules),
+			Matched: st.Result.Reason.Matched(),
+		})
+	}
+
+	resp.Reason = res.Reason.String()
+	resp.Rules = s.checkRules(res.Rules)
+	resp.CanonName = res.CanonName
+	resp.ServiceName = res.ServiceName
+	resp.IPList = res.IPList
+
+	switch {
+	case res.IsFiltered:
+		resp.Decision = filteringDecisionBlocked
+	case res.Reason == filtering.NotFilteredAllowList:
+		resp.Decision = filteringDecisionAllowed
+	case res.Reason.In(
+		filtering.Rewritten,
+		filtering.RewrittenRule,
+		filtering.RewrittenAutoHosts,
+		filtering.FilteredSafeSearch,
+	):
+		resp.Decision = filteringDecisionRewritten
+	default:
+		resp.Decision = filteringDecisionForwarded
+	}
+
+	return nil
+}
+
+// checkRules converts the matched rules for the HTTP API.
+func (s *Server) checkRules(rules []*filtering.ResultRule) (res []*filteringCheckRule) {
+	res = make([]*filteringCheckRule, 0, len(rules))
+	for _, r := range rules {
+		res = append(res, &filteringCheckRule{
+			Text:           r.Text,
+			FilterListName: s.dnsFilter.FilterListName(r.FilterListID),
+			FilterListID:   r.FilterListID,
+		})
+	}
+
+	return res
+}
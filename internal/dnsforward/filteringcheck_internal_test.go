@@ -0,0 +1,132 @@
+package dnsforward
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_handleFilteringCheck(t *testing.T) {
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode:      filtering.BlockingModeDefault,
+		ProtectionEnabled: true,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ClientsContainer: EmptyClientsContainer{},
+			BlockedHosts:     []string{"access.example"},
+		},
+		ServePlainDNS: true,
+	})
+
+	testCases := []struct {
+		name         string
+		req          string
+		wantDecision filteringDecision
+		wantReason   string
+		wantRule     string
+		wantSteps    []string
+	}{{
+		name:         "blocked",
+		req:          `{"name":"nxdomain.example.org","qtype":"A","client":"192.168.0.1"}`,
+		wantDecision: filteringDecisionBlocked,
+		wantReason:   "FilteredBlackList",
+		wantRule:     "||nxdomain.example.org",
+		wantSteps:    []string{checkStepAccess, "rewrites", "hosts container", "filtering"},
+	}, {
+		name:         "allowed",
+		req:          `{"name":"whitelist.example.org","qtype":"aaaa"}`,
+		wantDecision: filteringDecisionAllowed,
+		wantReason:   "NotFilteredWhiteList",
+		wantRule:     "@@||whitelist.example.org^",
+		wantSteps:    []string{checkStepAccess, "rewrites", "hosts container", "filtering"},
+	}, {
+		name:         "access",
+		req:          `{"name":"access.example"}`,
+		wantDecision: filteringDecisionBlocked,
+		wantReason:   "blocked host",
+		wantRule:     "",
+		wantSteps:    []string{checkStepAccess},
+	}, {
+		name:         "forwarded",
+		req:          `{"name":"other.example"}`,
+		wantDecision: filteringDecisionForwarded,
+		wantReason:   "NotFilteredNotFound",
+		wantRule:     "",
+		wantSteps: []string{
+			checkStepAccess,
+			"rewrites",
+			"hosts container",
+			"filtering",
+			"blocked tlds",
+			"blocked services",
+			"threat feeds",
+			"new domains",
+			"dga",
+			"homographs",
+			"safe browsing",
+			"parental",
+			"safe search",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(
+				http.MethodPost,
+				"/control/filtering/check",
+				bytes.NewBufferString(tc.req),
+			)
+			w := httptest.NewRecorder()
+			s.handleFilteringCheck(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			resp := &filteringCheckResp{}
+			err := json.NewDecoder(w.Body).Decode(resp)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantDecision, resp.Decision)
+			assert.Equal(t, tc.wantReason, resp.Reason)
+
+			if tc.wantRule == "" {
+				assert.Empty(t, resp.Rules)
+			} else {
+				require.Len(t, resp.Rules, 1)
+
+				assert.Equal(t, tc.wantRule, resp.Rules[0].Text)
+			}
+
+			steps := make([]string, 0, len(resp.Trace))
+			for _, st := range resp.Trace {
+				steps = append(steps, st.Name)
+			}
+
+			assert.Equal(t, tc.wantSteps, steps)
+			assert.Equal(t, tc.wantDecision != filteringDecisionForwarded, resp.Trace[len(resp.Trace)-1].Matched)
+		})
+	}
+
+	t.Run("bad_qtype", func(t *testing.T) {
+		r := httptest.NewRequest(
+			http.MethodPost,
+			"/control/filtering/check",
+			bytes.NewBufferString(`{"name":"example.org","qtype":"BAD"}`),
+		)
+		w := httptest.NewRecorder()
+		s.handleFilteringCheck(w, r)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, "validating: qtype: \"BAD\": bad enum value\n", w.Body.String())
+	})
+}
@@ -0,0 +1,330 @@
+package dnsforward
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/geoip"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// GeoBlockingAction is the action taken for the responses with the addresses
+// from the matching countries or autonomous systems.
+type GeoBlockingAction string
+
+// Valid geo-blocking actions.
+const (
+	// GeoBlockingActionBlock replaces the response with a blocked one.
+	GeoBlockingActionBlock GeoBlockingAction = "block"
+
+	// GeoBlockingActionFlag only records the match in the query log.
+	GeoBlockingActionFlag GeoBlockingAction = "flag"
+)
+
+// GeoBlockingConfig is the configuration of blocking the upstream responses by
+// the countries and the autonomous systems of their addresses.
+type GeoBlockingConfig struct {
+	// Databases are the paths to the MaxMind DB files with the countries and
+	// the autonomous systems of the addresses, for example the GeoLite2-Country
+	// and GeoLite2-ASN ones.  The first database containing the country or the
+	// autonomous system of an address is used for it.  It must not be empty.
+	Databases []string `yaml:"databases"`
+
+	// Rules are the geo-blocking rules.  See [GeoBlockingRule].
+	Rules []*GeoBlockingRule `yaml:"rules"`
+}
+
+// GeoBlockingRule defines the action for the upstream responses to the
+// particular clients with the addresses from the particular countries or
+// autonomous systems.  For each address, the first matching rule is used.
+type GeoBlockingRule struct {
+	// Countries are the ISO 3166-1 alpha-2 codes of the countries, for example
+	// "US".
+	Countries []string `yaml:"countries"`
+
+	// ASNs are the numbers of the autonomous systems.
+	ASNs []uint32 `yaml:"asns"`
+
+	// ClientTags are the tags of the persistent clients, to which the rule
+	// applies.  If empty, the rule applies to all clients from
+	// [GeoBlockingRule.Subnets].
+	ClientTags []string `yaml:"client_tags"`
+
+	// Subnets are the subnets of the clients, to which the rule applies.  If
+	// empty, the rule applies to all clients with
+	// [GeoBlockingRule.ClientTags].
+	Subnets []netutil.Prefix `yaml:"subnets"`
+
+	// Action is the action for the matching responses.
+	Action GeoBlockingAction `yaml:"action"`
+}
+
+// geoBlockingRule is the compiled version of [GeoBlockingRule].
+type geoBlockingRule struct {
+	// countries are the uppercase codes of the countries.
+	countries []string
+
+	// asns are the numbers of the autonomous systems.
+	asns []uint32
+
+	// tags are the tags of the clients.
+	tags []string
+
+	// subnets are the subnets of the clients.
+	subnets []netip.Prefix
+
+	// action is the action for the matching responses.
+	action GeoBlockingAction
+}
+
+// geoBlocker blocks and flags the upstream responses by the countries and the
+// autonomous systems of their addresses.
+type geoBlocker struct {
+	// dbs are the databases with the countries and the autonomous systems.
+	dbs []*geoip.DB
+
+	// rules are the compiled geo-blocking rules.
+	rules []*geoBlockingRule
+}
+
+// newGeoBlocker validates conf, opens the databases, and returns the geo
+// blocker.  gb is nil if conf is nil or has no rules.
+func newGeoBlocker(conf *GeoBlockingConfig) (gb *geoBlocker, err error) {
+	if conf == nil || len(conf.Rules) == 0 {
+		return nil, nil
+	}
+
+	if len(conf.Databases) == 0 {
+		return nil, fmt.Errorf("databases: %w", errors.ErrEmptyValue)
+	}
+
+	gb = &geoBlocker{}
+	for i, c := range conf.Rules {
+		var r *geoBlockingRule
+		r, err = newGeoBlockingRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("rule at index %d: %w", i, err)
+		}
+
+		gb.rules = append(gb.rules, r)
+	}
+
+	for i, path := range conf.Databases {
+		var db *geoip.DB
+		db, err = geoip.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("database at index %d: %w", i, err)
+		}
+
+		gb.dbs = append(gb.dbs, db)
+	}
+
+	return gb, nil
+}
+
+// newGeoBlockingRule validates c and returns the compiled rule.
+func newGeoBlockingRule(c *GeoBlockingRule) (r *geoBlockingRule, err error) {
+	switch {
+	case c == nil:
+		return nil, errors.ErrNoValue
+	case len(c.Countries) == 0 && len(c.ASNs) == 0:
+		return nil, fmt.Errorf("countries and asns: %w", errors.ErrEmptyValue)
+	case c.Action != GeoBlockingActionBlock && c.Action != GeoBlockingActionFlag:
+		return nil, fmt.Errorf("action: %w: %q", errors.ErrBadEnumValue, c.Action)
+	}
+
+	r = &geoBlockingRule{
+		asns:    slices.Clone(c.ASNs),
+		tags:    slices.Clone(c.ClientTags),
+		subnets: make([]netip.Prefix, 0, len(c.Subnets)),
+		action:  c.Action,
+	}
+
+	for i, code := range c.Countries {
+		if len(code) != 2 {
+			return nil, fmt.Errorf("countries: at index %d: bad country code %q", i, code)
+		}
+
+		r.countries = append(r.countries, strings.ToUpper(code))
+	}
+
+	for _, p := range c.Subnets {
+		r.subnets = append(r.subnets, p.Prefix)
+	}
+
+	return r, nil
+}
+
+// match returns the description of the match of r with info, for example
+// "country US".  desc is empty if r doesn't apply to info.
+func (r *geoBlockingRule) match(info *geoip.Info) (desc string) {
+	switch {
+	case info.Country != "" && slices.Contains(r.countries, info.Country):
+		return "country " + info.Country
+	case info.ASN != 0 && slices.Contains(r.asns, info.ASN):
+		return fmt.Sprintf("asn %d", info.ASN)
+	default:
+		return ""
+	}
+}
+
+// lookup returns the merged information about ip from all databases.  info is
+// nil if ip isn't found in any of them.
+func (gb *geoBlocker) lookup(ip netip.Addr) (info *geoip.Info, err error) {
+	var errs []error
+	for _, db := range gb.dbs {
+		dbInfo, lookupErr := db.Lookup(ip)
+		if lookupErr != nil {
+			errs = append(errs, lookupErr)
+
+			continue
+		} else if dbInfo == nil {
+			continue
+		}
+
+		if info == nil {
+			info = &geoip.Info{}
+		}
+
+		info.Country = cmp.Or(info.Country, dbInfo.Country)
+		info.ASN = cmp.Or(info.ASN, dbInfo.ASN)
+	}
+
+	return info, errors.Join(errs...)
+}
+
+// match returns the match for the addresses in the answer section of resp to
+// the request from the client with the address addr and the filtering settings
+// setts, as well as its description.  A blocking match is preferred to a
+// flagging one.  m is nil if there is no match.
+func (gb *geoBlocker) match(
+	ctx context.Context,
+	logger *slog.Logger,
+	resp *dns.Msg,
+	addr netip.Addr,
+	setts *filtering.Settings,
+) (m *geoip.Match, desc string) {
+	var rules []*geoBlockingRule
+	for _, r := range gb.rules {
+		if clientMatches(r.tags, r.subnets, addr, setts) {
+			rules = append(rules, r)
+		}
+	}
+
+	if len(rules) == 0 {
+		return nil, ""
+	}
+
+	for _, rr := range resp.Answer {
+		var ip netip.Addr
+		switch v := rr.(type) {
+		case *dns.A:
+			ip, _ = netip.AddrFromSlice(v.A.To4())
+		case *dns.AAAA:
+			ip, _ = netip.AddrFromSlice(v.AAAA)
+		default:
+			continue
+		}
+
+		info, err := gb.lookup(ip)
+		if err != nil {
+			logger.DebugContext(ctx, "looking up geo info", "ip", ip, slogutil.KeyError, err)
+		}
+
+		if info == nil {
+			continue
+		}
+
+		var r *geoBlockingRule
+		var ruleDesc string
+		for _, r = range rules {
+			if ruleDesc = r.match(info); ruleDesc != "" {
+				break
+			}
+		}
+
+		if ruleDesc == "" {
+			continue
+		}
+
+		blocked := r.action == GeoBlockingActionBlock
+		if m == nil || blocked {
+			m = &geoip.Match{
+				Addr:    ip.Unmap(),
+				Country: info.Country,
+				ASN:     info.ASN,
+				Blocked: blocked,
+			}
+			desc = ruleDesc
+		}
+
+		if blocked {
+			break
+		}
+	}
+
+	return m, desc
+}
+
+// processGeoBlocking blocks or flags the response received from the upstream
+// servers, if its addresses belong to the countries or the autonomous systems
+// from the geo-blocking rules.
+func (s *Server) processGeoBlocking(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	gb := s.geoBlocker
+	if gb == nil || pctx.Res == nil || !dctx.responseFromUpstream || !dctx.protectionEnabled {
+		return resultCodeSuccess
+	}
+
+	res := dctx.result
+	if res.IsFiltered || res.Reason == filtering.NotFilteredAllowList {
+		return resultCodeSuccess
+	}
+
+	m, desc := gb.match(ctx, s.logger, pctx.Res, pctx.Addr.Addr(), dctx.setts)
+	if m == nil {
+		return resultCodeSuccess
+	}
+
+	s.logger.InfoContext(
+		ctx,
+		"geo match",
+		"host", pctx.Req.Question[0].Name,
+		"ip", m.Addr,
+		"country", m.Country,
+		"asn", m.ASN,
+		"match", desc,
+		"blocked", m.Blocked,
+	)
+
+	if !m.Blocked {
+		res.Geo = m
+
+		return resultCodeSuccess
+	}
+
+	dctx.result = &filtering.Result{
+		Rules: []*filtering.ResultRule{{
+			Text:         "geo blocking: " + desc,
+			FilterListID: rulelist.APIIDGeoBlocking,
+		}},
+		Geo:        m,
+		Reason:     filtering.FilteredBlockList,
+		IsFiltered: true,
+	}
+	dctx.result.AppendTrace(res, "geo blocking")
+	dctx.origResp = pctx.Res
+	pctx.Res = s.genDNSFilterMessage(ctx, pctx, dctx.result, dctx.setts)
+
+	return resultCodeSuccess
+}
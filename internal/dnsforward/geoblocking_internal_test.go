@@ -0,0 +1,203 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/geoip"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_processGeoBlocking(t *testing.T) {
+	// The test database contains 192.0.2.0/24 in the country DE with the ASN
+	// 64500, and 198.51.100.0/24 in the country FR with the ASN 64501.
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeNXDOMAIN,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ClientsContainer: EmptyClientsContainer{},
+			GeoBlocking: &GeoBlockingConfig{
+				Databases: []string{"testdata/geo.mmdb"},
+				Rules: []*GeoBlockingRule{{
+					Countries: []string{"de"},
+					Subnets:   []netutil.Prefix{{Prefix: netip.MustParsePrefix("192.168.0.0/24")}},
+					Action:    GeoBlockingActionBlock,
+				}, {
+					ASNs:   []uint32{64500, 64501},
+					Action: GeoBlockingActionFlag,
+				}},
+			},
+		},
+		ServePlainDNS: true,
+	})
+
+	local := netip.MustParseAddrPort("192.168.0.10:12345")
+	remote := netip.MustParseAddrPort("192.0.2.10:12345")
+
+	testCases := []struct {
+		wantGeo       *geoip.Match
+		name          string
+		ip            net.IP
+		addr          netip.AddrPort
+		wantRcode     int
+		wantFiltered  bool
+		allowlisted   bool
+		protectionOff bool
+	}{{
+		wantGeo: &geoip.Match{
+			Addr:    netip.MustParseAddr("192.0.2.1"),
+			Country: "DE",
+			ASN:     64500,
+			Blocked: true,
+		},
+		name:         "blocked",
+		ip:           net.IP{192, 0, 2, 1},
+		addr:         local,
+		wantRcode:    dns.RcodeNameError,
+		wantFiltered: true,
+	}, {
+		wantGeo: &geoip.Match{
+			Addr:    netip.MustParseAddr("192.0.2.1"),
+			Country: "DE",
+			ASN:     64500,
+		},
+		name:      "flagged_other_client",
+		ip:        net.IP{192, 0, 2, 1},
+		addr:      remote,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		wantGeo: &geoip.Match{
+			Addr:    netip.MustParseAddr("198.51.100.1"),
+			Country: "FR",
+			ASN:     64501,
+		},
+		name:      "flagged_asn",
+		ip:        net.IP{198, 51, 100, 1},
+		addr:      local,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		wantGeo:   nil,
+		name:      "not_found",
+		ip:        net.IP{203, 0, 113, 1},
+		addr:      local,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		wantGeo:     nil,
+		name:        "allowlisted",
+		ip:          net.IP{192, 0, 2, 1},
+		addr:        local,
+		wantRcode:   dns.RcodeSuccess,
+		allowlisted: true,
+	}, {
+		wantGeo:       nil,
+		name:          "protection_disabled",
+		ip:            net.IP{192, 0, 2, 1},
+		addr:          local,
+		wantRcode:     dns.RcodeSuccess,
+		protectionOff: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := (&dns.Msg{}).SetQuestion("www.example.org.", dns.TypeA)
+			resp := (&dns.Msg{}).SetReply(req)
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   req.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    60,
+				},
+				A: tc.ip,
+			}}
+
+			res := &filtering.Result{}
+			if tc.allowlisted {
+				res.Reason = filtering.NotFilteredAllowList
+			}
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:  req,
+					Res:  resp,
+					Addr: tc.addr,
+				},
+				setts:                &filtering.Settings{},
+				result:               res,
+				protectionEnabled:    !tc.protectionOff,
+				responseFromUpstream: true,
+			}
+
+			rc := s.processGeoBlocking(testutil.ContextWithTimeout(t, testTimeout), dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			assert.Equal(t, tc.wantRcode, dctx.proxyCtx.Res.Rcode)
+			assert.Equal(t, tc.wantGeo, dctx.result.Geo)
+			assert.Equal(t, tc.wantFiltered, dctx.result.IsFiltered)
+
+			if tc.wantFiltered {
+				require.Len(t, dctx.result.Rules, 1)
+
+				rule := dctx.result.Rules[0]
+				assert.Equal(t, rulelist.APIIDGeoBlocking, rule.FilterListID)
+				assert.Equal(t, "geo blocking: country DE", rule.Text)
+				assert.Same(t, resp, dctx.origResp)
+			}
+		})
+	}
+}
+
+func TestNewGeoBlocker_errors(t *testing.T) {
+	testCases := []struct {
+		conf       *GeoBlockingConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &GeoBlockingConfig{
+			Rules: []*GeoBlockingRule{{Countries: []string{"US"}, Action: GeoBlockingActionBlock}},
+		},
+		name:       "no_databases",
+		wantErrMsg: "databases: empty value",
+	}, {
+		conf: &GeoBlockingConfig{
+			Databases: []string{"testdata/geo.mmdb"},
+			Rules:     []*GeoBlockingRule{{Action: GeoBlockingActionBlock}},
+		},
+		name:       "no_countries",
+		wantErrMsg: "rule at index 0: countries and asns: empty value",
+	}, {
+		conf: &GeoBlockingConfig{
+			Databases: []string{"testdata/geo.mmdb"},
+			Rules:     []*GeoBlockingRule{{Countries: []string{"USA"}, Action: GeoBlockingActionBlock}},
+		},
+		name:       "bad_country",
+		wantErrMsg: `rule at index 0: countries: at index 0: bad country code "USA"`,
+	}, {
+		conf: &GeoBlockingConfig{
+			Databases: []string{"testdata/geo.mmdb"},
+			Rules:     []*GeoBlockingRule{{ASNs: []uint32{1}, Action: "drop"}},
+		},
+		name:       "bad_action",
+		wantErrMsg: `rule at index 0: action: bad enum value: "drop"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newGeoBlocker(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
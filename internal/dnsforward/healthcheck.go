@@ -0,0 +1,223 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// UpstreamHealthCheckConfig is the configuration of the periodic active probes
+// of the upstreams.
+type UpstreamHealthCheckConfig struct {
+	// QueryName is the domain name requested from the upstreams.  It must be
+	// a valid domain name.
+	QueryName string `yaml:"query_name"`
+
+	// QueryType is the type of the requested records, for example "A".  It
+	// must be a valid DNS record type.
+	QueryType string `yaml:"query_type"`
+
+	// Interval is the interval between the probes.  It must be positive.
+	Interval timeutil.Duration `yaml:"interval"`
+
+	// Enabled defines if the upstreams are probed.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if c isn't valid.  A nil or disabled c is valid.
+func (c *UpstreamHealthCheckConfig) validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval: %w", errors.ErrNotPositive)
+	}
+
+	err = netutil.ValidateDomainName(c.QueryName)
+	if err != nil {
+		return fmt.Errorf("query_name: %w", err)
+	}
+
+	if _, ok := dns.StringToType[strings.ToUpper(c.QueryType)]; !ok {
+		return fmt.Errorf("query_type: %w: %q", errors.ErrBadEnumValue, c.QueryType)
+	}
+
+	return nil
+}
+
+// healthChecker periodically probes the upstreams, marks the failing ones as
+// down in the scoreboard, and logs the changes of their state.
+type healthChecker struct {
+	// logger is used to log the changes of the state of the upstreams.  It
+	// must not be nil.
+	logger *slog.Logger
+
+	// scores is the scoreboard of the upstreams.  It must not be nil.
+	scores *upstreamScores
+
+	// done is closed to stop the checker.  It's nil if the checker isn't
+	// running.
+	done chan struct{}
+
+	// wg waits for the checking goroutine to exit.
+	wg *sync.WaitGroup
+
+	// ups are the probed upstreams.
+	ups []upstream.Upstream
+
+	// qname is the requested domain name in the FQDN form.
+	qname string
+
+	// interval is the interval between the probes.
+	interval time.Duration
+
+	// qtype is the type of the requested records.
+	qtype uint16
+}
+
+// newHealthChecker returns a new health checker for the upstreams of uc or nil
+// if the checks are disabled.  conf must be valid.  l, scores, and uc must not
+// be nil.
+func newHealthChecker(
+	l *slog.Logger,
+	conf *UpstreamHealthCheckConfig,
+	scores *upstreamScores,
+	uc *proxy.UpstreamConfig,
+) (c *healthChecker) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	return &healthChecker{
+		logger:   l,
+		scores:   scores,
+		wg:       &sync.WaitGroup{},
+		ups:      uniqueUpstreams(uc),
+		qname:    dns.Fqdn(conf.QueryName),
+		interval: time.Duration(conf.Interval),
+		qtype:    dns.StringToType[strings.ToUpper(conf.QueryType)],
+	}
+}
+
+// uniqueUpstreams returns all distinct upstreams of uc.
+func uniqueUpstreams(uc *proxy.UpstreamConfig) (ups []upstream.Upstream) {
+	seen := map[upstream.Upstream]struct{}{}
+	add := func(list []upstream.Upstream) {
+		for _, u := range list {
+			if _, ok := seen[u]; !ok {
+				seen[u] = struct{}{}
+				ups = append(ups, u)
+			}
+		}
+	}
+
+	add(uc.Upstreams)
+	for _, list := range uc.DomainReservedUpstreams {
+		add(list)
+	}
+
+	for _, list := range uc.SpecifiedDomainUpstreams {
+		add(list)
+	}
+
+	return ups
+}
+
+// start starts probing the upstreams in a separate goroutine.  c may be nil.
+func (c *healthChecker) start(ctx context.Context) {
+	if c == nil || c.done != nil {
+		return
+	}
+
+	c.done = make(chan struct{})
+	c.wg.Add(1)
+
+	go c.run(context.WithoutCancel(ctx), c.done)
+}
+
+// stop stops probing the upstreams and waits for the probes in progress to
+// finish.  c may be nil.
+func (c *healthChecker) stop() {
+	if c == nil || c.done == nil {
+		return
+	}
+
+	close(c.done)
+	c.wg.Wait()
+	c.done = nil
+}
+
+// run probes the upstreams until done is closed.  It is intended to be used as
+// a goroutine.
+func (c *healthChecker) run(ctx context.Context, done <-chan struct{}) {
+	defer c.wg.Done()
+	defer slogutil.RecoverAndLog(ctx, c.logger)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.probeAll(ctx)
+		}
+	}
+}
+
+// probeAll probes all upstreams simultaneously and waits for the results.
+func (c *healthChecker) probeAll(ctx context.Context) {
+	wg := &sync.WaitGroup{}
+	for _, u := range c.ups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer slogutil.RecoverAndLog(ctx, c.logger)
+
+			c.probe(ctx, u)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// probe sends the check request to u and updates its state.
+func (c *healthChecker) probe(ctx context.Context, u upstream.Upstream) {
+	req := &dns.Msg{}
+	req.SetQuestion(c.qname, c.qtype)
+	req.Id = dns.Id()
+
+	resp, err := u.Exchange(req)
+	if err == nil {
+		switch resp.Rcode {
+		case dns.RcodeServerFailure, dns.RcodeRefused:
+			err = fmt.Errorf("unexpected rcode %s", dns.RcodeToString[resp.Rcode])
+		default:
+			// Go on.
+		}
+	}
+
+	addr := u.Address()
+	if !c.scores.setDown(addr, err != nil) {
+		return
+	}
+
+	if err != nil {
+		c.logger.WarnContext(ctx, "upstream is down", "upstream", addr, slogutil.KeyError, err)
+	} else {
+		c.logger.InfoContext(ctx, "upstream is up", "upstream", addr)
+	}
+}
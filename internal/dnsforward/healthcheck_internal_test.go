@@ -0,0 +1,132 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthChecker_Probe(t *testing.T) {
+	var fail bool
+	var gotQ dns.Question
+	u := &aghtest.UpstreamMock{
+		OnAddress: func() (addr string) { return "test" },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+			gotQ = req.Question[0]
+			if fail {
+				return nil, errors.Error("test error")
+			}
+
+			return (&dns.Msg{}).SetReply(req), nil
+		},
+		OnClose: func() (err error) { return nil },
+	}
+
+	scores := newUpstreamScores(nil, &faketime.Clock{
+		OnNow: func() (now time.Time) { return time.Time{} },
+	})
+
+	c := newHealthChecker(testLogger, &UpstreamHealthCheckConfig{
+		QueryName: "example.com",
+		QueryType: "aaaa",
+		Interval:  timeutil.Duration(time.Minute),
+		Enabled:   true,
+	}, scores, &proxy.UpstreamConfig{
+		Upstreams: []upstream.Upstream{u, u},
+		DomainReservedUpstreams: map[string][]upstream.Upstream{
+			"example.org.": {u},
+		},
+	})
+	require.NotNil(t, c)
+	require.Len(t, c.ups, 1)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	c.probeAll(ctx)
+	assert.Equal(t, "example.com.", gotQ.Name)
+	assert.Equal(t, dns.TypeAAAA, gotQ.Qtype)
+
+	got := scores.toJSON()
+	require.Len(t, got, 1)
+	assert.False(t, got[0].Down)
+
+	fail = true
+	c.probeAll(ctx)
+
+	got = scores.toJSON()
+	require.Len(t, got, 1)
+	assert.True(t, got[0].Down)
+	assert.True(t, got[0].Demoted)
+
+	// The state is unchanged.
+	assert.False(t, scores.setDown("test", true))
+
+	fail = false
+	c.probeAll(ctx)
+
+	got = scores.toJSON()
+	require.Len(t, got, 1)
+	assert.False(t, got[0].Down)
+}
+
+func TestUpstreamHealthCheckConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *UpstreamHealthCheckConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf: &UpstreamHealthCheckConfig{
+			QueryName: "example.com",
+			QueryType: "A",
+			Interval:  timeutil.Duration(time.Minute),
+			Enabled:   true,
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &UpstreamHealthCheckConfig{
+			QueryName: "example.com",
+			QueryType: "A",
+			Enabled:   true,
+		},
+		name:       "no_interval",
+		wantErrMsg: "interval: not positive",
+	}, {
+		conf: &UpstreamHealthCheckConfig{
+			QueryName: "example.com",
+			QueryType: "BAD",
+			Interval:  timeutil.Duration(time.Minute),
+			Enabled:   true,
+		},
+		name:       "bad_type",
+		wantErrMsg: `query_type: bad enum value: "BAD"`,
+	}, {
+		conf: &UpstreamHealthCheckConfig{
+			QueryType: "A",
+			Interval:  timeutil.Duration(time.Minute),
+			Enabled:   true,
+		},
+		name:       "no_name",
+		wantErrMsg: `query_name: bad domain name "": domain name is empty`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/netip"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
@@ -64,6 +65,10 @@ type jsonDNSConfig struct {
 	// RatelimitWhitelist is a list of IP addresses excluded from rate limiting.
 	RatelimitWhitelist *[]netip.Addr `json:"ratelimit_whitelist"`
 
+	// RatelimitBurst is the number of requests a client can send at once in
+	// addition to the rate limit.
+	RatelimitBurst *uint32 `json:"ratelimit_burst"`
+
 	// BlockingMode defines the way blocked responses are constructed.
 	BlockingMode *filtering.BlockingMode `json:"blocking_mode"`
 
@@ -94,6 +99,16 @@ type jsonDNSConfig struct {
 	// CacheMaxTTL is custom maximum TTL for cached DNS responses.
 	CacheMaxTTL *uint32 `json:"cache_ttl_max"`
 
+	// CacheNegativeMinTTL is the minimum TTL of the negative responses.
+	CacheNegativeMinTTL *uint32 `json:"cache_negative_ttl_min"`
+
+	// CacheNegativeMaxTTL is the maximum TTL of the negative responses.
+	CacheNegativeMaxTTL *uint32 `json:"cache_negative_ttl_max"`
+
+	// CacheNegativeDisabled defines if the negative responses must not be
+	// cached.
+	CacheNegativeDisabled *bool `json:"cache_negative_disabled"`
+
 	// CacheEnabled defines if the DNS cache should be used.
 	CacheEnabled *bool `json:"cache_enabled"`
 
@@ -140,6 +155,9 @@ const (
 	jsonUpstreamModeLoadBalance jsonUpstreamMode = "load_balance"
 	jsonUpstreamModeParallel    jsonUpstreamMode = "parallel"
 	jsonUpstreamModeFastestAddr jsonUpstreamMode = "fastest_addr"
+	jsonUpstreamModeWeighted    jsonUpstreamMode = "weighted"
+	jsonUpstreamModeLatency     jsonUpstreamMode = "latency"
+	jsonUpstreamModeFailover    jsonUpstreamMode = "failover"
 )
 
 func (s *Server) getDNSConfig(ctx context.Context) (c *jsonDNSConfig) {
@@ -158,6 +176,7 @@ func (s *Server) getDNSConfig(ctx context.Context) (c *jsonDNSConfig) {
 	ratelimitSubnetLenIPv4 := s.conf.RatelimitSubnetLenIPv4
 	ratelimitSubnetLenIPv6 := s.conf.RatelimitSubnetLenIPv6
 	ratelimitWhitelist := append([]netip.Addr{}, s.conf.RatelimitWhitelist...)
+	ratelimitBurst := s.conf.RatelimitBurst
 	upstreamTimeout := int(s.conf.UpstreamTimeout.Seconds())
 
 	customIP := s.conf.EDNSClientSubnet.CustomIP
@@ -170,6 +189,9 @@ func (s *Server) getDNSConfig(ctx context.Context) (c *jsonDNSConfig) {
 	cacheSize := s.conf.CacheSize
 	cacheMinTTL := s.conf.CacheMinTTL
 	cacheMaxTTL := s.conf.CacheMaxTTL
+	cacheNegativeMinTTL := s.conf.CacheNegativeMinTTL
+	cacheNegativeMaxTTL := s.conf.CacheNegativeMaxTTL
+	cacheNegativeDisabled := s.conf.CacheNegativeDisabled
 	cacheOptimistic := s.conf.CacheOptimistic
 	resolveClients := s.conf.AddrProcConf.UseRDNS
 	usePrivateRDNS := s.conf.UsePrivateRDNS
@@ -185,6 +207,12 @@ func (s *Server) getDNSConfig(ctx context.Context) (c *jsonDNSConfig) {
 		upstreamMode = jsonUpstreamModeParallel
 	case UpstreamModeFastestAddr:
 		upstreamMode = jsonUpstreamModeFastestAddr
+	case UpstreamModeWeighted:
+		upstreamMode = jsonUpstreamModeWeighted
+	case UpstreamModeLatency:
+		upstreamMode = jsonUpstreamModeLatency
+	case UpstreamModeFailover:
+		upstreamMode = jsonUpstreamModeFailover
 	}
 
 	defPTRUps, err := s.defaultLocalPTRUpstreams(ctx)
@@ -205,6 +233,7 @@ func (s *Server) getDNSConfig(ctx context.Context) (c *jsonDNSConfig) {
 		RatelimitSubnetLenIPv4:   &ratelimitSubnetLenIPv4,
 		RatelimitSubnetLenIPv6:   &ratelimitSubnetLenIPv6,
 		RatelimitWhitelist:       &ratelimitWhitelist,
+		RatelimitBurst:           &ratelimitBurst,
 		UpstreamTimeout:          &upstreamTimeout,
 		EDNSCSCustomIP:           customIP,
 		EDNSCSEnabled:            &enableEDNSClientSubnet,
@@ -216,6 +245,9 @@ func (s *Server) getDNSConfig(ctx context.Context) (c *jsonDNSConfig) {
 		CacheSize:                &cacheSize,
 		CacheMinTTL:              &cacheMinTTL,
 		CacheMaxTTL:              &cacheMaxTTL,
+		CacheNegativeMinTTL:      &cacheNegativeMinTTL,
+		CacheNegativeMaxTTL:      &cacheNegativeMaxTTL,
+		CacheNegativeDisabled:    &cacheNegativeDisabled,
 		CacheOptimistic:          &cacheOptimistic,
 		UpstreamMode:             &upstreamMode,
 		ResolveClients:           &resolveClients,
@@ -272,7 +304,10 @@ func (req *jsonDNSConfig) checkUpstreamMode() (err error) {
 		jsonUpstreamModeEmpty,
 		jsonUpstreamModeLoadBalance,
 		jsonUpstreamModeParallel,
-		jsonUpstreamModeFastestAddr:
+		jsonUpstreamModeFastestAddr,
+		jsonUpstreamModeWeighted,
+		jsonUpstreamModeLatency,
+		jsonUpstreamModeFailover:
 		return nil
 	default:
 		return fmt.Errorf("upstream_mode: incorrect value %q", um)
@@ -453,20 +488,25 @@ func (req *jsonDNSConfig) validateCacheSettings(curCacheSize uint32) (err error)
 		return err
 	}
 
-	if req.CacheMinTTL == nil && req.CacheMaxTTL == nil {
-		return nil
+	err = validateCacheTTL(ptrValOrZero(req.CacheMinTTL), ptrValOrZero(req.CacheMaxTTL))
+	if err != nil {
+		// Don't wrap the error because it's informative enough as is.
+		return err
 	}
 
-	var minTTL, maxTTL uint32
-	if req.CacheMinTTL != nil {
-		minTTL = *req.CacheMinTTL
-	}
+	return validateNegativeCacheTTL(
+		ptrValOrZero(req.CacheNegativeMinTTL),
+		ptrValOrZero(req.CacheNegativeMaxTTL),
+	)
+}
 
-	if req.CacheMaxTTL != nil {
-		maxTTL = *req.CacheMaxTTL
+// ptrValOrZero returns the value pointed to by p or zero if p is nil.
+func ptrValOrZero[T any](p *T) (v T) {
+	if p != nil {
+		return *p
 	}
 
-	return validateCacheTTL(minTTL, maxTTL)
+	return v
 }
 
 // validateCacheSize returns an error if the cache size configuration is
@@ -601,8 +641,13 @@ func (s *Server) setConfig(dc *jsonDNSConfig) (shouldRestart bool) {
 		s.dnsFilter.SetProtectionEnabled(*dc.ProtectionEnabled)
 	}
 
+	// The upstream selectors are created along with the upstream
+	// configuration, so switching the mode requires a restart.
+	var modeChanged bool
 	if dc.UpstreamMode != nil {
-		s.conf.UpstreamMode = mustParseUpstreamMode(*dc.UpstreamMode)
+		um := mustParseUpstreamMode(*dc.UpstreamMode)
+		modeChanged = um != s.conf.UpstreamMode
+		s.conf.UpstreamMode = um
 	}
 
 	if dc.EDNSCSUseCustom != nil && *dc.EDNSCSUseCustom {
@@ -612,7 +657,7 @@ func (s *Server) setConfig(dc *jsonDNSConfig) (shouldRestart bool) {
 	setIfNotNil(&s.conf.EnableDNSSEC, dc.DNSSECEnabled)
 	setIfNotNil(&s.conf.AAAADisabled, dc.DisableIPv6)
 
-	return s.setConfigRestartable(dc)
+	return s.setConfigRestartable(dc) || modeChanged
 }
 
 // mustParseUpstreamMode returns an upstream mode parsed from jsonUpstreamMode.
@@ -625,6 +670,12 @@ func mustParseUpstreamMode(mode jsonUpstreamMode) (um UpstreamMode) {
 		return UpstreamModeParallel
 	case jsonUpstreamModeFastestAddr:
 		return UpstreamModeFastestAddr
+	case jsonUpstreamModeWeighted:
+		return UpstreamModeWeighted
+	case jsonUpstreamModeLatency:
+		return UpstreamModeLatency
+	case jsonUpstreamModeFailover:
+		return UpstreamModeFailover
 	default:
 		// Should never happen, since the value should be validated.
 		panic(fmt.Errorf("unexpected upstream mode: %q", mode))
@@ -662,12 +713,16 @@ func (s *Server) setConfigRestartable(dc *jsonDNSConfig) (shouldRestart bool) {
 		setIfNotNil(&s.conf.CacheSize, dc.CacheSize),
 		setIfNotNil(&s.conf.CacheMinTTL, dc.CacheMinTTL),
 		setIfNotNil(&s.conf.CacheMaxTTL, dc.CacheMaxTTL),
+		setIfNotNil(&s.conf.CacheNegativeMinTTL, dc.CacheNegativeMinTTL),
+		setIfNotNil(&s.conf.CacheNegativeMaxTTL, dc.CacheNegativeMaxTTL),
+		setIfNotNil(&s.conf.CacheNegativeDisabled, dc.CacheNegativeDisabled),
 		setIfNotNil(&s.conf.CacheOptimistic, dc.CacheOptimistic),
 		setIfNotNil(&s.conf.AddrProcConf.UseRDNS, dc.ResolveClients),
 		setIfNotNil(&s.conf.UsePrivateRDNS, dc.UsePrivateRDNS),
 		setIfNotNil(&s.conf.RatelimitSubnetLenIPv4, dc.RatelimitSubnetLenIPv4),
 		setIfNotNil(&s.conf.RatelimitSubnetLenIPv6, dc.RatelimitSubnetLenIPv6),
 		setIfNotNil(&s.conf.RatelimitWhitelist, dc.RatelimitWhitelist),
+		setIfNotNil(&s.conf.RatelimitBurst, dc.RatelimitBurst),
 	} {
 		shouldRestart = shouldRestart || hasSet
 		if shouldRestart {
@@ -863,13 +918,40 @@ func (s *Server) registerHandlers() {
 	s.conf.HTTPReg.Register(http.MethodGet, "/control/dns_info", s.handleGetConfig)
 	s.conf.HTTPReg.Register(http.MethodPost, "/control/dns_config", s.handleSetConfig)
 	s.conf.HTTPReg.Register(http.MethodPost, "/control/test_upstream_dns", s.handleTestUpstreamDNS)
+	s.conf.HTTPReg.Register(http.MethodGet, "/control/upstreams/scores", s.handleUpstreamScores)
+	s.conf.HTTPReg.Register(
+		http.MethodGet,
+		"/control/upstreams/connections",
+		s.handleUpstreamConnections,
+	)
+	s.conf.HTTPReg.Register(http.MethodGet, "/control/ratelimit/status", s.handleRatelimitStatus)
 	s.conf.HTTPReg.Register(http.MethodPost, "/control/protection", s.handleSetProtection)
+	s.conf.HTTPReg.Register(http.MethodPost, "/control/clients/pause", s.handleClientPause)
+	s.conf.HTTPReg.Register(http.MethodGet, "/control/clients/quotas", s.handleClientQuotas)
+	s.conf.HTTPReg.Register(http.MethodPost, "/control/clients/resume", s.handleClientResume)
+	s.conf.HTTPReg.Register(
+		http.MethodGet,
+		"/control/clients/learning",
+		s.handleAllowlistLearningList,
+	)
+	s.conf.HTTPReg.Register(
+		http.MethodPost,
+		"/control/clients/learning/start",
+		s.handleAllowlistLearningStart,
+	)
+	s.conf.HTTPReg.Register(
+		http.MethodPost,
+		"/control/clients/learning/stop",
+		s.handleAllowlistLearningStop,
+	)
 
 	s.conf.HTTPReg.Register(http.MethodGet, "/control/access/list", s.handleAccessList)
 	s.conf.HTTPReg.Register(http.MethodPost, "/control/access/set", s.handleAccessSet)
 
 	s.conf.HTTPReg.Register(http.MethodPost, "/control/cache_clear", s.handleCacheClear)
 
+	s.conf.HTTPReg.Register(http.MethodPost, "/control/filtering/check", s.handleFilteringCheck)
+
 	// Register both versions, with and without the trailing slash, to
 	// prevent a 301 Moved Permanently redirect when clients request the
 	// path without the trailing slash.  Those redirects break some clients.
@@ -880,5 +962,11 @@ func (s *Server) registerHandlers() {
 	s.conf.HTTPReg.Register("", "/dns-query", s.handleDoH)
 	s.conf.HTTPReg.Register("", "/dns-query/", s.handleDoH)
 
+	for _, p := range s.conf.DoHPaths {
+		p = "/" + strings.TrimPrefix(p, "/")
+		s.conf.HTTPReg.Register("", p, s.handleDoH)
+		s.conf.HTTPReg.Register("", p+"/", s.handleDoH)
+	}
+
 	webRegistered = true
 }
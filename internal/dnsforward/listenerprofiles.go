@@ -0,0 +1,203 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/stringutil"
+)
+
+// ListenerProfile is the filtering profile of the additional plain DNS
+// listeners.  The listeners listen on the same addresses as the main plain DNS
+// ones, but on a different port.
+type ListenerProfile struct {
+	// Name is the name of the profile.  It must not be empty and must be
+	// unique.
+	Name string `yaml:"name"`
+
+	// UpstreamDNS, if not empty, are the upstreams for the requests received
+	// by the listeners of the profile instead of the general and the
+	// client-specific ones.
+	UpstreamDNS []string `yaml:"upstream_dns"`
+
+	// Port is the port of the listeners.  It must be positive, unique, and
+	// differ from the ports of the main plain DNS listeners.
+	Port uint16 `yaml:"port"`
+
+	// FilteringEnabled defines if the requests received by the listeners of
+	// the profile are filtered.
+	FilteringEnabled bool `yaml:"filtering_enabled"`
+}
+
+// listenerProfile is the compiled version of [ListenerProfile].
+type listenerProfile struct {
+	// upstreams are the upstreams of the profile.  It's nil if the profile
+	// uses the general upstreams.
+	upstreams *proxy.CustomUpstreamConfig
+
+	// name is the name of the profile.
+	name string
+
+	// filteringEnabled defines if the requests are filtered.
+	filteringEnabled bool
+}
+
+// newListenerProfiles validates conf and returns the compiled profiles by
+// their ports.  mainPorts are the ports of the main plain DNS listeners.  opts
+// are used to create the upstreams of the profiles.
+func (s *Server) newListenerProfiles(
+	ctx context.Context,
+	conf []*ListenerProfile,
+	mainPorts *container.MapSet[uint16],
+	opts *upstream.Options,
+) (profiles map[uint16]*listenerProfile, err error) {
+	if len(conf) == 0 {
+		return nil, nil
+	}
+
+	profiles = make(map[uint16]*listenerProfile, len(conf))
+	names := container.NewMapSet[string]()
+	for i, c := range conf {
+		err = validateListenerProfile(c, names, mainPorts, profiles)
+		if err != nil {
+			s.closeListenerProfiles(ctx, profiles)
+
+			return nil, fmt.Errorf("profile at index %d: %w", i, err)
+		}
+
+		p := &listenerProfile{
+			name:             c.Name,
+			filteringEnabled: c.FilteringEnabled,
+		}
+
+		p.upstreams, err = s.newProfileUpstreams(c.UpstreamDNS, opts)
+		if err != nil {
+			s.closeListenerProfiles(ctx, profiles)
+
+			return nil, fmt.Errorf("profile at index %d: upstream_dns: %w", i, err)
+		}
+
+		names.Add(c.Name)
+		profiles[c.Port] = p
+	}
+
+	return profiles, nil
+}
+
+// validateListenerProfile returns an error if c is invalid.  names and
+// profiles are the names and the ports of the previous profiles.
+func validateListenerProfile(
+	c *ListenerProfile,
+	names *container.MapSet[string],
+	mainPorts *container.MapSet[uint16],
+	profiles map[uint16]*listenerProfile,
+) (err error) {
+	switch {
+	case c == nil:
+		return errors.ErrNoValue
+	case c.Name == "":
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case names.Has(c.Name):
+		return fmt.Errorf("name: %q: %w", c.Name, errors.ErrDuplicated)
+	case c.Port == 0:
+		return fmt.Errorf("port: %w", errors.ErrNotPositive)
+	case mainPorts.Has(c.Port):
+		return fmt.Errorf("port: %d: used by the main listeners", c.Port)
+	}
+
+	if _, ok := profiles[c.Port]; ok {
+		return fmt.Errorf("port: %d: %w", c.Port, errors.ErrDuplicated)
+	}
+
+	return nil
+}
+
+// newProfileUpstreams returns the upstreams of a listener profile.  It returns
+// nil if upstreams contain no upstream addresses.
+func (s *Server) newProfileUpstreams(
+	upstreams []string,
+	opts *upstream.Options,
+) (conf *proxy.CustomUpstreamConfig, err error) {
+	upstreams = stringutil.FilterOut(upstreams, aghnet.IsCommentOrEmpty)
+	if len(upstreams) == 0 {
+		return nil, nil
+	}
+
+	uc, err := proxy.ParseUpstreamsConfig(upstreams, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return proxy.NewCustomUpstreamConfig(
+		uc,
+		s.conf.CacheEnabled,
+		int(s.conf.CacheSize),
+		s.conf.EDNSClientSubnet.Enabled,
+	), nil
+}
+
+// closeListenerProfiles closes the upstreams of profiles.
+func (s *Server) closeListenerProfiles(ctx context.Context, profiles map[uint16]*listenerProfile) {
+	for _, p := range profiles {
+		if p.upstreams != nil {
+			logCloserErr(ctx, p.upstreams, "closing profile upstreams", s.logger.With(
+				"profile", p.name,
+			))
+		}
+	}
+}
+
+// mainPlainPorts returns the ports of the main plain DNS listeners.
+func (conf *ServerConfig) mainPlainPorts() (ports *container.MapSet[uint16]) {
+	ports = container.NewMapSet[uint16]()
+	for _, laddr := range conf.UDPListenAddrs {
+		ports.Add(uint16(laddr.Port))
+	}
+
+	for _, laddr := range conf.TCPListenAddrs {
+		ports.Add(uint16(laddr.Port))
+	}
+
+	return ports
+}
+
+// profileListenAddrs returns the addresses of the listeners of the profiles,
+// which are the addresses of the main plain DNS listeners with the ports of
+// the profiles.
+func (conf *ServerConfig) profileListenAddrs() (udp []*net.UDPAddr, tcp []*net.TCPAddr) {
+	for _, p := range conf.ListenerProfiles {
+		port := int(p.Port)
+		for _, laddr := range conf.UDPListenAddrs {
+			udp = append(udp, &net.UDPAddr{IP: laddr.IP, Port: port, Zone: laddr.Zone})
+		}
+
+		for _, laddr := range conf.TCPListenAddrs {
+			tcp = append(tcp, &net.TCPAddr{IP: laddr.IP, Port: port, Zone: laddr.Zone})
+		}
+	}
+
+	return udp, tcp
+}
+
+// listenerProfile returns the profile of the listener, which has received the
+// request.  It returns nil if the request has been received by the main
+// listeners.
+func (s *Server) listenerProfile(pctx *proxy.DNSContext) (p *listenerProfile) {
+	if len(s.listenerProfiles) == 0 || pctx.Conn == nil {
+		return nil
+	}
+
+	switch pctx.Proto {
+	case proxy.ProtoUDP, proxy.ProtoTCP:
+		return s.listenerProfiles[netutil.NetAddrToAddrPort(pctx.Conn.LocalAddr()).Port()]
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/testutil/fakenet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_NewListenerProfiles(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		conf       []*ListenerProfile
+	}{{
+		name:       "empty",
+		wantErrMsg: "",
+		conf:       nil,
+	}, {
+		name:       "valid",
+		wantErrMsg: "",
+		conf: []*ListenerProfile{{
+			Name: "unfiltered",
+			Port: 5353,
+		}, {
+			Name:             "custom",
+			UpstreamDNS:      []string{"# comment", "192.0.2.1:53"},
+			Port:             5354,
+			FilteringEnabled: true,
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "profile at index 0: no value",
+		conf:       []*ListenerProfile{nil},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "profile at index 0: name: empty value",
+		conf:       []*ListenerProfile{{Port: 5353}},
+	}, {
+		name:       "duplicate_name",
+		wantErrMsg: `profile at index 1: name: "p": duplicated value`,
+		conf: []*ListenerProfile{{
+			Name: "p",
+			Port: 5353,
+		}, {
+			Name: "p",
+			Port: 5354,
+		}},
+	}, {
+		name:       "no_port",
+		wantErrMsg: "profile at index 0: port: not positive",
+		conf:       []*ListenerProfile{{Name: "p"}},
+	}, {
+		name:       "main_port",
+		wantErrMsg: "profile at index 0: port: 53: used by the main listeners",
+		conf: []*ListenerProfile{{
+			Name: "p",
+			Port: 53,
+		}},
+	}, {
+		name:       "duplicate_port",
+		wantErrMsg: "profile at index 1: port: 5353: duplicated value",
+		conf: []*ListenerProfile{{
+			Name: "p1",
+			Port: 5353,
+		}, {
+			Name: "p2",
+			Port: 5353,
+		}},
+	}, {
+		name: "bad_upstream",
+		wantErrMsg: "profile at index 0: upstream_dns: parsing error at index 0: " +
+			"cannot prepare the upstream: unsupported url scheme: bad",
+		conf: []*ListenerProfile{{
+			Name:        "p",
+			UpstreamDNS: []string{"bad://192.0.2.1"},
+			Port:        5353,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				logger: testLogger,
+				conf: ServerConfig{
+					UDPListenAddrs: defaultUDPListenAddrs,
+					TCPListenAddrs: defaultTCPListenAddrs,
+					Config: Config{
+						EDNSClientSubnet: &EDNSClientSubnet{},
+					},
+				},
+			}
+
+			profiles, err := s.newListenerProfiles(
+				testutil.ContextWithTimeout(t, testTimeout),
+				tc.conf,
+				s.conf.mainPlainPorts(),
+				&upstream.Options{Timeout: testTimeout},
+			)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if err != nil {
+				return
+			}
+
+			s.closeListenerProfiles(testutil.ContextWithTimeout(t, testTimeout), profiles)
+			assert.Len(t, profiles, len(tc.conf))
+		})
+	}
+}
+
+func TestServer_ListenerProfile(t *testing.T) {
+	p := &listenerProfile{name: "unfiltered"}
+	s := &Server{
+		listenerProfiles: map[uint16]*listenerProfile{5353: p},
+	}
+
+	newConn := func(port int) (c net.Conn) {
+		return &fakenet.Conn{
+			OnLocalAddr: func() (laddr net.Addr) {
+				return &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: port}
+			},
+		}
+	}
+
+	testCases := []struct {
+		conn  net.Conn
+		want  *listenerProfile
+		name  string
+		proto proxy.Proto
+	}{{
+		conn:  newConn(5353),
+		want:  p,
+		name:  "udp_profile",
+		proto: proxy.ProtoUDP,
+	}, {
+		conn:  newConn(5353),
+		want:  p,
+		name:  "tcp_profile",
+		proto: proxy.ProtoTCP,
+	}, {
+		conn:  newConn(53),
+		want:  nil,
+		name:  "main",
+		proto: proxy.ProtoUDP,
+	}, {
+		conn:  newConn(5353),
+		want:  nil,
+		name:  "tls",
+		proto: proxy.ProtoTLS,
+	}, {
+		conn:  nil,
+		want:  nil,
+		name:  "no_conn",
+		proto: proxy.ProtoHTTPS,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Conn:  tc.conn,
+				Proto: tc.proto,
+			}
+
+			assert.Same(t, tc.want, s.listenerProfile(pctx))
+		})
+	}
+}
+
+func TestServerConfig_ProfileListenAddrs(t *testing.T) {
+	conf := &ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{IP: net.IP{127, 0, 0, 1}, Port: 53}},
+		TCPListenAddrs: []*net.TCPAddr{{IP: net.IP{127, 0, 0, 1}, Port: 53}},
+		Config: Config{
+			ListenerProfiles: []*ListenerProfile{{
+				Name: "p",
+				Port: 5353,
+			}},
+		},
+	}
+
+	udp, tcp := conf.profileListenAddrs()
+	require.Len(t, udp, 1)
+	require.Len(t, tcp, 1)
+
+	assert.Equal(t, "127.0.0.1:5353", udp[0].String())
+	assert.Equal(t, "127.0.0.1:5353", tcp[0].String())
+	assert.Equal(t, 53, conf.UDPListenAddrs[0].Port)
+}
@@ -0,0 +1,246 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// ListenerConfig is the configuration of the DNS listeners of a protocol.
+type ListenerConfig struct {
+	// Ratelimit, if not nil, overrides [Config.Ratelimit] for the listeners.
+	// Unlike the general rate limit, it applies to any protocol and not only
+	// to plain DNS over UDP.  Zero disables the rate limiting.
+	Ratelimit *uint32 `yaml:"ratelimit"`
+
+	// AllowedNetworks, if not empty, are the only subnets, the clients from
+	// which may use the listeners.
+	AllowedNetworks []netutil.Prefix `yaml:"allowed_networks"`
+}
+
+// listenerProtos are the protocols, for which the listeners can be configured.
+var listenerProtos = []proxy.Proto{
+	proxy.ProtoUDP,
+	proxy.ProtoTCP,
+	proxy.ProtoTLS,
+	proxy.ProtoHTTPS,
+	proxy.ProtoQUIC,
+	proxy.ProtoDNSCrypt,
+}
+
+// listener is the compiled [ListenerConfig].
+type listener struct {
+	// rateLimiter is the rate limiter of the listener.  It's nil if the
+	// rate limiting is disabled.
+	rateLimiter *rateLimiter
+
+	// allowed are the subnets of the allowed clients.  If empty, all clients
+	// are allowed.
+	allowed []netip.Prefix
+
+	// hasRatelimit is true if the rate limit of the listener overrides the
+	// general one.
+	hasRatelimit bool
+}
+
+// listeners is the [proxy.Middleware] applying the settings of the listeners
+// of each protocol.
+type listeners struct {
+	// byProto are the settings of the listeners by their protocols.
+	byProto map[proxy.Proto]*listener
+
+	// defaultLimiter is the general rate limiter for plain DNS over UDP.  It's
+	// nil if the rate limiting is disabled.
+	defaultLimiter *rateLimiter
+
+	// refuse returns the REFUSED response to the dropped requests over the
+	// connection-oriented protocols.  It must not be nil.
+	refuse func(req *dns.Msg) (resp *dns.Msg)
+}
+
+// newListeners validates the settings of the listeners in conf and returns the
+// compiled ones.  It returns nil if there are none.  def is the general rate
+// limiter.
+func newListeners(
+	l *slog.Logger,
+	conf *ServerConfig,
+	def *rateLimiter,
+	refuse func(req *dns.Msg) (resp *dns.Msg),
+) (ls *listeners, err error) {
+	if len(conf.Listeners) == 0 {
+		return nil, nil
+	}
+
+	ls = &listeners{
+		byProto:        make(map[proxy.Proto]*listener, len(conf.Listeners)),
+		defaultLimiter: def,
+		refuse:         refuse,
+	}
+
+	var errs []error
+	for name, c := range conf.Listeners {
+		lsn, lErr := newListener(l, conf, name, c)
+		if lErr != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", name, lErr))
+
+			continue
+		}
+
+		ls.byProto[proxy.Proto(name)] = lsn
+	}
+
+	return ls, errors.Join(errs...)
+}
+
+// newListener returns the compiled settings of the listeners of the protocol
+// with name.
+func newListener(
+	l *slog.Logger,
+	conf *ServerConfig,
+	name string,
+	c *ListenerConfig,
+) (lsn *listener, err error) {
+	if !slices.Contains(listenerProtos, proxy.Proto(name)) {
+		return nil, errors.ErrBadEnumValue
+	} else if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	lsn = &listener{
+		allowed: make([]netip.Prefix, 0, len(c.AllowedNetworks)),
+	}
+
+	for _, p := range c.AllowedNetworks {
+		lsn.allowed = append(lsn.allowed, p.Masked())
+	}
+
+	if c.Ratelimit == nil {
+		return lsn, nil
+	}
+
+	lsn.hasRatelimit = true
+	lsn.rateLimiter, err = newRateLimiter(l, &ServerConfig{
+		Config: Config{
+			Ratelimit:              *c.Ratelimit,
+			RatelimitBurst:         conf.RatelimitBurst,
+			RatelimitSubnetLenIPv4: conf.RatelimitSubnetLenIPv4,
+			RatelimitSubnetLenIPv6: conf.RatelimitSubnetLenIPv6,
+			RatelimitWhitelist:     conf.RatelimitWhitelist,
+		},
+	}, timeutil.SystemClock{})
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: %w", err)
+	}
+
+	return lsn, nil
+}
+
+// isAllowed returns true if the client with addr may use the listeners of
+// proto.  ls may be nil.
+func (ls *listeners) isAllowed(proto proxy.Proto, addr netip.Addr) (ok bool) {
+	if ls == nil {
+		return true
+	}
+
+	lsn, ok := ls.byProto[proto]
+	if !ok || len(lsn.allowed) == 0 {
+		return true
+	}
+
+	addr = addr.Unmap()
+
+	return slices.ContainsFunc(lsn.allowed, func(p netip.Prefix) (ok bool) {
+		return p.Contains(addr)
+	})
+}
+
+// rateLimiterFor returns the rate limiter for the requests over proto.  It
+// returns nil if the requests aren't rate limited.
+func (ls *listeners) rateLimiterFor(proto proxy.Proto) (rl *rateLimiter) {
+	if lsn, ok := ls.byProto[proto]; ok && lsn.hasRatelimit {
+		return lsn.rateLimiter
+	} else if proto == proxy.ProtoUDP {
+		return ls.defaultLimiter
+	}
+
+	return nil
+}
+
+// type check
+var _ proxy.Middleware = (*listeners)(nil)
+
+// Wrap implements the [proxy.Middleware] interface for *listeners.  The rate
+// limited requests over plain DNS over UDP are dropped, and the ones over the
+// other protocols are refused.
+func (ls *listeners) Wrap(h proxy.Handler) (wrapped proxy.Handler) {
+	f := func(p *proxy.Proxy, dctx *proxy.DNSContext) (err error) {
+		ctx := context.TODO()
+		rl := ls.rateLimiterFor(dctx.Proto)
+		if rl == nil || rl.allow(ctx, dctx.Addr.Addr()) {
+			return h.ServeDNS(p, dctx)
+		}
+
+		if dctx.Proto == proxy.ProtoUDP || dctx.Proto == proxy.ProtoDNSCrypt {
+			return proxy.ErrDrop
+		}
+
+		dctx.Res = ls.refuse(dctx.Req)
+
+		return nil
+	}
+
+	return proxy.HandlerFunc(f)
+}
+
+// dohPathPrefix is the path of the DNS-over-HTTPS handler.
+const dohPathPrefix = "dns-query"
+
+// isDoHPath returns true if name, which is the first segment of a URL path, is
+// the one of the DNS-over-HTTPS handler.  dohPaths are the additional paths.
+func isDoHPath(name string, dohPaths []string) (ok bool) {
+	if name == dohPathPrefix {
+		return true
+	}
+
+	return slices.ContainsFunc(dohPaths, func(p string) (ok bool) {
+		return strings.TrimPrefix(p, "/") == name
+	})
+}
+
+// validateDoHPaths returns an error if any of the additional paths of the
+// DNS-over-HTTPS handler is invalid.
+func validateDoHPaths(paths []string) (err error) {
+	var errs []error
+	names := container.NewMapSet(dohPathPrefix)
+	for i, p := range paths {
+		name := strings.TrimPrefix(p, "/")
+		switch {
+		case name == "":
+			err = errors.ErrEmptyValue
+		case strings.ContainsAny(name, "/?#%"):
+			err = errors.Error("must be a single path segment")
+		case name == "control":
+			err = errors.Error("path is reserved for the http api")
+		case names.Has(name):
+			err = errors.ErrDuplicated
+		default:
+			names.Add(name)
+
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("at index %d: %q: %w", i, p, err))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,192 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRefuse returns a function constructing the REFUSED responses for
+// tests.
+func newTestRefuse() (refuse func(req *dns.Msg) (resp *dns.Msg)) {
+	return func(req *dns.Msg) (resp *dns.Msg) {
+		return (&dns.Msg{}).SetRcode(req, dns.RcodeRefused)
+	}
+}
+
+func TestNewListeners(t *testing.T) {
+	testCases := []struct {
+		listeners  map[string]*ListenerConfig
+		name       string
+		wantErrMsg string
+	}{{
+		listeners:  nil,
+		name:       "empty",
+		wantErrMsg: "",
+	}, {
+		listeners: map[string]*ListenerConfig{
+			"https": {AllowedNetworks: []netutil.Prefix{{
+				Prefix: netip.MustParsePrefix("192.168.0.0/16"),
+			}}},
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		listeners: map[string]*ListenerConfig{
+			"http": {},
+		},
+		name:       "bad_proto",
+		wantErrMsg: `"http": bad enum value`,
+	}, {
+		listeners: map[string]*ListenerConfig{
+			"tcp": nil,
+		},
+		name:       "nil",
+		wantErrMsg: `"tcp": no value`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &ServerConfig{Config: Config{Listeners: tc.listeners}}
+			_, err := newListeners(testLogger, conf, nil, newTestRefuse())
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestListeners_IsAllowed(t *testing.T) {
+	conf := &ServerConfig{Config: Config{
+		Listeners: map[string]*ListenerConfig{
+			"tcp": {AllowedNetworks: []netutil.Prefix{{
+				Prefix: netip.MustParsePrefix("192.168.1.1/24"),
+			}}},
+		},
+	}}
+
+	ls, err := newListeners(testLogger, conf, nil, newTestRefuse())
+	require.NoError(t, err)
+
+	lan := netip.MustParseAddr("192.168.1.10")
+	wan := netip.MustParseAddr("203.0.113.1")
+
+	assert.True(t, ls.isAllowed(proxy.ProtoTCP, lan))
+	assert.True(t, ls.isAllowed(proxy.ProtoTCP, netip.AddrFrom16(lan.As16())))
+	assert.False(t, ls.isAllowed(proxy.ProtoTCP, wan))
+	assert.True(t, ls.isAllowed(proxy.ProtoUDP, wan))
+
+	var nilLS *listeners
+	assert.True(t, nilLS.isAllowed(proxy.ProtoTCP, wan))
+}
+
+func TestListeners_Wrap(t *testing.T) {
+	one := uint32(1)
+	zero := uint32(0)
+
+	conf := &ServerConfig{Config: Config{
+		Ratelimit:              1,
+		RatelimitSubnetLenIPv4: 32,
+		RatelimitSubnetLenIPv6: 128,
+		Listeners: map[string]*ListenerConfig{
+			"tcp":   {Ratelimit: &one},
+			"udp":   {Ratelimit: &zero},
+			"https": {},
+		},
+	}}
+
+	def, err := newRateLimiter(testLogger, conf, timeutil.SystemClock{})
+	require.NoError(t, err)
+
+	ls, err := newListeners(testLogger, conf, def, newTestRefuse())
+	require.NoError(t, err)
+
+	var served int
+	h := ls.Wrap(proxy.HandlerFunc(func(_ *proxy.Proxy, _ *proxy.DNSContext) (err error) {
+		served++
+
+		return nil
+	}))
+
+	newDctx := func(proto proxy.Proto) (dctx *proxy.DNSContext) {
+		return &proxy.DNSContext{
+			Proto: proto,
+			Req:   (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA),
+			Addr:  netip.MustParseAddrPort("192.0.2.1:53"),
+		}
+	}
+
+	t.Run("tcp_limited", func(t *testing.T) {
+		served = 0
+
+		require.NoError(t, h.ServeDNS(nil, newDctx(proxy.ProtoTCP)))
+
+		dctx := newDctx(proxy.ProtoTCP)
+		require.NoError(t, h.ServeDNS(nil, dctx))
+		require.NotNil(t, dctx.Res)
+
+		assert.Equal(t, dns.RcodeRefused, dctx.Res.Rcode)
+		assert.Equal(t, 1, served)
+	})
+
+	t.Run("udp_unlimited", func(t *testing.T) {
+		served = 0
+		for range 3 {
+			require.NoError(t, h.ServeDNS(nil, newDctx(proxy.ProtoUDP)))
+		}
+
+		assert.Equal(t, 3, served)
+	})
+
+	t.Run("https_not_limited", func(t *testing.T) {
+		served = 0
+		for range 3 {
+			require.NoError(t, h.ServeDNS(nil, newDctx(proxy.ProtoHTTPS)))
+		}
+
+		assert.Equal(t, 3, served)
+	})
+}
+
+func TestValidateDoHPaths(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		paths      []string
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		paths:      []string{"/resolve", "query"},
+	}, {
+		name:       "empty",
+		wantErrMsg: `at index 0: "/": empty value`,
+		paths:      []string{"/"},
+	}, {
+		name:       "segments",
+		wantErrMsg: `at index 0: "/a/b": must be a single path segment`,
+		paths:      []string{"/a/b"},
+	}, {
+		name:       "default",
+		wantErrMsg: `at index 0: "/dns-query": duplicated value`,
+		paths:      []string{"/dns-query"},
+	}, {
+		name:       "duplicated",
+		wantErrMsg: `at index 1: "resolve": duplicated value`,
+		paths:      []string{"/resolve", "resolve"},
+	}, {
+		name:       "reserved",
+		wantErrMsg: `at index 0: "/control": path is reserved for the http api`,
+		paths:      []string{"/control"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateDoHPaths(tc.paths))
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// LocalZone is a DNS zone, which is served authoritatively by AdGuard Home.
+type LocalZone struct {
+	// Name is the name of the zone, which is also the origin for the relative
+	// domain names of the records.  It must be a valid domain name and must
+	// be unique.
+	Name string `yaml:"name"`
+
+	// File is the optional path to the zone file in the RFC 1035 format.  The
+	// records from it are added to [LocalZone.Records].
+	File string `yaml:"file"`
+
+	// Records are the resource records of the zone in the zone file format,
+	// for example "www 300 IN A 192.168.0.1".  The records without TTL have
+	// the TTL of 3600.  The records from [LocalZone.File] are added to them.
+	// The zone must have exactly one SOA record with the name of the zone.
+	Records []string `yaml:"records"`
+
+	// UpdateKeys are the names of the keys from [Config.TSIGKeys], which are
+	// allowed to update the zone dynamically.  If empty, the dynamic updates
+	// of the zone are refused.  The updated records are only kept in memory,
+	// so they are lost when the zone is reloaded.
+	UpdateKeys []string `yaml:"update_keys"`
+}
+
+// localZoneDefaultTTL is the TTL of the records of the local zones, for which
+// neither TTL nor $TTL is set.
+const localZoneDefaultTTL = 3600
+
+// maxCNAMEChain is the maximum number of CNAME records followed within a local
+// zone for a single request.
+const maxCNAMEChain = 8
+
+// localZone is the compiled version of [LocalZone].
+type localZone struct {
+	// mu protects soa and records.
+	mu *sync.RWMutex
+
+	// soa is the SOA record of the zone.  It must not be nil.
+	soa *dns.SOA
+
+	// records maps the lowercased FQDNs to their resource records.
+	records map[string][]dns.RR
+
+	// updateKeys are the lowercased FQDNs of the TSIG keys allowed to update
+	// the zone.
+	updateKeys *container.MapSet[string]
+
+	// name is the lowercased FQDN of the zone.
+	name string
+}
+
+// newLocalZones validates conf and returns the compiled zones.  keys are the
+// TSIG keys by their lowercased FQDNs.
+func newLocalZones(conf []*LocalZone, keys map[string]*tsigKey) (zones []*localZone, err error) {
+	names := container.NewMapSet[string]()
+	for i, c := range conf {
+		var z *localZone
+		z, err = newLocalZone(c, keys)
+		if err != nil {
+			return nil, fmt.Errorf("local zone at index %d: %w", i, err)
+		}
+
+		if names.Has(z.name) {
+			return nil, fmt.Errorf("local zone at index %d: duplicate name %q", i, z.name)
+		}
+
+		names.Add(z.name)
+		zones = append(zones, z)
+	}
+
+	return zones, nil
+}
+
+// newLocalZone validates c and returns the compiled zone.  keys are the TSIG
+// keys by their lowercased FQDNs.
+func newLocalZone(c *LocalZone, keys map[string]*tsigKey) (z *localZone, err error) {
+	switch {
+	case c == nil:
+		return nil, errors.ErrNoValue
+	case c.File == "" && len(c.Records) == 0:
+		return nil, fmt.Errorf("records: %w", errors.ErrEmptyValue)
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(c.Name, "."))
+	err = netutil.ValidateDomainName(name)
+	if err != nil {
+		return nil, fmt.Errorf("name: %w", err)
+	}
+
+	z = &localZone{
+		mu:         &sync.RWMutex{},
+		records:    map[string][]dns.RR{},
+		updateKeys: container.NewMapSet[string](),
+		name:       dns.Fqdn(name),
+	}
+
+	for i, k := range c.UpdateKeys {
+		k = dns.Fqdn(strings.ToLower(k))
+		if _, ok := keys[k]; !ok {
+			return nil, fmt.Errorf("update keys: at index %d: unknown tsig key %q", i, k)
+		}
+
+		z.updateKeys.Add(k)
+	}
+
+	err = z.parse(strings.NewReader(strings.Join(c.Records, "\n")), "records")
+	if err != nil {
+		return nil, fmt.Errorf("records: %w", err)
+	}
+
+	if c.File != "" {
+		err = z.parseFile(c.File)
+		if err != nil {
+			return nil, fmt.Errorf("file: %w", err)
+		}
+	}
+
+	if z.soa == nil {
+		return nil, fmt.Errorf("soa record: %w", errors.ErrNoValue)
+	}
+
+	return z, nil
+}
+
+// parseFile adds the records from the zone file at path to z.
+func (z *localZone) parseFile(path string) (err error) {
+	// #nosec G304 -- Trust the path from the configuration file.
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	return z.parse(f, path)
+}
+
+// parse adds the records in the zone file format from r to z.  file is used in
+// the error messages.
+func (z *localZone) parse(r io.Reader, file string) (err error) {
+	zp := dns.NewZoneParser(r, z.name, file)
+	zp.SetDefaultTTL(localZoneDefaultTTL)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		err = z.add(rr)
+		if err != nil {
+			return fmt.Errorf("record %q: %w", rr, err)
+		}
+	}
+
+	// Don't wrap the error, because it's informative enough as is.
+	return zp.Err()
+}
+
+// add validates rr and adds it to z.
+func (z *localZone) add(rr dns.RR) (err error) {
+	hdr := rr.Header()
+	hdr.Name = strings.ToLower(hdr.Name)
+	if !dns.IsSubDomain(z.name, hdr.Name) {
+		return fmt.Errorf("name %q is outside of zone %q", hdr.Name, z.name)
+	}
+
+	if soa, ok := rr.(*dns.SOA); ok {
+		switch {
+		case hdr.Name != z.name:
+			return errors.Error("soa record must have the name of the zone")
+		case z.soa != nil:
+			return errors.Error("duplicate soa record")
+		default:
+			z.soa = soa
+		}
+	}
+
+	z.records[hdr.Name] = append(z.records[hdr.Name], rr)
+
+	return nil
+}
+
+// negativeSOA returns the SOA record for the negative responses.  Its TTL is
+// the negative caching TTL as per RFC 2308.  z.mu is expected to be locked.
+func (z *localZone) negativeSOA() (rr dns.RR) {
+	soa := dns.Copy(z.soa)
+	soa.Header().Ttl = min(z.soa.Hdr.Ttl, z.soa.Minttl)
+
+	return soa
+}
+
+// hasDescendants returns true if there are records for the subdomains of name,
+// which means that name is an empty non-terminal.  z.mu is expected to be
+// locked.
+func (z *localZone) hasDescendants(name string) (ok bool) {
+	suffix := "." + name
+	for n := range z.records {
+		if strings.HasSuffix(n, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup returns the records for name, which must be a lowercased FQDN within
+// z.  The records of the matching wildcard domain name are returned with the
+// name replaced.  exists is false if name doesn't exist in z.  z.mu is
+// expected to be locked.
+func (z *localZone) lookup(name string) (rrs []dns.RR, exists bool) {
+	rrs, exists = z.records[name]
+	if exists {
+		return rrs, true
+	} else if z.hasDescendants(name) {
+		return nil, true
+	}
+
+	// Find the wildcard at the closest existing ancestor.  See RFC 4592.
+	for parent := name; parent != z.name; {
+		_, parent, _ = strings.Cut(parent, ".")
+		wildcard := "*." + parent
+		for _, rr := range z.records[wildcard] {
+			synth := dns.Copy(rr)
+			synth.Header().Name = name
+			rrs = append(rrs, synth)
+		}
+
+		if len(rrs) > 0 {
+			return rrs, true
+		} else if _, ok := z.records[parent]; ok || z.hasDescendants(parent) {
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// answer fills resp with the authoritative answer for the question q.  q.Name
+// must be a lowercased FQDN within z.
+func (z *localZone) answer(resp *dns.Msg, q dns.Question) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	resp.Authoritative = true
+
+	name := q.Name
+	for range maxCNAMEChain {
+		rrs, exists := z.lookup(name)
+		if !exists {
+			if len(resp.Answer) == 0 {
+				resp.Rcode = dns.RcodeNameError
+			}
+
+			resp.Ns = []dns.RR{z.negativeSOA()}
+
+			return
+		}
+
+		var cname *dns.CNAME
+		found := false
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			if hdr.Rrtype == q.Qtype || q.Qtype == dns.TypeANY {
+				resp.Answer = append(resp.Answer, dns.Copy(rr))
+				found = true
+			} else if c, ok := rr.(*dns.CNAME); ok {
+				cname = c
+			}
+		}
+
+		switch {
+		case found:
+			return
+		case cname == nil:
+			resp.Ns = []dns.RR{z.negativeSOA()}
+
+			return
+		default:
+			resp.Answer = append(resp.Answer, dns.Copy(cname))
+			name = strings.ToLower(cname.Target)
+			if !dns.IsSubDomain(z.name, name) {
+				// Let the client resolve the target outside of the zone.
+				return
+			}
+		}
+	}
+}
+
+// localZoneFor returns the most specific local zone containing name, which
+// must be a lowercased FQDN, or nil if there is none.
+func (s *Server) localZoneFor(name string) (z *localZone) {
+	for _, lz := range s.localZones {
+		if dns.IsSubDomain(lz.name, name) && (z == nil || len(lz.name) > len(z.name)) {
+			z = lz
+		}
+	}
+
+	return z
+}
+
+// processLocalZones responds authoritatively to the requests for the domain
+// names within the local zones.
+func (s *Server) processLocalZones(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	if pctx.Res != nil || len(s.localZones) == 0 {
+		return resultCodeSuccess
+	}
+
+	req := pctx.Req
+	q := req.Question[0]
+	q.Name = strings.ToLower(q.Name)
+	z := s.localZoneFor(q.Name)
+	if z == nil {
+		return resultCodeSuccess
+	}
+
+	s.logger.DebugContext(ctx, "local zone request", "zone", z.name, "qtype", q.Qtype)
+
+	resp := s.replyCompressed(req)
+	z.answer(resp, q)
+	pctx.Res = resp
+
+	return resultCodeSuccess
+}
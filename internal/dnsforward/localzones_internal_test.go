@@ -0,0 +1,204 @@
+package dnsforward
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ProcessLocalZones(t *testing.T) {
+	zones, err := newLocalZones([]*LocalZone{{
+		Name: "home.lan",
+		File: filepath.Join("testdata", "home.zone"),
+		Records: []string{
+			"printer IN A 192.168.0.30",
+		},
+	}, {
+		Name: "example.org",
+		Records: []string{
+			"@ IN SOA ns.example.org. admin.example.org. 1 3600 600 86400 60",
+		},
+	}}, nil)
+	require.NoError(t, err)
+
+	s := &Server{
+		logger:     testLogger,
+		localZones: zones,
+	}
+
+	testCases := []struct {
+		name       string
+		host       string
+		wantAns    []string
+		qtype      uint16
+		wantRcode  int
+		wantSOA    bool
+		wantPassed bool
+	}{{
+		name:      "a",
+		host:      "NAS.home.lan.",
+		wantAns:   []string{"nas.home.lan.\t300\tIN\tA\t192.168.0.10"},
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "records",
+		host:      "printer.home.lan.",
+		wantAns:   []string{"printer.home.lan.\t3600\tIN\tA\t192.168.0.30"},
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "nodata",
+		host:      "ns.home.lan.",
+		wantAns:   nil,
+		qtype:     dns.TypeAAAA,
+		wantRcode: dns.RcodeSuccess,
+		wantSOA:   true,
+	}, {
+		name:      "nxdomain",
+		host:      "none.home.lan.",
+		wantAns:   nil,
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeNameError,
+		wantSOA:   true,
+	}, {
+		name: "cname",
+		host: "files.home.lan.",
+		wantAns: []string{
+			"files.home.lan.\t300\tIN\tCNAME\tnas.home.lan.",
+			"nas.home.lan.\t300\tIN\tAAAA\tfd00::10",
+		},
+		qtype:     dns.TypeAAAA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "cname_external",
+		host:      "ext.home.lan.",
+		wantAns:   []string{"ext.home.lan.\t300\tIN\tCNAME\texample.com."},
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "wildcard",
+		host:      "wiki.apps.home.lan.",
+		wantAns:   []string{"wiki.apps.home.lan.\t300\tIN\tA\t192.168.0.20"},
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "empty_non_terminal",
+		host:      "_tcp.home.lan.",
+		wantAns:   nil,
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+		wantSOA:   true,
+	}, {
+		name:      "srv",
+		host:      "_smb._tcp.home.lan.",
+		wantAns:   []string{"_smb._tcp.home.lan.\t300\tIN\tSRV\t0 0 445 nas.home.lan."},
+		qtype:     dns.TypeSRV,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "other_zone",
+		host:      "www.example.org.",
+		wantAns:   nil,
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeNameError,
+		wantSOA:   true,
+	}, {
+		name:       "outside",
+		host:       "example.com.",
+		qtype:      dns.TypeA,
+		wantPassed: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: (&dns.Msg{}).SetQuestion(tc.host, tc.qtype),
+				},
+			}
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			rc := s.processLocalZones(ctx, dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			resp := dctx.proxyCtx.Res
+			if tc.wantPassed {
+				assert.Nil(t, resp)
+
+				return
+			}
+
+			require.NotNil(t, resp)
+
+			assert.True(t, resp.Authoritative)
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+
+			var ans []string
+			for _, rr := range resp.Answer {
+				ans = append(ans, rr.String())
+			}
+
+			assert.Equal(t, tc.wantAns, ans)
+
+			if tc.wantSOA {
+				require.Len(t, resp.Ns, 1)
+
+				soa := testutil.RequireTypeAssert[*dns.SOA](t, resp.Ns[0])
+				assert.Equal(t, uint32(60), soa.Hdr.Ttl)
+			} else {
+				assert.Empty(t, resp.Ns)
+			}
+		})
+	}
+}
+
+func TestNewLocalZones_errors(t *testing.T) {
+	const soa = "@ IN SOA ns.home.lan. admin.home.lan. 1 3600 600 86400 60"
+
+	testCases := []struct {
+		conf       []*LocalZone
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       []*LocalZone{{Name: "home.lan"}},
+		name:       "no_records",
+		wantErrMsg: "local zone at index 0: records: empty value",
+	}, {
+		conf:       []*LocalZone{{Name: "home.lan", Records: []string{"a IN A 1.2.3.4"}}},
+		name:       "no_soa",
+		wantErrMsg: "local zone at index 0: soa record: no value",
+	}, {
+		conf: []*LocalZone{{Name: "home.lan", Records: []string{soa, "a.example.com. IN A 1.2.3.4"}}},
+		name: "outside",
+		wantErrMsg: `local zone at index 0: records: record ` +
+			`"a.example.com.\t3600\tIN\tA\t1.2.3.4": ` +
+			`name "a.example.com." is outside of zone "home.lan."`,
+	}, {
+		conf: []*LocalZone{
+			{Name: "home.lan", Records: []string{soa}},
+			{Name: "HOME.lan.", Records: []string{soa}},
+		},
+		name:       "duplicate",
+		wantErrMsg: `local zone at index 1: duplicate name "home.lan."`,
+	}, {
+		conf: []*LocalZone{{
+			Name:       "home.lan",
+			Records:    []string{soa},
+			UpdateKeys: []string{"none.key"},
+		}},
+		name: "unknown_update_key",
+		wantErrMsg: `local zone at index 0: update keys: at index 0: ` +
+			`unknown tsig key "none.key."`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newLocalZones(tc.conf, nil)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
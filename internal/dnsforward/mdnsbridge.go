@@ -0,0 +1,233 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// MDNSBridgeConfig is the configuration of resolving the link-local host names
+// with multicast DNS and LLMNR for the clients, which only use unicast DNS.
+type MDNSBridgeConfig struct {
+	// Timeout is the time to wait for the responses.  It must be positive if
+	// any of the protocols is enabled.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// MDNS, if true, resolves the names within the "local." domain with
+	// multicast DNS.  See RFC 6762.
+	MDNS bool `yaml:"mdns"`
+
+	// LLMNR, if true, resolves the single-label names with Link-Local
+	// Multicast Name Resolution.  See RFC 4795.
+	LLMNR bool `yaml:"llmnr"`
+}
+
+// validate returns an error if c is not valid.  c may be nil.
+func (c *MDNSBridgeConfig) validate() (err error) {
+	if c == nil || (!c.MDNS && !c.LLMNR) {
+		return nil
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout: %w", errors.ErrNotPositive)
+	}
+
+	return nil
+}
+
+// Multicast groups of the link-local name resolution protocols.
+var (
+	mdnsGroup  = netip.MustParseAddrPort("224.0.0.251:5353")
+	llmnrGroup = netip.MustParseAddrPort("224.0.0.252:5355")
+)
+
+// mdnsMaxTTL is the maximum TTL of the records resolved with multicast DNS, as
+// recommended for the legacy unicast responses by RFC 6762.
+const mdnsMaxTTL = 10
+
+// mdnsCacheFlushBit is the cache-flush bit in the class of the multicast DNS
+// resource records.  See RFC 6762, section 10.2.
+const mdnsCacheFlushBit = 1 << 15
+
+// multicastExchanger sends the requests to the multicast groups.
+type multicastExchanger interface {
+	// exchange sends req to group and returns the first response with answers.
+	// resp is nil if there are no such responses before ctx is done.
+	exchange(ctx context.Context, req *dns.Msg, group netip.AddrPort) (resp *dns.Msg, err error)
+}
+
+// udpMulticastExchanger is the [multicastExchanger], which sends the requests
+// from an ephemeral port, so that the responders answer with unicast.
+type udpMulticastExchanger struct{}
+
+// type check
+var _ multicastExchanger = udpMulticastExchanger{}
+
+// exchange implements the [multicastExchanger] interface for
+// udpMulticastExchanger.
+func (udpMulticastExchanger) exchange(
+	ctx context.Context,
+	req *dns.Msg,
+	group netip.AddrPort,
+) (resp *dns.Msg, err error) {
+	packed, err := req.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing request: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("listening: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return nil, fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+
+	_, err = conn.WriteToUDPAddrPort(packed, group)
+	if err != nil {
+		return nil, fmt.Errorf("writing request: %w", err)
+	}
+
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		var n int
+		n, _, err = conn.ReadFromUDPAddrPort(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading response: %w", err)
+		}
+
+		resp = &dns.Msg{}
+		if resp.Unpack(buf[:n]) != nil || !resp.Response || resp.Id != req.Id {
+			// Ignore the malformed and unrelated messages.
+			continue
+		}
+
+		if len(resp.Answer) > 0 {
+			return resp, nil
+		}
+	}
+}
+
+// mdnsBridge resolves the link-local host names with multicast DNS and LLMNR.
+type mdnsBridge struct {
+	// exchanger sends the requests.  It must not be nil.
+	exchanger multicastExchanger
+
+	// timeout is the time to wait for the responses.
+	timeout time.Duration
+
+	// mdns, if true, enables multicast DNS.
+	mdns bool
+
+	// llmnr, if true, enables LLMNR.
+	llmnr bool
+}
+
+// newMDNSBridge returns a new bridge for conf or nil if it's disabled.  conf
+// must be valid.
+func newMDNSBridge(conf *MDNSBridgeConfig, exchanger multicastExchanger) (b *mdnsBridge) {
+	if conf == nil || (!conf.MDNS && !conf.LLMNR) {
+		return nil
+	}
+
+	return &mdnsBridge{
+		exchanger: exchanger,
+		timeout:   time.Duration(conf.Timeout),
+		mdns:      conf.MDNS,
+		llmnr:     conf.LLMNR,
+	}
+}
+
+// groupFor returns the multicast group for resolving name, which must be an
+// FQDN.  ok is false if name shouldn't be resolved with multicast.
+func (b *mdnsBridge) groupFor(name string) (group netip.AddrPort, ok bool) {
+	name = strings.ToLower(name)
+	switch {
+	case b.mdns && name != "local." && dns.IsSubDomain("local.", name):
+		return mdnsGroup, true
+	case b.llmnr && dns.CountLabel(name) == 1:
+		return llmnrGroup, true
+	default:
+		return netip.AddrPort{}, false
+	}
+}
+
+// resolve returns the answers for q from the group.  ans is empty if there are
+// no responses.
+func (b *mdnsBridge) resolve(
+	ctx context.Context,
+	q dns.Question,
+	group netip.AddrPort,
+) (ans []dns.RR, err error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	req := (&dns.Msg{}).SetQuestion(q.Name, q.Qtype)
+	req.RecursionDesired = false
+
+	resp, err := b.exchanger.exchange(ctx, req, group)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+
+	for _, rr := range resp.Answer {
+		hdr := rr.Header()
+		hdr.Class &^= mdnsCacheFlushBit
+		if group == mdnsGroup {
+			hdr.Ttl = min(hdr.Ttl, mdnsMaxTTL)
+		}
+
+		ans = append(ans, rr)
+	}
+
+	return ans, nil
+}
+
+// processMDNSBridge resolves the link-local host names with multicast DNS and
+// LLMNR.  If there are no answers, the requests for the names within the
+// "local." domain are answered with NODATA, since they must not be forwarded
+// to the upstreams, and the others are processed further.
+func (s *Server) processMDNSBridge(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	if pctx.Res != nil || s.mdnsBridge == nil {
+		return resultCodeSuccess
+	}
+
+	req := pctx.Req
+	q := req.Question[0]
+	group, ok := s.mdnsBridge.groupFor(q.Name)
+	if !ok {
+		return resultCodeSuccess
+	}
+
+	ans, err := s.mdnsBridge.resolve(ctx, q, group)
+	if err != nil {
+		s.logger.DebugContext(ctx, "resolving with multicast", "group", group, slogutil.KeyError, err)
+	}
+
+	if len(ans) > 0 {
+		resp := s.replyCompressed(req)
+		resp.Answer = ans
+		pctx.Res = resp
+	} else if group == mdnsGroup {
+		pctx.Res = s.NewMsgNODATA(req)
+	}
+
+	return resultCodeSuccess
+}
@@ -0,0 +1,234 @@
+package dnsforward
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMulticastExchanger is the [multicastExchanger] for tests.
+type testMulticastExchanger struct {
+	onExchange func(req *dns.Msg, group netip.AddrPort) (resp *dns.Msg, err error)
+}
+
+// type check
+var _ multicastExchanger = (*testMulticastExchanger)(nil)
+
+// exchange implements the [multicastExchanger] interface for
+// *testMulticastExchanger.
+func (e *testMulticastExchanger) exchange(
+	_ context.Context,
+	req *dns.Msg,
+	group netip.AddrPort,
+) (resp *dns.Msg, err error) {
+	return e.onExchange(req, group)
+}
+
+func TestMDNSBridge_GroupFor(t *testing.T) {
+	b := newMDNSBridge(&MDNSBridgeConfig{
+		Timeout: timeutil.Duration(testTimeout),
+		MDNS:    true,
+		LLMNR:   true,
+	}, &testMulticastExchanger{})
+	require.NotNil(t, b)
+
+	testCases := []struct {
+		name      string
+		host      string
+		wantGroup netip.AddrPort
+		wantOK    bool
+	}{{
+		name:      "mdns",
+		host:      "printer.local.",
+		wantGroup: mdnsGroup,
+		wantOK:    true,
+	}, {
+		name:      "mdns_case",
+		host:      "Printer.LOCAL.",
+		wantGroup: mdnsGroup,
+		wantOK:    true,
+	}, {
+		name:      "local_itself",
+		host:      "local.",
+		wantGroup: llmnrGroup,
+		wantOK:    true,
+	}, {
+		name:      "llmnr",
+		host:      "nas.",
+		wantGroup: llmnrGroup,
+		wantOK:    true,
+	}, {
+		name:      "other",
+		host:      "www.example.com.",
+		wantGroup: netip.AddrPort{},
+		wantOK:    false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			group, ok := b.groupFor(tc.host)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.wantGroup, group)
+		})
+	}
+}
+
+func TestServer_ProcessMDNSBridge(t *testing.T) {
+	var found bool
+	exchanger := &testMulticastExchanger{
+		onExchange: func(req *dns.Msg, _ netip.AddrPort) (resp *dns.Msg, err error) {
+			if !found {
+				return nil, nil
+			}
+
+			resp = (&dns.Msg{}).SetReply(req)
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   req.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET | mdnsCacheFlushBit,
+					Ttl:    120,
+				},
+				A: net.IP{192, 168, 0, 10},
+			}}
+
+			return resp, nil
+		},
+	}
+
+	f, err := filtering.New(&filtering.Config{
+		Logger:       testLogger,
+		BlockingMode: filtering.BlockingModeDefault,
+	}, nil)
+	require.NoError(t, err)
+
+	s := &Server{
+		dnsFilter: f,
+		logger:    testLogger,
+		mdnsBridge: newMDNSBridge(&MDNSBridgeConfig{
+			Timeout: timeutil.Duration(testTimeout),
+			MDNS:    true,
+			LLMNR:   true,
+		}, exchanger),
+	}
+
+	testCases := []struct {
+		name      string
+		host      string
+		wantRcode int
+		found     bool
+		wantRes   bool
+		wantTTL   uint32
+	}{{
+		name:      "mdns",
+		host:      "printer.local.",
+		wantRcode: dns.RcodeSuccess,
+		found:     true,
+		wantRes:   true,
+		wantTTL:   mdnsMaxTTL,
+	}, {
+		name:      "mdns_not_found",
+		host:      "printer.local.",
+		wantRcode: dns.RcodeSuccess,
+		found:     false,
+		wantRes:   true,
+		wantTTL:   0,
+	}, {
+		name:      "llmnr",
+		host:      "nas.",
+		wantRcode: dns.RcodeSuccess,
+		found:     true,
+		wantRes:   true,
+		wantTTL:   120,
+	}, {
+		name:      "llmnr_not_found",
+		host:      "nas.",
+		wantRcode: dns.RcodeSuccess,
+		found:     false,
+		wantRes:   false,
+		wantTTL:   0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			found = tc.found
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: (&dns.Msg{}).SetQuestion(tc.host, dns.TypeA),
+				},
+			}
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			rc := s.processMDNSBridge(ctx, dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			res := dctx.proxyCtx.Res
+			if !tc.wantRes {
+				assert.Nil(t, res)
+
+				return
+			}
+
+			require.NotNil(t, res)
+			assert.Equal(t, tc.wantRcode, res.Rcode)
+
+			if !tc.found {
+				assert.Empty(t, res.Answer)
+
+				return
+			}
+
+			require.Len(t, res.Answer, 1)
+
+			hdr := res.Answer[0].Header()
+			assert.Equal(t, uint16(dns.ClassINET), hdr.Class)
+			assert.Equal(t, tc.wantTTL, hdr.Ttl)
+		})
+	}
+}
+
+func TestUDPMulticastExchanger_Exchange(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := (&dns.Msg{}).SetReply(req)
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   req.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    10,
+				},
+				A: net.IP{192, 168, 0, 10},
+			}}
+
+			_ = w.WriteMsg(resp)
+		}),
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	testutil.CleanupAndRequireSuccess(t, srv.Shutdown)
+
+	group := testutil.RequireTypeAssert[*net.UDPAddr](t, pc.LocalAddr()).AddrPort()
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	req := (&dns.Msg{}).SetQuestion("printer.local.", dns.TypeA)
+	resp, err := udpMulticastExchanger{}.exchange(ctx, req, group)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	assert.Equal(t, req.Id, resp.Id)
+	assert.Len(t, resp.Answer, 1)
+}
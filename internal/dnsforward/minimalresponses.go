@@ -0,0 +1,44 @@
+package dnsforward
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+)
+
+// minimizeResponse removes the records, which aren't required, from the
+// authority and additional sections of resp.  The SOA records are only kept in
+// the negative responses, since they are required for negative caching, and
+// only the OPT pseudo-record is kept in the additional section.
+func minimizeResponse(resp *dns.Msg) {
+	negative := resp.Rcode == dns.RcodeNameError ||
+		(resp.Rcode == dns.RcodeSuccess && len(resp.Answer) == 0)
+
+	var ns []dns.RR
+	for _, rr := range resp.Ns {
+		if _, ok := rr.(*dns.SOA); ok && negative {
+			ns = append(ns, rr)
+		}
+	}
+
+	resp.Ns = ns
+
+	var extra []dns.RR
+	if opt := resp.IsEdns0(); opt != nil {
+		extra = []dns.RR{opt}
+	}
+
+	resp.Extra = extra
+}
+
+// processMinimalResponses removes the records, which aren't required, from the
+// authority and additional sections of the response, if the minimal responses
+// are enabled.
+func (s *Server) processMinimalResponses(_ context.Context, dctx *dnsContext) (rc resultCode) {
+	res := dctx.proxyCtx.Res
+	if res != nil && s.conf.MinimalResponses {
+		minimizeResponse(res)
+	}
+
+	return resultCodeSuccess
+}
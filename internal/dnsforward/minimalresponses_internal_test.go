@@ -0,0 +1,94 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinimizeResponse(t *testing.T) {
+	soa := &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		Ns:   "ns.example.com.",
+		Mbox: "hostmaster.example.com.",
+	}
+	ns := &dns.NS{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeNS,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		Ns: "ns.example.com.",
+	}
+	glue := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "ns.example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		A: net.IP{192, 0, 2, 53},
+	}
+	answer := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "www.example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		A: net.IP{192, 0, 2, 1},
+	}
+
+	testCases := []struct {
+		name      string
+		answer    []dns.RR
+		wantNs    []dns.RR
+		rcode     int
+		wantExtra int
+	}{{
+		name:      "positive",
+		answer:    []dns.RR{answer},
+		wantNs:    nil,
+		rcode:     dns.RcodeSuccess,
+		wantExtra: 1,
+	}, {
+		name:      "nodata",
+		answer:    nil,
+		wantNs:    []dns.RR{soa},
+		rcode:     dns.RcodeSuccess,
+		wantExtra: 1,
+	}, {
+		name:      "nxdomain",
+		answer:    nil,
+		wantNs:    []dns.RR{soa},
+		rcode:     dns.RcodeNameError,
+		wantExtra: 1,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := (&dns.Msg{}).SetQuestion("www.example.com.", dns.TypeA)
+			resp.Response = true
+			resp.Rcode = tc.rcode
+			resp.Answer = tc.answer
+			resp.Ns = []dns.RR{ns, soa}
+			resp.Extra = []dns.RR{glue}
+			resp.SetEdns0(1232, false)
+
+			minimizeResponse(resp)
+
+			assert.Equal(t, tc.answer, resp.Answer)
+			assert.Equal(t, tc.wantNs, resp.Ns)
+			assert.Len(t, resp.Extra, tc.wantExtra)
+			assert.NotNil(t, resp.IsEdns0())
+		})
+	}
+}
@@ -51,9 +51,20 @@ func (s *Server) genDNSFilterMessage(
 	ctx context.Context,
 	dctx *proxy.DNSContext,
 	res *filtering.Result,
+	setts *filtering.Settings,
 ) (resp *dns.Msg) {
 	req := dctx.Req
 	qt := req.Question[0].Qtype
+	if !res.Reason.In(
+		filtering.FilteredSafeBrowsing,
+		filtering.FilteredParental,
+		filtering.FilteredSafeSearch,
+	) {
+		if r := s.blockingRuleFor(qt, dctx.Addr.Addr(), setts); r != nil {
+			return s.genForBlockingRule(ctx, req, r, ipsFromRules(res.Rules))
+		}
+	}
+
 	if qt != dns.TypeA && qt != dns.TypeAAAA && qt != dns.TypeHTTPS {
 		m, _, _ := s.dnsFilter.BlockingMode()
 		if m == filtering.BlockingModeNullIP {
@@ -463,3 +474,30 @@ func (s *Server) genSOA(req *dns.Msg) []dns.RR {
 
 	return []dns.RR{&soa}
 }
+
+// removeOption removes the EDNS(0) options with code from opt.
+func removeOption(opt *dns.OPT, code uint16) {
+	opt.Option = slices.DeleteFunc(opt.Option, func(o dns.EDNS0) (ok bool) {
+		return o.Option() == code
+	})
+}
+
+// stripOption removes the EDNS(0) options with code from msg.  If removeOPT is
+// true, the OPT record is removed completely, for example because the client
+// hasn't sent it.
+func stripOption(msg *dns.Msg, code uint16, removeOPT bool) {
+	for i, rr := range msg.Extra {
+		opt, ok := rr.(*dns.OPT)
+		if !ok {
+			continue
+		}
+
+		if removeOPT {
+			msg.Extra = slices.Delete(msg.Extra, i, i+1)
+		} else {
+			removeOption(opt, code)
+		}
+
+		return
+	}
+}
@@ -0,0 +1,129 @@
+package dnsforward
+
+import (
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// validateNegativeCacheTTL returns an error if the configuration of the
+// negative cache TTL is invalid.
+func validateNegativeCacheTTL(minTTL, maxTTL uint32) (err error) {
+	if maxTTL > 0 && minTTL > maxTTL {
+		return errors.Error(
+			"cache_negative_ttl_min must be less than or equal to cache_negative_ttl_max",
+		)
+	}
+
+	return nil
+}
+
+// negativeTTL adjusts the TTLs of the negative responses, so that the cache of
+// the proxy stores them for the configured time.
+type negativeTTL struct {
+	// minTTL is the minimum TTL of the negative responses in seconds.
+	minTTL uint32
+
+	// maxTTL is the maximum TTL of the negative responses in seconds.  Zero
+	// means no limit.
+	maxTTL uint32
+
+	// disabled is true if the negative responses must not be cached.
+	disabled bool
+}
+
+// newNegativeTTL returns a new negativeTTL or nil if the TTLs of the negative
+// responses shouldn't be changed.
+func newNegativeTTL(minTTL, maxTTL uint32, disabled bool) (n *negativeTTL) {
+	if minTTL == 0 && maxTTL == 0 && !disabled {
+		return nil
+	}
+
+	return &negativeTTL{
+		minTTL:   minTTL,
+		maxTTL:   maxTTL,
+		disabled: disabled,
+	}
+}
+
+// soaFromNegative returns the SOA record of resp if resp is a negative
+// response, that is either NXDOMAIN or NODATA one.  See RFC 2308.
+func soaFromNegative(resp *dns.Msg) (soa *dns.SOA) {
+	switch {
+	case resp.Rcode == dns.RcodeNameError:
+		// Go on.
+	case resp.Rcode == dns.RcodeSuccess && len(resp.Answer) == 0:
+		// Go on.
+	default:
+		return nil
+	}
+
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa
+		}
+	}
+
+	return nil
+}
+
+// adjust sets the TTLs of the authority section of resp, if it's a negative
+// response.  The negative TTL is the minimum of the TTL of the SOA record and
+// its MINIMUM field, clamped to the configured range.  resp must not be nil.
+func (n *negativeTTL) adjust(resp *dns.Msg) {
+	soa := soaFromNegative(resp)
+	if soa == nil {
+		return
+	}
+
+	var ttl uint32
+	if !n.disabled {
+		ttl = min(soa.Hdr.Ttl, soa.Minttl)
+		if ttl < n.minTTL {
+			ttl = n.minTTL
+		}
+
+		if n.maxTTL > 0 && ttl > n.maxTTL {
+			ttl = n.maxTTL
+		}
+	}
+
+	for _, rr := range resp.Ns {
+		rr.Header().Ttl = ttl
+	}
+}
+
+// negativeTTLUpstream is an upstream, which adjusts the TTLs of the negative
+// responses of the wrapped upstream.
+type negativeTTLUpstream struct {
+	upstream.Upstream
+
+	ttl *negativeTTL
+}
+
+// type check
+var _ upstream.Upstream = (*negativeTTLUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for
+// *negativeTTLUpstream.
+func (u *negativeTTLUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	resp, err = u.Upstream.Exchange(req)
+	if err == nil && resp != nil {
+		u.ttl.adjust(resp)
+	}
+
+	return resp, err
+}
+
+// wrap wraps all upstreams of uc to adjust the TTLs of the negative responses.
+// n and uc may be nil.
+func (n *negativeTTL) wrap(uc *proxy.UpstreamConfig) {
+	if n == nil || uc == nil {
+		return
+	}
+
+	mapUpstreams(uc, func(u upstream.Upstream) (w upstream.Upstream) {
+		return &negativeTTLUpstream{Upstream: u, ttl: n}
+	})
+}
@@ -0,0 +1,90 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegativeTTL_Adjust(t *testing.T) {
+	const (
+		minTTL = 10
+		maxTTL = 100
+	)
+
+	newResp := func(rcode int, soaTTL, soaMin uint32, ans ...dns.RR) (resp *dns.Msg) {
+		req := (&dns.Msg{}).SetQuestion("host.example.", dns.TypeA)
+		resp = (&dns.Msg{}).SetRcode(req, rcode)
+		resp.Answer = ans
+		resp.Ns = []dns.RR{&dns.SOA{
+			Hdr: dns.RR_Header{
+				Name:   "example.",
+				Rrtype: dns.TypeSOA,
+				Class:  dns.ClassINET,
+				Ttl:    soaTTL,
+			},
+			Minttl: soaMin,
+		}}
+
+		return resp
+	}
+
+	a := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "host.example.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    1000,
+		},
+		A: net.IP{192, 0, 2, 1},
+	}
+
+	testCases := []struct {
+		resp     *dns.Msg
+		name     string
+		wantTTL  uint32
+		disabled bool
+	}{{
+		resp:     newResp(dns.RcodeNameError, 3600, 50),
+		name:     "nxdomain_soa_min",
+		wantTTL:  50,
+		disabled: false,
+	}, {
+		resp:     newResp(dns.RcodeSuccess, 3600, 86400),
+		name:     "nodata_max",
+		wantTTL:  maxTTL,
+		disabled: false,
+	}, {
+		resp:     newResp(dns.RcodeNameError, 1, 86400),
+		name:     "nxdomain_min",
+		wantTTL:  minTTL,
+		disabled: false,
+	}, {
+		resp:     newResp(dns.RcodeSuccess, 3600, 3600, a),
+		name:     "not_negative",
+		wantTTL:  3600,
+		disabled: false,
+	}, {
+		resp:     newResp(dns.RcodeNameError, 3600, 50),
+		name:     "disabled",
+		wantTTL:  0,
+		disabled: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newNegativeTTL(minTTL, maxTTL, tc.disabled)
+			require.NotNil(t, n)
+
+			n.adjust(tc.resp)
+
+			require.Len(t, tc.resp.Ns, 1)
+			assert.Equal(t, tc.wantTTL, tc.resp.Ns[0].Header().Ttl)
+		})
+	}
+
+	assert.Nil(t, newNegativeTTL(0, 0, false))
+}
@@ -0,0 +1,214 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/miekg/dns"
+)
+
+// PrefetchConfig is the configuration of refreshing the cached responses for
+// the popular domain names.
+type PrefetchConfig struct {
+	// Threshold is the number of requests for a domain name and type within
+	// the TTL of the response, after which the response is refreshed when it
+	// expires.  It must be positive.
+	Threshold uint `yaml:"threshold"`
+
+	// Concurrency is the maximum number of simultaneous refreshes.  It must
+	// be positive.
+	Concurrency uint `yaml:"concurrency"`
+
+	// Count is the maximum number of tracked domain names.  It must be
+	// positive.
+	Count uint `yaml:"count"`
+
+	// Enabled defines if the responses are refreshed.  It requires the cache
+	// to be enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if c isn't valid.  A nil or disabled c is valid.
+func (c *PrefetchConfig) validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	switch {
+	case c.Threshold == 0:
+		return fmt.Errorf("threshold: %w", errors.ErrNotPositive)
+	case c.Concurrency == 0:
+		return fmt.Errorf("concurrency: %w", errors.ErrNotPositive)
+	case c.Count == 0:
+		return fmt.Errorf("count: %w", errors.ErrNotPositive)
+	default:
+		return nil
+	}
+}
+
+// prefetchDelay is the time added to the TTL of a response before refreshing
+// it.  The cache of the proxy returns the TTLs rounded down to seconds, and the
+// cached response is only requested from the upstream again, when it expires.
+const prefetchDelay = 1 * time.Second
+
+// prefetchItem is the state of a single tracked request.
+type prefetchItem struct {
+	// hits is the number of requests since the last scheduled refresh.
+	hits uint
+
+	// scheduled is true if the refresh of the response is scheduled or being
+	// performed.
+	scheduled bool
+}
+
+// prefetcher tracks the popularity of the requests and limits the number of
+// simultaneous refreshes.
+type prefetcher struct {
+	// mu protects items.
+	mu *sync.Mutex
+
+	// items maps the keys of the requests to their state.
+	items map[string]*prefetchItem
+
+	// sem limits the number of simultaneous refreshes.
+	sem chan struct{}
+
+	// threshold is the number of requests, after which the response is
+	// refreshed.
+	threshold uint
+
+	// count is the maximum number of tracked requests.
+	count uint
+}
+
+// newPrefetcher returns a new prefetcher or nil if refreshing the responses is
+// disabled.  conf must be valid.
+func newPrefetcher(conf *PrefetchConfig, cacheEnabled bool) (p *prefetcher) {
+	if conf == nil || !conf.Enabled || !cacheEnabled {
+		return nil
+	}
+
+	return &prefetcher{
+		mu:        &sync.Mutex{},
+		items:     map[string]*prefetchItem{},
+		sem:       make(chan struct{}, conf.Concurrency),
+		threshold: conf.Threshold,
+		count:     conf.Count,
+	}
+}
+
+// hit records a request with key and returns true if the refresh of its
+// response should be scheduled.  If it returns true, [prefetcher.done] must be
+// called after the refresh.
+func (p *prefetcher) hit(key string) (ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	item := p.items[key]
+	if item == nil {
+		if uint(len(p.items)) >= p.count {
+			p.evict()
+		}
+
+		item = &prefetchItem{}
+		p.items[key] = item
+	}
+
+	item.hits++
+	if item.scheduled || item.hits < p.threshold {
+		return false
+	}
+
+	item.hits, item.scheduled = 0, true
+
+	return true
+}
+
+// evict removes the items, which aren't scheduled for refreshing.  p.mu must
+// be locked.
+func (p *prefetcher) evict() {
+	for k, item := range p.items {
+		if !item.scheduled {
+			delete(p.items, k)
+		}
+	}
+}
+
+// done marks the refresh of the response for key as finished.
+func (p *prefetcher) done(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if item := p.items[key]; item != nil {
+		item.scheduled = false
+	}
+}
+
+// schedulePrefetch records the request of pctx and schedules the refresh of its
+// response, if the request is popular enough.
+func (s *Server) schedulePrefetch(ctx context.Context, pctx *proxy.DNSContext) {
+	p := s.prefetch
+	if p == nil || pctx.CustomUpstreamConfig != nil || pctx.Res == nil {
+		return
+	}
+
+	resp := pctx.Res
+	ttl := minTTL(resp)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 || ttl == 0 {
+		return
+	}
+
+	key := string(reqKey(pctx.Req))
+	if !p.hit(key) {
+		return
+	}
+
+	req := pctx.Req.Copy()
+	delay := time.Duration(ttl)*time.Second + prefetchDelay
+	time.AfterFunc(delay, func() {
+		s.runPrefetch(context.Background(), p, key, req)
+	})
+}
+
+// runPrefetch requests the response for req from the upstreams, which updates
+// the cache.  It is intended to be used as a goroutine.
+func (s *Server) runPrefetch(ctx context.Context, p *prefetcher, key string, req *dns.Msg) {
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	defer p.done(key)
+
+	select {
+	case p.sem <- struct{}{}:
+		defer func() { <-p.sem }()
+	default:
+		s.logger.DebugContext(ctx, "too many prefetches", "qname", req.Question[0].Name)
+
+		return
+	}
+
+	prx := s.proxy()
+	if prx == nil {
+		return
+	}
+
+	req.Id = dns.Id()
+	pctx := &proxy.DNSContext{
+		Req:   req,
+		Proto: proxy.ProtoUDP,
+	}
+
+	staleKey := s.staleKey(pctx)
+	err := prx.Resolve(pctx)
+	if err != nil {
+		s.logger.DebugContext(ctx, "prefetching", "qname", req.Question[0].Name, slogutil.KeyError, err)
+
+		return
+	}
+
+	s.storeStale(ctx, staleKey, pctx.Res)
+}
@@ -0,0 +1,79 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetcher(t *testing.T) {
+	p := newPrefetcher(&PrefetchConfig{
+		Threshold:   2,
+		Concurrency: 1,
+		Count:       2,
+		Enabled:     true,
+	}, true)
+	require.NotNil(t, p)
+
+	const (
+		keyFirst  = "first"
+		keySecond = "second"
+		keyThird  = "third"
+	)
+
+	assert.False(t, p.hit(keyFirst))
+	assert.True(t, p.hit(keyFirst))
+
+	// The refresh is already scheduled.
+	assert.False(t, p.hit(keyFirst))
+
+	p.done(keyFirst)
+	assert.True(t, p.hit(keyFirst))
+
+	assert.False(t, p.hit(keySecond))
+
+	// Adding the third key evicts the second one, since the first one is
+	// scheduled.
+	assert.False(t, p.hit(keyThird))
+	assert.Len(t, p.items, 2)
+	assert.Contains(t, p.items, keyFirst)
+	assert.NotContains(t, p.items, keySecond)
+
+	assert.Nil(t, newPrefetcher(&PrefetchConfig{Enabled: true}, false))
+}
+
+func TestPrefetchConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *PrefetchConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf:       &PrefetchConfig{Threshold: 1, Concurrency: 1, Count: 1, Enabled: true},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf:       &PrefetchConfig{Concurrency: 1, Count: 1, Enabled: true},
+		name:       "no_threshold",
+		wantErrMsg: "threshold: not positive",
+	}, {
+		conf:       &PrefetchConfig{Threshold: 1, Count: 1, Enabled: true},
+		name:       "no_concurrency",
+		wantErrMsg: "concurrency: not positive",
+	}, {
+		conf:       &PrefetchConfig{Threshold: 1, Concurrency: 1, Enabled: true},
+		name:       "no_count",
+		wantErrMsg: "count: not positive",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
@@ -33,6 +33,10 @@ type dnsContext struct {
 	// err is the error returned from a processing function.
 	err error
 
+	// staleKey is the key of the request for the stale cache.  It's nil if the
+	// responses for the request aren't stored.
+	staleKey []byte
+
 	// clientID is the ClientID from DoH, DoQ, or DoT, if provided.
 	clientID string
 
@@ -57,6 +61,10 @@ type dnsContext struct {
 	// isDHCPHost is true if the request for a local domain name and the DHCP is
 	// available for this request.
 	isDHCPHost bool
+
+	// servedStale is true if the response has been served from the stale
+	// cache, because the upstreams have failed or haven't responded in time.
+	servedStale bool
 }
 
 // resultCode is the result of a request processing function.
@@ -136,6 +144,10 @@ func (s *Server) processInitial(ctx context.Context, dctx *dnsContext) (rc resul
 
 	// Get the client-specific filtering settings.
 	dctx.protectionEnabled, _ = s.UpdatedProtectionStatus(ctx)
+	if p := s.listenerProfile(pctx); p != nil && !p.filteringEnabled {
+		dctx.protectionEnabled = false
+	}
+
 	dctx.setts = s.clientRequestFilteringSettings(dctx)
 
 	return resultCodeSuccess
@@ -166,11 +178,11 @@ func (s *Server) processDDRQuery(ctx context.Context, dctx *dnsContext) (rc resu
 	s.logger.DebugContext(ctx, "started processing ddr")
 	defer s.logger.DebugContext(ctx, "finished processing ddr")
 
-	if !s.conf.HandleDDR {
+	pctx := dctx.proxyCtx
+	if pctx.Res != nil || !s.conf.HandleDDR {
 		return resultCodeSuccess
 	}
 
-	pctx := dctx.proxyCtx
 	q := pctx.Req.Question[0]
 	if q.Name == ddrHostFQDN {
 		pctx.Res = s.makeDDRResponse(pctx.Req)
@@ -266,6 +278,10 @@ func (s *Server) processDHCPHosts(ctx context.Context, dctx *dnsContext) (rc res
 	defer s.logger.DebugContext(ctx, "finished processing dhcp hosts")
 
 	pctx := dctx.proxyCtx
+	if pctx.Res != nil {
+		return resultCodeSuccess
+	}
+
 	req := pctx.Req
 
 	q := &req.Question[0]
@@ -444,6 +460,7 @@ func (s *Server) processUpstream(ctx context.Context, dctx *dnsContext) (rc resu
 	}
 
 	s.setCustomUpstream(ctx, pctx, dctx.clientID)
+	s.setDomainECS(pctx)
 
 	reqWantsDNSSEC := s.setReqAD(req)
 
@@ -455,7 +472,16 @@ func (s *Server) processUpstream(ctx context.Context, dctx *dnsContext) (rc resu
 		return resultCodeError
 	}
 
-	if dctx.err = prx.Resolve(pctx); dctx.err != nil {
+	dctx.staleKey = s.staleKey(pctx)
+	dctx.err = s.resolve(ctx, prx, dctx)
+	switch {
+	case dctx.servedStale:
+		// Go on, since the upstreams haven't responded in time, see
+		// [Server.resolve].
+	case dctx.err == nil && pctx.Res.Rcode != dns.RcodeServerFailure:
+		s.storeStale(ctx, dctx.staleKey, pctx.Res)
+		s.schedulePrefetch(ctx, pctx)
+	case !s.serveStale(ctx, dctx) && dctx.err != nil:
 		return resultCodeError
 	}
 
@@ -534,6 +560,14 @@ func (s *Server) dhcpHostFromRequest(q *dns.Question) (reqHost string) {
 
 // setCustomUpstream sets custom upstream settings in pctx, if necessary.
 func (s *Server) setCustomUpstream(ctx context.Context, pctx *proxy.DNSContext, clientID string) {
+	if p := s.listenerProfile(pctx); p != nil && p.upstreams != nil {
+		s.logger.DebugContext(ctx, "using listener profile upstreams", "profile", p.name)
+
+		pctx.CustomUpstreamConfig = p.upstreams
+
+		return
+	}
+
 	if !pctx.Addr.IsValid() || s.conf.ClientsContainer == nil {
 		return
 	}
@@ -575,6 +609,7 @@ func (s *Server) processFilteringAfterResponse(ctx context.Context, dctx *dnsCon
 		pctx.Req.Question[0], pctx.Res.Question[0] = dctx.origQuestion, dctx.origQuestion
 
 		rr := s.genAnswerCNAME(pctx.Req, res.CanonName)
+		setRewriteTTL([]dns.RR{rr}, res.TTL)
 		answer := append([]dns.RR{rr}, pctx.Res.Answer...)
 		pctx.Res.Answer = answer
 
@@ -0,0 +1,204 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// QTypeAction is the action taken for the requests of the types from a
+// [QTypePolicy].
+type QTypeAction string
+
+// Valid request type actions.
+const (
+	// QTypeActionRefuse responds with the REFUSED response code.
+	QTypeActionRefuse QTypeAction = "refuse"
+
+	// QTypeActionNODATA responds with an empty NOERROR response with the SOA
+	// record.
+	QTypeActionNODATA QTypeAction = "nodata"
+
+	// QTypeActionNotImp responds with the NOTIMP response code.
+	QTypeActionNotImp QTypeAction = "notimp"
+)
+
+// QTypePolicy refuses or strips the requests of particular types from
+// particular clients before the filtering, regardless of the protection
+// status.  The first matching policy is used.
+type QTypePolicy struct {
+	// QTypes are the types of the requests, to which the policy applies, for
+	// example "ANY", "HTTPS", or "TYPE65".  It must not be empty.
+	QTypes []string `yaml:"qtypes"`
+
+	// ClientTags are the tags of the persistent clients, to which the policy
+	// applies.  If empty, the policy applies to all clients from
+	// [QTypePolicy.Subnets].
+	ClientTags []string `yaml:"client_tags"`
+
+	// Subnets are the subnets of the clients, to which the policy applies.  If
+	// empty, the policy applies to all clients with [QTypePolicy.ClientTags].
+	Subnets []netutil.Prefix `yaml:"subnets"`
+
+	// Action is the action for the matching requests.
+	Action QTypeAction `yaml:"action"`
+}
+
+// qtypePolicy is the compiled version of [QTypePolicy].
+type qtypePolicy struct {
+	// qtypes are the types of the requests.
+	qtypes []uint16
+
+	// tags are the tags of the clients.
+	tags []string
+
+	// subnets are the subnets of the clients.
+	subnets []netip.Prefix
+
+	// action is the action for the matching requests.
+	action QTypeAction
+}
+
+// newQTypePolicies validates conf and returns the compiled policies.
+func newQTypePolicies(conf []*QTypePolicy) (policies []*qtypePolicy, err error) {
+	for i, c := range conf {
+		var p *qtypePolicy
+		p, err = newQTypePolicy(c)
+		if err != nil {
+			return nil, fmt.Errorf("qtype policy at index %d: %w", i, err)
+		}
+
+		policies = append(policies, p)
+	}
+
+	return policies, nil
+}
+
+// newQTypePolicy validates c and returns the compiled policy.
+func newQTypePolicy(c *QTypePolicy) (p *qtypePolicy, err error) {
+	switch {
+	case c == nil:
+		return nil, errors.ErrNoValue
+	case len(c.QTypes) == 0:
+		return nil, fmt.Errorf("qtypes: %w", errors.ErrEmptyValue)
+	}
+
+	switch c.Action {
+	case QTypeActionRefuse, QTypeActionNODATA, QTypeActionNotImp:
+		// Go on.
+	default:
+		return nil, fmt.Errorf("action: %w: %q", errors.ErrBadEnumValue, c.Action)
+	}
+
+	p = &qtypePolicy{
+		tags:    slices.Clone(c.ClientTags),
+		subnets: make([]netip.Prefix, 0, len(c.Subnets)),
+		action:  c.Action,
+	}
+
+	for i, qt := range c.QTypes {
+		var t uint16
+		t, err = parseQType(qt)
+		if err != nil {
+			return nil, fmt.Errorf("qtypes: at index %d: %w", i, err)
+		}
+
+		p.qtypes = append(p.qtypes, t)
+	}
+
+	for _, s := range c.Subnets {
+		p.subnets = append(p.subnets, s.Prefix)
+	}
+
+	return p, nil
+}
+
+// parseQType parses the name of a request type, either a known one, like
+// "HTTPS", or a generic one, like "TYPE65", as defined by RFC 3597.
+func parseQType(s string) (qt uint16, err error) {
+	s = strings.ToUpper(s)
+	if t, ok := dns.StringToType[s]; ok {
+		return t, nil
+	}
+
+	if numStr, ok := strings.CutPrefix(s, "TYPE"); ok {
+		var n uint64
+		n, err = strconv.ParseUint(numStr, 10, 16)
+		if err == nil {
+			// #nosec G115 -- The value is parsed as a 16-bit one above.
+			return uint16(n), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %q", errors.ErrBadEnumValue, s)
+}
+
+// qtypePolicyFor returns the first policy applying to the request of type qt
+// from the client or nil if there is none.
+func (s *Server) qtypePolicyFor(
+	qt uint16,
+	addr netip.Addr,
+	setts *filtering.Settings,
+) (p *qtypePolicy) {
+	for _, p = range s.qtypePolicies {
+		if slices.Contains(p.qtypes, qt) && clientMatches(p.tags, p.subnets, addr, setts) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// processQTypePolicies refuses or strips the request, if its type is in the
+// policy applying to the client.  The request is recorded in the query log as
+// blocked.
+func (s *Server) processQTypePolicies(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	if pctx.Res != nil || len(s.qtypePolicies) == 0 {
+		return resultCodeSuccess
+	}
+
+	req := pctx.Req
+	qt := req.Question[0].Qtype
+	p := s.qtypePolicyFor(qt, pctx.Addr.Addr(), dctx.setts)
+	if p == nil {
+		return resultCodeSuccess
+	}
+
+	s.logger.DebugContext(
+		ctx,
+		"qtype policy",
+		"qtype", dns.Type(qt),
+		"action", p.action,
+		"addr", pctx.Addr,
+	)
+
+	switch p.action {
+	case QTypeActionRefuse:
+		pctx.Res = s.makeResponseREFUSED(req)
+	case QTypeActionNotImp:
+		pctx.Res = s.reply(req, dns.RcodeNotImplemented)
+	default:
+		pctx.Res = s.NewMsgNODATA(req)
+	}
+
+	dctx.result = &filtering.Result{
+		Rules: []*filtering.ResultRule{{
+			Text:         fmt.Sprintf("qtype policy: %s %s", p.action, dns.Type(qt)),
+			FilterListID: rulelist.APIIDQTypePolicy,
+		}},
+		Reason:     filtering.FilteredBlockList,
+		IsFiltered: true,
+	}
+
+	return resultCodeSuccess
+}
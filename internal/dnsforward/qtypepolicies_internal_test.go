@@ -0,0 +1,142 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_processQTypePolicies(t *testing.T) {
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamDNS:      []string{"8.8.8.8:53"},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ClientsContainer: EmptyClientsContainer{},
+			QTypePolicies: []*QTypePolicy{{
+				QTypes: []string{"any"},
+				Action: QTypeActionNotImp,
+			}, {
+				QTypes: []string{"TYPE65"},
+				Action: QTypeActionNODATA,
+			}, {
+				QTypes:  []string{"PTR"},
+				Subnets: []netutil.Prefix{{Prefix: netip.MustParsePrefix("192.168.1.0/24")}},
+				Action:  QTypeActionRefuse,
+			}},
+		},
+		ServePlainDNS: true,
+	})
+
+	guest := netip.MustParseAddrPort("192.168.1.10:12345")
+	local := netip.MustParseAddrPort("192.168.0.10:12345")
+
+	testCases := []struct {
+		name      string
+		wantRule  string
+		addr      netip.AddrPort
+		qtype     uint16
+		wantRcode int
+	}{{
+		name:      "any",
+		wantRule:  "qtype policy: notimp ANY",
+		addr:      local,
+		qtype:     dns.TypeANY,
+		wantRcode: dns.RcodeNotImplemented,
+	}, {
+		name:      "https",
+		wantRule:  "qtype policy: nodata HTTPS",
+		addr:      local,
+		qtype:     dns.TypeHTTPS,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "ptr_guest",
+		wantRule:  "qtype policy: refuse PTR",
+		addr:      guest,
+		qtype:     dns.TypePTR,
+		wantRcode: dns.RcodeRefused,
+	}, {
+		name:      "ptr_local",
+		wantRule:  "",
+		addr:      local,
+		qtype:     dns.TypePTR,
+		wantRcode: 0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:  (&dns.Msg{}).SetQuestion("host.example.", tc.qtype),
+					Addr: tc.addr,
+				},
+				result: &filtering.Result{},
+				setts:  &filtering.Settings{},
+			}
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			rc := s.processQTypePolicies(ctx, dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			resp := dctx.proxyCtx.Res
+			if tc.wantRule == "" {
+				assert.Nil(t, resp)
+				assert.False(t, dctx.result.IsFiltered)
+
+				return
+			}
+
+			require.NotNil(t, resp)
+
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+			assert.Empty(t, resp.Answer)
+
+			require.Len(t, dctx.result.Rules, 1)
+
+			rule := dctx.result.Rules[0]
+			assert.Equal(t, tc.wantRule, rule.Text)
+			assert.Equal(t, rulelist.APIIDQTypePolicy, rule.FilterListID)
+		})
+	}
+}
+
+func TestNewQTypePolicies_errors(t *testing.T) {
+	testCases := []struct {
+		conf       *QTypePolicy
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &QTypePolicy{Action: QTypeActionRefuse},
+		name:       "no_qtypes",
+		wantErrMsg: "qtype policy at index 0: qtypes: empty value",
+	}, {
+		conf:       &QTypePolicy{QTypes: []string{"A"}, Action: "bad"},
+		name:       "bad_action",
+		wantErrMsg: `qtype policy at index 0: action: bad enum value: "bad"`,
+	}, {
+		conf:       &QTypePolicy{QTypes: []string{"TYPE70000"}, Action: QTypeActionRefuse},
+		name:       "bad_qtype",
+		wantErrMsg: `qtype policy at index 0: qtypes: at index 0: bad enum value: "TYPE70000"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newQTypePolicies([]*QTypePolicy{tc.conf})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package dnsforward
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+)
+
+// isPlainUDPUpstream returns true if the upstream with addr is a plain DNS one
+// using UDP.  addr is the address returned by [upstream.Upstream.Address].
+func isPlainUDPUpstream(addr string) (ok bool) {
+	scheme, _, found := strings.Cut(addr, "://")
+	if !found {
+		// Make sure that it's a host and port.
+		_, _, err := net.SplitHostPort(addr)
+
+		return err == nil
+	}
+
+	return scheme == "udp"
+}
+
+// randomizeCase returns name with the case of each ASCII letter chosen
+// randomly, as described in draft-vixie-dnsext-dns0x20.
+func randomizeCase(name string) (randomized string) {
+	b := []byte(name)
+
+	bits := make([]byte, len(b))
+	_, _ = rand.Read(bits)
+
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			if bits[i]&1 == 0 {
+				c |= 0x20
+			} else {
+				c &^= 0x20
+			}
+
+			b[i] = c
+		}
+	}
+
+	return string(b)
+}
+
+// queryCaseUpstream is an upstream, which randomizes the case of the question
+// names of the queries sent to the wrapped plain DNS upstream and rejects the
+// responses, the question names of which don't match exactly.
+type queryCaseUpstream struct {
+	upstream.Upstream
+}
+
+// type check
+var _ upstream.Upstream = (*queryCaseUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for
+// *queryCaseUpstream.
+func (u *queryCaseUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	if len(req.Question) != 1 {
+		return u.Upstream.Exchange(req)
+	}
+
+	name := req.Question[0].Name
+
+	randomized := req.Copy()
+	randomized.Question[0].Name = randomizeCase(name)
+
+	resp, err = u.Upstream.Exchange(randomized)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	want := randomized.Question[0].Name
+	if len(resp.Question) != 1 || resp.Question[0].Name != want {
+		return nil, fmt.Errorf("response question does not match %q", want)
+	}
+
+	restoreName(resp, want, name)
+
+	return resp, nil
+}
+
+// restoreName replaces the question name and the names of the resource records
+// of resp, which are from, with to.
+func restoreName(resp *dns.Msg, from, to string) {
+	resp.Question[0].Name = to
+
+	for _, rrs := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range rrs {
+			if hdr := rr.Header(); hdr.Name == from {
+				hdr.Name = to
+			}
+		}
+	}
+}
+
+// randomizeQueryCase wraps the plain UDP upstreams of uc to randomize the case
+// of the question names, if enabled.  uc may be nil.
+func randomizeQueryCase(enabled bool, uc *proxy.UpstreamConfig) {
+	if !enabled || uc == nil {
+		return
+	}
+
+	mapUpstreams(uc, func(u upstream.Upstream) (w upstream.Upstream) {
+		if !isPlainUDPUpstream(u.Address()) {
+			return u
+		}
+
+		return &queryCaseUpstream{Upstream: u}
+	})
+}
@@ -0,0 +1,89 @@
+package dnsforward
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandomizeCase(t *testing.T) {
+	const name = "www.example-123.com."
+
+	randomized := randomizeCase(name)
+	assert.True(t, strings.EqualFold(name, randomized))
+	assert.Len(t, randomized, len(name))
+}
+
+func TestIsPlainUDPUpstream(t *testing.T) {
+	assert.True(t, isPlainUDPUpstream("192.0.2.1:53"))
+	assert.True(t, isPlainUDPUpstream("udp://192.0.2.1:53"))
+	assert.False(t, isPlainUDPUpstream("tcp://192.0.2.1:53"))
+	assert.False(t, isPlainUDPUpstream("tls://dns.example"))
+	assert.False(t, isPlainUDPUpstream("192.0.2.1"))
+}
+
+func TestQueryCaseUpstream_Exchange(t *testing.T) {
+	const name = "www.example.com."
+
+	var sent string
+	var respName func(qname string) (rname string)
+	ups := &aghtest.UpstreamMock{
+		OnAddress: func() (addr string) { return "192.0.2.1:53" },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+			sent = req.Question[0].Name
+
+			resp = (&dns.Msg{}).SetReply(req)
+			resp.Question[0].Name = respName(sent)
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   resp.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    60,
+				},
+				A: net.IP{192, 0, 2, 2},
+			}}
+
+			return resp, nil
+		},
+	}
+
+	u := &queryCaseUpstream{Upstream: ups}
+
+	t.Run("match", func(t *testing.T) {
+		respName = func(qname string) (rname string) { return qname }
+
+		req := (&dns.Msg{}).SetQuestion(name, dns.TypeA)
+		resp, err := u.Exchange(req)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+
+		assert.True(t, strings.EqualFold(name, sent))
+		assert.Equal(t, name, req.Question[0].Name)
+		assert.Equal(t, name, resp.Question[0].Name)
+
+		require.Len(t, resp.Answer, 1)
+		assert.Equal(t, name, resp.Answer[0].Header().Name)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		respName = func(qname string) (rname string) { return "WwW.ExAmPlE.CoM." }
+
+		var err error
+		for range 16 {
+			req := (&dns.Msg{}).SetQuestion(name, dns.TypeA)
+			_, err = u.Exchange(req)
+			if sent != "WwW.ExAmPlE.CoM." {
+				break
+			}
+		}
+
+		testutil.AssertErrorMsg(t, `response question does not match "`+sent+`"`, err)
+	})
+}
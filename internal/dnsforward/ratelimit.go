@@ -0,0 +1,339 @@
+package dnsforward
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/AdguardTeam/golibs/validate"
+)
+
+// RatelimitSubnet overrides the rate limit for the clients from a subnet.
+type RatelimitSubnet struct {
+	// Subnet is the subnet of the clients.  The most specific subnet
+	// containing the address of the client is used.
+	Subnet netutil.Prefix `yaml:"subnet"`
+
+	// Ratelimit is the maximum number of requests per second from a given
+	// client within the subnet.  If zero, the clients aren't rate limited.
+	Ratelimit uint32 `yaml:"ratelimit"`
+
+	// Burst is the number of requests a client can send at once in addition
+	// to [RatelimitSubnet.Ratelimit].
+	Burst uint32 `yaml:"burst"`
+}
+
+// ratelimitCleanupIvl is the interval, after which the unused buckets of the
+// rate limiter are removed.
+const ratelimitCleanupIvl = 1 * time.Minute
+
+// ratelimitRule is the compiled rate limit for the clients from a subnet.
+type ratelimitRule struct {
+	// subnet is the subnet of the clients.
+	subnet netip.Prefix
+
+	// rate is the number of requests per second.  If zero, the clients aren't
+	// rate limited.
+	rate uint32
+
+	// burst is the number of additional requests allowed at once.
+	burst uint32
+}
+
+// ratelimitBucket is the token bucket of a client.
+type ratelimitBucket struct {
+	// last is the time of the last refill of tokens.
+	last time.Time
+
+	// throttledSince is the time when the client has started being rate
+	// limited.  It's zero if the client isn't currently rate limited.
+	throttledSince time.Time
+
+	// tokens is the number of requests the client can currently send.
+	tokens float64
+
+	// dropped is the total number of dropped requests of the client.
+	dropped uint64
+}
+
+// rateLimiter is the [proxy.Middleware] dropping the UDP requests of the
+// clients exceeding the rate limits.
+type rateLimiter struct {
+	logger *slog.Logger
+	clock  timeutil.Clock
+
+	// mu protects buckets, lastCleanup, and dropped.
+	mu          *sync.Mutex
+	buckets     map[netip.Prefix]*ratelimitBucket
+	lastCleanup time.Time
+	dropped     uint64
+
+	allowlist *container.MapSet[netip.Addr]
+
+	// rules are sorted by the length of the subnet in descending order.
+	rules []*ratelimitRule
+
+	defaultRule   *ratelimitRule
+	subnetLenIPv4 int
+	subnetLenIPv6 int
+}
+
+// newRateLimiter validates conf and returns a new rate limiter.  It returns nil
+// if the rate limiting is disabled.
+func newRateLimiter(
+	l *slog.Logger,
+	conf *ServerConfig,
+	clock timeutil.Clock,
+) (rl *rateLimiter, err error) {
+	if conf.Ratelimit == 0 && len(conf.RatelimitSubnets) == 0 {
+		return nil, nil
+	}
+
+	err = errors.Join(
+		validate.NoGreaterThan(
+			"ratelimit_subnet_len_ipv4",
+			conf.RatelimitSubnetLenIPv4,
+			netutil.IPv4BitLen,
+		),
+		validate.NoGreaterThan(
+			"ratelimit_subnet_len_ipv6",
+			conf.RatelimitSubnetLenIPv6,
+			netutil.IPv6BitLen,
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rl = &rateLimiter{
+		logger:    l,
+		clock:     clock,
+		mu:        &sync.Mutex{},
+		buckets:   map[netip.Prefix]*ratelimitBucket{},
+		allowlist: container.NewMapSet[netip.Addr](),
+		rules:     make([]*ratelimitRule, 0, len(conf.RatelimitSubnets)),
+		defaultRule: &ratelimitRule{
+			rate:  conf.Ratelimit,
+			burst: conf.RatelimitBurst,
+		},
+		subnetLenIPv4: int(conf.RatelimitSubnetLenIPv4),
+		subnetLenIPv6: int(conf.RatelimitSubnetLenIPv6),
+	}
+
+	for _, addr := range conf.RatelimitWhitelist {
+		rl.allowlist.Add(addr.Unmap())
+	}
+
+	for i, s := range conf.RatelimitSubnets {
+		if s == nil {
+			return nil, fmt.Errorf("ratelimit_subnets: at index %d: %w", i, errors.ErrNoValue)
+		}
+
+		rl.rules = append(rl.rules, &ratelimitRule{
+			subnet: s.Subnet.Masked(),
+			rate:   s.Ratelimit,
+			burst:  s.Burst,
+		})
+	}
+
+	slices.SortStableFunc(rl.rules, func(a, b *ratelimitRule) (res int) {
+		return cmp.Compare(b.subnet.Bits(), a.subnet.Bits())
+	})
+
+	return rl, nil
+}
+
+// type check
+var _ proxy.Middleware = (*rateLimiter)(nil)
+
+// Wrap implements the [proxy.Middleware] interface for *rateLimiter.  If the
+// client is rate limited, it returns [proxy.ErrDrop] to signal that no
+// response should be sent.
+func (rl *rateLimiter) Wrap(h proxy.Handler) (wrapped proxy.Handler) {
+	f := func(p *proxy.Proxy, dctx *proxy.DNSContext) (err error) {
+		ctx := context.TODO()
+		if dctx.Proto == proxy.ProtoUDP && !rl.allow(ctx, dctx.Addr.Addr()) {
+			return proxy.ErrDrop
+		}
+
+		return h.ServeDNS(p, dctx)
+	}
+
+	return proxy.HandlerFunc(f)
+}
+
+// ruleFor returns the rate limit rule for addr.
+func (rl *rateLimiter) ruleFor(addr netip.Addr) (r *ratelimitRule) {
+	for _, r = range rl.rules {
+		if r.subnet.Contains(addr) {
+			return r
+		}
+	}
+
+	return rl.defaultRule
+}
+
+// allow returns true if the request from addr should be processed.
+func (rl *rateLimiter) allow(ctx context.Context, addr netip.Addr) (ok bool) {
+	addr = addr.Unmap()
+	if rl.allowlist.Has(addr) {
+		return true
+	}
+
+	r := rl.ruleFor(addr)
+	if r.rate == 0 {
+		return true
+	}
+
+	bits := rl.subnetLenIPv6
+	if addr.Is4() {
+		bits = rl.subnetLenIPv4
+	}
+
+	key := netip.PrefixFrom(addr, bits).Masked()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.clock.Now()
+	rl.cleanup(now)
+
+	capacity := float64(r.rate + r.burst)
+	b, exists := rl.buckets[key]
+	if !exists {
+		b = &ratelimitBucket{
+			last:   now,
+			tokens: capacity,
+		}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = min(capacity, b.tokens+now.Sub(b.last).Seconds()*float64(r.rate))
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		if !b.throttledSince.IsZero() {
+			rl.logger.InfoContext(
+				ctx,
+				"client is no longer rate limited",
+				"subnet", key,
+				"duration", now.Sub(b.throttledSince),
+				"dropped", b.dropped,
+			)
+			b.throttledSince = time.Time{}
+		}
+
+		return true
+	}
+
+	b.dropped++
+	rl.dropped++
+	if b.throttledSince.IsZero() {
+		rl.logger.InfoContext(ctx, "client is rate limited", "subnet", key, "ratelimit", r.rate)
+		b.throttledSince = now
+	}
+
+	return false
+}
+
+// cleanup removes the buckets of the clients which haven't sent any requests
+// within [ratelimitCleanupIvl].  rl.mu must be locked.
+func (rl *rateLimiter) cleanup(now time.Time) {
+	if now.Sub(rl.lastCleanup) < ratelimitCleanupIvl {
+		return
+	}
+
+	rl.lastCleanup = now
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= ratelimitCleanupIvl {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// ratelimitClientJSON is the rate limiting data of a client.
+type ratelimitClientJSON struct {
+	// Subnet is the address of the client masked by the rate limiting subnet
+	// length.
+	Subnet netip.Prefix `json:"subnet"`
+
+	// Dropped is the number of the dropped requests of the client.
+	Dropped uint64 `json:"dropped"`
+
+	// Throttled is true if the client is currently rate limited.
+	Throttled bool `json:"throttled"`
+}
+
+// ratelimitStatusJSON is the response for the GET /control/ratelimit/status
+// HTTP API.
+type ratelimitStatusJSON struct {
+	// Clients are the recently active clients with dropped requests sorted by
+	// the number of the dropped requests in descending order.
+	Clients []*ratelimitClientJSON `json:"clients"`
+
+	// Dropped is the total number of the dropped requests.
+	Dropped uint64 `json:"dropped"`
+
+	// Enabled is true if the rate limiting is enabled.
+	Enabled bool `json:"enabled"`
+}
+
+// toJSON returns the JSON representation of the rate limiting data.  rl may be
+// nil.
+func (rl *rateLimiter) toJSON() (resp *ratelimitStatusJSON) {
+	resp = &ratelimitStatusJSON{
+		Clients: []*ratelimitClientJSON{},
+	}
+	if rl == nil {
+		return resp
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	resp.Enabled = true
+	resp.Dropped = rl.dropped
+	for key, b := range rl.buckets {
+		if b.dropped == 0 {
+			continue
+		}
+
+		resp.Clients = append(resp.Clients, &ratelimitClientJSON{
+			Subnet:    key,
+			Dropped:   b.dropped,
+			Throttled: !b.throttledSince.IsZero(),
+		})
+	}
+
+	slices.SortFunc(resp.Clients, func(a, b *ratelimitClientJSON) (res int) {
+		return cmp.Or(
+			cmp.Compare(b.Dropped, a.Dropped),
+			a.Subnet.Addr().Compare(b.Subnet.Addr()),
+		)
+	})
+
+	return resp
+}
+
+// handleRatelimitStatus is the handler for the GET /control/ratelimit/status
+// HTTP API.
+func (s *Server) handleRatelimitStatus(w http.ResponseWriter, r *http.Request) {
+	s.serverLock.RLock()
+	resp := s.rateLimiter.toJSON()
+	s.serverLock.RUnlock()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), s.logger, w, r, resp)
+}
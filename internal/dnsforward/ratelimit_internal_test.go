@@ -0,0 +1,84 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	clock := &faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	}
+
+	rl, err := newRateLimiter(testLogger, &ServerConfig{
+		Config: Config{
+			Ratelimit:              2,
+			RatelimitBurst:         1,
+			RatelimitSubnetLenIPv4: 24,
+			RatelimitSubnetLenIPv6: 56,
+			RatelimitWhitelist:     []netip.Addr{netip.MustParseAddr("192.0.2.10")},
+			RatelimitSubnets: []*RatelimitSubnet{{
+				Subnet:    netutil.Prefix{Prefix: netip.MustParsePrefix("198.51.100.0/24")},
+				Ratelimit: 0,
+			}, {
+				Subnet:    netutil.Prefix{Prefix: netip.MustParsePrefix("203.0.113.0/24")},
+				Ratelimit: 1,
+			}},
+		},
+	}, clock)
+	require.NoError(t, err)
+	require.NotNil(t, rl)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	allowN := func(addr netip.Addr, n int) (allowed int) {
+		for range n {
+			if rl.allow(ctx, addr) {
+				allowed++
+			}
+		}
+
+		return allowed
+	}
+
+	client := netip.MustParseAddr("192.0.2.1")
+	neighbour := netip.MustParseAddr("192.0.2.2")
+
+	assert.Equal(t, 3, allowN(client, 5))
+	assert.Equal(t, 0, allowN(neighbour, 1))
+	assert.Equal(t, 10, allowN(netip.MustParseAddr("192.0.2.10"), 10))
+	assert.Equal(t, 10, allowN(netip.MustParseAddr("198.51.100.1"), 10))
+	assert.Equal(t, 1, allowN(netip.MustParseAddr("203.0.113.1"), 5))
+
+	now = now.Add(time.Second)
+	assert.Equal(t, 2, allowN(client, 5))
+
+	status := rl.toJSON()
+	assert.True(t, status.Enabled)
+	assert.Equal(t, uint64(10), status.Dropped)
+
+	require.Len(t, status.Clients, 2)
+
+	assert.Equal(t, netip.MustParsePrefix("192.0.2.0/24"), status.Clients[0].Subnet)
+	assert.Equal(t, uint64(6), status.Clients[0].Dropped)
+	assert.True(t, status.Clients[0].Throttled)
+
+	assert.Equal(t, netip.MustParsePrefix("203.0.113.0/24"), status.Clients[1].Subnet)
+	assert.Equal(t, uint64(4), status.Clients[1].Dropped)
+}
+
+func TestNewRateLimiter_disabled(t *testing.T) {
+	rl, err := newRateLimiter(testLogger, &ServerConfig{}, &faketime.Clock{})
+	require.NoError(t, err)
+
+	assert.Nil(t, rl)
+	assert.False(t, rl.toJSON().Enabled)
+}
@@ -22,6 +22,9 @@ func (s *Server) ServeDNS(_ *proxy.Proxy, pctx *proxy.DNSContext) (err error) {
 		startTime: time.Now(),
 	}
 
+	clientCookie := s.takeCookie(pctx)
+	defer s.setRespCookie(pctx, clientCookie)
+
 	type modProcessFunc func(ctx context.Context, dctx *dnsContext) (rc resultCode)
 
 	// Since [*dnsforward.Server] is used as [proxy.Handler], there is no need
@@ -30,13 +33,24 @@ func (s *Server) ServeDNS(_ *proxy.Proxy, pctx *proxy.DNSContext) (err error) {
 	// before calling the appropriate handler.
 	mods := []modProcessFunc{
 		s.processInitial,
+		s.processClientQuotas,
+		s.processDynamicUpdate,
 		s.processDDRQuery,
 		s.processDHCPHosts,
+		s.processQTypePolicies,
 		s.processDHCPAddrs,
+		s.processViews,
+		s.processLocalZones,
 		s.processFilteringBeforeRequest,
+		s.processMDNSBridge,
 		s.processUpstream,
 		s.processFilteringAfterResponse,
+		s.processGeoBlocking,
+		s.processResponseRewrites,
 		s.ipset.process,
+		s.processCNAMEFlattening,
+		s.processMinimalResponses,
+		s.processAllowlistLearning,
 		s.processQueryLogsAndStats,
 	}
 	for _, process := range mods {
@@ -0,0 +1,271 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// ResponseRewrite modifies the upstream responses to the requests for
+// particular domain names from particular clients.  All the matching rules are
+// applied in order.
+type ResponseRewrite struct {
+	// Domains are the domain names from the questions of the requests, to
+	// which the rule applies.  A domain name prefixed with "*." also matches
+	// its subdomains, but not itself.  It must not be empty.
+	Domains []string `yaml:"domains"`
+
+	// ClientTags are the tags of the persistent clients, to which the rule
+	// applies.  If empty, the rule applies to all clients from
+	// [ResponseRewrite.Subnets].
+	ClientTags []string `yaml:"client_tags"`
+
+	// Subnets are the subnets of the clients, to which the rule applies.  If
+	// empty, the rule applies to all clients with
+	// [ResponseRewrite.ClientTags].
+	Subnets []netutil.Prefix `yaml:"subnets"`
+
+	// Replace are the replacements of the addresses in the A and AAAA records
+	// of the answer section.
+	Replace []*AddrReplacement `yaml:"replace"`
+
+	// Drop are the addresses, the A and AAAA records with which are removed
+	// from the answer section.
+	Drop []netip.Addr `yaml:"drop"`
+
+	// TTL, if positive, overrides the TTL of the records of the answer
+	// section, in seconds.
+	TTL uint32 `yaml:"ttl"`
+}
+
+// AddrReplacement is a replacement of an address in the A or AAAA records.
+type AddrReplacement struct {
+	// From is the replaced address.
+	From netip.Addr `yaml:"from"`
+
+	// To is the new address.  It must be of the same family as
+	// [AddrReplacement.From].
+	To netip.Addr `yaml:"to"`
+}
+
+// responseRewrite is the compiled version of [ResponseRewrite].
+type responseRewrite struct {
+	// domains are the lowercased exact domain names without the trailing dot.
+	domains []string
+
+	// suffixes are the lowercased domain names, the subdomains of which
+	// match, starting with a dot and without the trailing dot.
+	suffixes []string
+
+	// tags are the tags of the clients.
+	tags []string
+
+	// subnets are the subnets of the clients.
+	subnets []netip.Prefix
+
+	// replace maps the replaced addresses to the new ones.
+	replace map[netip.Addr]netip.Addr
+
+	// drop are the addresses of the removed records.
+	drop []netip.Addr
+
+	// ttl is the TTL override.  It's zero if the TTL isn't overridden.
+	ttl uint32
+}
+
+// newResponseRewrites validates conf and returns the compiled rules.
+func newResponseRewrites(conf []*ResponseRewrite) (rules []*responseRewrite, err error) {
+	for i, c := range conf {
+		var r *responseRewrite
+		r, err = newResponseRewrite(c)
+		if err != nil {
+			return nil, fmt.Errorf("response rewrite at index %d: %w", i, err)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// newResponseRewrite validates c and returns the compiled rule.
+func newResponseRewrite(c *ResponseRewrite) (r *responseRewrite, err error) {
+	switch {
+	case c == nil:
+		return nil, errors.ErrNoValue
+	case len(c.Domains) == 0:
+		return nil, fmt.Errorf("domains: %w", errors.ErrEmptyValue)
+	case c.TTL == 0 && len(c.Replace) == 0 && len(c.Drop) == 0:
+		return nil, errors.Error("no ttl, replace, or drop")
+	}
+
+	r = &responseRewrite{
+		tags:    slices.Clone(c.ClientTags),
+		subnets: make([]netip.Prefix, 0, len(c.Subnets)),
+		replace: make(map[netip.Addr]netip.Addr, len(c.Replace)),
+		drop:    make([]netip.Addr, 0, len(c.Drop)),
+		ttl:     c.TTL,
+	}
+
+	for i, d := range c.Domains {
+		d = strings.TrimSuffix(strings.ToLower(d), ".")
+		sub, isWildcard := strings.CutPrefix(d, "*.")
+		err = netutil.ValidateDomainName(sub)
+		if err != nil {
+			return nil, fmt.Errorf("domains: at index %d: %w", i, err)
+		}
+
+		if isWildcard {
+			r.suffixes = append(r.suffixes, "."+sub)
+		} else {
+			r.domains = append(r.domains, d)
+		}
+	}
+
+	for i, repl := range c.Replace {
+		err = validateAddrReplacement(repl)
+		if err != nil {
+			return nil, fmt.Errorf("replace: at index %d: %w", i, err)
+		}
+
+		from := repl.From.Unmap()
+		if _, ok := r.replace[from]; ok {
+			return nil, fmt.Errorf("replace: at index %d: %w: %s", i, errors.ErrDuplicated, from)
+		}
+
+		r.replace[from] = repl.To.Unmap()
+	}
+
+	for i, addr := range c.Drop {
+		if !addr.IsValid() {
+			return nil, fmt.Errorf("drop: at index %d: %w", i, errors.ErrNoValue)
+		}
+
+		r.drop = append(r.drop, addr.Unmap())
+	}
+
+	for _, p := range c.Subnets {
+		r.subnets = append(r.subnets, p.Prefix)
+	}
+
+	return r, nil
+}
+
+// validateAddrReplacement returns an error if repl is invalid.
+func validateAddrReplacement(repl *AddrReplacement) (err error) {
+	switch {
+	case repl == nil:
+		return errors.ErrNoValue
+	case !repl.From.IsValid():
+		return fmt.Errorf("from: %w", errors.ErrNoValue)
+	case !repl.To.IsValid():
+		return fmt.Errorf("to: %w", errors.ErrNoValue)
+	case repl.From.Unmap().Is4() != repl.To.Unmap().Is4():
+		return fmt.Errorf("to: address family doesn't match from: %s", repl.To)
+	default:
+		return nil
+	}
+}
+
+// matches returns true if r applies to the request for host, which must be
+// lowercased and without the trailing dot, from the client with the address
+// addr and the filtering settings setts.
+func (r *responseRewrite) matches(host string, addr netip.Addr, setts *filtering.Settings) (ok bool) {
+	if !slices.Contains(r.domains, host) && !slices.ContainsFunc(r.suffixes, func(s string) (has bool) {
+		return strings.HasSuffix(host, s)
+	}) {
+		return false
+	}
+
+	return clientMatches(r.tags, r.subnets, addr, setts)
+}
+
+// rewrite applies r to the answer section of resp.  It returns true if resp
+// has been changed.
+func (r *responseRewrite) rewrite(resp *dns.Msg) (ok bool) {
+	ans := make([]dns.RR, 0, len(resp.Answer))
+	for _, rr := range resp.Answer {
+		var changed bool
+		rr, changed = r.rewriteRR(rr)
+		ok = ok || changed
+		if rr != nil {
+			ans = append(ans, rr)
+		}
+	}
+
+	if ok {
+		resp.Answer = ans
+	}
+
+	return ok
+}
+
+// rewriteRR applies r to rr.  res is nil if rr must be removed.  The returned
+// record is a copy of rr if it has been changed.
+func (r *responseRewrite) rewriteRR(rr dns.RR) (res dns.RR, changed bool) {
+	var ip netip.Addr
+	switch v := rr.(type) {
+	case *dns.A:
+		ip, _ = netip.AddrFromSlice(v.A.To4())
+	case *dns.AAAA:
+		ip, _ = netip.AddrFromSlice(v.AAAA)
+	}
+
+	ip = ip.Unmap()
+	if ip.IsValid() && slices.Contains(r.drop, ip) {
+		return nil, true
+	}
+
+	to, replaced := r.replace[ip]
+	retimed := r.ttl > 0 && rr.Header().Ttl != r.ttl
+	if !replaced && !retimed {
+		return rr, false
+	}
+
+	res = dns.Copy(rr)
+	if retimed {
+		res.Header().Ttl = r.ttl
+	}
+
+	if replaced {
+		switch v := res.(type) {
+		case *dns.A:
+			v.A = to.AsSlice()
+		case *dns.AAAA:
+			v.AAAA = to.AsSlice()
+		}
+	}
+
+	return res, true
+}
+
+// processResponseRewrites applies the matching response rewrites to the
+// response received from the upstream servers.
+func (s *Server) processResponseRewrites(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	res := pctx.Res
+	if len(s.responseRewrites) == 0 || res == nil || !dctx.responseFromUpstream {
+		return resultCodeSuccess
+	}
+
+	if dctx.result != nil && dctx.result.IsFiltered {
+		return resultCodeSuccess
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(pctx.Req.Question[0].Name, "."))
+	addr := pctx.Addr.Addr()
+	for _, r := range s.responseRewrites {
+		if r.matches(host, addr, dctx.setts) && r.rewrite(res) {
+			s.logger.DebugContext(ctx, "rewrote response", "host", host)
+		}
+	}
+
+	return resultCodeSuccess
+}
@@ -0,0 +1,168 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_processResponseRewrites(t *testing.T) {
+	rules, err := newResponseRewrites([]*ResponseRewrite{{
+		Domains:    []string{"*.cdn.example"},
+		ClientTags: []string{"device_pc"},
+		Replace: []*AddrReplacement{{
+			From: netip.MustParseAddr("192.0.2.1"),
+			To:   netip.MustParseAddr("192.168.0.1"),
+		}},
+		Drop: []netip.Addr{netip.MustParseAddr("2001:db8::1")},
+	}, {
+		Domains: []string{"www.cdn.example"},
+		Subnets: []netutil.Prefix{{Prefix: netip.MustParsePrefix("192.168.0.0/24")}},
+		TTL:     10,
+	}})
+	require.NoError(t, err)
+
+	s := &Server{
+		logger:           testLogger,
+		responseRewrites: rules,
+	}
+
+	newResp := func(name string) (resp *dns.Msg) {
+		resp = (&dns.Msg{}).SetQuestion(name, dns.TypeA)
+		resp.Response = true
+		resp.Answer = []dns.RR{&dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600},
+			A:   net.IP{192, 0, 2, 1},
+		}, &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 3600},
+			AAAA: net.ParseIP("2001:db8::1"),
+		}}
+
+		return resp
+	}
+
+	local := netip.MustParseAddrPort("192.168.0.10:12345")
+	remote := netip.MustParseAddrPort("192.0.2.10:12345")
+	pc := &filtering.Settings{ClientTags: []string{"device_pc"}}
+
+	testCases := []struct {
+		setts    *filtering.Settings
+		name     string
+		host     string
+		addr     netip.AddrPort
+		wantIPs  []net.IP
+		wantTTL  uint32
+		filtered bool
+	}{{
+		setts:   pc,
+		name:    "replace_drop_ttl",
+		host:    "www.cdn.example.",
+		addr:    local,
+		wantIPs: []net.IP{{192, 168, 0, 1}},
+		wantTTL: 10,
+	}, {
+		setts:   pc,
+		name:    "replace_drop",
+		host:    "www.cdn.example.",
+		addr:    remote,
+		wantIPs: []net.IP{{192, 168, 0, 1}},
+		wantTTL: 3600,
+	}, {
+		setts:   nil,
+		name:    "ttl",
+		host:    "WWW.CDN.EXAMPLE.",
+		addr:    local,
+		wantIPs: []net.IP{{192, 0, 2, 1}, net.ParseIP("2001:db8::1")},
+		wantTTL: 10,
+	}, {
+		setts:   pc,
+		name:    "wildcard_parent",
+		host:    "cdn.example.",
+		addr:    remote,
+		wantIPs: []net.IP{{192, 0, 2, 1}, net.ParseIP("2001:db8::1")},
+		wantTTL: 3600,
+	}, {
+		setts:    pc,
+		name:     "filtered",
+		host:     "www.cdn.example.",
+		addr:     local,
+		wantIPs:  []net.IP{{192, 0, 2, 1}, net.ParseIP("2001:db8::1")},
+		wantTTL:  3600,
+		filtered: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := newResp(tc.host)
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:  (&dns.Msg{}).SetQuestion(tc.host, dns.TypeA),
+					Res:  resp,
+					Addr: tc.addr,
+				},
+				setts:                tc.setts,
+				result:               &filtering.Result{IsFiltered: tc.filtered},
+				responseFromUpstream: true,
+			}
+
+			rc := s.processResponseRewrites(testutil.ContextWithTimeout(t, testTimeout), dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+			require.Len(t, resp.Answer, len(tc.wantIPs))
+
+			for i, rr := range resp.Answer {
+				var ip net.IP
+				switch v := rr.(type) {
+				case *dns.A:
+					ip = v.A
+				case *dns.AAAA:
+					ip = v.AAAA
+				}
+
+				assert.True(t, tc.wantIPs[i].Equal(ip))
+				assert.Equal(t, tc.wantTTL, rr.Header().Ttl)
+			}
+		})
+	}
+}
+
+func TestNewResponseRewrites_errors(t *testing.T) {
+	testCases := []struct {
+		conf       *ResponseRewrite
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &ResponseRewrite{TTL: 10},
+		name:       "no_domains",
+		wantErrMsg: "response rewrite at index 0: domains: empty value",
+	}, {
+		conf:       &ResponseRewrite{Domains: []string{"example.org"}},
+		name:       "no_action",
+		wantErrMsg: "response rewrite at index 0: no ttl, replace, or drop",
+	}, {
+		conf: &ResponseRewrite{
+			Domains: []string{"example.org"},
+			Replace: []*AddrReplacement{{
+				From: netip.MustParseAddr("192.0.2.1"),
+				To:   netip.MustParseAddr("2001:db8::1"),
+			}},
+		},
+		name: "bad_family",
+		wantErrMsg: "response rewrite at index 0: replace: at index 0: " +
+			"to: address family doesn't match from: 2001:db8::1",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newResponseRewrites([]*ResponseRewrite{tc.conf})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
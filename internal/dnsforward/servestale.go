@@ -0,0 +1,477 @@
+package dnsforward
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/cache"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// ServeStaleConfig is the configuration of serving the expired responses when
+// the upstreams fail or don't respond in time.  See RFC 8767.
+type ServeStaleConfig struct {
+	// MaxStale is the maximum duration after the expiration of a response,
+	// during which it can still be served.  It must be positive.
+	MaxStale timeutil.Duration `yaml:"max_stale"`
+
+	// AnswerTTL is the TTL of the served expired responses.  It must be
+	// positive.
+	AnswerTTL timeutil.Duration `yaml:"answer_ttl"`
+
+	// ClientTimeout is the time to wait for the upstreams before serving the
+	// expired response, while the upstreams are still waited for in the
+	// background to refresh it.  If zero, the expired responses are only served
+	// after the upstreams fail.  It must not be negative.
+	ClientTimeout timeutil.Duration `yaml:"client_timeout"`
+
+	// Count is the maximum number of stored responses.  It must be positive.
+	Count uint `yaml:"count"`
+
+	// Enabled defines if the expired responses are served.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if c isn't valid.  A nil or disabled c is valid.
+func (c *ServeStaleConfig) validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	switch {
+	case c.MaxStale <= 0:
+		return fmt.Errorf("max_stale: %w", errors.ErrNotPositive)
+	case c.AnswerTTL < timeutil.Duration(time.Second):
+		return fmt.Errorf("answer_ttl: %w: must be at least 1s", errors.ErrOutOfRange)
+	case c.ClientTimeout < 0:
+		return fmt.Errorf("client_timeout: %w", errors.ErrNegative)
+	case c.Count == 0:
+		return fmt.Errorf("count: %w", errors.ErrNotPositive)
+	default:
+		return nil
+	}
+}
+
+// staleCache stores the upstream responses to serve them after the expiration,
+// if the upstreams fail.
+type staleCache struct {
+	// clock is used to get the current time.  It must not be nil.
+	clock timeutil.Clock
+
+	// items is the storage of the packed responses.  Each value is prefixed
+	// with the Unix time of the expiration of the response in seconds.
+	items cache.Cache
+
+	// mu protects refreshing.
+	mu *sync.Mutex
+
+	// refreshing are the keys of the stored responses, which are being
+	// refreshed in the background, see [Server.resolve].
+	refreshing map[string]struct{}
+
+	// maxStale is the maximum duration after the expiration of a response,
+	// during which it can still be served.
+	maxStale time.Duration
+
+	// clientTimeout is the time to wait for the upstreams before serving the
+	// stored response.  If zero, the stored responses are only served after
+	// the upstreams fail.
+	clientTimeout time.Duration
+
+	// answerTTL is the TTL of the served expired responses in seconds.
+	answerTTL uint32
+}
+
+// newStaleCache returns a new stale cache or nil if serving stale responses is
+// disabled.  conf must be valid.  clock must not be nil.
+func newStaleCache(conf *ServeStaleConfig, clock timeutil.Clock) (c *staleCache) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	return &staleCache{
+		clock: clock,
+		items: cache.New(cache.Config{
+			EnableLRU: true,
+			MaxCount:  conf.Count,
+		}),
+		mu:            &sync.Mutex{},
+		refreshing:    map[string]struct{}{},
+		maxStale:      time.Duration(conf.MaxStale),
+		clientTimeout: time.Duration(conf.ClientTimeout),
+		answerTTL:     uint32(time.Duration(conf.AnswerTTL).Seconds()),
+	}
+}
+
+// expiryLen is the length of the expiration time prefix of the stored values.
+const expiryLen = 8
+
+// reqKey returns the key of the request for the stored data.  req must have
+// exactly one question.
+func reqKey(req *dns.Msg) (key []byte) {
+	q := req.Question[0]
+	key = make([]byte, 0, 5+len(q.Name))
+	key = binary.BigEndian.AppendUint16(key, q.Qtype)
+	key = binary.BigEndian.AppendUint16(key, q.Qclass)
+	if hasDO(req) {
+		key = append(key, 1)
+	} else {
+		key = append(key, 0)
+	}
+
+	return append(key, strings.ToLower(q.Name)...)
+}
+
+// staleReqKey returns the key of the request for the stale cache.  Unlike
+// [reqKey], it includes subnet, which is the EDNS Client Subnet sent to the
+// upstreams, if any, since their responses may depend on it.  req must have
+// exactly one question.
+func staleReqKey(req *dns.Msg, subnet netip.Prefix) (key []byte) {
+	if !subnet.IsValid() {
+		return append([]byte{0}, reqKey(req)...)
+	}
+
+	addr := subnet.Addr().AsSlice()
+	key = make([]byte, 0, 2+len(addr))
+	key = append(key, byte(len(addr)))
+	key = append(key, addr...)
+	key = append(key, byte(subnet.Bits()))
+
+	return append(key, reqKey(req)...)
+}
+
+// set stores resp for the request with key, if the response is cacheable.
+// resp must not be nil.
+func (c *staleCache) set(key []byte, resp *dns.Msg) (err error) {
+	if resp.Truncated || (resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError) {
+		return nil
+	}
+
+	packed, err := resp.Pack()
+	if err != nil {
+		return fmt.Errorf("packing response: %w", err)
+	}
+
+	exp := c.clock.Now().Add(time.Duration(minTTL(resp)) * time.Second).Unix()
+	val := make([]byte, expiryLen, expiryLen+len(packed))
+	binary.BigEndian.PutUint64(val, uint64(exp))
+	val = append(val, packed...)
+
+	c.items.Set(key, val)
+
+	return nil
+}
+
+// get returns the stored response for req with key with the adjusted TTLs or
+// nil if there is no response, which can still be served.  req must not be
+// nil.
+func (c *staleCache) get(key []byte, req *dns.Msg) (resp *dns.Msg, err error) {
+	val := c.items.Get(key)
+	if len(val) < expiryLen {
+		return nil, nil
+	}
+
+	exp := time.Unix(int64(binary.BigEndian.Uint64(val)), 0)
+	now := c.clock.Now()
+	if now.After(exp.Add(c.maxStale)) {
+		c.items.Del(key)
+
+		return nil, nil
+	}
+
+	resp = &dns.Msg{}
+	err = resp.Unpack(val[expiryLen:])
+	if err != nil {
+		return nil, fmt.Errorf("unpacking response: %w", err)
+	}
+
+	ttl := c.answerTTL
+	if left := exp.Sub(now); left >= time.Second {
+		ttl = uint32(left.Seconds())
+	}
+
+	setTTL(resp, ttl)
+	resp.SetReply(req)
+
+	return resp, nil
+}
+
+// startRefresh marks the stored response for key as being refreshed and
+// returns true, unless it's already being refreshed.  If ok is true,
+// [staleCache.finishRefresh] must be called after the refresh.
+func (c *staleCache) startRefresh(key []byte) (ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok = c.refreshing[string(key)]; ok {
+		return false
+	}
+
+	c.refreshing[string(key)] = struct{}{}
+
+	return true
+}
+
+// finishRefresh marks the stored response for key as no longer being
+// refreshed.
+func (c *staleCache) finishRefresh(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.refreshing, string(key))
+}
+
+// minTTL returns the minimum TTL of the records in msg, excluding OPT.  It
+// returns 0 if there are no such records.
+func minTTL(msg *dns.Msg) (ttl uint32) {
+	first := true
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			h := rr.Header()
+			if h.Rrtype == dns.TypeOPT {
+				continue
+			}
+
+			if first || h.Ttl < ttl {
+				ttl, first = h.Ttl, false
+			}
+		}
+	}
+
+	return ttl
+}
+
+// setTTL sets the TTL of all records in msg, excluding OPT, to ttl.
+func setTTL(msg *dns.Msg, ttl uint32) {
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			if h := rr.Header(); h.Rrtype != dns.TypeOPT {
+				h.Ttl = ttl
+			}
+		}
+	}
+}
+
+// staleKey returns the key of the request of pctx for the stale cache or nil
+// if the responses for it aren't stored.  The responses from the custom
+// upstreams of the clients aren't stored.  It must be called before resolving
+// the request, see [Server.staleSubnet].
+func (s *Server) staleKey(pctx *proxy.DNSContext) (key []byte) {
+	if s.stale == nil || pctx.CustomUpstreamConfig != nil {
+		return nil
+	}
+
+	return staleReqKey(pctx.Req, s.staleSubnet(pctx))
+}
+
+// staleSubnet returns the EDNS Client Subnet, which the upstreams receive with
+// the request of pctx, if any.  It mirrors the processing of the option by the
+// proxy, which adds it to the request when resolving.
+func (s *Server) staleSubnet(pctx *proxy.DNSContext) (subnet netip.Prefix) {
+	if o := ecsOption(pctx.Req); o != nil && o.SourceNetmask > 0 {
+		addr, ok := netip.AddrFromSlice(o.Address)
+		if !ok {
+			return netip.Prefix{}
+		}
+
+		// Errors are only returned for the bit lengths larger than the ones of
+		// the address, which are considered as no subnet.
+		subnet, _ = addr.Unmap().Prefix(int(o.SourceNetmask))
+
+		return subnet
+	}
+
+	conf := s.conf.EDNSClientSubnet
+	if conf == nil || !conf.Enabled {
+		return netip.Prefix{}
+	}
+
+	ip := pctx.Addr.Addr()
+	if conf.UseCustom {
+		ip = conf.CustomIP
+	}
+
+	ip = ip.Unmap()
+	if netutil.IsSpecialPurpose(ip) {
+		return netip.Prefix{}
+	}
+
+	bits := ecsPrefixLenV6
+	if ip.Is4() {
+		bits = ecsPrefixLenV4
+	}
+
+	// Errors are only returned for the bit lengths larger than the ones of
+	// the address, which isn't possible here.
+	subnet, _ = ip.Prefix(bits)
+
+	return subnet
+}
+
+// ecsOption returns the EDNS Client Subnet option of msg, if any.
+func ecsOption(msg *dns.Msg) (o *dns.EDNS0_SUBNET) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, e := range opt.Option {
+		if o, ok := e.(*dns.EDNS0_SUBNET); ok {
+			return o
+		}
+	}
+
+	return nil
+}
+
+// storeStale stores resp, which is the upstream response for the request with
+// key, for serving it after the expiration.  key may be nil, in which case
+// resp isn't stored.
+func (s *Server) storeStale(ctx context.Context, key []byte, resp *dns.Msg) {
+	if key == nil || resp == nil {
+		return
+	}
+
+	err := s.stale.set(key, resp)
+	if err != nil {
+		s.logger.DebugContext(ctx, "storing stale response", slogutil.KeyError, err)
+	}
+}
+
+// resolve resolves the request of dctx using prx.  If a response for the
+// request is stored and the upstreams don't respond within the client response
+// timeout, it serves the stored response, while the upstreams are still waited
+// for in the background to refresh it.  See RFC 8767 Section 5.
+func (s *Server) resolve(ctx context.Context, prx *proxy.Proxy, dctx *dnsContext) (err error) {
+	pctx := dctx.proxyCtx
+	key := dctx.staleKey
+	if key == nil || s.stale.clientTimeout == 0 {
+		return prx.Resolve(pctx)
+	}
+
+	resp, err := s.stale.get(key, pctx.Req)
+	if err != nil {
+		s.logger.DebugContext(ctx, "getting stale response", slogutil.KeyError, err)
+
+		return prx.Resolve(pctx)
+	} else if resp == nil {
+		return prx.Resolve(pctx)
+	}
+
+	if !s.stale.startRefresh(key) {
+		// Don't wait for the upstreams, since they are already being waited
+		// for by another request.
+		s.setStale(ctx, dctx, resp)
+
+		return nil
+	}
+
+	// Resolve a copy, since the proxy must not see it modified after the
+	// stored response is served.
+	bg := *pctx
+	bg.Req = pctx.Req.Copy()
+
+	resCh := make(chan error)
+	abandonCh := make(chan struct{})
+	go s.refreshStale(context.WithoutCancel(ctx), prx, &bg, key, resCh, abandonCh)
+
+	timer := time.NewTimer(s.stale.clientTimeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-resCh:
+		*pctx = bg
+
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	case <-timer.C:
+		close(abandonCh)
+		s.setStale(ctx, dctx, resp)
+
+		return nil
+	}
+}
+
+// refreshStale resolves the request of pctx using prx and sends the result to
+// resCh.  If abandonCh is closed before that, it stores the response for key
+// itself.  It is intended to be used as a goroutine.
+func (s *Server) refreshStale(
+	ctx context.Context,
+	prx *proxy.Proxy,
+	pctx *proxy.DNSContext,
+	key []byte,
+	resCh chan<- error,
+	abandonCh <-chan struct{},
+) {
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	defer s.stale.finishRefresh(key)
+
+	err := prx.Resolve(pctx)
+
+	select {
+	case resCh <- err:
+		return
+	case <-abandonCh:
+		// Go on.
+	}
+
+	if err == nil && pctx.Res.Rcode != dns.RcodeServerFailure {
+		s.storeStale(ctx, key, pctx.Res)
+	} else {
+		s.logger.DebugContext(
+			ctx,
+			"refreshing stale response",
+			"qname", pctx.Req.Question[0].Name,
+			slogutil.KeyError, err,
+		)
+	}
+}
+
+// serveStale sets the stored response for the request of dctx, if there is
+// one, and returns true.  It should be called when the upstreams fail.
+func (s *Server) serveStale(ctx context.Context, dctx *dnsContext) (ok bool) {
+	if dctx.staleKey == nil {
+		return false
+	}
+
+	resp, err := s.stale.get(dctx.staleKey, dctx.proxyCtx.Req)
+	if err != nil {
+		s.logger.DebugContext(ctx, "getting stale response", slogutil.KeyError, err)
+
+		return false
+	} else if resp == nil {
+		return false
+	}
+
+	s.setStale(ctx, dctx, resp)
+
+	return true
+}
+
+// setStale sets resp, which is the stored response for the request of dctx, as
+// the response to it.
+func (s *Server) setStale(ctx context.Context, dctx *dnsContext, resp *dns.Msg) {
+	pctx := dctx.proxyCtx
+
+	s.logger.DebugContext(
+		ctx,
+		"serving stale response",
+		"qname", pctx.Req.Question[0].Name,
+		"upstream_err", dctx.err,
+	)
+
+	pctx.Res = resp
+	dctx.err = nil
+	dctx.servedStale = true
+}
@@ -0,0 +1,374 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaleCache(t *testing.T) {
+	const (
+		testTTL   = 60
+		answerTTL = 30
+	)
+
+	now := time.Unix(1_000_000, 0)
+	clock := &faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	}
+
+	c := newStaleCache(&ServeStaleConfig{
+		MaxStale:  timeutil.Duration(time.Hour),
+		AnswerTTL: timeutil.Duration(answerTTL * time.Second),
+		Count:     10,
+		Enabled:   true,
+	}, clock)
+	require.NotNil(t, c)
+
+	req := (&dns.Msg{}).SetQuestion("host.example.", dns.TypeA)
+	resp := (&dns.Msg{}).SetReply(req)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{
+			Name:   req.Question[0].Name,
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    testTTL,
+		},
+		A: net.IP{192, 0, 2, 1},
+	}}
+
+	subnet := netip.MustParsePrefix("192.0.2.0/24")
+	require.NoError(t, c.set(staleReqKey(req, subnet), resp))
+
+	servfail := (&dns.Msg{}).SetRcode(
+		(&dns.Msg{}).SetQuestion("other.example.", dns.TypeA),
+		dns.RcodeServerFailure,
+	)
+	require.NoError(t, c.set(staleReqKey(servfail, subnet), servfail))
+
+	testCases := []struct {
+		req     *dns.Msg
+		subnet  netip.Prefix
+		name    string
+		passed  time.Duration
+		wantTTL uint32
+		wantRes bool
+	}{{
+		req:     req,
+		subnet:  subnet,
+		name:    "fresh",
+		passed:  10 * time.Second,
+		wantTTL: testTTL - 10,
+		wantRes: true,
+	}, {
+		req:     (&dns.Msg{}).SetQuestion("HOST.example.", dns.TypeA),
+		subnet:  subnet,
+		name:    "case",
+		passed:  0,
+		wantTTL: testTTL,
+		wantRes: true,
+	}, {
+		req:     req,
+		subnet:  subnet,
+		name:    "stale",
+		passed:  30 * time.Minute,
+		wantTTL: answerTTL,
+		wantRes: true,
+	}, {
+		req:     (&dns.Msg{}).SetQuestion("host.example.", dns.TypeAAAA),
+		subnet:  subnet,
+		name:    "other_type",
+		passed:  0,
+		wantRes: false,
+	}, {
+		req:     servfail,
+		subnet:  subnet,
+		name:    "servfail",
+		passed:  0,
+		wantRes: false,
+	}, {
+		req:     req,
+		subnet:  netip.MustParsePrefix("198.51.100.0/24"),
+		name:    "other_subnet",
+		passed:  0,
+		wantRes: false,
+	}, {
+		req:     req,
+		subnet:  netip.Prefix{},
+		name:    "no_subnet",
+		passed:  0,
+		wantRes: false,
+	}, {
+		req:     req,
+		subnet:  subnet,
+		name:    "too_stale",
+		passed:  2 * time.Hour,
+		wantRes: false,
+	}}
+
+	start := now
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now = start.Add(tc.passed)
+
+			got, err := c.get(staleReqKey(tc.req, tc.subnet), tc.req)
+			require.NoError(t, err)
+
+			if !tc.wantRes {
+				assert.Nil(t, got)
+
+				return
+			}
+
+			require.NotNil(t, got)
+			require.Len(t, got.Answer, 1)
+
+			assert.Equal(t, tc.req.Id, got.Id)
+			assert.Equal(t, tc.wantTTL, got.Answer[0].Header().Ttl)
+		})
+	}
+}
+
+func TestServeStaleConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *ServeStaleConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf:       &ServeStaleConfig{Enabled: false},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &ServeStaleConfig{
+			MaxStale:  timeutil.Duration(time.Hour),
+			AnswerTTL: timeutil.Duration(time.Second),
+			Count:     1,
+			Enabled:   true,
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &ServeStaleConfig{
+			AnswerTTL: timeutil.Duration(time.Second),
+			Count:     1,
+			Enabled:   true,
+		},
+		name:       "no_max_stale",
+		wantErrMsg: "max_stale: not positive",
+	}, {
+		conf: &ServeStaleConfig{
+			MaxStale:  timeutil.Duration(time.Hour),
+			AnswerTTL: timeutil.Duration(time.Millisecond),
+			Count:     1,
+			Enabled:   true,
+		},
+		name:       "small_answer_ttl",
+		wantErrMsg: "answer_ttl: out of range: must be at least 1s",
+	}, {
+		conf: &ServeStaleConfig{
+			MaxStale:  timeutil.Duration(time.Hour),
+			AnswerTTL: timeutil.Duration(time.Second),
+			Enabled:   true,
+		},
+		name:       "no_count",
+		wantErrMsg: "count: not positive",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
+
+func TestServer_ProcessUpstream_serveStale(t *testing.T) {
+	const (
+		host          = "stale.example"
+		clientTimeout = 100 * time.Millisecond
+	)
+
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ClientsContainer: EmptyClientsContainer{},
+			ServeStale: &ServeStaleConfig{
+				MaxStale:      timeutil.Duration(time.Hour),
+				AnswerTTL:     timeutil.Duration(time.Second),
+				ClientTimeout: timeutil.Duration(clientTimeout),
+				Count:         10,
+				Enabled:       true,
+			},
+		},
+		ServePlainDNS: true,
+	})
+
+	var answer atomic.Value
+	answer.Store("192.0.2.1")
+
+	release := make(chan struct{})
+	var blocked atomic.Bool
+
+	s.conf.UpstreamConfig.Upstreams = []upstream.Upstream{
+		aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+			if blocked.Load() {
+				<-release
+			}
+
+			return aghtest.MatchedResponse(req, dns.TypeA, host, answer.Load().(string)), nil
+		}),
+	}
+
+	process := func() (dctx *dnsContext) {
+		dctx = &dnsContext{
+			proxyCtx: &proxy.DNSContext{
+				Addr: testClientAddrPort,
+				Req:  createTestMessage(host + "."),
+			},
+		}
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		require.Equal(t, resultCodeSuccess, s.processUpstream(ctx, dctx))
+
+		return dctx
+	}
+
+	dctx := process()
+	assert.False(t, dctx.servedStale)
+
+	blocked.Store(true)
+	answer.Store("192.0.2.2")
+
+	dctx = process()
+	require.True(t, dctx.servedStale)
+	require.Len(t, dctx.proxyCtx.Res.Answer, 1)
+
+	a := testutil.RequireTypeAssert[*dns.A](t, dctx.proxyCtx.Res.Answer[0])
+	assert.Equal(t, net.IP{192, 0, 2, 1}, a.A.To4())
+
+	// The refresh is still in progress, so the stored response is served
+	// without waiting.
+	dctx = process()
+	assert.True(t, dctx.servedStale)
+
+	close(release)
+
+	key := staleReqKey(createTestMessage(host+"."), netip.Prefix{})
+	assert.Eventually(t, func() (ok bool) {
+		resp, err := s.stale.get(key, createTestMessage(host+"."))
+		if err != nil || resp == nil || len(resp.Answer) != 1 {
+			return false
+		}
+
+		refreshed, _ := resp.Answer[0].(*dns.A)
+
+		return refreshed != nil && refreshed.A.Equal(net.IP{192, 0, 2, 2})
+	}, testTimeout, clientTimeout/10)
+}
+
+func TestServer_staleSubnet(t *testing.T) {
+	clientECS := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: 16,
+		Address:       net.IP{10, 1, 2, 3},
+	}
+
+	newReq := func(o *dns.EDNS0_SUBNET) (req *dns.Msg) {
+		req = (&dns.Msg{}).SetQuestion("host.example.", dns.TypeA)
+		if o != nil {
+			req.SetEdns0(1232, false)
+			req.IsEdns0().Option = append(req.IsEdns0().Option, o)
+		}
+
+		return req
+	}
+
+	testCases := []struct {
+		ecs  *EDNSClientSubnet
+		opt  *dns.EDNS0_SUBNET
+		addr netip.Addr
+		want netip.Prefix
+		name string
+	}{{
+		ecs:  &EDNSClientSubnet{Enabled: false},
+		opt:  nil,
+		addr: netip.MustParseAddr("192.0.2.10"),
+		want: netip.Prefix{},
+		name: "disabled",
+	}, {
+		ecs:  &EDNSClientSubnet{Enabled: false},
+		opt:  clientECS,
+		addr: netip.MustParseAddr("192.0.2.10"),
+		want: netip.MustParsePrefix("10.1.0.0/16"),
+		name: "client",
+	}, {
+		ecs:  &EDNSClientSubnet{Enabled: true},
+		opt:  nil,
+		addr: netip.MustParseAddr("192.0.2.10"),
+		want: netip.Prefix{},
+		name: "special_purpose",
+	}, {
+		ecs:  &EDNSClientSubnet{Enabled: true},
+		opt:  nil,
+		addr: netip.MustParseAddr("203.0.114.10"),
+		want: netip.MustParsePrefix("203.0.114.0/24"),
+		name: "v4",
+	}, {
+		ecs:  &EDNSClientSubnet{Enabled: true},
+		opt:  nil,
+		addr: netip.MustParseAddr("2a00:1450:4001:1234::1"),
+		want: netip.MustParsePrefix("2a00:1450:4001:1200::/56"),
+		name: "v6",
+	}, {
+		ecs: &EDNSClientSubnet{
+			CustomIP:  netip.MustParseAddr("203.0.114.10"),
+			Enabled:   true,
+			UseCustom: true,
+		},
+		opt:  nil,
+		addr: netip.MustParseAddr("192.0.2.10"),
+		want: netip.MustParsePrefix("203.0.114.0/24"),
+		name: "custom",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				conf: ServerConfig{
+					Config: Config{
+						EDNSClientSubnet: tc.ecs,
+					},
+				},
+			}
+
+			got := s.staleSubnet(&proxy.DNSContext{
+				Req:  newReq(tc.opt),
+				Addr: netip.AddrPortFrom(tc.addr, 12345),
+			})
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -107,6 +107,7 @@ func (s *Server) logQuery(dctx *dnsContext, ip net.IP, processingTime time.Durat
 		ClientIP:          ip,
 		Elapsed:           processingTime,
 		AuthenticatedData: dctx.responseAD,
+		Stale:             dctx.servedStale,
 	}
 
 	switch pctx.Proto {
@@ -131,12 +132,32 @@ func (s *Server) logQuery(dctx *dnsContext, ip net.IP, processingTime time.Durat
 		if len(ms) == 1 && ms[0].IsCached {
 			p.Upstream = ms[0].Address
 			p.Cached = true
+		} else {
+			p.UpstreamRTT = upstreamRTT(qs, p.Upstream)
 		}
 	}
 
 	s.queryLog.Add(p)
 }
 
+// upstreamRTT returns the duration of the successful exchange with the upstream
+// having the address addr, if there is one in qs.  qs must not be nil.
+func upstreamRTT(qs *proxy.QueryStatistics, addr string) (rtt time.Duration) {
+	if addr == "" {
+		return 0
+	}
+
+	for _, stats := range [][]*proxy.UpstreamStatistics{qs.Main(), qs.Fallback()} {
+		for _, us := range stats {
+			if us.Address == addr && us.Error == nil {
+				return us.QueryDuration
+			}
+		}
+	}
+
+	return 0
+}
+
 // updateStats writes the request data into statistics.
 func (s *Server) updateStats(dctx *dnsContext, clientIP string, processingTime time.Duration) {
 	pctx := dctx.proxyCtx
@@ -153,6 +174,7 @@ func (s *Server) updateStats(dctx *dnsContext, clientIP string, processingTime t
 		Domain:         aghnet.NormalizeDomain(pctx.Req.Question[0].Name),
 		Result:         stats.RNotFiltered,
 		ProcessingTime: processingTime,
+		Stale:          dctx.servedStale,
 	}
 
 	if clientID := dctx.clientID; clientID != "" {
@@ -164,14 +186,19 @@ func (s *Server) updateStats(dctx *dnsContext, clientIP string, processingTime t
 	switch dctx.result.Reason {
 	case filtering.FilteredSafeBrowsing:
 		e.Result = stats.RSafeBrowsing
+		e.Category = stats.CategorySafeBrowsing
 	case filtering.FilteredParental:
 		e.Result = stats.RParental
+		e.Category = stats.CategoryParental
 	case filtering.FilteredSafeSearch:
 		e.Result = stats.RSafeSearch
+	case filtering.FilteredBlockedService:
+		e.Result = stats.RFiltered
+		e.BlockedService = dctx.result.ServiceName
+		e.Category = filtering.BlockedServiceGroupID(e.BlockedService)
 	case
 		filtering.FilteredBlockList,
-		filtering.FilteredInvalid,
-		filtering.FilteredBlockedService:
+		filtering.FilteredInvalid:
 		e.Result = stats.RFiltered
 	}
 
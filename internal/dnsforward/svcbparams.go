@@ -0,0 +1,65 @@
+package dnsforward
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// strippableSVCBKeys are the keys of the SVCB parameters, which can be removed
+// from the upstream responses, by their presentation names.
+var strippableSVCBKeys = map[string]dns.SVCBKey{
+	"ech":      dns.SVCB_ECHCONFIG,
+	"ipv4hint": dns.SVCB_IPV4HINT,
+	"ipv6hint": dns.SVCB_IPV6HINT,
+}
+
+// newSVCBStripKeys returns the keys of the SVCB parameters by their names.  It
+// returns an error if any of the names is unknown or duplicated.
+func newSVCBStripKeys(names []string) (keys []dns.SVCBKey, err error) {
+	var errs []error
+	for i, name := range names {
+		key, ok := strippableSVCBKeys[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("at index %d: %q: %w", i, name, errors.ErrBadEnumValue))
+		} else if slices.Contains(keys, key) {
+			errs = append(errs, fmt.Errorf("at index %d: %q: %w", i, name, errors.ErrDuplicated))
+		} else {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, errors.Join(errs...)
+}
+
+// stripSVCBParams removes the parameters with keys from rr.  The keys are also
+// removed from the list of the mandatory keys, so that the clients don't
+// ignore the record.
+func stripSVCBParams(rr *dns.SVCB, keys []dns.SVCBKey) {
+	if len(keys) == 0 {
+		return
+	}
+
+	rr.Value = slices.DeleteFunc(rr.Value, func(kv dns.SVCBKeyValue) (del bool) {
+		return slices.Contains(keys, kv.Key())
+	})
+
+	for _, kv := range rr.Value {
+		m, ok := kv.(*dns.SVCBMandatory)
+		if !ok {
+			continue
+		}
+
+		m.Code = slices.DeleteFunc(m.Code, func(k dns.SVCBKey) (del bool) {
+			return slices.Contains(keys, k)
+		})
+	}
+
+	rr.Value = slices.DeleteFunc(rr.Value, func(kv dns.SVCBKeyValue) (del bool) {
+		m, ok := kv.(*dns.SVCBMandatory)
+
+		return ok && len(m.Code) == 0
+	})
+}
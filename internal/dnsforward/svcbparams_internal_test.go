@@ -0,0 +1,121 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSVCBStripKeys(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		names      []string
+		want       []dns.SVCBKey
+	}{{
+		name:       "empty",
+		wantErrMsg: "",
+		names:      nil,
+		want:       nil,
+	}, {
+		name:       "valid",
+		wantErrMsg: "",
+		names:      []string{"ech", "ipv4hint", "ipv6hint"},
+		want:       []dns.SVCBKey{dns.SVCB_ECHCONFIG, dns.SVCB_IPV4HINT, dns.SVCB_IPV6HINT},
+	}, {
+		name:       "unknown",
+		wantErrMsg: `at index 1: "alpn": bad enum value`,
+		names:      []string{"ech", "alpn"},
+		want:       []dns.SVCBKey{dns.SVCB_ECHCONFIG},
+	}, {
+		name:       "duplicated",
+		wantErrMsg: `at index 1: "ech": duplicated value`,
+		names:      []string{"ech", "ech"},
+		want:       []dns.SVCBKey{dns.SVCB_ECHCONFIG},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, err := newSVCBStripKeys(tc.names)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			assert.Equal(t, tc.want, keys)
+		})
+	}
+}
+
+func TestStripSVCBParams(t *testing.T) {
+	newRR := func() (rr *dns.SVCB) {
+		return &dns.SVCB{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeSVCB,
+				Class:  dns.ClassINET,
+			},
+			Priority: 1,
+			Target:   ".",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBMandatory{Code: []dns.SVCBKey{dns.SVCB_ALPN, dns.SVCB_ECHCONFIG}},
+				&dns.SVCBAlpn{Alpn: []string{"h2"}},
+				&dns.SVCBIPv4Hint{Hint: []net.IP{{192, 0, 2, 1}}},
+				&dns.SVCBECHConfig{ECH: []byte{1, 2, 3}},
+				&dns.SVCBIPv6Hint{Hint: []net.IP{net.ParseIP("2001:db8::1")}},
+			},
+		}
+	}
+
+	keysOf := func(rr *dns.SVCB) (keys []dns.SVCBKey) {
+		for _, kv := range rr.Value {
+			keys = append(keys, kv.Key())
+		}
+
+		return keys
+	}
+
+	t.Run("none", func(t *testing.T) {
+		rr := newRR()
+		stripSVCBParams(rr, nil)
+
+		assert.Equal(t, newRR(), rr)
+	})
+
+	t.Run("hints", func(t *testing.T) {
+		rr := newRR()
+		stripSVCBParams(rr, []dns.SVCBKey{dns.SVCB_IPV4HINT, dns.SVCB_IPV6HINT})
+
+		assert.Equal(t, []dns.SVCBKey{
+			dns.SVCB_MANDATORY,
+			dns.SVCB_ALPN,
+			dns.SVCB_ECHCONFIG,
+		}, keysOf(rr))
+	})
+
+	t.Run("ech", func(t *testing.T) {
+		rr := newRR()
+		stripSVCBParams(rr, []dns.SVCBKey{dns.SVCB_ECHCONFIG})
+
+		require.Equal(t, []dns.SVCBKey{
+			dns.SVCB_MANDATORY,
+			dns.SVCB_ALPN,
+			dns.SVCB_IPV4HINT,
+			dns.SVCB_IPV6HINT,
+		}, keysOf(rr))
+
+		m := testutil.RequireTypeAssert[*dns.SVCBMandatory](t, rr.Value[0])
+		assert.Equal(t, []dns.SVCBKey{dns.SVCB_ALPN}, m.Code)
+	})
+
+	t.Run("mandatory_empty", func(t *testing.T) {
+		rr := newRR()
+		stripSVCBParams(rr, []dns.SVCBKey{dns.SVCB_ECHCONFIG})
+		stripSVCBParams(rr, []dns.SVCBKey{dns.SVCB_ALPN})
+
+		assert.Equal(t, []dns.SVCBKey{
+			dns.SVCB_IPV4HINT,
+			dns.SVCB_IPV6HINT,
+		}, keysOf(rr))
+	})
+}
@@ -0,0 +1,83 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// UpstreamBinding is the outbound network interface or the source address of
+// the queries sent to an upstream.  Exactly one of the fields must be set.
+type UpstreamBinding struct {
+	// Interface is the name of the network interface, the address of which is
+	// used as the source address of the queries.
+	Interface string `yaml:"interface"`
+
+	// SourceIP is the source address of the queries.
+	SourceIP netip.Addr `yaml:"source_ip"`
+}
+
+// bindUpstreams replaces the upstreams of uc, for which [Config.UpstreamBindings]
+// are set, with the ones connecting from the set interfaces or addresses.  uc
+// may be nil.
+func (s *Server) bindUpstreams(uc *proxy.UpstreamConfig) (err error) {
+	if uc == nil || len(s.conf.UpstreamBindings) == 0 {
+		return nil
+	}
+
+	var errs []error
+	mapUpstreams(uc, func(u upstream.Upstream) (res upstream.Upstream) {
+		addr := u.Address()
+		b, ok := s.conf.UpstreamBindings[addr]
+		if !ok {
+			return u
+		}
+
+		res, bErr := s.newBoundUpstream(b, addr)
+		if bErr != nil {
+			errs = append(errs, fmt.Errorf("upstream %q: %w", addr, bErr))
+
+			return u
+		}
+
+		// The original upstream hasn't been used yet, so the error is not
+		// important.
+		_ = u.Close()
+
+		return res
+	})
+
+	return errors.Join(errs...)
+}
+
+// newBoundUpstream returns the upstream for addr, which is the address returned
+// by [upstream.Upstream.Address], connecting according to b.
+func (s *Server) newBoundUpstream(
+	b *UpstreamBinding,
+	addr string,
+) (u upstream.Upstream, err error) {
+	if b == nil {
+		return nil, errors.ErrNoValue
+	} else if s.upstreamProxyURL(addr) != "" {
+		return nil, errors.Error("binding cannot be used with upstream proxy")
+	}
+
+	d, err := aghnet.NewBoundDialer(b.Interface, b.SourceIP, s.conf.UpstreamTimeout)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return newProxiedUpstream(&proxiedUpstreamConfig{
+		dialer:       d,
+		rootCAs:      s.conf.TLSv12Roots,
+		cipherSuites: s.conf.TLSCiphers,
+		upstreamTLS:  s.upstreamTLS,
+		timeout:      s.conf.UpstreamTimeout,
+		udp:          true,
+	}, addr)
+}
@@ -0,0 +1,112 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_BindUpstreams(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := pc.LocalAddr().String()
+
+	l, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	networks := make(chan string, 2)
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := (&dns.Msg{}).SetReply(req)
+
+		network := w.RemoteAddr().Network()
+		networks <- network
+		resp.Truncated = network == "udp"
+
+		_ = w.WriteMsg(resp)
+	})
+
+	udpSrv := &dns.Server{PacketConn: pc, Handler: handler}
+	go func() { _ = udpSrv.ActivateAndServe() }()
+	testutil.CleanupAndRequireSuccess(t, udpSrv.Shutdown)
+
+	tcpSrv := &dns.Server{Listener: l, Handler: handler}
+	go func() { _ = tcpSrv.ActivateAndServe() }()
+	testutil.CleanupAndRequireSuccess(t, tcpSrv.Shutdown)
+
+	newUpstream := func(a string) (u upstream.Upstream) {
+		return &aghtest.UpstreamMock{
+			OnAddress: func() (res string) { return a },
+			OnClose:   func() (err error) { return nil },
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		s := &Server{
+			conf: ServerConfig{
+				Config: Config{
+					UpstreamBindings: map[string]*UpstreamBinding{
+						addr: {SourceIP: netip.MustParseAddr("127.0.0.1")},
+					},
+				},
+				UpstreamTimeout: testTimeout,
+			},
+		}
+
+		unbound := newUpstream("tls://dns.example")
+		uc := &proxy.UpstreamConfig{
+			Upstreams: []upstream.Upstream{newUpstream(addr), unbound},
+		}
+
+		err = s.bindUpstreams(uc)
+		require.NoError(t, err)
+
+		require.Len(t, uc.Upstreams, 2)
+		assert.Same(t, unbound, uc.Upstreams[1])
+
+		req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+		resp, exchErr := uc.Upstreams[0].Exchange(req)
+		require.NoError(t, exchErr)
+
+		assert.False(t, resp.Truncated)
+
+		network, _ := testutil.RequireReceive(t, networks, testTimeout)
+		assert.Equal(t, "udp", network)
+
+		network, _ = testutil.RequireReceive(t, networks, testTimeout)
+		assert.Equal(t, "tcp", network)
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		s := &Server{
+			conf: ServerConfig{
+				Config: Config{
+					UpstreamProxy: "socks5://127.0.0.1:1080",
+					UpstreamBindings: map[string]*UpstreamBinding{
+						addr: {Interface: "eth0"},
+					},
+				},
+				UpstreamTimeout: testTimeout,
+			},
+		}
+
+		uc := &proxy.UpstreamConfig{
+			Upstreams: []upstream.Upstream{newUpstream(addr)},
+		}
+
+		err = s.bindUpstreams(uc)
+		testutil.AssertErrorMsg(
+			t,
+			`upstream "`+addr+`": binding cannot be used with upstream proxy`,
+			err,
+		)
+	})
+}
@@ -0,0 +1,633 @@
+package dnsforward
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// UpstreamConnectionsConfig is the configuration of reusing the connections to
+// the plain DNS-over-TCP and DNS-over-TLS upstreams.
+type UpstreamConnectionsConfig struct {
+	// Enabled, if true, makes the queries to the TCP and DNS-over-TLS
+	// upstreams reuse the connections.
+	Enabled bool `yaml:"enabled"`
+
+	// IdleTimeout is the time after the last response, after which an idle
+	// connection is closed.  It must be positive.
+	IdleTimeout timeutil.Duration `yaml:"idle_timeout"`
+
+	// MaxIdle is the maximum number of the idle connections kept for each
+	// upstream.  It must be positive, unless Pipelining is true, in which case
+	// it isn't used.
+	MaxIdle uint `yaml:"max_idle"`
+
+	// Pipelining, if true, makes all queries to an upstream share a single
+	// connection without waiting for the responses to the previous queries,
+	// as described in RFC 7766.
+	Pipelining bool `yaml:"pipelining"`
+}
+
+// validate returns an error if c isn't valid.  A nil c is valid.
+func (c *UpstreamConnectionsConfig) validate() (err error) {
+	switch {
+	case c == nil || !c.Enabled:
+		return nil
+	case c.IdleTimeout <= 0:
+		return fmt.Errorf("idle_timeout: %w: %s", errors.ErrNotPositive, c.IdleTimeout)
+	case c.MaxIdle == 0 && !c.Pipelining:
+		return fmt.Errorf("max_idle: %w", errors.ErrNotPositive)
+	default:
+		return nil
+	}
+}
+
+// pooledConn is a connection to an upstream, which can be used for several
+// exchanges.
+type pooledConn struct {
+	// conn is the underlying connection.
+	conn *dns.Conn
+
+	// done is closed when the connection fails.
+	done chan struct{}
+
+	// writeMu serializes the writes to conn.
+	writeMu *sync.Mutex
+
+	// mu protects pending and err.
+	mu *sync.Mutex
+
+	// pending are the channels for the responses to the sent queries by their
+	// IDs.
+	pending map[uint16]chan *dns.Msg
+
+	// err is the error, with which the connection failed.
+	err error
+
+	// idleTimeout is the time after the last response, after which the
+	// connection is closed.
+	idleTimeout time.Duration
+}
+
+// newPooledConn returns a new *pooledConn over conn and starts reading the
+// responses.
+func newPooledConn(conn net.Conn, idleTimeout time.Duration) (c *pooledConn) {
+	c = &pooledConn{
+		conn:        &dns.Conn{Conn: conn, UDPSize: dns.MaxMsgSize},
+		done:        make(chan struct{}),
+		writeMu:     &sync.Mutex{},
+		mu:          &sync.Mutex{},
+		pending:     map[uint16]chan *dns.Msg{},
+		idleTimeout: idleTimeout,
+	}
+
+	go c.readLoop()
+
+	return c
+}
+
+// readLoop reads the responses and dispatches them to the waiting exchanges
+// until the connection fails.
+func (c *pooledConn) readLoop() {
+	for {
+		resp, err := c.conn.ReadMsg()
+		if err != nil {
+			c.close(err)
+
+			return
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.Id]
+		delete(c.pending, resp.Id)
+		idle := len(c.pending) == 0
+		c.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+
+		if idle {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+		}
+	}
+}
+
+// close closes the connection with err, unless it's already closed.
+func (c *pooledConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	close(c.done)
+
+	_ = c.conn.Close()
+}
+
+// isClosed returns true if the connection is closed.
+func (c *pooledConn) isClosed() (ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err != nil
+}
+
+// exchange sends req over the connection and waits for the response.  The ID
+// of the sent query is changed, if it's already used by another pending query.
+func (c *pooledConn) exchange(
+	ctx context.Context,
+	req *dns.Msg,
+	timeout time.Duration,
+) (resp *dns.Msg, err error) {
+	ch := make(chan *dns.Msg, 1)
+
+	id := req.Id
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+
+		return nil, fmt.Errorf("connection closed: %w", c.err)
+	}
+
+	for _, ok := c.pending[id]; ok; _, ok = c.pending[id] {
+		id = dns.Id()
+	}
+
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	sent := req
+	if id != req.Id {
+		sent = req.Copy()
+		sent.Id = id
+	}
+
+	err = c.write(sent, timeout)
+	if err != nil {
+		c.close(err)
+
+		return nil, fmt.Errorf("writing request: %w", err)
+	}
+
+	select {
+	case resp = <-ch:
+		resp.Id = req.Id
+
+		return resp, nil
+	case <-c.done:
+		return nil, fmt.Errorf("reading response: %w", c.err)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("reading response: %w", ctx.Err())
+	}
+}
+
+// write writes req to the connection and extends the read deadline to wait for
+// the response.
+func (c *pooledConn) write(req *dns.Msg, timeout time.Duration) (err error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	now := time.Now()
+	err = c.conn.SetWriteDeadline(now.Add(timeout))
+	if err != nil {
+		return err
+	}
+
+	err = c.conn.WriteMsg(req)
+	if err != nil {
+		return err
+	}
+
+	return c.conn.SetReadDeadline(now.Add(timeout + c.idleTimeout))
+}
+
+// pooledUpstream is a plain DNS-over-TCP or DNS-over-TLS upstream reusing the
+// connections.
+type pooledUpstream struct {
+	// conf is the common configuration.  It must not be nil.
+	conf *proxiedUpstreamConfig
+
+	// poolConf is the configuration of reusing the connections.  It must not
+	// be nil.
+	poolConf *UpstreamConnectionsConfig
+
+	// tlsConf is the TLS configuration.  It is nil for plain DNS.
+	tlsConf *tls.Config
+
+	// mu protects conns.
+	mu *sync.Mutex
+
+	// conns are the idle connections or, if the pipelining is enabled, the
+	// shared connection.
+	conns []*pooledConn
+
+	// dialed is the number of the opened connections.
+	dialed *atomic.Uint64
+
+	// reused is the number of the exchanges over the already opened
+	// connections.
+	reused *atomic.Uint64
+
+	// addr is the original address of the upstream.
+	addr string
+
+	// host is the host and port of the upstream.
+	host string
+}
+
+// newPooledUpstream returns a new *pooledUpstream.  conf and poolConf must not
+// be nil.
+func newPooledUpstream(
+	conf *proxiedUpstreamConfig,
+	poolConf *UpstreamConnectionsConfig,
+	tlsConf *tls.Config,
+	addr string,
+	host string,
+) (u *pooledUpstream) {
+	return &pooledUpstream{
+		conf:     conf,
+		poolConf: poolConf,
+		tlsConf:  tlsConf,
+		mu:       &sync.Mutex{},
+		dialed:   &atomic.Uint64{},
+		reused:   &atomic.Uint64{},
+		addr:     addr,
+		host:     host,
+	}
+}
+
+// type check
+var _ upstream.Upstream = (*pooledUpstream)(nil)
+
+// Address implements the [upstream.Upstream] interface for *pooledUpstream.
+func (u *pooledUpstream) Address() (addr string) {
+	return u.addr
+}
+
+// Exchange implements the [upstream.Upstream] interface for *pooledUpstream.
+// It retries the exchange over a new connection once, if the reused one
+// fails, since the upstream may have closed it.
+func (u *pooledUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), u.conf.timeout)
+	defer cancel()
+
+	c, reused, err := u.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err = c.exchange(ctx, req, u.conf.timeout)
+	if err != nil && reused && ctx.Err() == nil {
+		c, _, err = u.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err = c.exchange(ctx, req, u.conf.timeout)
+	}
+
+	u.put(c, err)
+
+	return resp, err
+}
+
+// get returns a connection, opening a new one, if there is none to reuse.
+func (u *pooledUpstream) get(ctx context.Context) (c *pooledConn, reused bool, err error) {
+	u.mu.Lock()
+	u.conns = slices.DeleteFunc(u.conns, (*pooledConn).isClosed)
+	if len(u.conns) > 0 {
+		if u.poolConf.Pipelining {
+			c = u.conns[0]
+		} else {
+			c = u.conns[len(u.conns)-1]
+			u.conns = u.conns[:len(u.conns)-1]
+		}
+	}
+	u.mu.Unlock()
+
+	if c != nil {
+		u.reused.Add(1)
+
+		return c, true, nil
+	}
+
+	return u.dial(ctx)
+}
+
+// dial opens a new connection.  If the pipelining is enabled, it becomes the
+// shared one.
+func (u *pooledUpstream) dial(ctx context.Context) (c *pooledConn, reused bool, err error) {
+	conn, err := u.conf.dialer.DialContext(ctx, "tcp", u.host)
+	if err != nil {
+		return nil, false, fmt.Errorf("dialing %s: %w", u.host, err)
+	}
+
+	if u.tlsConf != nil {
+		tlsConn := tls.Client(conn, u.tlsConf)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			_ = conn.Close()
+
+			return nil, false, fmt.Errorf("tls handshake: %w", err)
+		}
+
+		conn = tlsConn
+	}
+
+	u.dialed.Add(1)
+	c = newPooledConn(conn, time.Duration(u.poolConf.IdleTimeout))
+
+	if u.poolConf.Pipelining {
+		u.mu.Lock()
+		u.conns = append(u.conns, c)
+		u.mu.Unlock()
+	}
+
+	return c, false, nil
+}
+
+// put returns c to the idle connections, if the exchange over it hasn't
+// failed with err and the limit isn't reached.  Otherwise, c is closed.
+func (u *pooledUpstream) put(c *pooledConn, err error) {
+	if c == nil || u.poolConf.Pipelining {
+		return
+	}
+
+	if err != nil {
+		c.close(err)
+
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if uint(len(u.conns)) < u.poolConf.MaxIdle {
+		u.conns = append(u.conns, c)
+	} else {
+		c.close(net.ErrClosed)
+	}
+}
+
+// Close implements the [upstream.Upstream] interface for *pooledUpstream.
+func (u *pooledUpstream) Close() (err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, c := range u.conns {
+		c.close(net.ErrClosed)
+	}
+
+	u.conns = nil
+
+	return nil
+}
+
+// withTimeout returns a copy of u with the timeout of each exchange and a
+// separate pool of the connections.
+func (u *pooledUpstream) withTimeout(timeout time.Duration) (res *pooledUpstream) {
+	conf := *u.conf
+	conf.timeout = timeout
+
+	return newPooledUpstream(&conf, u.poolConf, u.tlsConf, u.addr, u.host)
+}
+
+// idleConns returns the number of the open connections in the pool.
+func (u *pooledUpstream) openConns() (n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, c := range u.conns {
+		if !c.isClosed() {
+			n++
+		}
+	}
+
+	return n
+}
+
+// bootstrapDialer is an [aghnet.ContextDialer] resolving the host names of the
+// upstreams using the bootstrap resolver.
+type bootstrapDialer struct {
+	// resolver resolves the host names.  If nil, the system resolver is used.
+	resolver upstream.Resolver
+
+	// dialer connects to the resolved addresses.  It must not be nil.
+	dialer *net.Dialer
+}
+
+// DialContext implements the [aghnet.ContextDialer] interface for
+// *bootstrapDialer.
+func (d *bootstrapDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (conn net.Conn, err error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = netip.ParseAddr(host); err == nil || d.resolver == nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := d.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %q: %w", host, err)
+	} else if len(ips) == 0 {
+		return nil, fmt.Errorf("resolving %q: no addresses", host)
+	}
+
+	return d.dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].String(), port))
+}
+
+// newDirectPooledUpstream returns a pooled upstream for the plain DNS-over-TCP
+// or DNS-over-TLS upstream with addr created with opts.  ok is false if addr
+// is not one of those.
+func (s *Server) newDirectPooledUpstream(
+	addr string,
+	opts *upstream.Options,
+) (u *pooledUpstream, ok bool, err error) {
+	scheme, _, found := strings.Cut(addr, "://")
+	if !found || (scheme != "tcp" && scheme != "tls") {
+		return nil, false, nil
+	}
+
+	parsed, err := url.Parse(addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("parsing address: %w", err)
+	}
+
+	host := parsed.Host
+	if parsed.Port() == "" {
+		port := "53"
+		if scheme == "tls" {
+			port = "853"
+		}
+
+		host = net.JoinHostPort(parsed.Hostname(), port)
+	}
+
+	conf := &proxiedUpstreamConfig{
+		dialer: &bootstrapDialer{
+			resolver: opts.Bootstrap,
+			dialer:   &net.Dialer{Timeout: opts.Timeout},
+		},
+		rootCAs:      opts.RootCAs,
+		cipherSuites: opts.CipherSuites,
+		upstreamTLS:  s.upstreamTLS,
+		timeout:      opts.Timeout,
+	}
+
+	var tlsConf *tls.Config
+	if scheme == "tls" {
+		tlsConf = conf.tlsConfig(addr, parsed.Hostname())
+	}
+
+	return newPooledUpstream(conf, s.conf.UpstreamConnections, tlsConf, addr, host), true, nil
+}
+
+// poolUpstreams replaces the plain DNS-over-TCP and DNS-over-TLS upstreams of
+// uc with the ones reusing the connections, if enabled by
+// [Config.UpstreamConnections].  opts are the options used to create the
+// upstreams of uc.  uc may be nil.
+func (s *Server) poolUpstreams(uc *proxy.UpstreamConfig, opts *upstream.Options) (err error) {
+	conf := s.conf.UpstreamConnections
+	if conf == nil || !conf.Enabled || uc == nil {
+		return nil
+	}
+
+	var errs []error
+	mapUpstreams(uc, func(u upstream.Upstream) (res upstream.Upstream) {
+		switch u := u.(type) {
+		case *streamProxiedUpstream:
+			if u.network != "tcp" {
+				return u
+			}
+
+			return newPooledUpstream(u.conf, conf, u.tlsConf, u.addr, u.host)
+		case *dohProxiedUpstream:
+			return u
+		default:
+			addr := u.Address()
+			pu, ok, pErr := s.newDirectPooledUpstream(addr, opts)
+			if pErr != nil {
+				errs = append(errs, fmt.Errorf("upstream %q: %w", addr, pErr))
+			}
+
+			if !ok {
+				return u
+			}
+
+			// The original upstream hasn't been used yet, so the error is not
+			// important.
+			_ = u.Close()
+
+			return pu
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// pooledUpstreams returns the pooled upstreams of uc, including the ones
+// wrapped to retry the exchanges.  uc may be nil.
+func pooledUpstreams(uc *proxy.UpstreamConfig) (ups []*pooledUpstream) {
+	if uc == nil {
+		return nil
+	}
+
+	mapUpstreams(uc, func(u upstream.Upstream) (res upstream.Upstream) {
+		inner := u
+		if ru, ok := u.(*retryUpstream); ok {
+			inner = ru.Upstream
+		}
+
+		if pu, ok := inner.(*pooledUpstream); ok && !slices.Contains(ups, pu) {
+			ups = append(ups, pu)
+		}
+
+		return u
+	})
+
+	return ups
+}
+
+// upstreamConnectionsJSON is the JSON structure for the GET
+// /control/upstreams/connections HTTP API.
+type upstreamConnectionsJSON struct {
+	// Upstreams are the statistics of the upstreams reusing the connections
+	// sorted by their addresses.
+	Upstreams []*upstreamConnectionJSON `json:"upstreams"`
+}
+
+// upstreamConnectionJSON is the JSON structure for the statistics of the
+// connections to a single upstream.
+type upstreamConnectionJSON struct {
+	// Address is the address of the upstream.
+	Address string `json:"address"`
+
+	// Dialed is the number of the opened connections.
+	Dialed uint64 `json:"dialed"`
+
+	// Reused is the number of the exchanges over the already opened
+	// connections.
+	Reused uint64 `json:"reused"`
+
+	// Open is the current number of the open connections in the pool.
+	Open int `json:"open"`
+}
+
+// handleUpstreamConnections is the handler for the GET
+// /control/upstreams/connections HTTP API.
+func (s *Server) handleUpstreamConnections(w http.ResponseWriter, r *http.Request) {
+	s.serverLock.RLock()
+	ups := slices.Clone(s.pooledUpstreams)
+	s.serverLock.RUnlock()
+
+	resp := &upstreamConnectionsJSON{
+		Upstreams: make([]*upstreamConnectionJSON, 0, len(ups)),
+	}
+
+	for _, u := range ups {
+		resp.Upstreams = append(resp.Upstreams, &upstreamConnectionJSON{
+			Address: u.addr,
+			Dialed:  u.dialed.Load(),
+			Reused:  u.reused.Load(),
+			Open:    u.openConns(),
+		})
+	}
+
+	slices.SortStableFunc(resp.Upstreams, func(a, b *upstreamConnectionJSON) (res int) {
+		return strings.Compare(a.Address, b.Address)
+	})
+
+	aghhttp.WriteJSONResponseOK(r.Context(), s.logger, w, r, resp)
+}
@@ -0,0 +1,192 @@
+package dnsforward
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamConnectionsConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *UpstreamConnectionsConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf:       &UpstreamConnectionsConfig{},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &UpstreamConnectionsConfig{
+			Enabled:     true,
+			IdleTimeout: timeutil.Duration(time.Minute),
+			MaxIdle:     2,
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &UpstreamConnectionsConfig{
+			Enabled:     true,
+			IdleTimeout: timeutil.Duration(time.Minute),
+			Pipelining:  true,
+		},
+		name:       "pipelining",
+		wantErrMsg: "",
+	}, {
+		conf: &UpstreamConnectionsConfig{
+			Enabled: true,
+			MaxIdle: 2,
+		},
+		name:       "no_idle_timeout",
+		wantErrMsg: "idle_timeout: not positive: 0s",
+	}, {
+		conf: &UpstreamConnectionsConfig{
+			Enabled:     true,
+			IdleTimeout: timeutil.Duration(time.Minute),
+		},
+		name:       "no_max_idle",
+		wantErrMsg: "max_idle: not positive",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
+
+// countingListener is a [net.Listener] counting the accepted connections.
+type countingListener struct {
+	net.Listener
+
+	// accepted is the number of the accepted connections.
+	accepted *atomic.Int64
+}
+
+// Accept implements the [net.Listener] interface for *countingListener.
+func (l *countingListener) Accept() (conn net.Conn, err error) {
+	conn, err = l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+
+	return conn, err
+}
+
+func TestPooledUpstream_Exchange(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	accepted := &atomic.Int64{}
+	srv := &dns.Server{
+		Listener: &countingListener{Listener: l, accepted: accepted},
+		Net:      "tcp",
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			_ = w.WriteMsg((&dns.Msg{}).SetReply(req))
+		}),
+		IdleTimeout: func() (d time.Duration) { return time.Minute },
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	testutil.CleanupAndRequireSuccess(t, srv.Shutdown)
+
+	addr := "tcp://" + l.Addr().String()
+
+	newUps := func(poolConf *UpstreamConnectionsConfig) (u *pooledUpstream) {
+		s := &Server{conf: ServerConfig{Config: Config{UpstreamConnections: poolConf}}}
+		opts := &upstream.Options{Timeout: testTimeout}
+
+		u, ok, uErr := s.newDirectPooledUpstream(addr, opts)
+		require.NoError(t, uErr)
+		require.True(t, ok)
+		testutil.CleanupAndRequireSuccess(t, u.Close)
+
+		return u
+	}
+
+	req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+
+	t.Run("reuse", func(t *testing.T) {
+		accepted.Store(0)
+		u := newUps(&UpstreamConnectionsConfig{
+			Enabled:     true,
+			IdleTimeout: timeutil.Duration(time.Minute),
+			MaxIdle:     1,
+		})
+
+		for range 3 {
+			resp, exErr := u.Exchange(req)
+			require.NoError(t, exErr)
+			assert.Equal(t, req.Id, resp.Id)
+		}
+
+		assert.Equal(t, uint64(1), u.dialed.Load())
+		assert.Equal(t, uint64(2), u.reused.Load())
+		assert.Equal(t, 1, u.openConns())
+		assert.Equal(t, int64(1), accepted.Load())
+	})
+
+	t.Run("pipelining", func(t *testing.T) {
+		accepted.Store(0)
+		u := newUps(&UpstreamConnectionsConfig{
+			Enabled:     true,
+			IdleTimeout: timeutil.Duration(time.Minute),
+			Pipelining:  true,
+		})
+
+		// Open the shared connection.
+		_, err = u.Exchange(req)
+		require.NoError(t, err)
+
+		const n = 10
+
+		wg := &sync.WaitGroup{}
+		errs := make([]error, n)
+		for i := range n {
+			wg.Go(func() {
+				_, errs[i] = u.Exchange(req)
+			})
+		}
+
+		wg.Wait()
+
+		for _, exErr := range errs {
+			assert.NoError(t, exErr)
+		}
+
+		assert.Equal(t, uint64(1), u.dialed.Load())
+		assert.Equal(t, uint64(n), u.reused.Load())
+		assert.Equal(t, int64(1), accepted.Load())
+	})
+
+	t.Run("idle_timeout", func(t *testing.T) {
+		u := newUps(&UpstreamConnectionsConfig{
+			Enabled:     true,
+			IdleTimeout: timeutil.Duration(10 * time.Millisecond),
+			MaxIdle:     1,
+		})
+
+		_, err = u.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() (ok bool) {
+			return u.openConns() == 0
+		}, testTimeout, testTimeout/100)
+
+		_, err = u.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, uint64(2), u.dialed.Load())
+	})
+}
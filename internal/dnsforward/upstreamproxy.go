@@ -0,0 +1,414 @@
+package dnsforward
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/miekg/dns"
+)
+
+// upstreamProxyDirect is the value of [Config.UpstreamProxies], which disables
+// the proxy for an upstream.
+const upstreamProxyDirect = "direct"
+
+// dnsMessageMIME is the MIME type of the DNS-over-HTTPS messages.
+const dnsMessageMIME = "application/dns-message"
+
+// proxiedUpstreamConfig is the common configuration of the upstreams connecting
+// through a proxy server or a bound dialer.
+type proxiedUpstreamConfig struct {
+	// dialer connects to the proxy servers or the upstreams.  It must not be
+	// nil.
+	dialer aghnet.ContextDialer
+
+	// rootCAs are the root certificates for the encrypted upstreams.
+	rootCAs *x509.CertPool
+
+	// cipherSuites are the cipher suites for the encrypted upstreams.
+	cipherSuites []uint16
+
+	// upstreamTLS are the custom TLS settings of the encrypted upstreams by
+	// their addresses.  It must not be modified.
+	upstreamTLS map[string]*upstreamTLS
+
+	// timeout is the timeout of a single exchange.
+	timeout time.Duration
+
+	// udp, if true, makes the plain DNS upstreams with the udp scheme use UDP.
+	// It's false for the proxies, since they only forward TCP connections.
+	udp bool
+}
+
+// tlsConfig returns the TLS configuration for the upstream with the address
+// addr and the host name host.
+func (c *proxiedUpstreamConfig) tlsConfig(addr, host string) (conf *tls.Config) {
+	conf = &tls.Config{
+		ServerName:   host,
+		RootCAs:      c.rootCAs,
+		CipherSuites: c.cipherSuites,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	c.upstreamTLS[addr].apply(conf)
+
+	return conf
+}
+
+// newProxiedUpstream returns an upstream for addr, which is the address
+// returned by [upstream.Upstream.Address], connecting through the proxy.  Plain
+// DNS is sent over TCP unless conf.udp is true.
+func newProxiedUpstream(
+	conf *proxiedUpstreamConfig,
+	addr string,
+) (u upstream.Upstream, err error) {
+	rawURL := addr
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "udp://" + rawURL
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing address: %w", err)
+	}
+
+	switch parsed.Scheme {
+	case "udp", "tcp":
+		network := "tcp"
+		if parsed.Scheme == "udp" && conf.udp {
+			network = "udp"
+		}
+
+		return &streamProxiedUpstream{
+			conf:    conf,
+			addr:    addr,
+			host:    parsed.Host,
+			network: network,
+		}, nil
+	case "tls":
+		return &streamProxiedUpstream{
+			conf:    conf,
+			addr:    addr,
+			host:    parsed.Host,
+			network: "tcp",
+			tlsConf: conf.tlsConfig(addr, parsed.Hostname()),
+		}, nil
+	case "https":
+		return newDoHProxiedUpstream(conf, addr, parsed), nil
+	default:
+		return nil, fmt.Errorf("scheme %q is not supported", parsed.Scheme)
+	}
+}
+
+// streamProxiedUpstream is a plain DNS or DNS-over-TLS upstream connecting
+// through a proxy or a bound dialer.  It uses a new connection for each
+// exchange.
+type streamProxiedUpstream struct {
+	// conf is the common configuration.  It must not be nil.
+	conf *proxiedUpstreamConfig
+
+	// tlsConf is the TLS configuration.  It is nil for plain DNS.
+	tlsConf *tls.Config
+
+	// addr is the original address of the upstream.
+	addr string
+
+	// host is the host and port of the upstream.
+	host string
+
+	// network is the network of the connections, either "tcp" or "udp".
+	network string
+}
+
+// type check
+var _ upstream.Upstream = (*streamProxiedUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for
+// *streamProxiedUpstream.
+func (u *streamProxiedUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	resp, err = u.exchange(req, u.network)
+	if err == nil && resp.Truncated && u.network == "udp" {
+		return u.exchange(req, "tcp")
+	}
+
+	return resp, err
+}
+
+// exchange sends req over a new connection of the network.
+func (u *streamProxiedUpstream) exchange(req *dns.Msg, network string) (resp *dns.Msg, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), u.conf.timeout)
+	defer cancel()
+
+	var conn net.Conn
+	conn, err = u.conf.dialer.DialContext(ctx, network, u.host)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", u.host, err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return nil, fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+
+	if u.tlsConf != nil {
+		tlsConn := tls.Client(conn, u.tlsConf)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+
+		conn = tlsConn
+	}
+
+	dnsConn := &dns.Conn{Conn: conn, UDPSize: dns.MaxMsgSize}
+	err = dnsConn.WriteMsg(req)
+	if err != nil {
+		return nil, fmt.Errorf("writing request: %w", err)
+	}
+
+	resp, err = dnsConn.ReadMsg()
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.Id != req.Id {
+		return nil, dns.ErrId
+	}
+
+	return resp, nil
+}
+
+// Address implements the [upstream.Upstream] interface for
+// *streamProxiedUpstream.
+func (u *streamProxiedUpstream) Address() (addr string) {
+	return u.addr
+}
+
+// Close implements the [upstream.Upstream] interface for
+// *streamProxiedUpstream.
+func (u *streamProxiedUpstream) Close() (err error) {
+	return nil
+}
+
+// dohProxiedUpstream is a DNS-over-HTTPS upstream connecting through a proxy.
+type dohProxiedUpstream struct {
+	// client sends the requests.  It must not be nil.
+	client *http.Client
+
+	// url is the URL of the upstream.
+	url *url.URL
+}
+
+// newDoHProxiedUpstream returns a new DNS-over-HTTPS upstream for u with the
+// original address addr.  conf must not be nil.
+func newDoHProxiedUpstream(
+	conf *proxiedUpstreamConfig,
+	addr string,
+	u *url.URL,
+) (ups *dohProxiedUpstream) {
+	return &dohProxiedUpstream{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:       conf.dialer.DialContext,
+				TLSClientConfig:   conf.tlsConfig(addr, u.Hostname()),
+				ForceAttemptHTTP2: true,
+				IdleConnTimeout:   5 * time.Minute,
+			},
+			Timeout: conf.timeout,
+		},
+		url: u,
+	}
+}
+
+// type check
+var _ upstream.Upstream = (*dohProxiedUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for
+// *dohProxiedUpstream.
+func (u *dohProxiedUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	// Per RFC 8484, the ID should be zero to improve the cacheability.
+	id := req.Id
+	req = req.Copy()
+	req.Id = 0
+
+	packed, err := req.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		u.url.String(),
+		bytes.NewReader(packed),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating http request: %w", err)
+	}
+
+	httpReq.Header.Set(httphdr.ContentType, dnsMessageMIME)
+	httpReq.Header.Set(httphdr.Accept, dnsMessageMIME)
+
+	httpResp, err := u.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("sending http request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, httpResp.Body.Close()) }()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %q", httpResp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	resp = &dns.Msg{}
+	err = resp.Unpack(body)
+	if err != nil {
+		return nil, fmt.Errorf("unpacking response: %w", err)
+	}
+
+	resp.Id = id
+
+	return resp, nil
+}
+
+// Address implements the [upstream.Upstream] interface for
+// *dohProxiedUpstream.
+func (u *dohProxiedUpstream) Address() (addr string) {
+	return u.url.String()
+}
+
+// Close implements the [upstream.Upstream] interface for *dohProxiedUpstream.
+func (u *dohProxiedUpstream) Close() (err error) {
+	u.client.CloseIdleConnections()
+
+	return nil
+}
+
+// upstreamProxyURL returns the URL of the proxy for the upstream with addr or
+// an empty string if the upstream connects directly.
+func (s *Server) upstreamProxyURL(addr string) (raw string) {
+	raw, ok := s.conf.UpstreamProxies[addr]
+	if !ok {
+		raw = s.conf.UpstreamProxy
+	}
+
+	if raw == upstreamProxyDirect {
+		return ""
+	}
+
+	return raw
+}
+
+// proxyUpstreams replaces the upstreams of uc, which should connect through a
+// proxy, with the proxied ones.  uc may be nil.
+func (s *Server) proxyUpstreams(uc *proxy.UpstreamConfig) (err error) {
+	if uc == nil || (s.conf.UpstreamProxy == "" && len(s.conf.UpstreamProxies) == 0) {
+		return nil
+	}
+
+	confs := map[string]*proxiedUpstreamConfig{}
+	replaced := map[upstream.Upstream]upstream.Upstream{}
+	replace := func(ups []upstream.Upstream) (err error) {
+		for i, u := range ups {
+			if r, ok := replaced[u]; ok {
+				ups[i] = r
+
+				continue
+			}
+
+			addr := u.Address()
+			raw := s.upstreamProxyURL(addr)
+			if raw == "" {
+				continue
+			}
+
+			conf, ok := confs[raw]
+			if !ok {
+				conf, err = s.newProxiedUpstreamConfig(raw)
+				if err != nil {
+					return fmt.Errorf("upstream %q: %w", addr, err)
+				}
+
+				confs[raw] = conf
+			}
+
+			var r upstream.Upstream
+			r, err = newProxiedUpstream(conf, addr)
+			if err != nil {
+				return fmt.Errorf("upstream %q: %w", addr, err)
+			}
+
+			// The original upstream hasn't been used yet, so the error is
+			// not important.
+			_ = u.Close()
+
+			replaced[u], ups[i] = r, r
+		}
+
+		return nil
+	}
+
+	err = replace(uc.Upstreams)
+	if err != nil {
+		return err
+	}
+
+	for _, ups := range uc.DomainReservedUpstreams {
+		err = replace(ups)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		err = replace(ups)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newProxiedUpstreamConfig returns the configuration of the upstreams
+// connecting through the proxy with the URL raw.
+func (s *Server) newProxiedUpstreamConfig(raw string) (conf *proxiedUpstreamConfig, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy url: %w", err)
+	}
+
+	d, err := aghnet.NewProxyDialer(u, s.conf.UpstreamTimeout)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return &proxiedUpstreamConfig{
+		dialer:       d,
+		rootCAs:      s.conf.TLSv12Roots,
+		cipherSuites: s.conf.TLSCiphers,
+		upstreamTLS:  s.upstreamTLS,
+		timeout:      s.conf.UpstreamTimeout,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package dnsforward
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// directDialer is an [aghnet.ContextDialer], which connects directly.
+type directDialer struct{}
+
+// DialContext implements the [aghnet.ContextDialer] interface for
+// directDialer.
+func (directDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (conn net.Conn, err error) {
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+func TestNewProxiedUpstream(t *testing.T) {
+	conf := &proxiedUpstreamConfig{
+		dialer:  directDialer{},
+		timeout: testTimeout,
+	}
+
+	testCases := []struct {
+		name       string
+		addr       string
+		wantErrMsg string
+	}{{
+		name:       "plain",
+		addr:       "1.2.3.4:53",
+		wantErrMsg: "",
+	}, {
+		name:       "tcp",
+		addr:       "tcp://1.2.3.4:53",
+		wantErrMsg: "",
+	}, {
+		name:       "tls",
+		addr:       "tls://dns.example:853",
+		wantErrMsg: "",
+	}, {
+		name:       "https",
+		addr:       "https://dns.example/dns-query",
+		wantErrMsg: "",
+	}, {
+		name:       "quic",
+		addr:       "quic://dns.example:853",
+		wantErrMsg: `scheme "quic" is not supported`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := newProxiedUpstream(conf, tc.addr)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg == "" {
+				assert.Equal(t, tc.addr, u.Address())
+			}
+		})
+	}
+}
+
+func TestStreamProxiedUpstream_Exchange(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dns.Server{
+		Listener: l,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			_ = w.WriteMsg((&dns.Msg{}).SetReply(req))
+		}),
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	testutil.CleanupAndRequireSuccess(t, srv.Shutdown)
+
+	u, err := newProxiedUpstream(&proxiedUpstreamConfig{
+		dialer:  directDialer{},
+		timeout: testTimeout,
+	}, l.Addr().String())
+	require.NoError(t, err)
+
+	req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+	resp, err := u.Exchange(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, req.Id, resp.Id)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+}
+
+func TestServer_UpstreamProxyURL(t *testing.T) {
+	s := &Server{
+		conf: ServerConfig{
+			Config: Config{
+				UpstreamProxy: "socks5://127.0.0.1:1080",
+				UpstreamProxies: map[string]string{
+					"1.1.1.1:53":        "http://127.0.0.1:3128",
+					"tls://dns.example": upstreamProxyDirect,
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, "socks5://127.0.0.1:1080", s.upstreamProxyURL("8.8.8.8:53"))
+	assert.Equal(t, "http://127.0.0.1:3128", s.upstreamProxyURL("1.1.1.1:53"))
+	assert.Empty(t, s.upstreamProxyURL("tls://dns.example"))
+}
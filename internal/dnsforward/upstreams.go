@@ -153,9 +153,40 @@ func setProxyUpstreamMode(
 		conf.FastestPingTimeout = fastestTimeout
 	case UpstreamModeLoadBalance:
 		conf.UpstreamMode = proxy.UpstreamModeLoadBalance
+	case UpstreamModeWeighted, UpstreamModeLatency, UpstreamModeFailover:
+		// These modes are implemented by [upstreamSelector], which is the only
+		// upstream of each list, so the proxy just uses it.
+		conf.UpstreamMode = proxy.UpstreamModeLoadBalance
 	default:
 		return fmt.Errorf("unexpected value %q", upstreamMode)
 	}
 
 	return nil
 }
+
+// mapUpstreams replaces each upstream of uc with the result of f.  f is called
+// once for each distinct upstream, so that the same upstreams are replaced with
+// the same values and are closed once.  uc must not be nil.
+func mapUpstreams(uc *proxy.UpstreamConfig, f func(u upstream.Upstream) (res upstream.Upstream)) {
+	mapped := map[upstream.Upstream]upstream.Upstream{}
+	mapAll := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			res, ok := mapped[u]
+			if !ok {
+				res = f(u)
+				mapped[u] = res
+			}
+
+			ups[i] = res
+		}
+	}
+
+	mapAll(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		mapAll(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		mapAll(ups)
+	}
+}
@@ -0,0 +1,385 @@
+package dnsforward
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+const (
+	// demoteFailures is the number of consecutive failures of an upstream,
+	// after which it's demoted.
+	demoteFailures = 3
+
+	// demoteDuration is the duration, for which a failed upstream is demoted.
+	demoteDuration = 30 * time.Second
+
+	// latencyWeight is the weight of the latest measurement in the
+	// exponentially weighted moving average of the latency of an upstream.
+	latencyWeight = 0.3
+)
+
+// isSelectorMode returns true if mode is implemented by [upstreamSelector]
+// rather than by the proxy.
+func isSelectorMode(mode UpstreamMode) (ok bool) {
+	switch mode {
+	case UpstreamModeWeighted, UpstreamModeLatency, UpstreamModeFailover:
+		return true
+	default:
+		return false
+	}
+}
+
+// upstreamScore is the health and latency data of a single upstream.
+type upstreamScore struct {
+	// demotedUntil is the time until which the upstream is demoted.
+	demotedUntil time.Time
+
+	// latency is the moving average of the latency of the upstream.
+	latency time.Duration
+
+	// weight is the static weight of the upstream.
+	weight uint
+
+	// failures is the number of consecutive failures of the upstream.
+	failures uint
+
+	// totalSucceeded is the total number of successful exchanges.
+	totalSucceeded uint64
+
+	// totalFailed is the total number of failed exchanges.
+	totalFailed uint64
+
+	// down is true if the last health check of the upstream has failed.
+	down bool
+}
+
+// isDemoted returns true if the upstream should only be used when the others
+// fail.
+func (sc *upstreamScore) isDemoted(now time.Time) (ok bool) {
+	return sc.down || now.Before(sc.demotedUntil)
+}
+
+// upstreamScores is the scoreboard of the upstreams shared by all selectors and
+// the health checker of a server.
+type upstreamScores struct {
+	// clock is used to get the current time.  It must not be nil.
+	clock timeutil.Clock
+
+	// mu protects scores.
+	mu *sync.Mutex
+
+	// scores maps the addresses of the upstreams to their scores.
+	scores map[string]*upstreamScore
+
+	// weights are the static weights of the upstreams by their addresses.
+	weights map[string]uint
+}
+
+// newUpstreamScores returns a new properly initialized *upstreamScores.  clock
+// must not be nil.
+func newUpstreamScores(weights map[string]uint, clock timeutil.Clock) (s *upstreamScores) {
+	return &upstreamScores{
+		clock:   clock,
+		mu:      &sync.Mutex{},
+		scores:  map[string]*upstreamScore{},
+		weights: weights,
+	}
+}
+
+// score returns the score for addr, creating it if necessary.  s.mu must be
+// locked.
+func (s *upstreamScores) score(addr string) (sc *upstreamScore) {
+	sc = s.scores[addr]
+	if sc == nil {
+		sc = &upstreamScore{weight: 1}
+		if w, ok := s.weights[addr]; ok {
+			sc.weight = w
+		}
+
+		s.scores[addr] = sc
+	}
+
+	return sc
+}
+
+// record updates the score of the upstream with addr according to the result
+// of an exchange.
+func (s *upstreamScores) record(addr string, elapsed time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc := s.score(addr)
+	if err != nil {
+		sc.totalFailed++
+		sc.failures++
+		if sc.failures >= demoteFailures {
+			sc.demotedUntil = s.clock.Now().Add(demoteDuration)
+		}
+
+		return
+	}
+
+	sc.totalSucceeded++
+	sc.failures = 0
+	sc.demotedUntil = time.Time{}
+	if sc.latency == 0 {
+		sc.latency = elapsed
+	} else {
+		sc.latency += time.Duration(latencyWeight * float64(elapsed-sc.latency))
+	}
+}
+
+// setDown sets the health state of the upstream with addr and returns true if
+// it has changed.
+func (s *upstreamScores) setDown(addr string, down bool) (changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc := s.score(addr)
+	changed, sc.down = sc.down != down, down
+
+	return changed
+}
+
+// order returns the indexes of ups in the order, in which they should be
+// tried according to mode.  The demoted upstreams always go last.
+func (s *upstreamScores) order(ups []upstream.Upstream, mode UpstreamMode) (idxs []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	scores := make([]*upstreamScore, len(ups))
+	keys := make([]float64, len(ups))
+	idxs = make([]int, len(ups))
+	for i, u := range ups {
+		idxs[i] = i
+		scores[i] = s.score(u.Address())
+
+		switch mode {
+		case UpstreamModeWeighted:
+			// Use the weighted random sampling, see the A-ES algorithm by
+			// Efraimidis and Spirakis.  The zero weight puts the upstream
+			// last.
+			if w := scores[i].weight; w > 0 {
+				keys[i] = -rand.Float64() / float64(w)
+			}
+		case UpstreamModeLatency:
+			keys[i] = float64(scores[i].latency)
+		default:
+			// Keep the configured order.
+		}
+	}
+
+	slices.SortStableFunc(idxs, func(a, b int) (res int) {
+		aDemoted, bDemoted := scores[a].isDemoted(now), scores[b].isDemoted(now)
+		if aDemoted != bDemoted {
+			if aDemoted {
+				return 1
+			}
+
+			return -1
+		}
+
+		return cmp.Compare(keys[a], keys[b])
+	})
+
+	return idxs
+}
+
+// upstreamSelector is an upstream, which selects one of the wrapped upstreams
+// for each exchange according to the upstream mode.  It falls back to the next
+// upstream if the selected one fails.
+type upstreamSelector struct {
+	// scores is the scoreboard of the upstreams.  It must not be nil.
+	scores *upstreamScores
+
+	// ups are the wrapped upstreams.
+	ups []upstream.Upstream
+
+	// addr is the human-readable representation of the selector.
+	addr string
+
+	// mode is the upstream mode, which must be one of the selector modes.
+	mode UpstreamMode
+}
+
+// newUpstreamSelector returns a new selector of ups.  scores must not be nil.
+// mode must be one of the selector modes.
+func newUpstreamSelector(
+	scores *upstreamScores,
+	mode UpstreamMode,
+	ups []upstream.Upstream,
+) (sel *upstreamSelector) {
+	addrs := make([]string, 0, len(ups))
+	for _, u := range ups {
+		addrs = append(addrs, u.Address())
+	}
+
+	return &upstreamSelector{
+		scores: scores,
+		ups:    ups,
+		addr:   fmt.Sprintf("%s(%s)", mode, strings.Join(addrs, ", ")),
+		mode:   mode,
+	}
+}
+
+// type check
+var _ upstream.Upstream = (*upstreamSelector)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *upstreamSelector.
+func (sel *upstreamSelector) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	var errs []error
+	for _, i := range sel.scores.order(sel.ups, sel.mode) {
+		u := sel.ups[i]
+
+		start := sel.scores.clock.Now()
+		resp, err = u.Exchange(req)
+		sel.scores.record(u.Address(), sel.scores.clock.Now().Sub(start), err)
+		if err == nil {
+			return resp, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", u.Address(), err))
+	}
+
+	return nil, fmt.Errorf("all upstreams failed to exchange request: %w", errors.Join(errs...))
+}
+
+// Address implements the [upstream.Upstream] interface for *upstreamSelector.
+func (sel *upstreamSelector) Address() (addr string) {
+	return sel.addr
+}
+
+// Close implements the [upstream.Upstream] interface for *upstreamSelector.
+func (sel *upstreamSelector) Close() (err error) {
+	var errs []error
+	for _, u := range sel.ups {
+		errs = append(errs, u.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// wrapSelectors replaces each non-empty list of upstreams in uc with a single
+// selector, if the respective mode is a selector one.  mode is used for the
+// general upstreams and domainMode, for the domain-specific ones.  scores and
+// uc must not be nil.
+func wrapSelectors(
+	scores *upstreamScores,
+	uc *proxy.UpstreamConfig,
+	mode UpstreamMode,
+	domainMode UpstreamMode,
+) {
+	wrap := func(ups []upstream.Upstream, m UpstreamMode) (wrapped []upstream.Upstream) {
+		if len(ups) == 0 || !isSelectorMode(m) {
+			return ups
+		}
+
+		return []upstream.Upstream{newUpstreamSelector(scores, m, ups)}
+	}
+
+	uc.Upstreams = wrap(uc.Upstreams, mode)
+	for d, ups := range uc.DomainReservedUpstreams {
+		uc.DomainReservedUpstreams[d] = wrap(ups, domainMode)
+	}
+
+	for d, ups := range uc.SpecifiedDomainUpstreams {
+		uc.SpecifiedDomainUpstreams[d] = wrap(ups, domainMode)
+	}
+}
+
+// upstreamScoreJSON is the JSON representation of the score of an upstream.
+type upstreamScoreJSON struct {
+	// Address is the address of the upstream.
+	Address string `json:"address"`
+
+	// Weight is the static weight of the upstream.
+	Weight uint `json:"weight"`
+
+	// Latency is the moving average of the latency of the upstream in
+	// milliseconds.
+	Latency float64 `json:"latency"`
+
+	// ConsecutiveFailures is the number of consecutive failures.
+	ConsecutiveFailures uint `json:"consecutive_failures"`
+
+	// Succeeded is the total number of successful exchanges.
+	Succeeded uint64 `json:"succeeded"`
+
+	// Failed is the total number of failed exchanges.
+	Failed uint64 `json:"failed"`
+
+	// Demoted is true if the upstream is demoted after failures.
+	Demoted bool `json:"demoted"`
+
+	// Down is true if the last health check of the upstream has failed.
+	Down bool `json:"down"`
+}
+
+// upstreamScoresJSON is the response for the GET /control/upstreams/scores
+// HTTP API.
+type upstreamScoresJSON struct {
+	// Mode is the current upstream mode.
+	Mode UpstreamMode `json:"mode"`
+
+	// Upstreams are the scores of the upstreams sorted by address.  If the mode
+	// isn't implemented by the selector, only the health data is present.
+	Upstreams []*upstreamScoreJSON `json:"upstreams"`
+}
+
+// toJSON returns the JSON representation of the scores.  s may be nil.
+func (s *upstreamScores) toJSON() (upstreams []*upstreamScoreJSON) {
+	upstreams = []*upstreamScoreJSON{}
+	if s == nil {
+		return upstreams
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	for addr, sc := range s.scores {
+		upstreams = append(upstreams, &upstreamScoreJSON{
+			Address:             addr,
+			Weight:              sc.weight,
+			Latency:             float64(sc.latency) / float64(time.Millisecond),
+			ConsecutiveFailures: sc.failures,
+			Succeeded:           sc.totalSucceeded,
+			Failed:              sc.totalFailed,
+			Demoted:             sc.isDemoted(now),
+			Down:                sc.down,
+		})
+	}
+
+	slices.SortFunc(upstreams, func(a, b *upstreamScoreJSON) (res int) {
+		return strings.Compare(a.Address, b.Address)
+	})
+
+	return upstreams
+}
+
+// handleUpstreamScores is the handler for the GET /control/upstreams/scores
+// HTTP API.
+func (s *Server) handleUpstreamScores(w http.ResponseWriter, r *http.Request) {
+	s.serverLock.RLock()
+	resp := &upstreamScoresJSON{
+		Mode:      s.conf.UpstreamMode,
+		Upstreams: s.upstreamScores.toJSON(),
+	}
+	s.serverLock.RUnlock()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), s.logger, w, r, resp)
+}
@@ -0,0 +1,137 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSelectorTestUpstream returns a new upstream with addr, which records its
+// address into used on each exchange and fails if *fail is true.
+func newSelectorTestUpstream(addr string, used *[]string, fail *bool) (u *aghtest.UpstreamMock) {
+	return &aghtest.UpstreamMock{
+		OnAddress: func() (a string) { return addr },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+			*used = append(*used, addr)
+			if *fail {
+				return nil, errors.Error("test error")
+			}
+
+			return (&dns.Msg{}).SetReply(req), nil
+		},
+		OnClose: func() (err error) { return nil },
+	}
+}
+
+func TestUpstreamSelector_failover(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	clock := &faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	}
+
+	var used []string
+	var firstFails, secondFails bool
+	ups := []upstream.Upstream{
+		newSelectorTestUpstream("first", &used, &firstFails),
+		newSelectorTestUpstream("second", &used, &secondFails),
+	}
+
+	scores := newUpstreamScores(nil, clock)
+	sel := newUpstreamSelector(scores, UpstreamModeFailover, ups)
+	assert.Equal(t, "failover(first, second)", sel.Address())
+
+	req := (&dns.Msg{}).SetQuestion("host.example.", dns.TypeA)
+
+	_, err := sel.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, used)
+
+	firstFails = true
+	for range demoteFailures {
+		used = used[:0]
+		_, err = sel.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"first", "second"}, used)
+	}
+
+	// The first upstream is now demoted.
+	used = used[:0]
+	_, err = sel.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second"}, used)
+
+	secondFails = true
+	used = used[:0]
+	_, err = sel.Exchange(req)
+	require.Error(t, err)
+	assert.Equal(t, []string{"second", "first"}, used)
+
+	// The demotion expires.
+	now = now.Add(demoteDuration)
+	firstFails, secondFails = false, false
+	used = used[:0]
+	_, err = sel.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, used)
+
+	got := scores.toJSON()
+	require.Len(t, got, 2)
+
+	assert.Equal(t, "first", got[0].Address)
+	assert.Equal(t, uint64(2), got[0].Succeeded)
+	assert.Equal(t, uint64(demoteFailures+1), got[0].Failed)
+	assert.False(t, got[0].Demoted)
+}
+
+func TestUpstreamSelector_latency(t *testing.T) {
+	var used []string
+	var fail bool
+	fast := newSelectorTestUpstream("fast", &used, &fail)
+	slow := newSelectorTestUpstream("slow", &used, &fail)
+
+	scores := newUpstreamScores(nil, &faketime.Clock{
+		OnNow: func() (n time.Time) { return time.Time{} },
+	})
+	scores.record("fast", time.Millisecond, nil)
+	scores.record("slow", time.Second, nil)
+
+	sel := newUpstreamSelector(scores, UpstreamModeLatency, []upstream.Upstream{slow, fast})
+
+	_, err := sel.Exchange((&dns.Msg{}).SetQuestion("host.example.", dns.TypeA))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"fast"}, used)
+}
+
+func TestUpstreamSelector_weighted(t *testing.T) {
+	var used []string
+	var fail bool
+	ups := []upstream.Upstream{
+		newSelectorTestUpstream("unused", &used, &fail),
+		newSelectorTestUpstream("used", &used, &fail),
+	}
+
+	scores := newUpstreamScores(map[string]uint{
+		"unused": 0,
+		"used":   1,
+	}, &faketime.Clock{
+		OnNow: func() (n time.Time) { return time.Time{} },
+	})
+	sel := newUpstreamSelector(scores, UpstreamModeWeighted, ups)
+
+	req := (&dns.Msg{}).SetQuestion("host.example.", dns.TypeA)
+	for range 10 {
+		_, err := sel.Exchange(req)
+		require.NoError(t, err)
+	}
+
+	assert.NotContains(t, used, "unused")
+}
@@ -0,0 +1,243 @@
+package dnsforward
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// UpstreamTimeoutConfig is the timeout and the retry count of the exchanges
+// with an upstream.
+type UpstreamTimeoutConfig struct {
+	// Timeout is the timeout of a single exchange.  If zero,
+	// [Config.UpstreamTimeout] is used.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// Retries is the number of times a failed exchange is repeated before the
+	// upstream is considered failed.
+	Retries uint `yaml:"retries"`
+}
+
+// validate returns an error if c isn't valid.
+func (c *UpstreamTimeoutConfig) validate() (err error) {
+	switch {
+	case c == nil:
+		return errors.ErrNoValue
+	case c.Timeout < 0:
+		return fmt.Errorf("timeout: %w: %s", errors.ErrNegative, c.Timeout)
+	case c.Timeout == 0 && c.Retries == 0:
+		return fmt.Errorf("timeout and retries: %w", errors.ErrNoValue)
+	default:
+		return nil
+	}
+}
+
+// validateUpstreamTimeouts returns an error if any of confs is invalid.
+func validateUpstreamTimeouts(confs map[string]*UpstreamTimeoutConfig) (err error) {
+	var errs []error
+	for k, c := range confs {
+		err = c.validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", k, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// retryUpstream is an upstream repeating the failed exchanges.
+type retryUpstream struct {
+	upstream.Upstream
+
+	// retries is the number of times a failed exchange is repeated.
+	retries uint
+}
+
+// type check
+var _ upstream.Upstream = (*retryUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *retryUpstream.
+func (u *retryUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	for i := uint(0); ; i++ {
+		resp, err = u.Upstream.Exchange(req)
+		if err == nil || i >= u.retries {
+			return resp, err
+		}
+	}
+}
+
+// timeoutKey is the key of the upstreams replaced according to a timeout
+// configuration.
+type timeoutKey struct {
+	// ups is the original upstream.
+	ups upstream.Upstream
+
+	// conf is the timeout configuration applied to ups.
+	conf *UpstreamTimeoutConfig
+}
+
+// timeoutReplacer replaces the upstreams with the ones using the configured
+// timeouts and retry counts.
+type timeoutReplacer struct {
+	// srv is used to look up the per-upstream settings.  It must not be nil.
+	srv *Server
+
+	// opts are the options used to create the original upstreams.
+	opts *upstream.Options
+
+	// replaced are the already replaced upstreams, so that the same upstreams
+	// with the same configuration are replaced once.
+	replaced map[timeoutKey]upstream.Upstream
+
+	// errs are the errors of creating the upstreams.
+	errs []error
+}
+
+// replaceAll replaces ups using domainConf, if it's not nil, or the
+// per-upstream configurations otherwise.
+func (r *timeoutReplacer) replaceAll(ups []upstream.Upstream, domainConf *UpstreamTimeoutConfig) {
+	for i, u := range ups {
+		conf := domainConf
+		if conf == nil {
+			conf = r.srv.conf.UpstreamTimeouts[u.Address()]
+		}
+
+		if conf == nil {
+			continue
+		}
+
+		k := timeoutKey{ups: u, conf: conf}
+		res, ok := r.replaced[k]
+		if !ok {
+			res = r.replace(u, conf)
+			r.replaced[k] = res
+		}
+
+		ups[i] = res
+	}
+}
+
+// replace returns the upstream for the address of u using conf.  If it fails,
+// the error is recorded and u is returned.
+func (r *timeoutReplacer) replace(u upstream.Upstream, conf *UpstreamTimeoutConfig) (res upstream.Upstream) {
+	res = u
+	if conf.Timeout > 0 {
+		var err error
+		res, err = r.withTimeout(u, time.Duration(conf.Timeout))
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("upstream %q: %w", u.Address(), err))
+
+			return u
+		}
+	}
+
+	if conf.Retries > 0 {
+		res = &retryUpstream{Upstream: res, retries: conf.Retries}
+	}
+
+	return res
+}
+
+// withTimeout returns the copy of u using the timeout of each exchange.
+func (r *timeoutReplacer) withTimeout(
+	u upstream.Upstream,
+	timeout time.Duration,
+) (res upstream.Upstream, err error) {
+	switch u := u.(type) {
+	case *streamProxiedUpstream:
+		conf := *u.conf
+		conf.timeout = timeout
+
+		c := *u
+		c.conf = &conf
+
+		return &c, nil
+	case *pooledUpstream:
+		return u.withTimeout(timeout), nil
+	case *dohProxiedUpstream:
+		client := *u.client
+		client.Timeout = timeout
+
+		return &dohProxiedUpstream{client: &client, url: u.url}, nil
+	default:
+		addr := u.Address()
+
+		o := r.opts.Clone()
+		o.Timeout = timeout
+		r.srv.upstreamTLS[addr].applyOptions(o)
+
+		return upstream.AddressToUpstream(addr, o)
+	}
+}
+
+// closeUnused closes the replaced upstreams, which aren't used in uc anymore.
+func (r *timeoutReplacer) closeUnused(uc *proxy.UpstreamConfig) {
+	used := map[upstream.Upstream]struct{}{}
+	mapUpstreams(uc, func(u upstream.Upstream) (res upstream.Upstream) {
+		used[u] = struct{}{}
+		if ru, ok := u.(*retryUpstream); ok {
+			used[ru.Upstream] = struct{}{}
+		}
+
+		return u
+	})
+
+	for k := range r.replaced {
+		if _, ok := used[k.ups]; !ok {
+			// The original upstream hasn't been used yet, so the error is not
+			// important.
+			_ = k.ups.Close()
+
+			// Don't close the same upstream replaced with several
+			// configurations twice.
+			used[k.ups] = struct{}{}
+		}
+	}
+}
+
+// applyUpstreamTimeouts replaces the upstreams of uc, for which
+// [Config.UpstreamTimeouts] or [DomainUpstreamsConfig.Timeouts] are set, with
+// the ones using the configured timeouts and retry counts.  The per-domain
+// configurations take precedence over the per-upstream ones.  opts are the
+// options used to create the upstreams of uc.  uc may be nil.
+func (s *Server) applyUpstreamTimeouts(uc *proxy.UpstreamConfig, opts *upstream.Options) (err error) {
+	var domainConfs map[string]*UpstreamTimeoutConfig
+	if c := s.conf.DomainUpstreams; c != nil {
+		domainConfs = c.Timeouts
+	}
+
+	if uc == nil || (len(s.conf.UpstreamTimeouts) == 0 && len(domainConfs) == 0) {
+		return nil
+	}
+
+	// Use the format of the domain names in uc.
+	fqdnConfs := make(map[string]*UpstreamTimeoutConfig, len(domainConfs))
+	for d, c := range domainConfs {
+		fqdnConfs[dns.Fqdn(aghnet.NormalizeDomain(d))] = c
+	}
+
+	r := &timeoutReplacer{
+		srv:      s,
+		opts:     opts,
+		replaced: map[timeoutKey]upstream.Upstream{},
+	}
+
+	r.replaceAll(uc.Upstreams, nil)
+	for d, ups := range uc.DomainReservedUpstreams {
+		r.replaceAll(ups, fqdnConfs[d])
+	}
+
+	for d, ups := range uc.SpecifiedDomainUpstreams {
+		r.replaceAll(ups, fqdnConfs[d])
+	}
+
+	r.closeUnused(uc)
+
+	return errors.Join(r.errs...)
+}
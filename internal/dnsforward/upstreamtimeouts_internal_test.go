@@ -0,0 +1,155 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamTimeoutConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *UpstreamTimeoutConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &UpstreamTimeoutConfig{Timeout: timeutil.Duration(time.Second)},
+		name:       "timeout",
+		wantErrMsg: "",
+	}, {
+		conf:       &UpstreamTimeoutConfig{Retries: 1},
+		name:       "retries",
+		wantErrMsg: "",
+	}, {
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "no value",
+	}, {
+		conf:       &UpstreamTimeoutConfig{},
+		name:       "empty",
+		wantErrMsg: "timeout and retries: no value",
+	}, {
+		conf:       &UpstreamTimeoutConfig{Timeout: timeutil.Duration(-time.Second)},
+		name:       "negative",
+		wantErrMsg: "timeout: negative value: -1s",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
+
+func TestRetryUpstream_Exchange(t *testing.T) {
+	const testErr errors.Error = "test error"
+
+	var calls uint
+	var failures uint
+	ups := &aghtest.UpstreamMock{
+		OnAddress: func() (addr string) { return "mock" },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+			calls++
+			if calls <= failures {
+				return nil, testErr
+			}
+
+			return (&dns.Msg{}).SetReply(req), nil
+		},
+	}
+
+	u := &retryUpstream{Upstream: ups, retries: 2}
+	req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+
+	testCases := []struct {
+		wantErr   error
+		name      string
+		failures  uint
+		wantCalls uint
+	}{{
+		wantErr:   nil,
+		name:      "success",
+		failures:  0,
+		wantCalls: 1,
+	}, {
+		wantErr:   nil,
+		name:      "retried",
+		failures:  2,
+		wantCalls: 3,
+	}, {
+		wantErr:   testErr,
+		name:      "failed",
+		failures:  3,
+		wantCalls: 3,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls, failures = 0, tc.failures
+
+			_, err := u.Exchange(req)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantCalls, calls)
+		})
+	}
+}
+
+func TestServer_ApplyUpstreamTimeouts(t *testing.T) {
+	const (
+		mainAddr   = "192.0.2.1:53"
+		corpAddr   = "192.0.2.2:53"
+		corpDomain = "corp.example"
+	)
+
+	opts := &upstream.Options{
+		Logger:  testLogger,
+		Timeout: testTimeout,
+	}
+
+	uc, err := proxy.ParseUpstreamsConfig([]string{
+		mainAddr,
+		"[/" + corpDomain + "/]" + corpAddr,
+	}, opts)
+	require.NoError(t, err)
+
+	origCorp := uc.SpecifiedDomainUpstreams[corpDomain+"."][0]
+
+	s := &Server{
+		conf: ServerConfig{
+			Config: Config{
+				UpstreamTimeouts: map[string]*UpstreamTimeoutConfig{
+					mainAddr: {Retries: 2},
+				},
+				DomainUpstreams: &DomainUpstreamsConfig{
+					Timeouts: map[string]*UpstreamTimeoutConfig{
+						"Corp.Example": {Timeout: timeutil.Duration(8 * time.Second)},
+					},
+				},
+			},
+		},
+	}
+
+	err = s.applyUpstreamTimeouts(uc, opts)
+	require.NoError(t, err)
+
+	require.Len(t, uc.Upstreams, 1)
+
+	ru := testutil.RequireTypeAssert[*retryUpstream](t, uc.Upstreams[0])
+	assert.Equal(t, uint(2), ru.retries)
+	assert.Equal(t, mainAddr, ru.Address())
+
+	corp := uc.SpecifiedDomainUpstreams[corpDomain+"."]
+	require.Len(t, corp, 1)
+
+	assert.NotSame(t, origCorp, corp[0])
+	assert.Equal(t, corpAddr, corp[0].Address())
+	assert.Equal(t, corp, uc.DomainReservedUpstreams[corpDomain+"."])
+}
@@ -0,0 +1,214 @@
+package dnsforward
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// UpstreamTLSConfig is the configuration of the verification of the
+// certificates of an encrypted upstream.  At least one of the fields must be
+// set.
+type UpstreamTLSConfig struct {
+	// SPKIPins are the base64-encoded SHA-256 hashes of the DER-encoded
+	// SubjectPublicKeyInfo of the certificates.  If not empty, at least one of
+	// the certificates in the verified chain must match one of the pins,
+	// otherwise the connection fails.
+	SPKIPins []string `yaml:"spki_pins"`
+
+	// CAFile is the path to the file with the PEM-encoded root certificates,
+	// which are used instead of the system ones.
+	CAFile string `yaml:"ca_file"`
+}
+
+// upstreamTLS is the compiled [UpstreamTLSConfig].
+type upstreamTLS struct {
+	// rootCAs are the custom root certificates.  It's nil if the default ones
+	// are used.
+	rootCAs *x509.CertPool
+
+	// pins are the SHA-256 hashes of the SubjectPublicKeyInfo.  It's nil if
+	// the pinning is disabled.
+	pins *container.MapSet[[sha256.Size]byte]
+}
+
+// newUpstreamTLS returns the compiled TLS settings of the upstreams by their
+// addresses.  It returns an error if any of confs is invalid.
+func newUpstreamTLS(confs map[string]*UpstreamTLSConfig) (res map[string]*upstreamTLS, err error) {
+	if len(confs) == 0 {
+		return nil, nil
+	}
+
+	var errs []error
+	res = make(map[string]*upstreamTLS, len(confs))
+	for addr, c := range confs {
+		t, tErr := newUpstreamTLSFor(addr, c)
+		if tErr != nil {
+			errs = append(errs, fmt.Errorf("upstream %q: %w", addr, tErr))
+
+			continue
+		}
+
+		res[addr] = t
+	}
+
+	return res, errors.Join(errs...)
+}
+
+// newUpstreamTLSFor returns the compiled TLS settings of the upstream with
+// addr.
+func newUpstreamTLSFor(addr string, c *UpstreamTLSConfig) (t *upstreamTLS, err error) {
+	if c == nil || (len(c.SPKIPins) == 0 && c.CAFile == "") {
+		return nil, fmt.Errorf("spki_pins and ca_file: %w", errors.ErrNoValue)
+	} else if !isEncryptedUpstream(addr) {
+		return nil, errors.Error("tls settings cannot be used with plain dns upstream")
+	}
+
+	t = &upstreamTLS{}
+	if c.CAFile != "" {
+		t.rootCAs, err = loadRootCAs(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %w", err)
+		}
+	}
+
+	if len(c.SPKIPins) > 0 {
+		t.pins, err = newSPKIPins(c.SPKIPins)
+		if err != nil {
+			return nil, fmt.Errorf("spki_pins: %w", err)
+		}
+	}
+
+	return t, nil
+}
+
+// loadRootCAs returns the pool of the PEM-encoded certificates from the file
+// at path.
+func loadRootCAs(path string) (pool *x509.CertPool, err error) {
+	// #nosec G304 -- Trust the path explicitly given by the user.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%q: no certificates found", path)
+	}
+
+	return pool, nil
+}
+
+// newSPKIPins decodes the base64-encoded SHA-256 hashes.
+func newSPKIPins(encoded []string) (pins *container.MapSet[[sha256.Size]byte], err error) {
+	var errs []error
+	pins = container.NewMapSet[[sha256.Size]byte]()
+	for i, e := range encoded {
+		pin, dErr := base64.StdEncoding.DecodeString(e)
+		if dErr == nil && len(pin) != sha256.Size {
+			dErr = fmt.Errorf("bad length %d, want %d", len(pin), sha256.Size)
+		}
+
+		if dErr != nil {
+			errs = append(errs, fmt.Errorf("at index %d: %q: %w", i, e, dErr))
+
+			continue
+		}
+
+		pins.Add([sha256.Size]byte(pin))
+	}
+
+	return pins, errors.Join(errs...)
+}
+
+// verifyConnection returns the function verifying the TLS connections to the
+// upstream according to the pins.  It returns nil if t is nil or the pinning
+// is disabled.
+func (t *upstreamTLS) verifyConnection() (f func(state tls.ConnectionState) (err error)) {
+	if t == nil || t.pins == nil {
+		return nil
+	}
+
+	return func(state tls.ConnectionState) (err error) {
+		for _, chain := range state.VerifiedChains {
+			for _, cert := range chain {
+				if t.pins.Has(sha256.Sum256(cert.RawSubjectPublicKeyInfo)) {
+					return nil
+				}
+			}
+		}
+
+		return errors.Error("no certificate matches the spki pins")
+	}
+}
+
+// apply sets the custom TLS settings of t to conf.  t may be nil.
+func (t *upstreamTLS) apply(conf *tls.Config) {
+	if t == nil {
+		return
+	}
+
+	if t.rootCAs != nil {
+		conf.RootCAs = t.rootCAs
+	}
+
+	conf.VerifyConnection = t.verifyConnection()
+}
+
+// applyOptions sets the custom TLS settings of t to o.  t may be nil.
+func (t *upstreamTLS) applyOptions(o *upstream.Options) {
+	if t == nil {
+		return
+	}
+
+	if t.rootCAs != nil {
+		o.RootCAs = t.rootCAs
+	}
+
+	o.VerifyConnection = t.verifyConnection()
+}
+
+// pinUpstreams replaces the upstreams of uc, for which [Config.UpstreamTLS] is
+// set, with the ones verifying the certificates accordingly.  opts are the
+// options used to create the upstreams of uc.  uc may be nil.
+func (s *Server) pinUpstreams(uc *proxy.UpstreamConfig, opts *upstream.Options) (err error) {
+	if uc == nil || len(s.upstreamTLS) == 0 {
+		return nil
+	}
+
+	var errs []error
+	mapUpstreams(uc, func(u upstream.Upstream) (res upstream.Upstream) {
+		addr := u.Address()
+		t, ok := s.upstreamTLS[addr]
+		if !ok {
+			return u
+		}
+
+		o := opts.Clone()
+		t.applyOptions(o)
+
+		res, pErr := upstream.AddressToUpstream(addr, o)
+		if pErr != nil {
+			errs = append(errs, fmt.Errorf("upstream %q: %w", addr, pErr))
+
+			return u
+		}
+
+		// The original upstream hasn't been used yet, so the error is not
+		// important.
+		_ = u.Close()
+
+		return res
+	})
+
+	return errors.Join(errs...)
+}
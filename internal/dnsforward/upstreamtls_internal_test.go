@@ -0,0 +1,165 @@
+package dnsforward
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUpstreamTLS(t *testing.T) {
+	_, certPem, _ := createServerTLSConfig(t)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, certPem, 0o600)
+	require.NoError(t, err)
+
+	badFile := filepath.Join(t.TempDir(), "bad.pem")
+	err = os.WriteFile(badFile, []byte("not a certificate"), 0o600)
+	require.NoError(t, err)
+
+	pin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	testCases := []struct {
+		conf       *UpstreamTLSConfig
+		name       string
+		addr       string
+		wantErrMsg string
+	}{{
+		conf:       &UpstreamTLSConfig{SPKIPins: []string{pin}, CAFile: caFile},
+		name:       "valid",
+		addr:       "tls://dns.example",
+		wantErrMsg: "",
+	}, {
+		conf:       &UpstreamTLSConfig{},
+		name:       "empty",
+		addr:       "tls://dns.example",
+		wantErrMsg: `upstream "tls://dns.example": spki_pins and ca_file: no value`,
+	}, {
+		conf: &UpstreamTLSConfig{SPKIPins: []string{pin}},
+		name: "plain",
+		addr: "1.2.3.4:53",
+		wantErrMsg: `upstream "1.2.3.4:53": ` +
+			`tls settings cannot be used with plain dns upstream`,
+	}, {
+		conf: &UpstreamTLSConfig{SPKIPins: []string{"AAAA"}},
+		name: "bad_pin_length",
+		addr: "https://dns.example/dns-query",
+		wantErrMsg: `upstream "https://dns.example/dns-query": spki_pins: ` +
+			`at index 0: "AAAA": bad length 3, want 32`,
+	}, {
+		conf: &UpstreamTLSConfig{CAFile: badFile},
+		name: "bad_ca_file",
+		addr: "quic://dns.example",
+		wantErrMsg: fmt.Sprintf(
+			`upstream "quic://dns.example": ca_file: %q: no certificates found`,
+			badFile,
+		),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, tErr := newUpstreamTLS(map[string]*UpstreamTLSConfig{tc.addr: tc.conf})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tErr)
+		})
+	}
+}
+
+func TestServer_PinUpstreams(t *testing.T) {
+	srvConf, certPem, _ := createServerTLSConfig(t)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", srvConf)
+	require.NoError(t, err)
+
+	srv := &dns.Server{
+		Listener: l,
+		Net:      "tcp-tls",
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			_ = w.WriteMsg((&dns.Msg{}).SetReply(req))
+		}),
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	testutil.CleanupAndRequireSuccess(t, srv.Shutdown)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(caFile, certPem, 0o600)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(certPem)
+	require.NotNil(t, block)
+
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	spki := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	validPin := base64.StdEncoding.EncodeToString(spki[:])
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+
+	addr := "tls://" + net.JoinHostPort(tlsServerName, port)
+	opts := &upstream.Options{
+		Logger:    testLogger,
+		Bootstrap: upstream.StaticResolver{netip.MustParseAddr("127.0.0.1")},
+		Timeout:   testTimeout,
+	}
+
+	testCases := []struct {
+		conf       *UpstreamTLSConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &UpstreamTLSConfig{CAFile: caFile, SPKIPins: []string{validPin}},
+		name:       "pinned",
+		wantErrMsg: "",
+	}, {
+		conf:       &UpstreamTLSConfig{CAFile: caFile},
+		name:       "ca_only",
+		wantErrMsg: "",
+	}, {
+		conf:       &UpstreamTLSConfig{CAFile: caFile, SPKIPins: []string{otherPin}},
+		name:       "pin_mismatch",
+		wantErrMsg: "no certificate matches the spki pins",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{}
+			s.upstreamTLS, err = newUpstreamTLS(map[string]*UpstreamTLSConfig{addr: tc.conf})
+			require.NoError(t, err)
+
+			uc, err := proxy.ParseUpstreamsConfig([]string{addr}, opts)
+			require.NoError(t, err)
+
+			err = s.pinUpstreams(uc, opts)
+			require.NoError(t, err)
+			require.Len(t, uc.Upstreams, 1)
+
+			u := uc.Upstreams[0]
+			testutil.CleanupAndRequireSuccess(t, u.Close)
+
+			_, err = u.Exchange((&dns.Msg{}).SetQuestion("example.com.", dns.TypeA))
+			if tc.wantErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.ErrorContains(t, err, tc.wantErrMsg)
+			}
+		})
+	}
+}
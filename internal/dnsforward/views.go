@@ -0,0 +1,217 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// View is a split-horizon DNS view.  It contains the local records returned to
+// the clients from the specified subnets instead of the upstream responses.
+type View struct {
+	// Name is the name of the view.  It must not be empty and must be unique.
+	Name string `yaml:"name"`
+
+	// Subnets are the subnets of the clients, to which the view applies.  If a
+	// client belongs to subnets of several views, the first of them is used.
+	// It must not be empty.
+	Subnets []netutil.Prefix `yaml:"subnets"`
+
+	// Records are the local records of the view.  It must not be empty.
+	Records []*ViewRecord `yaml:"records"`
+}
+
+// ViewRecord is a single local record of a [View].
+type ViewRecord struct {
+	// Domain is the domain name of the record.  The "*." prefix means that the
+	// record applies to all subdomains of the domain.  The exact domain names
+	// have priority over the wildcard ones.
+	Domain string `yaml:"domain"`
+
+	// Answer is the IP address returned for the domain name.
+	Answer netip.Addr `yaml:"answer"`
+}
+
+// wildcardPrefix is the prefix of the wildcard domain names of the records of
+// the views.
+const wildcardPrefix = "*."
+
+// view is the compiled version of [View].
+type view struct {
+	// records maps lowercased domain names to their addresses.
+	records map[string][]netip.Addr
+
+	// wildcards maps lowercased parent domain names of the wildcard records to
+	// their addresses.
+	wildcards map[string][]netip.Addr
+
+	// name is the name of the view.
+	name string
+
+	// subnets are the subnets of the clients, to which the view applies.
+	subnets []netip.Prefix
+}
+
+// newViews validates conf and returns the compiled views.
+func newViews(conf []*View) (views []*view, err error) {
+	names := container.NewMapSet[string]()
+	for i, c := range conf {
+		var v *view
+		v, err = newView(c)
+		if err != nil {
+			return nil, fmt.Errorf("view at index %d: %w", i, err)
+		}
+
+		if names.Has(v.name) {
+			return nil, fmt.Errorf("view at index %d: duplicate name %q", i, v.name)
+		}
+
+		names.Add(v.name)
+		views = append(views, v)
+	}
+
+	return views, nil
+}
+
+// newView validates c and returns the compiled view.
+func newView(c *View) (v *view, err error) {
+	switch {
+	case c == nil:
+		return nil, errors.ErrNoValue
+	case c.Name == "":
+		return nil, fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case len(c.Subnets) == 0:
+		return nil, fmt.Errorf("subnets: %w", errors.ErrEmptyValue)
+	case len(c.Records) == 0:
+		return nil, fmt.Errorf("records: %w", errors.ErrEmptyValue)
+	}
+
+	v = &view{
+		records:   map[string][]netip.Addr{},
+		wildcards: map[string][]netip.Addr{},
+		name:      c.Name,
+		subnets:   make([]netip.Prefix, 0, len(c.Subnets)),
+	}
+
+	for _, p := range c.Subnets {
+		v.subnets = append(v.subnets, p.Prefix)
+	}
+
+	for i, r := range c.Records {
+		err = v.addRecord(r)
+		if err != nil {
+			return nil, fmt.Errorf("record at index %d: %w", i, err)
+		}
+	}
+
+	return v, nil
+}
+
+// addRecord validates r and adds it to v.
+func (v *view) addRecord(r *ViewRecord) (err error) {
+	if r == nil {
+		return errors.ErrNoValue
+	} else if !r.Answer.IsValid() {
+		return fmt.Errorf("answer: %w", errors.ErrEmptyValue)
+	}
+
+	domain := aghnet.NormalizeDomain(r.Domain)
+	m := v.records
+	if parent, ok := strings.CutPrefix(domain, wildcardPrefix); ok {
+		domain, m = parent, v.wildcards
+	}
+
+	err = netutil.ValidateDomainName(domain)
+	if err != nil {
+		return fmt.Errorf("domain: %w", err)
+	}
+
+	m[domain] = append(m[domain], r.Answer.Unmap())
+
+	return nil
+}
+
+// addrs returns the addresses for host, which must be lowercased and must not
+// have the trailing dot.  ok is false if the view has no records for host.
+func (v *view) addrs(host string) (addrs []netip.Addr, ok bool) {
+	addrs, ok = v.records[host]
+	if ok {
+		return addrs, true
+	}
+
+	for {
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return nil, false
+		}
+
+		host = host[i+1:]
+		addrs, ok = v.wildcards[host]
+		if ok {
+			return addrs, true
+		}
+	}
+}
+
+// viewForAddr returns the first view applying to the client with the address
+// addr or nil if there is none.
+func (s *Server) viewForAddr(addr netip.Addr) (v *view) {
+	addr = addr.Unmap()
+	for _, v = range s.views {
+		for _, p := range v.subnets {
+			if p.Contains(addr) {
+				return v
+			}
+		}
+	}
+
+	return nil
+}
+
+// processViews responds to the requests for the domain names, which have local
+// records in the view applying to the client.  The response for a domain name
+// with the records but without ones of the requested type is empty.
+func (s *Server) processViews(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	if pctx.Res != nil || len(s.views) == 0 {
+		return resultCodeSuccess
+	}
+
+	v := s.viewForAddr(pctx.Addr.Addr())
+	if v == nil {
+		return resultCodeSuccess
+	}
+
+	req := pctx.Req
+	q := req.Question[0]
+	host := aghnet.NormalizeDomain(q.Name)
+	addrs, ok := v.addrs(host)
+	if !ok {
+		return resultCodeSuccess
+	}
+
+	s.logger.DebugContext(ctx, "view record", "view", v.name, "host", host, "qtype", q.Qtype)
+
+	resp := s.replyCompressed(req)
+	for _, addr := range addrs {
+		switch {
+		case q.Qtype == dns.TypeA && addr.Is4():
+			resp.Answer = append(resp.Answer, s.genAnswerA(req, addr))
+		case q.Qtype == dns.TypeAAAA && addr.Is6():
+			resp.Answer = append(resp.Answer, s.genAnswerAAAA(req, addr))
+		default:
+			// Go on.
+		}
+	}
+
+	pctx.Res = resp
+
+	return resultCodeSuccess
+}
@@ -0,0 +1,187 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ProcessViews(t *testing.T) {
+	var (
+		internalIP  = netip.MustParseAddr("192.168.1.1")
+		internalIP6 = netip.MustParseAddr("fd00::1")
+		guestAddr   = netip.MustParseAddrPort("203.0.113.1:53")
+		clientAddr  = netip.MustParseAddrPort("192.168.0.2:53")
+	)
+
+	views, err := newViews([]*View{{
+		Name: "internal",
+		Subnets: []netutil.Prefix{{
+			Prefix: netip.MustParsePrefix("192.168.0.0/24"),
+		}},
+		Records: []*ViewRecord{{
+			Domain: "host.example",
+			Answer: internalIP,
+		}, {
+			Domain: "host.example",
+			Answer: internalIP6,
+		}, {
+			Domain: "*.apps.example",
+			Answer: internalIP,
+		}},
+	}})
+	require.NoError(t, err)
+
+	s := &Server{
+		dnsFilter:  createTestDNSFilter(t),
+		baseLogger: testLogger,
+		logger:     testLogger,
+		views:      views,
+	}
+
+	testCases := []struct {
+		want    []dns.RR
+		name    string
+		host    string
+		addr    netip.AddrPort
+		qtype   uint16
+		wantRes bool
+	}{{
+		want:    []dns.RR{&dns.A{A: internalIP.AsSlice()}},
+		name:    "a",
+		host:    "host.example",
+		addr:    clientAddr,
+		qtype:   dns.TypeA,
+		wantRes: true,
+	}, {
+		want:    []dns.RR{&dns.AAAA{AAAA: internalIP6.AsSlice()}},
+		name:    "aaaa",
+		host:    "HOST.example",
+		addr:    clientAddr,
+		qtype:   dns.TypeAAAA,
+		wantRes: true,
+	}, {
+		want:    nil,
+		name:    "nodata",
+		host:    "host.example",
+		addr:    clientAddr,
+		qtype:   dns.TypeMX,
+		wantRes: true,
+	}, {
+		want:    []dns.RR{&dns.A{A: internalIP.AsSlice()}},
+		name:    "wildcard",
+		host:    "a.b.apps.example",
+		addr:    clientAddr,
+		qtype:   dns.TypeA,
+		wantRes: true,
+	}, {
+		want:    nil,
+		name:    "wildcard_parent",
+		host:    "apps.example",
+		addr:    clientAddr,
+		qtype:   dns.TypeA,
+		wantRes: false,
+	}, {
+		want:    nil,
+		name:    "guest",
+		host:    "host.example",
+		addr:    guestAddr,
+		qtype:   dns.TypeA,
+		wantRes: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := (&dns.Msg{}).SetQuestion(dns.Fqdn(tc.host), tc.qtype)
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:  req,
+					Addr: tc.addr,
+				},
+			}
+
+			rc := s.processViews(testutil.ContextWithTimeout(t, testTimeout), dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			res := dctx.proxyCtx.Res
+			if !tc.wantRes {
+				assert.Nil(t, res)
+
+				return
+			}
+
+			require.NotNil(t, res)
+			assert.Equal(t, dns.RcodeSuccess, res.Rcode)
+			require.Len(t, res.Answer, len(tc.want))
+
+			for i, rr := range res.Answer {
+				switch want := tc.want[i].(type) {
+				case *dns.A:
+					a := testutil.RequireTypeAssert[*dns.A](t, rr)
+					assert.Equal(t, want.A, a.A)
+				case *dns.AAAA:
+					aaaa := testutil.RequireTypeAssert[*dns.AAAA](t, rr)
+					assert.Equal(t, want.AAAA, aaaa.AAAA)
+				}
+			}
+		})
+	}
+}
+
+func TestNewViews(t *testing.T) {
+	subnets := []netutil.Prefix{{Prefix: netip.MustParsePrefix("192.168.0.0/24")}}
+	records := []*ViewRecord{{
+		Domain: "host.example",
+		Answer: netip.MustParseAddr("192.168.0.1"),
+	}}
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		conf       []*View
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		conf:       []*View{{Name: "v", Subnets: subnets, Records: records}},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "view at index 0: name: empty value",
+		conf:       []*View{{Subnets: subnets, Records: records}},
+	}, {
+		name:       "no_subnets",
+		wantErrMsg: "view at index 0: subnets: empty value",
+		conf:       []*View{{Name: "v", Records: records}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `view at index 1: duplicate name "v"`,
+		conf: []*View{
+			{Name: "v", Subnets: subnets, Records: records},
+			{Name: "v", Subnets: subnets, Records: records},
+		},
+	}, {
+		name: "bad_domain",
+		wantErrMsg: `view at index 0: record at index 0: domain: bad domain name "a..b": ` +
+			`bad domain name label "": domain name label is empty`,
+		conf: []*View{{
+			Name:    "v",
+			Subnets: subnets,
+			Records: []*ViewRecord{{
+				Domain: "a..b",
+				Answer: netip.MustParseAddr("192.168.0.1"),
+			}},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newViews(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
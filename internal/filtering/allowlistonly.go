@@ -0,0 +1,39 @@
+package filtering
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+)
+
+// allowlistOnlyRuleText is the text of the rule of the results for the domain
+// names blocked in the allowlist-only mode.
+const allowlistOnlyRuleText = "allowlist-only mode"
+
+// isAllowlisted returns true if host or any of its parent domains is in the
+// sorted allowlist.
+func isAllowlisted(host string, allowlist []string) (ok bool) {
+	for host != "" {
+		if _, ok = slices.BinarySearch(allowlist, host); ok {
+			return true
+		}
+
+		_, host, _ = strings.Cut(host, ".")
+	}
+
+	return false
+}
+
+// allowlistOnlyResult returns the result for a domain name blocked in the
+// allowlist-only mode.
+func allowlistOnlyResult() (res Result) {
+	return Result{
+		Rules: []*ResultRule{{
+			Text:         allowlistOnlyRuleText,
+			FilterListID: rulelist.APIIDAllowlistOnly,
+		}},
+		Reason:     FilteredBlockList,
+		IsFiltered: true,
+	}
+}
@@ -0,0 +1,77 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_CheckHost_allowlistOnly(t *testing.T) {
+	d, setts := newForTest(t, nil, []Filter{{
+		ID:   rulelist.IDCustom,
+		Data: []byte("||blocked.kiosk.example^\n"),
+	}})
+	t.Cleanup(d.Close)
+
+	setts.AllowlistOnly = true
+	setts.Allowlist = []string{"cdn.example", "kiosk.example"}
+
+	testCases := []struct {
+		name       string
+		host       string
+		wantRuleID rulelist.APIID
+		wantBlk    bool
+	}{{
+		name:       "allowed",
+		host:       "kiosk.example",
+		wantRuleID: 0,
+		wantBlk:    false,
+	}, {
+		name:       "allowed_subdomain",
+		host:       "img.cdn.example",
+		wantRuleID: 0,
+		wantBlk:    false,
+	}, {
+		name:       "not_allowed",
+		host:       "other.example",
+		wantRuleID: rulelist.APIIDAllowlistOnly,
+		wantBlk:    true,
+	}, {
+		name:       "not_allowed_parent",
+		host:       "example",
+		wantRuleID: rulelist.APIIDAllowlistOnly,
+		wantBlk:    true,
+	}, {
+		name:       "allowed_but_blocked",
+		host:       "blocked.kiosk.example",
+		wantRuleID: rulelist.APIIDCustom,
+		wantBlk:    true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := d.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantBlk, res.IsFiltered)
+			if tc.wantBlk {
+				require.Len(t, res.Rules, 1)
+
+				assert.Equal(t, tc.wantRuleID, res.Rules[0].FilterListID)
+			}
+		})
+	}
+
+	t.Run("protection_disabled", func(t *testing.T) {
+		s := *setts
+		s.ProtectionEnabled = false
+
+		res, err := d.CheckHost("other.example", dns.TypeA, &s)
+		require.NoError(t, err)
+
+		assert.False(t, res.IsFiltered)
+	})
+}
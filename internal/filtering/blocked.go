@@ -24,12 +24,16 @@ var serviceRules map[string][]*rules.NetworkRule
 // serviceIDs contains service IDs sorted alphabetically.
 var serviceIDs []string
 
+// serviceGroupIDs maps a service ID to the ID of its group.
+var serviceGroupIDs map[string]string
+
 // initBlockedServices initializes package-level blocked service data.  l must
 // not be nil.
 func initBlockedServices(ctx context.Context, l *slog.Logger) {
 	svcLen := len(blockedServices)
 	serviceIDs = make([]string, svcLen)
 	serviceRules = make(map[string][]*rules.NetworkRule, svcLen)
+	serviceGroupIDs = make(map[string]string, svcLen)
 
 	for i, s := range blockedServices {
 		netRules := make([]*rules.NetworkRule, 0, len(s.Rules))
@@ -52,6 +56,7 @@ func initBlockedServices(ctx context.Context, l *slog.Logger) {
 
 		serviceIDs[i] = s.ID
 		serviceRules[s.ID] = netRules
+		serviceGroupIDs[s.ID] = s.GroupID
 	}
 
 	slices.Sort(serviceIDs)
@@ -92,7 +97,7 @@ func (s *BlockedServices) FilterUnknownIDs(ctx context.Context, logger *slog.Log
 	}
 
 	s.IDs = slices.DeleteFunc(s.IDs, func(id string) (ok bool) {
-		_, isKnown := serviceRules[id]
+		_, isKnown := lookupServiceRules(id)
 		if !isKnown {
 			logger.WarnContext(ctx, "filtered unknown service", "id", id)
 		}
@@ -112,7 +117,7 @@ func (s *BlockedServices) Validate() (err error) {
 
 	var errs []error
 	for _, id := range s.IDs {
-		_, ok := serviceRules[id]
+		_, ok := lookupServiceRules(id)
 		if !ok {
 			errs = append(errs, fmt.Errorf("unknown blocked-service %q", id))
 		}
@@ -136,10 +141,26 @@ func (d *DNSFilter) ApplyBlockedServices(setts *Settings) {
 	}
 }
 
+// BlockedServiceGroupID returns the ID of the group of the blocked service with
+// the given ID.  groupID is empty if there is no such service.  The group of
+// the user-defined services is [CustomServiceGroupID].
+func BlockedServiceGroupID(id string) (groupID string) {
+	groupID, ok := serviceGroupIDs[id]
+	if ok {
+		return groupID
+	}
+
+	if idx := customServices.Load(); idx != nil && idx.rules[id] != nil {
+		return CustomServiceGroupID
+	}
+
+	return ""
+}
+
 // ApplyBlockedServicesList appends filtering rules to the settings.
 func (d *DNSFilter) ApplyBlockedServicesList(setts *Settings, list []string) {
 	for _, name := range list {
-		rules, ok := serviceRules[name]
+		rules, ok := lookupServiceRules(name)
 		if !ok {
 			d.logger.ErrorContext(context.TODO(), "unknown service name", "name", name)
 
@@ -154,16 +175,45 @@ func (d *DNSFilter) ApplyBlockedServicesList(setts *Settings, list []string) {
 }
 
 func (d *DNSFilter) handleBlockedServicesIDs(w http.ResponseWriter, r *http.Request) {
-	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, serviceIDs)
+	ids := serviceIDs
+	if custom := customBlockedServices(); len(custom) > 0 {
+		ids = slices.Clone(serviceIDs)
+		for _, s := range custom {
+			ids = append(ids, s.ID)
+		}
+
+		slices.Sort(ids)
+	}
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, ids)
 }
 
+// handleBlockedServicesAll is the handler for the GET
+// /control/blocked_services/all HTTP API.  The user-defined services are
+// returned after the built-in ones in the [CustomServiceGroupID] group.
 func (d *DNSFilter) handleBlockedServicesAll(w http.ResponseWriter, r *http.Request) {
+	svcs, groups := blockedServices, serviceGroups
+	if custom := customBlockedServices(); len(custom) > 0 {
+		svcs = slices.Clip(svcs)
+		for _, s := range custom {
+			svcs = append(svcs, blockedService{
+				ID:      s.ID,
+				Name:    s.Name,
+				IconSVG: []byte(s.IconSVG),
+				Rules:   s.Rules,
+				GroupID: CustomServiceGroupID,
+			})
+		}
+
+		groups = append(slices.Clip(groups), serviceGroup{ID: CustomServiceGroupID})
+	}
+
 	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, struct {
 		BlockedServices []blockedService `json:"blocked_services"`
 		ServiceGroups   []serviceGroup   `json:"groups"`
 	}{
-		BlockedServices: blockedServices,
-		ServiceGroups:   serviceGroups,
+		BlockedServices: svcs,
+		ServiceGroups:   groups,
 	})
 }
 
@@ -0,0 +1,240 @@
+package filtering
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// CustomServiceGroupID is the ID of the group of the user-defined blocked
+// services.
+const CustomServiceGroupID = "custom"
+
+// CustomBlockedService is a blocked service defined by the user.
+type CustomBlockedService struct {
+	// ID is the unique ID of the service.  It must not be equal to the ID of a
+	// built-in service.
+	ID string `json:"id" yaml:"id"`
+
+	// Name is the human-readable name of the service.
+	Name string `json:"name" yaml:"name"`
+
+	// IconSVG is the optional SVG image of the service.
+	IconSVG string `json:"icon_svg" yaml:"icon_svg"`
+
+	// Rules are the filtering rules blocking the service.  It must not be
+	// empty.
+	Rules []string `json:"rules" yaml:"rules"`
+}
+
+// validate returns an error if s isn't a valid user-defined blocked service.
+// ids are the IDs of the previously validated user-defined services.  It
+// returns the parsed rules of s.
+func (s *CustomBlockedService) validate(
+	ids *container.MapSet[string],
+) (netRules []*rules.NetworkRule, err error) {
+	if s == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	err = validateCustomServiceID(s.ID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("id: %w", err)
+	}
+
+	if s.Name == "" {
+		return nil, fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	}
+
+	if s.IconSVG != "" && !strings.HasPrefix(s.IconSVG, "<svg") {
+		return nil, fmt.Errorf("icon_svg: %q: not an svg image", ellipsize(s.IconSVG))
+	}
+
+	if len(s.Rules) == 0 {
+		return nil, fmt.Errorf("rules: %w", errors.ErrEmptyValue)
+	}
+
+	netRules = make([]*rules.NetworkRule, 0, len(s.Rules))
+	for i, text := range s.Rules {
+		var rule *rules.NetworkRule
+		rule, err = rules.NewNetworkRule(text, rulelist.IDBlockedService)
+		if err != nil {
+			return nil, fmt.Errorf("rules: at index %d: %w", i, err)
+		}
+
+		netRules = append(netRules, rule)
+	}
+
+	return netRules, nil
+}
+
+// ellipsize returns the shortened s for error messages.
+func ellipsize(s string) (short string) {
+	const maxLen = 16
+	if len(s) <= maxLen {
+		return s
+	}
+
+	return s[:maxLen] + "..."
+}
+
+// validateCustomServiceID returns an error if id isn't a valid ID of a
+// user-defined blocked service.
+func validateCustomServiceID(id string, ids *container.MapSet[string]) (err error) {
+	if id == "" {
+		return errors.ErrEmptyValue
+	}
+
+	if strings.ContainsFunc(id, func(r rune) (ok bool) {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' && r != '-'
+	}) {
+		return fmt.Errorf("%q: only lowercase letters, digits, '_', and '-' are allowed", id)
+	}
+
+	if _, ok := serviceRules[id]; ok {
+		return fmt.Errorf("%q: equal to the id of a built-in service", id)
+	}
+
+	if ids.Has(id) {
+		return fmt.Errorf("%q: %w", id, errors.ErrDuplicated)
+	}
+
+	return nil
+}
+
+// customServiceIndex contains the data of the user-defined blocked services.
+type customServiceIndex struct {
+	// rules maps the ID of a service to its filtering rules.
+	rules map[string][]*rules.NetworkRule
+
+	// services are the services sorted by their IDs.
+	services []*CustomBlockedService
+}
+
+// customServices is the index of the user-defined blocked services.  Like the
+// built-in services, they're package-level data, since the blocked services of
+// the persistent clients are validated before the filter is created.
+var customServices atomic.Pointer[customServiceIndex]
+
+// SetCustomBlockedServices validates the user-defined blocked services and
+// makes them available alongside the built-in ones.  It must be called after
+// [InitModule].  svcs must not be modified after calling it.
+func SetCustomBlockedServices(svcs []*CustomBlockedService) (err error) {
+	idx := &customServiceIndex{
+		rules:    make(map[string][]*rules.NetworkRule, len(svcs)),
+		services: slices.Clone(svcs),
+	}
+
+	ids := container.NewMapSet[string]()
+	var errs []error
+	for i, s := range svcs {
+		netRules, valErr := s.validate(ids)
+		if valErr != nil {
+			errs = append(errs, fmt.Errorf("at index %d: %w", i, valErr))
+
+			continue
+		}
+
+		ids.Add(s.ID)
+		idx.rules[s.ID] = netRules
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return fmt.Errorf("custom blocked services: %w", err)
+	}
+
+	slices.SortFunc(idx.services, func(a, b *CustomBlockedService) (res int) {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	customServices.Store(idx)
+
+	return nil
+}
+
+// lookupServiceRules returns the filtering rules of the built-in or the
+// user-defined blocked service with id.
+func lookupServiceRules(id string) (netRules []*rules.NetworkRule, ok bool) {
+	netRules, ok = serviceRules[id]
+	if ok {
+		return netRules, true
+	}
+
+	if idx := customServices.Load(); idx != nil {
+		netRules, ok = idx.rules[id]
+	}
+
+	return netRules, ok
+}
+
+// customBlockedServices returns the user-defined blocked services sorted by
+// their IDs.
+func customBlockedServices() (svcs []*CustomBlockedService) {
+	if idx := customServices.Load(); idx != nil {
+		return idx.services
+	}
+
+	return nil
+}
+
+// handleCustomBlockedServicesGet is the handler for the GET
+// /control/blocked_services/custom/get HTTP API.
+func (d *DNSFilter) handleCustomBlockedServicesGet(w http.ResponseWriter, r *http.Request) {
+	svcs := customBlockedServices()
+	if svcs == nil {
+		svcs = []*CustomBlockedService{}
+	}
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, svcs)
+}
+
+// handleCustomBlockedServicesUpdate is the handler for the PUT
+// /control/blocked_services/custom/update HTTP API.  The removed services are
+// also removed from the global blocked services.
+func (d *DNSFilter) handleCustomBlockedServicesUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	svcs := []*CustomBlockedService{}
+	err := json.NewDecoder(r.Body).Decode(&svcs)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		err = SetCustomBlockedServices(svcs)
+		if err != nil {
+			return
+		}
+
+		d.conf.CustomBlockedServices = svcs
+		d.conf.BlockedServices.FilterUnknownIDs(ctx, l)
+	}()
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return
+	}
+
+	l.DebugContext(ctx, "updated custom blocked services", "len", len(svcs))
+
+	d.conf.ConfModifier.Apply(ctx)
+
+	aghhttp.OK(ctx, l, w)
+}
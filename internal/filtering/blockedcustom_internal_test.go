@@ -0,0 +1,165 @@
+package filtering
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCustomBlockedServices(t *testing.T) {
+	initBlockedServices(testutil.ContextWithTimeout(t, testTimeout), testLogger)
+	t.Cleanup(func() {
+		require.NoError(t, SetCustomBlockedServices(nil))
+	})
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		svcs       []*CustomBlockedService
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		svcs: []*CustomBlockedService{{
+			ID:      "district_app",
+			Name:    "District app",
+			IconSVG: "<svg></svg>",
+			Rules:   []string{"||district.example^"},
+		}},
+	}, {
+		name: "builtin_id",
+		wantErrMsg: `custom blocked services: at index 0: id: "4chan": ` +
+			`equal to the id of a built-in service`,
+		svcs: []*CustomBlockedService{{
+			ID:    "4chan",
+			Name:  "4chan",
+			Rules: []string{"||4chan.example^"},
+		}},
+	}, {
+		name: "duplicate_id",
+		wantErrMsg: `custom blocked services: at index 1: id: "app": ` +
+			`duplicated value`,
+		svcs: []*CustomBlockedService{{
+			ID:    "app",
+			Name:  "App",
+			Rules: []string{"||app.example^"},
+		}, {
+			ID:    "app",
+			Name:  "App",
+			Rules: []string{"||app.example^"},
+		}},
+	}, {
+		name: "bad_id",
+		wantErrMsg: `custom blocked services: at index 0: id: "App": only lowercase ` +
+			`letters, digits, '_', and '-' are allowed`,
+		svcs: []*CustomBlockedService{{
+			ID:    "App",
+			Name:  "App",
+			Rules: []string{"||app.example^"},
+		}},
+	}, {
+		name:       "no_rules",
+		wantErrMsg: `custom blocked services: at index 0: rules: empty value`,
+		svcs: []*CustomBlockedService{{
+			ID:   "app",
+			Name: "App",
+		}},
+	}, {
+		name: "bad_icon",
+		wantErrMsg: `custom blocked services: at index 0: icon_svg: ` +
+			`"<img src=\"x\" one...": not an svg image`,
+		svcs: []*CustomBlockedService{{
+			ID:      "app",
+			Name:    "App",
+			IconSVG: `<img src="x" onerror="alert(1)">`,
+			Rules:   []string{"||app.example^"},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := SetCustomBlockedServices(tc.svcs)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestDNSFilter_customBlockedServices(t *testing.T) {
+	const (
+		svcID   = "district_app"
+		svcHost = "district.example"
+	)
+
+	t.Cleanup(func() {
+		require.NoError(t, SetCustomBlockedServices(nil))
+	})
+
+	d, setts := newForTest(t, &Config{
+		BlockedServices: &BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+			IDs:      []string{},
+		},
+		ConfModifier: agh.EmptyConfigModifier{},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	r := httptest.NewRequest(
+		http.MethodPut,
+		"/control/blocked_services/custom/update",
+		bytes.NewBufferString(`[{"id":"district_app","name":"District app","rules":["||district.example^"]}]`),
+	)
+	w := httptest.NewRecorder()
+	d.handleCustomBlockedServicesUpdate(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.NoError(t, (&BlockedServices{IDs: []string{svcID}}).Validate())
+
+	assert.Equal(t, CustomServiceGroupID, BlockedServiceGroupID(svcID))
+
+	d.conf.BlockedServices.IDs = []string{svcID}
+	d.ApplyBlockedServices(setts)
+
+	res, err := d.CheckHost("www."+svcHost, dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+	assert.Equal(t, FilteredBlockedService, res.Reason)
+	assert.Equal(t, svcID, res.ServiceName)
+
+	r = httptest.NewRequest(http.MethodGet, "/control/blocked_services/all", nil)
+	w = httptest.NewRecorder()
+	d.handleBlockedServicesAll(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	all := &struct {
+		BlockedServices []blockedService `json:"blocked_services"`
+		ServiceGroups   []serviceGroup   `json:"groups"`
+	}{}
+	err = json.NewDecoder(w.Body).Decode(all)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, all.BlockedServices)
+	require.NotEmpty(t, all.ServiceGroups)
+
+	assert.Equal(t, svcID, all.BlockedServices[len(all.BlockedServices)-1].ID)
+	assert.Equal(t, CustomServiceGroupID, all.ServiceGroups[len(all.ServiceGroups)-1].ID)
+
+	r = httptest.NewRequest(
+		http.MethodPut,
+		"/control/blocked_services/custom/update",
+		bytes.NewBufferString(`[]`),
+	)
+	w = httptest.NewRecorder()
+	d.handleCustomBlockedServicesUpdate(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Empty(t, d.conf.BlockedServices.IDs)
+}
@@ -0,0 +1,253 @@
+package filtering
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"golang.org/x/net/publicsuffix"
+)
+
+// TLDCategory is a category of public suffixes, all domain names under which
+// may be blocked at once.
+type TLDCategory string
+
+// Valid public-suffix categories.
+const (
+	// TLDCategoryCountryCode are the two-letter country-code top-level domains
+	// from the ICANN section of the Public Suffix List, such as "de".
+	TLDCategoryCountryCode TLDCategory = "country_code"
+
+	// TLDCategoryPrivate are the suffixes from the private section of the
+	// Public Suffix List, which are managed by companies, such as "github.io".
+	TLDCategoryPrivate TLDCategory = "private"
+
+	// TLDCategoryUnlisted are the top-level domains absent from the Public
+	// Suffix List, such as "lan".
+	TLDCategoryUnlisted TLDCategory = "unlisted"
+)
+
+// validate returns an error if c isn't a valid public-suffix category.
+func (c TLDCategory) validate() (err error) {
+	switch c {
+	case TLDCategoryCountryCode, TLDCategoryPrivate, TLDCategoryUnlisted:
+		return nil
+	default:
+		return fmt.Errorf("%q: %w", c, errors.ErrBadEnumValue)
+	}
+}
+
+// BlockedTLDs is the configuration of blocking entire top-level domains and
+// other public suffixes.
+type BlockedTLDs struct {
+	// suffixes is the index of the normalized Suffixes.
+	suffixes *container.MapSet[string]
+
+	// Suffixes are the blocked suffixes, such as "zip" or "co.uk".  The
+	// domain names equal to a suffix or under it are blocked.  A leading "*."
+	// or "." is allowed and ignored.
+	Suffixes []string `json:"suffixes" yaml:"suffixes"`
+
+	// Categories are the blocked public-suffix categories.
+	Categories []TLDCategory `json:"categories" yaml:"categories"`
+
+	// Enabled defines if the suffixes and the categories are blocked.
+	Enabled bool `json:"enabled" yaml:"enabled"`
+}
+
+// init normalizes and validates the suffixes and the categories and builds the
+// index of the suffixes.  b must not be nil.
+func (b *BlockedTLDs) init() (err error) {
+	var errs []error
+
+	b.suffixes = container.NewMapSet[string]()
+	suffixes := make([]string, 0, len(b.Suffixes))
+	for i, s := range b.Suffixes {
+		s = normalizeBlockedSuffix(s)
+		if err = netutil.ValidateDomainName(s); err != nil {
+			errs = append(errs, fmt.Errorf("suffixes: at index %d: %w", i, err))
+
+			continue
+		}
+
+		if !b.suffixes.Has(s) {
+			b.suffixes.Add(s)
+			suffixes = append(suffixes, s)
+		}
+	}
+
+	b.Suffixes = suffixes
+
+	for i, c := range b.Categories {
+		if err = c.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("categories: at index %d: %w", i, err))
+		}
+	}
+
+	slices.Sort(b.Categories)
+	b.Categories = slices.Compact(b.Categories)
+
+	return errors.Join(errs...)
+}
+
+// normalizeBlockedSuffix returns the suffix without the leading wildcard or
+// dot and the trailing dot.
+func normalizeBlockedSuffix(s string) (norm string) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "*")
+	s = strings.TrimPrefix(s, ".")
+
+	return strings.TrimSuffix(s, ".")
+}
+
+// match returns the blocked suffix or the blocked category of host, if any.
+// The suffixes are checked first, which takes one lookup per label of host.
+// b must be initialized.
+func (b *BlockedTLDs) match(host string) (suffix string, cat TLDCategory, ok bool) {
+	for s := host; s != ""; _, s, _ = strings.Cut(s, ".") {
+		if b.suffixes.Has(s) {
+			return s, "", true
+		}
+	}
+
+	if len(b.Categories) == 0 {
+		return "", "", false
+	}
+
+	cat = publicSuffixCategory(host)
+	if cat != "" && slices.Contains(b.Categories, cat) {
+		return "", cat, true
+	}
+
+	return "", "", false
+}
+
+// publicSuffixCategory returns the category of the public suffix of host or an
+// empty string if it doesn't belong to any.
+func publicSuffixCategory(host string) (cat TLDCategory) {
+	suffix, icann := publicsuffix.PublicSuffix(host)
+	if !icann {
+		if strings.Contains(suffix, ".") {
+			return TLDCategoryPrivate
+		}
+
+		return TLDCategoryUnlisted
+	}
+
+	tld := suffix[strings.LastIndexByte(suffix, '.')+1:]
+	if len(tld) == 2 && isASCIILetter(tld[0]) && isASCIILetter(tld[1]) {
+		return TLDCategoryCountryCode
+	}
+
+	return ""
+}
+
+// isASCIILetter returns true if c is a lowercase ASCII letter.
+func isASCIILetter(c byte) (ok bool) {
+	return c >= 'a' && c <= 'z'
+}
+
+// checkBlockedTLDs is a hostChecker that blocks the hosts under the blocked
+// suffixes and the suffixes of the blocked categories.
+func (d *DNSFilter) checkBlockedTLDs(
+	host string,
+	_ uint16,
+	setts *Settings,
+) (res Result, err error) {
+	if !setts.ProtectionEnabled || !setts.FilteringEnabled {
+		return Result{}, nil
+	}
+
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	b := d.conf.BlockedTLDs
+	if b == nil || !b.Enabled {
+		return Result{}, nil
+	}
+
+	suffix, cat, ok := b.match(host)
+	if !ok {
+		return Result{}, nil
+	}
+
+	text := "blocked suffix: " + suffix
+	if cat != "" {
+		text = "blocked suffix category: " + string(cat)
+	}
+
+	return Result{
+		Rules: []*ResultRule{{
+			Text:         text,
+			FilterListID: rulelist.APIIDBlockedTLD,
+		}},
+		Reason:     FilteredBlockList,
+		IsFiltered: true,
+	}, nil
+}
+
+// handleBlockedTLDsGet is the handler for the GET /control/blocked_tlds/get
+// HTTP API.
+func (d *DNSFilter) handleBlockedTLDsGet(w http.ResponseWriter, r *http.Request) {
+	resp := &BlockedTLDs{
+		Suffixes:   []string{},
+		Categories: []TLDCategory{},
+	}
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		if b := d.conf.BlockedTLDs; b != nil {
+			resp.Suffixes = append(resp.Suffixes, b.Suffixes...)
+			resp.Categories = append(resp.Categories, b.Categories...)
+			resp.Enabled = b.Enabled
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
+}
+
+// handleBlockedTLDsUpdate is the handler for the PUT
+// /control/blocked_tlds/update HTTP API.
+func (d *DNSFilter) handleBlockedTLDsUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	b := &BlockedTLDs{}
+	err := json.NewDecoder(r.Body).Decode(b)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	err = b.init()
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		d.conf.BlockedTLDs = b
+	}()
+
+	l.DebugContext(
+		ctx,
+		"updated blocked tlds",
+		"suffixes", len(b.Suffixes),
+		"categories", len(b.Categories),
+	)
+
+	d.conf.ConfModifier.Apply(ctx)
+}
@@ -0,0 +1,138 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_CheckHost_blockedTLDs(t *testing.T) {
+	d, setts := newForTest(t, &Config{
+		BlockedTLDs: &BlockedTLDs{
+			Suffixes:   []string{"*.zip", ".TOP.", "co.uk"},
+			Categories: []TLDCategory{TLDCategoryPrivate},
+			Enabled:    true,
+		},
+	}, []Filter{{
+		ID:   rulelist.IDCustom,
+		Data: []byte("@@||allowed.zip^\n"),
+	}})
+	t.Cleanup(d.Close)
+
+	assert.Equal(t, []string{"zip", "top", "co.uk"}, d.conf.BlockedTLDs.Suffixes)
+
+	testCases := []struct {
+		name     string
+		host     string
+		wantText string
+		wantBlk  bool
+	}{{
+		name:     "tld",
+		host:     "www.example.zip",
+		wantText: "blocked suffix: zip",
+		wantBlk:  true,
+	}, {
+		name:     "tld_itself",
+		host:     "top",
+		wantText: "blocked suffix: top",
+		wantBlk:  true,
+	}, {
+		name:     "second_level",
+		host:     "example.co.uk",
+		wantText: "blocked suffix: co.uk",
+		wantBlk:  true,
+	}, {
+		name:     "not_suffix",
+		host:     "zip.example.com",
+		wantText: "",
+		wantBlk:  false,
+	}, {
+		name:     "uk",
+		host:     "example.uk",
+		wantText: "",
+		wantBlk:  false,
+	}, {
+		name:     "category",
+		host:     "user.github.io",
+		wantText: "blocked suffix category: private",
+		wantBlk:  true,
+	}, {
+		name:     "allowlisted",
+		host:     "allowed.zip",
+		wantText: "",
+		wantBlk:  false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := d.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantBlk, res.IsFiltered)
+			if tc.wantBlk {
+				require.Len(t, res.Rules, 1)
+
+				assert.Equal(t, tc.wantText, res.Rules[0].Text)
+				assert.Equal(t, rulelist.APIIDBlockedTLD, res.Rules[0].FilterListID)
+			}
+		})
+	}
+
+	t.Run("filtering_disabled", func(t *testing.T) {
+		s := *setts
+		s.FilteringEnabled = false
+
+		res, err := d.CheckHost("example.zip", dns.TypeA, &s)
+		require.NoError(t, err)
+
+		assert.False(t, res.IsFiltered)
+	})
+}
+
+func TestPublicSuffixCategory(t *testing.T) {
+	testCases := []struct {
+		host string
+		want TLDCategory
+	}{{
+		host: "example.de",
+		want: TLDCategoryCountryCode,
+	}, {
+		host: "example.co.uk",
+		want: TLDCategoryCountryCode,
+	}, {
+		host: "example.com",
+		want: "",
+	}, {
+		host: "example.github.io",
+		want: TLDCategoryPrivate,
+	}, {
+		host: "printer.lan",
+		want: TLDCategoryUnlisted,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			assert.Equal(t, tc.want, publicSuffixCategory(tc.host))
+		})
+	}
+}
+
+func TestBlockedTLDs_init(t *testing.T) {
+	b := &BlockedTLDs{
+		Suffixes:   []string{"zip", "bad..suffix"},
+		Categories: []TLDCategory{"generic"},
+	}
+
+	err := b.init()
+	testutil.AssertErrorMsg(
+		t,
+		`suffixes: at index 1: bad domain name "bad..suffix": `+
+			`bad domain name label "": domain name label is empty`+"\n"+
+			`categories: at index 0: "generic": bad enum value`,
+		err,
+	)
+}
@@ -0,0 +1,203 @@
+package filtering
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// DefaultDGAThreshold is the default minimum score of the domain names
+	// considered generated.
+	DefaultDGAThreshold = 0.65
+
+	// DefaultDGAMinLabelLength is the default minimum length of the scored
+	// labels.
+	DefaultDGAMinLabelLength = 8
+)
+
+// DGAAction is the action taken for the requests for the domain names, which
+// look generated by a domain generation algorithm.
+type DGAAction string
+
+// Valid DGA detection actions.
+const (
+	// DGAActionLog logs the requests with the info level.
+	DGAActionLog DGAAction = "log"
+
+	// DGAActionNotify logs the requests with the warning level.
+	DGAActionNotify DGAAction = "notify"
+
+	// DGAActionBlock blocks the requests and logs them with the warning level.
+	DGAActionBlock DGAAction = "block"
+)
+
+// DGAConfig is the configuration of detecting the domain names generated by
+// domain generation algorithms, which are often used by malware for beaconing.
+type DGAConfig struct {
+	// Action is the action for the requests for the detected domain names.
+	Action DGAAction `yaml:"action"`
+
+	// Threshold is the minimum score of the detected domain names, from 0 to 1.
+	// If it's zero, [DefaultDGAThreshold] is used.
+	Threshold float64 `yaml:"threshold"`
+
+	// MinLabelLength is the minimum length of the scored labels.  The shorter
+	// labels are never considered generated.  If it's zero,
+	// [DefaultDGAMinLabelLength] is used.
+	MinLabelLength uint `yaml:"min_label_length"`
+
+	// Enabled defines if the domain names are scored.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if c is invalid.  c may be nil.
+func (c *DGAConfig) validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	switch c.Action {
+	case DGAActionLog, DGAActionNotify, DGAActionBlock:
+		// Go on.
+	default:
+		return fmt.Errorf("action: %w: %q", errors.ErrBadEnumValue, c.Action)
+	}
+
+	if c.Threshold < 0 || c.Threshold > 1 {
+		return fmt.Errorf("threshold: out of range [0, 1]: %v", c.Threshold)
+	}
+
+	return nil
+}
+
+// dgaCommonBigrams are the most common bigrams of the English text.  The
+// bigrams of the human-readable labels are mostly among these, while the ones
+// of the random labels mostly aren't.
+var dgaCommonBigrams = container.NewMapSet(strings.Fields(`
+	th he in er an re on at en nd ti es or te of ed is it al ar st to nt ng se
+	ha as ou io le ve co me de hi ri ro ic ne ea ra ce li ch ll be ma si om ur
+	ca el ta la ns di fo ho pe ec pr no ct us ac ot il tr ly nc et ut ss so rs
+	un lo wa ge ie wh ee wi em ad ol rt po we na ul ni ts mo ow pa im mi ai sh
+	ir su id os iv ia am fi ci vi pl ig tu ev ld ry mp fe bl ab gh ty op wo sa
+	ay ex ke fr oo av ag if ap gr od bo sp rd do uc bu ei ov by rm ep tt oc fa
+	ef cu rn sc gi da yo cr cl du ga qu ue ff ba ey ls va um pp ua up lu go ht
+	ru ug ds lt pi rc rr eg au ck ew mu br bi pt ak pu ui rg ib tl ny ki rk ys
+	ob mm fu ph og ms ye ud mb ip ub oi rl gu dr hr cc tw ft wn nu gl ok ks eb
+	oa
+`)...)
+
+// dgaScore returns the score of label from 0 to 1, where the higher scores
+// mean that label looks more random.  The score combines the share of the
+// uncommon bigrams with the Shannon entropy of the characters compared to the
+// maximum one for the letters and the digits.
+func dgaScore(label string) (score float64) {
+	rare := 0
+	for i := range len(label) - 1 {
+		if !dgaCommonBigrams.Has(label[i : i+2]) {
+			rare++
+		}
+	}
+
+	var rareShare float64
+	if len(label) > 1 {
+		rareShare = float64(rare) / float64(len(label)-1)
+	}
+
+	counts := map[rune]int{}
+	for _, r := range label {
+		counts[r]++
+	}
+
+	var entropy float64
+	for _, n := range counts {
+		p := float64(n) / float64(len(label))
+		entropy -= p * math.Log2(p)
+	}
+
+	// The maximum entropy of the labels consisting of 26 letters and 10 digits.
+	entropyShare := min(entropy/math.Log2(36), 1)
+
+	return 0.7*rareShare + 0.3*entropyShare
+}
+
+// dgaMatch returns the label of host with the highest score and the score
+// itself.  The public suffix of host, the internationalized labels, and the
+// labels shorter than minLen aren't scored.  label is empty if there are no
+// scored labels.
+func dgaMatch(host string, minLen uint) (label string, score float64) {
+	host = strings.ToLower(host)
+	suffix, _ := publicsuffix.PublicSuffix(host)
+	rest := strings.TrimSuffix(strings.TrimSuffix(host, suffix), ".")
+
+	for _, l := range strings.Split(rest, ".") {
+		if uint(len(l)) < minLen || strings.HasPrefix(l, "xn--") {
+			continue
+		}
+
+		l = strings.ReplaceAll(l, "-", "")
+		if s := dgaScore(l); s > score {
+			label, score = l, s
+		}
+	}
+
+	return label, score
+}
+
+// checkDGA is a hostChecker that detects the domain names generated by domain
+// generation algorithms.
+func (d *DNSFilter) checkDGA(host string, _ uint16, setts *Settings) (res Result, err error) {
+	if !setts.ProtectionEnabled {
+		return Result{}, nil
+	}
+
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	c := d.conf.DGA
+	if c == nil || !c.Enabled {
+		return Result{}, nil
+	}
+
+	label, score := dgaMatch(host, cmp.Or(c.MinLabelLength, DefaultDGAMinLabelLength))
+	if label == "" || score < cmp.Or(c.Threshold, DefaultDGAThreshold) {
+		return Result{}, nil
+	}
+
+	lvl := slog.LevelWarn
+	if c.Action == DGAActionLog {
+		lvl = slog.LevelInfo
+	}
+
+	d.logger.Log(
+		context.TODO(),
+		lvl,
+		"generated domain name",
+		"host", host,
+		"label", label,
+		"score", score,
+		"client", setts.ClientName,
+		"action", c.Action,
+	)
+
+	if c.Action != DGAActionBlock {
+		return Result{}, nil
+	}
+
+	return Result{
+		Rules: []*ResultRule{{
+			Text:         fmt.Sprintf("dga score %.2f: %s", score, label),
+			FilterListID: rulelist.APIIDDGA,
+		}},
+		Reason:     FilteredBlockList,
+		IsFiltered: true,
+	}, nil
+}
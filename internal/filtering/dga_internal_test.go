@@ -0,0 +1,98 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDGAMatch(t *testing.T) {
+	testCases := []struct {
+		name      string
+		host      string
+		wantLabel string
+		generated bool
+	}{{
+		name:      "short",
+		host:      "example.com",
+		wantLabel: "",
+		generated: false,
+	}, {
+		name:      "words",
+		host:      "www.wikipedia.org",
+		wantLabel: "wikipedia",
+		generated: false,
+	}, {
+		name:      "words_dashes",
+		host:      "download-updates.microsoft.com",
+		wantLabel: "downloadupdates",
+		generated: false,
+	}, {
+		name:      "public_suffix",
+		host:      "facebook.co.uk",
+		wantLabel: "facebook",
+		generated: false,
+	}, {
+		name:      "random_letters",
+		host:      "xjwqzkvbpfmt.com",
+		wantLabel: "xjwqzkvbpfmt",
+		generated: true,
+	}, {
+		name:      "random_subdomain",
+		host:      "q7x2kz9vj4mw.example.net",
+		wantLabel: "q7x2kz9vj4mw",
+		generated: true,
+	}, {
+		name:      "idn",
+		host:      "xn--80ak6aa92e.com",
+		wantLabel: "",
+		generated: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			label, score := dgaMatch(tc.host, DefaultDGAMinLabelLength)
+			assert.Equal(t, tc.wantLabel, label)
+			assert.Equal(t, tc.generated, score >= DefaultDGAThreshold, "score %v", score)
+		})
+	}
+}
+
+func TestDNSFilter_CheckHost_dga(t *testing.T) {
+	conf := &DGAConfig{
+		Action:  DGAActionBlock,
+		Enabled: true,
+	}
+
+	d, setts := newForTest(t, &Config{
+		DGA: conf,
+	}, []Filter{{
+		ID:   rulelist.IDCustom,
+		Data: []byte("@@||xjwqzkvbpfmt.net^\n"),
+	}})
+	t.Cleanup(d.Close)
+
+	res, err := d.CheckHost("xjwqzkvbpfmt.com", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+	assert.Equal(t, FilteredBlockList, res.Reason)
+
+	require.Len(t, res.Rules, 1)
+
+	assert.Equal(t, rulelist.APIIDDGA, res.Rules[0].FilterListID)
+
+	res, err = d.CheckHost("xjwqzkvbpfmt.net", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.False(t, res.IsFiltered)
+
+	conf.Action = DGAActionNotify
+	res, err = d.CheckHost("xjwqzkvbpfmt.com", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.False(t, res.IsFiltered)
+}
@@ -0,0 +1,142 @@
+package filtering
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// engineView is the filtering engine built from a subset of the enabled
+// blocklists.  It's used for the clients with their own blocklists and for the
+// blocklists with schedules.
+type engineView struct {
+	// storage is the rule storage of the view.
+	storage *filterlist.RuleStorage
+
+	// engine is the filtering engine of the view.
+	engine *urlfilter.DNSEngine
+}
+
+// engineFor returns the filtering engine for the blocklists with ids.  If ids
+// is nil, it returns the general engine.  d.engineLock is expected to be locked
+// for reading.
+func (d *DNSFilter) engineFor(ctx context.Context, ids []rules.ListID) (e *urlfilter.DNSEngine) {
+	if ids == nil || d.filteringEngine == nil {
+		return d.filteringEngine
+	}
+
+	key := engineViewKey(ids)
+
+	d.viewsMu.Lock()
+	defer d.viewsMu.Unlock()
+
+	if v, ok := d.views[key]; ok {
+		return v.engine
+	}
+
+	filters := make([]Filter, 0, len(ids))
+	for _, f := range d.blockFilters {
+		if slices.Contains(ids, f.ID) {
+			filters = append(filters, f)
+		}
+	}
+
+	rs, err := newRuleStorage(filters)
+	if err != nil {
+		d.logger.ErrorContext(
+			ctx,
+			"creating engine view; using all blocklists",
+			"filter_ids", key,
+			slogutil.KeyError, err,
+		)
+
+		return d.filteringEngine
+	}
+
+	if d.views == nil {
+		d.views = map[string]*engineView{}
+	}
+
+	v := &engineView{
+		storage: rs,
+		engine:  urlfilter.NewDNSEngine(rs),
+	}
+	d.views[key] = v
+
+	d.logger.DebugContext(ctx, "created engine view", "filter_ids", key)
+
+	return v.engine
+}
+
+// activeFilterIDs returns the IDs of the blocklists applied at now.  clientIDs
+// are the IDs of the blocklists of the client, if any; the user rules are
+// applied regardless of them.  It returns nil if all blocklists are applied.
+// d.engineLock is expected to be locked for reading.
+func (d *DNSFilter) activeFilterIDs(clientIDs []rules.ListID, now time.Time) (ids []rules.ListID) {
+	if len(clientIDs) == 0 && !d.hasSchedules {
+		return nil
+	}
+
+	ids = make([]rules.ListID, 0, len(d.blockFilters))
+	for _, f := range d.blockFilters {
+		if f.ID != rulelist.IDCustom && len(clientIDs) > 0 && !slices.Contains(clientIDs, f.ID) {
+			continue
+		}
+
+		if f.Schedule != nil && !f.Schedule.Contains(now) {
+			continue
+		}
+
+		ids = append(ids, f.ID)
+	}
+
+	if len(ids) == len(d.blockFilters) {
+		return nil
+	}
+
+	return ids
+}
+
+// engineViewKey returns the key of the engine view for the blocklists with
+// ids.
+func engineViewKey(ids []rules.ListID) (key string) {
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	strs := make([]string, 0, len(sorted))
+	for _, id := range sorted {
+		strs = append(strs, strconv.FormatUint(uint64(id), 10))
+	}
+
+	return strings.Join(strs, ",")
+}
+
+// resetViews closes the rule storages of the engine views and removes them.
+// d.engineLock is expected to be locked for writing.
+func (d *DNSFilter) resetViews(ctx context.Context) {
+	d.viewsMu.Lock()
+	defer d.viewsMu.Unlock()
+
+	for key, v := range d.views {
+		err := v.storage.Close()
+		if err != nil {
+			d.logger.ErrorContext(
+				ctx,
+				"closing engine view rules storage",
+				"filter_ids", key,
+				slogutil.KeyError, err,
+			)
+		}
+	}
+
+	clear(d.views)
+}
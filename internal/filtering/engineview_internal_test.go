@@ -0,0 +1,158 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/urlfilter/rules"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_CheckHost_filterListIDs(t *testing.T) {
+	const (
+		adsID   rules.ListID = 1
+		adultID rules.ListID = 2
+	)
+
+	filters := []Filter{{
+		ID:   rulelist.IDCustom,
+		Data: []byte("||custom.example^\n"),
+	}, {
+		ID:   adsID,
+		Data: []byte("||ads.example^\n"),
+	}, {
+		ID:   adultID,
+		Data: []byte("||adult.example^\n"),
+	}}
+
+	d, setts := newForTest(t, nil, filters)
+	t.Cleanup(d.Close)
+
+	testCases := []struct {
+		name     string
+		host     string
+		ids      []rules.ListID
+		wantList rulelist.APIID
+		wantBlk  bool
+	}{{
+		name:     "all_lists",
+		host:     "adult.example",
+		ids:      nil,
+		wantList: rulelist.APIID(adultID),
+		wantBlk:  true,
+	}, {
+		name:     "own_list",
+		host:     "adult.example",
+		ids:      []rules.ListID{adultID},
+		wantList: rulelist.APIID(adultID),
+		wantBlk:  true,
+	}, {
+		name:     "other_list",
+		host:     "adult.example",
+		ids:      []rules.ListID{adsID},
+		wantList: 0,
+		wantBlk:  false,
+	}, {
+		name:     "custom_rules",
+		host:     "custom.example",
+		ids:      []rules.ListID{adsID},
+		wantList: rulelist.APIIDCustom,
+		wantBlk:  true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := *setts
+			s.FilterListIDs = tc.ids
+
+			res, err := d.CheckHost(tc.host, dns.TypeA, &s)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantBlk, res.IsFiltered)
+			if tc.wantBlk {
+				require.Len(t, res.Rules, 1)
+
+				assert.Equal(t, tc.wantList, res.Rules[0].FilterListID)
+			}
+		})
+	}
+
+	assert.Len(t, d.views, 2)
+
+	d.engineLock.Lock()
+	d.resetViews(testutil.ContextWithTimeout(t, testTimeout))
+	d.engineLock.Unlock()
+
+	assert.Empty(t, d.views)
+}
+
+func TestEngineViewKey(t *testing.T) {
+	assert.Equal(t, "1,2,3", engineViewKey([]rules.ListID{3, 1, 2, 1}))
+	assert.Equal(t, "", engineViewKey(nil))
+}
+
+func TestDNSFilter_CheckHost_schedule(t *testing.T) {
+	const (
+		alwaysID rules.ListID = 1
+		neverID  rules.ListID = 2
+	)
+
+	filters := []Filter{{
+		ID:   rulelist.IDCustom,
+		Data: []byte("||custom.example^\n"),
+	}, {
+		ID:       alwaysID,
+		Data:     []byte("||always.example^\n"),
+		Schedule: schedule.FullWeekly(),
+	}, {
+		ID:       neverID,
+		Data:     []byte("||never.example^\n"),
+		Schedule: schedule.EmptyWeekly(),
+	}}
+
+	d, setts := newForTest(t, nil, filters)
+	t.Cleanup(d.Close)
+
+	testCases := []struct {
+		name    string
+		host    string
+		ids     []rules.ListID
+		wantBlk bool
+	}{{
+		name:    "custom",
+		host:    "custom.example",
+		ids:     nil,
+		wantBlk: true,
+	}, {
+		name:    "active",
+		host:    "always.example",
+		ids:     nil,
+		wantBlk: true,
+	}, {
+		name:    "inactive",
+		host:    "never.example",
+		ids:     nil,
+		wantBlk: false,
+	}, {
+		name:    "inactive_client",
+		host:    "never.example",
+		ids:     []rules.ListID{neverID},
+		wantBlk: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := *setts
+			s.FilterListIDs = tc.ids
+
+			res, err := d.CheckHost(tc.host, dns.TypeA, &s)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantBlk, res.IsFiltered)
+		})
+	}
+}
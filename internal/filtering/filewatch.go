@@ -0,0 +1,140 @@
+package filtering
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// localFilesDebounce is the delay between the last change of a watched local
+// filter file and the refresh of the local filters, so that a file written in
+// several steps is only reloaded once.
+const localFilesDebounce = 2 * time.Second
+
+// localFilesWatcher tracks the files of the filter lists configured from local
+// file paths.
+type localFilesWatcher struct {
+	// watcher notifies about the changes of the files.
+	watcher aghos.FSWatcher
+
+	// mu protects paths.
+	mu *sync.Mutex
+
+	// paths are the currently tracked files.
+	paths *container.MapSet[string]
+}
+
+// newLocalFilesWatcher returns a new properly initialized *localFilesWatcher.
+// w must not be nil.
+func newLocalFilesWatcher(w aghos.FSWatcher) (lw *localFilesWatcher) {
+	return &localFilesWatcher{
+		watcher: w,
+		mu:      &sync.Mutex{},
+		paths:   container.NewMapSet[string](),
+	}
+}
+
+// isLocalList is a [listSelector] that selects the lists configured from local
+// file paths.
+func isLocalList(flt *FilterYAML, _ time.Time) (ok bool) {
+	return filepath.IsAbs(flt.URL)
+}
+
+// syncWatchedFiles makes the watcher track the files of the enabled local
+// filter lists and only them.  d.conf.filtersMu must be locked.
+func (d *DNSFilter) syncWatchedFiles(ctx context.Context) {
+	lw := d.localFiles
+	if lw == nil {
+		return
+	}
+
+	paths := container.NewMapSet[string]()
+	for _, filters := range [][]FilterYAML{d.conf.Filters, d.conf.WhitelistFilters} {
+		for i := range filters {
+			flt := &filters[i]
+			if flt.Enabled && isLocalList(flt, time.Time{}) {
+				paths.Add(filepath.Clean(flt.URL))
+			}
+		}
+	}
+
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	for p := range lw.paths.Range {
+		if paths.Has(p) {
+			continue
+		}
+
+		err := lw.watcher.Remove(p)
+		if err != nil {
+			d.logger.WarnContext(ctx, "unwatching filter file", "path", p, slogutil.KeyError, err)
+		}
+
+		lw.paths.Delete(p)
+	}
+
+	for p := range paths.Range {
+		if lw.paths.Has(p) {
+			continue
+		}
+
+		err := lw.watcher.Add(p)
+		if err != nil {
+			// Try again on the next synchronization.
+			d.logger.WarnContext(ctx, "watching filter file", "path", p, slogutil.KeyError, err)
+
+			continue
+		}
+
+		lw.paths.Add(p)
+	}
+}
+
+// localFilesLoop refreshes the local filter lists after their files change
+// until done is closed.  It is intended to be used as a goroutine.
+func (d *DNSFilter) localFilesLoop(ctx context.Context, done <-chan struct{}) {
+	defer slogutil.RecoverAndLog(ctx, d.logger)
+
+	events := d.localFiles.watcher.Events()
+
+	t := time.NewTimer(localFilesDebounce)
+	t.Stop()
+	defer t.Stop()
+
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+
+			t.Reset(localFilesDebounce)
+		case <-t.C:
+			d.refreshLocalFilters(ctx)
+		case <-done:
+			return
+		}
+	}
+}
+
+// refreshLocalFilters updates the filter lists configured from local file
+// paths and rebuilds the filtering engine, if any of them has changed.
+func (d *DNSFilter) refreshLocalFilters(ctx context.Context) {
+	d.refreshLock.Lock()
+	defer d.refreshLock.Unlock()
+
+	updated, _ := d.refreshFiltersIntl(true, true, isLocalList)
+	if updated == 0 {
+		return
+	}
+
+	d.logger.InfoContext(ctx, "reloaded changed local filters", "updated", updated)
+
+	d.conf.ConfModifier.Apply(ctx)
+}
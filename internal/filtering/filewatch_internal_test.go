@@ -0,0 +1,109 @@
+package filtering
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_localFilesLoop(t *testing.T) {
+	listsDir := t.TempDir()
+	listPath := filepath.Join(listsDir, "list.txt")
+
+	err := os.WriteFile(listPath, []byte("||first.example^\n"), 0o644)
+	require.NoError(t, err)
+
+	watched := make(chan string, 1)
+	unwatched := make(chan string, 1)
+	events := make(chan aghos.Event, 1)
+
+	watcher := aghtest.NewFSWatcher()
+	watcher.OnEvents = func() (e <-chan aghos.Event) { return events }
+	watcher.OnAdd = func(name string) (err error) {
+		testutil.RequireSend(testutil.PanicT{}, watched, name, testTimeout)
+
+		return nil
+	}
+	watcher.OnRemove = func(name string) (err error) {
+		testutil.RequireSend(testutil.PanicT{}, unwatched, name, testTimeout)
+
+		return nil
+	}
+
+	applied := make(chan struct{}, 1)
+	confModifier := &aghtest.ConfigModifier{}
+	confModifier.OnApply = func(_ context.Context) {
+		testutil.RequireSend(testutil.PanicT{}, applied, struct{}{}, testTimeout)
+	}
+
+	d, err := New(&Config{
+		Logger:           testLogger,
+		FilteringEnabled: true,
+		Filters: []FilterYAML{{
+			Enabled: true,
+			URL:     listPath,
+			Name:    "local",
+			Filter:  Filter{ID: 1},
+		}},
+		ConfModifier:   confModifier,
+		HTTPReg:        aghhttp.EmptyRegistrar{},
+		DataDir:        t.TempDir(),
+		SafeFSPatterns: []string{filepath.Join(listsDir, "*")},
+		FilesWatcher:   watcher,
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	ctx := testutil.ContextWithTimeout(t, localFilesDebounce+2*testTimeout)
+	setts := &Settings{
+		ProtectionEnabled: true,
+		FilteringEnabled:  true,
+	}
+
+	d.refreshLocalFilters(ctx)
+	testutil.RequireReceive(t, applied, testTimeout)
+
+	name, _ := testutil.RequireReceive(t, watched, testTimeout)
+	assert.Equal(t, listPath, name)
+
+	res, err := d.CheckHost("first.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+
+	err = os.WriteFile(listPath, []byte("||second.example^\n"), 0o644)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go d.localFilesLoop(ctx, done)
+
+	testutil.RequireSend(t, events, aghos.Event{}, testTimeout)
+	testutil.RequireReceive(t, applied, localFilesDebounce+testTimeout)
+
+	res, err = d.CheckHost("first.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.False(t, res.IsFiltered)
+
+	res, err = d.CheckHost("second.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+
+	d.conf.Filters[0].Enabled = false
+	d.EnableFilters(false)
+
+	name, _ = testutil.RequireReceive(t, unwatched, testTimeout)
+	assert.Equal(t, listPath, name)
+}
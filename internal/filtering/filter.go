@@ -5,13 +5,13 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"net/netip"
 	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
@@ -19,7 +19,10 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/robfig/cron/v3"
 )
 
 // filterDir is the subdirectory of a data directory to store downloaded
@@ -30,13 +33,41 @@ const filterDir = "filters"
 //
 // TODO(e.burkov):  Investigate if the field ordering is important.
 type FilterYAML struct {
-	Enabled     bool
-	URL         string    // URL or a file path
-	Name        string    `yaml:"name"`
+	Enabled bool
+	URL     string // URL or a file path
+	Name    string `yaml:"name"`
+
+	// UpdateCron, if not empty, is the cron expression defining when the
+	// filter is updated.  It takes precedence over UpdateInterval.
+	UpdateCron string `yaml:"update_cron,omitempty"`
+
+	// UpdateInterval, if positive, is the interval between the updates of the
+	// filter, which is used instead of the global one.
+	UpdateInterval timeutil.Duration `yaml:"update_interval,omitempty"`
+
 	RulesCount  int       `yaml:"-"`
 	LastUpdated time.Time `yaml:"-"`
-	checksum    uint32    // checksum of the file data
-	white       bool
+
+	// updateSchedule is the parsed UpdateCron.  It's nil if UpdateCron is
+	// empty.
+	updateSchedule cron.Schedule
+
+	// etag and lastModified are the values of the corresponding HTTP headers
+	// of the last response with the filter data.  They are used to make
+	// conditional requests.
+	etag         string
+	lastModified string
+
+	// jitter is the random delay added to the next update time.
+	jitter time.Duration
+
+	// diff is the difference between the previous and the new data of the
+	// filter list.  It's only set for the refreshed lists, which have
+	// actually been updated.
+	diff *ruleListDiff
+
+	checksum uint32 // checksum of the file data
+	white    bool
 
 	Filter `yaml:",inline"`
 }
@@ -45,6 +76,99 @@ type FilterYAML struct {
 func (filter *FilterYAML) unload() {
 	filter.RulesCount = 0
 	filter.checksum = 0
+	filter.etag = ""
+	filter.lastModified = ""
+}
+
+// initUpdateSchedule parses the update cron expression of the filter.
+func (filter *FilterYAML) initUpdateSchedule() (err error) {
+	if filter.UpdateCron == "" {
+		filter.updateSchedule = nil
+
+		return nil
+	}
+
+	filter.updateSchedule, err = cron.ParseStandard(filter.UpdateCron)
+	if err != nil {
+		return fmt.Errorf("update_cron: %w", err)
+	}
+
+	return nil
+}
+
+// nextUpdate returns the time of the next automatic update of the filter.
+// defaultIvl is the global update interval.  ok is false if the filter isn't
+// updated automatically.
+func (filter *FilterYAML) nextUpdate(defaultIvl time.Duration) (next time.Time, ok bool) {
+	switch {
+	case filter.updateSchedule != nil:
+		next = filter.updateSchedule.Next(filter.LastUpdated)
+	case filter.UpdateInterval > 0:
+		next = filter.LastUpdated.Add(time.Duration(filter.UpdateInterval))
+	case defaultIvl > 0:
+		next = filter.LastUpdated.Add(defaultIvl)
+	default:
+		return time.Time{}, false
+	}
+
+	return next.Add(filter.jitter), true
+}
+
+// updateInterval returns the global update interval of the filters.
+func (c *Config) updateInterval() (ivl time.Duration) {
+	return time.Duration(c.FiltersUpdateIntervalHours) * time.Hour
+}
+
+// newUpdateJitter returns a new random delay for the next update of a filter.
+func (c *Config) newUpdateJitter() (jitter time.Duration) {
+	if c.FiltersUpdateJitter <= 0 {
+		return 0
+	}
+
+	// #nosec G404 -- The jitter doesn't need a cryptographically secure
+	// randomness.
+	return rand.N(time.Duration(c.FiltersUpdateJitter))
+}
+
+// untilNextUpdate returns the duration until the earliest automatic update of
+// the enabled filters.  ok is false if none of them are updated automatically.
+func (d *DNSFilter) untilNextUpdate(now time.Time) (ivl time.Duration, ok bool) {
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	defaultIvl := d.conf.updateInterval()
+	var earliest time.Time
+	for _, filters := range [][]FilterYAML{d.conf.Filters, d.conf.WhitelistFilters} {
+		for i := range filters {
+			flt := &filters[i]
+			if !flt.Enabled {
+				continue
+			}
+
+			next, hasNext := flt.nextUpdate(defaultIvl)
+			if hasNext && (!ok || next.Before(earliest)) {
+				earliest, ok = next, true
+			}
+		}
+	}
+
+	if !ok {
+		return 0, false
+	}
+
+	return max(earliest.Sub(now), 0), true
+}
+
+// initUpdateSchedules parses the update cron expressions of filters.
+func initUpdateSchedules(filters []FilterYAML) (err error) {
+	for i := range filters {
+		err = filters[i].initUpdateSchedule()
+		if err != nil {
+			return fmt.Errorf("filter at index %d: %w", i, err)
+		}
+	}
+
+	return nil
 }
 
 // Path to the filter contents
@@ -193,6 +317,26 @@ func (d *DNSFilter) filterExistsLocked(url string) (ok bool) {
 	return false
 }
 
+// FilterListName returns the name of the configured filter list with id.  It
+// returns an empty string for the built-in and the unknown lists.  It's safe
+// for concurrent use.
+func (d *DNSFilter) FilterListName(id rulelist.APIID) (name string) {
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	for _, flts := range [][]FilterYAML{d.conf.Filters, d.conf.WhitelistFilters} {
+		for _, f := range flts {
+			// #nosec G115 -- The overflow is required for backwards
+			// compatibility.
+			if rulelist.APIID(f.ID) == id {
+				return f.Name
+			}
+		}
+	}
+
+	return ""
+}
+
 // Add a filter
 // Return FALSE if a filter with this URL exists
 func (d *DNSFilter) filterAdd(flt FilterYAML) (err error) {
@@ -266,13 +410,35 @@ func (d *DNSFilter) tryRefreshFilters(block, allow, force bool) (updated int, is
 	}
 	defer d.refreshLock.Unlock()
 
-	updated, isNetworkErr = d.refreshFiltersIntl(block, allow, force)
+	sel := d.isUpdateDue
+	if force {
+		sel = isAnyList
+	}
+
+	updated, isNetworkErr = d.refreshFiltersIntl(block, allow, sel)
 
 	return updated, isNetworkErr, ok
 }
 
+// listSelector returns true if the enabled filter list flt should be updated
+// at now.
+type listSelector func(flt *FilterYAML, now time.Time) (ok bool)
+
+// isAnyList is a [listSelector] that selects all lists.
+func isAnyList(_ *FilterYAML, _ time.Time) (ok bool) {
+	return true
+}
+
+// isUpdateDue is a [listSelector] that selects the lists, the automatic update
+// of which is due.  d.conf.filtersMu must be locked.
+func (d *DNSFilter) isUpdateDue(flt *FilterYAML, now time.Time) (ok bool) {
+	next, ok := flt.nextUpdate(d.conf.updateInterval())
+
+	return ok && !now.Before(next)
+}
+
 // listsToUpdate returns the slice of filter lists that could be updated.
-func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []FilterYAML) {
+func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, sel listSelector) (toUpd []FilterYAML) {
 	now := time.Now()
 
 	d.conf.filtersMu.RLock()
@@ -281,24 +447,19 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 	for i := range *filters {
 		flt := &(*filters)[i] // otherwise we will be operating on a copy
 
-		if !flt.Enabled {
+		if !flt.Enabled || !sel(flt, now) {
 			continue
 		}
 
-		if !force {
-			exp := flt.LastUpdated.Add(time.Duration(d.conf.FiltersUpdateIntervalHours) * time.Hour)
-			if now.Before(exp) {
-				continue
-			}
-		}
-
 		toUpd = append(toUpd, FilterYAML{
 			Filter: Filter{
 				ID: flt.ID,
 			},
-			URL:      flt.URL,
-			Name:     flt.Name,
-			checksum: flt.checksum,
+			URL:          flt.URL,
+			Name:         flt.Name,
+			etag:         flt.etag,
+			lastModified: flt.lastModified,
+			checksum:     flt.checksum,
 		})
 	}
 
@@ -311,9 +472,9 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 func (d *DNSFilter) refreshFiltersArray(
 	ctx context.Context,
 	filters *[]FilterYAML,
-	force bool,
+	sel listSelector,
 ) (updateCount int, updateFilters []FilterYAML, updateFlags []bool, isNetErr bool) {
-	updateFilters = d.listsToUpdate(filters, force)
+	updateFilters = d.listsToUpdate(filters, sel)
 	if len(updateFilters) == 0 {
 		return 0, nil, nil, false
 	}
@@ -371,6 +532,9 @@ func (d *DNSFilter) syncUpdatedFilters(
 			}
 
 			f.LastUpdated = uf.LastUpdated
+			f.jitter = d.conf.newUpdateJitter()
+			f.etag, f.lastModified = uf.etag, uf.lastModified
+
 			if !updated {
 				continue
 			}
@@ -383,6 +547,8 @@ func (d *DNSFilter) syncUpdatedFilters(
 				"prev_rules_count", f.RulesCount,
 			)
 
+			d.recordListChange(ctx, f, uf, filters == &d.conf.WhitelistFilters)
+
 			f.Name = uf.Name
 			f.RulesCount = uf.RulesCount
 			f.checksum = uf.checksum
@@ -393,8 +559,8 @@ func (d *DNSFilter) syncUpdatedFilters(
 	return updateCount
 }
 
-// refreshFiltersIntl checks filters and updates them if necessary.  If force is
-// true, it ignores the filter.LastUpdated field value.
+// refreshFiltersIntl checks the filters selected by sel and updates them if
+// necessary.
 //
 // Algorithm:
 //
@@ -411,7 +577,7 @@ func (d *DNSFilter) syncUpdatedFilters(
 // true if there was a network error and nothing could be updated.
 //
 // TODO(a.garipov, e.burkov): What the hell?
-func (d *DNSFilter) refreshFiltersIntl(block, allow, force bool) (int, bool) {
+func (d *DNSFilter) refreshFiltersIntl(block, allow bool, sel listSelector) (int, bool) {
 	ctx := context.TODO()
 
 	updNum := 0
@@ -425,13 +591,13 @@ func (d *DNSFilter) refreshFiltersIntl(block, allow, force bool) (int, bool) {
 	isNetErr := false
 
 	if block {
-		updNum, lists, toUpd, isNetErr = d.refreshFiltersArray(ctx, &d.conf.Filters, force)
+		updNum, lists, toUpd, isNetErr = d.refreshFiltersArray(ctx, &d.conf.Filters, sel)
 	}
 	if allow {
 		updNumAl, listsAl, toUpdAl, isNetErrAl := d.refreshFiltersArray(
 			ctx,
 			&d.conf.WhitelistFilters,
-			force,
+			sel,
 		)
 
 		updNum += updNumAl
@@ -507,20 +673,40 @@ func (d *DNSFilter) updateIntl(ctx context.Context, flt *FilterYAML) (ok bool, e
 	}
 	defer func() { err = d.finalizeUpdate(ctx, tmpFile, flt, res, err, ok) }()
 
-	r, err := d.reader(flt.URL)
-	if err != nil {
+	r, err := d.reader(ctx, flt)
+	if errors.Is(err, errNotModified) {
+		d.logger.DebugContext(ctx, "filter not modified", "id", flt.ID, "url", flt.URL)
+
+		return false, nil
+	} else if err != nil {
 		// Don't wrap the error since it's informative enough as is.
 		return false, err
 	}
 	defer func() { err = errors.WithDeferred(err, r.Close()) }()
 
+	diff := d.newListDiff(ctx, flt)
+	if diff != nil {
+		r = struct {
+			io.Reader
+			io.Closer
+		}{
+			Reader: io.TeeReader(r, diff),
+			Closer: r,
+		}
+	}
+
 	bufPtr := d.bufPool.Get()
 	defer d.bufPool.Put(bufPtr)
 
 	p := rulelist.NewParser()
 	res, err = p.Parse(tmpFile, r, *bufPtr)
 
-	return res.Checksum != flt.checksum && err == nil, err
+	ok = res.Checksum != flt.checksum && err == nil
+	if ok {
+		flt.diff = diff
+	}
+
+	return ok, err
 }
 
 // finalizeUpdate closes and gets rid of temporary file f with filter's content
@@ -566,12 +752,19 @@ func (d *DNSFilter) finalizeUpdate(
 	return nil
 }
 
+// errNotModified is returned by [DNSFilter.readerFromURL] if the filter data
+// hasn't been modified since the last update.
+const errNotModified errors.Error = "not modified"
+
 // reader returns an io.ReadCloser reading filtering-rule list data form either
 // a file on the filesystem or the filter's HTTP URL.
-func (d *DNSFilter) reader(fltURL string) (r io.ReadCloser, err error) {
+func (d *DNSFilter) reader(ctx context.Context, flt *FilterYAML) (r io.ReadCloser, err error) {
+	fltURL := flt.URL
 	if !filepath.IsAbs(fltURL) {
-		r, err = d.readerFromURL(fltURL)
-		if err != nil {
+		r, err = d.readerFromURL(ctx, flt)
+		if errors.Is(err, errNotModified) {
+			return nil, err
+		} else if err != nil {
 			return nil, fmt.Errorf("reading from url: %w", err)
 		}
 
@@ -592,19 +785,46 @@ func (d *DNSFilter) reader(fltURL string) (r io.ReadCloser, err error) {
 }
 
 // readerFromURL returns an io.ReadCloser reading filtering-rule list data form
-// the filter's URL.
-func (d *DNSFilter) readerFromURL(fltURL string) (r io.ReadCloser, err error) {
-	resp, err := d.conf.HTTPClient.Get(fltURL)
+// the filter's URL.  If the filter data has been loaded, the request is
+// conditional, and errNotModified is returned if the data hasn't changed.  It
+// sets the etag and lastModified fields of flt from the response.
+func (d *DNSFilter) readerFromURL(ctx context.Context, flt *FilterYAML) (r io.ReadCloser, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, flt.URL, nil)
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	if flt.checksum != 0 {
+		if flt.etag != "" {
+			req.Header.Set(httphdr.IfNoneMatch, flt.etag)
+		}
+
+		if flt.lastModified != "" {
+			req.Header.Set(httphdr.IfModifiedSince, flt.lastModified)
+		}
 	}
 
-	return resp.Body, nil
+	// #nosec G704 -- Trust the URL explicitly given by the user.
+	resp, err := d.conf.HTTPClient.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		flt.etag = resp.Header.Get(httphdr.ETag)
+		flt.lastModified = resp.Header.Get(httphdr.LastModified)
+
+		return resp.Body, nil
+	case http.StatusNotModified:
+		return nil, errors.WithDeferred(errNotModified, resp.Body.Close())
+	default:
+		err = fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+
+		return nil, errors.WithDeferred(err, resp.Body.Close())
+	}
 }
 
 // loads filter contents from the file in dataDir
@@ -641,6 +861,7 @@ func (d *DNSFilter) load(ctx context.Context, flt *FilterYAML) (err error) {
 
 	flt.ensureName(res.Title)
 	flt.RulesCount, flt.checksum, flt.LastUpdated = res.RulesCount, res.Checksum, st.ModTime()
+	flt.jitter = d.conf.newUpdateJitter()
 
 	return nil
 }
@@ -657,8 +878,9 @@ func (d *DNSFilter) EnableFilters(async bool) {
 func (d *DNSFilter) enableFiltersLocked(ctx context.Context, async bool) {
 	filters := make([]Filter, 1, len(d.conf.Filters)+len(d.conf.WhitelistFilters)+1)
 	filters[0] = Filter{
-		ID:   rulelist.IDCustom,
-		Data: []byte(strings.Join(d.conf.UserRules, "\n")),
+		ID:       rulelist.IDCustom,
+		Data:     userRulesData(d.conf.UserRules, time.Now()),
+		Schedule: d.conf.UserRulesSchedule,
 	}
 
 	for _, filter := range d.conf.Filters {
@@ -669,6 +891,7 @@ func (d *DNSFilter) enableFiltersLocked(ctx context.Context, async bool) {
 		filters = append(filters, Filter{
 			ID:       filter.ID,
 			FilePath: filter.Path(d.conf.DataDir),
+			Schedule: filter.Schedule,
 		})
 	}
 
@@ -689,6 +912,8 @@ func (d *DNSFilter) enableFiltersLocked(ctx context.Context, async bool) {
 		d.logger.ErrorContext(ctx, "enabling filters", slogutil.KeyError, err)
 	}
 
+	d.syncWatchedFiles(ctx)
+
 	d.SetEnabled(d.conf.FilteringEnabled)
 }
 
@@ -7,10 +7,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/AdguardTeam/golibs/httphdr"
 	"github.com/AdguardTeam/golibs/netutil/urlutil"
 	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -175,3 +179,112 @@ func TestFilterYAML_EnsureName(t *testing.T) {
 		assert.Equal(t, "List 0", f.Name)
 	})
 }
+
+func TestDNSFilter_Update_conditional(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	const etag = `"v1"`
+
+	var numFull, numNotModified atomic.Int32
+	addr := serveHTTPLocally(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(httphdr.IfNoneMatch) == etag {
+			numNotModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		numFull.Add(1)
+		w.Header().Set(httphdr.ETag, etag)
+		_, _ = w.Write([]byte("||example.org^\n"))
+	}))
+
+	f := &FilterYAML{
+		URL:  addr,
+		Name: "test-filter",
+	}
+
+	dnsFilter := newDNSFilter(t)
+
+	updateAndAssert(t, ctx, dnsFilter, f, require.True, 1)
+	assert.Equal(t, etag, f.etag)
+
+	updateAndAssert(t, ctx, dnsFilter, f, require.False, 1)
+
+	assert.Equal(t, int32(1), numFull.Load())
+	assert.Equal(t, int32(1), numNotModified.Load())
+}
+
+func TestFilterYAML_nextUpdate(t *testing.T) {
+	lastUpdated := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		want       time.Time
+		name       string
+		cron       string
+		ivl        timeutil.Duration
+		jitter     time.Duration
+		defaultIvl time.Duration
+		wantOK     bool
+	}{{
+		want:       time.Time{},
+		name:       "disabled",
+		cron:       "",
+		ivl:        0,
+		jitter:     0,
+		defaultIvl: 0,
+		wantOK:     false,
+	}, {
+		want:       lastUpdated.Add(24 * time.Hour),
+		name:       "default",
+		cron:       "",
+		ivl:        0,
+		jitter:     0,
+		defaultIvl: 24 * time.Hour,
+		wantOK:     true,
+	}, {
+		want:       lastUpdated.Add(6*time.Hour + time.Minute),
+		name:       "interval_jitter",
+		cron:       "",
+		ivl:        timeutil.Duration(6 * time.Hour),
+		jitter:     time.Minute,
+		defaultIvl: 24 * time.Hour,
+		wantOK:     true,
+	}, {
+		want:       time.Date(2024, time.January, 2, 4, 30, 0, 0, time.UTC),
+		name:       "cron",
+		cron:       "CRON_TZ=UTC 30 4 * * *",
+		ivl:        timeutil.Duration(6 * time.Hour),
+		jitter:     0,
+		defaultIvl: 0,
+		wantOK:     true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &FilterYAML{
+				UpdateCron:     tc.cron,
+				UpdateInterval: tc.ivl,
+				LastUpdated:    lastUpdated,
+				jitter:         tc.jitter,
+			}
+
+			err := f.initUpdateSchedule()
+			require.NoError(t, err)
+
+			next, ok := f.nextUpdate(tc.defaultIvl)
+			require.Equal(t, tc.wantOK, ok)
+
+			assert.True(t, tc.want.Equal(next), "got %s, want %s", next, tc.want)
+		})
+	}
+
+	t.Run("bad_cron", func(t *testing.T) {
+		f := &FilterYAML{
+			UpdateCron: "bad",
+		}
+
+		err := f.initUpdateSchedule()
+		testutil.AssertErrorMsg(t, "update_cron: expected exactly 5 fields, found 1: [bad]", err)
+	})
+}
@@ -0,0 +1,360 @@
+package filtering
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+const (
+	// maxListChanges is the maximum number of the stored changes of the filter
+	// lists.
+	maxListChanges = 100
+
+	// maxNewDomains is the maximum number of the domains of the added rules
+	// stored for a change of a filter list.
+	maxNewDomains = 10
+)
+
+// ruleListDiff computes the difference between the previous and the new data
+// of a filter list.  The new data is written into it line by line.
+type ruleListDiff struct {
+	// seed is the seed for hashing the rules.
+	seed maphash.Seed
+
+	// prev are the hashes of the rules of the previous data, which haven't
+	// been found in the new data yet.  The hashes are used instead of the
+	// rules themselves to save memory.
+	prev *container.MapSet[uint64]
+
+	// partial is the last incomplete line of the new data.
+	partial []byte
+
+	// newDomains are the first domains of the added rules.
+	newDomains []string
+
+	// added is the number of the added rules.
+	added uint64
+}
+
+// newRuleListDiff returns a new *ruleListDiff for the previous data of the
+// filter list from the file at prevPath using buf for reading.  diff is nil if
+// there is no such file.
+func newRuleListDiff(prevPath string, buf []byte) (diff *ruleListDiff, err error) {
+	// #nosec G304 -- The path is computed from the data directory and the ID
+	// of the filter list.
+	f, err := os.Open(prevPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening previous data: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	diff = &ruleListDiff{
+		seed: maphash.MakeSeed(),
+		prev: container.NewMapSet[uint64](),
+	}
+
+	s := bufio.NewScanner(f)
+	s.Buffer(buf, bufio.MaxScanTokenSize)
+	for s.Scan() {
+		if rule := normalizeRuleLine(s.Text()); rule != "" {
+			diff.prev.Add(maphash.String(diff.seed, rule))
+		}
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading previous data: %w", err)
+	}
+
+	return diff, nil
+}
+
+// newListDiff returns a new *ruleListDiff for the refresh of flt, if it has
+// been loaded previously.  Otherwise, as well as on errors, it returns nil.
+func (d *DNSFilter) newListDiff(ctx context.Context, flt *FilterYAML) (diff *ruleListDiff) {
+	if flt.checksum == 0 {
+		return nil
+	}
+
+	bufPtr := d.bufPool.Get()
+	defer d.bufPool.Put(bufPtr)
+
+	diff, err := newRuleListDiff(flt.Path(d.conf.DataDir), *bufPtr)
+	if err != nil {
+		// Don't prevent the update because of the diff.
+		d.logger.WarnContext(ctx, "computing filter diff", "id", flt.ID, slogutil.KeyError, err)
+	}
+
+	return diff
+}
+
+// type check
+var _ io.Writer = (*ruleListDiff)(nil)
+
+// Write implements the [io.Writer] interface for *ruleListDiff.  It never
+// returns an error.
+func (diff *ruleListDiff) Write(p []byte) (n int, err error) {
+	n = len(p)
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			diff.partial = append(diff.partial, p...)
+
+			return n, nil
+		}
+
+		if len(diff.partial) > 0 {
+			diff.addLine(string(append(diff.partial, p[:i]...)))
+			diff.partial = diff.partial[:0]
+		} else {
+			diff.addLine(string(p[:i]))
+		}
+
+		p = p[i+1:]
+	}
+}
+
+// addLine compares a line of the new data with the previous data.
+func (diff *ruleListDiff) addLine(line string) {
+	rule := normalizeRuleLine(line)
+	if rule == "" {
+		return
+	}
+
+	h := maphash.String(diff.seed, rule)
+	if diff.prev.Has(h) {
+		diff.prev.Delete(h)
+
+		return
+	}
+
+	diff.added++
+	if len(diff.newDomains) >= maxNewDomains {
+		return
+	}
+
+	if d := ruleDomain(rule); d != "" && !slices.Contains(diff.newDomains, d) {
+		diff.newDomains = append(diff.newDomains, d)
+	}
+}
+
+// finish processes the last line of the new data and returns the number of the
+// removed rules.  diff must not be used after calling it.
+func (diff *ruleListDiff) finish() (removed uint64) {
+	if len(diff.partial) > 0 {
+		diff.addLine(string(diff.partial))
+		diff.partial = nil
+	}
+
+	return uint64(diff.prev.Len())
+}
+
+// normalizeRuleLine returns the rule from a line of a filter list.  rule is
+// empty if the line isn't a rule.
+func normalizeRuleLine(line string) (rule string) {
+	rule = strings.TrimSpace(line)
+	if rule == "" || rule[0] == '!' || rule[0] == '#' {
+		return ""
+	}
+
+	return rule
+}
+
+// ruleDomain returns the domain name blocked or allowed by rule.  domain is
+// empty if rule isn't a simple domain rule, a hosts-file entry, or a domain
+// name.
+func ruleDomain(rule string) (domain string) {
+	rule = strings.TrimPrefix(rule, "@@")
+	if rest, ok := strings.CutPrefix(rule, "||"); ok {
+		domain, _, _ = strings.Cut(rest, "^")
+	} else if fields := strings.Fields(rule); len(fields) >= 2 {
+		if _, err := netip.ParseAddr(fields[0]); err != nil {
+			return ""
+		}
+
+		domain = fields[1]
+	} else {
+		domain = rule
+	}
+
+	if netutil.ValidateDomainName(domain) != nil {
+		return ""
+	}
+
+	return strings.ToLower(domain)
+}
+
+// listChange is a change of the data of a filter list.
+type listChange struct {
+	Time time.Time      `json:"time"`
+	URL  string         `json:"url"`
+	Name string         `json:"name"`
+	ID   rulelist.APIID `json:"id"`
+
+	// NewDomains are the first domains of the added rules.
+	NewDomains []string `json:"new_domains"`
+
+	Added          uint64 `json:"added"`
+	Removed        uint64 `json:"removed"`
+	RulesCount     int    `json:"rules_count"`
+	PrevRulesCount int    `json:"prev_rules_count"`
+	Whitelist      bool   `json:"whitelist"`
+
+	// Suspicious is true if more than a half of the previous rules have been
+	// removed.
+	Suspicious bool `json:"suspicious"`
+}
+
+// listChanges stores the latest changes of the filter lists in memory.
+type listChanges struct {
+	// mu protects changes.
+	mu *sync.Mutex
+
+	// changes are the stored changes, the oldest first.
+	changes []*listChange
+}
+
+// newListChanges returns a new properly initialized *listChanges.
+func newListChanges() (c *listChanges) {
+	return &listChanges{
+		mu: &sync.Mutex{},
+	}
+}
+
+// add stores ch, removing the oldest changes if needed.
+func (c *listChanges) add(ch *listChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.changes) >= maxListChanges {
+		c.changes = slices.Delete(c.changes, 0, len(c.changes)-maxListChanges+1)
+	}
+
+	c.changes = append(c.changes, ch)
+}
+
+// list returns the stored changes of the filter list with id, the newest
+// first.  If id is nil, the changes of all lists are returned.
+func (c *listChanges) list(id *rulelist.APIID) (changes []*listChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changes = make([]*listChange, 0, len(c.changes))
+	for _, ch := range slices.Backward(c.changes) {
+		if id == nil || ch.ID == *id {
+			changes = append(changes, ch)
+		}
+	}
+
+	return changes
+}
+
+// recordListChange stores the change of the updated filter list uf, the
+// previous version of which is prev.  d.conf.filtersMu must be locked.
+func (d *DNSFilter) recordListChange(
+	ctx context.Context,
+	prev *FilterYAML,
+	uf *FilterYAML,
+	whitelist bool,
+) {
+	diff := uf.diff
+	if diff == nil {
+		return
+	}
+
+	uf.diff = nil
+
+	ch := &listChange{
+		Time:       uf.LastUpdated,
+		URL:        uf.URL,
+		Name:       prev.Name,
+		NewDomains: slices.Clip(diff.newDomains),
+		// #nosec G115 -- The overflow is required for backwards compatibility.
+		ID:             rulelist.APIID(uf.ID),
+		Added:          diff.added,
+		Removed:        diff.finish(),
+		RulesCount:     uf.RulesCount,
+		PrevRulesCount: prev.RulesCount,
+		Whitelist:      whitelist,
+	}
+
+	ch.Suspicious = prev.RulesCount > 0 && ch.Removed*2 > uint64(prev.RulesCount)
+
+	d.listChanges.add(ch)
+
+	lvl := slog.LevelInfo
+	msg := "filter list changed"
+	if ch.Suspicious {
+		lvl = slog.LevelWarn
+		msg = "filter list lost more than a half of its rules"
+	}
+
+	d.logger.Log(
+		ctx,
+		lvl,
+		msg,
+		"id", ch.ID,
+		"url", ch.URL,
+		"added", ch.Added,
+		"removed", ch.Removed,
+	)
+}
+
+// listChangesResp is the response of the GET /control/filtering/changes HTTP
+// API.
+type listChangesResp struct {
+	Changes []*listChange `json:"changes"`
+}
+
+// handleFilteringChanges is the handler for the GET /control/filtering/changes
+// HTTP API.  The optional query parameter id selects a single filter list.
+func (d *DNSFilter) handleFilteringChanges(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var id *rulelist.APIID
+	if s := r.URL.Query().Get("id"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			aghhttp.ErrorAndLog(
+				ctx,
+				d.logger,
+				r,
+				w,
+				http.StatusBadRequest,
+				"bad id query parameter: %q",
+				s,
+			)
+
+			return
+		}
+
+		apiID := rulelist.APIID(v)
+		id = &apiID
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, d.logger, w, r, &listChangesResp{
+		Changes: d.listChanges.list(id),
+	})
+}
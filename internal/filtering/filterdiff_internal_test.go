@@ -0,0 +1,156 @@
+package filtering
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleListDiff(t *testing.T) {
+	prevPath := filepath.Join(t.TempDir(), "prev.txt")
+	err := os.WriteFile(prevPath, []byte("! Title: List\n||kept.example^\n||removed.example^\n"), 0o644)
+	require.NoError(t, err)
+
+	diff, err := newRuleListDiff(prevPath, make([]byte, rulelist.DefaultRuleBufSize))
+	require.NoError(t, err)
+	require.NotNil(t, diff)
+
+	chunks := []string{
+		"! Title: New list\n||ke",
+		"pt.example^\r\n0.0.0.0 Hosts.Example\n",
+		"# comment\n@@||allowed.example^$important\n/regexp/",
+	}
+	for _, c := range chunks {
+		_, err = diff.Write([]byte(c))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, uint64(1), diff.finish())
+	assert.Equal(t, uint64(3), diff.added)
+	assert.Equal(t, []string{"hosts.example", "allowed.example"}, diff.newDomains)
+
+	diff, err = newRuleListDiff(filepath.Join(t.TempDir(), "none.txt"), nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, diff)
+}
+
+func TestRuleDomain(t *testing.T) {
+	testCases := []struct {
+		name string
+		rule string
+		want string
+	}{{
+		name: "adblock",
+		rule: "||block.example^",
+		want: "block.example",
+	}, {
+		name: "allowlist",
+		rule: "@@||allow.example^$important",
+		want: "allow.example",
+	}, {
+		name: "hosts",
+		rule: "127.0.0.1 Hosts.Example",
+		want: "hosts.example",
+	}, {
+		name: "domain",
+		rule: "plain.example",
+		want: "plain.example",
+	}, {
+		name: "regexp",
+		rule: "/ads[0-9]+/",
+		want: "",
+	}, {
+		name: "bad_hosts",
+		rule: "host.example alias.example",
+		want: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ruleDomain(tc.rule))
+		})
+	}
+}
+
+func TestDNSFilter_handleFilteringChanges(t *testing.T) {
+	listsDir := t.TempDir()
+	listPath := filepath.Join(listsDir, "list.txt")
+
+	err := os.WriteFile(listPath, []byte("||first.example^\n||second.example^\n"), 0o644)
+	require.NoError(t, err)
+
+	d, err := New(&Config{
+		Logger:           testLogger,
+		FilteringEnabled: true,
+		Filters: []FilterYAML{{
+			Enabled: true,
+			URL:     listPath,
+			Name:    "local",
+			Filter:  Filter{ID: 1},
+		}},
+		ConfModifier:   agh.EmptyConfigModifier{},
+		HTTPReg:        aghhttp.EmptyRegistrar{},
+		DataDir:        t.TempDir(),
+		SafeFSPatterns: []string{filepath.Join(listsDir, "*")},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	updated, _ := d.refreshFiltersIntl(true, true, isAnyList)
+	require.Equal(t, 1, updated)
+
+	// The initial download isn't a change.
+	assert.Empty(t, d.listChanges.list(nil))
+
+	err = os.WriteFile(listPath, []byte("||third.example^\n"), 0o644)
+	require.NoError(t, err)
+
+	updated, _ = d.refreshFiltersIntl(true, true, isAnyList)
+	require.Equal(t, 1, updated)
+
+	getChanges := func(t *testing.T, query string) (resp *listChangesResp) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/control/filtering/changes"+query, nil)
+		w := httptest.NewRecorder()
+		d.handleFilteringChanges(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp = &listChangesResp{}
+		err = json.NewDecoder(w.Body).Decode(resp)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	resp := getChanges(t, "?id=1")
+	require.Len(t, resp.Changes, 1)
+
+	ch := resp.Changes[0]
+	assert.Equal(t, rulelist.APIID(1), ch.ID)
+	assert.Equal(t, uint64(1), ch.Added)
+	assert.Equal(t, uint64(2), ch.Removed)
+	assert.Equal(t, 1, ch.RulesCount)
+	assert.Equal(t, 2, ch.PrevRulesCount)
+	assert.Equal(t, []string{"third.example"}, ch.NewDomains)
+	assert.True(t, ch.Suspicious)
+	assert.False(t, ch.Whitelist)
+
+	assert.Empty(t, getChanges(t, "?id=2").Changes)
+
+	r := httptest.NewRequest(http.MethodGet, "/control/filtering/changes?id=bad", nil)
+	w := httptest.NewRecorder()
+	d.handleFilteringChanges(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
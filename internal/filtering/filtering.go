@@ -23,12 +23,14 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/hostsfile"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/mathutil"
 	"github.com/AdguardTeam/golibs/syncutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/AdguardTeam/urlfilter"
 	"github.com/AdguardTeam/urlfilter/filterlist"
 	"github.com/AdguardTeam/urlfilter/rules"
@@ -63,6 +65,19 @@ type Settings struct {
 
 	// ClientSafeSearch is a client configured safe search.
 	ClientSafeSearch SafeSearch
+
+	// FilterListIDs are the IDs of the blocklists applied to the request.  If
+	// empty, all enabled blocklists are applied.  The user rules are always
+	// applied.
+	FilterListIDs []rules.ListID
+
+	// Allowlist are the sorted domain names the client may resolve, if
+	// AllowlistOnly is true.  It must not be modified.
+	Allowlist []string
+
+	// AllowlistOnly defines if all domain names except the ones from
+	// Allowlist and their subdomains are blocked.
+	AllowlistOnly bool
 }
 
 // Resolver is the interface for net.Resolver to simplify testing.
@@ -88,6 +103,10 @@ type Config struct {
 	// ParentControl is the parental control hash-prefix checker.
 	ParentalControlChecker Checker `yaml:"-"`
 
+	// ThreatChecker is the threat-intelligence feeds checker.  It's nil if the
+	// threat feeds are disabled.
+	ThreatChecker ThreatChecker `yaml:"-"`
+
 	SafeSearch SafeSearch `yaml:"-"`
 
 	// ApplyClientFiltering retrieves persistent client information using the
@@ -99,6 +118,30 @@ type Config struct {
 	// Per-client settings can override this configuration.
 	BlockedServices *BlockedServices `yaml:"blocked_services"`
 
+	// CustomBlockedServices are the user-defined blocked services, which are
+	// available alongside the built-in ones.  They must be registered with
+	// [SetCustomBlockedServices] before the blocked services are validated.
+	CustomBlockedServices []*CustomBlockedService `yaml:"custom_blocked_services"`
+
+	// ThreatFeeds is the configuration of the threat-intelligence feeds.
+	ThreatFeeds *ThreatFeedsConfig `yaml:"threat_feeds"`
+
+	// BlockedTLDs is the configuration of blocking entire top-level domains
+	// and other public suffixes.
+	BlockedTLDs *BlockedTLDs `yaml:"blocked_tlds"`
+
+	// NewDomains is the configuration of blocking the requests for the newly
+	// observed domains.
+	NewDomains *NewDomainsConfig `yaml:"new_domains"`
+
+	// DGA is the configuration of detecting the domain names generated by
+	// domain generation algorithms.
+	DGA *DGAConfig `yaml:"dga"`
+
+	// Homographs is the configuration of detecting the internationalized
+	// domain names confusable with the protected brands.
+	Homographs *HomographConfig `yaml:"homographs"`
+
 	// EtcHosts is a container of IP-hostname pairs taken from the operating
 	// system configuration files (e.g. /etc/hosts).
 	//
@@ -112,6 +155,11 @@ type Config struct {
 	// HTTPReg registers HTTP handlers.  It must not be nil.
 	HTTPReg aghhttp.Registrar `yaml:"-"`
 
+	// FilesWatcher notifies about the changes of the files of the filter lists
+	// configured from local file paths, which are then reloaded.  If it's nil,
+	// the files are only reloaded on the updates of the filters.
+	FilesWatcher aghos.FSWatcher `yaml:"-"`
+
 	// HTTPClient is the client to use for updating the remote filters.
 	HTTPClient *http.Client `yaml:"-"`
 
@@ -150,6 +198,10 @@ type Config struct {
 	// UserRules is the global list of custom rules.
 	UserRules []string `yaml:"-"`
 
+	// UserRulesSchedule, if not nil, is the weekly schedule, during which the
+	// custom rules are applied.
+	UserRulesSchedule *schedule.Weekly `yaml:"user_rules_schedule,omitempty"`
+
 	// SafeFSPatterns are the patterns for matching which local filtering-rule
 	// files can be added.
 	SafeFSPatterns []string `yaml:"safe_fs_patterns"`
@@ -171,6 +223,11 @@ type Config struct {
 	// (in hours).
 	FiltersUpdateIntervalHours uint32 `yaml:"filters_update_interval"`
 
+	// FiltersUpdateJitter is the maximum random delay added to the update
+	// times of the filters, so that many instances don't request the filters
+	// at the same time.
+	FiltersUpdateJitter timeutil.Duration `yaml:"filters_update_jitter"`
+
 	// BlockedResponseTTL is the time-to-live value for blocked responses.  If
 	// 0, then default value is used (3600).
 	BlockedResponseTTL uint32 `yaml:"blocked_response_ttl"`
@@ -181,6 +238,10 @@ type Config struct {
 	// RewritesEnabled indicates whether legacy rewrites are applied.
 	RewritesEnabled bool `yaml:"rewrites_enabled"`
 
+	// DecisionTrace defines if the steps performed by [DNSFilter.CheckHost]
+	// are recorded into [Result.Trace] and, consequently, into the query log.
+	DecisionTrace bool `yaml:"decision_trace"`
+
 	ParentalEnabled     bool `yaml:"parental_enabled"`
 	SafeBrowsingEnabled bool `yaml:"safebrowsing_enabled"`
 
@@ -261,6 +322,18 @@ type DNSFilter struct {
 	rulesStorageAllow    *filterlist.RuleStorage
 	filteringEngineAllow *urlfilter.DNSEngine
 
+	// blockFilters are the blocklists, from which filteringEngine is built.
+	// It's protected by engineLock.
+	blockFilters []Filter
+
+	// hasSchedules is true if any of blockFilters has a schedule.  It's
+	// protected by engineLock.
+	hasSchedules bool
+
+	// views are the filtering engines built from the subsets of blockFilters
+	// by the keys of the subsets.  It's protected by viewsMu.
+	views map[string]*engineView
+
 	safeSearch SafeSearch
 
 	// safeBrowsingChecker is the safe browsing hash-prefix checker.
@@ -269,6 +342,10 @@ type DNSFilter struct {
 	// parentalControl is the parental control hash-prefix checker.
 	parentalControlChecker Checker
 
+	// threatChecker is the threat-intelligence feeds checker.  It's nil if the
+	// threat feeds are disabled.
+	threatChecker ThreatChecker
+
 	// applyClientFiltering retrieves persistent client information using the
 	// ClientID or client IP address, and applies it to the filtering settings.
 	//
@@ -278,6 +355,9 @@ type DNSFilter struct {
 
 	engineLock sync.RWMutex
 
+	// viewsMu protects views.
+	viewsMu sync.Mutex
+
 	// confMu protects conf.
 	confMu *sync.RWMutex
 
@@ -287,6 +367,27 @@ type DNSFilter struct {
 	// done is the channel to signal to stop running filters updates loop.
 	done chan struct{}
 
+	// threatDone is closed to stop the threat feeds updates loop.
+	threatDone chan struct{}
+
+	// localFiles tracks the files of the local filter lists.  It's nil if
+	// they aren't watched.
+	localFiles *localFilesWatcher
+
+	// localFilesDone is closed to stop the local filter files watching loop.
+	localFilesDone chan struct{}
+
+	// observedDomains is the database of the observed domains.  It's nil if
+	// the newly observed domains aren't checked.
+	observedDomains *observedDomains
+
+	// observedDomainsDone is closed to stop the observed domains saving loop.
+	observedDomainsDone chan struct{}
+
+	// userRulesExpiryDone is closed to stop the expired user rules removal
+	// loop.
+	userRulesExpiryDone chan struct{}
+
 	// Channel for passing data to filters-initializer goroutine
 	filtersInitializerChan chan filtersInitializerParams
 	filtersInitializerLock sync.Mutex
@@ -295,6 +396,12 @@ type DNSFilter struct {
 
 	hostCheckers []hostChecker
 
+	// hits counts the matches of the rules and the filter lists.
+	hits *hitCounter
+
+	// listChanges stores the latest changes of the filter lists.
+	listChanges *listChanges
+
 	safeFSPatterns []string
 }
 
@@ -306,6 +413,11 @@ type Filter struct {
 	// Data is the content of the file.
 	Data []byte `yaml:"-"`
 
+	// Schedule, if not nil, is the weekly schedule, during which the filter is
+	// applied.  Outside of it, the filter is ignored.  It's only used for
+	// blocklists.
+	Schedule *schedule.Weekly `yaml:"schedule,omitempty"`
+
 	// ID is automatically assigned when filter is added.
 	ID rules.ListID `yaml:"id"`
 }
@@ -394,10 +506,33 @@ func (d *DNSFilter) Close() {
 		d.done <- struct{}{}
 	}
 
+	if d.threatDone != nil {
+		close(d.threatDone)
+		d.threatDone = nil
+	}
+
+	if d.localFilesDone != nil {
+		close(d.localFilesDone)
+		d.localFilesDone = nil
+	}
+
+	if d.observedDomainsDone != nil {
+		close(d.observedDomainsDone)
+		d.observedDomainsDone = nil
+		d.saveObservedDomains(context.TODO())
+	}
+
+	if d.userRulesExpiryDone != nil {
+		close(d.userRulesExpiryDone)
+		d.userRulesExpiryDone = nil
+	}
+
 	d.reset(context.TODO())
 }
 
 func (d *DNSFilter) reset(ctx context.Context) {
+	d.resetViews(ctx)
+
 	if d.rulesStorage != nil {
 		if err := d.rulesStorage.Close(); err != nil {
 			d.logger.ErrorContext(ctx, "closing rules storage", slogutil.KeyError, err)
@@ -492,15 +627,82 @@ func (r Reason) Matched() bool {
 
 // CheckHostRules tries to match the host against filtering rules only.
 func (d *DNSFilter) CheckHostRules(host string, rrtype uint16, setts *Settings) (Result, error) {
-	return d.matchHost(strings.ToLower(host), rrtype, setts)
+	res, err := d.matchHost(strings.ToLower(host), rrtype, setts)
+	if err == nil {
+		d.hits.record(&res, time.Now())
+	}
+
+	return res, err
 }
 
 // CheckHost tries to match the host against filtering rules, then safebrowsing
-// and parental control rules, if they are enabled.
+// and parental control rules, if they are enabled.  The matched rules are
+// counted.  If [Config.DecisionTrace] is true, the performed steps are recorded
+// into res.Trace.
 func (d *DNSFilter) CheckHost(
 	host string,
 	qtype uint16,
 	setts *Settings,
+) (res Result, err error) {
+	d.confMu.RLock()
+	trace := d.conf.DecisionTrace
+	d.confMu.RUnlock()
+
+	var onStep func(name string, res Result)
+	var steps []*TraceStep
+	if trace {
+		onStep = func(name string, stepRes Result) {
+			steps = append(steps, newTraceStep(name, &stepRes))
+		}
+	}
+
+	res, err = d.checkHost(host, qtype, setts, onStep)
+	if err != nil {
+		return res, err
+	}
+
+	res.Trace = steps
+	d.hits.record(&res, time.Now())
+
+	return res, nil
+}
+
+// CheckStep is a step of the processing of a request by
+// [DNSFilter.CheckHostTrace].
+type CheckStep struct {
+	// Name is the name of the step, such as "rewrites" or "safe browsing".
+	Name string
+
+	// Result is the result of the step.  The processing stops at the first
+	// step with a matched result.
+	Result Result
+}
+
+// CheckHostTrace is like [DNSFilter.CheckHost] but also returns the performed
+// steps in the order of processing.  The matched rules aren't counted.
+func (d *DNSFilter) CheckHostTrace(
+	host string,
+	qtype uint16,
+	setts *Settings,
+) (res Result, steps []*CheckStep, err error) {
+	res, err = d.checkHost(host, qtype, setts, func(name string, stepRes Result) {
+		steps = append(steps, &CheckStep{
+			Name:   name,
+			Result: stepRes,
+		})
+	})
+
+	return res, steps, err
+}
+
+// checkHost is the implementation of [DNSFilter.CheckHost], which doesn't count
+// the matched rules.  onStep, if not nil, is called with the result of each
+// performed step.
+func (d *DNSFilter) checkHost(
+	host string,
+	qtype uint16,
+	setts *Settings,
+	onStep func(name string, res Result),
 ) (res Result, err error) {
 	// Sometimes clients try to resolve ".", which is a request to get root
 	// servers.
@@ -508,21 +710,39 @@ func (d *DNSFilter) CheckHost(
 		return Result{}, nil
 	}
 
+	if onStep == nil {
+		onStep = func(_ string, _ Result) {}
+	}
+
 	host = strings.ToLower(host)
 
 	if setts.FilteringEnabled {
 		res = d.processRewrites(host, qtype)
+		onStep("rewrites", res)
 		if res.Reason == Rewritten {
 			return res, nil
 		}
 	}
 
+	if setts.ProtectionEnabled && setts.AllowlistOnly {
+		res = Result{}
+		if !isAllowlisted(host, setts.Allowlist) {
+			res = allowlistOnlyResult()
+		}
+
+		onStep("allowlist-only mode", res)
+		if res.IsFiltered {
+			return res, nil
+		}
+	}
+
 	for _, hc := range d.hostCheckers {
 		res, err = hc.check(host, qtype, setts)
 		if err != nil {
 			return Result{}, fmt.Errorf("%s: %w", hc.name, err)
 		}
 
+		onStep(hc.name, res)
 		if res.Reason.Matched() {
 			return res, nil
 		}
@@ -540,6 +760,9 @@ func (d *DNSFilter) CheckHost(
 // Secondly, it finds A or AAAA rewrites for host and, if found, sets res.IPList
 // accordingly.  If the found rewrite has a special value of "A" or "AAAA", the
 // result is an exception.
+//
+// If there are no rewrites for the reversed address in a PTR request, the PTR
+// records are synthesized from the A and AAAA rewrites.
 func (d *DNSFilter) processRewrites(host string, qtype uint16) (res Result) {
 	d.confMu.RLock()
 	defer d.confMu.RUnlock()
@@ -552,6 +775,10 @@ func (d *DNSFilter) processRewrites(host string, qtype uint16) (res Result) {
 
 	rewrites, matched := findRewrites(d.conf.Rewrites, host, qtype)
 	if !matched {
+		if qtype == dns.TypePTR {
+			return rewritePTRResult(d.conf.Rewrites, host)
+		}
+
 		return Result{}
 	}
 
@@ -604,6 +831,8 @@ func (d *DNSFilter) handleRewriteLoop(
 
 		cnames.Add(host)
 		res.CanonName = host
+		res.FlattenCNAME = res.FlattenCNAME || rw.FlattenCNAME
+		res.TTL = minRewriteTTL(res.TTL, rw.TTL)
 		rewrites, matched = findRewrites(d.conf.Rewrites, host, qtype)
 	}
 
@@ -759,6 +988,10 @@ func (d *DNSFilter) initFiltering(ctx context.Context, allowFilters, blockFilter
 		d.reset(ctx)
 		d.rulesStorage = rulesStorage
 		d.filteringEngine = filteringEngine
+		d.blockFilters = blockFilters
+		d.hasSchedules = slices.ContainsFunc(blockFilters, func(f Filter) (ok bool) {
+			return f.Schedule != nil
+		})
 		d.rulesStorageAllow = rulesStorageAllow
 		d.filteringEngineAllow = filteringEngineAllow
 	}()
@@ -910,11 +1143,13 @@ func (d *DNSFilter) matchHost(
 		}
 	}
 
-	if d.filteringEngine == nil {
+	ids := d.activeFilterIDs(setts.FilterListIDs, time.Now())
+	engine := d.engineFor(ctx, ids)
+	if engine == nil {
 		return Result{}, nil
 	}
 
-	dnsres, matchedEngine := d.filteringEngine.MatchRequest(ufReq)
+	dnsres, matchedEngine := engine.MatchRequest(ufReq)
 
 	// Check DNS rewrites first, because the API there is a bit awkward.
 	dnsRWRes := d.processDNSResultRewrites(dnsres, host)
@@ -976,8 +1211,15 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		refreshLock:            &sync.Mutex{},
 		safeBrowsingChecker:    c.SafeBrowsingChecker,
 		parentalControlChecker: c.ParentalControlChecker,
+		threatChecker:          c.ThreatChecker,
 		applyClientFiltering:   c.ApplyClientFiltering,
 		confMu:                 &sync.RWMutex{},
+		hits:                   newHitCounter(time.Now()),
+		listChanges:            newListChanges(),
+	}
+
+	if c.FilesWatcher != nil {
+		d.localFiles = newLocalFilesWatcher(c.FilesWatcher)
 	}
 
 	err = d.validateSafeFSPatterns(c.SafeFSPatterns)
@@ -992,9 +1234,24 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 	}, {
 		check: d.matchHost,
 		name:  "filtering",
+	}, {
+		check: d.checkBlockedTLDs,
+		name:  "blocked tlds",
 	}, {
 		check: d.matchBlockedServicesRules,
 		name:  "blocked services",
+	}, {
+		check: d.checkThreatFeeds,
+		name:  "threat feeds",
+	}, {
+		check: d.checkNewDomains,
+		name:  "new domains",
+	}, {
+		check: d.checkDGA,
+		name:  "dga",
+	}, {
+		check: d.checkHomographs,
+		name:  "homographs",
 	}, {
 		check: d.checkSafeBrowsing,
 		name:  "safe browsing",
@@ -1024,6 +1281,38 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		}
 	}
 
+	if d.conf.BlockedTLDs != nil {
+		err = d.conf.BlockedTLDs.init()
+		if err != nil {
+			return nil, fmt.Errorf("initializing blocked tlds: %w", err)
+		}
+	}
+
+	err = d.conf.NewDomains.validate()
+	if err != nil {
+		return nil, fmt.Errorf("new_domains: %w", err)
+	}
+
+	err = d.conf.DGA.validate()
+	if err != nil {
+		return nil, fmt.Errorf("dga: %w", err)
+	}
+
+	if d.conf.Homographs != nil {
+		err = d.conf.Homographs.init()
+		if err != nil {
+			return nil, fmt.Errorf("initializing homographs: %w", err)
+		}
+	}
+
+	if nd := d.conf.NewDomains; nd != nil && nd.Enabled {
+		path := filepath.Join(d.conf.DataDir, observedDomainsFileName)
+		d.observedDomains, err = newObservedDomains(path, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("loading observed domains: %w", err)
+		}
+	}
+
 	if blockFilters != nil {
 		err = d.initFiltering(ctx, nil, blockFilters)
 		if err != nil {
@@ -1040,6 +1329,16 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		return nil, fmt.Errorf("making filtering directory: %w", err)
 	}
 
+	err = errors.Join(
+		initUpdateSchedules(d.conf.Filters),
+		initUpdateSchedules(d.conf.WhitelistFilters),
+	)
+	if err != nil {
+		d.Close()
+
+		return nil, fmt.Errorf("filters: %w", err)
+	}
+
 	d.loadFilters(ctx, d.conf.Filters)
 	d.loadFilters(ctx, d.conf.WhitelistFilters)
 
@@ -1076,6 +1375,24 @@ func (d *DNSFilter) Start() {
 	d.RegisterFilteringHandlers()
 
 	go d.updatesLoop(context.TODO())
+
+	if d.threatChecker != nil {
+		d.threatDone = make(chan struct{})
+		go d.threatFeedsLoop(context.TODO(), d.conf.threatFeedsInterval())
+	}
+
+	if d.localFiles != nil {
+		d.localFilesDone = make(chan struct{})
+		go d.localFilesLoop(context.TODO(), d.localFilesDone)
+	}
+
+	if d.observedDomains != nil {
+		d.observedDomainsDone = make(chan struct{})
+		go d.observedDomainsLoop(context.TODO(), d.observedDomainsDone)
+	}
+
+	d.userRulesExpiryDone = make(chan struct{})
+	go d.userRulesExpiryLoop(context.TODO(), d.userRulesExpiryDone)
 }
 
 // updatesLoop initializes new filters and checks for filters updates in a loop.
@@ -1108,9 +1425,12 @@ func (d *DNSFilter) updatesLoop(ctx context.Context) {
 // periodicallyRefreshFilters checks for filters updates and returns time
 // interval for the next update.
 func (d *DNSFilter) periodicallyRefreshFilters(ivl time.Duration) (nextIvl time.Duration) {
-	const maxInterval = time.Hour
+	const (
+		minInterval = time.Minute
+		maxInterval = time.Hour
+	)
 
-	if d.conf.FiltersUpdateIntervalHours == 0 {
+	if _, ok := d.untilNextUpdate(time.Now()); !ok {
 		return ivl
 	}
 
@@ -1119,6 +1439,9 @@ func (d *DNSFilter) periodicallyRefreshFilters(ivl time.Duration) (nextIvl time.
 
 	if ok && !isNetErr {
 		ivl = maxInterval
+		if untilNext, hasNext := d.untilNextUpdate(time.Now()); hasNext {
+			ivl = min(max(untilNext, minInterval), maxInterval)
+		}
 	} else if isNetErr {
 		ivl *= 2
 		ivl = max(ivl, maxInterval)
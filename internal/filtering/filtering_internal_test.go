@@ -173,6 +173,50 @@ func TestDNSFilter_CheckHost_hostRules(t *testing.T) {
 	assert.Equal(t, res.Rules[0].IP, netutil.IPv6Localhost())
 }
 
+func TestDNSFilter_CheckHost_decisionTrace(t *testing.T) {
+	const rule = "||blocked.example^"
+
+	filters := []Filter{{
+		ID: 0, Data: []byte(rule + "\n"),
+	}}
+	d, setts := newForTest(t, &Config{DecisionTrace: true}, filters)
+	t.Cleanup(d.Close)
+
+	res, err := d.CheckHost("blocked.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+	assert.Equal(t, []*TraceStep{{
+		Name: "rewrites",
+	}, {
+		Name: "hosts container",
+	}, {
+		Name: "filtering",
+		Rules: []*ResultRule{{
+			Text: rule,
+		}},
+		Reason: FilteredBlockList,
+	}}, res.Trace)
+
+	res, err = d.CheckHost("allowed.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.False(t, res.IsFiltered)
+	require.NotEmpty(t, res.Trace)
+
+	for _, step := range res.Trace {
+		assert.Equal(t, NotFilteredNotFound, step.Reason, step.Name)
+	}
+
+	d.conf.DecisionTrace = false
+
+	res, err = d.CheckHost("blocked.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+	assert.Empty(t, res.Trace)
+}
+
 // Safe Browsing.
 
 func TestSafeBrowsing(t *testing.T) {
@@ -0,0 +1,264 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Types of the values of the data section.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEnd       = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// maxDepth is the maximum nesting of the decoded values, which protects
+// against the malformed databases.
+const maxDepth = 32
+
+// errUnexpectedEnd is returned when the data ends in the middle of a value.
+const errUnexpectedEnd errors.Error = "unexpected end of data"
+
+// decoder decodes the values of the data section of a MaxMind DB.
+type decoder struct {
+	// data is the data section.  The pointers are offsets in it.
+	data []byte
+}
+
+// decode decodes the value at offset.  The maps are decoded into
+// map[string]any, the arrays into []any, the unsigned integers into uint64,
+// the signed ones into int64, the floating-point numbers into float64, and the
+// 128-bit integers into []byte.  next is the offset after the value.
+func (d *decoder) decode(offset uint, depth int) (v any, next uint, err error) {
+	if depth > maxDepth {
+		return nil, 0, errors.Error("too deep nesting")
+	}
+
+	typ, size, offset, err := d.decodeCtrl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		// The value after a pointer is the one after the pointer itself, and
+		// not after the value it points to.
+		v, _, err = d.decode(size, depth+1)
+
+		return v, offset, err
+	}
+
+	return d.decodeValue(typ, size, offset, depth)
+}
+
+// decodeCtrl decodes the control byte at offset and the following extended
+// type and size bytes.  For pointers, size is the decoded pointer.  next is the
+// offset of the payload.
+func (d *decoder) decodeCtrl(offset uint) (typ, size, next uint, err error) {
+	b, err := d.read(offset, 1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	ctrl := uint(b[0])
+	typ, next = ctrl>>5, offset+1
+	if typ == typePointer {
+		return d.decodePointer(ctrl, next)
+	}
+
+	if typ == typeExtended {
+		b, err = d.read(next, 1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		typ, next = 7+uint(b[0]), next+1
+	}
+
+	size = ctrl & 0x1f
+	if size < 29 {
+		return typ, size, next, nil
+	}
+
+	n := size - 28
+	b, err = d.read(next, n)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	size = uintFromBytes(b)
+	switch n {
+	case 1:
+		size += 29
+	case 2:
+		size += 285
+	default:
+		size += 65821
+	}
+
+	return typ, size, next + n, nil
+}
+
+// decodePointer decodes the pointer with the control byte ctrl and the payload
+// at offset.
+func (d *decoder) decodePointer(ctrl, offset uint) (typ, ptr, next uint, err error) {
+	n := (ctrl>>3)&0x3 + 1
+	b, err := d.read(offset, n)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	ptr = uintFromBytes(b)
+	switch n {
+	case 1:
+		ptr |= (ctrl & 0x7) << 8
+	case 2:
+		ptr = ptr | (ctrl&0x7)<<16 + 2048
+	case 3:
+		ptr = ptr | (ctrl&0x7)<<24 + 526336
+	}
+
+	return typePointer, ptr, offset + n, nil
+}
+
+// decodeValue decodes the value of typ and size, which payload is at offset.
+func (d *decoder) decodeValue(typ, size, offset uint, depth int) (v any, next uint, err error) {
+	switch typ {
+	case typeMap:
+		return d.decodeMap(size, offset, depth)
+	case typeArray:
+		return d.decodeArray(size, offset, depth)
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEnd:
+		return nil, 0, fmt.Errorf("unsupported type %d", typ)
+	}
+
+	b, err := d.read(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	next = offset + size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		return b, next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("uint size %d: too large", size)
+		}
+
+		return uint64FromBytes(b), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("int32 size %d: too large", size)
+		}
+
+		// #nosec G115 -- The value is sign-extended from 32 bits on purpose.
+		return int64(int32(uint32(uint64FromBytes(b)))), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double size %d: must be 8", size)
+		}
+
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float size %d: must be 4", size)
+		}
+
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown type %d", typ)
+	}
+}
+
+// decodeMap decodes the map of size entries, which payload is at offset.
+func (d *decoder) decodeMap(size, offset uint, depth int) (v any, next uint, err error) {
+	m := make(map[string]any, min(size, 64))
+	next = offset
+	for range size {
+		var key, val any
+		key, next, err = d.decode(next, depth+1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("map key: %w", err)
+		}
+
+		k, ok := key.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("map key: bad type %T", key)
+		}
+
+		val, next, err = d.decode(next, depth+1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("map value for key %q: %w", k, err)
+		}
+
+		m[k] = val
+	}
+
+	return m, next, nil
+}
+
+// decodeArray decodes the array of size elements, which payload is at offset.
+func (d *decoder) decodeArray(size, offset uint, depth int) (v any, next uint, err error) {
+	a := make([]any, 0, min(size, 64))
+	next = offset
+	for i := range size {
+		var elem any
+		elem, next, err = d.decode(next, depth+1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("array element at index %d: %w", i, err)
+		}
+
+		a = append(a, elem)
+	}
+
+	return a, next, nil
+}
+
+// read returns n bytes of data at offset.
+func (d *decoder) read(offset, n uint) (b []byte, err error) {
+	if offset > uint(len(d.data)) || n > uint(len(d.data))-offset {
+		return nil, errUnexpectedEnd
+	}
+
+	return d.data[offset : offset+n], nil
+}
+
+// uintFromBytes returns the big-endian unsigned integer from b, which must not
+// be longer than 4 bytes.
+func uintFromBytes(b []byte) (u uint) {
+	for _, c := range b {
+		u = u<<8 | uint(c)
+	}
+
+	return u
+}
+
+// uint64FromBytes returns the big-endian unsigned integer from b, which must
+// not be longer than 8 bytes.
+func uint64FromBytes(b []byte) (u uint64) {
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+
+	return u
+}
@@ -0,0 +1,272 @@
+// Package geoip contains the reader of the MaxMind DB files with the countries
+// and the autonomous systems of the IP addresses, such as GeoLite2-Country and
+// GeoLite2-ASN.
+//
+// See https://maxmind.github.io/MaxMind-DB/.
+package geoip
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Match is an address from a response, which belongs to a blocked or a flagged
+// country or autonomous system.
+type Match struct {
+	// Addr is the matched address.
+	Addr netip.Addr `json:"addr"`
+
+	// Country is the ISO 3166-1 alpha-2 code of the country of Addr, if any.
+	Country string `json:"country,omitempty"`
+
+	// ASN is the number of the autonomous system of Addr, if any.
+	ASN uint32 `json:"asn,omitempty"`
+
+	// Blocked is true if the response has been blocked, and false if the
+	// request has only been flagged.
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// Info is the information about an IP address from a database.
+type Info struct {
+	// Country is the uppercase ISO 3166-1 alpha-2 code of the country.  It's
+	// empty if the database doesn't contain countries.
+	Country string
+
+	// ASN is the number of the autonomous system.  It's zero if the database
+	// doesn't contain autonomous systems.
+	ASN uint32
+}
+
+// metadataStart is the marker preceding the metadata of a MaxMind DB.
+const metadataStart = "\xab\xcd\xefMaxMind.com"
+
+// dataSectionSep is the size of the separator between the search tree and the
+// data section.
+const dataSectionSep = 16
+
+// DB is a MaxMind DB read into memory.  It's safe for concurrent use.
+type DB struct {
+	// mu protects infos.
+	mu *sync.Mutex
+
+	// infos are the decoded records by their offsets in the data section.
+	// The records are shared by many networks, so caching them is cheap.
+	infos map[uint]*Info
+
+	// tree is the binary search tree.
+	tree []byte
+
+	// data is the data section.
+	data []byte
+
+	// nodeCount is the number of the nodes in tree.
+	nodeCount uint
+
+	// recordSize is the size of a record of a node in bits.
+	recordSize uint
+
+	// ipv4Start is the node, from which the IPv4 addresses are looked up.
+	ipv4Start uint
+
+	// ipVersion is either 4 or 6.
+	ipVersion uint
+}
+
+// Open reads the MaxMind DB from the file at path.
+func Open(path string) (db *DB, err error) {
+	// #nosec G304 -- Trust the path explicitly given by the user.
+	b, err := os.ReadFile(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return New(b)
+}
+
+// New parses the MaxMind DB from b.  b must not be modified after calling New.
+func New(b []byte) (db *DB, err error) {
+	i := bytes.LastIndex(b, []byte(metadataStart))
+	if i < 0 {
+		return nil, errors.Error("no metadata")
+	}
+
+	meta, _, err := (&decoder{data: b[i+len(metadataStart):]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+
+	db = &DB{
+		mu:    &sync.Mutex{},
+		infos: map[uint]*Info{},
+	}
+
+	err = db.setMetadata(meta)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	// Use uint64 to prevent overflows on 32-bit platforms.
+	treeSize := uint64(db.nodeCount) * uint64(db.recordSize) / 4
+	if treeSize+dataSectionSep > uint64(i) {
+		return nil, fmt.Errorf("search tree size %d: exceeds data size %d", treeSize, i)
+	}
+
+	db.tree = b[:treeSize]
+	db.data = b[treeSize+dataSectionSep : i]
+	db.ipv4Start = db.findIPv4Start()
+
+	return db, nil
+}
+
+// setMetadata validates and sets the properties of db from the decoded
+// metadata.
+func (db *DB) setMetadata(meta any) (err error) {
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return fmt.Errorf("bad type %T", meta)
+	}
+
+	if v, _ := m["binary_format_major_version"].(uint64); v != 2 {
+		return fmt.Errorf("binary_format_major_version: unsupported value %d", v)
+	}
+
+	nodeCount, _ := m["node_count"].(uint64)
+	recordSize, _ := m["record_size"].(uint64)
+	ipVersion, _ := m["ip_version"].(uint64)
+
+	switch {
+	case nodeCount == 0:
+		return fmt.Errorf("node_count: %w", errors.ErrNoValue)
+	case nodeCount > math.MaxUint32:
+		return fmt.Errorf("node_count: too large: %d", nodeCount)
+	case recordSize != 24 && recordSize != 28 && recordSize != 32:
+		return fmt.Errorf("record_size: %w: %d", errors.ErrBadEnumValue, recordSize)
+	case ipVersion != 4 && ipVersion != 6:
+		return fmt.Errorf("ip_version: %w: %d", errors.ErrBadEnumValue, ipVersion)
+	}
+
+	// #nosec G115 -- The values are validated above.
+	db.nodeCount, db.recordSize, db.ipVersion = uint(nodeCount), uint(recordSize), uint(ipVersion)
+
+	return nil
+}
+
+// findIPv4Start returns the node, which corresponds to the IPv4-mapped
+// addresses in an IPv6 database, that is the one after 96 zero bits.
+func (db *DB) findIPv4Start() (node uint) {
+	if db.ipVersion == 4 {
+		return 0
+	}
+
+	for i := 0; i < 96 && node < db.nodeCount; i++ {
+		node = db.record(node, 0)
+	}
+
+	return node
+}
+
+// record returns the left record of node if bit is zero, and the right one
+// otherwise.  node must be less than db.nodeCount.
+func (db *DB) record(node, bit uint) (rec uint) {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := db.tree[node*8+bit*4:]
+
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+	}
+}
+
+// Lookup returns the information about ip.  info is nil if ip isn't found in
+// the database.
+func (db *DB) Lookup(ip netip.Addr) (info *Info, err error) {
+	ip = ip.Unmap()
+
+	node := uint(0)
+	var bits []byte
+	if ip.Is4() {
+		node = db.ipv4Start
+		b := ip.As4()
+		bits = b[:]
+	} else if db.ipVersion == 6 {
+		b := ip.As16()
+		bits = b[:]
+	} else {
+		return nil, nil
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(bits[i/8]>>(7-i%8))&1)
+	}
+
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount+dataSectionSep:
+		return nil, fmt.Errorf("search tree: invalid record %d", node)
+	}
+
+	return db.info(node - db.nodeCount - dataSectionSep)
+}
+
+// info returns the decoded record at offset in the data section.
+func (db *DB) info(offset uint) (info *Info, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if info = db.infos[offset]; info != nil {
+		return info, nil
+	}
+
+	v, _, err := (&decoder{data: db.data}).decode(offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding record at offset %d: %w", offset, err)
+	}
+
+	info = newInfo(v)
+	db.infos[offset] = info
+
+	return info, nil
+}
+
+// newInfo returns the information from the decoded record v in the format of
+// the GeoIP2 and GeoLite2 databases.
+func newInfo(v any) (info *Info) {
+	info = &Info{}
+
+	m, _ := v.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		c, _ := m[key].(map[string]any)
+		if code, _ := c["iso_code"].(string); code != "" {
+			info.Country = strings.ToUpper(code)
+
+			break
+		}
+	}
+
+	if asn, _ := m["autonomous_system_number"].(uint64); asn <= math.MaxUint32 {
+		// #nosec G115 -- The value is validated above.
+		info.ASN = uint32(asn)
+	}
+
+	return info
+}
@@ -0,0 +1,241 @@
+package geoip
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNode is a node of the search tree of a test database.
+type testNode struct {
+	children [2]*testNode
+
+	// data is the offset of the record in the data section for leaves.
+	data uint
+
+	// isLeaf is true if the node is a record.
+	isLeaf bool
+}
+
+// insert adds the network p with the record at offset data to the tree.
+func (n *testNode) insert(p netip.Prefix, data uint) {
+	addr := p.Addr()
+	bits := p.Bits()
+
+	// The IPv4 networks are stored in the IPv4-compatible form, ::a.b.c.d.
+	var b [16]byte
+	if addr.Is4() {
+		bits += 96
+		b4 := addr.As4()
+		copy(b[12:], b4[:])
+	} else {
+		b = addr.As16()
+	}
+
+	for i := range bits {
+		bit := (b[i/8] >> (7 - i%8)) & 1
+		child := n.children[bit]
+		if child == nil {
+			child = &testNode{}
+			n.children[bit] = child
+		}
+
+		if i == bits-1 {
+			child.isLeaf, child.data = true, data
+		}
+
+		n = child
+	}
+}
+
+// newTestDB returns the data of a MaxMind DB with IPv6 search tree of 24-bit
+// records and the given networks and data section.
+func newTestDB(tb testing.TB, nets map[netip.Prefix]uint, data []byte) (b []byte) {
+	tb.Helper()
+
+	root := &testNode{}
+	for p, off := range nets {
+		root.insert(p, off)
+	}
+
+	var nodes []*testNode
+	idx := map[*testNode]uint{}
+	for queue := []*testNode{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		idx[n] = uint(len(nodes))
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil && !c.isLeaf {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	nodeCount := uint(len(nodes))
+	buf := &bytes.Buffer{}
+	for _, n := range nodes {
+		for _, c := range n.children {
+			rec := nodeCount
+			if c != nil && c.isLeaf {
+				rec = nodeCount + dataSectionSep + c.data
+			} else if c != nil {
+				rec = idx[c]
+			}
+
+			buf.Write([]byte{byte(rec >> 16), byte(rec >> 8), byte(rec)})
+		}
+	}
+
+	buf.Write(make([]byte, dataSectionSep))
+	buf.Write(data)
+	buf.WriteString(metadataStart)
+
+	buf.Write(encMap(5))
+	buf.Write(encString("node_count"))
+	buf.Write(encUint(typeUint32, uint64(nodeCount)))
+	buf.Write(encString("record_size"))
+	buf.Write(encUint(typeUint16, 24))
+	buf.Write(encString("ip_version"))
+	buf.Write(encUint(typeUint16, 6))
+	buf.Write(encString("binary_format_major_version"))
+	buf.Write(encUint(typeUint16, 2))
+	buf.Write(encString("build_epoch"))
+	buf.Write(encUint(typeUint64, 1700000000))
+
+	return buf.Bytes()
+}
+
+// encCtrl encodes the control byte of typ and size, which must be less than
+// 29.
+func encCtrl(typ, size uint) (b []byte) {
+	if typ > typeMap {
+		return []byte{byte(size), byte(typ - 7)}
+	}
+
+	return []byte{byte(typ<<5 | size)}
+}
+
+// encString encodes s, which must be shorter than 29 bytes.
+func encString(s string) (b []byte) {
+	return append(encCtrl(typeString, uint(len(s))), s...)
+}
+
+// encMap encodes the control byte of a map with n entries.
+func encMap(n uint) (b []byte) {
+	return encCtrl(typeMap, n)
+}
+
+// encUint encodes u as an unsigned integer of typ.
+func encUint(typ uint, u uint64) (b []byte) {
+	var val []byte
+	for ; u > 0; u >>= 8 {
+		val = append([]byte{byte(u)}, val...)
+	}
+
+	return append(encCtrl(typ, uint(len(val))), val...)
+}
+
+// encPointer encodes the pointer to offset, which must be less than 2048.
+func encPointer(offset uint) (b []byte) {
+	return []byte{byte(typePointer<<5 | offset>>8), byte(offset)}
+}
+
+func TestDB_Lookup(t *testing.T) {
+	data := &bytes.Buffer{}
+
+	// The record with a country and an autonomous system.
+	deOff := uint(data.Len())
+	data.Write(encMap(2))
+	data.Write(encString("country"))
+	data.Write(encMap(1))
+	isoCodeOff := uint(data.Len())
+	data.Write(encString("iso_code"))
+	data.Write(encString("de"))
+	data.Write(encString("autonomous_system_number"))
+	data.Write(encUint(typeUint32, 64500))
+
+	// The record with only the registered country, which uses a pointer to
+	// the key.
+	frOff := uint(data.Len())
+	data.Write(encMap(1))
+	data.Write(encString("registered_country"))
+	data.Write(encMap(1))
+	data.Write(encPointer(isoCodeOff))
+	data.Write(encString("FR"))
+
+	b := newTestDB(t, map[netip.Prefix]uint{
+		netip.MustParsePrefix("192.0.2.0/24"):  deOff,
+		netip.MustParsePrefix("2001:db8::/32"): frOff,
+	}, data.Bytes())
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	err := os.WriteFile(path, b, 0o644)
+	require.NoError(t, err)
+
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		want *Info
+		ip   netip.Addr
+		name string
+	}{{
+		want: &Info{Country: "DE", ASN: 64500},
+		ip:   netip.MustParseAddr("192.0.2.1"),
+		name: "ipv4",
+	}, {
+		want: &Info{Country: "DE", ASN: 64500},
+		ip:   netip.MustParseAddr("::ffff:192.0.2.1"),
+		name: "ipv4_mapped",
+	}, {
+		want: &Info{Country: "FR"},
+		ip:   netip.MustParseAddr("2001:db8::1"),
+		name: "ipv6_pointer",
+	}, {
+		want: nil,
+		ip:   netip.MustParseAddr("198.51.100.1"),
+		name: "not_found",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, lookupErr := db.Lookup(tc.ip)
+			require.NoError(t, lookupErr)
+
+			assert.Equal(t, tc.want, info)
+		})
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		data       []byte
+	}{{
+		name:       "no_metadata",
+		wantErrMsg: "no metadata",
+		data:       []byte("not a database"),
+	}, {
+		name:       "bad_version",
+		wantErrMsg: "metadata: binary_format_major_version: unsupported value 0",
+		data:       append([]byte(metadataStart), encMap(0)...),
+	}, {
+		name:       "truncated",
+		wantErrMsg: "decoding metadata: map key: unexpected end of data",
+		data:       append([]byte(metadataStart), encMap(1)...),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.data)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package filtering
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+)
+
+// defaultRuleHitsLimit is the default maximum number of the rules returned by
+// the HTTP API.
+const defaultRuleHitsLimit = 100
+
+// ruleHitKey is the key of the hit counters of the rules.
+type ruleHitKey struct {
+	text   string
+	listID rulelist.APIID
+}
+
+// hitCount is the hit counter of a rule or a filter list.
+type hitCount struct {
+	lastHit time.Time
+	hits    uint64
+}
+
+// hitCounter counts the matches of the filtering rules and the filter lists
+// since the start or the last reset.
+type hitCounter struct {
+	// mu protects all fields.
+	mu *sync.Mutex
+
+	// rules are the counters of the matched rules.
+	rules map[ruleHitKey]*hitCount
+
+	// lists are the counters of the filter lists, including the built-in
+	// ones.
+	lists map[rulelist.APIID]*hitCount
+
+	// since is the time of the start or the last reset.
+	since time.Time
+}
+
+// newHitCounter returns a new properly initialized *hitCounter.
+func newHitCounter(now time.Time) (c *hitCounter) {
+	return &hitCounter{
+		mu:    &sync.Mutex{},
+		rules: map[ruleHitKey]*hitCount{},
+		lists: map[rulelist.APIID]*hitCount{},
+		since: now,
+	}
+}
+
+// record counts the rules of res and their filter lists.  Each filter list is
+// counted once per result.
+func (c *hitCounter) record(res *Result, now time.Time) {
+	if len(res.Rules) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, r := range res.Rules {
+		incHitCount(c.rules, ruleHitKey{text: r.Text, listID: r.FilterListID}, now)
+
+		if !slices.ContainsFunc(res.Rules[:i], func(prev *ResultRule) (ok bool) {
+			return prev.FilterListID == r.FilterListID
+		}) {
+			incHitCount(c.lists, r.FilterListID, now)
+		}
+	}
+}
+
+// incHitCount increments the counter for key in m.
+func incHitCount[K comparable](m map[K]*hitCount, key K, now time.Time) {
+	hc := m[key]
+	if hc == nil {
+		hc = &hitCount{}
+		m[key] = hc
+	}
+
+	hc.hits++
+	hc.lastHit = now
+}
+
+// listHits returns the number of hits of the filter list with id.
+func (c *hitCounter) listHits(id rulelist.APIID) (hits uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hc := c.lists[id]; hc != nil {
+		return hc.hits
+	}
+
+	return 0
+}
+
+// reset removes all counters.
+func (c *hitCounter) reset(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.rules)
+	clear(c.lists)
+	c.since = now
+}
+
+// ruleHitJSON is the hit counter of a rule for the HTTP API.
+type ruleHitJSON struct {
+	Text     string         `json:"text"`
+	LastHit  string         `json:"last_hit"`
+	FilterID rulelist.APIID `json:"filter_id"`
+	Hits     uint64         `json:"hits"`
+}
+
+// listHitJSON is the hit counter of a filter list for the HTTP API.
+type listHitJSON struct {
+	URL        string         `json:"url"`
+	Name       string         `json:"name"`
+	LastHit    string         `json:"last_hit,omitempty"`
+	ID         rulelist.APIID `json:"id"`
+	Hits       uint64         `json:"hits"`
+	RulesCount uint64         `json:"rules_count"`
+	Enabled    bool           `json:"enabled"`
+	Whitelist  bool           `json:"whitelist"`
+}
+
+// hitsResp is the response of the GET /control/filtering/hits HTTP API.
+type hitsResp struct {
+	Since string `json:"since"`
+
+	// Lists are the configured filter lists, the ones with fewer hits first.
+	Lists []*listHitJSON `json:"lists"`
+
+	// Rules are the most matched rules of all lists, including the built-in
+	// ones.
+	Rules []*ruleHitJSON `json:"rules"`
+
+	// ZeroHitLists are the IDs of the enabled filter lists, which haven't
+	// matched any requests.
+	ZeroHitLists []rulelist.APIID `json:"zero_hit_lists"`
+}
+
+// handleFilteringHits is the handler for the GET /control/filtering/hits HTTP
+// API.
+func (d *DNSFilter) handleFilteringHits(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit := defaultRuleHitsLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			aghhttp.ErrorAndLog(
+				ctx,
+				d.logger,
+				r,
+				w,
+				http.StatusBadRequest,
+				"bad limit query parameter: %q",
+				s,
+			)
+
+			return
+		}
+	}
+
+	resp := &hitsResp{
+		Lists:        []*listHitJSON{},
+		ZeroHitLists: []rulelist.APIID{},
+	}
+
+	func() {
+		d.conf.filtersMu.RLock()
+		defer d.conf.filtersMu.RUnlock()
+
+		for _, f := range d.conf.Filters {
+			resp.Lists = append(resp.Lists, listHitToJSON(f, false))
+		}
+
+		for _, f := range d.conf.WhitelistFilters {
+			resp.Lists = append(resp.Lists, listHitToJSON(f, true))
+		}
+	}()
+
+	func() {
+		d.hits.mu.Lock()
+		defer d.hits.mu.Unlock()
+
+		resp.Since = d.hits.since.Format(time.RFC3339)
+		for _, l := range resp.Lists {
+			if hc := d.hits.lists[l.ID]; hc != nil {
+				l.Hits = hc.hits
+				l.LastHit = hc.lastHit.Format(time.RFC3339)
+			}
+		}
+
+		resp.Rules = make([]*ruleHitJSON, 0, len(d.hits.rules))
+		for k, hc := range d.hits.rules {
+			resp.Rules = append(resp.Rules, &ruleHitJSON{
+				Text:     k.text,
+				LastHit:  hc.lastHit.Format(time.RFC3339),
+				FilterID: k.listID,
+				Hits:     hc.hits,
+			})
+		}
+	}()
+
+	slices.SortStableFunc(resp.Lists, func(a, b *listHitJSON) (res int) {
+		return cmp.Compare(a.Hits, b.Hits)
+	})
+
+	for _, l := range resp.Lists {
+		if l.Enabled && l.Hits == 0 {
+			resp.ZeroHitLists = append(resp.ZeroHitLists, l.ID)
+		}
+	}
+
+	slices.SortFunc(resp.Rules, func(a, b *ruleHitJSON) (res int) {
+		return cmp.Or(
+			cmp.Compare(b.Hits, a.Hits),
+			cmp.Compare(a.FilterID, b.FilterID),
+			cmp.Compare(a.Text, b.Text),
+		)
+	})
+
+	resp.Rules = resp.Rules[:min(limit, len(resp.Rules))]
+
+	aghhttp.WriteJSONResponseOK(ctx, d.logger, w, r, resp)
+}
+
+// listHitToJSON returns the hit counter of f for the HTTP API without the
+// hits.
+func listHitToJSON(f FilterYAML, whitelist bool) (l *listHitJSON) {
+	return &listHitJSON{
+		URL:  f.URL,
+		Name: f.Name,
+		// #nosec G115 -- The overflow is required for backwards compatibility.
+		ID: rulelist.APIID(f.ID),
+		// #nosec G115 -- The number of rules must not be negative.
+		RulesCount: uint64(f.RulesCount),
+		Enabled:    f.Enabled,
+		Whitelist:  whitelist,
+	}
+}
+
+// handleFilteringHitsReset is the handler for the POST
+// /control/filtering/hits/reset HTTP API.
+func (d *DNSFilter) handleFilteringHitsReset(w http.ResponseWriter, r *http.Request) {
+	d.hits.reset(time.Now())
+
+	aghhttp.OK(r.Context(), d.logger, w)
+}
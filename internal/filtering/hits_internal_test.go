@@ -0,0 +1,90 @@
+package filtering
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_handleFilteringHits(t *testing.T) {
+	const (
+		usedID   = 1
+		unusedID = 2
+	)
+
+	d, setts := newForTest(t, &Config{
+		Filters: []FilterYAML{{
+			Enabled: true,
+			URL:     "https://filters.example/used.txt",
+			Name:    "used",
+			Filter:  Filter{ID: usedID},
+		}, {
+			Enabled: true,
+			URL:     "https://filters.example/unused.txt",
+			Name:    "unused",
+			Filter:  Filter{ID: unusedID},
+		}},
+	}, []Filter{{
+		ID:   usedID,
+		Data: []byte("||ads.example^\n||tracker.example^\n"),
+	}, {
+		ID:   unusedID,
+		Data: []byte("||never.example^\n"),
+	}})
+	t.Cleanup(d.Close)
+
+	for _, host := range []string{"ads.example", "a.ads.example", "tracker.example", "ok.example"} {
+		_, err := d.CheckHost(host, dns.TypeA, setts)
+		require.NoError(t, err)
+	}
+
+	// The checks of the HTTP API aren't counted.
+	r := httptest.NewRequest(http.MethodGet, "/control/filtering/check_host?name=ads.example", nil)
+	d.handleCheckHost(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest(http.MethodGet, "/control/filtering/hits?limit=1", nil)
+	w := httptest.NewRecorder()
+	d.handleFilteringHits(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	resp := &hitsResp{}
+	err := json.NewDecoder(w.Body).Decode(resp)
+	require.NoError(t, err)
+
+	require.Len(t, resp.Lists, 2)
+
+	assert.Equal(t, rulelist.APIID(unusedID), resp.Lists[0].ID)
+	assert.Zero(t, resp.Lists[0].Hits)
+	assert.Empty(t, resp.Lists[0].LastHit)
+
+	assert.Equal(t, rulelist.APIID(usedID), resp.Lists[1].ID)
+	assert.Equal(t, uint64(3), resp.Lists[1].Hits)
+	assert.NotEmpty(t, resp.Lists[1].LastHit)
+
+	assert.Equal(t, []rulelist.APIID{unusedID}, resp.ZeroHitLists)
+
+	require.Len(t, resp.Rules, 1)
+
+	assert.Equal(t, "||ads.example^", resp.Rules[0].Text)
+	assert.Equal(t, rulelist.APIID(usedID), resp.Rules[0].FilterID)
+	assert.Equal(t, uint64(2), resp.Rules[0].Hits)
+
+	r = httptest.NewRequest(http.MethodPost, "/control/filtering/hits/reset", nil)
+	d.handleFilteringHitsReset(httptest.NewRecorder(), r)
+
+	assert.Zero(t, d.hits.listHits(usedID))
+
+	t.Run("bad_limit", func(t *testing.T) {
+		r = httptest.NewRequest(http.MethodGet, "/control/filtering/hits?limit=-1", nil)
+		w = httptest.NewRecorder()
+		d.handleFilteringHits(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,244 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// HomographAction is the action taken for the requests for the
+// internationalized domain names confusable with the protected ones.
+type HomographAction string
+
+// Valid homograph detection actions.
+const (
+	// HomographActionBlock blocks the requests and logs them with the warning
+	// level.
+	HomographActionBlock HomographAction = "block"
+
+	// HomographActionNotify logs the requests with the warning level.
+	HomographActionNotify HomographAction = "notify"
+)
+
+// HomographConfig is the configuration of detecting the internationalized
+// domain names, which are visually confusable with the protected brands or
+// mix the letters of different scripts.
+type HomographConfig struct {
+	// brands maps the registrable labels of the normalized Brands, such as
+	// "paypal", to the brands themselves.
+	brands map[string]string
+
+	// Brands are the protected domain names, such as "paypal.com".  The
+	// internationalized labels, which look like the registrable label of a
+	// brand, are detected everywhere except the brand itself.
+	Brands []string `yaml:"brands"`
+
+	// Action is the action for the requests for the detected domain names.
+	Action HomographAction `yaml:"action"`
+
+	// MixedScripts defines if the internationalized labels mixing the Latin,
+	// Cyrillic, Greek, and Armenian letters are detected as well.
+	MixedScripts bool `yaml:"mixed_scripts"`
+
+	// Enabled defines if the internationalized domain names are checked.
+	Enabled bool `yaml:"enabled"`
+}
+
+// init normalizes and validates the brands and the action and builds the index
+// of the brands.  c must not be nil.
+func (c *HomographConfig) init() (err error) {
+	var errs []error
+
+	switch c.Action {
+	case HomographActionBlock, HomographActionNotify:
+		// Go on.
+	default:
+		errs = append(errs, fmt.Errorf("action: %w: %q", errors.ErrBadEnumValue, c.Action))
+	}
+
+	c.brands = make(map[string]string, len(c.Brands))
+	for i, b := range c.Brands {
+		b = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(b)), ".")
+		if err = netutil.ValidateDomainName(b); err != nil {
+			errs = append(errs, fmt.Errorf("brands: at index %d: %w", i, err))
+
+			continue
+		}
+
+		etldOne, etldErr := publicsuffix.EffectiveTLDPlusOne(b)
+		if etldErr != nil {
+			errs = append(errs, fmt.Errorf("brands: at index %d: %w", i, etldErr))
+
+			continue
+		}
+
+		label, _, _ := strings.Cut(etldOne, ".")
+		c.brands[label] = etldOne
+	}
+
+	return errors.Join(errs...)
+}
+
+// homographConfusables maps the letters of the Cyrillic, Greek, and Armenian
+// scripts, as well as the Latin letters with the diacritics, to the ASCII
+// letters they're easily confused with.
+var homographConfusables = map[rune]rune{
+	// Cyrillic.
+	'а': 'a', 'в': 'b', 'г': 'r', 'е': 'e', 'ё': 'e', 'і': 'i', 'ї': 'i',
+	'ј': 'j', 'к': 'k', 'о': 'o', 'п': 'n', 'р': 'p', 'с': 'c', 'у': 'y',
+	'х': 'x', 'ѕ': 's', 'ь': 'b', 'һ': 'h', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'ӏ': 'l',
+
+	// Greek.
+	'α': 'a', 'β': 'b', 'γ': 'y', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w', 'ϲ': 'c',
+	'ϳ': 'j',
+
+	// Armenian.
+	'հ': 'h', 'ո': 'n', 'ս': 'u', 'օ': 'o',
+
+	// Latin.
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a',
+	'ă': 'a', 'ą': 'a', 'ɑ': 'a', 'ç': 'c', 'ć': 'c', 'č': 'c', 'ď': 'd',
+	'đ': 'd', 'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ė': 'e',
+	'ę': 'e', 'ě': 'e', 'ğ': 'g', 'ģ': 'g', 'ɡ': 'g', 'ì': 'i', 'í': 'i',
+	'î': 'i', 'ï': 'i', 'ī': 'i', 'į': 'i', 'ı': 'i', 'ɩ': 'i', 'ķ': 'k',
+	'ĺ': 'l', 'ļ': 'l', 'ľ': 'l', 'ł': 'l', 'ñ': 'n', 'ń': 'n', 'ņ': 'n',
+	'ň': 'n', 'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o',
+	'ō': 'o', 'ő': 'o', 'ŕ': 'r', 'ř': 'r', 'ś': 's', 'ş': 's', 'š': 's',
+	'ţ': 't', 'ť': 't', 'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u',
+	'ů': 'u', 'ű': 'u', 'ų': 'u', 'ý': 'y', 'ÿ': 'y', 'ź': 'z', 'ż': 'z',
+	'ž': 'z',
+}
+
+// homographSkeleton returns label with the confusable letters replaced with
+// their ASCII counterparts.
+func homographSkeleton(label string) (skel string) {
+	return strings.Map(func(r rune) (mapped rune) {
+		if c, ok := homographConfusables[r]; ok {
+			return c
+		}
+
+		return r
+	}, label)
+}
+
+// homographScripts are the scripts, the letters of which are confusable with
+// each other.
+var homographScripts = []*unicode.RangeTable{
+	unicode.Latin,
+	unicode.Cyrillic,
+	unicode.Greek,
+	unicode.Armenian,
+}
+
+// isMixedScript returns true if label contains the letters of more than one of
+// [homographScripts].
+func isMixedScript(label string) (ok bool) {
+	var found *unicode.RangeTable
+	for _, r := range label {
+		for _, s := range homographScripts {
+			if !unicode.Is(s, r) {
+				continue
+			}
+
+			if found != nil && found != s {
+				return true
+			}
+
+			found = s
+		}
+	}
+
+	return false
+}
+
+// match returns the description of the detected homograph in host, if any.
+// host must be lowercased.  c must be initialized.
+func (c *HomographConfig) match(host string) (desc string) {
+	if !strings.Contains(host, "xn--") {
+		return ""
+	}
+
+	etldOne, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+
+	suffix := strings.TrimPrefix(etldOne[strings.IndexByte(etldOne, '.'):], ".")
+	rest := strings.TrimSuffix(strings.TrimSuffix(host, suffix), ".")
+	for _, l := range strings.Split(rest, ".") {
+		if !strings.HasPrefix(l, "xn--") {
+			continue
+		}
+
+		u, uErr := idna.Punycode.ToUnicode(l)
+		if uErr != nil {
+			continue
+		}
+
+		if brand, ok := c.brands[homographSkeleton(u)]; ok && etldOne != brand {
+			return fmt.Sprintf("homograph of %s: %s", brand, u)
+		}
+
+		if c.MixedScripts && isMixedScript(u) {
+			return "mixed-script label: " + u
+		}
+	}
+
+	return ""
+}
+
+// checkHomographs is a hostChecker that detects the internationalized domain
+// names confusable with the protected brands.
+func (d *DNSFilter) checkHomographs(
+	host string,
+	_ uint16,
+	setts *Settings,
+) (res Result, err error) {
+	if !setts.ProtectionEnabled {
+		return Result{}, nil
+	}
+
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	c := d.conf.Homographs
+	if c == nil || !c.Enabled {
+		return Result{}, nil
+	}
+
+	desc := c.match(strings.ToLower(host))
+	if desc == "" {
+		return Result{}, nil
+	}
+
+	d.logger.WarnContext(
+		context.TODO(),
+		"homograph domain name",
+		"host", host,
+		"match", desc,
+		"client", setts.ClientName,
+		"action", c.Action,
+	)
+
+	if c.Action != HomographActionBlock {
+		return Result{}, nil
+	}
+
+	return Result{
+		Rules: []*ResultRule{{
+			Text:         desc,
+			FilterListID: rulelist.APIIDHomograph,
+		}},
+		Reason:     FilteredBlockList,
+		IsFiltered: true,
+	}, nil
+}
@@ -0,0 +1,107 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/idna"
+)
+
+func TestHomographConfig_match(t *testing.T) {
+	c := &HomographConfig{
+		Brands:       []string{"PayPal.com.", "www.example.co.uk"},
+		Action:       HomographActionBlock,
+		MixedScripts: true,
+		Enabled:      true,
+	}
+
+	err := c.init()
+	require.NoError(t, err)
+
+	toASCII := func(s string) (ascii string) {
+		ascii, err = idna.Punycode.ToASCII(s)
+		require.NoError(t, err)
+
+		return ascii
+	}
+
+	testCases := []struct {
+		name     string
+		host     string
+		wantDesc string
+	}{{
+		name:     "ascii",
+		host:     "paypal.net",
+		wantDesc: "",
+	}, {
+		// The first "а" is Cyrillic.
+		name:     "cyrillic_brand",
+		host:     toASCII("pаypal.com"),
+		wantDesc: "homograph of paypal.com: pаypal",
+	}, {
+		name:     "diacritics_subdomain",
+		host:     toASCII("login.exämple.evil.test"),
+		wantDesc: "homograph of example.co.uk: exämple",
+	}, {
+		name:     "mixed_scripts",
+		host:     toASCII("gооgle.test"),
+		wantDesc: "mixed-script label: gооgle",
+	}, {
+		name:     "single_script",
+		host:     toASCII("пример.рф"),
+		wantDesc: "",
+	}, {
+		name:     "idn_tld",
+		host:     toASCII("paypal.рф"),
+		wantDesc: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantDesc, c.match(tc.host))
+		})
+	}
+}
+
+func TestHomographConfig_init_errors(t *testing.T) {
+	c := &HomographConfig{
+		Brands: []string{"com", "bad..domain"},
+		Action: "bad",
+	}
+
+	testutil.AssertErrorMsg(
+		t,
+		`action: bad enum value: "bad"`+"\n"+
+			`brands: at index 0: publicsuffix: cannot derive eTLD+1 for domain "com"`+"\n"+
+			`brands: at index 1: bad domain name "bad..domain": `+
+			`bad domain name label "": domain name label is empty`,
+		c.init(),
+	)
+}
+
+func TestDNSFilter_CheckHost_homographs(t *testing.T) {
+	d, setts := newForTest(t, &Config{
+		Homographs: &HomographConfig{
+			Brands:  []string{"paypal.com"},
+			Action:  HomographActionBlock,
+			Enabled: true,
+		},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	host, err := idna.Punycode.ToASCII("pаypal.com")
+	require.NoError(t, err)
+
+	res, err := d.CheckHost(host, dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+
+	require.Len(t, res.Rules, 1)
+
+	assert.Equal(t, rulelist.APIIDHomograph, res.Rules[0].FilterListID)
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil/urlutil"
@@ -406,10 +407,26 @@ type filterJSON struct {
 	Name        string `json:"name"`
 	LastUpdated string `json:"last_updated,omitempty"`
 
+	// Schedule is the weekly schedule, during which the filter is applied.  It's
+	// nil if the filter is always applied.
+	Schedule *schedule.Weekly `json:"schedule,omitempty"`
+
+	// UpdateCron is the cron expression defining when the filter is updated.
+	UpdateCron string `json:"update_cron,omitempty"`
+
+	// UpdateInterval is the interval between the updates of the filter.  It's
+	// empty if the global one is used.
+	UpdateInterval string `json:"update_interval,omitempty"`
+
 	ID rulelist.APIID `json:"id"`
 
 	RulesCount uint64 `json:"rules_count"`
-	Enabled    bool   `json:"enabled"`
+
+	// Hits is the number of the requests matched by the filter since the
+	// start or the last reset of the counters.
+	Hits uint64 `json:"hits"`
+
+	Enabled bool `json:"enabled"`
 }
 
 type filteringConfig struct {
@@ -418,17 +435,26 @@ type filteringConfig struct {
 	UserRules        []string     `json:"user_rules"`
 	Interval         uint32       `json:"interval"` // in hours
 	Enabled          bool         `json:"enabled"`
+
+	// UserRulesExpirations are the user rules with the expires modifier.
+	UserRulesExpirations []*ruleExpiryJSON `json:"user_rules_expirations"`
 }
 
 func filterToJSON(f FilterYAML) filterJSON {
 	fj := filterJSON{
 		// #nosec G115 -- The overflow is required for backwards compatibility.
-		ID:      rulelist.APIID(f.ID),
-		Enabled: f.Enabled,
-		URL:     f.URL,
-		Name:    f.Name,
+		ID:       rulelist.APIID(f.ID),
+		Enabled:  f.Enabled,
+		URL:      f.URL,
+		Name:     f.Name,
+		Schedule: f.Schedule,
 		// #nosec G115 -- The number of rules must not be negative.
 		RulesCount: uint64(f.RulesCount),
+		UpdateCron: f.UpdateCron,
+	}
+
+	if f.UpdateInterval > 0 {
+		fj.UpdateInterval = f.UpdateInterval.String()
 	}
 
 	if !f.LastUpdated.IsZero() {
@@ -446,13 +472,16 @@ func (d *DNSFilter) handleFilteringStatus(w http.ResponseWriter, r *http.Request
 	resp.Interval = d.conf.FiltersUpdateIntervalHours
 	for _, f := range d.conf.Filters {
 		fj := filterToJSON(f)
+		fj.Hits = d.hits.listHits(fj.ID)
 		resp.Filters = append(resp.Filters, fj)
 	}
 	for _, f := range d.conf.WhitelistFilters {
 		fj := filterToJSON(f)
+		fj.Hits = d.hits.listHits(fj.ID)
 		resp.WhitelistFilters = append(resp.WhitelistFilters, fj)
 	}
 	resp.UserRules = d.conf.UserRules
+	resp.UserRulesExpirations = userRulesExpirations(d.conf.UserRules)
 	d.conf.filtersMu.RUnlock()
 
 	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
@@ -570,7 +599,7 @@ func (d *DNSFilter) handleCheckHost(w http.ResponseWriter, r *http.Request) {
 		d.ApplyAdditionalFiltering(netip.Addr{}, cli, setts)
 	}
 
-	result, err := d.CheckHost(host, qType, setts)
+	result, err := d.checkHost(host, qType, setts, nil)
 	if err != nil {
 		aghhttp.ErrorAndLog(
 			ctx,
@@ -744,6 +773,19 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 
 	registerHTTP(http.MethodGet, "/control/blocked_services/get", d.handleBlockedServicesGet)
 	registerHTTP(http.MethodPut, "/control/blocked_services/update", d.handleBlockedServicesUpdate)
+	registerHTTP(
+		http.MethodGet,
+		"/control/blocked_services/custom/get",
+		d.handleCustomBlockedServicesGet,
+	)
+	registerHTTP(
+		http.MethodPut,
+		"/control/blocked_services/custom/update",
+		d.handleCustomBlockedServicesUpdate,
+	)
+
+	registerHTTP(http.MethodGet, "/control/blocked_tlds/get", d.handleBlockedTLDsGet)
+	registerHTTP(http.MethodPut, "/control/blocked_tlds/update", d.handleBlockedTLDsUpdate)
 
 	registerHTTP(http.MethodGet, "/control/filtering/status", d.handleFilteringStatus)
 	registerHTTP(http.MethodPost, "/control/filtering/config", d.handleFilteringConfig)
@@ -752,7 +794,16 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodPost, "/control/filtering/set_url", d.handleFilteringSetURL)
 	registerHTTP(http.MethodPost, "/control/filtering/refresh", d.handleFilteringRefresh)
 	registerHTTP(http.MethodPost, "/control/filtering/set_rules", d.handleFilteringSetRules)
+	registerHTTP(
+		http.MethodPost,
+		"/control/filtering/user_rules/replace",
+		d.handleUserRulesReplace,
+	)
+	registerHTTP(http.MethodPost, "/control/filtering/user_rules/patch", d.handleUserRulesPatch)
 	registerHTTP(http.MethodGet, "/control/filtering/check_host", d.handleCheckHost)
+	registerHTTP(http.MethodGet, "/control/filtering/hits", d.handleFilteringHits)
+	registerHTTP(http.MethodPost, "/control/filtering/hits/reset", d.handleFilteringHitsReset)
+	registerHTTP(http.MethodGet, "/control/filtering/changes", d.handleFilteringChanges)
 }
 
 // ValidateUpdateIvl returns false if i is not a valid filters update interval.
@@ -0,0 +1,338 @@
+package filtering
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// DefaultNewDomainsWindow is the default period since the first
+	// observation of a domain, during which it's considered new.
+	DefaultNewDomainsWindow = 30 * timeutil.Day
+
+	// DefaultNewDomainsLearningPeriod is the default period since the creation
+	// of the database of the observed domains, during which the domains are
+	// only learned.
+	DefaultNewDomainsLearningPeriod = 7 * timeutil.Day
+
+	// observedDomainsSaveInterval is the interval between the saves of the
+	// changed database of the observed domains.
+	observedDomainsSaveInterval = 5 * time.Minute
+
+	// observedDomainsFileName is the name of the file with the database of the
+	// observed domains in the data directory.
+	observedDomainsFileName = "observed_domains.txt"
+
+	// observedDomainsHeader is the prefix of the first line of the file with
+	// the database of the observed domains followed by its creation time.
+	observedDomainsHeader = "# since "
+)
+
+// NewDomainsAction is the action taken for the requests for the newly observed
+// domains.
+type NewDomainsAction string
+
+// Valid newly-observed domains actions.
+const (
+	// NewDomainsActionBlock blocks the requests.
+	NewDomainsActionBlock NewDomainsAction = "block"
+
+	// NewDomainsActionAlert only logs the requests.
+	NewDomainsActionAlert NewDomainsAction = "alert"
+)
+
+// NewDomainsConfig is the configuration of blocking the requests for the newly
+// observed domains.  The domains are learned locally, by their registrable
+// parts, such as "example.co.uk".
+type NewDomainsConfig struct {
+	// Action is the action for the requests for the new domains.
+	Action NewDomainsAction `yaml:"action"`
+
+	// Window is the period since the first observation of a domain, during
+	// which it's considered new.  If it's zero, [DefaultNewDomainsWindow] is
+	// used.
+	Window timeutil.Duration `yaml:"window"`
+
+	// LearningPeriod is the period since the first start, during which the
+	// domains are only learned, so that all domains aren't considered new.  If
+	// it's zero, [DefaultNewDomainsLearningPeriod] is used.
+	LearningPeriod timeutil.Duration `yaml:"learning_period"`
+
+	// Enabled defines if the new domains are checked.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if c is invalid.  c may be nil.
+func (c *NewDomainsConfig) validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	switch c.Action {
+	case NewDomainsActionBlock, NewDomainsActionAlert:
+		// Go on.
+	default:
+		return fmt.Errorf("action: %w: %q", errors.ErrBadEnumValue, c.Action)
+	}
+
+	switch {
+	case c.Window < 0:
+		return fmt.Errorf("window: %w", errors.ErrNegative)
+	case c.LearningPeriod < 0:
+		return fmt.Errorf("learning_period: %w", errors.ErrNegative)
+	default:
+		return nil
+	}
+}
+
+// window returns the period, during which a domain is considered new.
+func (c *NewDomainsConfig) window() (ivl time.Duration) {
+	if c.Window == 0 {
+		return DefaultNewDomainsWindow
+	}
+
+	return time.Duration(c.Window)
+}
+
+// learningPeriod returns the period, during which the domains are only
+// learned.
+func (c *NewDomainsConfig) learningPeriod() (ivl time.Duration) {
+	if c.LearningPeriod == 0 {
+		return DefaultNewDomainsLearningPeriod
+	}
+
+	return time.Duration(c.LearningPeriod)
+}
+
+// observedDomains is the database of the times of the first observations of
+// the domains.  It's persisted in a text file, each line of which contains a
+// domain and the Unix time of its first observation.
+type observedDomains struct {
+	// mu protects firstSeen and dirty.
+	mu *sync.Mutex
+
+	// firstSeen maps the registrable domains to the Unix times of their first
+	// observations.
+	firstSeen map[string]int64
+
+	// since is the creation time of the database.
+	since time.Time
+
+	// path is the path to the file of the database.
+	path string
+
+	// dirty is true if the database has been changed since the last save.
+	dirty bool
+}
+
+// newObservedDomains loads the database of the observed domains from the file
+// at path.  If there is no such file, the database is created at now.
+func newObservedDomains(path string, now time.Time) (od *observedDomains, err error) {
+	od = &observedDomains{
+		mu:        &sync.Mutex{},
+		firstSeen: map[string]int64{},
+		since:     now,
+		path:      path,
+		dirty:     true,
+	}
+
+	// #nosec G304 -- The path is computed from the data directory.
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return od, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	s := bufio.NewScanner(f)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		err = od.parseLine(s.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	od.dirty = false
+
+	return od, nil
+}
+
+// parseLine parses a line of the file of the database into od.
+func (od *observedDomains) parseLine(line string) (err error) {
+	if sinceStr, ok := strings.CutPrefix(line, observedDomainsHeader); ok {
+		var since int64
+		since, err = strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("creation time: %w", err)
+		}
+
+		od.since = time.Unix(since, 0)
+
+		return nil
+	}
+
+	domain, tsStr, ok := strings.Cut(line, " ")
+	if !ok {
+		return errors.Error("no time")
+	}
+
+	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("time: %w", err)
+	}
+
+	od.firstSeen[domain] = ts
+
+	return nil
+}
+
+// observe records the observation of domain at now, if it's the first one, and
+// returns the time of the first observation.
+func (od *observedDomains) observe(domain string, now time.Time) (first time.Time) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	ts, ok := od.firstSeen[domain]
+	if !ok {
+		ts = now.Unix()
+		od.firstSeen[domain] = ts
+		od.dirty = true
+	}
+
+	return time.Unix(ts, 0)
+}
+
+// save writes the database into its file, if it has been changed.
+func (od *observedDomains) save() (err error) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	if !od.dirty {
+		return nil
+	}
+
+	tmpFile, err := aghrenameio.NewPendingFile(od.path, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer func() { err = aghrenameio.WithDeferredCleanup(err, tmpFile) }()
+
+	w := bufio.NewWriter(tmpFile)
+	_, err = fmt.Fprintf(w, "%s%d\n", observedDomainsHeader, od.since.Unix())
+	if err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	for domain, ts := range od.firstSeen {
+		_, err = fmt.Fprintf(w, "%s %d\n", domain, ts)
+		if err != nil {
+			return fmt.Errorf("writing: %w", err)
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return fmt.Errorf("flushing: %w", err)
+	}
+
+	od.dirty = false
+
+	return nil
+}
+
+// checkNewDomains is a hostChecker that learns the registrable domains of the
+// hosts and blocks the ones observed for the first time recently.
+func (d *DNSFilter) checkNewDomains(
+	host string,
+	_ uint16,
+	setts *Settings,
+) (res Result, err error) {
+	od := d.observedDomains
+	if !setts.ProtectionEnabled || od == nil {
+		return Result{}, nil
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// The host is a public suffix itself or isn't a valid domain name.
+		return Result{}, nil
+	}
+
+	conf := d.conf.NewDomains
+	now := time.Now()
+	first := od.observe(domain, now)
+	if now.Sub(od.since) < conf.learningPeriod() || now.Sub(first) >= conf.window() {
+		return Result{}, nil
+	}
+
+	d.logger.WarnContext(
+		context.TODO(),
+		"newly observed domain",
+		"host", host,
+		"domain", domain,
+		"client", setts.ClientName,
+		"first_seen", first,
+		"action", conf.Action,
+	)
+
+	if conf.Action != NewDomainsActionBlock {
+		return Result{}, nil
+	}
+
+	return Result{
+		Rules: []*ResultRule{{
+			Text:         "newly observed domain: " + domain,
+			FilterListID: rulelist.APIIDNewDomains,
+		}},
+		Reason:     FilteredBlockList,
+		IsFiltered: true,
+	}, nil
+}
+
+// observedDomainsLoop saves the changed database of the observed domains
+// periodically until done is closed.  It is intended to be used as a
+// goroutine.
+func (d *DNSFilter) observedDomainsLoop(ctx context.Context, done <-chan struct{}) {
+	defer slogutil.RecoverAndLog(ctx, d.logger)
+
+	t := time.NewTicker(observedDomainsSaveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			d.saveObservedDomains(ctx)
+		case <-done:
+			return
+		}
+	}
+}
+
+// saveObservedDomains saves the database of the observed domains and logs the
+// errors.
+func (d *DNSFilter) saveObservedDomains(ctx context.Context) {
+	err := d.observedDomains.save()
+	if err != nil {
+		d.logger.ErrorContext(ctx, "saving observed domains", slogutil.KeyError, err)
+	}
+}
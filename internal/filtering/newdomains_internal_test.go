@@ -0,0 +1,125 @@
+package filtering
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_CheckHost_newDomains(t *testing.T) {
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, observedDomainsFileName)
+
+	old := time.Now().Add(-60 * timeutil.Day).Unix()
+	data := fmt.Sprintf("%s%d\nold.example %d\n", observedDomainsHeader, old, old)
+	err := os.WriteFile(path, []byte(data), 0o644)
+	require.NoError(t, err)
+
+	d, setts := newForTest(t, &Config{
+		DataDir: dataDir,
+		NewDomains: &NewDomainsConfig{
+			Action:  NewDomainsActionBlock,
+			Enabled: true,
+		},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	t.Run("new", func(t *testing.T) {
+		res, checkErr := d.CheckHost("www.new.example", dns.TypeA, setts)
+		require.NoError(t, checkErr)
+
+		assert.True(t, res.IsFiltered)
+		assert.Equal(t, FilteredBlockList, res.Reason)
+
+		require.Len(t, res.Rules, 1)
+
+		assert.Equal(t, rulelist.APIIDNewDomains, res.Rules[0].FilterListID)
+		assert.Equal(t, "newly observed domain: new.example", res.Rules[0].Text)
+	})
+
+	t.Run("old", func(t *testing.T) {
+		res, checkErr := d.CheckHost("www.old.example", dns.TypeA, setts)
+		require.NoError(t, checkErr)
+
+		assert.False(t, res.IsFiltered)
+	})
+
+	t.Run("protection_disabled", func(t *testing.T) {
+		s := *setts
+		s.ProtectionEnabled = false
+
+		res, checkErr := d.CheckHost("other.example", dns.TypeA, &s)
+		require.NoError(t, checkErr)
+
+		assert.False(t, res.IsFiltered)
+	})
+
+	err = d.observedDomains.save()
+	require.NoError(t, err)
+
+	od, err := newObservedDomains(path, time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, d.observedDomains.firstSeen, od.firstSeen)
+	assert.Equal(t, old, od.since.Unix())
+}
+
+func TestDNSFilter_CheckHost_newDomainsLearning(t *testing.T) {
+	d, setts := newForTest(t, &Config{
+		DataDir: t.TempDir(),
+		NewDomains: &NewDomainsConfig{
+			Action:  NewDomainsActionBlock,
+			Enabled: true,
+		},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	res, err := d.CheckHost("new.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.False(t, res.IsFiltered)
+	assert.Contains(t, d.observedDomains.firstSeen, "new.example")
+}
+
+func TestNewDomainsConfig_validate(t *testing.T) {
+	testCases := []struct {
+		conf       *NewDomainsConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf:       &NewDomainsConfig{Action: "bad", Enabled: false},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf:       &NewDomainsConfig{Action: "bad", Enabled: true},
+		name:       "bad_action",
+		wantErrMsg: `action: bad enum value: "bad"`,
+	}, {
+		conf: &NewDomainsConfig{
+			Action:  NewDomainsActionAlert,
+			Window:  -1,
+			Enabled: true,
+		},
+		name:       "negative_window",
+		wantErrMsg: "window: negative value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"net/netip"
 	"slices"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/geoip"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/threatfeed"
 	"github.com/AdguardTeam/urlfilter/rules"
 )
 
@@ -26,6 +28,15 @@ type Result struct {
 	// Reason is set to FilteredBlockedService.
 	ServiceName string `json:",omitempty"`
 
+	// Threat is the indicator of compromise of a threat-intelligence feed.  It
+	// is nil unless the request is blocked by a threat feed.
+	Threat *threatfeed.Indicator `json:",omitempty"`
+
+	// Geo is the address from the response, which belongs to a country or an
+	// autonomous system from the geo-blocking rules.  It is nil unless the
+	// response is blocked or flagged by them.
+	Geo *geoip.Match `json:",omitempty"`
+
 	// IPList is the lookup rewrite result.  It is empty unless Reason is set to
 	// Rewritten.
 	IPList []netip.Addr `json:",omitempty"`
@@ -33,9 +44,23 @@ type Result struct {
 	// Rules are applied rules.  If Rules are not empty, each rule is not nil.
 	Rules []*ResultRule `json:",omitempty"`
 
+	// Trace are the steps of the decision in the order of processing.  The last
+	// step is the one that decided the result, if it's matched.  It is empty
+	// unless [Config.DecisionTrace] is true.
+	Trace []*TraceStep `json:",omitempty"`
+
 	// Reason is the reason for blocking or unblocking the request.
 	Reason Reason `json:",omitempty"`
 
+	// TTL is the TTL of the records of the rewrite result.  It is zero unless
+	// Reason is set to Rewritten and the TTL is set for the rewrites.
+	TTL uint32 `json:",omitempty"`
+
+	// FlattenCNAME is true if the CNAME chain in the response should be
+	// replaced with the final addresses.  It is false unless Reason is set to
+	// Rewritten.
+	FlattenCNAME bool `json:",omitempty"`
+
 	// IsFiltered is true if the request is filtered.
 	//
 	// TODO(d.kolyshev): Get rid of this flag.
@@ -55,6 +80,42 @@ type ResultRule struct {
 	FilterListID rulelist.APIID `json:",omitempty"`
 }
 
+// TraceStep is a step of the filtering decision, such as a consulted filter
+// list checker or a stage of the DNS processing.
+type TraceStep struct {
+	// Name is the name of the step, such as "filtering" or "safe browsing".
+	Name string `json:",omitempty"`
+
+	// Rules are the rules matched at this step, if any.
+	Rules []*ResultRule `json:",omitempty"`
+
+	// Reason is the reason of the result of this step.  It is
+	// [NotFilteredNotFound] if nothing was matched.
+	Reason Reason `json:",omitempty"`
+}
+
+// newTraceStep returns a new trace step with the given name for the result of
+// the step.  res must not be nil.
+func newTraceStep(name string, res *Result) (s *TraceStep) {
+	return &TraceStep{
+		Name:   name,
+		Rules:  res.Rules,
+		Reason: res.Reason,
+	}
+}
+
+// AppendTrace sets the trace of res to the trace of prev followed by the step
+// with the given name, which decided res.  It does nothing if prev is nil or
+// its trace is empty, which means that the decision trace is disabled.  res
+// must not be nil.
+func (res *Result) AppendTrace(prev *Result, name string) {
+	if prev == nil || len(prev.Trace) == 0 {
+		return
+	}
+
+	res.Trace = append(slices.Clip(prev.Trace), newTraceStep(name, res))
+}
+
 // NewResultRule converts an URLFilter rule into a *ResultRule.  nr must not be
 // nil.
 func NewResultRule(r rules.Rule) (rr *ResultRule) {
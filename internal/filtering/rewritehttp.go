@@ -13,9 +13,11 @@ import (
 //
 // TODO(d.kolyshev): Use [rewrite.Item] instead.
 type rewriteEntryJSON struct {
-	Domain  string          `json:"domain"`
-	Answer  string          `json:"answer"`
-	Enabled aghalg.NullBool `json:"enabled"`
+	Domain       string          `json:"domain"`
+	Answer       string          `json:"answer"`
+	Enabled      aghalg.NullBool `json:"enabled"`
+	FlattenCNAME aghalg.NullBool `json:"flatten_cname"`
+	TTL          *uint32         `json:"ttl"`
 }
 
 // rewriteSettings contains DNS rewrite settings.
@@ -36,10 +38,13 @@ func (d *DNSFilter) handleRewriteList(w http.ResponseWriter, r *http.Request) {
 		defer d.confMu.RUnlock()
 
 		for _, ent := range d.conf.Rewrites {
+			ttl := ent.TTL
 			jsonEnt := rewriteEntryJSON{
-				Domain:  ent.Domain,
-				Answer:  ent.Answer,
-				Enabled: aghalg.BoolToNullBool(ent.Enabled),
+				Domain:       ent.Domain,
+				Answer:       ent.Answer,
+				Enabled:      aghalg.BoolToNullBool(ent.Enabled),
+				FlattenCNAME: aghalg.BoolToNullBool(ent.FlattenCNAME),
+				TTL:          &ttl,
 			}
 			arr = append(arr, &jsonEnt)
 		}
@@ -67,15 +72,18 @@ func (d *DNSFilter) handleRewriteAdd(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rw := &LegacyRewrite{
-		Domain:  rwJSON.Domain,
-		Answer:  rwJSON.Answer,
-		Enabled: enabled,
+		Domain:       rwJSON.Domain,
+		Answer:       rwJSON.Answer,
+		Enabled:      enabled,
+		FlattenCNAME: rwJSON.FlattenCNAME == aghalg.NBTrue,
+	}
+
+	if rwJSON.TTL != nil {
+		rw.TTL = *rwJSON.TTL
 	}
 
 	err = rw.normalize(ctx, l)
 	if err != nil {
-		// Shouldn't happen currently, since normalize only returns a non-nil
-		// error when a rewrite is nil, but be change-proof.
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "normalizing: %s", err)
 
 		return
@@ -173,8 +181,6 @@ func (d *DNSFilter) handleRewriteUpdate(w http.ResponseWriter, r *http.Request)
 
 	err = rwAdd.normalize(ctx, l)
 	if err != nil {
-		// Shouldn't happen currently, since normalize only returns a non-nil
-		// error when a rewrite is nil, but be change-proof.
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "normalizing: %s", err)
 
 		return
@@ -204,6 +210,18 @@ func (d *DNSFilter) handleRewriteUpdate(w http.ResponseWriter, r *http.Request)
 		rwAdd.Enabled = updateJSON.Update.Enabled == aghalg.NBTrue
 	}
 
+	if updateJSON.Update.FlattenCNAME == aghalg.NBNull {
+		rwAdd.FlattenCNAME = d.conf.Rewrites[index].FlattenCNAME
+	} else {
+		rwAdd.FlattenCNAME = updateJSON.Update.FlattenCNAME == aghalg.NBTrue
+	}
+
+	if updateJSON.Update.TTL == nil {
+		rwAdd.TTL = d.conf.Rewrites[index].TTL
+	} else {
+		rwAdd.TTL = *updateJSON.Update.TTL
+	}
+
 	d.conf.Rewrites = slices.Replace(d.conf.Rewrites, index, index+1, rwAdd)
 
 	l.DebugContext(
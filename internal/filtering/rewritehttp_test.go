@@ -20,17 +20,20 @@ import (
 
 // TODO(d.kolyshev): Use [rewrite.Item] instead.
 type rewriteJSON struct {
-	Domain  string          `json:"domain"`
-	Answer  string          `json:"answer"`
-	Enabled aghalg.NullBool `json:"enabled"`
+	Domain       string          `json:"domain"`
+	Answer       string          `json:"answer"`
+	Enabled      aghalg.NullBool `json:"enabled"`
+	FlattenCNAME aghalg.NullBool `json:"flatten_cname"`
+	TTL          uint32          `json:"ttl"`
 }
 
 // newRewriteJSON returns a freshly initialized *rewriteJSON.
 func newRewriteJSON(domain, answer string, enabled aghalg.NullBool) (rw *rewriteJSON) {
 	return &rewriteJSON{
-		Domain:  domain,
-		Answer:  answer,
-		Enabled: enabled,
+		Domain:       domain,
+		Answer:       answer,
+		Enabled:      enabled,
+		FlattenCNAME: aghalg.NBFalse,
 	}
 }
 
@@ -139,6 +142,56 @@ func TestDNSFilter_HandleRewriteHTTP(t *testing.T) {
 			testRewrites,
 			newRewriteJSON(addDomain, addAnswer, aghalg.NBTrue),
 		),
+	}, {
+		name:   "add_flatten_cname",
+		url:    addURL,
+		method: http.MethodPost,
+		reqData: rewriteJSON{
+			Domain:       addDomain,
+			Answer:       addAnswer,
+			FlattenCNAME: aghalg.NBTrue,
+		},
+		wantConfMod: true,
+		wantStatus:  http.StatusOK,
+		wantBody:    "",
+		wantList: append(testRewrites, &rewriteJSON{
+			Domain:       addDomain,
+			Answer:       addAnswer,
+			Enabled:      aghalg.NBTrue,
+			FlattenCNAME: aghalg.NBTrue,
+		}),
+	}, {
+		name:   "add_ttl",
+		url:    addURL,
+		method: http.MethodPost,
+		reqData: rewriteJSON{
+			Domain: addDomain,
+			Answer: addAnswer,
+			TTL:    60,
+		},
+		wantConfMod: true,
+		wantStatus:  http.StatusOK,
+		wantBody:    "",
+		wantList: append(testRewrites, &rewriteJSON{
+			Domain:       addDomain,
+			Answer:       addAnswer,
+			Enabled:      aghalg.NBTrue,
+			FlattenCNAME: aghalg.NBFalse,
+			TTL:          60,
+		}),
+	}, {
+		name:   "add_invalid_regexp",
+		url:    addURL,
+		method: http.MethodPost,
+		reqData: rewriteJSON{
+			Domain: "/(/",
+			Answer: addAnswer,
+		},
+		wantConfMod: false,
+		wantStatus:  http.StatusBadRequest,
+		wantBody: "normalizing: domain \"/(/\": " +
+			"error parsing regexp: missing closing ): `(`\n",
+		wantList: testRewrites,
 	}, {
 		name:        "add_error",
 		url:         addURL,
@@ -331,9 +384,11 @@ func assertRewritesList(tb testing.TB, handler http.Handler, wantList []*rewrite
 func rewriteEntriesToLegacyRewrites(entries []*rewriteJSON) (rw []*filtering.LegacyRewrite) {
 	for _, entry := range entries {
 		rw = append(rw, &filtering.LegacyRewrite{
-			Domain:  entry.Domain,
-			Answer:  entry.Answer,
-			Enabled: entry.Enabled == aghalg.NBTrue,
+			Domain:       entry.Domain,
+			Answer:       entry.Answer,
+			Enabled:      entry.Enabled == aghalg.NBTrue,
+			FlattenCNAME: entry.FlattenCNAME == aghalg.NBTrue,
+			TTL:          entry.TTL,
 		})
 	}
 
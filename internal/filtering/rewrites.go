@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"log/slog"
 	"net/netip"
+	"regexp"
 	"slices"
 	"strings"
 
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/miekg/dns"
 )
 
@@ -21,22 +24,41 @@ import (
 //
 // NOTE:  Keep fields in sync with [cloneRewrites].
 type LegacyRewrite struct {
-	// Domain is the pattern to which this rewrite applies.
+	// re is the compiled regular expression for the regular expression
+	// patterns and the wildcard patterns with answer templates.  It is nil for
+	// the other patterns.
+	re *regexp.Regexp
+
+	// Domain is the pattern to which this rewrite applies.  It is either a
+	// domain name, a wildcard, such as "*.example.com", or a regular
+	// expression enclosed in slashes, such as "/^host-[0-9]+\.example$/".
 	Domain string `yaml:"domain"`
 
 	// Answer is the IP address, canonical name, or one of the special
-	// values: "A" or "AAAA".
+	// values: "A" or "AAAA".  For the wildcard and regular expression patterns
+	// it may be a template with the captured submatches, such as "10.0.0.$1",
+	// where the wildcard is the first submatch.
 	Answer string `yaml:"answer"`
 
 	// IP is the IP address that should be used in the response if Type is
 	// dns.TypeA or dns.TypeAAAA.
 	IP netip.Addr `yaml:"-"`
 
-	// Type is the DNS record type: A, AAAA, or CNAME.
+	// Type is the DNS record type: A, AAAA, or CNAME.  It is zero for the
+	// answer templates, since the type is determined after the expansion.
 	Type uint16 `yaml:"-"`
 
+	// TTL is the TTL of the records in the responses.  If zero, the TTL of
+	// the blocked responses is used.
+	TTL uint32 `yaml:"ttl"`
+
 	// Enabled indicates whether this rewrite is active.
 	Enabled bool `yaml:"enabled"`
+
+	// FlattenCNAME, if true, makes the DNS server respond with the addresses
+	// of the final canonical name only, owned by the requested name, if the
+	// answer is a CNAME.
+	FlattenCNAME bool `yaml:"flatten_cname"`
 }
 
 // equal returns true if the rw is equal to the other.
@@ -64,17 +86,47 @@ func (rw *LegacyRewrite) matchesQType(qt uint16) (ok bool) {
 // normalize makes sure that the new or decoded entry is normalized with regards
 // to domain name case, IP length, and so on.
 //
-// If rw is nil, it returns an errors.
+// If rw is nil or its regular expression is invalid, it returns an error.
 func (rw *LegacyRewrite) normalize(ctx context.Context, l *slog.Logger) (err error) {
 	if rw == nil {
 		return errors.Error("nil rewrite entry")
 	}
 
-	// TODO(a.garipov): Write a case-agnostic version of strings.HasSuffix and
-	// use it in matchDomainWildcard instead of using strings.ToLower
-	// everywhere.
-	rw.Domain = strings.ToLower(rw.Domain)
+	rw.re = nil
+	if isRegexp(rw.Domain) {
+		rw.re, err = regexp.Compile(rw.Domain[1 : len(rw.Domain)-1])
+		if err != nil {
+			return fmt.Errorf("domain %q: %w", rw.Domain, err)
+		}
+	} else {
+		// TODO(a.garipov): Write a case-agnostic version of strings.HasSuffix
+		// and use it in matchDomainWildcard instead of using strings.ToLower
+		// everywhere.
+		rw.Domain = strings.ToLower(rw.Domain)
+		if isWildcard(rw.Domain) && isAnswerTemplate(rw.Answer) {
+			rw.re = regexp.MustCompile(`^(.+)` + regexp.QuoteMeta(rw.Domain[1:]) + `$`)
+		}
+	}
+
+	if rw.re != nil && isAnswerTemplate(rw.Answer) {
+		rw.IP = netip.Addr{}
+		rw.Type = 0
+
+		return nil
+	}
+
+	err = rw.setAnswer()
+	if err != nil {
+		l.DebugContext(ctx, "normalizing legacy rewrite", slogutil.KeyError, err)
+	}
+
+	return nil
+}
 
+// setAnswer sets the type and the IP address of rw according to its answer.
+// err is the error of parsing the answer as an IP address, if the answer is a
+// canonical name.
+func (rw *LegacyRewrite) setAnswer() (err error) {
 	switch rw.Answer {
 	case "AAAA":
 		rw.IP = netip.Addr{}
@@ -92,10 +144,10 @@ func (rw *LegacyRewrite) normalize(ctx context.Context, l *slog.Logger) (err err
 
 	ip, err := netip.ParseAddr(rw.Answer)
 	if err != nil {
-		l.DebugContext(ctx, "normalizing legacy rewrite", slogutil.KeyError, err)
+		rw.IP = netip.Addr{}
 		rw.Type = dns.TypeCNAME
 
-		return nil
+		return err
 	}
 
 	rw.IP = ip
@@ -113,6 +165,53 @@ func isWildcard(pat string) bool {
 	return len(pat) > 1 && pat[0] == '*' && pat[1] == '.'
 }
 
+// isRegexp returns true if pat is a regular expression domain pattern.
+func isRegexp(pat string) (ok bool) {
+	return len(pat) > 2 && pat[0] == '/' && pat[len(pat)-1] == '/'
+}
+
+// isPattern returns true if pat is either a wildcard or a regular expression
+// domain pattern.
+func isPattern(pat string) (ok bool) {
+	return isWildcard(pat) || isRegexp(pat)
+}
+
+// isAnswerTemplate returns true if ans contains references to the captured
+// submatches.
+func isAnswerTemplate(ans string) (ok bool) {
+	return strings.Contains(ans, "$")
+}
+
+// match returns the rewrite applying to host or false if rw doesn't match it.
+// If the answer of rw is a template, res is a copy of rw with the expanded
+// answer, otherwise it's rw itself.
+func (rw *LegacyRewrite) match(host string) (res *LegacyRewrite, ok bool) {
+	if rw.re == nil {
+		return rw, rw.Domain == host || matchDomainWildcard(host, rw.Domain)
+	}
+
+	sub := rw.re.FindStringSubmatchIndex(host)
+	if sub == nil {
+		return nil, false
+	} else if !isAnswerTemplate(rw.Answer) {
+		return rw, true
+	}
+
+	res = &LegacyRewrite{
+		Domain:       rw.Domain,
+		Answer:       string(rw.re.ExpandString(nil, rw.Answer, host, sub)),
+		TTL:          rw.TTL,
+		Enabled:      rw.Enabled,
+		FlattenCNAME: rw.FlattenCNAME,
+	}
+
+	// Don't check the error, since it only means that the expanded answer is
+	// a canonical name.
+	_ = res.setAnswer()
+
+	return res, true
+}
+
 // matchDomainWildcard returns true if host matches the wildcard pattern.
 func matchDomainWildcard(host, wildcard string) (ok bool) {
 	return isWildcard(wildcard) && strings.HasSuffix(host, wildcard[1:])
@@ -121,7 +220,7 @@ func matchDomainWildcard(host, wildcard string) (ok bool) {
 // Compare is used to sort rewrites according to the following priority:
 //
 //  1. A and AAAA > CNAME;
-//  2. wildcard > exact;
+//  2. regular expression > wildcard > exact;
 //  3. lower level wildcard > higher level wildcard;
 func (rw *LegacyRewrite) Compare(b *LegacyRewrite) (res int) {
 	if rw.Type == dns.TypeCNAME {
@@ -132,12 +231,30 @@ func (rw *LegacyRewrite) Compare(b *LegacyRewrite) (res int) {
 		return 1
 	}
 
+	if aIsRe, bIsRe := isRegexp(rw.Domain), isRegexp(b.Domain); aIsRe && bIsRe {
+		// Keep the order of the regular expressions.
+		return 0
+	} else if aIsRe != bIsRe {
+		return compareBool(aIsRe, bIsRe)
+	}
+
 	if aIsWld, bIsWld := isWildcard(rw.Domain), isWildcard(b.Domain); aIsWld == bIsWld {
 		// Both are either wildcards or both aren't.
 		return len(b.Domain) - len(rw.Domain)
-	} else if aIsWld {
-		return 1
 	} else {
+		return compareBool(aIsWld, bIsWld)
+	}
+}
+
+// compareBool returns 1 if a is true and b is false, -1 if a is false and b is
+// true, and 0 otherwise.
+func compareBool(a, b bool) (res int) {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
 		return -1
 	}
 }
@@ -154,6 +271,50 @@ func (d *DNSFilter) prepareRewrites(ctx context.Context) (err error) {
 	return nil
 }
 
+// findRewritesPTR returns the domain names of the enabled exact rewrites, which
+// resolve to ip.
+func findRewritesPTR(entries []*LegacyRewrite, ip netip.Addr) (hosts []string) {
+	for _, e := range entries {
+		if !e.Enabled || isPattern(e.Domain) || (e.Type != dns.TypeA && e.Type != dns.TypeAAAA) {
+			continue
+		}
+
+		if e.IP == ip && !slices.Contains(hosts, e.Domain) {
+			hosts = append(hosts, e.Domain)
+		}
+	}
+
+	return hosts
+}
+
+// rewritePTRResult returns the result of synthesizing the PTR records for arpa,
+// which is a reversed address, from the rewrites.  res is empty if there are no
+// rewrites for the address.
+func rewritePTRResult(entries []*LegacyRewrite, arpa string) (res Result) {
+	ip, err := netutil.IPFromReversedAddr(arpa)
+	if err != nil {
+		return Result{}
+	}
+
+	hosts := findRewritesPTR(entries, ip)
+	if len(hosts) == 0 {
+		return Result{}
+	}
+
+	vals := make([]rules.RRValue, 0, len(hosts))
+	for _, h := range hosts {
+		vals = append(vals, h)
+	}
+
+	return Result{
+		DNSRewriteResult: &DNSRewriteResult{
+			Response: DNSRewriteResultResponse{dns.TypePTR: vals},
+			RCode:    dns.RcodeSuccess,
+		},
+		Reason: Rewritten,
+	}
+}
+
 // findRewrites returns the list of matched rewrite entries.  If rewrites are
 // empty, but matched is true, the domain is found among the rewrite rules but
 // not for this question type.
@@ -171,13 +332,14 @@ func findRewrites(
 			continue
 		}
 
-		if e.Domain != host && !matchDomainWildcard(host, e.Domain) {
+		rw, ok := e.match(host)
+		if !ok {
 			continue
 		}
 
 		matched = true
-		if e.matchesQType(qtype) {
-			rewrites = append(rewrites, e)
+		if rw.matchesQType(qtype) {
+			rewrites = append(rewrites, rw)
 		}
 	}
 
@@ -188,12 +350,13 @@ func findRewrites(
 	return finalizeRewrites(rewrites), matched
 }
 
-// finalizeRewrites sorts rewrites and truncates wildcard ones.
+// finalizeRewrites sorts rewrites and truncates wildcard and regular expression
+// ones.
 func finalizeRewrites(rewrites []*LegacyRewrite) (resRewrites []*LegacyRewrite) {
-	slices.SortFunc(rewrites, (*LegacyRewrite).Compare)
+	slices.SortStableFunc(rewrites, (*LegacyRewrite).Compare)
 
 	for i, r := range rewrites {
-		if isWildcard(r.Domain) {
+		if isPattern(r.Domain) {
 			// Don't use rewrites[:0], because we need to return at least one
 			// item here.
 			rewrites = rewrites[:max(1, i)]
@@ -224,6 +387,7 @@ func (d *DNSFilter) setRewriteResult(
 			}
 
 			res.IPList = append(res.IPList, rw.IP)
+			res.TTL = minRewriteTTL(res.TTL, rw.TTL)
 
 			d.logger.DebugContext(ctx, "set a/aaaa rewrite", "host", host, "ans", rw.IP)
 		}
@@ -235,13 +399,29 @@ func cloneRewrites(entries []*LegacyRewrite) (clone []*LegacyRewrite) {
 	clone = make([]*LegacyRewrite, len(entries))
 	for i, rw := range entries {
 		clone[i] = &LegacyRewrite{
-			Domain:  rw.Domain,
-			Answer:  rw.Answer,
-			IP:      rw.IP,
-			Type:    rw.Type,
-			Enabled: rw.Enabled,
+			re:           rw.re,
+			Domain:       rw.Domain,
+			Answer:       rw.Answer,
+			IP:           rw.IP,
+			Type:         rw.Type,
+			TTL:          rw.TTL,
+			Enabled:      rw.Enabled,
+			FlattenCNAME: rw.FlattenCNAME,
 		}
 	}
 
 	return clone
 }
+
+// minRewriteTTL returns the minimum of the TTLs, ignoring the ones, which are
+// zero, since that means that the TTL isn't set.
+func minRewriteTTL(a, b uint32) (ttl uint32) {
+	switch {
+	case a == 0:
+		return b
+	case b == 0:
+		return a
+	default:
+		return min(a, b)
+	}
+}
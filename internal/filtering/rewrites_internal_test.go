@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -445,3 +446,225 @@ func TestRewritesExceptionIP(t *testing.T) {
 		})
 	}
 }
+
+func TestRewritesPatterns(t *testing.T) {
+	d, _ := newForTest(t, nil, nil)
+	t.Cleanup(d.Close)
+
+	d.conf.Rewrites = []*LegacyRewrite{{
+		Domain:  "*.host.com",
+		Answer:  "10.0.0.$1",
+		TTL:     60,
+		Enabled: true,
+	}, {
+		Domain:  `/^host-([0-9]+)-([0-9]+)\.example$/`,
+		Answer:  "192.168.$1.$2",
+		Enabled: true,
+	}, {
+		Domain:  `/^alias-([a-z]+)\.example$/`,
+		Answer:  "$1.target.example",
+		TTL:     30,
+		Enabled: true,
+	}, {
+		Domain:  "www.target.example",
+		Answer:  "1.2.3.4",
+		TTL:     120,
+		Enabled: true,
+	}, {
+		Domain:  "7.host.com",
+		Answer:  "1.1.1.1",
+		Enabled: true,
+	}, {
+		Domain:  "/^.*\\.other\\.example$/",
+		Answer:  "2.2.2.2",
+		Enabled: true,
+	}, {
+		Domain:  "*.other.example",
+		Answer:  "3.3.3.3",
+		Enabled: true,
+	}}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, d.prepareRewrites(ctx))
+
+	testCases := []struct {
+		name       string
+		host       string
+		wantCName  string
+		wantIPs    []netip.Addr
+		wantReason Reason
+		wantTTL    uint32
+	}{{
+		name:       "wildcard_template",
+		host:       "5.host.com",
+		wantCName:  "",
+		wantIPs:    []netip.Addr{netip.MustParseAddr("10.0.0.5")},
+		wantReason: Rewritten,
+		wantTTL:    60,
+	}, {
+		name:       "wildcard_template_invalid",
+		host:       "a.b.host.com",
+		wantCName:  "10.0.0.a.b",
+		wantIPs:    nil,
+		wantReason: Rewritten,
+		wantTTL:    60,
+	}, {
+		name:       "exact_over_template",
+		host:       "7.host.com",
+		wantCName:  "",
+		wantIPs:    []netip.Addr{netip.MustParseAddr("1.1.1.1")},
+		wantReason: Rewritten,
+		wantTTL:    0,
+	}, {
+		name:       "regexp_template",
+		host:       "host-12-34.example",
+		wantCName:  "",
+		wantIPs:    []netip.Addr{netip.MustParseAddr("192.168.12.34")},
+		wantReason: Rewritten,
+		wantTTL:    0,
+	}, {
+		name:       "regexp_cname",
+		host:       "alias-www.example",
+		wantCName:  "www.target.example",
+		wantIPs:    []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+		wantReason: Rewritten,
+		wantTTL:    30,
+	}, {
+		name:       "wildcard_over_regexp",
+		host:       "sub.other.example",
+		wantCName:  "",
+		wantIPs:    []netip.Addr{netip.MustParseAddr("3.3.3.3")},
+		wantReason: Rewritten,
+		wantTTL:    0,
+	}, {
+		name:       "regexp_no_match",
+		host:       "host-12.example",
+		wantCName:  "",
+		wantIPs:    nil,
+		wantReason: NotFilteredNotFound,
+		wantTTL:    0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := d.processRewrites(tc.host, dns.TypeA)
+			require.Equalf(t, tc.wantReason, r.Reason, "got %s", r.Reason)
+
+			assert.Equal(t, tc.wantCName, r.CanonName)
+			assert.Equal(t, tc.wantIPs, r.IPList)
+			assert.Equal(t, tc.wantTTL, r.TTL)
+		})
+	}
+}
+
+func TestLegacyRewrite_normalize_regexp(t *testing.T) {
+	rw := &LegacyRewrite{
+		Domain: "/(/",
+		Answer: "1.2.3.4",
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	err := rw.normalize(ctx, testLogger)
+	testutil.AssertErrorMsg(t, "domain \"/(/\": error parsing regexp: missing closing ): `(`", err)
+}
+
+func TestRewritesPTR(t *testing.T) {
+	d, _ := newForTest(t, nil, nil)
+	t.Cleanup(d.Close)
+
+	d.conf.Rewrites = []*LegacyRewrite{{
+		Domain:  "host.lan",
+		Answer:  "192.168.1.50",
+		Enabled: true,
+	}, {
+		Domain:  "alias.lan",
+		Answer:  "192.168.1.50",
+		Enabled: true,
+	}, {
+		Domain:  "*.wildcard.lan",
+		Answer:  "192.168.1.51",
+		Enabled: true,
+	}, {
+		Domain:  "disabled.lan",
+		Answer:  "192.168.1.52",
+		Enabled: false,
+	}, {
+		Domain:  "v6.lan",
+		Answer:  "fd00::1",
+		Enabled: true,
+	}, {
+		Domain:  "53.1.168.192.in-addr.arpa",
+		Answer:  "manual.lan",
+		Enabled: true,
+	}, {
+		Domain:  "other.lan",
+		Answer:  "192.168.1.53",
+		Enabled: true,
+	}}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, d.prepareRewrites(ctx))
+
+	testCases := []struct {
+		name       string
+		host       string
+		wantPTRs   []rules.RRValue
+		wantCName  string
+		wantReason Reason
+	}{{
+		name:       "synthesized",
+		host:       "50.1.168.192.in-addr.arpa",
+		wantPTRs:   []rules.RRValue{"host.lan", "alias.lan"},
+		wantCName:  "",
+		wantReason: Rewritten,
+	}, {
+		name: "synthesized_ipv6",
+		host: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0." +
+			"0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa",
+		wantPTRs:   []rules.RRValue{"v6.lan"},
+		wantCName:  "",
+		wantReason: Rewritten,
+	}, {
+		name:       "wildcard",
+		host:       "51.1.168.192.in-addr.arpa",
+		wantPTRs:   nil,
+		wantCName:  "",
+		wantReason: NotFilteredNotFound,
+	}, {
+		name:       "disabled",
+		host:       "52.1.168.192.in-addr.arpa",
+		wantPTRs:   nil,
+		wantCName:  "",
+		wantReason: NotFilteredNotFound,
+	}, {
+		name:       "manual",
+		host:       "53.1.168.192.in-addr.arpa",
+		wantPTRs:   nil,
+		wantCName:  "manual.lan",
+		wantReason: Rewritten,
+	}, {
+		name:       "not_reversed",
+		host:       "unknown.lan",
+		wantPTRs:   nil,
+		wantCName:  "",
+		wantReason: NotFilteredNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := d.processRewrites(tc.host, dns.TypePTR)
+			require.Equalf(t, tc.wantReason, r.Reason, "got %s", r.Reason)
+
+			assert.Equal(t, tc.wantCName, r.CanonName)
+
+			if tc.wantPTRs == nil {
+				assert.Nil(t, r.DNSRewriteResult)
+
+				return
+			}
+
+			require.NotNil(t, r.DNSRewriteResult)
+			assert.Equal(t, tc.wantPTRs, r.DNSRewriteResult.Response[dns.TypePTR])
+		})
+	}
+}
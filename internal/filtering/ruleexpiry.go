@@ -0,0 +1,166 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// expiresModifier is the name of the modifier of the user rules, which sets
+// the time after which the rule is removed, for example:
+//
+//	@@||example.com^$expires=2024-07-01
+//	||example.org^$important,expires=2024-07-01T12:00:00Z
+const expiresModifier = "expires"
+
+// userRulesExpiryInterval is the interval between the removals of the expired
+// user rules.
+const userRulesExpiryInterval = 1 * time.Minute
+
+// parseRuleExpiry returns the rule text without the expires modifier and the
+// time of the expiration.  expires is zero if text has no expires modifier.
+// The expiration is either a date, which means the start of the day in the
+// local time zone, or an RFC 3339 time.
+func parseRuleExpiry(text string) (rule string, expires time.Time, err error) {
+	i := strings.LastIndexByte(text, '$')
+	if i < 0 || !strings.Contains(text[i:], expiresModifier+"=") {
+		return text, time.Time{}, nil
+	}
+
+	mods := strings.Split(text[i+1:], ",")
+	rest := make([]string, 0, len(mods))
+	for _, m := range mods {
+		name, val, _ := strings.Cut(m, "=")
+		if strings.TrimSpace(name) != expiresModifier {
+			rest = append(rest, m)
+
+			continue
+		}
+
+		if !expires.IsZero() {
+			return "", time.Time{}, fmt.Errorf("%s: duplicate modifier", expiresModifier)
+		}
+
+		expires, err = parseExpiresValue(strings.TrimSpace(val))
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("%s: %w", expiresModifier, err)
+		}
+	}
+
+	if len(rest) == 0 {
+		return text[:i], expires, nil
+	}
+
+	return text[:i+1] + strings.Join(rest, ","), expires, nil
+}
+
+// parseExpiresValue parses the value of the expires modifier.
+func parseExpiresValue(val string) (t time.Time, err error) {
+	if val == "" {
+		return time.Time{}, errors.ErrEmptyValue
+	}
+
+	t, err = time.ParseInLocation(time.DateOnly, val, time.Local)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time %q: want date or rfc3339 time", val)
+	}
+
+	return t, nil
+}
+
+// userRulesData returns the user rules applied at now, which are the ones that
+// haven't expired yet, with the expires modifiers removed.  The rules with the
+// invalid expires modifiers are kept as is, so that they are reported by the
+// rule engine.
+func userRulesData(userRules []string, now time.Time) (data []byte) {
+	applied := make([]string, 0, len(userRules))
+	for _, text := range userRules {
+		rule, expires, err := parseRuleExpiry(text)
+		if err != nil {
+			rule = text
+		} else if !expires.IsZero() && !now.Before(expires) {
+			continue
+		}
+
+		applied = append(applied, rule)
+	}
+
+	return []byte(strings.Join(applied, "\n"))
+}
+
+// ruleExpiryJSON is a user rule with an expiration.
+type ruleExpiryJSON struct {
+	// Expires is the time of the expiration of the rule.
+	Expires time.Time `json:"expires"`
+
+	// Rule is the text of the rule, including the expires modifier.
+	Rule string `json:"rule"`
+}
+
+// userRulesExpirations returns the user rules with the expirations.
+func userRulesExpirations(userRules []string) (exps []*ruleExpiryJSON) {
+	exps = []*ruleExpiryJSON{}
+	for _, text := range userRules {
+		_, expires, err := parseRuleExpiry(text)
+		if err == nil && !expires.IsZero() {
+			exps = append(exps, &ruleExpiryJSON{
+				Expires: expires,
+				Rule:    text,
+			})
+		}
+	}
+
+	return exps
+}
+
+// removeExpiredUserRules removes the user rules, which have expired at now,
+// and returns their number.
+func (d *DNSFilter) removeExpiredUserRules(now time.Time) (n int) {
+	d.conf.filtersMu.Lock()
+	defer d.conf.filtersMu.Unlock()
+
+	prevLen := len(d.conf.UserRules)
+	d.conf.UserRules = slices.DeleteFunc(slices.Clone(d.conf.UserRules), func(text string) (ok bool) {
+		_, expires, err := parseRuleExpiry(text)
+
+		return err == nil && !expires.IsZero() && !now.Before(expires)
+	})
+
+	return prevLen - len(d.conf.UserRules)
+}
+
+// userRulesExpiryLoop periodically removes the expired user rules and writes
+// the configuration, if any have been removed, until done is closed.
+func (d *DNSFilter) userRulesExpiryLoop(ctx context.Context, done <-chan struct{}) {
+	defer slogutil.RecoverAndLog(ctx, d.logger)
+
+	t := time.NewTicker(userRulesExpiryInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			n := d.removeExpiredUserRules(time.Now())
+			if n == 0 {
+				continue
+			}
+
+			d.logger.InfoContext(ctx, "removed expired user rules", "count", n)
+
+			d.conf.ConfModifier.Apply(ctx)
+			d.EnableFilters(true)
+		case <-done:
+			return
+		}
+	}
+}
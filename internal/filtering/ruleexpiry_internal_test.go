@@ -0,0 +1,110 @@
+package filtering
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRuleExpiry(t *testing.T) {
+	date := time.Date(2024, 7, 1, 0, 0, 0, 0, time.Local)
+	moment := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		wantExpires time.Time
+		name        string
+		text        string
+		wantRule    string
+		wantErrMsg  string
+	}{{
+		wantExpires: time.Time{},
+		name:        "no_expiry",
+		text:        "||example.org^$important",
+		wantRule:    "||example.org^$important",
+		wantErrMsg:  "",
+	}, {
+		wantExpires: date,
+		name:        "date",
+		text:        "@@||example.com^$expires=2024-07-01",
+		wantRule:    "@@||example.com^",
+		wantErrMsg:  "",
+	}, {
+		wantExpires: moment,
+		name:        "time_with_modifiers",
+		text:        "||example.org^$important,expires=2024-07-01T12:00:00Z,client=cli",
+		wantRule:    "||example.org^$important,client=cli",
+		wantErrMsg:  "",
+	}, {
+		wantExpires: time.Time{},
+		name:        "regexp",
+		text:        "/ads$/",
+		wantRule:    "/ads$/",
+		wantErrMsg:  "",
+	}, {
+		wantExpires: time.Time{},
+		name:        "bad_time",
+		text:        "||example.org^$expires=tomorrow",
+		wantRule:    "",
+		wantErrMsg:  `expires: bad time "tomorrow": want date or rfc3339 time`,
+	}, {
+		wantExpires: time.Time{},
+		name:        "empty",
+		text:        "||example.org^$expires=",
+		wantRule:    "",
+		wantErrMsg:  "expires: empty value",
+	}, {
+		wantExpires: time.Time{},
+		name:        "duplicate",
+		text:        "||example.org^$expires=2024-07-01,expires=2024-07-02",
+		wantRule:    "",
+		wantErrMsg:  "expires: duplicate modifier",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, expires, err := parseRuleExpiry(tc.text)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.wantRule, rule)
+			assert.True(t, tc.wantExpires.Equal(expires))
+		})
+	}
+}
+
+func TestDNSFilter_removeExpiredUserRules(t *testing.T) {
+	const (
+		expired   = "@@||expired.example^$expires=2024-07-01"
+		unexpired = "||unexpired.example^$important,expires=2024-07-03"
+		permanent = "||permanent.example^"
+	)
+
+	now := time.Date(2024, 7, 2, 0, 0, 0, 0, time.Local)
+	userRules := []string{expired, unexpired, permanent}
+
+	assert.Equal(
+		t,
+		"||unexpired.example^$important\n||permanent.example^",
+		string(userRulesData(userRules, now)),
+	)
+
+	exps := userRulesExpirations(userRules)
+	require.Len(t, exps, 2)
+
+	assert.Equal(t, expired, exps[0].Rule)
+	assert.Equal(t, unexpired, exps[1].Rule)
+
+	d := &DNSFilter{
+		conf: &Config{
+			UserRules: userRules,
+			filtersMu: &sync.RWMutex{},
+		},
+	}
+
+	assert.Equal(t, 1, d.removeExpiredUserRules(now))
+	assert.Equal(t, []string{unexpired, permanent}, d.conf.UserRules)
+	assert.Equal(t, 0, d.removeExpiredUserRules(now))
+}
@@ -37,6 +37,15 @@ const (
 	APIIDParentalControl APIID = -3
 	APIIDSafeBrowsing    APIID = -4
 	APIIDSafeSearch      APIID = -5
+	APIIDThreatFeed      APIID = -6
+	APIIDAllowlistOnly   APIID = -7
+	APIIDBlockedTLD      APIID = -8
+	APIIDGeoBlocking     APIID = -9
+	APIIDNewDomains      APIID = -10
+	APIIDDGA             APIID = -11
+	APIIDQTypePolicy     APIID = -12
+	APIIDHomograph       APIID = -13
+	APIIDClientQuota     APIID = -14
 )
 
 // The IDs of built-in filter lists.  The IDs for the blocked-service and the
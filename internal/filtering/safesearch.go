@@ -32,6 +32,23 @@ type SafeSearchConfig struct {
 	Pixabay    bool `yaml:"pixabay" json:"pixabay"`
 	Yandex     bool `yaml:"yandex" json:"yandex"`
 	YouTube    bool `yaml:"youtube" json:"youtube"`
+
+	// CustomRewrites are the additional safe search rewrites for the search
+	// engines, which aren't among the built-in services, such as self-hosted
+	// ones or regional domains.
+	CustomRewrites []*SafeSearchRewrite `yaml:"custom_rewrites" json:"custom_rewrites"`
+}
+
+// SafeSearchRewrite is a custom mapping of a search engine domain to its safe
+// search version.
+type SafeSearchRewrite struct {
+	// Domain is the domain name of the search engine.  If it starts with "*.",
+	// the subdomains are rewritten as well.
+	Domain string `yaml:"domain" json:"domain"`
+
+	// Answer is either the domain name of the safe search version, which is
+	// returned as a CNAME, or its IP address.
+	Answer string `yaml:"answer" json:"answer"`
 }
 
 // checkSafeSearch checks host with safe search engine.  Matches
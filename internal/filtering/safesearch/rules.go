@@ -1,6 +1,15 @@
 package safesearch
 
-import _ "embed"
+import (
+	_ "embed"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+)
 
 //go:embed rules/bing.txt
 var bing string
@@ -36,3 +45,63 @@ var safeSearchRules = map[Service]string{
 	Yandex:     yandex,
 	YouTube:    youtube,
 }
+
+// customRulesText returns the text of the filtering rules for the custom safe
+// search rewrites.
+func customRulesText(rewrites []*filtering.SafeSearchRewrite) (text string, err error) {
+	var sb strings.Builder
+	var errs []error
+	for i, rw := range rewrites {
+		err = writeCustomRule(&sb, rw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("at index %d: %w", i, err))
+		}
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return "", fmt.Errorf("custom rewrites: %w", err)
+	}
+
+	return sb.String(), nil
+}
+
+// writeCustomRule validates rw and writes the filtering rule for it to sb.
+func writeCustomRule(sb *strings.Builder, rw *filtering.SafeSearchRewrite) (err error) {
+	if rw == nil {
+		return errors.ErrNoValue
+	}
+
+	domain, hasWildcard := strings.CutPrefix(strings.ToLower(rw.Domain), "*.")
+	err = netutil.ValidateHostname(domain)
+	if err != nil {
+		return fmt.Errorf("domain: %w", err)
+	}
+
+	var answer string
+	if ip, parseErr := netip.ParseAddr(rw.Answer); parseErr == nil {
+		rrType := "A"
+		if ip.Is6() {
+			rrType = "AAAA"
+		}
+
+		answer = rrType + ";" + ip.String()
+	} else if err = netutil.ValidateHostname(rw.Answer); err != nil {
+		return fmt.Errorf("answer: %w", err)
+	} else {
+		answer = "CNAME;" + strings.ToLower(rw.Answer)
+	}
+
+	if hasWildcard {
+		sb.WriteString("||")
+	} else {
+		sb.WriteString("|")
+	}
+
+	sb.WriteString(domain)
+	sb.WriteString("^$dnsrewrite=NOERROR;")
+	sb.WriteString(answer)
+	sb.WriteByte('\n')
+
+	return nil
+}
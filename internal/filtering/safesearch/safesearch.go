@@ -136,6 +136,14 @@ func (ss *Default) resetEngine(
 	id rules.ListID,
 	conf filtering.SafeSearchConfig,
 ) (err error) {
+	// Validate the custom rewrites even if safe search is disabled, so that
+	// the invalid ones aren't saved to the configuration.
+	custom, err := customRulesText(conf.CustomRewrites)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
 	if !conf.Enabled {
 		ss.logger.DebugContext(ctx, "disabled")
 
@@ -149,6 +157,8 @@ func (ss *Default) resetEngine(
 		}
 	}
 
+	sb.WriteString(custom)
+
 	strList := []filterlist.Interface{
 		filterlist.NewString(&filterlist.StringConfig{
 			ID:             id,
@@ -223,3 +223,89 @@ func TestDefault_Update(t *testing.T) {
 
 	assert.False(t, res.IsFiltered)
 }
+
+func TestDefault_CheckHost_custom(t *testing.T) {
+	conf := filtering.SafeSearchConfig{
+		Enabled: true,
+		CustomRewrites: []*filtering.SafeSearchRewrite{{
+			Domain: "search.example",
+			Answer: "safe.search.example",
+		}, {
+			Domain: "*.searx.example",
+			Answer: "192.0.2.1",
+		}},
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	ss, err := safesearch.NewDefault(ctx, &safesearch.DefaultConfig{
+		Logger:         testLogger,
+		ServicesConfig: conf,
+		CacheSize:      testCacheSize,
+		CacheTTL:       testCacheTTL,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		host      string
+		wantCNAME string
+		wantIP    netip.Addr
+		filtered  bool
+	}{{
+		name:      "cname",
+		host:      "search.example",
+		wantCNAME: "safe.search.example",
+		wantIP:    netip.Addr{},
+		filtered:  true,
+	}, {
+		name:      "cname_subdomain",
+		host:      "www.search.example",
+		wantCNAME: "",
+		wantIP:    netip.Addr{},
+		filtered:  false,
+	}, {
+		name:      "ip",
+		host:      "searx.example",
+		wantCNAME: "",
+		wantIP:    netip.MustParseAddr("192.0.2.1"),
+		filtered:  true,
+	}, {
+		name:      "ip_subdomain",
+		host:      "www.searx.example",
+		wantCNAME: "",
+		wantIP:    netip.MustParseAddr("192.0.2.1"),
+		filtered:  true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, checkErr := ss.CheckHost(ctx, tc.host, testQType)
+			require.NoError(t, checkErr)
+
+			assert.Equal(t, tc.filtered, res.IsFiltered)
+			assert.Equal(t, tc.wantCNAME, res.CanonName)
+
+			if tc.wantIP.IsValid() {
+				require.Len(t, res.Rules, 1)
+
+				assert.Equal(t, tc.wantIP, res.Rules[0].IP)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		err = ss.Update(ctx, filtering.SafeSearchConfig{
+			CustomRewrites: []*filtering.SafeSearchRewrite{{
+				Domain: "bad domain",
+				Answer: "safe.example",
+			}},
+		})
+		testutil.AssertErrorMsg(
+			t,
+			`custom rewrites: at index 0: domain: bad hostname "bad domain": `+
+				`bad top-level domain name label "bad domain": `+
+				`bad top-level domain name label rune ' '`,
+			err,
+		)
+	})
+}
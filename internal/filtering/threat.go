@@ -0,0 +1,114 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/threatfeed"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/service"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// DefaultThreatFeedsUpdateInterval is the default interval between the pulls
+// of the threat-intelligence feeds.
+const DefaultThreatFeedsUpdateInterval = 12 * time.Hour
+
+// ThreatFeedsConfig is the configuration of the threat-intelligence feeds.
+type ThreatFeedsConfig struct {
+	// Feeds are the configurations of the feeds.
+	Feeds []*threatfeed.FeedConfig `yaml:"feeds"`
+
+	// UpdateInterval is the interval between the pulls of the feeds.  If it's
+	// zero, [DefaultThreatFeedsUpdateInterval] is used.
+	UpdateInterval timeutil.Duration `yaml:"update_interval"`
+
+	// MinConfidence is the minimum confidence of the indicators used for
+	// blocking.
+	MinConfidence uint8 `yaml:"min_confidence"`
+
+	// Enabled defines if the feeds are used.
+	Enabled bool `yaml:"enabled"`
+}
+
+// ThreatChecker is used for matching hosts against the indicators of
+// compromise of threat-intelligence feeds.
+type ThreatChecker interface {
+	// Refresher pulls the feeds.
+	service.Refresher
+
+	// Match returns the indicator matching host, if any.
+	Match(host string) (ind *threatfeed.Indicator)
+}
+
+// checkThreatFeeds is a hostChecker that blocks the hosts matching the
+// indicators of the threat-intelligence feeds.
+func (d *DNSFilter) checkThreatFeeds(
+	host string,
+	_ uint16,
+	setts *Settings,
+) (res Result, err error) {
+	if !setts.ProtectionEnabled || d.threatChecker == nil {
+		return Result{}, nil
+	}
+
+	ind := d.threatChecker.Match(host)
+	if ind == nil {
+		return Result{}, nil
+	}
+
+	d.logger.InfoContext(
+		context.TODO(),
+		"threat detected",
+		"host", host,
+		"client", setts.ClientName,
+		"feed", ind.Feed,
+		"category", ind.Category,
+		"confidence", ind.Confidence,
+	)
+
+	return Result{
+		Rules: []*ResultRule{{
+			Text:         fmt.Sprintf("threat feed %s: %s", ind.Feed, ind.Category),
+			FilterListID: rulelist.APIIDThreatFeed,
+		}},
+		Threat:     ind,
+		Reason:     FilteredBlockList,
+		IsFiltered: true,
+	}, nil
+}
+
+// threatFeedsLoop pulls the threat-intelligence feeds every ivl until
+// d.threatDone is closed.  The first pull is performed immediately.
+func (d *DNSFilter) threatFeedsLoop(ctx context.Context, ivl time.Duration) {
+	defer slogutil.RecoverAndLog(ctx, d.logger)
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			err := d.threatChecker.Refresh(ctx)
+			if err != nil {
+				d.logger.ErrorContext(ctx, "refreshing threat feeds", slogutil.KeyError, err)
+			}
+
+			t.Reset(ivl)
+		case <-d.threatDone:
+			return
+		}
+	}
+}
+
+// threatFeedsInterval returns the interval between the pulls of the
+// threat-intelligence feeds.
+func (c *Config) threatFeedsInterval() (ivl time.Duration) {
+	if c.ThreatFeeds == nil || c.ThreatFeeds.UpdateInterval == 0 {
+		return DefaultThreatFeedsUpdateInterval
+	}
+
+	return time.Duration(c.ThreatFeeds.UpdateInterval)
+}
@@ -0,0 +1,81 @@
+package filtering
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/threatfeed"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testThreatChecker is the ThreatChecker for tests.
+type testThreatChecker struct {
+	indicators map[string]*threatfeed.Indicator
+}
+
+// type check
+var _ ThreatChecker = (*testThreatChecker)(nil)
+
+// Refresh implements the [ThreatChecker] interface for *testThreatChecker.
+func (c *testThreatChecker) Refresh(_ context.Context) (err error) { return nil }
+
+// Match implements the [ThreatChecker] interface for *testThreatChecker.
+func (c *testThreatChecker) Match(host string) (ind *threatfeed.Indicator) {
+	return c.indicators[host]
+}
+
+func TestDNSFilter_CheckHost_threatFeeds(t *testing.T) {
+	ind := &threatfeed.Indicator{
+		Feed:       "urlhaus",
+		Category:   "malware_download",
+		Confidence: 80,
+	}
+
+	d, setts := newForTest(t, &Config{
+		ThreatChecker: &testThreatChecker{
+			indicators: map[string]*threatfeed.Indicator{
+				"evil.example":    ind,
+				"allowed.example": ind,
+			},
+		},
+	}, []Filter{{
+		ID:   rulelist.IDCustom,
+		Data: []byte("@@||allowed.example^\n"),
+	}})
+	t.Cleanup(d.Close)
+
+	t.Run("blocked", func(t *testing.T) {
+		res, err := d.CheckHost("evil.example", dns.TypeA, setts)
+		require.NoError(t, err)
+
+		assert.True(t, res.IsFiltered)
+		assert.Equal(t, FilteredBlockList, res.Reason)
+		assert.Same(t, ind, res.Threat)
+
+		require.Len(t, res.Rules, 1)
+
+		assert.Equal(t, rulelist.APIIDThreatFeed, res.Rules[0].FilterListID)
+		assert.Equal(t, "threat feed urlhaus: malware_download", res.Rules[0].Text)
+	})
+
+	t.Run("allowlisted", func(t *testing.T) {
+		res, err := d.CheckHost("allowed.example", dns.TypeA, setts)
+		require.NoError(t, err)
+
+		assert.False(t, res.IsFiltered)
+		assert.Nil(t, res.Threat)
+	})
+
+	t.Run("protection_disabled", func(t *testing.T) {
+		s := *setts
+		s.ProtectionEnabled = false
+
+		res, err := d.CheckHost("evil.example", dns.TypeA, &s)
+		require.NoError(t, err)
+
+		assert.False(t, res.IsFiltered)
+	})
+}
@@ -0,0 +1,302 @@
+package threatfeed
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// Format is the format of the data of a feed.
+type Format string
+
+// Valid formats.
+const (
+	// FormatHosts is the hosts-file format.  Each line contains an IP address
+	// followed by the hostnames, or a single hostname.
+	FormatHosts Format = "hosts"
+
+	// FormatURLhaus is the CSV format of the URLhaus database dumps.
+	FormatURLhaus Format = "urlhaus"
+
+	// FormatThreatFox is the CSV format of the ThreatFox IOC exports.
+	FormatThreatFox Format = "threatfox"
+
+	// FormatCSV is the custom CSV format.  Each record contains a hostname
+	// optionally followed by the category and the confidence.
+	FormatCSV Format = "csv"
+
+	// FormatSTIX is the STIX 2.1 bundle JSON format.  Only the indicators with
+	// the domain-name and url patterns are used.
+	FormatSTIX Format = "stix"
+)
+
+// validate returns an error if f is not a valid format.
+func (f Format) validate() (err error) {
+	switch f {
+	case FormatHosts, FormatURLhaus, FormatThreatFox, FormatCSV, FormatSTIX:
+		return nil
+	default:
+		return fmt.Errorf("%q: %w", f, errors.ErrBadEnumValue)
+	}
+}
+
+// The column indexes of the URLhaus CSV records.
+const (
+	urlhausColURL    = 2
+	urlhausColThreat = 5
+)
+
+// The column indexes of the ThreatFox CSV records.
+const (
+	threatfoxColValue      = 2
+	threatfoxColType       = 3
+	threatfoxColThreat     = 4
+	threatfoxColConfidence = 9
+)
+
+// stixPatternRe matches the domain-name and url comparisons of a STIX pattern.
+var stixPatternRe = regexp.MustCompile(`(domain-name|url):value\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// parser parses the data of a feed into indicators.
+type parser struct {
+	// feed is the configuration of the parsed feed.
+	feed *FeedConfig
+
+	// indicators are the parsed indicators by their hosts.
+	indicators map[string]*Indicator
+
+	// invalid is the number of skipped invalid indicators.
+	invalid int
+
+	// minConfidence is the minimum confidence of the indicators to keep.
+	minConfidence uint8
+}
+
+// parse parses the data from r in accordance with the format of the feed.
+func (p *parser) parse(r io.Reader) (err error) {
+	switch p.feed.Format {
+	case FormatHosts:
+		return p.parseHosts(r)
+	case FormatURLhaus:
+		return p.parseCSV(r, p.addURLhaus)
+	case FormatThreatFox:
+		return p.parseCSV(r, p.addThreatFox)
+	case FormatCSV:
+		return p.parseCSV(r, p.addCustom)
+	case FormatSTIX:
+		return p.parseSTIX(r)
+	default:
+		return fmt.Errorf("format: %q: %w", p.feed.Format, errors.ErrBadEnumValue)
+	}
+}
+
+// parseHosts parses the data in the hosts-file format.
+func (p *parser) parseHosts(r io.Reader) (err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			p.add(fields[0], "", "")
+		default:
+			if _, err = netip.ParseAddr(fields[0]); err != nil {
+				p.invalid++
+
+				continue
+			}
+
+			for _, host := range fields[1:] {
+				p.add(host, "", "")
+			}
+		}
+	}
+
+	return s.Err()
+}
+
+// parseCSV parses the CSV records from r and adds them using add.  The lines
+// starting with "#" are considered comments.
+func (p *parser) parseCSV(r io.Reader, add func(rec []string)) (err error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	for {
+		var rec []string
+		rec, err = cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		add(rec)
+	}
+}
+
+// addURLhaus adds the indicator from a URLhaus record.
+func (p *parser) addURLhaus(rec []string) {
+	if len(rec) <= urlhausColThreat {
+		p.invalid++
+
+		return
+	}
+
+	p.add(hostFromURL(rec[urlhausColURL]), rec[urlhausColThreat], "")
+}
+
+// addThreatFox adds the indicator from a ThreatFox record.  Only the domain and
+// url indicators are used.
+func (p *parser) addThreatFox(rec []string) {
+	if len(rec) <= threatfoxColConfidence {
+		p.invalid++
+
+		return
+	}
+
+	host := rec[threatfoxColValue]
+	switch rec[threatfoxColType] {
+	case "domain":
+		// Go on.
+	case "url":
+		host = hostFromURL(host)
+	default:
+		return
+	}
+
+	p.add(host, rec[threatfoxColThreat], rec[threatfoxColConfidence])
+}
+
+// addCustom adds the indicator from a custom CSV record.
+func (p *parser) addCustom(rec []string) {
+	host, category, confidence := rec[0], "", ""
+	if len(rec) > 1 {
+		category = rec[1]
+	}
+
+	if len(rec) > 2 {
+		confidence = rec[2]
+	}
+
+	p.add(host, category, confidence)
+}
+
+// stixBundle is the part of a STIX 2.1 bundle used by the parser.
+type stixBundle struct {
+	Objects []*stixObject `json:"objects"`
+}
+
+// stixObject is the part of a STIX 2.1 object used by the parser.
+type stixObject struct {
+	Confidence     *int     `json:"confidence"`
+	Type           string   `json:"type"`
+	Pattern        string   `json:"pattern"`
+	PatternType    string   `json:"pattern_type"`
+	IndicatorTypes []string `json:"indicator_types"`
+}
+
+// parseSTIX parses the data in the STIX 2.1 bundle format.
+func (p *parser) parseSTIX(r io.Reader) (err error) {
+	b := &stixBundle{}
+	err = json.NewDecoder(r).Decode(b)
+	if err != nil {
+		return fmt.Errorf("decoding bundle: %w", err)
+	}
+
+	for _, o := range b.Objects {
+		if o == nil || o.Type != "indicator" || (o.PatternType != "" && o.PatternType != "stix") {
+			continue
+		}
+
+		category := ""
+		if len(o.IndicatorTypes) > 0 {
+			category = o.IndicatorTypes[0]
+		}
+
+		confidence := ""
+		if o.Confidence != nil {
+			confidence = strconv.Itoa(*o.Confidence)
+		}
+
+		for _, m := range stixPatternRe.FindAllStringSubmatch(o.Pattern, -1) {
+			host := strings.ReplaceAll(m[2], `\'`, `'`)
+			if m[1] == "url" {
+				host = hostFromURL(host)
+			}
+
+			p.add(host, category, confidence)
+		}
+	}
+
+	return nil
+}
+
+// add validates and adds the indicator for host.  Empty category and
+// confidence are replaced with the ones of the feed.
+func (p *parser) add(host, category, confidence string) {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	if host == "" || netutil.ValidateHostname(host) != nil {
+		p.invalid++
+
+		return
+	} else if _, err := netip.ParseAddr(host); err == nil {
+		// IP addresses can't be matched against the requested hostnames.
+		return
+	}
+
+	ind := &Indicator{
+		Feed:       p.feed.Name,
+		Category:   strings.TrimSpace(category),
+		Confidence: p.feed.Confidence,
+	}
+
+	if ind.Category == "" {
+		ind.Category = p.feed.Category
+	}
+
+	if confidence = strings.TrimSpace(confidence); confidence != "" {
+		c, err := strconv.ParseUint(confidence, 10, 8)
+		if err != nil || uint8(c) > MaxConfidence {
+			p.invalid++
+
+			return
+		}
+
+		ind.Confidence = uint8(c)
+	}
+
+	if ind.Confidence < p.minConfidence {
+		return
+	}
+
+	if prev := p.indicators[host]; prev == nil || prev.Confidence < ind.Confidence {
+		p.indicators[host] = ind
+	}
+}
+
+// hostFromURL returns the hostname of the URL in s.  It returns an empty string
+// if s is not a valid URL.
+func hostFromURL(s string) (host string) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
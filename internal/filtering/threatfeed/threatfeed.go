@@ -0,0 +1,289 @@
+// Package threatfeed contains the storage of the indicators of compromise
+// pulled from the threat-intelligence feeds.
+package threatfeed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/service"
+	"github.com/c2h5oh/datasize"
+)
+
+// MaxConfidence is the maximum confidence of an indicator.
+const MaxConfidence uint8 = 100
+
+// DefaultMaxSize is the default maximum size of the data of a feed.
+const DefaultMaxSize = 64 * datasize.MB
+
+// Indicator is the indicator of compromise matching a host.
+type Indicator struct {
+	// Feed is the name of the feed, which has reported the indicator.
+	Feed string `json:"feed"`
+
+	// Category is the category of the threat, for example, "malware" or
+	// "botnet_cc".
+	Category string `json:"category,omitempty"`
+
+	// Confidence is the confidence of the feed in the indicator, from 0 to
+	// [MaxConfidence].
+	Confidence uint8 `json:"confidence"`
+}
+
+// FeedConfig is the configuration of a single threat-intelligence feed.
+type FeedConfig struct {
+	// Name is the name of the feed.  It must not be empty and must be unique.
+	Name string `yaml:"name"`
+
+	// URL is the HTTP(S) URL of the feed data.  It must not be empty.
+	URL string `yaml:"url"`
+
+	// Format is the format of the feed data.  It must be valid.
+	Format Format `yaml:"format"`
+
+	// Category is the category of the indicators of the feed, which don't
+	// have one.
+	Category string `yaml:"category"`
+
+	// Confidence is the confidence of the indicators of the feed, which don't
+	// have one.  It must not be greater than [MaxConfidence].
+	Confidence uint8 `yaml:"confidence"`
+
+	// Enabled defines if the feed is pulled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if c is invalid.  names are the names of the
+// previous feeds.
+func (c *FeedConfig) validate(names *container.MapSet[string]) (err error) {
+	switch {
+	case c == nil:
+		return errors.ErrNoValue
+	case c.Name == "":
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case names.Has(c.Name):
+		return fmt.Errorf("name: %q: %w", c.Name, errors.ErrDuplicated)
+	case c.Confidence > MaxConfidence:
+		return fmt.Errorf("confidence: %d: must not be greater than %d", c.Confidence, MaxConfidence)
+	}
+
+	err = c.Format.validate()
+	if err != nil {
+		return fmt.Errorf("format: %w", err)
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url: scheme: %q: %w", u.Scheme, errors.ErrBadEnumValue)
+	}
+
+	return nil
+}
+
+// Config is the configuration structure for [New].
+type Config struct {
+	// Logger is used for logging the operation of the storage.  It must not be
+	// nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used to pull the feeds.  It must not be nil.
+	HTTPClient *http.Client
+
+	// Feeds are the configurations of the feeds.  Disabled feeds are ignored.
+	Feeds []*FeedConfig
+
+	// MaxSize is the maximum size of the data of a feed.  If it's zero,
+	// [DefaultMaxSize] is used.
+	MaxSize datasize.ByteSize
+
+	// MinConfidence is the minimum confidence of the indicators to store.
+	MinConfidence uint8
+}
+
+// Storage contains the indicators of compromise of the enabled feeds.  It's
+// safe for concurrent use.
+type Storage struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+
+	// mu protects indicators and byFeed.
+	mu *sync.RWMutex
+
+	// indicators are the indicators of all feeds by their hosts.
+	indicators map[string]*Indicator
+
+	// byFeed are the indicators of each feed by their hosts.  The indicators
+	// of a feed are kept when the next pull fails.
+	byFeed map[string]map[string]*Indicator
+
+	feeds         []*FeedConfig
+	maxSize       uint64
+	minConfidence uint8
+}
+
+// New returns a new properly initialized *Storage.  c must not be nil.  The
+// storage is empty until the first refresh.
+func New(c *Config) (s *Storage, err error) {
+	names := container.NewMapSet[string]()
+	feeds := make([]*FeedConfig, 0, len(c.Feeds))
+	for i, f := range c.Feeds {
+		err = f.validate(names)
+		if err != nil {
+			return nil, fmt.Errorf("feed at index %d: %w", i, err)
+		}
+
+		names.Add(f.Name)
+		if f.Enabled {
+			feeds = append(feeds, f)
+		}
+	}
+
+	if c.MinConfidence > MaxConfidence {
+		return nil, fmt.Errorf(
+			"min_confidence: %d: must not be greater than %d",
+			c.MinConfidence,
+			MaxConfidence,
+		)
+	}
+
+	maxSize := c.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	return &Storage{
+		logger:        c.Logger,
+		httpClient:    c.HTTPClient,
+		mu:            &sync.RWMutex{},
+		indicators:    map[string]*Indicator{},
+		byFeed:        map[string]map[string]*Indicator{},
+		feeds:         feeds,
+		maxSize:       maxSize.Bytes(),
+		minConfidence: c.MinConfidence,
+	}, nil
+}
+
+// Match returns the indicator matching host or one of its parent domains.  ind
+// is nil if there is no such indicator.
+func (s *Storage) Match(host string) (ind *Indicator) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.indicators) == 0 {
+		return nil
+	}
+
+	for host != "" {
+		ind = s.indicators[host]
+		if ind != nil {
+			return ind
+		}
+
+		_, host, _ = strings.Cut(host, ".")
+	}
+
+	return nil
+}
+
+// type check
+var _ service.Refresher = (*Storage)(nil)
+
+// Refresh implements the [service.Refresher] interface for *Storage.  It pulls
+// all enabled feeds.  The indicators of the feeds, which fail to be pulled, are
+// kept.
+func (s *Storage) Refresh(ctx context.Context) (err error) {
+	var errs []error
+	byFeed := make(map[string]map[string]*Indicator, len(s.feeds))
+	for _, f := range s.feeds {
+		var inds map[string]*Indicator
+		inds, err = s.pull(ctx, f)
+		if err == nil {
+			byFeed[f.Name] = inds
+			s.logger.DebugContext(ctx, "pulled feed", "feed", f.Name, "indicators", len(inds))
+
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("feed %q: %w", f.Name, err))
+
+		s.mu.RLock()
+		byFeed[f.Name] = s.byFeed[f.Name]
+		s.mu.RUnlock()
+	}
+
+	indicators := merge(byFeed)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.byFeed, s.indicators = byFeed, indicators
+
+	s.logger.InfoContext(ctx, "refreshed threat feeds", "indicators", len(indicators))
+
+	return errors.Join(errs...)
+}
+
+// pull requests the data of the feed and parses it.
+func (s *Storage) pull(ctx context.Context, f *FeedConfig) (inds map[string]*Indicator, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+
+	// #nosec G704 -- Trust the URL explicitly given by the user.
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	p := &parser{
+		feed:          f,
+		indicators:    map[string]*Indicator{},
+		minConfidence: s.minConfidence,
+	}
+
+	err = p.parse(ioutil.LimitReader(resp.Body, s.maxSize))
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+
+	if p.invalid > 0 {
+		s.logger.DebugContext(ctx, "skipped invalid indicators", "feed", f.Name, "num", p.invalid)
+	}
+
+	return p.indicators, nil
+}
+
+// merge returns the indicators of all feeds.  If several feeds report the same
+// host, the indicator with the highest confidence is used.
+func merge(byFeed map[string]map[string]*Indicator) (indicators map[string]*Indicator) {
+	indicators = map[string]*Indicator{}
+	for _, inds := range byFeed {
+		for host, ind := range inds {
+			prev := indicators[host]
+			if prev == nil || ind.Confidence > prev.Confidence ||
+				(ind.Confidence == prev.Confidence && ind.Feed < prev.Feed) {
+				indicators[host] = ind
+			}
+		}
+	}
+
+	return indicators
+}
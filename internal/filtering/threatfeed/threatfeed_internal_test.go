@@ -0,0 +1,244 @@
+package threatfeed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+func TestParser_Parse(t *testing.T) {
+	testCases := []struct {
+		want   map[string]*Indicator
+		name   string
+		data   string
+		format Format
+	}{{
+		want: map[string]*Indicator{
+			"a.example": {Feed: "test", Category: "default", Confidence: 60},
+			"b.example": {Feed: "test", Category: "default", Confidence: 60},
+			"c.example": {Feed: "test", Category: "default", Confidence: 60},
+		},
+		name: "hosts",
+		data: "# comment\n" +
+			"0.0.0.0 a.example b.example # trailing\n" +
+			"C.example.\n" +
+			"bad_ip d.example\n" +
+			"127.0.0.1\n",
+		format: FormatHosts,
+	}, {
+		want: map[string]*Indicator{
+			"evil.example": {Feed: "test", Category: "malware_download", Confidence: 60},
+		},
+		name: "urlhaus",
+		data: `# id,dateadded,url,url_status,last_online,threat,tags,urlhaus_link,reporter` + "\n" +
+			`"1","2024-01-01 00:00:00","http://evil.example/x.exe","online","","malware_download","exe","https://urlhaus.example/1","r"` + "\n" +
+			`"2","2024-01-01 00:00:00","http://192.0.2.1/x.exe","online","","malware_download","exe","https://urlhaus.example/2","r"` + "\n",
+		format: FormatURLhaus,
+	}, {
+		want: map[string]*Indicator{
+			"cc.example":  {Feed: "test", Category: "botnet_cc", Confidence: 100},
+			"pay.example": {Feed: "test", Category: "payload_delivery", Confidence: 75},
+		},
+		name: "threatfox",
+		data: `# "first_seen_utc","ioc_id","ioc_value","ioc_type","threat_type","fk_malware","malware_alias","malware_printable","last_seen_utc","confidence_level","reference","tags","anonymous","reporter"` + "\n" +
+			`"2024-01-01 00:00:00", "1", "cc.example", "domain", "botnet_cc", "m", "", "M", "", "100", "", "", "0", "r"` + "\n" +
+			`"2024-01-01 00:00:00", "2", "https://pay.example/p", "url", "payload_delivery", "m", "", "M", "", "75", "", "", "0", "r"` + "\n" +
+			`"2024-01-01 00:00:00", "3", "192.0.2.1:443", "ip:port", "botnet_cc", "m", "", "M", "", "100", "", "", "0", "r"` + "\n" +
+			`"2024-01-01 00:00:00", "4", "low.example", "domain", "botnet_cc", "m", "", "M", "", "10", "", "", "0", "r"` + "\n",
+		format: FormatThreatFox,
+	}, {
+		want: map[string]*Indicator{
+			"a.example": {Feed: "test", Category: "default", Confidence: 60},
+			"b.example": {Feed: "test", Category: "phishing", Confidence: 60},
+			"c.example": {Feed: "test", Category: "phishing", Confidence: 90},
+		},
+		name: "csv",
+		data: "# host,category,confidence\n" +
+			"a.example\n" +
+			"b.example,phishing\n" +
+			"c.example,phishing,90\n" +
+			"d.example,phishing,200\n",
+		format: FormatCSV,
+	}, {
+		want: map[string]*Indicator{
+			"a.example": {Feed: "test", Category: "malicious-activity", Confidence: 85},
+			"b.example": {Feed: "test", Category: "malicious-activity", Confidence: 85},
+			"c.example": {Feed: "test", Category: "default", Confidence: 60},
+		},
+		name: "stix",
+		data: `{"type":"bundle","objects":[` +
+			`{"type":"indicator","pattern_type":"stix","confidence":85,` +
+			`"indicator_types":["malicious-activity"],` +
+			`"pattern":"[domain-name:value = 'a.example'] OR [url:value = 'http://b.example/x']"},` +
+			`{"type":"indicator","pattern":"[domain-name:value = 'c.example']"},` +
+			`{"type":"indicator","pattern_type":"sigma","pattern":"[domain-name:value = 'd.example']"},` +
+			`{"type":"malware","name":"m"}]}`,
+		format: FormatSTIX,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &parser{
+				feed: &FeedConfig{
+					Name:       "test",
+					Format:     tc.format,
+					Category:   "default",
+					Confidence: 60,
+				},
+				indicators:    map[string]*Indicator{},
+				minConfidence: 50,
+			}
+
+			err := p.parse(strings.NewReader(tc.data))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, p.indicators)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		feeds      []*FeedConfig
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		feeds: []*FeedConfig{{
+			Name:   "f",
+			URL:    "https://feed.example/list.csv",
+			Format: FormatCSV,
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "feed at index 0: no value",
+		feeds:      []*FeedConfig{nil},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "feed at index 0: name: empty value",
+		feeds:      []*FeedConfig{{URL: "https://feed.example", Format: FormatCSV}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `feed at index 1: name: "f": duplicated value`,
+		feeds: []*FeedConfig{{
+			Name:   "f",
+			URL:    "https://feed.example",
+			Format: FormatCSV,
+		}, {
+			Name:   "f",
+			URL:    "https://feed.example",
+			Format: FormatCSV,
+		}},
+	}, {
+		name:       "bad_format",
+		wantErrMsg: `feed at index 0: format: "xml": bad enum value`,
+		feeds: []*FeedConfig{{
+			Name:   "f",
+			URL:    "https://feed.example",
+			Format: "xml",
+		}},
+	}, {
+		name:       "bad_scheme",
+		wantErrMsg: `feed at index 0: url: scheme: "ftp": bad enum value`,
+		feeds: []*FeedConfig{{
+			Name:   "f",
+			URL:    "ftp://feed.example",
+			Format: FormatCSV,
+		}},
+	}, {
+		name:       "bad_confidence",
+		wantErrMsg: "feed at index 0: confidence: 101: must not be greater than 100",
+		feeds: []*FeedConfig{{
+			Name:       "f",
+			URL:        "https://feed.example",
+			Format:     FormatCSV,
+			Confidence: 101,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(&Config{
+				Logger:     slogutil.NewDiscardLogger(),
+				HTTPClient: http.DefaultClient,
+				Feeds:      tc.feeds,
+			})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestStorage_Refresh(t *testing.T) {
+	failing := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing && r.URL.Path == "/low" {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/low":
+			_, _ = w.Write([]byte("evil.example,malware,60\nlow.example,malware,60\n"))
+		case "/high":
+			_, _ = w.Write([]byte("evil.example,phishing,90\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := New(&Config{
+		Logger:     slogutil.NewDiscardLogger(),
+		HTTPClient: srv.Client(),
+		Feeds: []*FeedConfig{{
+			Name:    "low",
+			URL:     srv.URL + "/low",
+			Format:  FormatCSV,
+			Enabled: true,
+		}, {
+			Name:    "high",
+			URL:     srv.URL + "/high",
+			Format:  FormatCSV,
+			Enabled: true,
+		}, {
+			Name:    "disabled",
+			URL:     srv.URL + "/disabled",
+			Format:  FormatCSV,
+			Enabled: false,
+		}},
+	})
+	require.NoError(t, err)
+
+	assert.Nil(t, s.Match("evil.example"))
+
+	err = s.Refresh(testutil.ContextWithTimeout(t, testTimeout))
+	require.NoError(t, err)
+
+	assert.Equal(t, &Indicator{
+		Feed:       "high",
+		Category:   "phishing",
+		Confidence: 90,
+	}, s.Match("sub.Evil.example."))
+	assert.Nil(t, s.Match("example"))
+
+	failing = true
+	err = s.Refresh(testutil.ContextWithTimeout(t, testTimeout))
+	testutil.AssertErrorMsg(t, `feed "low": got status code 500, want 200`, err)
+
+	got := s.Match("low.example")
+	require.NotNil(t, got)
+
+	assert.Equal(t, "low", got.Feed)
+}
@@ -0,0 +1,258 @@
+package filtering
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// exceptionPrefix is the prefix of the exception filtering rules.
+const exceptionPrefix = "@@"
+
+// userRulesReplaceReq is the request for the POST
+// /control/filtering/user_rules/replace HTTP API.
+type userRulesReplaceReq struct {
+	// Rules are the new user rules.
+	Rules []string `json:"rules"`
+
+	// DryRun defines if the change is only computed and not applied.
+	DryRun bool `json:"dry_run"`
+}
+
+// userRulesPatchReq is the request for the POST
+// /control/filtering/user_rules/patch HTTP API.
+type userRulesPatchReq struct {
+	// Add are the rules to append to the user rules, unless they're already
+	// there.
+	Add []string `json:"add"`
+
+	// Remove are the rules to remove from the user rules.
+	Remove []string `json:"remove"`
+
+	// DryRun defines if the change is only computed and not applied.
+	DryRun bool `json:"dry_run"`
+}
+
+// userRulesChangeJSON is the response of the user rules bulk HTTP APIs.
+type userRulesChangeJSON struct {
+	// Added are the rules, which are added to the user rules.
+	Added []string `json:"added"`
+
+	// Removed are the rules, which are removed from the user rules.
+	Removed []string `json:"removed"`
+
+	// Invalid are the added rules with the syntax errors.  The change isn't
+	// applied if there are any.
+	Invalid []*invalidRuleJSON `json:"invalid"`
+
+	// Conflicts are the pairs of the blocking and the exception rules with the
+	// same pattern in the resulting user rules, at least one of which is
+	// added.
+	Conflicts []*ruleConflictJSON `json:"conflicts"`
+
+	// Applied is true if the change has been applied.
+	Applied bool `json:"applied"`
+}
+
+// invalidRuleJSON is a rule with a syntax error.
+type invalidRuleJSON struct {
+	// Rule is the text of the rule.
+	Rule string `json:"rule"`
+
+	// Error is the description of the syntax error.
+	Error string `json:"error"`
+}
+
+// ruleConflictJSON is a pair of the conflicting rules.
+type ruleConflictJSON struct {
+	// Rule is the added rule.
+	Rule string `json:"rule"`
+
+	// ConflictsWith is the rule in the resulting user rules, which has the
+	// same pattern but the opposite effect.
+	ConflictsWith string `json:"conflicts_with"`
+}
+
+// newUserRulesChange computes the change of the user rules from prev to next.
+func newUserRulesChange(prev, next []string) (c *userRulesChangeJSON) {
+	prevSet := container.NewMapSet(prev...)
+	nextSet := container.NewMapSet(next...)
+
+	c = &userRulesChangeJSON{
+		Added:     []string{},
+		Removed:   []string{},
+		Invalid:   []*invalidRuleJSON{},
+		Conflicts: []*ruleConflictJSON{},
+	}
+
+	added := container.NewMapSet[string]()
+	for _, text := range next {
+		if prevSet.Has(text) || added.Has(text) {
+			continue
+		}
+
+		added.Add(text)
+		c.Added = append(c.Added, text)
+
+		if err := validateUserRule(text); err != nil {
+			c.Invalid = append(c.Invalid, &invalidRuleJSON{
+				Rule:  text,
+				Error: err.Error(),
+			})
+		}
+	}
+
+	removed := container.NewMapSet[string]()
+	for _, text := range prev {
+		if !nextSet.Has(text) && !removed.Has(text) {
+			removed.Add(text)
+			c.Removed = append(c.Removed, text)
+		}
+	}
+
+	for _, text := range c.Added {
+		opposite, isException := oppositeRule(text)
+		if opposite == "" || !nextSet.Has(opposite) {
+			continue
+		}
+
+		// Report the conflicts between two added rules only once.
+		if isException && added.Has(opposite) {
+			continue
+		}
+
+		c.Conflicts = append(c.Conflicts, &ruleConflictJSON{
+			Rule:          text,
+			ConflictsWith: opposite,
+		})
+	}
+
+	return c
+}
+
+// validateUserRule returns an error if text isn't a valid user rule.
+func validateUserRule(text string) (err error) {
+	rule, _, err := parseRuleExpiry(text)
+	if err != nil {
+		return err
+	}
+
+	_, err = rules.NewRule(rule, rulelist.IDCustom)
+
+	return err
+}
+
+// oppositeRule returns the rule with the same pattern as text but with the
+// opposite effect.  isException is true if text is an exception rule.
+// opposite is empty if text isn't a rule.
+func oppositeRule(text string) (opposite string, isException bool) {
+	text = strings.TrimSpace(text)
+	if text == "" || text[0] == '!' || text[0] == '#' {
+		return "", false
+	}
+
+	pattern, isException := strings.CutPrefix(text, exceptionPrefix)
+	if isException {
+		return pattern, true
+	}
+
+	return exceptionPrefix + text, false
+}
+
+// patchUserRules returns the user rules with the rules from remove removed and
+// the rules from add appended, unless they're already there.
+func patchUserRules(prev, add, remove []string) (next []string) {
+	removeSet := container.NewMapSet(remove...)
+	next = slices.DeleteFunc(slices.Clone(prev), removeSet.Has)
+
+	nextSet := container.NewMapSet(next...)
+	for _, text := range add {
+		if !nextSet.Has(text) {
+			nextSet.Add(text)
+			next = append(next, text)
+		}
+	}
+
+	return next
+}
+
+// handleUserRulesReplace is the handler for the POST
+// /control/filtering/user_rules/replace HTTP API.
+func (d *DNSFilter) handleUserRulesReplace(w http.ResponseWriter, r *http.Request) {
+	req := &userRulesReplaceReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(r.Context(), d.logger, r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	next := slices.Clone(req.Rules)
+	d.changeUserRules(w, r, req.DryRun, func(_ []string) (n []string) { return next })
+}
+
+// handleUserRulesPatch is the handler for the POST
+// /control/filtering/user_rules/patch HTTP API.
+func (d *DNSFilter) handleUserRulesPatch(w http.ResponseWriter, r *http.Request) {
+	req := &userRulesPatchReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(r.Context(), d.logger, r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	d.changeUserRules(w, r, req.DryRun, func(prev []string) (next []string) {
+		return patchUserRules(prev, req.Add, req.Remove)
+	})
+}
+
+// changeUserRules atomically replaces the user rules with the ones returned by
+// update, unless dryRun is true or any of the added rules is invalid, and
+// writes the change into w.
+func (d *DNSFilter) changeUserRules(
+	w http.ResponseWriter,
+	r *http.Request,
+	dryRun bool,
+	update func(prev []string) (next []string),
+) {
+	ctx := r.Context()
+	l := d.logger
+
+	c := func() (c *userRulesChangeJSON) {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		next := update(d.conf.UserRules)
+		c = newUserRulesChange(d.conf.UserRules, next)
+		if dryRun || len(c.Invalid) > 0 || len(c.Added)+len(c.Removed) == 0 {
+			return c
+		}
+
+		d.conf.UserRules = next
+		c.Applied = true
+
+		return c
+	}()
+
+	if len(c.Invalid) > 0 {
+		aghhttp.WriteJSONResponse(ctx, l, w, r, http.StatusUnprocessableEntity, c)
+
+		return
+	}
+
+	if c.Applied {
+		l.DebugContext(ctx, "updated user rules", "added", len(c.Added), "removed", len(c.Removed))
+
+		d.conf.ConfModifier.Apply(ctx)
+		d.EnableFilters(true)
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, c)
+}
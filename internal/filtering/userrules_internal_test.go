@@ -0,0 +1,127 @@
+package filtering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUserRulesChange(t *testing.T) {
+	prev := []string{
+		"! comment",
+		"||blocked.example^",
+		"||removed.example^",
+	}
+	next := []string{
+		"! comment",
+		"||blocked.example^",
+		"@@||blocked.example^",
+		"||both.example^",
+		"@@||both.example^",
+		"||bad.example^$unknown",
+	}
+
+	c := newUserRulesChange(prev, next)
+
+	assert.Equal(t, []string{
+		"@@||blocked.example^",
+		"||both.example^",
+		"@@||both.example^",
+		"||bad.example^$unknown",
+	}, c.Added)
+	assert.Equal(t, []string{"||removed.example^"}, c.Removed)
+	assert.Equal(t, []*ruleConflictJSON{{
+		Rule:          "@@||blocked.example^",
+		ConflictsWith: "||blocked.example^",
+	}, {
+		Rule:          "||both.example^",
+		ConflictsWith: "@@||both.example^",
+	}}, c.Conflicts)
+
+	require.Len(t, c.Invalid, 1)
+
+	assert.Equal(t, "||bad.example^$unknown", c.Invalid[0].Rule)
+	assert.False(t, c.Applied)
+}
+
+func TestDNSFilter_handleUserRulesPatch(t *testing.T) {
+	applied := 0
+	confModifier := &aghtest.ConfigModifier{}
+	confModifier.OnApply = func(_ context.Context) {
+		applied++
+	}
+
+	d, err := New(&Config{
+		Logger:           testLogger,
+		FilteringEnabled: true,
+		UserRules:        []string{"||first.example^", "||second.example^"},
+		ConfModifier:     confModifier,
+		HTTPReg:          aghhttp.EmptyRegistrar{},
+		DataDir:          t.TempDir(),
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	d.Start()
+
+	patch := func(t *testing.T, req *userRulesPatchReq, wantCode int) (c *userRulesChangeJSON) {
+		t.Helper()
+
+		data, mErr := json.Marshal(req)
+		require.NoError(t, mErr)
+
+		r := httptest.NewRequest(http.MethodPost, "http://example.org", bytes.NewReader(data))
+		w := httptest.NewRecorder()
+
+		d.handleUserRulesPatch(w, r)
+		require.Equal(t, wantCode, w.Code)
+
+		c = &userRulesChangeJSON{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(c))
+
+		return c
+	}
+
+	t.Run("dry_run", func(t *testing.T) {
+		c := patch(t, &userRulesPatchReq{
+			Add:    []string{"||third.example^", "||first.example^"},
+			Remove: []string{"||second.example^"},
+			DryRun: true,
+		}, http.StatusOK)
+
+		assert.Equal(t, []string{"||third.example^"}, c.Added)
+		assert.Equal(t, []string{"||second.example^"}, c.Removed)
+		assert.False(t, c.Applied)
+		assert.Equal(t, 0, applied)
+		assert.Equal(t, []string{"||first.example^", "||second.example^"}, d.conf.UserRules)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		c := patch(t, &userRulesPatchReq{
+			Add: []string{"||bad.example^$unknown"},
+		}, http.StatusUnprocessableEntity)
+
+		assert.Len(t, c.Invalid, 1)
+		assert.False(t, c.Applied)
+		assert.Equal(t, 0, applied)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		c := patch(t, &userRulesPatchReq{
+			Add:    []string{"||third.example^"},
+			Remove: []string{"||second.example^"},
+		}, http.StatusOK)
+
+		assert.True(t, c.Applied)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, []string{"||first.example^", "||third.example^"}, d.conf.UserRules)
+	})
+}
@@ -0,0 +1,112 @@
+package fingerprint
+
+import (
+	"slices"
+	"strings"
+)
+
+// signature is the classification of the devices by a DHCP fingerprint.
+type signature struct {
+	// os is the operating system of the devices, if any.
+	os string
+
+	// typ is the type of the devices, if any.
+	typ Type
+}
+
+// vendorClassSignature is a signature matched by the prefix of the vendor
+// class identifier.
+type vendorClassSignature struct {
+	prefix string
+	signature
+}
+
+// vendorClassSignatures are the signatures of the well-known vendor class
+// identifiers.
+var vendorClassSignatures = []vendorClassSignature{{
+	prefix:    "MSFT ",
+	signature: signature{os: "Windows", typ: TypeComputer},
+}, {
+	prefix:    "android-dhcp-",
+	signature: signature{os: "Android", typ: TypeMobile},
+}, {
+	prefix:    "udhcp",
+	signature: signature{os: "Linux", typ: TypeIoT},
+}}
+
+// requestListSignature is a signature matched by the exact parameter request
+// list.
+type requestListSignature struct {
+	list []uint8
+	signature
+}
+
+// requestListSignatures are the signatures of the well-known parameter request
+// lists.
+var requestListSignatures = []requestListSignature{{
+	list:      []uint8{1, 121, 3, 6, 15, 119, 252},
+	signature: signature{os: "iOS", typ: TypeMobile},
+}, {
+	list:      []uint8{1, 121, 3, 6, 15, 114, 119, 252, 95, 44, 46},
+	signature: signature{os: "macOS", typ: TypeComputer},
+}, {
+	list:      []uint8{1, 121, 3, 6, 15, 119, 252, 95, 44, 46},
+	signature: signature{os: "macOS", typ: TypeComputer},
+}, {
+	list:      []uint8{1, 3, 6, 15, 31, 33, 43, 44, 46, 47, 119, 121, 249, 252},
+	signature: signature{os: "Windows", typ: TypeComputer},
+}, {
+	list:      []uint8{1, 15, 3, 6, 44, 46, 47, 31, 33, 121, 249, 43},
+	signature: signature{os: "Windows", typ: TypeComputer},
+}, {
+	list:      []uint8{1, 3, 6, 15, 26, 28, 51, 58, 59, 43},
+	signature: signature{os: "Android", typ: TypeMobile},
+}, {
+	list:      []uint8{1, 28, 2, 3, 15, 6, 119, 12, 44, 47, 26, 121, 42},
+	signature: signature{os: "Linux"},
+}}
+
+// matchDHCP returns the signature matching fp.  The vendor class identifier
+// takes precedence.  sig is empty if fp is nil or unknown.
+func matchDHCP(fp *DHCP) (sig signature) {
+	if fp == nil {
+		return signature{}
+	}
+
+	for _, s := range vendorClassSignatures {
+		if strings.HasPrefix(fp.VendorClass, s.prefix) {
+			return s.signature
+		}
+	}
+
+	if os := dhcpcdOS(fp.VendorClass); os != "" {
+		return signature{os: os}
+	}
+
+	for _, s := range requestListSignatures {
+		if slices.Equal(fp.ParameterRequestList, s.list) {
+			return s.signature
+		}
+	}
+
+	return signature{}
+}
+
+// dhcpcdOS returns the operating system from the vendor class identifier of
+// dhcpcd, which has the format "dhcpcd-<version>:<os>-<release>:<machine>:
+// <platform>".  os is empty if vc isn't such an identifier.
+func dhcpcdOS(vc string) (os string) {
+	rest, ok := strings.CutPrefix(vc, "dhcpcd-")
+	if !ok {
+		return ""
+	}
+
+	parts := strings.Split(rest, ":")
+	if len(parts) < 2 {
+		return ""
+	}
+
+	os, _, _ = strings.Cut(parts[1], "-")
+
+	return os
+}
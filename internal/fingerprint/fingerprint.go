@@ -0,0 +1,110 @@
+// Package fingerprint implements the classification of the devices by their
+// DHCP fingerprints and the vendor prefixes of their hardware addresses.
+package fingerprint
+
+import (
+	"cmp"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Type is the type of a device.
+type Type string
+
+// Supported device types.
+const (
+	TypeComputer Type = "computer"
+	TypeConsole  Type = "console"
+	TypeIoT      Type = "iot"
+	TypeMedia    Type = "media"
+	TypeMobile   Type = "mobile"
+	TypeNetwork  Type = "network"
+	TypePrinter  Type = "printer"
+)
+
+// DHCP is the fingerprint of a device from its DHCP requests.
+type DHCP struct {
+	// VendorClass is the vendor class identifier, DHCP option 60.
+	VendorClass string
+
+	// ParameterRequestList is the list of the requested options, DHCP option
+	// 55, in the requested order.
+	ParameterRequestList []uint8
+}
+
+// Clone returns a deep copy of fp.
+func (fp *DHCP) Clone() (c *DHCP) {
+	if fp == nil {
+		return nil
+	}
+
+	return &DHCP{
+		VendorClass:          fp.VendorClass,
+		ParameterRequestList: slices.Clone(fp.ParameterRequestList),
+	}
+}
+
+// String returns the parameter request list in the common comma-separated
+// format, for example "1,3,6,15".
+func (fp *DHCP) String() (s string) {
+	if fp == nil {
+		return ""
+	}
+
+	codes := make([]string, 0, len(fp.ParameterRequestList))
+	for _, c := range fp.ParameterRequestList {
+		codes = append(codes, strconv.Itoa(int(c)))
+	}
+
+	return strings.Join(codes, ",")
+}
+
+// Device is the classification of a device.  Any of the fields may be empty.
+type Device struct {
+	// Vendor is the manufacturer of the network interface of the device.
+	Vendor string `json:"vendor,omitempty"`
+
+	// OS is the operating system of the device.
+	OS string `json:"os,omitempty"`
+
+	// Type is the type of the device.
+	Type Type `json:"type,omitempty"`
+
+	// DHCPFingerprint is the DHCP parameter request list of the device in the
+	// format of [DHCP.String].
+	DHCPFingerprint string `json:"dhcp_fingerprint,omitempty"`
+}
+
+// Clone returns a deep copy of d.
+func (d *Device) Clone() (c *Device) {
+	if d == nil {
+		return nil
+	}
+
+	clone := *d
+
+	return &clone
+}
+
+// Classify returns the classification of the device with the hardware address
+// mac and the DHCP fingerprint fp.  fp may be nil.  d is nil if nothing is
+// known about the device.
+func Classify(mac net.HardwareAddr, fp *DHCP) (d *Device) {
+	vendor := lookupOUI(mac)
+	sig := matchDHCP(fp)
+
+	d = &Device{
+		Vendor:          vendor.name,
+		OS:              sig.os,
+		Type:            cmp.Or(sig.typ, vendor.typ),
+		DHCPFingerprint: fp.String(),
+	}
+
+	if *d == (Device{}) {
+		return nil
+	}
+
+	return d
+}
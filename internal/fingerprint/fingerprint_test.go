@@ -0,0 +1,88 @@
+package fingerprint_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	var (
+		macApple     = net.HardwareAddr{0xF0, 0x18, 0x98, 0x01, 0x02, 0x03}
+		macEspressif = net.HardwareAddr{0x24, 0x0A, 0xC4, 0x01, 0x02, 0x03}
+		macRandom    = net.HardwareAddr{0xAA, 0xBB, 0xCC, 0x01, 0x02, 0x03}
+	)
+
+	testCases := []struct {
+		want *fingerprint.Device
+		fp   *fingerprint.DHCP
+		name string
+		mac  net.HardwareAddr
+	}{{
+		want: nil,
+		fp:   nil,
+		name: "unknown",
+		mac:  macRandom,
+	}, {
+		want: &fingerprint.Device{
+			Vendor: "Espressif",
+			Type:   fingerprint.TypeIoT,
+		},
+		fp:   nil,
+		name: "oui",
+		mac:  macEspressif,
+	}, {
+		want: &fingerprint.Device{
+			Vendor:          "Apple",
+			OS:              "iOS",
+			Type:            fingerprint.TypeMobile,
+			DHCPFingerprint: "1,121,3,6,15,119,252",
+		},
+		fp: &fingerprint.DHCP{
+			ParameterRequestList: []uint8{1, 121, 3, 6, 15, 119, 252},
+		},
+		name: "request_list",
+		mac:  macApple,
+	}, {
+		want: &fingerprint.Device{
+			OS:              "Windows",
+			Type:            fingerprint.TypeComputer,
+			DHCPFingerprint: "1,3,6",
+		},
+		fp: &fingerprint.DHCP{
+			VendorClass:          "MSFT 5.0",
+			ParameterRequestList: []uint8{1, 3, 6},
+		},
+		name: "vendor_class",
+		mac:  macRandom,
+	}, {
+		want: &fingerprint.Device{
+			Vendor: "Espressif",
+			OS:     "Linux",
+			Type:   fingerprint.TypeIoT,
+		},
+		fp: &fingerprint.DHCP{
+			VendorClass: "dhcpcd-9.4.1:Linux-5.15.0:armv7l:BCM2835",
+		},
+		name: "dhcpcd",
+		mac:  macEspressif,
+	}, {
+		want: &fingerprint.Device{
+			DHCPFingerprint: "1,3",
+		},
+		fp: &fingerprint.DHCP{
+			VendorClass:          "dhcpcd-broken",
+			ParameterRequestList: []uint8{1, 3},
+		},
+		name: "unknown_fingerprint",
+		mac:  macRandom,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, fingerprint.Classify(tc.mac, tc.fp))
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package fingerprint
+
+import "net"
+
+// ouiLen is the length of an organizationally unique identifier.
+const ouiLen = 3
+
+// vendor is a manufacturer of network interfaces.
+type vendor struct {
+	// name is the human-readable name of the manufacturer.
+	name string
+
+	// typ is the type of most of the devices of the manufacturer, if any.
+	typ Type
+}
+
+// Well-known vendors.
+var (
+	vendorAmazon      = vendor{name: "Amazon", typ: TypeIoT}
+	vendorApple       = vendor{name: "Apple"}
+	vendorBrother     = vendor{name: "Brother", typ: TypePrinter}
+	vendorEspressif   = vendor{name: "Espressif", typ: TypeIoT}
+	vendorGoogle      = vendor{name: "Google"}
+	vendorIntel       = vendor{name: "Intel", typ: TypeComputer}
+	vendorMicrosoft   = vendor{name: "Microsoft"}
+	vendorNintendo    = vendor{name: "Nintendo", typ: TypeConsole}
+	vendorQEMU        = vendor{name: "QEMU", typ: TypeComputer}
+	vendorRaspberryPi = vendor{name: "Raspberry Pi", typ: TypeComputer}
+	vendorRoku        = vendor{name: "Roku", typ: TypeMedia}
+	vendorSamsung     = vendor{name: "Samsung"}
+	vendorSignify     = vendor{name: "Signify", typ: TypeIoT}
+	vendorSonos       = vendor{name: "Sonos", typ: TypeMedia}
+	vendorSony        = vendor{name: "Sony Interactive Entertainment", typ: TypeConsole}
+	vendorUbiquiti    = vendor{name: "Ubiquiti", typ: TypeNetwork}
+	vendorVMware      = vendor{name: "VMware", typ: TypeComputer}
+	vendorXiaomi      = vendor{name: "Xiaomi"}
+)
+
+// ouiVendors maps the organizationally unique identifiers to the vendors.  It
+// contains only a small set of the well-known identifiers.
+var ouiVendors = map[[ouiLen]byte]vendor{
+	{0x00, 0x03, 0x93}: vendorApple,
+	{0x00, 0x0A, 0x95}: vendorApple,
+	{0x00, 0x1B, 0x63}: vendorApple,
+	{0x00, 0x1E, 0xC2}: vendorApple,
+	{0x00, 0x25, 0x00}: vendorApple,
+	{0x28, 0xCF, 0xE9}: vendorApple,
+	{0x3C, 0x07, 0x54}: vendorApple,
+	{0xA4, 0x83, 0xE7}: vendorApple,
+	{0xAC, 0xBC, 0x32}: vendorApple,
+	{0xF0, 0x18, 0x98}: vendorApple,
+
+	{0x44, 0x65, 0x0D}: vendorAmazon,
+	{0x68, 0x54, 0xFD}: vendorAmazon,
+	{0x74, 0xC2, 0x46}: vendorAmazon,
+	{0xF0, 0x27, 0x2D}: vendorAmazon,
+
+	{0x00, 0x80, 0x77}: vendorBrother,
+	{0x30, 0x05, 0x5C}: vendorBrother,
+
+	{0x24, 0x0A, 0xC4}: vendorEspressif,
+	{0x24, 0x62, 0xAB}: vendorEspressif,
+	{0x30, 0xAE, 0xA4}: vendorEspressif,
+	{0x5C, 0xCF, 0x7F}: vendorEspressif,
+	{0x84, 0xF3, 0xEB}: vendorEspressif,
+	{0xA4, 0xCF, 0x12}: vendorEspressif,
+	{0xEC, 0xFA, 0xBC}: vendorEspressif,
+
+	{0x3C, 0x5A, 0xB4}: vendorGoogle,
+	{0x54, 0x60, 0x09}: vendorGoogle,
+	{0xF4, 0xF5, 0xD8}: vendorGoogle,
+	{0xF8, 0x8F, 0xCA}: vendorGoogle,
+
+	{0x3C, 0xA9, 0xF4}: vendorIntel,
+	{0xA0, 0x36, 0x9F}: vendorIntel,
+
+	{0x00, 0x15, 0x5D}: vendorMicrosoft,
+	{0x28, 0x18, 0x78}: vendorMicrosoft,
+	{0x7C, 0x1E, 0x52}: vendorMicrosoft,
+
+	{0x00, 0x09, 0xBF}: vendorNintendo,
+	{0x00, 0x17, 0xAB}: vendorNintendo,
+	{0x00, 0x1F, 0x32}: vendorNintendo,
+	{0x98, 0xB6, 0xE9}: vendorNintendo,
+
+	{0x52, 0x54, 0x00}: vendorQEMU,
+
+	{0x2C, 0xCF, 0x67}: vendorRaspberryPi,
+	{0xB8, 0x27, 0xEB}: vendorRaspberryPi,
+	{0xD8, 0x3A, 0xDD}: vendorRaspberryPi,
+	{0xDC, 0xA6, 0x32}: vendorRaspberryPi,
+	{0xE4, 0x5F, 0x01}: vendorRaspberryPi,
+
+	{0x08, 0x05, 0x81}: vendorRoku,
+	{0xB0, 0xA7, 0x37}: vendorRoku,
+	{0xCC, 0x6D, 0xA0}: vendorRoku,
+	{0xDC, 0x3A, 0x5E}: vendorRoku,
+
+	{0x00, 0x12, 0xFB}: vendorSamsung,
+	{0x00, 0x15, 0x99}: vendorSamsung,
+	{0x00, 0x16, 0x32}: vendorSamsung,
+
+	{0x00, 0x17, 0x88}: vendorSignify,
+	{0xEC, 0xB5, 0xFA}: vendorSignify,
+
+	{0x00, 0x0E, 0x58}: vendorSonos,
+	{0x48, 0xA6, 0xB8}: vendorSonos,
+	{0x5C, 0xAA, 0xFD}: vendorSonos,
+	{0x94, 0x9F, 0x3E}: vendorSonos,
+	{0xB8, 0xE9, 0x37}: vendorSonos,
+
+	{0x00, 0xD9, 0xD1}: vendorSony,
+	{0x70, 0x9E, 0x29}: vendorSony,
+	{0xBC, 0x60, 0xA7}: vendorSony,
+	{0xF8, 0x46, 0x1C}: vendorSony,
+
+	{0x04, 0x18, 0xD6}: vendorUbiquiti,
+	{0x24, 0xA4, 0x3C}: vendorUbiquiti,
+	{0x44, 0xD9, 0xE7}: vendorUbiquiti,
+	{0x68, 0x72, 0x51}: vendorUbiquiti,
+	{0x78, 0x8A, 0x20}: vendorUbiquiti,
+	{0x80, 0x2A, 0xA8}: vendorUbiquiti,
+	{0xDC, 0x9F, 0xDB}: vendorUbiquiti,
+	{0xF0, 0x9F, 0xC2}: vendorUbiquiti,
+	{0xFC, 0xEC, 0xDA}: vendorUbiquiti,
+
+	{0x00, 0x05, 0x69}: vendorVMware,
+	{0x00, 0x0C, 0x29}: vendorVMware,
+	{0x00, 0x50, 0x56}: vendorVMware,
+
+	{0x28, 0x6C, 0x07}: vendorXiaomi,
+	{0x50, 0xEC, 0x50}: vendorXiaomi,
+	{0x64, 0x09, 0x80}: vendorXiaomi,
+	{0x78, 0x11, 0xDC}: vendorXiaomi,
+	{0xF8, 0xA4, 0x5F}: vendorXiaomi,
+}
+
+// lookupOUI returns the vendor of the network interface with the hardware
+// address mac.  v is empty if the vendor is unknown, including the randomized
+// addresses.
+func lookupOUI(mac net.HardwareAddr) (v vendor) {
+	if len(mac) < ouiLen {
+		return vendor{}
+	}
+
+	return ouiVendors[[ouiLen]byte(mac)]
+}
@@ -0,0 +1,439 @@
+package home
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+)
+
+// apiScope is the scope of an API token, which defines the HTTP APIs available
+// with the token.
+type apiScope string
+
+// Valid API token scopes.
+const (
+	// apiScopeStatsRead allows reading the statistics and the status of the
+	// server.
+	apiScopeStatsRead apiScope = "stats:read"
+
+	// apiScopeQueryLogRead allows reading the query log.
+	apiScopeQueryLogRead apiScope = "querylog:read"
+
+	// apiScopeFilteringWrite allows reading and changing the filtering
+	// settings: the filter lists, the user rules, the blocked services, the
+	// rewrites, the safe browsing, the parental control, and the safe search.
+	apiScopeFilteringWrite apiScope = "filtering:write"
+
+	// apiScopeAdmin allows all HTTP APIs, including the management of the API
+	// tokens.
+	apiScopeAdmin apiScope = "admin"
+)
+
+// validate returns an error if s is not a valid API token scope.
+func (s apiScope) validate() (err error) {
+	switch s {
+	case apiScopeStatsRead, apiScopeQueryLogRead, apiScopeFilteringWrite, apiScopeAdmin:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", errors.ErrBadEnumValue, s)
+	}
+}
+
+// filteringPathPrefixes are the prefixes of the paths of the HTTP APIs allowed
+// by [apiScopeFilteringWrite].
+var filteringPathPrefixes = []string{
+	"/control/filtering/",
+	"/control/blocked_services/",
+	"/control/rewrite/",
+	"/control/safebrowsing/",
+	"/control/parental/",
+	"/control/safesearch/",
+}
+
+// allows returns true if s allows the request with the given method to the
+// HTTP API with path p.
+func (s apiScope) allows(method, p string) (ok bool) {
+	isGet := method == http.MethodGet
+
+	switch s {
+	case apiScopeStatsRead:
+		return isGet && (p == "/control/status" || strings.HasPrefix(p, "/control/stats"))
+	case apiScopeQueryLogRead:
+		return isGet && (strings.HasPrefix(p, "/control/querylog") || isActivityPath(p))
+	case apiScopeFilteringWrite:
+		return slices.ContainsFunc(filteringPathPrefixes, func(pref string) (has bool) {
+			return strings.HasPrefix(p, pref)
+		})
+	case apiScopeAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// isActivityPath returns true if p is the path of the client activity HTTP
+// API, GET /control/clients/{id}/activity.
+func isActivityPath(p string) (ok bool) {
+	id, ok := strings.CutPrefix(p, "/control/clients/")
+	if !ok {
+		return false
+	}
+
+	id, ok = strings.CutSuffix(id, "/activity")
+
+	return ok && id != "" && !strings.Contains(id, "/")
+}
+
+// apiTokenPrefix is the prefix of the API tokens, which makes them easier to
+// recognize, for example by secret scanners.
+const apiTokenPrefix = "agh_"
+
+// apiTokenLength is the length of the random part of an API token in bytes.
+const apiTokenLength = 32
+
+// apiToken is a long-lived token for accessing the HTTP API from scripts and
+// exporters.  Only the hash of the token is stored.
+type apiToken struct {
+	// Created is the time when the token has been created.
+	Created time.Time `yaml:"created"`
+
+	// lastUsed is the time when the token has been used last time since the
+	// start.  It isn't persisted.
+	lastUsed time.Time
+
+	// Name is the unique name of the token.  It must not be empty.
+	Name string `yaml:"name"`
+
+	// Hash is the hexadecimal SHA-256 hash of the token.
+	Hash string `yaml:"hash"`
+
+	// Scopes are the scopes of the token.  It must not be empty.
+	Scopes []apiScope `yaml:"scopes"`
+}
+
+// validate returns an error if t is invalid.
+func (t *apiToken) validate() (err error) {
+	switch {
+	case t == nil:
+		return errors.ErrNoValue
+	case t.Name == "":
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case len(t.Scopes) == 0:
+		return fmt.Errorf("scopes: %w", errors.ErrEmptyValue)
+	}
+
+	if _, err = hex.DecodeString(t.Hash); err != nil || len(t.Hash) != 2*sha256.Size {
+		return fmt.Errorf("hash: must be %d hexadecimal characters", 2*sha256.Size)
+	}
+
+	for i, s := range t.Scopes {
+		err = s.validate()
+		if err != nil {
+			return fmt.Errorf("scopes: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// allows returns true if any of the scopes of t allows the request with the
+// given method to the HTTP API with path p.
+func (t *apiToken) allows(method, p string) (ok bool) {
+	return slices.ContainsFunc(t.Scopes, func(s apiScope) (has bool) {
+		return s.allows(method, p)
+	})
+}
+
+// hashAPIToken returns the hexadecimal SHA-256 hash of the API token.
+func hashAPIToken(token string) (hash string) {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// apiTokens contains the API tokens.
+type apiTokens struct {
+	// mu protects tokens.
+	mu *sync.Mutex
+
+	// tokens are the API tokens sorted by name.
+	tokens []*apiToken
+}
+
+// newAPITokens validates tokens and returns a new properly initialized
+// *apiTokens with their copies.
+func newAPITokens(tokens []*apiToken) (ts *apiTokens, err error) {
+	ts = &apiTokens{
+		mu:     &sync.Mutex{},
+		tokens: make([]*apiToken, 0, len(tokens)),
+	}
+
+	for i, t := range tokens {
+		err = t.validate()
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		if ts.indexByName(t.Name) >= 0 {
+			return nil, fmt.Errorf("at index %d: duplicate name %q", i, t.Name)
+		}
+
+		c := *t
+		c.Scopes = slices.Clone(t.Scopes)
+		ts.tokens = append(ts.tokens, &c)
+	}
+
+	ts.sort()
+
+	return ts, nil
+}
+
+// sort sorts the tokens by name.  ts.mu must be locked, if ts is in use.
+func (ts *apiTokens) sort() {
+	slices.SortFunc(ts.tokens, func(a, b *apiToken) (res int) {
+		return cmp.Compare(a.Name, b.Name)
+	})
+}
+
+// indexByName returns the index of the token with the given name or -1 if
+// there is none.  ts.mu must be locked, if ts is in use.
+func (ts *apiTokens) indexByName(name string) (i int) {
+	return slices.IndexFunc(ts.tokens, func(t *apiToken) (ok bool) { return t.Name == name })
+}
+
+// add creates a new token with the given name and scopes and returns its
+// value, which isn't stored.
+func (ts *apiTokens) add(name string, scopes []apiScope, now time.Time) (token string, err error) {
+	b := make([]byte, apiTokenLength)
+
+	// Don't check the error, since [rand.Read] never fails.
+	_, _ = rand.Read(b)
+
+	token = apiTokenPrefix + hex.EncodeToString(b)
+	t := &apiToken{
+		Created: now,
+		Name:    name,
+		Hash:    hashAPIToken(token),
+		Scopes:  slices.Clone(scopes),
+	}
+
+	err = t.validate()
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return "", err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.indexByName(name) >= 0 {
+		return "", fmt.Errorf("name: token %q already exists", name)
+	}
+
+	ts.tokens = append(ts.tokens, t)
+	ts.sort()
+
+	return token, nil
+}
+
+// remove removes the token with the given name.  ok is false if there is no
+// such token.
+func (ts *apiTokens) remove(name string) (ok bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	i := ts.indexByName(name)
+	if i < 0 {
+		return false
+	}
+
+	ts.tokens = slices.Delete(ts.tokens, i, i+1)
+
+	return true
+}
+
+// find returns a copy of the token with the value token and updates the time
+// of its last usage to now.  ok is false if there is no such token.
+func (ts *apiTokens) find(token string, now time.Time) (t apiToken, ok bool) {
+	hash := []byte(hashAPIToken(token))
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, stored := range ts.tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(stored.Hash)) == 1 {
+			stored.lastUsed = now
+
+			return *stored, true
+		}
+	}
+
+	return apiToken{}, false
+}
+
+// list returns the copies of the tokens sorted by name.
+func (ts *apiTokens) list() (tokens []*apiToken) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	tokens = make([]*apiToken, 0, len(ts.tokens))
+	for _, t := range ts.tokens {
+		c := *t
+		c.Scopes = slices.Clone(t.Scopes)
+		tokens = append(tokens, &c)
+	}
+
+	return tokens
+}
+
+// bearerToken returns the token from the Authorization header of r with the
+// Bearer scheme, if any.
+func bearerToken(r *http.Request) (token string, ok bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get(httphdr.Authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+// apiTokenJSON is the API token in the HTTP API.
+type apiTokenJSON struct {
+	// Created is the time when the token has been created.
+	Created time.Time `json:"created"`
+
+	// LastUsed is the time when the token has been used last time since the
+	// start, if it has been used.
+	LastUsed *time.Time `json:"last_used,omitempty"`
+
+	// Name is the unique name of the token.
+	Name string `json:"name"`
+
+	// Token is the value of the token.  It's only returned on creation.
+	Token string `json:"token,omitempty"`
+
+	// Scopes are the scopes of the token.
+	Scopes []apiScope `json:"scopes"`
+}
+
+// apiTokensJSON is the response of the GET /control/api_tokens HTTP API.
+type apiTokensJSON struct {
+	// Tokens are the API tokens sorted by name.
+	Tokens []*apiTokenJSON `json:"tokens"`
+}
+
+// handleAPITokens is the handler for the GET /control/api_tokens HTTP API.
+func (web *webAPI) handleAPITokens(w http.ResponseWriter, r *http.Request) {
+	tokens := web.auth.apiTokens.list()
+	resp := &apiTokensJSON{
+		Tokens: make([]*apiTokenJSON, 0, len(tokens)),
+	}
+
+	for _, t := range tokens {
+		tj := &apiTokenJSON{
+			Created: t.Created,
+			Name:    t.Name,
+			Scopes:  t.Scopes,
+		}
+
+		if !t.lastUsed.IsZero() {
+			tj.LastUsed = &t.lastUsed
+		}
+
+		resp.Tokens = append(resp.Tokens, tj)
+	}
+
+	aghhttp.WriteJSONResponseOK(r.Context(), web.logger, w, r, resp)
+}
+
+// apiTokenAddJSON is the request of the POST /control/api_tokens/add HTTP API.
+type apiTokenAddJSON struct {
+	// Name is the unique name of the new token.
+	Name string `json:"name"`
+
+	// Scopes are the scopes of the new token.
+	Scopes []apiScope `json:"scopes"`
+}
+
+// handleAPITokenAdd is the handler for the POST /control/api_tokens/add HTTP
+// API.  The value of the token is only returned in the response.
+func (web *webAPI) handleAPITokenAdd(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := web.logger
+
+	req := &apiTokenAddJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	now := time.Now()
+	token, err := web.auth.apiTokens.add(req.Name, req.Scopes, now)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "adding api token: %s", err)
+
+		return
+	}
+
+	l.InfoContext(ctx, "added api token", "name", req.Name, "scopes", req.Scopes)
+
+	web.confModifier.Apply(ctx)
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, &apiTokenJSON{
+		Created: now,
+		Name:    req.Name,
+		Token:   token,
+		Scopes:  req.Scopes,
+	})
+}
+
+// apiTokenDeleteJSON is the request of the POST /control/api_tokens/delete
+// HTTP API.
+type apiTokenDeleteJSON struct {
+	// Name is the name of the token to delete.
+	Name string `json:"name"`
+}
+
+// handleAPITokenDelete is the handler for the POST /control/api_tokens/delete
+// HTTP API.
+func (web *webAPI) handleAPITokenDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := web.logger
+
+	req := &apiTokenDeleteJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	if !web.auth.apiTokens.remove(req.Name) {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "api token %q not found", req.Name)
+
+		return
+	}
+
+	l.InfoContext(ctx, "deleted api token", "name", req.Name)
+
+	web.confModifier.Apply(ctx)
+
+	aghhttp.OK(ctx, l, w)
+}
@@ -0,0 +1,339 @@
+package home
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIScope_allows(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scope  apiScope
+		method string
+		path   string
+		name   string
+		want   bool
+	}{{
+		scope:  apiScopeStatsRead,
+		method: http.MethodGet,
+		path:   "/control/stats",
+		name:   "stats_read",
+		want:   true,
+	}, {
+		scope:  apiScopeStatsRead,
+		method: http.MethodGet,
+		path:   "/control/status",
+		name:   "stats_status",
+		want:   true,
+	}, {
+		scope:  apiScopeStatsRead,
+		method: http.MethodPost,
+		path:   "/control/stats_reset",
+		name:   "stats_reset",
+		want:   false,
+	}, {
+		scope:  apiScopeStatsRead,
+		method: http.MethodGet,
+		path:   "/control/querylog",
+		name:   "stats_querylog",
+		want:   false,
+	}, {
+		scope:  apiScopeQueryLogRead,
+		method: http.MethodGet,
+		path:   "/control/querylog",
+		name:   "querylog_read",
+		want:   true,
+	}, {
+		scope:  apiScopeQueryLogRead,
+		method: http.MethodGet,
+		path:   "/control/clients/laptop/activity",
+		name:   "querylog_activity",
+		want:   true,
+	}, {
+		scope:  apiScopeQueryLogRead,
+		method: http.MethodGet,
+		path:   "/control/clients/laptop/other/activity",
+		name:   "querylog_bad_activity",
+		want:   false,
+	}, {
+		scope:  apiScopeQueryLogRead,
+		method: http.MethodPost,
+		path:   "/control/querylog_clear",
+		name:   "querylog_clear",
+		want:   false,
+	}, {
+		scope:  apiScopeFilteringWrite,
+		method: http.MethodPost,
+		path:   "/control/filtering/set_rules",
+		name:   "filtering_write",
+		want:   true,
+	}, {
+		scope:  apiScopeFilteringWrite,
+		method: http.MethodPut,
+		path:   "/control/blocked_services/update",
+		name:   "filtering_blocked_services",
+		want:   true,
+	}, {
+		scope:  apiScopeFilteringWrite,
+		method: http.MethodPost,
+		path:   "/control/dns_config",
+		name:   "filtering_dns_config",
+		want:   false,
+	}, {
+		scope:  apiScopeAdmin,
+		method: http.MethodPost,
+		path:   "/control/api_tokens/add",
+		name:   "admin",
+		want:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want, tc.scope.allows(tc.method, tc.path))
+		})
+	}
+}
+
+func TestNewAPITokens(t *testing.T) {
+	t.Parallel()
+
+	validHash := hashAPIToken("agh_test")
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		tokens     []*apiToken
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		tokens: []*apiToken{{
+			Name:   "exporter",
+			Hash:   validHash,
+			Scopes: []apiScope{apiScopeStatsRead},
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "at index 0: no value",
+		tokens:     []*apiToken{nil},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "at index 0: name: empty value",
+		tokens: []*apiToken{{
+			Hash:   validHash,
+			Scopes: []apiScope{apiScopeStatsRead},
+		}},
+	}, {
+		name:       "no_scopes",
+		wantErrMsg: "at index 0: scopes: empty value",
+		tokens: []*apiToken{{
+			Name: "exporter",
+			Hash: validHash,
+		}},
+	}, {
+		name:       "bad_hash",
+		wantErrMsg: "at index 0: hash: must be 64 hexadecimal characters",
+		tokens: []*apiToken{{
+			Name:   "exporter",
+			Hash:   "abc",
+			Scopes: []apiScope{apiScopeStatsRead},
+		}},
+	}, {
+		name:       "bad_scope",
+		wantErrMsg: `at index 0: scopes: at index 0: bad enum value: "stats:write"`,
+		tokens: []*apiToken{{
+			Name:   "exporter",
+			Hash:   validHash,
+			Scopes: []apiScope{"stats:write"},
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `at index 1: duplicate name "exporter"`,
+		tokens: []*apiToken{{
+			Name:   "exporter",
+			Hash:   validHash,
+			Scopes: []apiScope{apiScopeStatsRead},
+		}, {
+			Name:   "exporter",
+			Hash:   validHash,
+			Scopes: []apiScope{apiScopeAdmin},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newAPITokens(tc.tokens)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	t.Parallel()
+
+	ts, err := newAPITokens(nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+	token, err := ts.add("exporter", []apiScope{apiScopeStatsRead}, now)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(token, apiTokenPrefix))
+
+	_, err = ts.add("exporter", []apiScope{apiScopeAdmin}, now)
+	testutil.AssertErrorMsg(t, `name: token "exporter" already exists`, err)
+
+	_, err = ts.add("other", nil, now)
+	testutil.AssertErrorMsg(t, "scopes: empty value", err)
+
+	_, ok := ts.find("agh_unknown", now)
+	assert.False(t, ok)
+
+	found, ok := ts.find(token, now)
+	require.True(t, ok)
+
+	assert.Equal(t, "exporter", found.Name)
+	assert.Equal(t, now, found.lastUsed)
+
+	list := ts.list()
+	require.Len(t, list, 1)
+
+	assert.Equal(t, hashAPIToken(token), list[0].Hash)
+
+	assert.True(t, ts.remove("exporter"))
+	assert.False(t, ts.remove("exporter"))
+	assert.Empty(t, ts.list())
+}
+
+func TestAuthMiddlewareDefault_apiToken(t *testing.T) {
+	t.Parallel()
+
+	usersDB := newTestUsersDB()
+	usersDB.onAll = func(_ context.Context) (us []*aghuser.User, err error) {
+		return []*aghuser.User{{Login: "user_login"}}, nil
+	}
+
+	tokens, err := newAPITokens(nil)
+	require.NoError(t, err)
+
+	token, err := tokens.add("exporter", []apiScope{apiScopeStatsRead}, time.Now())
+	require.NoError(t, err)
+
+	mw := newAuthMiddlewareDefault(&authMiddlewareDefaultConfig{
+		logger:           testLogger,
+		rateLimiter:      emptyRateLimiter{},
+		tokenRateLimiter: emptyRateLimiter{},
+		sessions:         newTestSessionStorage(),
+		users:            usersDB,
+		apiTokens:        tokens,
+	})
+
+	testCases := []struct {
+		name       string
+		path       string
+		token      string
+		wantCode   int
+		wantCalled bool
+	}{{
+		name:       "allowed",
+		path:       "/control/stats",
+		token:      token,
+		wantCode:   http.StatusOK,
+		wantCalled: true,
+	}, {
+		name:       "forbidden",
+		path:       "/control/querylog",
+		token:      token,
+		wantCode:   http.StatusForbidden,
+		wantCalled: false,
+	}, {
+		name:       "invalid",
+		path:       "/control/stats",
+		token:      "agh_invalid",
+		wantCode:   http.StatusUnauthorized,
+		wantCalled: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.Header.Set(httphdr.Authorization, "Bearer "+tc.token)
+
+			h := &testAuthHandler{}
+			w := httptest.NewRecorder()
+			mw.Wrap(h).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Equal(t, tc.wantCalled, h.called)
+		})
+	}
+}
+
+func TestAuthMiddlewareDefault_apiTokenRateLimit(t *testing.T) {
+	t.Parallel()
+
+	usersDB := newTestUsersDB()
+	usersDB.onAll = func(_ context.Context) (us []*aghuser.User, err error) {
+		return []*aghuser.User{{Login: "user_login"}}, nil
+	}
+
+	tokens, err := newAPITokens(nil)
+	require.NoError(t, err)
+
+	token, err := tokens.add("exporter", []apiScope{apiScopeStatsRead}, time.Now())
+	require.NoError(t, err)
+
+	loginLimiter := newAuthRateLimiter(testLogger, time.Minute, time.Minute, 1)
+	tokenLimiter := newAuthRateLimiter(testLogger, time.Minute, time.Minute, 1)
+
+	mw := newAuthMiddlewareDefault(&authMiddlewareDefaultConfig{
+		logger:           testLogger,
+		rateLimiter:      loginLimiter,
+		tokenRateLimiter: tokenLimiter,
+		sessions:         newTestSessionStorage(),
+		users:            usersDB,
+		apiTokens:        tokens,
+	})
+
+	// clientIP is the address of the requests created by [httptest.NewRequest].
+	const clientIP = "192.0.2.1"
+
+	loginLimiter.inc(clientIP)
+	require.Positive(t, loginLimiter.check(clientIP))
+
+	serve := func(tok string) (code int) {
+		r := httptest.NewRequest(http.MethodGet, "/control/stats", nil)
+		r.Header.Set(httphdr.Authorization, "Bearer "+tok)
+
+		w := httptest.NewRecorder()
+		mw.Wrap(&testAuthHandler{}).ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(token))
+	assert.Positive(t, loginLimiter.check(clientIP))
+	assert.Zero(t, tokenLimiter.check(clientIP))
+
+	loginLimiter.remove(clientIP)
+
+	assert.Equal(t, http.StatusUnauthorized, serve("agh_invalid"))
+	assert.Zero(t, loginLimiter.check(clientIP))
+	assert.Equal(t, http.StatusTooManyRequests, serve(token))
+}
@@ -56,6 +56,10 @@ type authConfig struct {
 	// nil.
 	rateLimiter loginRateLimiter
 
+	// tokenRateLimiter manages the rate limiting for attempts to use API
+	// tokens.  It must not be nil.
+	tokenRateLimiter loginRateLimiter
+
 	// trustedProxies is a set of subnets considered as trusted.
 	trustedProxies netutil.SubnetSet
 
@@ -66,6 +70,17 @@ type authConfig struct {
 	// users contains web user information from the configuration file.
 	users []webUser
 
+	// apiTokens are the API tokens from the configuration file.
+	apiTokens []*apiToken
+
+	// oidc is the single sign-on through the identity provider.  It's nil if
+	// the single sign-on is disabled.
+	oidc *oidcAuth
+
+	// publicDashboard is the access to the read-only public dashboard.  It's
+	// nil if the public dashboard is disabled.
+	publicDashboard *publicDashboard
+
 	// sessionTTL is the TTL (Time To Live) for web user sessions.
 	sessionTTL time.Duration
 
@@ -81,6 +96,9 @@ type auth struct {
 	// rateLimiter manages rate limiting for login attempts.
 	rateLimiter loginRateLimiter
 
+	// tokenRateLimiter manages rate limiting for attempts to use API tokens.
+	tokenRateLimiter loginRateLimiter
+
 	// trustedProxies is a set of subnets considered trusted.
 	trustedProxies netutil.SubnetSet
 
@@ -90,12 +108,27 @@ type auth struct {
 	// users stores user credentials.
 	users aghuser.DB
 
+	// apiTokens stores the API tokens.
+	apiTokens *apiTokens
+
+	// oidc is the single sign-on through the identity provider.  It's nil if
+	// the single sign-on is disabled.
+	oidc *oidcAuth
+
+	// publicDashboard is the access to the read-only public dashboard.  It's
+	// nil if the public dashboard is disabled.
+	publicDashboard *publicDashboard
+
 	// isGLiNet indicates whether GLiNet mode is enabled.
 	isGLiNet bool
 
 	// isUserless indicates that there are no users defined in the configuration
 	// file.
 	isUserless bool
+
+	// isOIDCOnly indicates that the single sign-on is enabled and there are no
+	// users defined in the configuration file.
+	isOIDCOnly bool
 }
 
 // newAuth returns the new properly initialized *auth.
@@ -108,6 +141,11 @@ func newAuth(ctx context.Context, conf *authConfig) (a *auth, err error) {
 		}
 	}
 
+	tokens, err := newAPITokens(conf.apiTokens)
+	if err != nil {
+		return nil, fmt.Errorf("api tokens: %w", err)
+	}
+
 	s, err := aghuser.NewDefaultSessionStorage(ctx, &aghuser.DefaultSessionStorageConfig{
 		Logger:     conf.baseLogger.With(slogutil.KeyPrefix, "session_storage"),
 		Clock:      timeutil.SystemClock{},
@@ -120,13 +158,18 @@ func newAuth(ctx context.Context, conf *authConfig) (a *auth, err error) {
 	}
 
 	return &auth{
-		logger:         conf.baseLogger.With(slogutil.KeyPrefix, "auth"),
-		rateLimiter:    conf.rateLimiter,
-		trustedProxies: conf.trustedProxies,
-		sessions:       s,
-		users:          userDB,
-		isGLiNet:       conf.isGLiNet,
-		isUserless:     len(conf.users) == 0,
+		logger:           conf.baseLogger.With(slogutil.KeyPrefix, "auth"),
+		rateLimiter:      conf.rateLimiter,
+		tokenRateLimiter: conf.tokenRateLimiter,
+		trustedProxies:   conf.trustedProxies,
+		sessions:         s,
+		users:            userDB,
+		apiTokens:        tokens,
+		oidc:             conf.oidc,
+		publicDashboard:  conf.publicDashboard,
+		isGLiNet:         conf.isGLiNet,
+		isUserless:       len(conf.users) == 0 && conf.oidc == nil,
+		isOIDCOnly:       len(conf.users) == 0 && conf.oidc != nil,
 	}, nil
 }
 
@@ -143,15 +186,21 @@ func (a *auth) middleware() (mw httputil.Middleware) {
 	}
 
 	return newAuthMiddlewareDefault(&authMiddlewareDefaultConfig{
-		logger:         a.logger,
-		rateLimiter:    a.rateLimiter,
-		trustedProxies: a.trustedProxies,
-		sessions:       a.sessions,
-		users:          a.users,
+		logger:           a.logger,
+		rateLimiter:      a.rateLimiter,
+		tokenRateLimiter: a.tokenRateLimiter,
+		trustedProxies:   a.trustedProxies,
+		sessions:         a.sessions,
+		users:            a.users,
+		apiTokens:        a.apiTokens,
+		oidc:             a.oidc,
+		publicDashboard:  a.publicDashboard,
+		isOIDCOnly:       a.isOIDCOnly,
 	})
 }
 
-// usersList returns a copy of a users list.
+// usersList returns a copy of a users list.  The users logged in through the
+// identity provider aren't included.
 func (a *auth) usersList(ctx context.Context) (webUsers []webUser) {
 	users, err := a.users.All(ctx)
 	if err != nil {
@@ -161,6 +210,10 @@ func (a *auth) usersList(ctx context.Context) (webUsers []webUser) {
 
 	webUsers = make([]webUser, 0, len(users))
 	for _, u := range users {
+		if isOIDCUser(u) {
+			continue
+		}
+
 		webUsers = append(webUsers, webUser{
 			Name:         string(u.Login),
 			PasswordHash: string(u.Password.Hash()),
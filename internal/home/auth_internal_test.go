@@ -29,13 +29,14 @@ func TestAuth_UsersList(t *testing.T) {
 	}
 
 	auth, err := newAuth(testutil.ContextWithTimeout(t, testTimeout), &authConfig{
-		baseLogger:     testLogger,
-		rateLimiter:    emptyRateLimiter{},
-		trustedProxies: nil,
-		dbFilename:     sessionsDB,
-		users:          nil,
-		sessionTTL:     testTimeout,
-		isGLiNet:       false,
+		baseLogger:       testLogger,
+		rateLimiter:      emptyRateLimiter{},
+		tokenRateLimiter: emptyRateLimiter{},
+		trustedProxies:   nil,
+		dbFilename:       sessionsDB,
+		users:            nil,
+		sessionTTL:       testTimeout,
+		isGLiNet:         false,
 	})
 	require.NoError(t, err)
 
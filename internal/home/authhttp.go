@@ -210,6 +210,11 @@ func newCookie(
 		return nil, err
 	}
 
+	return sessionCookie(sess), nil
+}
+
+// sessionCookie returns a new authentication cookie for sess.
+func sessionCookie(sess *aghuser.Session) (c *http.Cookie) {
 	return &http.Cookie{
 		Name:     sessionCookieName,
 		Value:    hex.EncodeToString(sess.Token[:]),
@@ -217,7 +222,7 @@ func newCookie(
 		Expires:  time.Now().Add(cookieTTL),
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
-	}, nil
+	}
 }
 
 // handleLogout is the handler for the GET /control/logout HTTP API.
@@ -271,6 +276,14 @@ func (web *webAPI) registerAuthHandlers() {
 		web.postInstallHandler(http.HandlerFunc(web.handleLogin)),
 	)
 	web.httpReg.Register(http.MethodGet, "/control/logout", web.handleLogout)
+	web.httpReg.Register(http.MethodGet, "/control/api_tokens", web.handleAPITokens)
+	web.httpReg.Register(http.MethodPost, "/control/api_tokens/add", web.handleAPITokenAdd)
+	web.httpReg.Register(http.MethodPost, "/control/api_tokens/delete", web.handleAPITokenDelete)
+
+	if web.auth != nil && web.auth.oidc != nil {
+		web.httpReg.Register(http.MethodGet, oidcLoginPath, web.handleOIDCLogin)
+		web.httpReg.Register(http.MethodGet, oidcCallbackPath, web.handleOIDCCallback)
+	}
 }
 
 // isPublicResource returns true if p is a path to a public resource.
@@ -296,6 +309,8 @@ func isPublicResource(p string) (ok bool) {
 	paths := []string{
 		"/dns-query",
 		"/control/login",
+		oidcLoginPath,
+		oidcCallbackPath,
 		"/apple/doh.mobileconfig",
 		"/apple/dot.mobileconfig",
 		"/control/install/get_addresses",
@@ -322,6 +337,11 @@ type authMiddlewareDefaultConfig struct {
 	// rateLimiter manages the rate limiting for login attempts.
 	rateLimiter loginRateLimiter
 
+	// tokenRateLimiter manages the rate limiting for attempts to use API
+	// tokens.  It's kept apart from rateLimiter, so that a valid token doesn't
+	// lift the block of the login attempts.
+	tokenRateLimiter loginRateLimiter
+
 	// trustedProxies is a set of subnets considered as trusted.
 	//
 	// TODO(s.chzhen):  Use it not only to pass it to the middleware but also to
@@ -333,28 +353,54 @@ type authMiddlewareDefaultConfig struct {
 
 	// users contains web user information.  It must not be nil.
 	users aghuser.DB
+
+	// apiTokens contains the API tokens.  It must not be nil.
+	apiTokens *apiTokens
+
+	// oidc is the single sign-on through the identity provider.  It's nil if
+	// the single sign-on is disabled.
+	oidc *oidcAuth
+
+	// publicDashboard is the access to the read-only public dashboard.  It's
+	// nil if the public dashboard is disabled.
+	publicDashboard *publicDashboard
+
+	// isOIDCOnly is true if the single sign-on is enabled and there are no
+	// built-in users, so that the login page is replaced by the identity
+	// provider.
+	isOIDCOnly bool
 }
 
 // authMiddlewareDefault is the default authentication middleware.  It searches
 // for a web client using an authentication cookie or basic auth credentials and
 // passes it with the context.
 type authMiddlewareDefault struct {
-	logger         *slog.Logger
-	rateLimiter    loginRateLimiter
-	trustedProxies netutil.SubnetSet
-	sessions       aghuser.SessionStorage
-	users          aghuser.DB
+	logger           *slog.Logger
+	rateLimiter      loginRateLimiter
+	tokenRateLimiter loginRateLimiter
+	trustedProxies   netutil.SubnetSet
+	sessions         aghuser.SessionStorage
+	users            aghuser.DB
+	apiTokens        *apiTokens
+	oidc             *oidcAuth
+	publicDashboard  *publicDashboard
+	isOIDCOnly       bool
 }
 
 // newAuthMiddlewareDefault returns the new properly initialized
 // *authMiddlewareDefault.
 func newAuthMiddlewareDefault(c *authMiddlewareDefaultConfig) (mw *authMiddlewareDefault) {
 	return &authMiddlewareDefault{
-		logger:         c.logger,
-		rateLimiter:    c.rateLimiter,
-		trustedProxies: c.trustedProxies,
-		sessions:       c.sessions,
-		users:          c.users,
+		logger:           c.logger,
+		rateLimiter:      c.rateLimiter,
+		tokenRateLimiter: c.tokenRateLimiter,
+		trustedProxies:   c.trustedProxies,
+		sessions:         c.sessions,
+		users:            c.users,
+		apiTokens:        c.apiTokens,
+		oidc:             c.oidc,
+		publicDashboard:  c.publicDashboard,
+		isOIDCOnly:       c.isOIDCOnly,
 	}
 }
 
@@ -373,6 +419,12 @@ func (mw *authMiddlewareDefault) Wrap(h http.Handler) (wrapped http.Handler) {
 			return
 		}
 
+		if token, ok := bearerToken(r); ok {
+			mw.handleAPIToken(ctx, w, r, h, token)
+
+			return
+		}
+
 		path := r.URL.Path
 		if mw.handleAuthenticatedUser(ctx, w, r, h, path) {
 			return
@@ -402,6 +454,10 @@ func (mw *authMiddlewareDefault) handleAuthenticatedUser(
 
 	if u == nil {
 		return false
+	} else if isOIDCUser(u) && !mw.oidc.isLoggedIn(u.Login) {
+		// The roles of the users logged in through the identity provider
+		// aren't persisted, so such users must log in again.
+		return false
 	}
 
 	if path == "/login.html" {
@@ -410,11 +466,74 @@ func (mw *authMiddlewareDefault) handleAuthenticatedUser(
 		return true
 	}
 
+	if isOIDCUser(u) && !mw.oidc.allows(u.Login, r.Method, path) {
+		w.WriteHeader(http.StatusForbidden)
+
+		return true
+	}
+
 	h.ServeHTTP(w, r.WithContext(withWebUser(ctx, u)))
 
 	return true
 }
 
+// handleAPIToken authenticates the request with the API token and processes it
+// if the scopes of the token allow it.  Failed attempts are rate limited the
+// same way as the login attempts, but separately from them.  Successful
+// attempts don't reset the counter, so that a known token doesn't help to
+// guess the others.
+func (mw *authMiddlewareDefault) handleAPIToken(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	h http.Handler,
+	token string,
+) {
+	// The real IP address of the client [realIP] cannot be used here without
+	// taking trusted proxies into account due to security issues:
+	//
+	// See https://github.com/AdguardTeam/AdGuardHome/issues/2799.
+	remoteIP, err := netutil.SplitHost(r.RemoteAddr)
+	if err != nil {
+		mw.logger.ErrorContext(ctx, "getting remote address", slogutil.KeyError, err)
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	rateLimiter := mw.tokenRateLimiter
+	if left := rateLimiter.check(remoteIP); left > 0 {
+		w.Header().Set(httphdr.RetryAfter, strconv.Itoa(int(left.Seconds())))
+		w.WriteHeader(http.StatusTooManyRequests)
+
+		return
+	}
+
+	t, ok := mw.apiTokens.find(token, time.Now())
+	if !ok {
+		rateLimiter.inc(remoteIP)
+		mw.logger.InfoContext(ctx, "invalid api token", "remote_ip", remoteIP)
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	if !t.allows(r.Method, r.URL.Path) {
+		mw.logger.InfoContext(
+			ctx,
+			"api token scopes do not allow request",
+			"name", t.Name,
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+		w.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	h.ServeHTTP(w, r.WithContext(withAPIToken(ctx, t.Name)))
+}
+
 // handlePublicAccess handles request if user is trying to access public or root
 // pages.
 func (mw *authMiddlewareDefault) handlePublicAccess(
@@ -423,7 +542,14 @@ func (mw *authMiddlewareDefault) handlePublicAccess(
 	h http.Handler,
 	path string,
 ) (ok bool) {
-	if isPublicResource(path) {
+	if mw.isOIDCOnly && (path == "/" || path == "/index.html" || path == "/login.html") {
+		// There are no users, who could log in with the login page.
+		http.Redirect(w, r, oidcLoginPath, http.StatusFound)
+
+		return true
+	}
+
+	if isPublicResource(path) || mw.publicDashboard.allows(r) {
 		h.ServeHTTP(w, r)
 
 		return true
@@ -438,9 +564,13 @@ func (mw *authMiddlewareDefault) handlePublicAccess(
 	return false
 }
 
-// needsAuthentication returns true if there are stored web users and requests
-// should be authenticated first.
+// needsAuthentication returns true if there are stored web users or the single
+// sign-on is enabled and requests should be authenticated first.
 func (mw *authMiddlewareDefault) needsAuthentication(ctx context.Context) (ok bool) {
+	if mw.oidc != nil {
+		return true
+	}
+
 	users, err := mw.users.All(ctx)
 	if err != nil {
 		// Should not happen.
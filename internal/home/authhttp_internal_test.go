@@ -216,10 +216,11 @@ func TestAuthMiddlewareDefault(t *testing.T) {
 	}
 
 	mw := newAuthMiddlewareDefault(&authMiddlewareDefaultConfig{
-		logger:      testLogger,
-		rateLimiter: emptyRateLimiter{},
-		sessions:    ts,
-		users:       usersDB,
+		logger:           testLogger,
+		rateLimiter:      emptyRateLimiter{},
+		tokenRateLimiter: emptyRateLimiter{},
+		sessions:         ts,
+		users:            usersDB,
 	})
 
 	cookie := &http.Cookie{Name: sessionCookieName, Value: tokenHex}
@@ -465,13 +466,14 @@ func TestAuth_ServeHTTP_auth(t *testing.T) {
 	}}
 
 	auth, err := newAuth(testutil.ContextWithTimeout(t, testTimeout), &authConfig{
-		baseLogger:     testLogger,
-		rateLimiter:    emptyRateLimiter{},
-		trustedProxies: nil,
-		dbFilename:     sessionsDB,
-		users:          users,
-		sessionTTL:     testTTL * time.Second,
-		isGLiNet:       false,
+		baseLogger:       testLogger,
+		rateLimiter:      emptyRateLimiter{},
+		tokenRateLimiter: emptyRateLimiter{},
+		trustedProxies:   nil,
+		dbFilename:       sessionsDB,
+		users:            users,
+		sessionTTL:       testTTL * time.Second,
+		isGLiNet:         false,
 	})
 	require.NoError(t, err)
 
@@ -621,13 +623,14 @@ func TestAuth_ServeHTTP_logout(t *testing.T) {
 	}}
 
 	auth, err := newAuth(testutil.ContextWithTimeout(t, testTimeout), &authConfig{
-		baseLogger:     testLogger,
-		rateLimiter:    emptyRateLimiter{},
-		trustedProxies: nil,
-		dbFilename:     sessionsDB,
-		users:          users,
-		sessionTTL:     testTTL * time.Second,
-		isGLiNet:       false,
+		baseLogger:       testLogger,
+		rateLimiter:      emptyRateLimiter{},
+		tokenRateLimiter: emptyRateLimiter{},
+		trustedProxies:   nil,
+		dbFilename:       sessionsDB,
+		users:            users,
+		sessionTTL:       testTTL * time.Second,
+		isGLiNet:         false,
 	})
 	require.NoError(t, err)
 
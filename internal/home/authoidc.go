@@ -0,0 +1,406 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/oidc"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// Paths of the HTTP APIs of the single sign-on.
+const (
+	oidcLoginPath    = "/control/login/oidc"
+	oidcCallbackPath = "/control/login/oidc/callback"
+)
+
+// oidcFlowTTL is the time within which the user must complete the login at
+// the identity provider.
+const oidcFlowTTL = 10 * time.Minute
+
+// oidcMaxFlows is the maximum number of the pending logins.  It protects the
+// public login HTTP API from exhausting the memory.
+const oidcMaxFlows = 1000
+
+// oidcMaxClientFlows is the maximum number of the pending logins started by a
+// single client.  It prevents a single client from taking all of
+// [oidcMaxFlows].
+const oidcMaxClientFlows = 10
+
+// errTooManyFlows is returned by [oidcAuth.start] when there are too many
+// pending logins.
+const errTooManyFlows errors.Error = "too many pending logins"
+
+// oidcPassword is the [aghuser.Password] of the web users logged in through
+// the identity provider.  Such users can't log in with a password.
+type oidcPassword struct{}
+
+// type check
+var _ aghuser.Password = oidcPassword{}
+
+// Authenticate implements the [aghuser.Password] interface for oidcPassword.
+// It always returns false.
+func (oidcPassword) Authenticate(_ context.Context, _ string) (ok bool) { return false }
+
+// Hash implements the [aghuser.Password] interface for oidcPassword.  It always
+// returns nil.
+func (oidcPassword) Hash() (b []byte) { return nil }
+
+// isOIDCUser returns true if u has been logged in through the identity
+// provider.
+func isOIDCUser(u *aghuser.User) (ok bool) {
+	_, ok = u.Password.(oidcPassword)
+
+	return ok
+}
+
+// oidcPendingFlow is a login waiting for the callback from the identity
+// provider.
+type oidcPendingFlow struct {
+	expire time.Time
+	flow   *oidc.Flow
+
+	// client is the address of the client, which has started the login.
+	client string
+}
+
+// oidcAuth is the single sign-on to the web interface through an OpenID
+// Connect identity provider.
+type oidcAuth struct {
+	logger        *slog.Logger
+	provider      *oidc.Provider
+	clock         timeutil.Clock
+	groupRoles    map[string]apiScope
+	redirectURL   string
+	usernameClaim string
+	groupsClaim   string
+
+	// mu protects flows and roles.
+	mu *sync.Mutex
+
+	// flows are the pending logins by their states.
+	flows map[string]*oidcPendingFlow
+
+	// roles are the roles of the logged in users.  They aren't persisted, so
+	// the users log in again after a restart.
+	roles map[aghuser.Login][]apiScope
+}
+
+// newOIDCAuth returns a new properly initialized *oidcAuth.  c must be valid
+// and enabled.
+func newOIDCAuth(baseLogger *slog.Logger, c *oidcConfig) (a *oidcAuth, err error) {
+	u, err := url.Parse(c.IssuerURL)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	logger := baseLogger.With(slogutil.KeyPrefix, "oidc")
+	clock := timeutil.SystemClock{}
+
+	// Don't use the common HTTP client for the same reasons as in
+	// [newIdentitySource].
+	p, err := oidc.New(&oidc.Config{
+		Logger:       logger,
+		HTTPClient:   &http.Client{Timeout: time.Duration(c.Timeout)},
+		Clock:        clock,
+		IssuerURL:    u,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Scopes:       c.Scopes,
+	})
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	return &oidcAuth{
+		logger:        logger,
+		provider:      p,
+		clock:         clock,
+		groupRoles:    maps.Clone(c.GroupRoles),
+		redirectURL:   c.RedirectURL,
+		usernameClaim: c.UsernameClaim,
+		groupsClaim:   c.GroupsClaim,
+		mu:            &sync.Mutex{},
+		flows:         map[string]*oidcPendingFlow{},
+		roles:         map[aghuser.Login][]apiScope{},
+	}, nil
+}
+
+// start starts a new login for the client with the given address and returns
+// the URL of the identity provider to redirect the user agent to.
+func (a *oidcAuth) start(ctx context.Context, client string) (authURL string, err error) {
+	f := oidc.NewFlow()
+
+	authURL, err = a.provider.AuthURL(ctx, f, a.redirectURL)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return "", err
+	}
+
+	now := a.clock.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	maps.DeleteFunc(a.flows, func(_ string, pf *oidcPendingFlow) (del bool) {
+		return now.After(pf.expire)
+	})
+
+	if len(a.flows) >= oidcMaxFlows || a.clientFlowsLocked(client) >= oidcMaxClientFlows {
+		return "", errTooManyFlows
+	}
+
+	a.flows[f.State] = &oidcPendingFlow{
+		expire: now.Add(oidcFlowTTL),
+		flow:   f,
+		client: client,
+	}
+
+	return authURL, nil
+}
+
+// clientFlowsLocked returns the number of the pending logins started by the
+// client with the given address.  a.mu must be locked.
+func (a *oidcAuth) clientFlowsLocked(client string) (n int) {
+	for _, pf := range a.flows {
+		if pf.client == client {
+			n++
+		}
+	}
+
+	return n
+}
+
+// finish completes the login with the callback request r and returns the name
+// and the roles of the user.
+func (a *oidcAuth) finish(
+	ctx context.Context,
+	r *http.Request,
+) (login aghuser.Login, roles []apiScope, err error) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return "", nil, fmt.Errorf("identity provider: %s: %s", e, q.Get("error_description"))
+	}
+
+	state := q.Get("state")
+
+	a.mu.Lock()
+	pf, ok := a.flows[state]
+	delete(a.flows, state)
+	a.mu.Unlock()
+
+	if !ok || a.clock.Now().After(pf.expire) {
+		return "", nil, errors.Error("unknown or expired login")
+	}
+
+	c, err := a.provider.Exchange(ctx, pf.flow, q.Get("code"), a.redirectURL)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return "", nil, err
+	}
+
+	name, _ := c.String(a.usernameClaim)
+	login, err = aghuser.NewLogin(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("claim %q: %w", a.usernameClaim, err)
+	}
+
+	groups := c.Strings(a.groupsClaim)
+	roles = a.rolesOf(groups)
+	if len(roles) == 0 {
+		return "", nil, fmt.Errorf("user %q: no roles for groups %q", login, groups)
+	}
+
+	a.logger.InfoContext(ctx, "user authenticated", "user", login, "roles", roles)
+
+	return login, roles, nil
+}
+
+// setRoles sets the roles of the user with login, which has been logged in
+// through the identity provider.
+func (a *oidcAuth) setRoles(login aghuser.Login, roles []apiScope) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.roles[login] = roles
+}
+
+// rolesOf returns the sorted roles of a user with the given groups.
+func (a *oidcAuth) rolesOf(groups []string) (roles []apiScope) {
+	if len(a.groupRoles) == 0 {
+		return []apiScope{apiScopeAdmin}
+	}
+
+	for _, g := range groups {
+		if role, ok := a.groupRoles[g]; ok {
+			roles = append(roles, role)
+		}
+	}
+
+	slices.Sort(roles)
+
+	return slices.Compact(roles)
+}
+
+// isLoggedIn returns true if the user with login, which has been logged in
+// through the identity provider, has the recorded roles.  a may be nil, in
+// which case isLoggedIn returns false.
+func (a *oidcAuth) isLoggedIn(login aghuser.Login) (ok bool) {
+	if a == nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, ok = a.roles[login]
+
+	return ok
+}
+
+// allows returns true if the roles of the user with login, which has been
+// logged in through the identity provider, allow the request with the given
+// method to path p.  Such users are allowed the web interface itself and their
+// profiles, unless they have no recorded roles.  a may be nil, in which case
+// allows returns false.
+func (a *oidcAuth) allows(login aghuser.Login, method, p string) (ok bool) {
+	if a == nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	roles, ok := a.roles[login]
+	if !ok {
+		return false
+	}
+
+	if !strings.HasPrefix(p, "/control/") || p == "/control/profile" || p == "/control/logout" {
+		return true
+	}
+
+	return slices.ContainsFunc(roles, func(s apiScope) (has bool) {
+		return s.allows(method, p)
+	})
+}
+
+// handleOIDCLogin is the handler for the GET /control/login/oidc HTTP API.  It
+// redirects the user agent to the identity provider.
+func (web *webAPI) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// The real IP address of the client [realIP] cannot be used here without
+	// taking trusted proxies into account due to security issues:
+	//
+	// See https://github.com/AdguardTeam/AdGuardHome/issues/2799.
+	remoteIP, err := netutil.SplitHost(r.RemoteAddr)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, web.logger, r, w, http.StatusBadRequest, "oidc: %s", err)
+
+		return
+	}
+
+	authURL, err := web.auth.oidc.start(ctx, remoteIP)
+	if errors.Is(err, errTooManyFlows) {
+		w.Header().Set(httphdr.RetryAfter, strconv.Itoa(int(oidcFlowTTL.Seconds())))
+		aghhttp.ErrorAndLog(ctx, web.logger, r, w, http.StatusTooManyRequests, "oidc: %s", err)
+
+		return
+	} else if err != nil {
+		aghhttp.ErrorAndLog(ctx, web.logger, r, w, http.StatusBadGateway, "oidc: %s", err)
+
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleOIDCCallback is the handler for the GET /control/login/oidc/callback
+// HTTP API.  It creates the session of the user authenticated by the identity
+// provider.
+func (web *webAPI) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := web.logger
+
+	login, roles, err := web.auth.oidc.finish(ctx, r)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusForbidden, "oidc: %s", err)
+
+		return
+	}
+
+	u, err := web.auth.oidcUser(ctx, login)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusForbidden, "oidc: %s", err)
+
+		return
+	}
+
+	web.auth.oidc.setRoles(login, roles)
+
+	sess, err := web.auth.sessions.New(ctx, u)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "oidc: %s", err)
+
+		return
+	}
+
+	l.InfoContext(ctx, "successful oidc login", "user", login)
+
+	http.SetCookie(w, sessionCookie(sess))
+	w.Header().Set(httphdr.CacheControl, "no-store")
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// oidcUser returns the web user logged in through the identity provider,
+// creating it if necessary.  The built-in users can't be logged in this way.
+func (a *auth) oidcUser(ctx context.Context, login aghuser.Login) (u *aghuser.User, err error) {
+	u, err = a.users.ByLogin(ctx, login)
+	if err != nil {
+		return nil, fmt.Errorf("searching user by login %q: %w", login, err)
+	}
+
+	if u != nil {
+		if !isOIDCUser(u) {
+			return nil, fmt.Errorf("user %q is a built-in user", login)
+		}
+
+		return u, nil
+	}
+
+	id, err := aghuser.NewUserID()
+	if err != nil {
+		return nil, fmt.Errorf("generating user id: %w", err)
+	}
+
+	u = &aghuser.User{
+		Password: oidcPassword{},
+		Login:    login,
+		ID:       id,
+	}
+
+	err = a.users.Create(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("creating user %q: %w", login, err)
+	}
+
+	return u, nil
+}
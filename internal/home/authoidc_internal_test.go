@@ -0,0 +1,245 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOIDCAuth returns a new *oidcAuth with the given group roles for
+// tests.
+func newTestOIDCAuth(tb testing.TB, groupRoles map[string]apiScope) (a *oidcAuth) {
+	tb.Helper()
+
+	a, err := newOIDCAuth(testLogger, &oidcConfig{
+		GroupRoles:    groupRoles,
+		IssuerURL:     "https://idp.example",
+		RedirectURL:   "https://agh.example" + oidcCallbackPath,
+		ClientID:      "adguard-home",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		Timeout:       timeutil.Duration(time.Second),
+		Enabled:       true,
+	})
+	require.NoError(tb, err)
+
+	return a
+}
+
+func TestOIDCAuth_rolesOf(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no_mapping", func(t *testing.T) {
+		t.Parallel()
+
+		a := newTestOIDCAuth(t, nil)
+		assert.Equal(t, []apiScope{apiScopeAdmin}, a.rolesOf(nil))
+	})
+
+	t.Run("mapping", func(t *testing.T) {
+		t.Parallel()
+
+		a := newTestOIDCAuth(t, map[string]apiScope{
+			"noc":     apiScopeStatsRead,
+			"support": apiScopeQueryLogRead,
+			"viewers": apiScopeStatsRead,
+		})
+
+		assert.Equal(
+			t,
+			[]apiScope{apiScopeQueryLogRead, apiScopeStatsRead},
+			a.rolesOf([]string{"viewers", "support", "noc", "other"}),
+		)
+		assert.Empty(t, a.rolesOf([]string{"other"}))
+	})
+}
+
+func TestOIDCAuth_start(t *testing.T) {
+	t.Parallel()
+
+	var issuer string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(
+			w,
+			`{"issuer":%[1]q,"authorization_endpoint":"%[1]s/auth",`+
+				`"token_endpoint":"%[1]s/token","jwks_uri":"%[1]s/jwks"}`,
+			issuer,
+		)
+	}))
+	t.Cleanup(srv.Close)
+
+	issuer = srv.URL
+
+	a, err := newOIDCAuth(testLogger, &oidcConfig{
+		IssuerURL:     issuer,
+		RedirectURL:   "https://agh.example" + oidcCallbackPath,
+		ClientID:      "adguard-home",
+		UsernameClaim: "preferred_username",
+		Timeout:       timeutil.Duration(testTimeout),
+		Enabled:       true,
+	})
+	require.NoError(t, err)
+
+	const (
+		client      = "192.0.2.1"
+		otherClient = "192.0.2.2"
+	)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	for range oidcMaxClientFlows {
+		_, err = a.start(ctx, client)
+		require.NoError(t, err)
+	}
+
+	_, err = a.start(ctx, client)
+	assert.ErrorIs(t, err, errTooManyFlows)
+
+	authURL, err := a.start(ctx, otherClient)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(authURL, issuer+"/auth?"))
+}
+
+func TestAuthMiddlewareDefault_oidc(t *testing.T) {
+	t.Parallel()
+
+	const (
+		builtinLogin aghuser.Login = "admin"
+		oidcLogin    aghuser.Login = "alice"
+		noRolesLogin aghuser.Login = "bob"
+	)
+
+	users := map[aghuser.Login]*aghuser.User{
+		builtinLogin: {Login: builtinLogin},
+		oidcLogin:    {Login: oidcLogin, Password: oidcPassword{}},
+		noRolesLogin: {Login: noRolesLogin, Password: oidcPassword{}},
+	}
+
+	usersDB := newTestUsersDB()
+	usersDB.onByLogin = func(_ context.Context, login aghuser.Login) (u *aghuser.User, err error) {
+		return users[login], nil
+	}
+
+	builtinToken := aghuser.NewSessionToken()
+	oidcToken := aghuser.NewSessionToken()
+	noRolesToken := aghuser.NewSessionToken()
+	sessions := map[aghuser.SessionToken]*aghuser.Session{
+		builtinToken: {UserLogin: builtinLogin},
+		oidcToken:    {UserLogin: oidcLogin},
+		noRolesToken: {UserLogin: noRolesLogin},
+	}
+
+	ts := newTestSessionStorage()
+	ts.onFindByToken = func(
+		_ context.Context,
+		t aghuser.SessionToken,
+	) (s *aghuser.Session, err error) {
+		return sessions[t], nil
+	}
+
+	sso := newTestOIDCAuth(t, map[string]apiScope{"noc": apiScopeStatsRead})
+	sso.setRoles(oidcLogin, []apiScope{apiScopeStatsRead})
+
+	mw := newAuthMiddlewareDefault(&authMiddlewareDefaultConfig{
+		logger:           testLogger,
+		rateLimiter:      emptyRateLimiter{},
+		tokenRateLimiter: emptyRateLimiter{},
+		sessions:         ts,
+		users:            usersDB,
+		oidc:             sso,
+		isOIDCOnly:       true,
+	})
+
+	builtinCookie := sessionCookie(&aghuser.Session{Token: builtinToken})
+	oidcCookie := sessionCookie(&aghuser.Session{Token: oidcToken})
+	noRolesCookie := sessionCookie(&aghuser.Session{Token: noRolesToken})
+
+	testCases := []struct {
+		cookie       *http.Cookie
+		name         string
+		path         string
+		wantLocation string
+		wantCode     int
+	}{{
+		cookie:       nil,
+		name:         "no_auth_root",
+		path:         "/",
+		wantLocation: oidcLoginPath,
+		wantCode:     http.StatusFound,
+	}, {
+		cookie:       nil,
+		name:         "no_auth_login_page",
+		path:         "/login.html",
+		wantLocation: oidcLoginPath,
+		wantCode:     http.StatusFound,
+	}, {
+		cookie:       nil,
+		name:         "no_auth_sso",
+		path:         oidcLoginPath,
+		wantLocation: "",
+		wantCode:     http.StatusOK,
+	}, {
+		cookie:       oidcCookie,
+		name:         "oidc_allowed",
+		path:         "/control/stats",
+		wantLocation: "",
+		wantCode:     http.StatusOK,
+	}, {
+		cookie:       oidcCookie,
+		name:         "oidc_profile",
+		path:         "/control/profile",
+		wantLocation: "",
+		wantCode:     http.StatusOK,
+	}, {
+		cookie:       oidcCookie,
+		name:         "oidc_forbidden",
+		path:         "/control/querylog",
+		wantLocation: "",
+		wantCode:     http.StatusForbidden,
+	}, {
+		cookie:       noRolesCookie,
+		name:         "no_roles_root",
+		path:         "/",
+		wantLocation: oidcLoginPath,
+		wantCode:     http.StatusFound,
+	}, {
+		cookie:       noRolesCookie,
+		name:         "no_roles_api",
+		path:         "/control/querylog",
+		wantLocation: "",
+		wantCode:     http.StatusUnauthorized,
+	}, {
+		cookie:       builtinCookie,
+		name:         "builtin",
+		path:         "/control/querylog",
+		wantLocation: "",
+		wantCode:     http.StatusOK,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.cookie != nil {
+				r.AddCookie(tc.cookie)
+			}
+
+			w := httptest.NewRecorder()
+			mw.Wrap(&testAuthHandler{}).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Equal(t, tc.wantLocation, w.Header().Get("Location"))
+		})
+	}
+}
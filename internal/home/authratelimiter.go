@@ -1,6 +1,8 @@
 package home
 
 import (
+	"context"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -44,23 +46,42 @@ func (rl emptyRateLimiter) remove(_ string) {}
 // failedAuth is an entry of authRateLimiter's cache.
 type failedAuth struct {
 	until time.Time
-	num   uint
+
+	// forget is the moment after which the previous blocks of the attempter
+	// are forgotten.  It's zero if the attempter hasn't been blocked.
+	forget time.Time
+
+	num uint
+
+	// blocks is the number of the consecutive blocks of the attempter.
+	blocks uint
 }
 
 // authRateLimiter used to cache failed authentication attempts.
 type authRateLimiter struct {
+	logger      *slog.Logger
 	failedAuths map[string]failedAuth
 	// failedAuthsLock protects failedAuths.
 	failedAuthsLock sync.Mutex
 	blockDur        time.Duration
+	maxBlockDur     time.Duration
 	maxAttempts     uint
 }
 
-// newAuthRateLimiter returns properly initialized *authRateLimiter.
-func newAuthRateLimiter(blockDur time.Duration, maxAttempts uint) (ab *authRateLimiter) {
+// newAuthRateLimiter returns properly initialized *authRateLimiter.  The
+// duration of each consecutive block of the same attempter doubles, starting
+// from blockDur, until it reaches maxBlockDur.
+func newAuthRateLimiter(
+	logger *slog.Logger,
+	blockDur time.Duration,
+	maxBlockDur time.Duration,
+	maxAttempts uint,
+) (ab *authRateLimiter) {
 	return &authRateLimiter{
+		logger:      logger,
 		failedAuths: make(map[string]failedAuth),
 		blockDur:    blockDur,
+		maxBlockDur: maxBlockDur,
 		maxAttempts: maxAttempts,
 	}
 }
@@ -68,12 +89,22 @@ func newAuthRateLimiter(blockDur time.Duration, maxAttempts uint) (ab *authRateL
 // type check
 var _ loginRateLimiter = (*authRateLimiter)(nil)
 
-// cleanupLocked checks each blocked users removing ones with expired TTL.  For
-// internal use only.
+// cleanupLocked checks each blocked users removing ones with expired TTL.  The
+// attempters, which have been blocked recently, are kept with their numbers of
+// blocks, but their attempts are counted anew.  For internal use only.
 func (ab *authRateLimiter) cleanupLocked(now time.Time) {
 	for k, v := range ab.failedAuths {
-		if now.After(v.until) {
+		if !now.After(v.until) {
+			continue
+		}
+
+		if now.After(v.forget) {
 			delete(ab.failedAuths, k)
+		} else {
+			ab.failedAuths[k] = failedAuth{
+				forget: v.forget,
+				blocks: v.blocks,
+			}
 		}
 	}
 }
@@ -107,22 +138,40 @@ func (ab *authRateLimiter) check(usrID string) (left time.Duration) {
 // incLocked increments the number of unsuccessful attempts for attempter with
 // usrID and updates it's blocking moment if needed.  For internal use only.
 func (ab *authRateLimiter) incLocked(usrID string, now time.Time) {
-	until := now.Add(failedAuthTTL)
-	var attNum uint = 1
-
-	a, ok := ab.failedAuths[usrID]
-	if ok {
-		until = a.until
-		attNum = a.num + 1
+	a := ab.failedAuths[usrID]
+	if a.num == 0 {
+		a.until = now.Add(failedAuthTTL)
 	}
-	if attNum >= ab.maxAttempts {
-		until = now.Add(ab.blockDur)
+
+	a.num++
+	if a.num >= ab.maxAttempts {
+		a.blocks++
+		dur := ab.blockDuration(a.blocks)
+		a.until = now.Add(dur)
+		a.forget = a.until.Add(dur)
+
+		ab.logger.WarnContext(
+			context.TODO(),
+			"login attempts blocked",
+			"attempter", usrID,
+			"attempts", a.num,
+			"blocks", a.blocks,
+			"duration", dur,
+		)
 	}
 
-	ab.failedAuths[usrID] = failedAuth{
-		num:   attNum,
-		until: until,
+	ab.failedAuths[usrID] = a
+}
+
+// blockDuration returns the duration of the block with the given consecutive
+// number, which must be positive.
+func (ab *authRateLimiter) blockDuration(blocks uint) (dur time.Duration) {
+	dur = ab.blockDur
+	for i := uint(1); i < blocks && dur < ab.maxBlockDur; i++ {
+		dur *= 2
 	}
+
+	return max(min(dur, ab.maxBlockDur), ab.blockDur)
 }
 
 // inc implements the [loginRateLimiter] interface for *authRateLimiter.
@@ -161,6 +161,7 @@ func TestAuthRateLimiter_Inc(t *testing.T) {
 			},
 		}
 		ab := &authRateLimiter{
+			logger:      testLogger,
 			blockDur:    blockDur,
 			maxAttempts: maxAtt,
 			failedAuths: failedAuths,
@@ -178,6 +179,7 @@ func TestAuthRateLimiter_Inc(t *testing.T) {
 
 	t.Run("non-existent", func(t *testing.T) {
 		ab := &authRateLimiter{
+			logger:      testLogger,
 			blockDur:    blockDur,
 			maxAttempts: maxAtt,
 			failedAuths: map[string]failedAuth{},
@@ -191,6 +193,56 @@ func TestAuthRateLimiter_Inc(t *testing.T) {
 	})
 }
 
+func TestAuthRateLimiter_exponential(t *testing.T) {
+	const (
+		key         = "some-key"
+		maxAtt      = 2
+		blockDur    = 15 * time.Minute
+		maxBlockDur = time.Hour
+	)
+
+	ab := newAuthRateLimiter(testLogger, blockDur, maxBlockDur, maxAtt)
+
+	// block makes the attempter blocked and returns the duration of the block.
+	block := func(t *testing.T) (dur time.Duration) {
+		t.Helper()
+
+		for range maxAtt {
+			require.LessOrEqual(t, ab.check(key), time.Duration(0))
+
+			ab.inc(key)
+		}
+
+		left := ab.check(key)
+		require.Positive(t, left)
+
+		// Expire the block without forgetting it.
+		ab.failedAuthsLock.Lock()
+		defer ab.failedAuthsLock.Unlock()
+
+		a := ab.failedAuths[key]
+		a.until = time.Now().Add(-time.Second)
+		ab.failedAuths[key] = a
+
+		return left
+	}
+
+	assert.InDelta(t, blockDur, block(t), float64(time.Second))
+	assert.InDelta(t, 2*blockDur, block(t), float64(time.Second))
+	assert.InDelta(t, maxBlockDur, block(t), float64(time.Second))
+	assert.InDelta(t, maxBlockDur, block(t), float64(time.Second))
+
+	t.Run("forget", func(t *testing.T) {
+		ab.failedAuthsLock.Lock()
+		a := ab.failedAuths[key]
+		a.forget = time.Now().Add(-time.Second)
+		ab.failedAuths[key] = a
+		ab.failedAuthsLock.Unlock()
+
+		assert.InDelta(t, blockDur, block(t), float64(time.Second))
+	})
+}
+
 func TestAuthRateLimiter_Remove(t *testing.T) {
 	const key = "some-key"
 
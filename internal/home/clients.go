@@ -14,14 +14,20 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/discovery"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+	"github.com/AdguardTeam/AdGuardHome/internal/identity"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/router"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/AdGuardHome/internal/vpn"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/AdguardTeam/urlfilter/rules"
 )
 
 // clientsContainer is the storage of all runtime and persistent clients.
@@ -41,6 +47,10 @@ type clientsContainer struct {
 	// settings.
 	clientChecker BlockedClientChecker
 
+	// allowlistLearner provides the domain names learned for the allowlists of
+	// the persistent clients.
+	allowlistLearner AllowlistLearner
+
 	// confModifier is used to update the global configuration.  It must not be
 	// nil.
 	confModifier agh.ConfigModifier
@@ -70,6 +80,18 @@ type BlockedClientChecker interface {
 	IsBlockedClient(ip netip.Addr, clientID string) (blocked bool, rule string)
 }
 
+// AllowlistLearner provides the allowlist learning sessions of the persistent
+// clients.
+type AllowlistLearner interface {
+	// AllowlistLearning returns the allowlist learning session for the
+	// persistent client with the given name.  sess is nil if there is none.
+	AllowlistLearning(client string) (sess *dnsforward.AllowlistLearning)
+
+	// RemoveAllowlistLearning removes the allowlist learning session for the
+	// persistent client with the given name, if any.
+	RemoveAllowlistLearning(client string)
+}
+
 // Init initializes the clients container.  All arguments must not be nil except
 // for objects.
 //
@@ -83,6 +105,11 @@ func (clients *clientsContainer) Init(
 	dhcpServer client.DHCP,
 	etcHosts *aghnet.HostsContainer,
 	arpDB arpdb.Interface,
+	arpWatcher arpdb.Watcher,
+	disc discovery.Interface,
+	rtr router.Interface,
+	vpnPeers vpn.Interface,
+	ids identity.Interface,
 	filteringConf *filtering.Config,
 	sigHdlr *signalHandler,
 	confModifier agh.ConfigModifier,
@@ -130,8 +157,22 @@ func (clients *clientsContainer) Init(
 		DHCP:                   dhcpServer,
 		EtcHosts:               hosts,
 		ARPDB:                  arpDB,
-		ARPClientsUpdatePeriod: arpClientsUpdatePeriod,
+		ARPWatcher:             arpWatcher,
+		ARPClientsUpdatePeriod: time.Duration(config.Clients.ARPRefreshInterval),
+		ARPWatchDelay:          arpWatchDelay,
+		Discovery:              disc,
+		DiscoveryUpdatePeriod:  discoveryUpdatePeriod,
+		Router:                 rtr,
+		RouterUpdatePeriod:     routerUpdatePeriod(config.Clients.Router),
+		VPN:                    vpnPeers,
+		VPNUpdatePeriod:        vpnUpdatePeriod(config.Clients.VPN),
 		RuntimeSourceDHCP:      config.Clients.Sources.DHCP,
+		TagUpstreams:           config.Clients.TagUpstreams,
+		TagProtection:          config.Clients.TagProtection,
+		Groups:                 config.Clients.Groups,
+		TagRules:               config.Clients.TagRules,
+		Identity:               ids,
+		IdentityGroups:         identityGroups(config.Clients.Identity),
 	})
 	if err != nil {
 		return fmt.Errorf("init client storage: %w", err)
@@ -169,10 +210,16 @@ type clientObject struct {
 
 	Name string `yaml:"name"`
 
+	// Group is the name of the group of the client, if any.
+	Group string `yaml:"group,omitempty"`
+
 	IDs       []string `yaml:"ids"`
 	Tags      []string `yaml:"tags"`
 	Upstreams []string `yaml:"upstreams"`
 
+	// BootstrapDNS are the custom bootstrap DNS servers for the upstreams.
+	BootstrapDNS []string `yaml:"bootstrap_dns"`
+
 	// UID is the unique identifier of the persistent client.
 	UID client.UID `yaml:"uid"`
 
@@ -190,6 +237,18 @@ type clientObject struct {
 	SafeBrowsingEnabled      bool `yaml:"safebrowsing_enabled"`
 	UseGlobalBlockedServices bool `yaml:"use_global_blocked_services"`
 
+	// FilterListIDs are the IDs of the blocklists applied to the requests of
+	// the client.  If empty, all enabled blocklists are applied.
+	FilterListIDs []rules.ListID `yaml:"filter_list_ids"`
+
+	// Allowlist are the domain names the client may resolve in the
+	// allowlist-only mode.
+	Allowlist []string `yaml:"allowlist"`
+
+	// AllowlistOnly defines if the client may only resolve the domain names
+	// from Allowlist and their subdomains.
+	AllowlistOnly bool `yaml:"allowlist_only"`
+
 	IgnoreQueryLog   bool `yaml:"ignore_querylog"`
 	IgnoreStatistics bool `yaml:"ignore_statistics"`
 }
@@ -202,9 +261,11 @@ func (o *clientObject) toPersistent(
 	safeSearchCacheTTL time.Duration,
 ) (cli *client.Persistent, err error) {
 	cli = &client.Persistent{
-		Name: o.Name,
+		Name:  o.Name,
+		Group: o.Group,
 
-		Upstreams: o.Upstreams,
+		Upstreams:    o.Upstreams,
+		BootstrapDNS: o.BootstrapDNS,
 
 		UID: o.UID,
 
@@ -214,6 +275,9 @@ func (o *clientObject) toPersistent(
 		SafeSearchConf:        o.SafeSearchConf,
 		SafeBrowsingEnabled:   o.SafeBrowsingEnabled,
 		UseOwnBlockedServices: !o.UseGlobalBlockedServices,
+		FilterListIDs:         slices.Clone(o.FilterListIDs),
+		Allowlist:             slices.Clone(o.Allowlist),
+		AllowlistOnly:         o.AllowlistOnly,
 		IgnoreQueryLog:        o.IgnoreQueryLog,
 		IgnoreStatistics:      o.IgnoreStatistics,
 		UpstreamsCacheEnabled: o.UpstreamsCacheEnabled,
@@ -280,7 +344,8 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 	objs = make([]*clientObject, 0, clients.storage.Size())
 	clients.storage.RangeByName(func(cli *client.Persistent) (cont bool) {
 		objs = append(objs, &clientObject{
-			Name: cli.Name,
+			Name:  cli.Name,
+			Group: cli.Group,
 
 			BlockedServices: cli.BlockedServices.Clone(),
 
@@ -288,6 +353,8 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 			Tags:      slices.Clone(cli.Tags),
 			Upstreams: slices.Clone(cli.Upstreams),
 
+			BootstrapDNS: slices.Clone(cli.BootstrapDNS),
+
 			UID: cli.UID,
 
 			UseGlobalSettings:        !cli.UseOwnSettings,
@@ -296,6 +363,9 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 			SafeSearchConf:           cli.SafeSearchConf,
 			SafeBrowsingEnabled:      cli.SafeBrowsingEnabled,
 			UseGlobalBlockedServices: !cli.UseOwnBlockedServices,
+			FilterListIDs:            slices.Clone(cli.FilterListIDs),
+			Allowlist:                slices.Clone(cli.Allowlist),
+			AllowlistOnly:            cli.AllowlistOnly,
 			IgnoreQueryLog:           cli.IgnoreQueryLog,
 			IgnoreStatistics:         cli.IgnoreStatistics,
 			UpstreamsCacheEnabled:    cli.UpstreamsCacheEnabled,
@@ -308,8 +378,42 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 	return objs
 }
 
-// arpClientsUpdatePeriod defines how often ARP clients are updated.
-const arpClientsUpdatePeriod = 10 * time.Minute
+// identityGroups returns the mapping of the directory groups to the client
+// groups from conf, if the identity source is enabled.
+func identityGroups(conf *clientIdentityConfig) (groups map[string]string) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	return conf.Groups
+}
+
+// arpWatchDelay is the delay between the first reported change of the network
+// neighborhood and the refreshing of ARP clients.
+const arpWatchDelay = 1 * time.Second
+
+// routerUpdatePeriod returns how often the clients are requested from the
+// upstream router configured by conf, if it's enabled.
+func routerUpdatePeriod(conf *clientRouterConfig) (ivl time.Duration) {
+	if conf == nil || !conf.Enabled {
+		return 0
+	}
+
+	return time.Duration(conf.RefreshInterval)
+}
+
+// vpnUpdatePeriod returns how often the peers are read from the VPN configured
+// by conf, if it's enabled.
+func vpnUpdatePeriod(conf *clientVPNConfig) (ivl time.Duration) {
+	if conf == nil || !conf.Enabled {
+		return 0
+	}
+
+	return time.Duration(conf.RefreshInterval)
+}
+
+// discoveryUpdatePeriod defines how often the clients are actively discovered.
+const discoveryUpdatePeriod = 10 * time.Minute
 
 // findMultiple is a wrapper around [clientsContainer.find] to make it a valid
 // client finder for the query log.  c is never nil; if no information about the
@@ -348,21 +452,41 @@ func (clients *clientsContainer) clientOrArtificial(
 		}
 	}()
 
+	rc := clients.storage.ClientRuntime(ip)
+
+	ident := clients.storage.Identity(context.TODO(), ip)
+
 	cli, ok := clients.storage.FindLoose(ip, id)
 	if ok {
-		return &querylog.Client{
+		ignoreQueryLog, _ := clients.storage.Ignores(cli)
+		c = &querylog.Client{
 			Name:           cli.Name,
-			IgnoreQueryLog: cli.IgnoreQueryLog,
-		}, false
+			Identity:       ident,
+			IgnoreQueryLog: ignoreQueryLog,
+		}
+
+		if rc != nil {
+			c.Device = rc.Device()
+		}
+
+		return c, false
 	}
 
-	rc := clients.storage.ClientRuntime(ip)
 	if rc != nil {
 		_, host := rc.Info()
 
 		return &querylog.Client{
-			Name:  host,
-			WHOIS: rc.WHOIS(),
+			Name:     host,
+			WHOIS:    rc.WHOIS(),
+			Device:   rc.Device(),
+			Identity: ident,
+		}, false
+	}
+
+	if ident != nil {
+		return &querylog.Client{
+			Name:     ident.Computer,
+			Identity: ident,
 		}, false
 	}
 
@@ -393,7 +517,9 @@ func (clients *clientsContainer) shouldCountClient(ids []string) (y bool) {
 
 		client, ok := clients.storage.Find(params)
 		if ok {
-			return !client.IgnoreStatistics
+			_, ignoreStatistics := clients.storage.Ignores(client)
+
+			return !ignoreStatistics
 		}
 	}
 
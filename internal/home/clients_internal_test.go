@@ -26,6 +26,11 @@ func newClientsContainer(tb testing.TB) (c *clientsContainer) {
 		client.EmptyDHCP{},
 		nil,
 		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
 		&filtering.Config{
 			Logger: testLogger,
 		},
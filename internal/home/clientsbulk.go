@@ -0,0 +1,534 @@
+package home
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// clientsFormat is the format of the exported and imported persistent clients.
+type clientsFormat string
+
+// Valid formats of the persistent clients.
+const (
+	clientsFormatCSV  clientsFormat = "csv"
+	clientsFormatJSON clientsFormat = "json"
+)
+
+// newClientsFormat validates that s is a valid format of the persistent clients
+// and returns it as a clientsFormat.  An empty s means [clientsFormatJSON].
+func newClientsFormat(s string) (f clientsFormat, err error) {
+	switch f = clientsFormat(s); f {
+	case "":
+		return clientsFormatJSON, nil
+	case clientsFormatCSV, clientsFormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf(
+			"invalid format %q: should be one of %q",
+			s,
+			[]clientsFormat{clientsFormatCSV, clientsFormatJSON},
+		)
+	}
+}
+
+// contentType returns the value of the Content-Type header for f.
+func (f clientsFormat) contentType() (ct string) {
+	if f == clientsFormatCSV {
+		return "text/csv"
+	}
+
+	return aghhttp.HdrValApplicationJSON
+}
+
+// contentDisposition returns the value of the Content-Disposition header for
+// f.
+func (f clientsFormat) contentDisposition() (cd string) {
+	return fmt.Sprintf("attachment; filename=clients.%s", f)
+}
+
+// importStrategy defines how the imported persistent clients, which have the
+// same names as the existing ones, are handled.
+type importStrategy string
+
+// Valid import strategies.
+const (
+	// importStrategySkip means that the existing clients are kept as is.
+	importStrategySkip importStrategy = "skip"
+
+	// importStrategyOverwrite means that the existing clients are replaced
+	// with the imported ones.
+	importStrategyOverwrite importStrategy = "overwrite"
+)
+
+// newImportStrategy validates that s is a valid import strategy and returns it
+// as an importStrategy.  An empty s means [importStrategySkip].
+func newImportStrategy(s string) (st importStrategy, err error) {
+	switch st = importStrategy(s); st {
+	case "":
+		return importStrategySkip, nil
+	case importStrategySkip, importStrategyOverwrite:
+		return st, nil
+	default:
+		return "", fmt.Errorf(
+			"invalid strategy %q: should be one of %q",
+			s,
+			[]importStrategy{importStrategyOverwrite, importStrategySkip},
+		)
+	}
+}
+
+// csvClientsSep is the separator of the values in the list columns of the CSV
+// representation of the persistent clients.
+const csvClientsSep = " "
+
+// CSV columns of the persistent clients.
+const (
+	csvColName                     = "name"
+	csvColIDs                      = "ids"
+	csvColTags                     = "tags"
+	csvColGroup                    = "group"
+	csvColUpstreams                = "upstreams"
+	csvColUseGlobalSettings        = "use_global_settings"
+	csvColFilteringEnabled         = "filtering_enabled"
+	csvColParentalEnabled          = "parental_enabled"
+	csvColSafeBrowsingEnabled      = "safebrowsing_enabled"
+	csvColSafeSearchEnabled        = "safesearch_enabled"
+	csvColUseGlobalBlockedServices = "use_global_blocked_services"
+	csvColBlockedServices          = "blocked_services"
+	csvColIgnoreQueryLog           = "ignore_querylog"
+	csvColIgnoreStatistics         = "ignore_statistics"
+)
+
+// csvClientsHeader is the header row of the CSV representation of the
+// persistent clients.
+var csvClientsHeader = []string{
+	csvColName,
+	csvColIDs,
+	csvColTags,
+	csvColGroup,
+	csvColUpstreams,
+	csvColUseGlobalSettings,
+	csvColFilteringEnabled,
+	csvColParentalEnabled,
+	csvColSafeBrowsingEnabled,
+	csvColSafeSearchEnabled,
+	csvColUseGlobalBlockedServices,
+	csvColBlockedServices,
+	csvColIgnoreQueryLog,
+	csvColIgnoreStatistics,
+}
+
+// clientToCSV returns the CSV record of cj with [csvClientsHeader] columns.  cj
+// must not be nil.
+func clientToCSV(cj *clientJSON) (rec []string) {
+	var group string
+	if cj.Group != nil {
+		group = *cj.Group
+	}
+
+	return []string{
+		cj.Name,
+		strings.Join(cj.IDs, csvClientsSep),
+		strings.Join(cj.Tags, csvClientsSep),
+		group,
+		strings.Join(cj.Upstreams, csvClientsSep),
+		strconv.FormatBool(cj.UseGlobalSettings),
+		strconv.FormatBool(cj.FilteringEnabled),
+		strconv.FormatBool(cj.ParentalEnabled),
+		strconv.FormatBool(cj.SafeBrowsingEnabled),
+		strconv.FormatBool(cj.SafeSearchEnabled),
+		strconv.FormatBool(cj.UseGlobalBlockedServices),
+		strings.Join(cj.BlockedServices, csvClientsSep),
+		strconv.FormatBool(cj.IgnoreQueryLog == aghalg.NBTrue),
+		strconv.FormatBool(cj.IgnoreStatistics == aghalg.NBTrue),
+	}
+}
+
+// csvToClient returns the client from the CSV record rec.  cols maps the names
+// of the columns to their indexes in rec.  The missing boolean values of the
+// use_global_* columns mean true, the other missing boolean values mean false.
+func csvToClient(cols map[string]int, rec []string) (cj *clientJSON, err error) {
+	val := func(col string) (v string, ok bool) {
+		i, ok := cols[col]
+		if !ok || i >= len(rec) {
+			return "", false
+		}
+
+		return strings.TrimSpace(rec[i]), true
+	}
+
+	list := func(col string) (vals []string) {
+		v, _ := val(col)
+
+		return strings.Fields(v)
+	}
+
+	var errs []error
+	boolean := func(col string, def bool) (b bool) {
+		v, _ := val(col)
+		if v == "" {
+			return def
+		}
+
+		b, err = strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("column %q: %w", col, err))
+		}
+
+		return b
+	}
+
+	name, _ := val(csvColName)
+	cj = &clientJSON{
+		Name:      name,
+		IDs:       list(csvColIDs),
+		Tags:      list(csvColTags),
+		Upstreams: list(csvColUpstreams),
+
+		UseGlobalSettings:   boolean(csvColUseGlobalSettings, true),
+		FilteringEnabled:    boolean(csvColFilteringEnabled, false),
+		ParentalEnabled:     boolean(csvColParentalEnabled, false),
+		SafeBrowsingEnabled: boolean(csvColSafeBrowsingEnabled, false),
+		SafeSearchEnabled:   boolean(csvColSafeSearchEnabled, false),
+
+		UseGlobalBlockedServices: boolean(csvColUseGlobalBlockedServices, true),
+		BlockedServices:          list(csvColBlockedServices),
+
+		IgnoreQueryLog:   aghalg.BoolToNullBool(boolean(csvColIgnoreQueryLog, false)),
+		IgnoreStatistics: aghalg.BoolToNullBool(boolean(csvColIgnoreStatistics, false)),
+	}
+
+	if group, ok := val(csvColGroup); ok {
+		cj.Group = &group
+	}
+
+	return cj, errors.Join(errs...)
+}
+
+// handleExportClients is the handler for GET /control/clients/export HTTP
+// API.  It writes all persistent clients in the format from the "format" query
+// parameter.
+func (clients *clientsContainer) handleExportClients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := clients.logger
+
+	f, err := newClientsFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	cjs := []*clientJSON{}
+	clients.storage.RangeByName(func(c *client.Persistent) (cont bool) {
+		cjs = append(cjs, clientToJSON(c))
+
+		return true
+	})
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, f.contentType())
+	h.Set(httphdr.ContentDisposition, f.contentDisposition())
+	h.Set(httphdr.Server, aghhttp.UserAgent())
+
+	w.WriteHeader(http.StatusOK)
+
+	err = writeClients(f, w, cjs)
+	if err != nil {
+		// Don't use aghhttp.ErrorAndLog, since the headers have already been
+		// sent.
+		l.ErrorContext(ctx, "exporting clients", slogutil.KeyError, err)
+	}
+}
+
+// writeClients writes cjs to w in the format f.
+func writeClients(f clientsFormat, w io.Writer, cjs []*clientJSON) (err error) {
+	if f == clientsFormatJSON {
+		return json.NewEncoder(w).Encode(cjs)
+	}
+
+	cw := csv.NewWriter(w)
+	err = cw.Write(csvClientsHeader)
+	if err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	for _, cj := range cjs {
+		err = cw.Write(clientToCSV(cj))
+		if err != nil {
+			return fmt.Errorf("writing client %q: %w", cj.Name, err)
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// readClients reads the persistent clients in the format f from r.  A CSV
+// input must start with a header row containing the "name" column and any of
+// the other columns of [csvClientsHeader] in any order.
+func readClients(f clientsFormat, r io.Reader) (cjs []*clientJSON, err error) {
+	if f == clientsFormatJSON {
+		err = json.NewDecoder(r).Decode(&cjs)
+		if err != nil {
+			return nil, fmt.Errorf("decoding json: %w", err)
+		}
+
+		return cjs, nil
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	recs, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv: %w", err)
+	} else if len(recs) == 0 {
+		return nil, fmt.Errorf("csv header: %w", errors.ErrNoValue)
+	}
+
+	cols, err := csvColumns(recs[0])
+	if err != nil {
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+
+	var errs []error
+	for i, rec := range recs[1:] {
+		var cj *clientJSON
+		cj, err = csvToClient(cols, rec)
+		if err != nil {
+			// Count the header row and start from one, as the editors do.
+			errs = append(errs, fmt.Errorf("csv row %d: %w", i+2, err))
+		}
+
+		cjs = append(cjs, cj)
+	}
+
+	return cjs, errors.Join(errs...)
+}
+
+// csvColumns validates the CSV header row and returns the map of the names of
+// the columns to their indexes.
+func csvColumns(header []string) (cols map[string]int, err error) {
+	cols = make(map[string]int, len(header))
+	for i, col := range header {
+		col = strings.TrimSpace(col)
+		if !slices.Contains(csvClientsHeader, col) {
+			return nil, fmt.Errorf("column %q: unknown column", col)
+		} else if _, ok := cols[col]; ok {
+			return nil, fmt.Errorf("column %q: duplicate column", col)
+		}
+
+		cols[col] = i
+	}
+
+	if _, ok := cols[csvColName]; !ok {
+		return nil, fmt.Errorf("column %q: %w", csvColName, errors.ErrNoValue)
+	}
+
+	return cols, nil
+}
+
+// importErrorJSON is the error of a single imported persistent client.
+type importErrorJSON struct {
+	// Name is the name of the client, if any.
+	Name string `json:"name"`
+
+	// Error is the description of the error.
+	Error string `json:"error"`
+
+	// Index is the zero-based index of the client in the imported list.
+	Index int `json:"index"`
+}
+
+// importResultJSON is the response of the POST /control/clients/import HTTP
+// API.
+type importResultJSON struct {
+	// Added are the names of the added clients.
+	Added []string `json:"added"`
+
+	// Updated are the names of the overwritten clients.
+	Updated []string `json:"updated"`
+
+	// Skipped are the names of the clients, which already existed and were
+	// kept as is.
+	Skipped []string `json:"skipped"`
+
+	// Errors are the errors of the clients, which couldn't be imported.
+	Errors []*importErrorJSON `json:"errors"`
+}
+
+// handleImportClients is the handler for POST /control/clients/import HTTP
+// API.  It reads the persistent clients in the format from the "format" query
+// parameter and handles the existing ones according to the "strategy" query
+// parameter.  All clients are validated first, so that nothing is imported if
+// any of them is invalid.
+func (clients *clientsContainer) handleImportClients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := clients.logger
+
+	q := r.URL.Query()
+	f, err := newClientsFormat(q.Get("format"))
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	st, err := newImportStrategy(q.Get("strategy"))
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	cjs, err := readClients(f, r.Body)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "reading clients: %s", err)
+
+		return
+	}
+
+	ps, res := clients.importedClients(ctx, cjs)
+	if len(res.Errors) > 0 {
+		aghhttp.WriteJSONResponse(ctx, l, w, r, http.StatusUnprocessableEntity, res)
+
+		return
+	}
+
+	for i, p := range ps {
+		clients.importClient(ctx, res, i, p, st)
+	}
+
+	if len(res.Added) > 0 || len(res.Updated) > 0 {
+		clients.confModifier.Apply(ctx)
+	}
+
+	l.InfoContext(
+		ctx,
+		"clients imported",
+		"added", len(res.Added),
+		"updated", len(res.Updated),
+		"skipped", len(res.Skipped),
+		"errors", len(res.Errors),
+	)
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, res)
+}
+
+// importedClients converts cjs into persistent clients.  res contains the
+// errors of the conversion, if any.
+func (clients *clientsContainer) importedClients(
+	ctx context.Context,
+	cjs []*clientJSON,
+) (ps []*client.Persistent, res *importResultJSON) {
+	res = &importResultJSON{
+		Added:   []string{},
+		Updated: []string{},
+		Skipped: []string{},
+		Errors:  []*importErrorJSON{},
+	}
+
+	names := make(map[string]struct{}, len(cjs))
+	for i, cj := range cjs {
+		var err error
+		switch {
+		case cj == nil:
+			err = errors.ErrNoValue
+		case cj.Name == "":
+			err = fmt.Errorf("name: %w", errors.ErrEmptyValue)
+		default:
+			if _, ok := names[cj.Name]; ok {
+				err = errors.Error("duplicate name")
+			}
+		}
+
+		if err != nil {
+			res.Errors = append(res.Errors, newImportErrorJSON(i, cj, err))
+
+			continue
+		}
+
+		names[cj.Name] = struct{}{}
+
+		prev, _ := clients.storage.FindByName(cj.Name)
+
+		var p *client.Persistent
+		p, err = clients.jsonToClient(ctx, *cj, prev)
+		if err != nil {
+			res.Errors = append(res.Errors, newImportErrorJSON(i, cj, err))
+
+			continue
+		}
+
+		ps = append(ps, p)
+	}
+
+	return ps, res
+}
+
+// importClient adds p or, if a client with the same name exists, handles it
+// according to st.  The result or the error is recorded in res.
+func (clients *clientsContainer) importClient(
+	ctx context.Context,
+	res *importResultJSON,
+	i int,
+	p *client.Persistent,
+	st importStrategy,
+) {
+	_, exists := clients.storage.FindByName(p.Name)
+
+	var err error
+	switch {
+	case !exists:
+		err = clients.storage.Add(ctx, p)
+		if err == nil {
+			res.Added = append(res.Added, p.Name)
+		}
+	case st == importStrategyOverwrite:
+		err = clients.storage.Update(ctx, p.Name, p)
+		if err == nil {
+			res.Updated = append(res.Updated, p.Name)
+		}
+	default:
+		res.Skipped = append(res.Skipped, p.Name)
+	}
+
+	if err != nil {
+		res.Errors = append(res.Errors, &importErrorJSON{
+			Name:  p.Name,
+			Error: err.Error(),
+			Index: i,
+		})
+	}
+}
+
+// newImportErrorJSON returns the error of the imported client cj at index i.
+// cj may be nil.
+func newImportErrorJSON(i int, cj *clientJSON, err error) (e *importErrorJSON) {
+	e = &importErrorJSON{
+		Error: err.Error(),
+		Index: i,
+	}
+
+	if cj != nil {
+		e.Name = cj.Name
+	}
+
+	return e
+}
@@ -0,0 +1,204 @@
+package home
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientsContainer_HandleExportClients(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	err := clients.storage.Add(ctx, newPersistentClientWithIDs(t, "client1", []string{testClientIP1}))
+	require.NoError(t, err)
+
+	err = clients.storage.Add(ctx, newPersistentClientWithIDs(t, "client2", []string{testClientIP2}))
+	require.NoError(t, err)
+
+	t.Run("json", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/control/clients/export?format=json", nil)
+		rw := httptest.NewRecorder()
+		clients.handleExportClients(rw, r)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		var cjs []*clientJSON
+		err = json.NewDecoder(rw.Body).Decode(&cjs)
+		require.NoError(t, err)
+		require.Len(t, cjs, 2)
+
+		assert.Equal(t, "client1", cjs[0].Name)
+		assert.Equal(t, []string{testClientIP1}, cjs[0].IDs)
+		assert.Equal(t, "client2", cjs[1].Name)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/control/clients/export?format=csv", nil)
+		rw := httptest.NewRecorder()
+		clients.handleExportClients(rw, r)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		assert.Equal(t, "text/csv", rw.Header().Get("Content-Type"))
+
+		var recs [][]string
+		recs, err = csv.NewReader(rw.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, recs, 3)
+
+		assert.Equal(t, csvClientsHeader, recs[0])
+		assert.Equal(t, []string{"client1", testClientIP1}, recs[1][:2])
+		assert.Equal(t, []string{"client2", testClientIP2}, recs[2][:2])
+	})
+
+	t.Run("bad_format", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/control/clients/export?format=xml", nil)
+		rw := httptest.NewRecorder()
+		clients.handleExportClients(rw, r)
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+}
+
+func TestClientsContainer_HandleImportClients(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	clientOne := newPersistentClientWithIDs(t, "client1", []string{testClientIP1})
+	err := clients.storage.Add(ctx, clientOne)
+	require.NoError(t, err)
+
+	const (
+		csvHeader = "name,ids,filtering_enabled\n"
+		csvBody   = csvHeader +
+			"client1,1.1.1.1 3.3.3.3,true\n" +
+			"client2,2.2.2.2,false\n"
+	)
+
+	testCases := []struct {
+		wantRes    *importResultJSON
+		wantIDs    map[string][]string
+		name       string
+		query      string
+		body       string
+		wantCode   int
+		wantErrors int
+	}{{
+		wantRes: &importResultJSON{
+			Added:   []string{"client2"},
+			Updated: []string{},
+			Skipped: []string{"client1"},
+			Errors:  []*importErrorJSON{},
+		},
+		wantIDs: map[string][]string{
+			"client1": {testClientIP1},
+			"client2": {testClientIP2},
+		},
+		name:     "csv_skip",
+		query:    "format=csv",
+		body:     csvBody,
+		wantCode: http.StatusOK,
+	}, {
+		wantRes: &importResultJSON{
+			Added:   []string{},
+			Updated: []string{"client1", "client2"},
+			Skipped: []string{},
+			Errors:  []*importErrorJSON{},
+		},
+		wantIDs: map[string][]string{
+			"client1": {testClientIP1, "3.3.3.3"},
+			"client2": {testClientIP2},
+		},
+		name:     "csv_overwrite",
+		query:    "format=csv&strategy=overwrite",
+		body:     csvBody,
+		wantCode: http.StatusOK,
+	}, {
+		wantRes: &importResultJSON{
+			Added:   []string{"client3"},
+			Updated: []string{},
+			Skipped: []string{},
+			Errors:  []*importErrorJSON{},
+		},
+		wantIDs: map[string][]string{
+			"client3": {"4.4.4.4"},
+		},
+		name:     "json",
+		query:    "format=json",
+		body:     `[{"name":"client3","ids":["4.4.4.4"],"use_global_settings":true}]`,
+		wantCode: http.StatusOK,
+	}, {
+		wantRes: nil,
+		wantIDs: map[string][]string{
+			"client3": {"4.4.4.4"},
+		},
+		name:       "invalid",
+		query:      "format=json&strategy=overwrite",
+		body:       `[{"name":"client3","ids":["5.5.5.5"]},{"name":"client4","ids":["!"]},{"name":""}]`,
+		wantCode:   http.StatusUnprocessableEntity,
+		wantErrors: 2,
+	}, {
+		wantRes:  nil,
+		wantIDs:  map[string][]string{},
+		name:     "bad_strategy",
+		query:    "strategy=merge",
+		body:     "[]",
+		wantCode: http.StatusBadRequest,
+	}, {
+		wantRes:  nil,
+		wantIDs:  map[string][]string{},
+		name:     "bad_csv_header",
+		query:    "format=csv",
+		body:     "ids\n1.1.1.1\n",
+		wantCode: http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(
+				http.MethodPost,
+				"/control/clients/import?"+tc.query,
+				strings.NewReader(tc.body),
+			)
+			rw := httptest.NewRecorder()
+			clients.handleImportClients(rw, r)
+			require.Equal(t, tc.wantCode, rw.Code)
+
+			if tc.wantCode != http.StatusBadRequest {
+				res := &importResultJSON{}
+				err = json.NewDecoder(bytes.NewReader(rw.Body.Bytes())).Decode(res)
+				require.NoError(t, err)
+
+				if tc.wantRes != nil {
+					assert.Equal(t, tc.wantRes, res)
+				}
+
+				assert.Len(t, res.Errors, tc.wantErrors)
+			}
+
+			for name, ids := range tc.wantIDs {
+				p, ok := clients.storage.FindByName(name)
+				require.True(t, ok)
+
+				want := newPersistentClientWithIDs(t, name, ids)
+				assert.True(t, want.EqualIDs(p))
+			}
+		})
+	}
+
+	_, ok := clients.storage.FindByName("client4")
+	assert.False(t, ok)
+
+	p, ok := clients.storage.FindByName("client1")
+	require.True(t, ok)
+
+	assert.Equal(t, clientOne.UID, p.UID)
+	assert.True(t, p.FilteringEnabled)
+}
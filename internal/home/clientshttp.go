@@ -10,11 +10,15 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/urlfilter/rules"
 )
 
 // clientJSON is a common structure used by several handlers to deal with
@@ -43,11 +47,28 @@ type clientJSON struct {
 
 	Name string `json:"name"`
 
+	// Group is the name of the group of the client, if any.  If it's nil in a
+	// request, the group of the client isn't changed.
+	Group *string `json:"group,omitempty"`
+
 	// BlockedServices is the names of blocked services.
 	BlockedServices []string `json:"blocked_services"`
 	IDs             []string `json:"ids"`
 	Tags            []string `json:"tags"`
 	Upstreams       []string `json:"upstreams"`
+	BootstrapDNS    []string `json:"bootstrap_dns"`
+
+	// FilterListIDs are the IDs of the blocklists applied to the requests of
+	// the client.
+	FilterListIDs []rules.ListID `json:"filter_list_ids"`
+
+	// Allowlist are the domain names the client may resolve in the
+	// allowlist-only mode.
+	Allowlist []string `json:"allowlist"`
+
+	// AllowlistOnly defines if the client may only resolve the domain names
+	// from Allowlist.
+	AllowlistOnly bool `json:"allowlist_only"`
 
 	FilteringEnabled    bool `json:"filtering_enabled"`
 	ParentalEnabled     bool `json:"parental_enabled"`
@@ -66,7 +87,11 @@ type clientJSON struct {
 
 // runtimeClientJSON is a JSON representation of the [client.Runtime].
 type runtimeClientJSON struct {
-	WHOIS *whois.Info `json:"whois_info"`
+	WHOIS  *whois.Info         `json:"whois_info"`
+	Device *fingerprint.Device `json:"device,omitempty"`
+
+	// Tags are the tags assigned to the client by the tag rules, if any.
+	Tags []string `json:"tags,omitempty"`
 
 	IP     netip.Addr    `json:"ip"`
 	Name   string        `json:"name"`
@@ -79,6 +104,7 @@ type clientListJSON struct {
 	Clients        []*clientJSON       `json:"clients"`
 	RuntimeClients []runtimeClientJSON `json:"auto_clients"`
 	Tags           []string            `json:"supported_tags"`
+	Groups         []string            `json:"supported_groups"`
 }
 
 // whoisOrEmpty returns a WHOIS client information or a pointer to an empty
@@ -113,6 +139,7 @@ func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, r *http
 		src, host := rc.Info()
 		cj := runtimeClientJSON{
 			WHOIS:  whoisOrEmpty(rc),
+			Device: rc.Device(),
 			Name:   host,
 			Source: src,
 			IP:     rc.Addr(),
@@ -123,7 +150,14 @@ func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, r *http
 		return true
 	})
 
+	// Don't get the tags inside RangeRuntime, since it locks the storage.
+	for i := range data.RuntimeClients {
+		cj := &data.RuntimeClients[i]
+		cj.Tags = clients.storage.RuntimeTags(cj.IP)
+	}
+
 	data.Tags = clients.storage.AllowedTags()
+	data.Groups = clients.storage.GroupNames()
 
 	aghhttp.WriteJSONResponseOK(ctx, clients.logger, w, r, data)
 }
@@ -133,6 +167,7 @@ func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, r *http
 func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err error) {
 	var (
 		uid              client.UID
+		group            string
 		ignoreQueryLog   bool
 		ignoreStatistics bool
 		upsCacheEnabled  bool
@@ -141,12 +176,17 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 
 	if prev != nil {
 		uid = prev.UID
+		group = prev.Group
 		ignoreQueryLog = prev.IgnoreQueryLog
 		ignoreStatistics = prev.IgnoreStatistics
 		upsCacheEnabled = prev.UpstreamsCacheEnabled
 		upsCacheSize = prev.UpstreamsCacheSize
 	}
 
+	if cj.Group != nil {
+		group = *cj.Group
+	}
+
 	if cj.IgnoreQueryLog != aghalg.NBNull {
 		ignoreQueryLog = cj.IgnoreQueryLog == aghalg.NBTrue
 	}
@@ -175,6 +215,7 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 	return &client.Persistent{
 		BlockedServices:       svcs,
 		UID:                   uid,
+		Group:                 group,
 		IgnoreQueryLog:        ignoreQueryLog,
 		IgnoreStatistics:      ignoreStatistics,
 		UpstreamsCacheEnabled: upsCacheEnabled,
@@ -205,11 +246,15 @@ func (clients *clientsContainer) jsonToClient(
 	c.Name = cj.Name
 	c.Tags = cj.Tags
 	c.Upstreams = cj.Upstreams
+	c.BootstrapDNS = cj.BootstrapDNS
 	c.UseOwnSettings = !cj.UseGlobalSettings
 	c.FilteringEnabled = cj.FilteringEnabled
 	c.ParentalEnabled = cj.ParentalEnabled
 	c.SafeBrowsingEnabled = cj.SafeBrowsingEnabled
 	c.UseOwnBlockedServices = !cj.UseGlobalBlockedServices
+	c.FilterListIDs = cj.FilterListIDs
+	c.Allowlist = cj.Allowlist
+	c.AllowlistOnly = cj.AllowlistOnly
 
 	if c.SafeSearchConf.Enabled {
 		logger := clients.baseLogger.With(
@@ -301,6 +346,7 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 
 	return &clientJSON{
 		Name:                c.Name,
+		Group:               &c.Group,
 		IDs:                 c.Identifiers(),
 		Tags:                c.Tags,
 		UseGlobalSettings:   !c.UseOwnSettings,
@@ -315,7 +361,11 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 		Schedule:        c.BlockedServices.Schedule,
 		BlockedServices: c.BlockedServices.IDs,
 
-		Upstreams: c.Upstreams,
+		Upstreams:     c.Upstreams,
+		BootstrapDNS:  c.BootstrapDNS,
+		FilterListIDs: c.FilterListIDs,
+		Allowlist:     c.Allowlist,
+		AllowlistOnly: c.AllowlistOnly,
 
 		IgnoreQueryLog:   aghalg.BoolToNullBool(c.IgnoreQueryLog),
 		IgnoreStatistics: aghalg.BoolToNullBool(c.IgnoreStatistics),
@@ -441,6 +491,12 @@ func (clients *clientsContainer) handleUpdateClient(w http.ResponseWriter, r *ht
 		return
 	}
 
+	// Keep the group of the client, if the request doesn't change it, since
+	// the frontend doesn't send it.
+	if prev, ok := clients.storage.FindByName(dj.Name); ok && dj.Data.Group == nil {
+		c.Group = prev.Group
+	}
+
 	err = clients.storage.Update(ctx, dj.Name, c)
 	if err != nil {
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
@@ -451,6 +507,111 @@ func (clients *clientsContainer) handleUpdateClient(w http.ResponseWriter, r *ht
 	clients.confModifier.Apply(ctx)
 }
 
+// allowlistLearningApplyJSON is the request of the POST
+// /control/clients/learning/apply HTTP API.
+type allowlistLearningApplyJSON struct {
+	// Client is the name of the persistent client.
+	Client string `json:"client"`
+
+	// Domains are the reviewed learned domain names to add to the allowlist of
+	// the client.  If empty, all learned domain names are added.
+	Domains []string `json:"domains"`
+
+	// AllowlistOnly defines if the allowlist-only mode should be enabled for
+	// the client.
+	AllowlistOnly bool `json:"allowlist_only"`
+}
+
+// handleAllowlistLearningApply is the handler for the POST
+// /control/clients/learning/apply HTTP API.  It adds the learned domain names
+// to the allowlist of the persistent client and removes the learning session.
+func (clients *clientsContainer) handleAllowlistLearningApply(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+	l := clients.logger
+
+	req := &allowlistLearningApplyJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "reading req: %s", err)
+
+		return
+	}
+
+	if req.Client == "" {
+		aghhttp.ErrorAndLog(
+			ctx,
+			l,
+			r,
+			w,
+			http.StatusUnprocessableEntity,
+			"client: %s",
+			errors.ErrEmptyValue,
+		)
+
+		return
+	}
+
+	var sess *dnsforward.AllowlistLearning
+	if clients.allowlistLearner != nil {
+		sess = clients.allowlistLearner.AllowlistLearning(req.Client)
+	}
+
+	if sess == nil {
+		aghhttp.ErrorAndLog(
+			ctx,
+			l,
+			r,
+			w,
+			http.StatusNotFound,
+			"no allowlist learning for client %q",
+			req.Client,
+		)
+
+		return
+	}
+
+	var p *client.Persistent
+	clients.storage.RangeByName(func(c *client.Persistent) (cont bool) {
+		if c.Name != req.Client {
+			return true
+		}
+
+		p = c.ShallowClone()
+
+		return false
+	})
+
+	if p == nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusNotFound, "client %q is not found", req.Client)
+
+		return
+	}
+
+	domains := req.Domains
+	if len(domains) == 0 {
+		domains = sess.Domains
+	}
+
+	p.Allowlist = append(p.Allowlist, domains...)
+	p.AllowlistOnly = p.AllowlistOnly || req.AllowlistOnly
+
+	err = clients.storage.Update(ctx, req.Client, p)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	clients.allowlistLearner.RemoveAllowlistLearning(req.Client)
+
+	l.InfoContext(ctx, "learned allowlist applied", "client", req.Client, "domains", len(domains))
+
+	clients.confModifier.Apply(ctx)
+}
+
 // handleFindClient is the handler for GET /control/clients/find HTTP API.
 //
 // Deprecated:  Remove it when migration to the new API is over.
@@ -612,9 +773,16 @@ func (clients *clientsContainer) findRuntime(
 func (clients *clientsContainer) registerWebHandlers() {
 	clients.httpReg.Register(http.MethodGet, "/control/clients", clients.handleGetClients)
 	clients.httpReg.Register(http.MethodPost, "/control/clients/add", clients.handleAddClient)
+	clients.httpReg.Register(http.MethodGet, "/control/clients/export", clients.handleExportClients)
+	clients.httpReg.Register(http.MethodPost, "/control/clients/import", clients.handleImportClients)
 	clients.httpReg.Register(http.MethodPost, "/control/clients/delete", clients.handleDelClient)
 	clients.httpReg.Register(http.MethodPost, "/control/clients/update", clients.handleUpdateClient)
 	clients.httpReg.Register(http.MethodPost, "/control/clients/search", clients.handleSearchClient)
+	clients.httpReg.Register(
+		http.MethodPost,
+		"/control/clients/learning/apply",
+		clients.handleAllowlistLearningApply,
+	)
 
 	// Deprecated handler.
 	clients.httpReg.Register(http.MethodGet, "/control/clients/find", clients.handleFindClient)
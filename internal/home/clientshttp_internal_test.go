@@ -14,10 +14,12 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -48,6 +50,29 @@ func (c *testBlockedClientChecker) IsBlockedClient(
 	return c.onIsBlockedClient(ip, clientID)
 }
 
+// testAllowlistLearner is a mock implementation of the [AllowlistLearner]
+// interface.
+type testAllowlistLearner struct {
+	sessions map[string]*dnsforward.AllowlistLearning
+}
+
+// type check
+var _ AllowlistLearner = (*testAllowlistLearner)(nil)
+
+// AllowlistLearning implements the [AllowlistLearner] interface for
+// *testAllowlistLearner.
+func (l *testAllowlistLearner) AllowlistLearning(
+	client string,
+) (sess *dnsforward.AllowlistLearning) {
+	return l.sessions[client]
+}
+
+// RemoveAllowlistLearning implements the [AllowlistLearner] interface for
+// *testAllowlistLearner.
+func (l *testAllowlistLearner) RemoveAllowlistLearning(client string) {
+	delete(l.sessions, client)
+}
+
 // newPersistentClient is a helper function that returns a persistent client
 // with the specified name and newly generated UID.
 func newPersistentClient(name string) (c *client.Persistent) {
@@ -339,6 +364,71 @@ func TestClientsContainer_HandleUpdateClient(t *testing.T) {
 	}
 }
 
+func TestClientsContainer_HandleUpdateClient_group(t *testing.T) {
+	const groupName = "family"
+
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	var err error
+	clients.storage, err = client.NewStorage(ctx, &client.StorageConfig{
+		BaseLogger: testLogger,
+		Logger:     testLogger,
+		Clock:      timeutil.SystemClock{},
+		DHCP:       client.EmptyDHCP{},
+		Groups: []*client.Group{{
+			Name: groupName,
+		}},
+	})
+	require.NoError(t, err)
+
+	grouped := newPersistentClientWithIDs(t, "grouped", []string{testClientIP1})
+	grouped.Group = groupName
+
+	err = clients.storage.Add(ctx, grouped)
+	require.NoError(t, err)
+
+	emptyGroup := ""
+
+	testCases := []struct {
+		group     *string
+		name      string
+		wantGroup string
+	}{{
+		group:     nil,
+		name:      "no_group",
+		wantGroup: groupName,
+	}, {
+		group:     &emptyGroup,
+		name:      "empty_group",
+		wantGroup: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := *clientToJSON(grouped)
+			data.Group = tc.group
+
+			var body []byte
+			body, err = json.Marshal(updateJSON{
+				Name: grouped.Name,
+				Data: data,
+			})
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodPost, "/control/clients/update", bytes.NewReader(body))
+			rw := httptest.NewRecorder()
+			clients.handleUpdateClient(rw, r)
+			require.Equal(t, http.StatusOK, rw.Code)
+
+			updated, ok := clients.storage.FindByName(grouped.Name)
+			require.True(t, ok)
+
+			assert.Equal(t, tc.wantGroup, updated.Group)
+		})
+	}
+}
+
 func TestClientsContainer_HandleFindClient(t *testing.T) {
 	clients := newClientsContainer(t)
 	clients.clientChecker = &testBlockedClientChecker{
@@ -544,3 +634,94 @@ func TestClientsContainer_HandleSearchClient(t *testing.T) {
 		})
 	}
 }
+
+func TestClientsContainer_HandleAllowlistLearningApply(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	learner := &testAllowlistLearner{
+		sessions: map[string]*dnsforward.AllowlistLearning{
+			"client1": {
+				Client:  "client1",
+				Domains: []string{"cloud.example", "time.example"},
+			},
+			"client2": {
+				Client:  "client2",
+				Domains: []string{"cloud.example", "time.example"},
+			},
+		},
+	}
+	clients.allowlistLearner = learner
+
+	clientOne := newPersistentClientWithIDs(t, "client1", []string{testClientIP1})
+	clientOne.Allowlist = []string{"update.example"}
+	err := clients.storage.Add(ctx, clientOne)
+	require.NoError(t, err)
+
+	clientTwo := newPersistentClientWithIDs(t, "client2", []string{testClientIP2})
+	err = clients.storage.Add(ctx, clientTwo)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		req           *allowlistLearningApplyJSON
+		name          string
+		wantAllowlist []string
+		wantCode      int
+		wantOnly      bool
+	}{{
+		req: &allowlistLearningApplyJSON{
+			Client:        "client1",
+			AllowlistOnly: true,
+		},
+		name:          "all",
+		wantAllowlist: []string{"cloud.example", "time.example", "update.example"},
+		wantCode:      http.StatusOK,
+		wantOnly:      true,
+	}, {
+		req: &allowlistLearningApplyJSON{
+			Client:  "client2",
+			Domains: []string{"time.example"},
+		},
+		name:          "reviewed",
+		wantAllowlist: []string{"time.example"},
+		wantCode:      http.StatusOK,
+		wantOnly:      false,
+	}, {
+		req: &allowlistLearningApplyJSON{
+			Client: "client2",
+		},
+		name:          "applied",
+		wantAllowlist: []string{"time.example"},
+		wantCode:      http.StatusNotFound,
+		wantOnly:      false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body []byte
+			body, err = json.Marshal(tc.req)
+			require.NoError(t, err)
+
+			var r *http.Request
+			r, err = http.NewRequest(http.MethodPost, "", bytes.NewReader(body))
+			require.NoError(t, err)
+
+			rw := httptest.NewRecorder()
+			clients.handleAllowlistLearningApply(rw, r)
+			require.Equal(t, tc.wantCode, rw.Code)
+
+			var c *client.Persistent
+			clients.storage.RangeByName(func(p *client.Persistent) (cont bool) {
+				if p.Name == tc.req.Client {
+					c = p
+				}
+
+				return c == nil
+			})
+			require.NotNil(t, c)
+
+			assert.Equal(t, tc.wantAllowlist, c.Allowlist)
+			assert.Equal(t, tc.wantOnly, c.AllowlistOnly)
+		})
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
@@ -16,17 +18,22 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/configmigrate"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/threatfeed"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/router"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+	"github.com/AdguardTeam/AdGuardHome/internal/vpn"
 	"github.com/AdguardTeam/dnsproxy/fastip"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/netutil/urlutil"
 	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/renameio/v2/maybe"
@@ -94,6 +101,204 @@ type clientsConfig struct {
 	Sources *clientSourcesConfig `yaml:"runtime_sources"`
 	// Persistent are the configured clients.
 	Persistent []*clientObject `yaml:"persistent"`
+	// TagUpstreams maps client tags to the upstream DNS servers used by the
+	// persistent clients with the tag, which have no own upstreams.
+	TagUpstreams map[string][]string `yaml:"tag_upstreams"`
+	// TagProtection maps client tags to the configurations of the protection
+	// services for the persistent clients with the tag, which have no own
+	// settings.
+	TagProtection map[string]*client.TagProtection `yaml:"tag_protection"`
+	// Groups are the groups of the persistent clients, the settings of which
+	// are inherited by their members.
+	Groups []*client.Group `yaml:"groups"`
+	// TagRules are the rules, which automatically assign tags to the runtime
+	// clients.
+	TagRules []*client.TagRule `yaml:"tag_rules"`
+	// Discovery is the configuration of the active discovery of the runtime
+	// clients.  It's used only if Sources.Discovery is true.
+	Discovery *clientDiscoveryConfig `yaml:"discovery"`
+	// ARPRefreshInterval defines how often the network neighborhood is
+	// refreshed from ARP and NDP.  On Linux, it's also refreshed as soon as
+	// the kernel reports a change.  It's used only if Sources.ARP is true and
+	// must be positive.
+	ARPRefreshInterval timeutil.Duration `yaml:"arp_refresh_interval"`
+	// Identity is the configuration of the external identity source, which
+	// resolves the IP addresses of the clients to their users and computers.
+	Identity *clientIdentityConfig `yaml:"identity"`
+	// Router is the configuration of the upstream router, the DHCP leases and
+	// the clients of which are used to get the names and the hardware
+	// addresses of the runtime clients.
+	Router *clientRouterConfig `yaml:"router"`
+	// VPN is the configuration of the VPN, the peers of which are named by
+	// their tunnel addresses and matched to the persistent clients with the
+	// same names.
+	VPN *clientVPNConfig `yaml:"vpn"`
+}
+
+// auditLogConfig is the configuration of the append-only log of the changes
+// of the configuration, which is written to the data directory.
+type auditLogConfig struct {
+	// Enabled defines if the changes are logged.
+	Enabled bool `yaml:"enabled"`
+}
+
+// oidcConfig is the configuration of the single sign-on to the web interface
+// through an OpenID Connect identity provider.
+type oidcConfig struct {
+	// GroupRoles maps the groups of the users to their roles, which are the
+	// same as the scopes of the API tokens.  If empty, all users authenticated
+	// by the identity provider have the "admin" role.  Otherwise, the users
+	// without any of the groups aren't allowed to log in.
+	GroupRoles map[string]apiScope `yaml:"group_roles"`
+
+	// IssuerURL is the URL of the identity provider, which must serve the
+	// OpenID Provider configuration document.  It must be a valid HTTP(S) URL
+	// if Enabled is true.
+	IssuerURL string `yaml:"issuer_url"`
+
+	// ClientID is the ID of AdGuard Home registered at the identity provider.
+	// It must not be empty if Enabled is true.
+	ClientID string `yaml:"client_id"`
+
+	// ClientSecret is the secret of the client.
+	ClientSecret string `yaml:"client_secret"`
+
+	// RedirectURL is the URL of the callback, which must be registered at the
+	// identity provider.  It must not be empty if Enabled is true.
+	RedirectURL string `yaml:"redirect_url"`
+
+	// UsernameClaim is the claim of the ID token used as the name of the user.
+	// It must not be empty if Enabled is true.
+	UsernameClaim string `yaml:"username_claim"`
+
+	// GroupsClaim is the claim of the ID token with the groups of the user.
+	GroupsClaim string `yaml:"groups_claim"`
+
+	// Scopes are the requested scopes.  If empty, "openid", "profile", and
+	// "email" are requested.
+	Scopes []string `yaml:"scopes"`
+
+	// Timeout is the timeout of the requests to the identity provider.  It
+	// must be positive if Enabled is true.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// Enabled defines if the single sign-on is enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// clientVPNConfig is the configuration of the VPN, the peers of which are
+// shown with their names and get the settings of the persistent clients with
+// the same names even when their tunnel addresses change.
+type clientVPNConfig struct {
+	// Enabled defines if the peers are read from the VPN.
+	Enabled bool `yaml:"enabled"`
+
+	// Type is the type of the VPN, either "wireguard" or "tailscale".
+	Type vpn.Type `yaml:"type"`
+
+	// ConfigFile is the path to the wg-quick configuration file of the
+	// WireGuard interface.  It must not be empty if Enabled is true and Type
+	// is "wireguard".
+	ConfigFile string `yaml:"config_file"`
+
+	// URL is the base URL of the Tailscale API.  If empty, the official API of
+	// Tailscale is used.
+	URL string `yaml:"url"`
+
+	// Tailnet is the name of the Tailscale network.  If empty, the default
+	// tailnet of the API key is used.
+	Tailnet string `yaml:"tailnet"`
+
+	// APIKey is the Tailscale API access token.  It must not be empty if
+	// Enabled is true and Type is "tailscale".
+	APIKey string `yaml:"api_key"`
+
+	// RefreshInterval defines how often the peers are read.  It must be
+	// positive if Enabled is true.
+	RefreshInterval timeutil.Duration `yaml:"refresh_interval"`
+
+	// Timeout is the timeout of the requests to the Tailscale API.  It must be
+	// positive if Enabled is true.
+	Timeout timeutil.Duration `yaml:"timeout"`
+}
+
+// clientRouterConfig is the configuration of the upstream router, which is
+// used when AdGuard Home isn't the DHCP server of the network.
+type clientRouterConfig struct {
+	// Enabled defines if the clients are requested from the router.
+	Enabled bool `yaml:"enabled"`
+
+	// Type is the type of the API of the router, one of "openwrt", "unifi",
+	// and "unifi_os".
+	Type router.Type `yaml:"type"`
+
+	// URL is the base URL of the API of the router.  It must be a valid
+	// HTTP(S) URL if Enabled is true.
+	URL string `yaml:"url"`
+
+	// Username is the name of the user of the API.
+	Username string `yaml:"username"`
+
+	// Password is the password of the user of the API.
+	Password string `yaml:"password"`
+
+	// Site is the name of the UniFi site.  If empty, "default" is used.
+	Site string `yaml:"site"`
+
+	// RefreshInterval defines how often the clients are requested.  It must be
+	// positive if Enabled is true.
+	RefreshInterval timeutil.Duration `yaml:"refresh_interval"`
+
+	// Timeout is the timeout of the requests to the API.  It must be positive
+	// if Enabled is true.
+	Timeout timeutil.Duration `yaml:"timeout"`
+}
+
+// clientIdentityConfig is the configuration of the external identity source of
+// the clients.
+type clientIdentityConfig struct {
+	// Enabled defines if the identities of the clients are resolved.
+	Enabled bool `yaml:"enabled"`
+
+	// URL is the URL of the HTTP API of the identity source, for example a
+	// bridge to LDAP or Active Directory.  It must be a valid HTTP(S) URL if
+	// Enabled is true.
+	URL string `yaml:"url"`
+
+	// Timeout is the timeout of a single lookup.  It must be positive if
+	// Enabled is true.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// CacheTTL is the duration, during which a resolved identity is used
+	// without resolving it again.  It must be positive if Enabled is true.
+	CacheTTL timeutil.Duration `yaml:"cache_ttl"`
+
+	// Groups maps the names of the directory groups to the names of the client
+	// groups from [clientsConfig.Groups], the settings of which are applied to
+	// the clients with such identities.
+	Groups map[string]string `yaml:"groups"`
+}
+
+// clientDiscoveryConfig is the configuration of the active discovery of the
+// runtime clients in the local networks.
+type clientDiscoveryConfig struct {
+	// Interfaces are the names of the network interfaces, in the networks of
+	// which the devices are discovered.
+	Interfaces []string `yaml:"interfaces"`
+
+	// Timeout is the time to wait for the responses of each protocol in each
+	// network.  It must be positive.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// MDNS defines if the devices are discovered with multicast DNS.
+	MDNS bool `yaml:"mdns"`
+
+	// NetBIOS defines if the devices are discovered with NetBIOS node status
+	// requests.
+	NetBIOS bool `yaml:"netbios"`
+
+	// SSDP defines if the devices are discovered with SSDP.
+	SSDP bool `yaml:"ssdp"`
 }
 
 // clientSourceConfig is used to configure where the runtime clients will be
@@ -104,6 +309,7 @@ type clientSourcesConfig struct {
 	RDNS      bool `yaml:"rdns"`
 	DHCP      bool `yaml:"dhcp"`
 	HostsFile bool `yaml:"hosts"`
+	Discovery bool `yaml:"discovery"`
 }
 
 // configuration is loaded from YAML.
@@ -115,10 +321,23 @@ type configuration struct {
 	// It's reset after config is parsed
 	fileData []byte
 
+	// isImportPending is true if the configuration file has been replaced by
+	// the imported one, so that it must not be written until the restart.
+	isImportPending bool
+
 	// HTTPConfig is the block with http conf.
 	HTTPConfig httpConfig `yaml:"http"`
 	// Users are the clients capable for accessing the web interface.
 	Users []webUser `yaml:"users"`
+	// APITokens are the scoped long-lived tokens for accessing the HTTP API
+	// from scripts and exporters.
+	APITokens []*apiToken `yaml:"api_tokens"`
+	// OIDC is the configuration of the single sign-on through an OpenID
+	// Connect identity provider.
+	OIDC *oidcConfig `yaml:"oidc"`
+	// AuditLog is the configuration of the log of the changes of the
+	// configuration made through the HTTP API.
+	AuditLog *auditLogConfig `yaml:"audit_log"`
 	// AuthAttempts is the maximum number of failed login attempts a user
 	// can do before being blocked.
 	AuthAttempts uint `yaml:"auth_attempts"`
@@ -190,6 +409,47 @@ type httpConfig struct {
 	// SessionTTL for a web session.
 	// An active session is automatically refreshed once a day.
 	SessionTTL timeutil.Duration `yaml:"session_ttl"`
+
+	// Management is the protection of the web interface and the HTTP API.
+	Management *httpManagementConfig `yaml:"management"`
+
+	// PublicDashboard is the read-only dashboard available without the
+	// authentication.
+	PublicDashboard *httpPublicDashboardConfig `yaml:"public_dashboard"`
+}
+
+// httpPublicDashboardConfig is the configuration of the read-only dashboard,
+// which only shows the aggregate statistics and is available without the
+// authentication.
+type httpPublicDashboardConfig struct {
+	// Token, if not empty, must be passed in the token query parameter to get
+	// the statistics.
+	Token string `yaml:"token"`
+
+	// Enabled defines if the public dashboard is available.
+	Enabled bool `yaml:"enabled"`
+}
+
+// httpManagementConfig is the configuration of the protection of the web
+// interface and the HTTP API from the unwanted clients.
+type httpManagementConfig struct {
+	// AllowedClients are the IP addresses and the subnets of the clients,
+	// which are allowed to access the web interface and the HTTP API.  If
+	// empty, all clients are allowed.  The loopback addresses are always
+	// allowed.  DNS-over-HTTPS isn't restricted.
+	AllowedClients []netutil.Prefix `yaml:"allowed_clients"`
+
+	// RateLimit is the maximum number of the requests to the HTTP API per
+	// second from a single client.  Zero means no limit.
+	RateLimit uint `yaml:"rate_limit"`
+
+	// MaxBlockDuration is the maximum duration of the block of new login
+	// attempts.  Each consecutive block of the same client is twice as long as
+	// the previous one, starting from the value of block_auth_min, until it
+	// reaches MaxBlockDuration.  If it's not greater than block_auth_min, the
+	// duration of the blocks doesn't grow.  Every block is logged as a warning,
+	// no other notifications are sent.
+	MaxBlockDuration timeutil.Duration `yaml:"max_block_duration"`
 }
 
 // httpPprofConfig is the block with pprof HTTP configuration.
@@ -416,6 +676,137 @@ type queryLogConfig struct {
 
 	// FileEnabled defines, if the query log is written to the file.
 	FileEnabled bool `yaml:"file_enabled"`
+
+	// InfluxDB is the configuration of the export of the query log entries to
+	// InfluxDB.
+	InfluxDB queryLogInfluxDBConfig `yaml:"influxdb"`
+
+	// Loki is the configuration of the push of the query log entries to
+	// Grafana Loki.
+	Loki queryLogLokiConfig `yaml:"loki"`
+}
+
+// queryLogInfluxDBConfig is the configuration of the export of the query log
+// entries in InfluxDB line protocol.
+type queryLogInfluxDBConfig struct {
+	// URL is the URL of the write endpoint of InfluxDB, for example:
+	//
+	//	http://localhost:8086/api/v2/write?org=home&bucket=adguardhome
+	URL string `yaml:"url"`
+
+	// Token is the API token of InfluxDB.
+	Token string `yaml:"token"`
+
+	// Measurement is the name of the measurement.
+	Measurement string `yaml:"measurement"`
+
+	// FlushInterval is the interval between sending the data.
+	FlushInterval timeutil.Duration `yaml:"flush_interval"`
+
+	// Enabled defines if the query log entries are sent to InfluxDB.
+	Enabled bool `yaml:"enabled"`
+
+	// Aggregate defines if the aggregated points are sent every flush interval
+	// instead of a point per each query.
+	Aggregate bool `yaml:"aggregate"`
+}
+
+// queryLogLokiConfig is the configuration of the push of the query log entries
+// to Grafana Loki.
+type queryLogLokiConfig struct {
+	// URL is the URL of the push API endpoint of Loki, for example:
+	//
+	//	http://localhost:3100/loki/api/v1/push
+	URL string `yaml:"url"`
+
+	// Username is the username for the basic authentication.
+	Username string `yaml:"username"`
+
+	// Password is the password for the basic authentication.
+	Password string `yaml:"password"`
+
+	// TenantID is the ID of the tenant for multi-tenant Loki installations.
+	TenantID string `yaml:"tenant_id"`
+
+	// Labels are the names of the labels attached to the streams.  See
+	// [querylog.LokiLabel].
+	Labels []string `yaml:"labels"`
+
+	// FlushInterval is the interval between pushing the data.
+	FlushInterval timeutil.Duration `yaml:"flush_interval"`
+
+	// Enabled defines if the query log entries are pushed to Loki.
+	Enabled bool `yaml:"enabled"`
+}
+
+// toInternal returns the configuration for the query log module.  c must not
+// be nil.  conf is nil if the push is disabled.
+func (c *queryLogLokiConfig) toInternal() (conf *querylog.LokiConfig, err error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	u, err := url.ParseRequestURI(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	err = urlutil.ValidateHTTPURL(u)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	labels := make([]querylog.LokiLabel, 0, len(c.Labels))
+	for _, s := range c.Labels {
+		var l querylog.LokiLabel
+		l, err = querylog.NewLokiLabel(s)
+		if err != nil {
+			return nil, fmt.Errorf("labels: %w", err)
+		}
+
+		labels = append(labels, l)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("getting hostname: %w", err)
+	}
+
+	return &querylog.LokiConfig{
+		URL:      u,
+		Username: c.Username,
+		Password: c.Password,
+		TenantID: c.TenantID,
+		Hostname: hostname,
+		Labels:   labels,
+		FlushIvl: time.Duration(c.FlushInterval),
+	}, nil
+}
+
+// toInternal returns the configuration for the query log module.  c must not
+// be nil.  conf is nil if the export is disabled.
+func (c *queryLogInfluxDBConfig) toInternal() (conf *querylog.InfluxDBConfig, err error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	u, err := url.ParseRequestURI(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	err = urlutil.ValidateHTTPURL(u)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	return &querylog.InfluxDBConfig{
+		URL:         u,
+		Token:       c.Token,
+		Measurement: c.Measurement,
+		FlushIvl:    time.Duration(c.FlushInterval),
+		Aggregate:   c.Aggregate,
+	}, nil
 }
 
 type statsConfig struct {
@@ -429,12 +820,65 @@ type statsConfig struct {
 	// Interval is the retention interval for statistics.
 	Interval timeutil.Duration `yaml:"interval"`
 
+	// LongTermInterval is the retention interval for the long-term statistics,
+	// into which the hourly statistics are downsampled after Interval.  Zero
+	// means that the long-term statistics are disabled.
+	LongTermInterval timeutil.Duration `yaml:"long_term_interval"`
+
 	// Enabled defines if the statistics are enabled.
 	Enabled bool `yaml:"enabled"`
 
 	// IgnoredEnabled defines whether hosts from the ignored list should be
 	// ignored.
 	IgnoredEnabled bool `yaml:"ignored_enabled"`
+
+	// StatsD is the configuration of the emission of the metrics to StatsD.
+	StatsD statsDConfig `yaml:"statsd"`
+}
+
+// statsDConfig is the configuration of the emission of the metrics to StatsD.
+type statsDConfig struct {
+	// Address is the address of the StatsD server in the host:port format.
+	Address string `yaml:"address"`
+
+	// Prefix is prepended to the names of the metrics.
+	Prefix string `yaml:"prefix"`
+
+	// TagFormat is the format of the tags of the metrics.  See
+	// [stats.StatsDTagFormat].
+	TagFormat string `yaml:"tag_format"`
+
+	// FlushInterval is the interval between sending the buffered metrics.
+	FlushInterval timeutil.Duration `yaml:"flush_interval"`
+
+	// Enabled defines if the metrics are sent to StatsD.
+	Enabled bool `yaml:"enabled"`
+}
+
+// toInternal returns the configuration for the statistics module.  c must not
+// be nil.  conf is nil if the emission is disabled.
+func (c *statsDConfig) toInternal() (conf *stats.StatsDConfig, err error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	_, _, err = net.SplitHostPort(c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("address: %w", err)
+	}
+
+	tagFormat, err := stats.NewStatsDTagFormat(c.TagFormat)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return &stats.StatsDConfig{
+		Addr:      c.Address,
+		Prefix:    c.Prefix,
+		TagFormat: tagFormat,
+		FlushIvl:  time.Duration(c.FlushInterval),
+	}, nil
 }
 
 // Default block host constants.
@@ -449,6 +893,14 @@ const (
 var config = &configuration{
 	AuthAttempts: 5,
 	AuthBlockMin: 15,
+	AuditLog: &auditLogConfig{
+		Enabled: false,
+	},
+	OIDC: &oidcConfig{
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		Timeout:       timeutil.Duration(10 * time.Second),
+	},
 	HTTPConfig: httpConfig{
 		Address:    netip.AddrPortFrom(netip.IPv4Unspecified(), 3000),
 		SessionTTL: timeutil.Duration(30 * timeutil.Day),
@@ -456,6 +908,13 @@ var config = &configuration{
 			Enabled: false,
 			Port:    6060,
 		},
+		Management: &httpManagementConfig{
+			RateLimit:        0,
+			MaxBlockDuration: timeutil.Duration(timeutil.Day),
+		},
+		PublicDashboard: &httpPublicDashboardConfig{
+			Enabled: false,
+		},
 	},
 	DNS: dnsConfig{
 		BindHosts: []netip.Addr{netip.IPv4Unspecified()},
@@ -485,6 +944,51 @@ var config = &configuration{
 				UseCustom: false,
 			},
 
+			ServeStale: &dnsforward.ServeStaleConfig{
+				MaxStale:      timeutil.Duration(timeutil.Day),
+				AnswerTTL:     timeutil.Duration(30 * time.Second),
+				ClientTimeout: timeutil.Duration(1800 * time.Millisecond),
+				Count:         10_000,
+				Enabled:       false,
+			},
+
+			Prefetch: &dnsforward.PrefetchConfig{
+				Threshold:   10,
+				Concurrency: 10,
+				Count:       10_000,
+				Enabled:     false,
+			},
+
+			UpstreamHealthCheck: &dnsforward.UpstreamHealthCheckConfig{
+				QueryName: "example.com",
+				QueryType: "A",
+				Interval:  timeutil.Duration(time.Minute),
+				Enabled:   false,
+			},
+
+			EDNSPadding: &dnsforward.EDNSPaddingConfig{
+				BlockSize: 128,
+				Enabled:   false,
+			},
+
+			MDNSBridge: &dnsforward.MDNSBridgeConfig{
+				Timeout: timeutil.Duration(time.Second),
+				MDNS:    false,
+				LLMNR:   false,
+			},
+
+			DomainUpstreams: &dnsforward.DomainUpstreamsConfig{
+				Mode:       "",
+				ECSDomains: []string{},
+			},
+
+			DNSCookies: &dnsforward.DNSCookiesConfig{
+				Listeners:       []netip.AddrPort{},
+				Enforce:         false,
+				UpstreamEnabled: false,
+				Enabled:         false,
+			},
+
 			// set default maximum concurrent queries to 300
 			// we introduced a default limit due to this:
 			// https://github.com/AdguardTeam/AdGuardHome/issues/2015#issuecomment-674041912
@@ -511,12 +1015,30 @@ var config = &configuration{
 		MemSize:        1000,
 		Ignored:        []string{},
 		IgnoredEnabled: false,
+		InfluxDB: queryLogInfluxDBConfig{
+			Measurement:   querylog.DefaultInfluxDBMeasurement,
+			FlushInterval: timeutil.Duration(10 * time.Second),
+		},
+		Loki: queryLogLokiConfig{
+			Labels: []string{
+				string(querylog.LokiLabelHostname),
+				string(querylog.LokiLabelClient),
+				string(querylog.LokiLabelBlocked),
+			},
+			FlushInterval: timeutil.Duration(10 * time.Second),
+		},
 	},
 	Stats: statsConfig{
 		Enabled:        true,
 		Interval:       timeutil.Duration(1 * timeutil.Day),
 		Ignored:        []string{},
 		IgnoredEnabled: false,
+		StatsD: statsDConfig{
+			Address:       "127.0.0.1:8125",
+			Prefix:        "adguardhome",
+			TagFormat:     string(stats.StatsDTagFormatDogStatsD),
+			FlushInterval: timeutil.Duration(1 * time.Second),
+		},
 	},
 	// NOTE: Keep these parameters in sync with the one put into
 	// client/src/helpers/filters/filters.ts by scripts/vetted-filters.
@@ -541,8 +1063,10 @@ var config = &configuration{
 
 		FilteringEnabled:           true,
 		FiltersUpdateIntervalHours: 24,
+		FiltersUpdateJitter:        timeutil.Duration(10 * time.Minute),
 
 		RewritesEnabled: true,
+		DecisionTrace:   true,
 
 		ParentalEnabled:     false,
 		SafeBrowsingEnabled: false,
@@ -561,6 +1085,8 @@ var config = &configuration{
 			Pixabay:    true,
 			Yandex:     true,
 			YouTube:    true,
+
+			CustomRewrites: []*filtering.SafeSearchRewrite{},
 		},
 
 		BlockedServices: &filtering.BlockedServices{
@@ -568,6 +1094,42 @@ var config = &configuration{
 			IDs:      []string{},
 		},
 
+		CustomBlockedServices: []*filtering.CustomBlockedService{},
+
+		ThreatFeeds: &filtering.ThreatFeedsConfig{
+			Feeds:          []*threatfeed.FeedConfig{},
+			UpdateInterval: timeutil.Duration(filtering.DefaultThreatFeedsUpdateInterval),
+			MinConfidence:  50,
+			Enabled:        false,
+		},
+
+		BlockedTLDs: &filtering.BlockedTLDs{
+			Suffixes:   []string{},
+			Categories: []filtering.TLDCategory{},
+			Enabled:    false,
+		},
+
+		NewDomains: &filtering.NewDomainsConfig{
+			Action:         filtering.NewDomainsActionAlert,
+			Window:         timeutil.Duration(filtering.DefaultNewDomainsWindow),
+			LearningPeriod: timeutil.Duration(filtering.DefaultNewDomainsLearningPeriod),
+			Enabled:        false,
+		},
+
+		DGA: &filtering.DGAConfig{
+			Action:         filtering.DGAActionLog,
+			Threshold:      filtering.DefaultDGAThreshold,
+			MinLabelLength: filtering.DefaultDGAMinLabelLength,
+			Enabled:        false,
+		},
+
+		Homographs: &filtering.HomographConfig{
+			Brands:       []string{},
+			Action:       filtering.HomographActionNotify,
+			MixedScripts: true,
+			Enabled:      false,
+		},
+
 		ParentalBlockHost:     defaultParentalBlockHost,
 		SafeBrowsingBlockHost: defaultSafeBrowsingBlockHost,
 	},
@@ -589,6 +1151,35 @@ var config = &configuration{
 			DHCP:      true,
 			HostsFile: true,
 		},
+		Discovery: &clientDiscoveryConfig{
+			Interfaces: []string{},
+			Timeout:    timeutil.Duration(2 * time.Second),
+			MDNS:       true,
+			NetBIOS:    true,
+			SSDP:       true,
+		},
+		ARPRefreshInterval: timeutil.Duration(1 * time.Minute),
+		Identity: &clientIdentityConfig{
+			Enabled:  false,
+			URL:      "",
+			Timeout:  timeutil.Duration(5 * time.Second),
+			CacheTTL: timeutil.Duration(10 * time.Minute),
+			Groups:   map[string]string{},
+		},
+		Router: &clientRouterConfig{
+			Enabled:         false,
+			Type:            router.TypeOpenWrt,
+			URL:             "",
+			RefreshInterval: timeutil.Duration(5 * time.Minute),
+			Timeout:         timeutil.Duration(10 * time.Second),
+		},
+		VPN: &clientVPNConfig{
+			Enabled:         false,
+			Type:            vpn.TypeWireGuard,
+			ConfigFile:      "",
+			RefreshInterval: timeutil.Duration(1 * time.Minute),
+			Timeout:         timeutil.Duration(10 * time.Second),
+		},
 	},
 	Log: logSettings{
 		Enabled:    true,
@@ -700,7 +1291,7 @@ func parseConfig(ctx context.Context, l *slog.Logger, workDir, confPath string)
 		return err
 	}
 
-	err = validateConfig(ctx, l, config.fileData)
+	err = validateConfig(ctx, l, config, config.fileData)
 	if err != nil {
 		return err
 	}
@@ -763,32 +1354,37 @@ func hasNilValue(m map[string]any) (ok bool) {
 	return false
 }
 
-// validateConfig returns error if the configuration is invalid.  l must not be
-// nil.
-func validateConfig(ctx context.Context, l *slog.Logger, fileData []byte) (err error) {
-	err = validateBindHosts(ctx, l, config, fileData)
+// validateConfig returns error if conf, decoded from fileData, is invalid.  l
+// and conf must not be nil.
+func validateConfig(
+	ctx context.Context,
+	l *slog.Logger,
+	conf *configuration,
+	fileData []byte,
+) (err error) {
+	err = validateBindHosts(ctx, l, conf, fileData)
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
 		return err
 	}
 
 	tcpPorts := aghalg.UniqChecker[tcpPort]{}
-	addPorts(tcpPorts, tcpPort(config.HTTPConfig.Address.Port()))
+	addPorts(tcpPorts, tcpPort(conf.HTTPConfig.Address.Port()))
 
 	udpPorts := aghalg.UniqChecker[udpPort]{}
-	addPorts(udpPorts, udpPort(config.DNS.Port))
+	addPorts(udpPorts, udpPort(conf.DNS.Port))
 
-	if config.TLS.Enabled {
+	if conf.TLS.Enabled {
 		addPorts(
 			tcpPorts,
-			tcpPort(config.TLS.PortHTTPS),
-			tcpPort(config.TLS.PortDNSOverTLS),
-			tcpPort(config.TLS.PortDNSCrypt),
+			tcpPort(conf.TLS.PortHTTPS),
+			tcpPort(conf.TLS.PortDNSOverTLS),
+			tcpPort(conf.TLS.PortDNSCrypt),
 		)
 
 		// TODO(e.burkov):  Consider adding a udpPort with the same value when
 		// we add support for HTTP/3 for web admin interface.
-		addPorts(udpPorts, udpPort(config.TLS.PortDNSOverQUIC))
+		addPorts(udpPorts, udpPort(conf.TLS.PortDNSOverQUIC))
 	}
 
 	if err = tcpPorts.Validate(); err != nil {
@@ -797,20 +1393,223 @@ func validateConfig(ctx context.Context, l *slog.Logger, fileData []byte) (err e
 		return fmt.Errorf("validating udp ports: %w", err)
 	}
 
-	if !filtering.ValidateUpdateIvl(config.Filtering.FiltersUpdateIntervalHours) {
-		config.Filtering.FiltersUpdateIntervalHours = 24
+	err = validateClientDiscovery(conf.Clients)
+	if err != nil {
+		return fmt.Errorf("clients: %w", err)
+	}
+
+	if conf.Clients.Sources.ARP && conf.Clients.ARPRefreshInterval <= 0 {
+		return fmt.Errorf("clients: arp_refresh_interval: %w", errors.ErrNotPositive)
+	}
+
+	err = validateClientIdentity(conf.Clients.Identity)
+	if err != nil {
+		return fmt.Errorf("clients: identity: %w", err)
+	}
+
+	err = validateClientRouter(conf.Clients.Router)
+	if err != nil {
+		return fmt.Errorf("clients: router: %w", err)
+	}
+
+	err = validateClientVPN(conf.Clients.VPN)
+	if err != nil {
+		return fmt.Errorf("clients: vpn: %w", err)
+	}
+
+	err = validateOIDC(conf.OIDC)
+	if err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+
+	if m := conf.HTTPConfig.Management; m != nil && m.MaxBlockDuration < 0 {
+		return fmt.Errorf("http: management: max_block_duration: %w", errors.ErrNegative)
+	}
+
+	if !filtering.ValidateUpdateIvl(conf.Filtering.FiltersUpdateIntervalHours) {
+		conf.Filtering.FiltersUpdateIntervalHours = 24
 	}
 
-	if len(config.Users) == 0 {
+	if len(conf.Users) == 0 && (conf.OIDC == nil || !conf.OIDC.Enabled) {
 		l.WarnContext(ctx, "no users in the configuration file; authentication is disabled")
 	}
 
-	if config.Language != "" && !allowedLanguages.Has(config.Language) {
-		l.WarnContext(ctx, "unsupported language", "lang", config.Language)
+	if conf.Language != "" && !allowedLanguages.Has(conf.Language) {
+		l.WarnContext(ctx, "unsupported language", "lang", conf.Language)
 
 		// Clear the language so the frontend can use the client's browser
 		// language.
-		config.Language = ""
+		conf.Language = ""
+	}
+
+	return nil
+}
+
+// validateClientDiscovery returns an error if the active discovery of the
+// runtime clients is enabled in conf, but misconfigured.
+func validateClientDiscovery(conf *clientsConfig) (err error) {
+	if !conf.Sources.Discovery {
+		return nil
+	}
+
+	d := conf.Discovery
+	if d == nil {
+		return fmt.Errorf("discovery: %w", errors.ErrNoValue)
+	}
+
+	if d.Timeout <= 0 {
+		return fmt.Errorf("discovery: timeout: %w", errors.ErrNotPositive)
+	}
+
+	return nil
+}
+
+// validateClientIdentity returns an error if the identity source is enabled in
+// conf, but misconfigured.
+func validateClientIdentity(conf *clientIdentityConfig) (err error) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	err = urlutil.ValidateHTTPURL(u)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	if conf.Timeout <= 0 {
+		return fmt.Errorf("timeout: %w", errors.ErrNotPositive)
+	} else if conf.CacheTTL <= 0 {
+		return fmt.Errorf("cache_ttl: %w", errors.ErrNotPositive)
+	}
+
+	return nil
+}
+
+// validateClientRouter returns an error if the upstream router is enabled in
+// conf, but misconfigured.
+func validateClientRouter(conf *clientRouterConfig) (err error) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	switch conf.Type {
+	case router.TypeOpenWrt, router.TypeUniFi, router.TypeUniFiOS:
+		// Go on.
+	default:
+		return fmt.Errorf("type: %w: %q", errors.ErrBadEnumValue, conf.Type)
+	}
+
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	err = urlutil.ValidateHTTPURL(u)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	if conf.RefreshInterval <= 0 {
+		return fmt.Errorf("refresh_interval: %w", errors.ErrNotPositive)
+	} else if conf.Timeout <= 0 {
+		return fmt.Errorf("timeout: %w", errors.ErrNotPositive)
+	}
+
+	return nil
+}
+
+// validateOIDC returns an error if the single sign-on is enabled in conf, but
+// misconfigured.
+func validateOIDC(conf *oidcConfig) (err error) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	u, err := url.Parse(conf.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("issuer_url: %w", err)
+	}
+
+	err = urlutil.ValidateHTTPURL(u)
+	if err != nil {
+		return fmt.Errorf("issuer_url: %w", err)
+	}
+
+	if conf.RedirectURL == "" {
+		return fmt.Errorf("redirect_url: %w", errors.ErrEmptyValue)
+	}
+
+	u, err = url.Parse(conf.RedirectURL)
+	if err != nil {
+		return fmt.Errorf("redirect_url: %w", err)
+	}
+
+	err = urlutil.ValidateHTTPURL(u)
+	if err != nil {
+		return fmt.Errorf("redirect_url: %w", err)
+	}
+
+	switch {
+	case conf.ClientID == "":
+		return fmt.Errorf("client_id: %w", errors.ErrEmptyValue)
+	case conf.UsernameClaim == "":
+		return fmt.Errorf("username_claim: %w", errors.ErrEmptyValue)
+	case conf.Timeout <= 0:
+		return fmt.Errorf("timeout: %w", errors.ErrNotPositive)
+	}
+
+	for group, role := range conf.GroupRoles {
+		err = role.validate()
+		if err != nil {
+			return fmt.Errorf("group_roles: group %q: %w", group, err)
+		}
+	}
+
+	return nil
+}
+
+// validateClientVPN returns an error if the VPN is enabled in conf, but
+// misconfigured.
+func validateClientVPN(conf *clientVPNConfig) (err error) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	switch conf.Type {
+	case vpn.TypeWireGuard:
+		if conf.ConfigFile == "" {
+			return fmt.Errorf("config_file: %w", errors.ErrEmptyValue)
+		}
+	case vpn.TypeTailscale:
+		if conf.APIKey == "" {
+			return fmt.Errorf("api_key: %w", errors.ErrEmptyValue)
+		}
+
+		if conf.URL != "" {
+			var u *url.URL
+			u, err = url.Parse(conf.URL)
+			if err != nil {
+				return fmt.Errorf("url: %w", err)
+			}
+
+			err = urlutil.ValidateHTTPURL(u)
+			if err != nil {
+				return fmt.Errorf("url: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("type: %w: %q", errors.ErrBadEnumValue, conf.Type)
+	}
+
+	if conf.RefreshInterval <= 0 {
+		return fmt.Errorf("refresh_interval: %w", errors.ErrNotPositive)
+	} else if conf.Timeout <= 0 {
+		return fmt.Errorf("timeout: %w", errors.ErrNotPositive)
 	}
 
 	return nil
@@ -856,14 +1655,45 @@ func (c *configuration) write(
 	l *slog.Logger,
 	tlsMgr *tlsManager,
 	auth *auth,
+	audit *auditLog,
 	workDir string,
 	confPath string,
 ) (err error) {
 	c.Lock()
 	defer c.Unlock()
 
+	if c.isImportPending {
+		l.DebugContext(ctx, "config import is pending; not writing config file")
+
+		return nil
+	}
+
+	c.updateLocked(ctx, tlsMgr, auth)
+
+	return writeConfigFile(ctx, l, audit, workDir, confPath)
+}
+
+// effective returns the configuration file data with the current settings of
+// all modules.
+func (c *configuration) effective(
+	ctx context.Context,
+	tlsMgr *tlsManager,
+	auth *auth,
+) (data []byte, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.updateLocked(ctx, tlsMgr, auth)
+
+	return encodeConfig(config)
+}
+
+// updateLocked updates the global configuration with the current settings of
+// all modules.  The configuration is expected to be locked.
+func (c *configuration) updateLocked(ctx context.Context, tlsMgr *tlsManager, auth *auth) {
 	if auth != nil {
 		config.Users = auth.usersList(ctx)
+		config.APITokens = auth.apiTokens.list()
 	}
 
 	if tlsMgr != nil {
@@ -919,24 +1749,68 @@ func (c *configuration) write(
 	}
 
 	config.Clients.Persistent = globalContext.clients.forConfig()
+}
 
-	confPath = configFilePath(ctx, l, workDir, confPath)
-	l.DebugContext(ctx, "writing config file", "path", confPath)
+// writeConfigFile encodes the global configuration into the YAML file.  The
+// configuration is expected to be locked.  l must not be nil.  The changes are
+// recorded to audit, if it's not nil.
+func writeConfigFile(
+	ctx context.Context,
+	l *slog.Logger,
+	audit *auditLog,
+	workDir string,
+	confPath string,
+) (err error) {
+	data, err := encodeConfig(config)
+	if err != nil {
+		return fmt.Errorf("generating config file: %w", err)
+	}
 
+	return writeConfigData(ctx, l, audit, workDir, confPath, data)
+}
+
+// encodeConfig returns v encoded as the YAML configuration file.
+func encodeConfig(v any) (data []byte, err error) {
 	buf := &bytes.Buffer{}
 	enc := yaml.NewEncoder(buf)
 	enc.SetIndent(2)
 
-	err = enc.Encode(config)
+	err = enc.Encode(v)
 	if err != nil {
-		return fmt.Errorf("generating config file: %w", err)
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeConfigData atomically replaces the configuration file with data.  l
+// must not be nil.  The changes are recorded to audit, if it's not nil.
+func writeConfigData(
+	ctx context.Context,
+	l *slog.Logger,
+	audit *auditLog,
+	workDir string,
+	confPath string,
+	data []byte,
+) (err error) {
+	confPath = configFilePath(ctx, l, workDir, confPath)
+	l.DebugContext(ctx, "writing config file", "path", confPath)
+
+	var entry *auditEntry
+	if audit != nil {
+		entry = audit.diff(ctx, confPath, data)
 	}
 
-	err = maybe.WriteFile(confPath, buf.Bytes(), aghos.DefaultPermFile)
+	err = maybe.WriteFile(confPath, data, aghos.DefaultPermFile)
 	if err != nil {
 		return fmt.Errorf("writing config file: %w", err)
 	}
 
+	if entry != nil {
+		audit.append(ctx, entry)
+	}
+
 	return nil
 }
 
@@ -957,6 +1831,7 @@ func validateTLSCipherIDs(cipherIDs []string) (err error) {
 // defaultConfigModifier is a default [agh.ConfigModifier] implementation.
 type defaultConfigModifier struct {
 	auth     *auth
+	audit    *auditLog
 	config   *configuration
 	logger   *slog.Logger
 	tlsMgr   *tlsManager
@@ -988,7 +1863,7 @@ var _ agh.ConfigModifier = (*defaultConfigModifier)(nil)
 // Apply implements the [agh.ConfigModifier] interface for
 // *defaultConfigModifier.
 func (cm *defaultConfigModifier) Apply(ctx context.Context) {
-	err := cm.config.write(ctx, cm.logger, cm.tlsMgr, cm.auth, cm.workDir, cm.confPath)
+	err := cm.config.write(ctx, cm.logger, cm.tlsMgr, cm.auth, cm.audit, cm.workDir, cm.confPath)
 	if err != nil {
 		cm.logger.ErrorContext(ctx, "writing config", slogutil.KeyError, err)
 	}
@@ -999,6 +1874,11 @@ func (cm *defaultConfigModifier) setAuth(a *auth) {
 	cm.auth = a
 }
 
+// setAuditLog sets the audit log used by Apply.
+func (cm *defaultConfigModifier) setAuditLog(a *auditLog) {
+	cm.audit = a
+}
+
 // setTLSManager sets the TLS manager used by Apply.
 func (cm *defaultConfigModifier) setTLSManager(m *tlsManager) {
 	cm.tlsMgr = m
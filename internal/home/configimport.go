@@ -0,0 +1,501 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/configmigrate"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/google/renameio/v2/maybe"
+	yaml "go.yaml.in/yaml/v4"
+)
+
+// configBackupExt is the extension of the copy of the previous configuration
+// file, which is kept when a new one is imported.
+const configBackupExt = ".bak"
+
+// configImportResp is the response to the POST /control/config/import and
+// POST /control/config/rollback HTTP APIs.
+type configImportResp struct {
+	// Changes are the changed properties sorted by path.  The values of the
+	// secrets are redacted.
+	Changes []*auditChange `json:"changes"`
+
+	// Applied is true if the configuration file has been replaced and AdGuard
+	// Home is restarting.
+	Applied bool `json:"applied"`
+}
+
+// handleConfigExport is the handler for the GET /control/config/export HTTP
+// API.  It returns the effective configuration file with the values of the
+// secrets redacted, unless the redact query parameter is false.
+func (web *webAPI) handleConfigExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := web.logger
+
+	isRedacted := true
+	if s := r.URL.Query().Get("redact"); s != "" {
+		var err error
+		isRedacted, err = strconv.ParseBool(s)
+		if err != nil {
+			aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "redact: %s", err)
+
+			return
+		}
+	}
+
+	data, err := config.effective(ctx, web.tlsManager, web.auth)
+	if err == nil && isRedacted {
+		data, err = redactConfig(data)
+	}
+
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "encoding config: %s", err)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, "application/yaml")
+	h.Set(httphdr.ContentDisposition, "attachment; filename="+filepath.Base(web.conf.confPath))
+	h.Set(httphdr.Server, aghhttp.UserAgent())
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(data)
+	if err != nil {
+		// Don't use aghhttp.ErrorAndLog, since the headers have already been
+		// sent.
+		l.ErrorContext(ctx, "exporting config", slogutil.KeyError, err)
+	}
+}
+
+// handleConfigImport is the handler for the POST /control/config/import HTTP
+// API.  The body is the new configuration file.  If the dry_run query
+// parameter is true, the configuration is only validated.
+func (web *webAPI) handleConfigImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := web.logger
+
+	isDryRun := false
+	if s := r.URL.Query().Get("dry_run"); s != "" {
+		var err error
+		isDryRun, err = strconv.ParseBool(s)
+		if err != nil {
+			aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "dry_run: %s", err)
+
+			return
+		}
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "reading body: %s", err)
+
+		return
+	}
+
+	web.importConfig(w, r, data, isDryRun)
+}
+
+// handleConfigRollback is the handler for the POST /control/config/rollback
+// HTTP API.  It imports the configuration file, which has been replaced by the
+// last import.
+func (web *webAPI) handleConfigRollback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := web.logger
+
+	backupPath := configFilePath(ctx, l, web.conf.workDir, web.conf.confPath) + configBackupExt
+
+	// #nosec G304 -- Trust the path to the configuration file.
+	data, err := os.ReadFile(backupPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusNotFound, "no previous config")
+
+		return
+	} else if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "reading previous config: %s", err)
+
+		return
+	}
+
+	web.importConfig(w, r, data, false)
+}
+
+// importConfig validates the configuration file data and, unless isDryRun is
+// true, replaces the current one with it and restarts AdGuard Home.
+func (web *webAPI) importConfig(w http.ResponseWriter, r *http.Request, data []byte, isDryRun bool) {
+	ctx := r.Context()
+	l := web.logger
+
+	cur, err := config.effective(ctx, web.tlsManager, web.auth)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "encoding config: %s", err)
+
+		return
+	}
+
+	data, err = newImportedConfig(ctx, l, cur, data)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "validating config: %s", err)
+
+		return
+	}
+
+	changes, err := diffConfigs(cur, data)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "comparing configs: %s", err)
+
+		return
+	}
+
+	resp := &configImportResp{
+		Changes: append([]*auditChange{}, changes...),
+	}
+
+	if isDryRun || len(changes) == 0 {
+		aghhttp.WriteJSONResponseOK(ctx, l, w, r, resp)
+
+		return
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "getting path: %s", err)
+
+		return
+	}
+
+	err = config.replaceFile(ctx, l, web.auditLog, web.conf.workDir, web.conf.confPath, data)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "replacing config: %s", err)
+
+		return
+	}
+
+	l.InfoContext(ctx, "config imported; restarting", "changes", len(changes))
+
+	resp.Applied = true
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, resp)
+
+	rc := http.NewResponseController(w)
+	err = rc.Flush()
+	if err != nil {
+		l.WarnContext(ctx, "flushing response", slogutil.KeyError, err)
+	}
+
+	// Use the background context and a separate goroutine for the same
+	// reasons as in [webAPI.handleUpdate].
+	go finishUpdate(
+		context.Background(),
+		l,
+		web.cmdCons,
+		execPath,
+		web.conf.runningAsService,
+	)
+}
+
+// newImportedConfig returns the configuration file, which is data with the
+// redacted secrets restored from the current configuration file cur, if it's
+// valid.  The properties missing from data keep their values from cur.  l must
+// not be nil.
+func newImportedConfig(
+	ctx context.Context,
+	l *slog.Logger,
+	cur []byte,
+	data []byte,
+) (imported []byte, err error) {
+	if len(data) == 0 {
+		return nil, errors.ErrEmptyValue
+	}
+
+	data, err = restoreSecrets(cur, data)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	conf := &configuration{}
+	err = yaml.Unmarshal(cur, conf)
+	if err != nil {
+		return nil, fmt.Errorf("decoding current config: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, conf)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if conf.SchemaVersion != configmigrate.LastSchemaVersion {
+		return nil, fmt.Errorf(
+			"schema_version: must be %d, got %d",
+			configmigrate.LastSchemaVersion,
+			conf.SchemaVersion,
+		)
+	}
+
+	err = validateConfig(ctx, l, conf, data)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	err = validateTLSCipherIDs(conf.TLS.OverrideTLSCiphers)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	_, err = newAPITokens(conf.APITokens)
+	if err != nil {
+		return nil, fmt.Errorf("api_tokens: %w", err)
+	}
+
+	return encodeConfig(conf)
+}
+
+// replaceFile atomically replaces the configuration file with data, keeping
+// the previous one with the [configBackupExt] extension, and prevents the
+// further writes of the configuration file until the restart.  l must not be
+// nil.  The changes are recorded to audit, if it's not nil.
+func (c *configuration) replaceFile(
+	ctx context.Context,
+	l *slog.Logger,
+	audit *auditLog,
+	workDir string,
+	confPath string,
+	data []byte,
+) (err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	resolved := configFilePath(ctx, l, workDir, confPath)
+
+	// #nosec G304 -- Trust the path to the configuration file.
+	prev, err := os.ReadFile(resolved)
+	if err != nil {
+		return fmt.Errorf("reading current config: %w", err)
+	}
+
+	err = maybe.WriteFile(resolved+configBackupExt, prev, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("writing backup: %w", err)
+	}
+
+	// The file is replaced atomically, so the current configuration file stays
+	// intact on error.
+	err = writeConfigData(ctx, l, audit, workDir, confPath, data)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	c.isImportPending = true
+
+	return nil
+}
+
+// redactConfig returns the configuration file data with the non-empty values
+// of the secrets and the userinfo of the URLs replaced with [auditRedacted].
+func redactConfig(data []byte) (redacted []byte, err error) {
+	doc := &yaml.Node{}
+	err = yaml.Unmarshal(data, doc)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	redactNode(doc)
+
+	return encodeConfig(doc)
+}
+
+// redactNode replaces the non-empty values of the secrets and the userinfo of
+// the URLs within n with [auditRedacted].
+func redactNode(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if isSecretNode(k, v) && v.Value != "" && v.Tag != "!!null" {
+				v.SetString(auditRedacted)
+			} else {
+				redactNode(v)
+			}
+		}
+	case yaml.ScalarNode:
+		if redacted, ok := redactURLUserinfo(n.Value); ok {
+			n.SetString(redacted)
+		}
+	default:
+		for _, child := range n.Content {
+			redactNode(child)
+		}
+	}
+}
+
+// isSecretNode returns true if v is the scalar value of the secret with the
+// key k.
+func isSecretNode(k, v *yaml.Node) (ok bool) {
+	return v.Kind == yaml.ScalarNode && slices.Contains(auditSecretKeys, k.Value)
+}
+
+// restoreSecrets returns the configuration file data with the values of the
+// secrets redacted by [redactConfig] restored from the configuration file cur.
+func restoreSecrets(cur, data []byte) (restored []byte, err error) {
+	curDoc, doc := &yaml.Node{}, &yaml.Node{}
+	err = yaml.Unmarshal(cur, curDoc)
+	if err != nil {
+		return nil, fmt.Errorf("decoding current config: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, doc)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	} else if len(doc.Content) == 0 {
+		return nil, errors.ErrEmptyValue
+	}
+
+	var curRoot *yaml.Node
+	if len(curDoc.Content) > 0 {
+		curRoot = curDoc.Content[0]
+	}
+
+	err = restoreNode("", curRoot, doc.Content[0])
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return encodeConfig(doc)
+}
+
+// restoreNode restores the redacted values of the secrets within n at path p
+// from the corresponding node cur, which may be nil.
+func restoreNode(p string, cur, n *yaml.Node) (err error) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			kp := joinConfigPath(p, k.Value)
+			curVal := mappingValue(cur, k.Value)
+
+			if !isSecretNode(k, v) || v.Value != auditRedacted {
+				err = restoreNode(kp, curVal, v)
+			} else if curVal == nil || curVal.Kind != yaml.ScalarNode {
+				err = fmt.Errorf("%s: redacted secret has no current value", kp)
+			} else {
+				*v = *curVal
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, elem := range n.Content {
+			err = restoreNode(fmt.Sprintf("%s[%d]", p, i), sequenceElem(cur, elem, i), elem)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		return restoreURL(p, cur, n)
+	default:
+		// Go on.
+	}
+
+	return nil
+}
+
+// restoreURL restores the userinfo of the URL in n at path p redacted by
+// [redactNode] from the corresponding node cur, which may be nil.  The rest of
+// the URL must not be changed, so that the credentials aren't sent to another
+// server.
+func restoreURL(p string, cur, n *yaml.Node) (err error) {
+	_, userinfo, _, ok := splitURLUserinfo(n.Value)
+	if !ok || userinfo != auditRedacted {
+		return nil
+	}
+
+	if cur != nil && cur.Kind == yaml.ScalarNode {
+		redacted, _ := redactURLUserinfo(cur.Value)
+		if redacted == n.Value {
+			n.Value = cur.Value
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: redacted url credentials have no current value", p)
+}
+
+// mappingValue returns the value of the property k of the mapping node n or
+// nil if there is none.
+func mappingValue(n *yaml.Node, k string) (v *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == k {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// sequenceElem returns the element of the sequence node n corresponding to
+// elem, which is the element of the new sequence at index i, or nil if there is
+// none.  The objects are matched by their "id" or "name" properties, if they
+// have any, and the scalars, by their redacted values, so that the secrets
+// don't move between them when the list is reordered.
+func sequenceElem(n, elem *yaml.Node, i int) (curElem *yaml.Node) {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	if elem.Kind == yaml.ScalarNode {
+		for _, c := range n.Content {
+			if redacted, ok := redactURLUserinfo(c.Value); ok && redacted == elem.Value {
+				return c
+			}
+		}
+	}
+
+	for _, prop := range []string{"id", "name"} {
+		id := mappingValue(elem, prop)
+		if id == nil {
+			continue
+		}
+
+		for _, c := range n.Content {
+			if curID := mappingValue(c, prop); curID != nil && curID.Value == id.Value {
+				return c
+			}
+		}
+
+		return nil
+	}
+
+	if i < len(n.Content) {
+		return n.Content[i]
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/confimport"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// importFormat is the format of the configuration imported with the --import
+// command-line option.
+type importFormat string
+
+// Valid import formats.
+const (
+	importFormatDnsmasq importFormat = "dnsmasq"
+	importFormatPihole  importFormat = "pihole"
+)
+
+// parseImportFormat parses and validates the import format.
+func parseImportFormat(s string) (f importFormat, err error) {
+	switch f = importFormat(s); f {
+	case importFormatDnsmasq, importFormatPihole:
+		return f, nil
+	default:
+		return "", fmt.Errorf("import format: %q: %w", s, errors.ErrBadEnumValue)
+	}
+}
+
+// readImport reads the configuration of the format from path.
+func readImport(format importFormat, path string) (res *confimport.Result, err error) {
+	switch format {
+	case importFormatDnsmasq:
+		return confimport.ReadDnsmasq(path)
+	case importFormatPihole:
+		return confimport.ReadPihole(path)
+	case "":
+		return nil, fmt.Errorf("import format: %w", errors.ErrEmptyValue)
+	default:
+		return nil, fmt.Errorf("import format: %q: %w", format, errors.ErrBadEnumValue)
+	}
+}
+
+// importConfig imports the configuration from opts into the parsed
+// configuration, writes it, and adds the imported static leases into the
+// database of the DHCP server.  AdGuard Home must not be running.  baseLogger
+// must not be nil.
+func importConfig(
+	ctx context.Context,
+	baseLogger *slog.Logger,
+	opts options,
+	workDir string,
+	confPath string,
+) (err error) {
+	l := baseLogger.With(slogutil.KeyPrefix, "import")
+
+	res, err := readImport(opts.importFrom, opts.importPath)
+	if err != nil {
+		return fmt.Errorf("reading %q: %w", opts.importPath, err)
+	}
+
+	for _, s := range res.Skipped {
+		l.WarnContext(
+			ctx,
+			"skipped entry",
+			"file", s.File,
+			"line", s.Line,
+			"text", s.Text,
+			"reason", s.Reason,
+		)
+	}
+
+	config.Lock()
+	defer config.Unlock()
+
+	filters := mergeImportFilters(config, res)
+	rewrites, rules, upstreams := mergeImport(config, res)
+
+	leases, err := dhcpd.ImportStaticLeases(filepath.Join(workDir, dataDir), res.StaticLeases)
+	if err != nil {
+		return fmt.Errorf("importing static leases: %w", err)
+	}
+
+	err = writeConfigFile(ctx, l, nil, workDir, confPath)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	l.InfoContext(
+		ctx,
+		"imported configuration",
+		"filters", filters,
+		"rewrites", rewrites,
+		"user_rules", rules,
+		"upstreams", upstreams,
+		"static_leases", leases,
+		"skipped", len(res.Skipped),
+	)
+
+	return nil
+}
+
+// mergeImportFilters adds the imported filters into conf, unless there already
+// are filters with the same URLs.  The IDs of the filters are assigned when the
+// filtering is initialized.  It returns the number of the added filters.
+func mergeImportFilters(conf *configuration, res *confimport.Result) (added int) {
+	sameURL := func(url string) (f func(flt filtering.FilterYAML) (ok bool)) {
+		return func(flt filtering.FilterYAML) (ok bool) { return flt.URL == url }
+	}
+
+	merge := func(dst *[]filtering.FilterYAML, src []filtering.FilterYAML) {
+		for _, flt := range src {
+			if slices.ContainsFunc(conf.Filters, sameURL(flt.URL)) ||
+				slices.ContainsFunc(conf.WhitelistFilters, sameURL(flt.URL)) {
+				continue
+			}
+
+			*dst = append(*dst, flt)
+			added++
+		}
+	}
+
+	merge(&conf.Filters, res.Filters)
+	merge(&conf.WhitelistFilters, res.WhitelistFilters)
+
+	return added
+}
+
+// mergeImport adds the imported rewrites, custom filtering rules, and upstreams
+// into conf, unless they are already there.  It returns the numbers of the
+// added ones.
+func mergeImport(conf *configuration, res *confimport.Result) (rewrites, rules, upstreams int) {
+	for _, rw := range res.Rewrites {
+		if !slices.ContainsFunc(conf.Filtering.Rewrites, func(prev *filtering.LegacyRewrite) (ok bool) {
+			return prev.Domain == rw.Domain && prev.Answer == rw.Answer
+		}) {
+			conf.Filtering.Rewrites = append(conf.Filtering.Rewrites, rw)
+			rewrites++
+		}
+	}
+
+	for _, rule := range res.UserRules {
+		if !slices.Contains(conf.UserRules, rule) {
+			conf.UserRules = append(conf.UserRules, rule)
+			rules++
+		}
+	}
+
+	for _, ups := range res.Upstreams {
+		if !slices.Contains(conf.DNS.UpstreamDNS, ups) {
+			conf.DNS.UpstreamDNS = append(conf.DNS.UpstreamDNS, ups)
+			upstreams++
+		}
+	}
+
+	return rewrites, rules, upstreams
+}
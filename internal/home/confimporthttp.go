@@ -0,0 +1,108 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/confimport"
+)
+
+// importReqJSON is the request for the POST /control/import/dnsmasq HTTP API.
+type importReqJSON struct {
+	// Config is the text of the imported configuration.
+	Config string `json:"config"`
+}
+
+// importRewriteJSON is the imported DNS rewrite.
+type importRewriteJSON struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+// importLeaseJSON is the imported static DHCP lease.
+type importLeaseJSON struct {
+	MAC      string     `json:"mac"`
+	IP       netip.Addr `json:"ip"`
+	Hostname string     `json:"hostname"`
+}
+
+// importSkippedJSON is the entry of the imported configuration, which hasn't
+// been imported.
+type importSkippedJSON struct {
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+	Line   int    `json:"line"`
+}
+
+// importRespJSON is the response for the POST /control/import/dnsmasq HTTP API.
+type importRespJSON struct {
+	Rewrites     []*importRewriteJSON `json:"rewrites"`
+	UserRules    []string             `json:"user_rules"`
+	Upstreams    []string             `json:"upstream_dns"`
+	StaticLeases []*importLeaseJSON   `json:"static_leases"`
+	Skipped      []*importSkippedJSON `json:"skipped"`
+}
+
+// newImportRespJSON converts the result of an import into the response.
+func newImportRespJSON(res *confimport.Result) (resp *importRespJSON) {
+	resp = &importRespJSON{
+		Rewrites:     make([]*importRewriteJSON, 0, len(res.Rewrites)),
+		UserRules:    append([]string{}, res.UserRules...),
+		Upstreams:    append([]string{}, res.Upstreams...),
+		StaticLeases: make([]*importLeaseJSON, 0, len(res.StaticLeases)),
+		Skipped:      make([]*importSkippedJSON, 0, len(res.Skipped)),
+	}
+
+	for _, rw := range res.Rewrites {
+		resp.Rewrites = append(resp.Rewrites, &importRewriteJSON{
+			Domain: rw.Domain,
+			Answer: rw.Answer,
+		})
+	}
+
+	for _, l := range res.StaticLeases {
+		resp.StaticLeases = append(resp.StaticLeases, &importLeaseJSON{
+			MAC:      l.HWAddr.String(),
+			IP:       l.IP,
+			Hostname: l.Hostname,
+		})
+	}
+
+	for _, s := range res.Skipped {
+		resp.Skipped = append(resp.Skipped, &importSkippedJSON{
+			Text:   s.Text,
+			Reason: s.Reason,
+			Line:   s.Line,
+		})
+	}
+
+	return resp
+}
+
+// handleImportDnsmasq is the handler for the POST /control/import/dnsmasq HTTP
+// API.  It converts the dnsmasq configuration without applying it, so that the
+// user could review the result and apply it using the corresponding APIs.
+func (web *webAPI) handleImportDnsmasq(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := web.logger
+
+	req := &importReqJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	res, err := confimport.ParseDnsmasq(strings.NewReader(req.Config))
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusUnprocessableEntity, "parsing: %s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, newImportRespJSON(res))
+}
@@ -13,6 +13,7 @@ type ctxKey uint8
 
 const (
 	ctxKeyWebUser ctxKey = iota
+	ctxKeyAPIToken
 )
 
 // type check
@@ -23,6 +24,8 @@ func (k ctxKey) String() (s string) {
 	switch k {
 	case ctxKeyWebUser:
 		return "ctxKeyWebUser"
+	case ctxKeyAPIToken:
+		return "ctxKeyAPIToken"
 	default:
 		panic(fmt.Errorf("ctx key: %w: %d", errors.ErrBadEnumValue, k))
 	}
@@ -54,3 +57,26 @@ func webUserFromContext(ctx context.Context) (u *aghuser.User, ok bool) {
 
 	return u, true
 }
+
+// withAPIToken returns a copy of the parent context with the name of the API
+// token added.
+func withAPIToken(ctx context.Context, name string) (withToken context.Context) {
+	return context.WithValue(ctx, ctxKeyAPIToken, name)
+}
+
+// apiTokenFromContext returns the name of the API token from the context, if
+// any.
+func apiTokenFromContext(ctx context.Context) (name string, ok bool) {
+	const key = ctxKeyAPIToken
+	v := ctx.Value(key)
+	if v == nil {
+		return "", false
+	}
+
+	name, ok = v.(string)
+	if !ok {
+		panicBadType(key, v)
+	}
+
+	return name, true
+}
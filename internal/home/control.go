@@ -110,6 +110,10 @@ type statusResponse struct {
 	// StartTime is the start time of the web API server in Unix milliseconds.
 	StartTime aghhttp.JSONTime `json:"start_time"`
 
+	// PausedClients are the clients, for which the filtering is temporarily
+	// paused.
+	PausedClients []*pausedClientJSON `json:"paused_clients"`
+
 	ProtectionEnabled bool `json:"protection_enabled"`
 	// TODO(e.burkov): Inspect if front-end doesn't requires this field as
 	// openapi.yaml declares.
@@ -117,6 +121,32 @@ type statusResponse struct {
 	IsRunning       bool `json:"running"`
 }
 
+// pausedClientJSON is a client, for which the filtering is temporarily paused,
+// for the HTTP API.
+type pausedClientJSON struct {
+	Client string `json:"client"`
+
+	// Until is the time when the filtering is resumed in Unix milliseconds.
+	Until aghhttp.JSONTime `json:"until"`
+
+	// Duration is the remaining duration of the pause in milliseconds.
+	Duration int64 `json:"duration"`
+}
+
+// pausedClientsToJSON converts the client pauses for the HTTP API.
+func pausedClientsToJSON(pauses []*dnsforward.ClientPause) (res []*pausedClientJSON) {
+	res = make([]*pausedClientJSON, 0, len(pauses))
+	for _, p := range pauses {
+		res = append(res, &pausedClientJSON{
+			Client:   p.Client,
+			Until:    aghhttp.JSONTime(p.Until),
+			Duration: max(0, time.Until(p.Until).Milliseconds()),
+		})
+	}
+
+	return res
+}
+
 func (web *webAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := web.logger
@@ -133,12 +163,14 @@ func (web *webAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
 	var (
 		fltConf           *dnsforward.Config
 		protDisabledUntil *time.Time
+		pauses            []*dnsforward.ClientPause
 		protEnabled       bool
 	)
 	if globalContext.dnsServer != nil {
 		fltConf = &dnsforward.Config{}
 		globalContext.dnsServer.WriteDiskConfig(fltConf)
 		protEnabled, protDisabledUntil = globalContext.dnsServer.UpdatedProtectionStatus(ctx)
+		pauses = globalContext.dnsServer.PausedClients()
 	}
 
 	var resp statusResponse
@@ -162,6 +194,7 @@ func (web *webAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
 			HTTPPort:                   config.HTTPConfig.Address.Port(),
 			ProtectionDisabledDuration: protectionDisabledDuration,
 			StartTime:                  aghhttp.JSONTime(web.startTime),
+			PausedClients:              pausedClientsToJSON(pauses),
 			ProtectionEnabled:          protEnabled,
 			IsRunning:                  isRunning(),
 		}
@@ -198,6 +231,14 @@ func (web *webAPI) registerControlHandlers() {
 	)
 	web.httpReg.Register(http.MethodGet, "/control/profile", web.handleGetProfile)
 	web.httpReg.Register(http.MethodPut, "/control/profile/update", web.handlePutProfile)
+	web.httpReg.Register(http.MethodPost, "/control/import/dnsmasq", web.handleImportDnsmasq)
+	web.httpReg.Register(http.MethodGet, "/control/audit_log", web.handleAuditLog)
+	web.httpReg.Register(http.MethodGet, "/control/audit_log/export", web.handleAuditLogExport)
+	web.httpReg.Register(http.MethodGet, "/control/config/export", web.handleConfigExport)
+	web.httpReg.Register(http.MethodPost, "/control/config/import", web.handleConfigImport)
+	web.httpReg.Register(http.MethodPost, "/control/config/rollback", web.handleConfigRollback)
+	web.httpReg.Register(http.MethodGet, openAPIJSONPath, web.handleOpenAPIJSON)
+	web.httpReg.Register(http.MethodGet, openAPIYAMLPath, web.handleOpenAPIYAML)
 
 	// No authentication is required for DoH/DoT configuration endpoints.
 	mux.Handle(
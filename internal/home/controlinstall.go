@@ -526,6 +526,7 @@ func (web *webAPI) finalizeInstall(
 		web.logger,
 		web.tlsManager,
 		web.auth,
+		web.auditLog,
 		web.conf.workDir,
 		web.conf.confPath,
 	)
@@ -212,8 +212,9 @@ func tlsConfUsesPrivilegedPorts(c *tlsConfigSettings) (ok bool) {
 	return c.Enabled && (c.PortHTTPS < 1024 || c.PortDNSOverTLS < 1024 || c.PortDNSOverQUIC < 1024)
 }
 
-// finishUpdate completes an update procedure.  It is intended to be used as a
-// goroutine.  l and cmdCons must not be nil.
+// finishUpdate completes an update procedure or an import of the configuration
+// file by restarting AdGuard Home.  It is intended to be used as a goroutine.
+// l and cmdCons must not be nil.
 func finishUpdate(
 	ctx context.Context,
 	l *slog.Logger,
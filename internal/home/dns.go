@@ -54,10 +54,17 @@ func initDNS(
 ) (err error) {
 	anonymizer := config.anonymizer()
 
+	statsDConf, err := config.Stats.StatsD.toInternal()
+	if err != nil {
+		return fmt.Errorf("statistics: statsd: %w", err)
+	}
+
 	statsConf := stats.Config{
 		Logger:            baseLogger.With(slogutil.KeyPrefix, "stats"),
+		StatsD:            statsDConf,
 		Filename:          filepath.Join(statsDir, "stats.db"),
 		Limit:             time.Duration(config.Stats.Interval),
+		LongTermLimit:     time.Duration(config.Stats.LongTermInterval),
 		ConfigModifier:    confModifier,
 		HTTPReg:           httpReg,
 		Enabled:           config.Stats.Enabled,
@@ -75,12 +82,25 @@ func initDNS(
 		return fmt.Errorf("init stats: %w", err)
 	}
 
+	influxConf, err := config.QueryLog.InfluxDB.toInternal()
+	if err != nil {
+		return fmt.Errorf("querylog: influxdb: %w", err)
+	}
+
+	lokiConf, err := config.QueryLog.Loki.toInternal()
+	if err != nil {
+		return fmt.Errorf("querylog: loki: %w", err)
+	}
+
 	conf := querylog.Config{
 		Logger:            baseLogger.With(slogutil.KeyPrefix, "querylog"),
 		Anonymizer:        anonymizer,
 		ConfigModifier:    confModifier,
 		HTTPReg:           httpReg,
 		FindClient:        globalContext.clients.findMultiple,
+		HTTPClient:        httpClient(tlsMgr),
+		InfluxDB:          influxConf,
+		Loki:              lokiConf,
 		BaseDir:           querylogDir,
 		AnonymizeClientIP: config.DNS.AnonymizeClientIP,
 		RotationIvl:       time.Duration(config.QueryLog.Interval),
@@ -159,6 +179,7 @@ func initDNSServer(
 	}
 
 	globalContext.clients.clientChecker = globalContext.dnsServer
+	globalContext.clients.allowlistLearner = globalContext.dnsServer
 
 	dnsConf, err := newServerConfig(
 		&config.DNS,
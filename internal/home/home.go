@@ -28,15 +28,20 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
 	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/discovery"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/threatfeed"
+	"github.com/AdguardTeam/AdGuardHome/internal/identity"
 	"github.com/AdguardTeam/AdGuardHome/internal/permcheck"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/router"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
 	"github.com/AdguardTeam/AdGuardHome/internal/updater"
 	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/AdGuardHome/internal/vpn"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/hostsfile"
@@ -46,6 +51,7 @@ import (
 	"github.com/AdguardTeam/golibs/netutil/urlutil"
 	"github.com/AdguardTeam/golibs/osutil"
 	"github.com/AdguardTeam/golibs/osutil/executil"
+	"github.com/AdguardTeam/golibs/timeutil"
 )
 
 // Global context
@@ -198,6 +204,28 @@ func setupContext(
 		os.Exit(osutil.ExitCodeSuccess)
 	}
 
+	if opts.replayTarget != "" {
+		err = replayQueryLog(ctx, baseLogger, opts, workDir)
+		if err != nil {
+			baseLogger.ErrorContext(ctx, "replaying query log", slogutil.KeyError, err)
+
+			os.Exit(osutil.ExitCodeFailure)
+		}
+
+		os.Exit(osutil.ExitCodeSuccess)
+	}
+
+	if opts.importPath != "" {
+		err = importConfig(ctx, baseLogger, opts, workDir, confPath)
+		if err != nil {
+			baseLogger.ErrorContext(ctx, "importing configuration", slogutil.KeyError, err)
+
+			os.Exit(osutil.ExitCodeFailure)
+		}
+
+		os.Exit(osutil.ExitCodeSuccess)
+	}
+
 	return nil
 }
 
@@ -300,6 +328,33 @@ func setupHostsContainer(ctx context.Context, baseLogger *slog.Logger) (err erro
 	return hostsWatcher.Start(ctx)
 }
 
+// newFiltersWatcher returns a started watcher for the files of the local filter
+// lists or nil, if the watcher can't be initialized.  baseLogger must not be
+// nil.
+func newFiltersWatcher(ctx context.Context, baseLogger *slog.Logger) (w aghos.FSWatcher) {
+	l := baseLogger.With(slogutil.KeyPrefix, "filters_watcher")
+
+	w, err := aghos.NewOSWatcher(&aghos.OSWatcherConfig{
+		Logger: l,
+	})
+	if err == nil {
+		err = w.Start(ctx)
+	}
+
+	if err != nil {
+		l.WarnContext(
+			ctx,
+			"initializing filesystem watcher; not watching local filter files",
+			slogutil.KeyError,
+			err,
+		)
+
+		return nil
+	}
+
+	return w
+}
+
 // setupOpts sets up command-line options.
 func setupOpts(opts options) (err error) {
 	err = setupBindOpts(opts)
@@ -343,8 +398,51 @@ func initContextClients(
 	}
 
 	var arpDB arpdb.Interface
+	var arpWatcher arpdb.Watcher
 	if config.Clients.Sources.ARP {
-		arpDB = arpdb.New(logger.With(slogutil.KeyError, "arpdb"))
+		arpLogger := logger.With(slogutil.KeyError, "arpdb")
+		arpDB = arpdb.New(arpLogger)
+
+		arpWatcher, err = arpdb.NewWatcher(arpLogger)
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return fmt.Errorf("initing arp watcher: %w", err)
+		}
+	}
+
+	var disc discovery.Interface
+	if c := config.Clients.Discovery; config.Clients.Sources.Discovery && c != nil {
+		disc = discovery.New(&discovery.Config{
+			Logger:     logger.With(slogutil.KeyPrefix, "discovery"),
+			Interfaces: c.Interfaces,
+			Timeout:    time.Duration(c.Timeout),
+			MDNS:       c.MDNS,
+			NetBIOS:    c.NetBIOS,
+			SSDP:       c.SSDP,
+		})
+	}
+
+	var ids identity.Interface
+	if c := config.Clients.Identity; c != nil && c.Enabled {
+		ids, err = newIdentitySource(logger, c)
+		if err != nil {
+			return fmt.Errorf("initing identity source: %w", err)
+		}
+	}
+
+	var rtr router.Interface
+	if c := config.Clients.Router; c != nil && c.Enabled {
+		rtr, err = newRouter(logger, c)
+		if err != nil {
+			return fmt.Errorf("initing router: %w", err)
+		}
+	}
+
+	var vpnPeers vpn.Interface
+	if c := config.Clients.VPN; c != nil && c.Enabled {
+		vpnPeers, err = newVPN(logger, c)
+		if err != nil {
+			return fmt.Errorf("initing vpn: %w", err)
+		}
 	}
 
 	return globalContext.clients.Init(
@@ -354,6 +452,11 @@ func initContextClients(
 		globalContext.dhcpServer,
 		globalContext.etcHosts,
 		arpDB,
+		arpWatcher,
+		disc,
+		rtr,
+		vpnPeers,
+		ids,
 		config.Filtering,
 		sigHdlr,
 		confModifier,
@@ -361,6 +464,76 @@ func initContextClients(
 	)
 }
 
+// newIdentitySource returns the identity source of the clients configured by
+// c.  c must be valid.
+func newIdentitySource(logger *slog.Logger, c *clientIdentityConfig) (ids identity.Interface, err error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	// Don't use the common HTTP client, since it's created after the clients,
+	// and the identity source is usually in the local network.
+	return identity.NewREST(&identity.RESTConfig{
+		Logger:     logger.With(slogutil.KeyPrefix, "identity"),
+		HTTPClient: &http.Client{Timeout: time.Duration(c.Timeout)},
+		URL:        u,
+		Timeout:    time.Duration(c.Timeout),
+		CacheTTL:   time.Duration(c.CacheTTL),
+		CacheSize:  identityCacheSize,
+	}), nil
+}
+
+// newVPN returns the source of the VPN peers configured by c.  c must be valid.
+func newVPN(logger *slog.Logger, c *clientVPNConfig) (s *vpn.Source, err error) {
+	var u *url.URL
+	if c.URL != "" {
+		u, err = url.Parse(c.URL)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	// Don't use the common HTTP client for the same reasons as in
+	// [newIdentitySource].
+	return vpn.New(&vpn.Config{
+		Logger:     logger.With(slogutil.KeyPrefix, "vpn"),
+		HTTPClient: &http.Client{Timeout: time.Duration(c.Timeout)},
+		URL:        u,
+		Type:       c.Type,
+		ConfigFile: c.ConfigFile,
+		Tailnet:    c.Tailnet,
+		APIKey:     c.APIKey,
+	})
+}
+
+// identityCacheSize is the maximum number of the cached identities of the
+// clients.
+const identityCacheSize = 10_000
+
+// newRouter returns the upstream router configured by c.  c must be valid.
+func newRouter(logger *slog.Logger, c *clientRouterConfig) (r *router.Router, err error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	// Don't use the common HTTP client for the same reasons as in
+	// [newIdentitySource].
+	return router.New(&router.Config{
+		Logger:     logger.With(slogutil.KeyPrefix, "router"),
+		HTTPClient: &http.Client{Timeout: time.Duration(c.Timeout)},
+		URL:        u,
+		Type:       c.Type,
+		Username:   c.Username,
+		Password:   c.Password,
+		Site:       c.Site,
+	})
+}
+
 // setupBindOpts overrides bind host/port from the opts.
 func setupBindOpts(opts options) (err error) {
 	bindAddr := opts.bindAddr
@@ -524,6 +697,23 @@ func setupDNSFilteringConf(
 		return fmt.Errorf("initializing safesearch: %w", err)
 	}
 
+	conf.FilesWatcher = newFiltersWatcher(ctx, baseLogger)
+
+	if tf := conf.ThreatFeeds; tf != nil && tf.Enabled {
+		var s *threatfeed.Storage
+		s, err = threatfeed.New(&threatfeed.Config{
+			Logger:        baseLogger.With(slogutil.KeyPrefix, "threat_feeds"),
+			HTTPClient:    conf.HTTPClient,
+			Feeds:         tf.Feeds,
+			MinConfidence: tf.MinConfidence,
+		})
+		if err != nil {
+			return fmt.Errorf("initializing threat feeds: %w", err)
+		}
+
+		conf.ThreatChecker = s
+	}
+
 	return nil
 }
 
@@ -612,6 +802,10 @@ type webConfig struct {
 	// be nil.
 	auth *auth
 
+	// auditLog is the log of the changes of the configuration.  It's nil if
+	// the audit log is disabled.
+	auditLog *auditLog
+
 	// mux is the default *http.ServeMux, the same as [globalContext.mux]. It
 	// must not be nil.
 	mux *http.ServeMux
@@ -654,6 +848,14 @@ func newWeb(ctx context.Context, conf *webConfig) (web *webAPI, err error) {
 	}
 
 	disableUpdate := !isUpdateEnabled(ctx, conf.baseLogger, &conf.opts, conf.isCustomUpdURL)
+	openAPI := loadOpenAPISpec(ctx, logger, conf.clientBuildFS, conf.opts.localFrontend)
+	accessMw := newWebAccessMiddleware(&webAccessMiddlewareConfig{
+		logger:         logger,
+		clock:          timeutil.SystemClock{},
+		trustedProxies: netutil.SliceSubnetSet(netutil.UnembedPrefixes(config.DNS.TrustedProxies)),
+		dohPaths:       config.DNS.DoHPaths,
+		conf:           config.HTTPConfig.Management,
+	})
 
 	webConf := &webAPIConfig{
 		CommandConstructor: executil.SystemCommandConstructor{},
@@ -664,6 +866,9 @@ func newWeb(ctx context.Context, conf *webConfig) (web *webAPI, err error) {
 		httpReg:            conf.httpReg,
 		tlsManager:         conf.tlsManager,
 		auth:               conf.auth,
+		auditLog:           conf.auditLog,
+		openAPI:            openAPI,
+		accessMw:           accessMw,
 		mux:                conf.mux,
 
 		clientFS: clientFS,
@@ -762,6 +967,9 @@ func run(
 	// data first, but also to avoid relying on automatic Go init() function.
 	filtering.InitModule(ctx, baseLogger)
 
+	err = filtering.SetCustomBlockedServices(config.Filtering.CustomBlockedServices)
+	fatalOnError(err)
+
 	confModifier := newDefaultConfigModifier(
 		config,
 		baseLogger.With(slogutil.KeyPrefix, "config_modifier"),
@@ -800,6 +1008,16 @@ func run(
 
 	confModifier.setAuth(auth)
 
+	var audit *auditLog
+	if config.AuditLog != nil && config.AuditLog.Enabled {
+		audit = newAuditLog(
+			baseLogger.With(slogutil.KeyPrefix, "audit_log"),
+			timeutil.SystemClock{},
+			filepath.Join(dataDirPath, auditLogFileName),
+		)
+		confModifier.setAuditLog(audit)
+	}
+
 	conf := &webConfig{
 		clientBuildFS:  clientBuildFS,
 		updater:        upd,
@@ -807,6 +1025,7 @@ func run(
 		baseLogger:     baseLogger,
 		tlsManager:     tlsMgr,
 		auth:           auth,
+		auditLog:       audit,
 		mux:            mux,
 		configModifier: confModifier,
 		httpReg:        httpReg,
@@ -953,7 +1172,7 @@ func initUpdate(
 
 	if !isFirstRun {
 		// Save the updated config.
-		err = config.write(ctx, baseLogger, nil, nil, workDir, confPath)
+		err = config.write(ctx, baseLogger, nil, nil, nil, workDir, confPath)
 		fatalOnError(err)
 
 		if config.HTTPConfig.Pprof.Enabled {
@@ -1039,37 +1258,68 @@ func checkPermissions(
 }
 
 // initUsers initializes authentication module and clears the [config.Users]
-// field.
+// and [config.APITokens] fields.
 func initUsers(
 	ctx context.Context,
 	baseLogger *slog.Logger,
 	workDir string,
 	isGLiNet bool,
 ) (auth *auth, err error) {
-	var rateLimiter loginRateLimiter
+	var rateLimiter, tokenRateLimiter loginRateLimiter
 	if config.AuthAttempts > 0 && config.AuthBlockMin > 0 {
 		blockDur := time.Duration(config.AuthBlockMin) * time.Minute
-		rateLimiter = newAuthRateLimiter(blockDur, config.AuthAttempts)
+
+		var maxBlockDur time.Duration
+		if m := config.HTTPConfig.Management; m != nil {
+			maxBlockDur = time.Duration(m.MaxBlockDuration)
+		}
+
+		rateLimiter = newAuthRateLimiter(
+			baseLogger.With(slogutil.KeyPrefix, "authratelimiter"),
+			blockDur,
+			maxBlockDur,
+			config.AuthAttempts,
+		)
+		tokenRateLimiter = newAuthRateLimiter(
+			baseLogger.With(slogutil.KeyPrefix, "tokenratelimiter"),
+			blockDur,
+			maxBlockDur,
+			config.AuthAttempts,
+		)
 	} else {
 		baseLogger.WarnContext(ctx, "authratelimiter is disabled")
 		rateLimiter = emptyRateLimiter{}
+		tokenRateLimiter = emptyRateLimiter{}
+	}
+
+	var sso *oidcAuth
+	if c := config.OIDC; c != nil && c.Enabled {
+		sso, err = newOIDCAuth(baseLogger, c)
+		if err != nil {
+			return nil, fmt.Errorf("initializing oidc: %w", err)
+		}
 	}
 
 	dataDirPath := filepath.Join(workDir, dataDir)
 	auth, err = newAuth(ctx, &authConfig{
-		baseLogger:     baseLogger,
-		rateLimiter:    rateLimiter,
-		trustedProxies: netutil.SliceSubnetSet(netutil.UnembedPrefixes(config.DNS.TrustedProxies)),
-		dbFilename:     filepath.Join(dataDirPath, sessionsDBName),
-		users:          config.Users,
-		sessionTTL:     time.Duration(config.HTTPConfig.SessionTTL),
-		isGLiNet:       isGLiNet,
+		baseLogger:       baseLogger,
+		rateLimiter:      rateLimiter,
+		tokenRateLimiter: tokenRateLimiter,
+		trustedProxies:   netutil.SliceSubnetSet(netutil.UnembedPrefixes(config.DNS.TrustedProxies)),
+		dbFilename:       filepath.Join(dataDirPath, sessionsDBName),
+		users:            config.Users,
+		apiTokens:        config.APITokens,
+		oidc:             sso,
+		publicDashboard:  newPublicDashboard(config.HTTPConfig.PublicDashboard),
+		sessionTTL:       time.Duration(config.HTTPConfig.SessionTTL),
+		isGLiNet:         isGLiNet,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("initializing auth module: %w", err)
 	}
 
 	config.Users = nil
+	config.APITokens = nil
 
 	return auth, nil
 }
@@ -46,7 +46,11 @@ func expectsLargerRequests(r *http.Request) (ok bool) {
 	}
 
 	switch r.URL.Path {
-	case "/control/access/set", "/control/filtering/set_rules":
+	case
+		"/control/access/set",
+		"/control/clients/import",
+		"/control/config/import",
+		"/control/filtering/set_rules":
 		return true
 	default:
 		return false
@@ -0,0 +1,130 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	yaml "go.yaml.in/yaml/v4"
+)
+
+// openAPISpecPath is the path to the OpenAPI specification of the HTTP API
+// within the embedded filesystem as well as within the working directory of
+// the source tree.
+const openAPISpecPath = "openapi/openapi.yaml"
+
+// Paths of the HTTP APIs serving the OpenAPI specification.
+const (
+	openAPIJSONPath = "/control/openapi.json"
+	openAPIYAMLPath = "/control/openapi.yaml"
+)
+
+// openAPISpec is the OpenAPI specification of the HTTP API encoded in both of
+// the supported formats.
+type openAPISpec struct {
+	json []byte
+	yaml []byte
+}
+
+// newOpenAPISpec returns the specification decoded from the YAML document
+// data.
+func newOpenAPISpec(data []byte) (s *openAPISpec, err error) {
+	var doc any
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("decoding yaml: %w", err)
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("encoding json: %w", err)
+	}
+
+	return &openAPISpec{
+		json: b,
+		yaml: data,
+	}, nil
+}
+
+// loadOpenAPISpec returns the specification from clientBuildFS or, if
+// localFrontend is true, from the working directory.  s is nil if the
+// specification isn't available, since it must not prevent the web interface
+// from starting.
+func loadOpenAPISpec(
+	ctx context.Context,
+	l *slog.Logger,
+	clientBuildFS fs.FS,
+	localFrontend bool,
+) (s *openAPISpec) {
+	var data []byte
+	var err error
+	switch {
+	case localFrontend:
+		data, err = os.ReadFile(openAPISpecPath)
+	case clientBuildFS == nil:
+		err = errors.Error("no embedded filesystem")
+	default:
+		data, err = fs.ReadFile(clientBuildFS, openAPISpecPath)
+	}
+
+	if err == nil {
+		s, err = newOpenAPISpec(data)
+	}
+
+	if err != nil {
+		l.WarnContext(ctx, "openapi specification is not available", slogutil.KeyError, err)
+
+		return nil
+	}
+
+	return s
+}
+
+// handleOpenAPIJSON is the handler for the GET /control/openapi.json HTTP API.
+func (web *webAPI) handleOpenAPIJSON(w http.ResponseWriter, r *http.Request) {
+	web.serveOpenAPI(w, r, true)
+}
+
+// handleOpenAPIYAML is the handler for the GET /control/openapi.yaml HTTP API.
+func (web *webAPI) handleOpenAPIYAML(w http.ResponseWriter, r *http.Request) {
+	web.serveOpenAPI(w, r, false)
+}
+
+// serveOpenAPI writes the specification encoded as JSON, if isJSON is true, or
+// as YAML otherwise to w.
+func (web *webAPI) serveOpenAPI(w http.ResponseWriter, r *http.Request, isJSON bool) {
+	ctx := r.Context()
+	l := web.logger
+
+	if web.openAPI == nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusNotFound, "openapi specification is not available")
+
+		return
+	}
+
+	ct, b := "application/yaml", web.openAPI.yaml
+	if isJSON {
+		ct, b = aghhttp.HdrValApplicationJSON, web.openAPI.json
+	}
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, ct)
+	h.Set(httphdr.Server, aghhttp.UserAgent())
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err := w.Write(b)
+	if err != nil {
+		// Don't use aghhttp.ErrorAndLog, since the headers have already been
+		// sent.
+		l.ErrorContext(ctx, "writing openapi specification", slogutil.KeyError, err)
+	}
+}
@@ -0,0 +1,152 @@
+package home
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOpenAPIPath is the path to the OpenAPI specification of the source tree
+// relative to the directory of the package.
+const testOpenAPIPath = "../../" + openAPISpecPath
+
+// testRouteRe matches the registrations of the HTTP API routes in the source
+// code.
+var testRouteRe = regexp.MustCompile(`http\.Method(\w+),\s*"/control(/[^"]+)"`)
+
+// testOpenAPIDoc is the part of the OpenAPI specification used in tests.
+type testOpenAPIDoc struct {
+	Paths map[string]map[string]any `json:"paths"`
+}
+
+// newTestOpenAPISpec returns the OpenAPI specification of the source tree.
+func newTestOpenAPISpec(tb testing.TB) (s *openAPISpec) {
+	tb.Helper()
+
+	data, err := os.ReadFile(testOpenAPIPath)
+	require.NoError(tb, err)
+
+	s, err = newOpenAPISpec(data)
+	require.NoError(tb, err)
+
+	return s
+}
+
+// TestOpenAPISpec_routes makes sure that every HTTP API route registered in
+// the source code is documented in the OpenAPI specification.
+func TestOpenAPISpec_routes(t *testing.T) {
+	t.Parallel()
+
+	doc := &testOpenAPIDoc{}
+	err := json.Unmarshal(newTestOpenAPISpec(t).json, doc)
+	require.NoError(t, err)
+	require.NotEmpty(t, doc.Paths)
+
+	var numRoutes int
+	err = filepath.WalkDir("..", func(p string, d fs.DirEntry, walkErr error) (err error) {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		if d.IsDir() {
+			if d.Name() == "next" {
+				// The new API has its own specification.
+				return fs.SkipDir
+			}
+
+			return nil
+		} else if filepath.Ext(p) != ".go" || strings.HasSuffix(p, "_test.go") {
+			return nil
+		}
+
+		// #nosec G304 -- Trust the paths within the source tree.
+		src, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range testRouteRe.FindAllSubmatch(src, -1) {
+			method, route := strings.ToLower(string(m[1])), string(m[2])
+			assert.Containsf(t, doc.Paths[route], method, "%s %s in %s", method, route, p)
+			numRoutes++
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Positive(t, numRoutes)
+}
+
+func TestWeb_HandleOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(testOpenAPIPath)
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	buildFS := fstest.MapFS{
+		openAPISpecPath: &fstest.MapFile{Data: data},
+	}
+
+	web := &webAPI{
+		logger:  testLogger,
+		openAPI: loadOpenAPISpec(ctx, testLogger, buildFS, false),
+	}
+	require.NotNil(t, web.openAPI)
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, openAPIJSONPath, nil)
+		web.handleOpenAPIJSON(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, aghhttp.HdrValApplicationJSON, w.Header().Get(httphdr.ContentType))
+
+		doc := &testOpenAPIDoc{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), doc))
+
+		assert.Contains(t, doc.Paths, "/status")
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, openAPIYAMLPath, nil)
+		web.handleOpenAPIYAML(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, data, w.Body.Bytes())
+	})
+
+	t.Run("not_available", func(t *testing.T) {
+		t.Parallel()
+
+		noSpecWeb := &webAPI{
+			logger:  testLogger,
+			openAPI: loadOpenAPISpec(ctx, testLogger, fstest.MapFS{}, false),
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, openAPIJSONPath, nil)
+		noSpecWeb.handleOpenAPIJSON(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
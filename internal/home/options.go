@@ -8,6 +8,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/configmigrate"
 	"github.com/AdguardTeam/AdGuardHome/internal/version"
@@ -87,6 +88,31 @@ type options struct {
 	// noPermCheck disables checking and migration of permissions for the
 	// security-sensitive files.
 	noPermCheck bool
+
+	// replayTarget is the address of the DNS server to replay the query log
+	// against.  If it's not empty, AdGuard Home replays the query log and
+	// exits.
+	replayTarget string
+
+	// replaySince, if not zero, is the time of the oldest replayed query log
+	// entry.
+	replaySince time.Time
+
+	// replayUntil, if not zero, is the time of the newest replayed query log
+	// entry.
+	replayUntil time.Time
+
+	// replayPace, if set, makes the replayed queries keep their original
+	// intervals.
+	replayPace bool
+
+	// importPath is the path to the configuration of another DNS server to
+	// import.  If it's not empty, AdGuard Home imports the configuration and
+	// exits.
+	importPath string
+
+	// importFrom is the format of the imported configuration.
+	importFrom importFormat
 }
 
 // initCmdLineOpts completes initialization of the global command-line option
@@ -323,6 +349,74 @@ var cmdLineOpts = []cmdLineOpt{{
 		"of security-sensitive files.",
 	longName:  "no-permcheck",
 	shortName: "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) { o.replayTarget = v; return o, nil },
+	updateNoValue:   nil,
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return o.replayTarget, o.replayTarget != "" },
+	description: "Replay the questions from the query log against the DNS server " +
+		"at the address and exit.",
+	longName:  "replay-querylog",
+	shortName: "",
+}, {
+	updateWithValue: func(o options, v string) (oo options, err error) {
+		o.replaySince, err = time.Parse(time.RFC3339, v)
+
+		return o, err
+	},
+	updateNoValue: nil,
+	effect:        nil,
+	serialize: func(o options) (val string, ok bool) {
+		return o.replaySince.Format(time.RFC3339), !o.replaySince.IsZero()
+	},
+	description: "Only replay the query log entries not older than the RFC 3339 time.",
+	longName:    "replay-since",
+	shortName:   "",
+}, {
+	updateWithValue: func(o options, v string) (oo options, err error) {
+		o.replayUntil, err = time.Parse(time.RFC3339, v)
+
+		return o, err
+	},
+	updateNoValue: nil,
+	effect:        nil,
+	serialize: func(o options) (val string, ok bool) {
+		return o.replayUntil.Format(time.RFC3339), !o.replayUntil.IsZero()
+	},
+	description: "Only replay the query log entries not newer than the RFC 3339 time.",
+	longName:    "replay-until",
+	shortName:   "",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.replayPace = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", o.replayPace },
+	description:     "Keep the original intervals between the replayed queries.",
+	longName:        "replay-pace",
+	shortName:       "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) { o.importPath = v; return o, nil },
+	updateNoValue:   nil,
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return o.importPath, o.importPath != "" },
+	description: "Import the configuration of another DNS server from the file or the directory " +
+		"at the path and exit.  AdGuard Home must not be running.",
+	longName:  "import",
+	shortName: "",
+}, {
+	updateWithValue: func(o options, v string) (oo options, err error) {
+		o.importFrom, err = parseImportFormat(v)
+
+		return o, err
+	},
+	updateNoValue: nil,
+	effect:        nil,
+	serialize: func(o options) (val string, ok bool) {
+		return string(o.importFrom), o.importFrom != ""
+	},
+	description: "Format of the imported configuration: dnsmasq or pihole.",
+	longName:    "import-from",
+	shortName:   "",
 }, {
 	updateWithValue: nil,
 	updateNoValue:   nil,
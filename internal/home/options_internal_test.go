@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -153,6 +154,61 @@ func TestParseGLInet(t *testing.T) {
 	assert.True(t, testParseOK(t, "--glinet").glinetMode, "--glinet is GL-Inet mode")
 }
 
+func TestParseReplay(t *testing.T) {
+	wantTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	assert.Equal(t, "", testParseOK(t).replayTarget, "empty is no replay target")
+	assert.Equal(
+		t,
+		"127.0.0.1:53",
+		testParseOK(t, "--replay-querylog", "127.0.0.1:53").replayTarget,
+		"--replay-querylog is replay target",
+	)
+	testParseParamMissing(t, "--replay-querylog")
+
+	assert.True(
+		t,
+		wantTime.Equal(testParseOK(t, "--replay-since", "2026-01-02T03:04:05Z").replaySince),
+		"--replay-since is replay since",
+	)
+	testParseErr(t, "not a time", "--replay-since", "x")
+
+	assert.True(
+		t,
+		wantTime.Equal(testParseOK(t, "--replay-until", "2026-01-02T03:04:05Z").replayUntil),
+		"--replay-until is replay until",
+	)
+	testParseErr(t, "not a time", "--replay-until", "x")
+
+	assert.False(t, testParseOK(t).replayPace, "empty is not replay pace")
+	assert.True(t, testParseOK(t, "--replay-pace").replayPace, "--replay-pace is replay pace")
+}
+
+func TestParseImport(t *testing.T) {
+	assert.Equal(t, "", testParseOK(t).importPath, "empty is no import path")
+	assert.Equal(
+		t,
+		"/etc/dnsmasq.conf",
+		testParseOK(t, "--import", "/etc/dnsmasq.conf").importPath,
+		"--import is import path",
+	)
+	testParseParamMissing(t, "--import")
+
+	assert.Equal(
+		t,
+		importFormatDnsmasq,
+		testParseOK(t, "--import-from", "dnsmasq").importFrom,
+		"--import-from is import format",
+	)
+	assert.Equal(
+		t,
+		importFormatPihole,
+		testParseOK(t, "--import-from", "pihole").importFrom,
+		"--import-from is import format",
+	)
+	testParseErr(t, "bad format", "--import-from", "bind")
+}
+
 func TestParseUnknown(t *testing.T) {
 	testParseErr(t, "unknown word", "x")
 	testParseErr(t, "unknown short", "-x")
@@ -215,6 +271,25 @@ func TestOptsToArgs(t *testing.T) {
 		name: "glinet_mode",
 		args: []string{"--glinet"},
 		opts: options{glinetMode: true},
+	}, {
+		name: "replay",
+		args: []string{
+			"--replay-querylog", "127.0.0.1:53",
+			"--replay-since", "2026-01-02T03:04:05Z",
+			"--replay-pace",
+		},
+		opts: options{
+			replayTarget: "127.0.0.1:53",
+			replaySince:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			replayPace:   true,
+		},
+	}, {
+		name: "import",
+		args: []string{"--import", "/etc/dnsmasq.conf", "--import-from", "dnsmasq"},
+		opts: options{
+			importPath: "/etc/dnsmasq.conf",
+			importFrom: importFormatDnsmasq,
+		},
 	}, {
 		name: "multiple",
 		args: []string{
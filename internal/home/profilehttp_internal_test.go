@@ -60,13 +60,14 @@ func TestWeb_HandleGetProfile(t *testing.T) {
 	}
 
 	auth, err := newAuth(testutil.ContextWithTimeout(t, testTimeout), &authConfig{
-		baseLogger:     testLogger,
-		rateLimiter:    emptyRateLimiter{},
-		trustedProxies: nil,
-		dbFilename:     sessionsDB,
-		users:          nil,
-		sessionTTL:     testTTL * time.Second,
-		isGLiNet:       false,
+		baseLogger:       testLogger,
+		rateLimiter:      emptyRateLimiter{},
+		tokenRateLimiter: emptyRateLimiter{},
+		trustedProxies:   nil,
+		dbFilename:       sessionsDB,
+		users:            nil,
+		sessionTTL:       testTTL * time.Second,
+		isGLiNet:         false,
 	})
 	require.NoError(t, err)
 
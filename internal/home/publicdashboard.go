@@ -0,0 +1,73 @@
+package home
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"path"
+)
+
+// Paths of the read-only public dashboard.
+const (
+	// publicDashboardPagePattern matches the page of the public dashboard as
+	// well as its scripts and styles.
+	publicDashboardPagePattern = "/dashboard.*"
+
+	// publicDashboardAPIPath is the path of the HTTP API, which returns the
+	// aggregate statistics for the public dashboard.
+	publicDashboardAPIPath = "/control/stats/public"
+)
+
+// queryKeyPublicDashboardToken is the key of the query parameter that contains
+// the token of the public dashboard.
+const queryKeyPublicDashboardToken = "token"
+
+// publicDashboard controls the unauthenticated access to the read-only public
+// dashboard.  A nil *publicDashboard denies all access.
+type publicDashboard struct {
+	// token is the token required to access the statistics.  If it's empty,
+	// the statistics are available to everyone.
+	token []byte
+}
+
+// newPublicDashboard returns a new properly initialized *publicDashboard or nil
+// if the public dashboard is disabled in c.
+func newPublicDashboard(c *httpPublicDashboardConfig) (d *publicDashboard) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	return &publicDashboard{
+		token: []byte(c.Token),
+	}
+}
+
+// allows returns true if r may be served without the authentication.
+func (d *publicDashboard) allows(r *http.Request) (ok bool) {
+	if d == nil || r.Method != http.MethodGet {
+		return false
+	}
+
+	p := r.URL.Path
+	if p == publicDashboardAPIPath {
+		return d.isValidToken(r.URL.Query().Get(queryKeyPublicDashboardToken))
+	}
+
+	isPage, err := path.Match(publicDashboardPagePattern, p)
+	if err != nil {
+		// The only error that is returned from path.Match is
+		// [path.ErrBadPattern].  This is a programmer error.
+		panic(fmt.Errorf("bad dashboard pattern: %w", err))
+	}
+
+	return isPage
+}
+
+// isValidToken returns true if token grants the access to the statistics.
+func (d *publicDashboard) isValidToken(token string) (ok bool) {
+	if len(d.token) == 0 {
+		return true
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), d.token) == 1
+}
@@ -0,0 +1,161 @@
+package home
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddlewareDefault_publicDashboard(t *testing.T) {
+	t.Parallel()
+
+	const testToken = "dashboard_token"
+
+	usersDB := newTestUsersDB()
+	usersDB.onAll = func(_ context.Context) (us []*aghuser.User, err error) {
+		return []*aghuser.User{{Login: "user_login"}}, nil
+	}
+
+	tokens, err := newAPITokens(nil)
+	require.NoError(t, err)
+
+	// newMiddleware returns the authentication middleware with the public
+	// dashboard configured by c.
+	newMiddleware := func(c *httpPublicDashboardConfig) (mw *authMiddlewareDefault) {
+		return newAuthMiddlewareDefault(&authMiddlewareDefaultConfig{
+			logger:           testLogger,
+			rateLimiter:      emptyRateLimiter{},
+			tokenRateLimiter: emptyRateLimiter{},
+			sessions:         newTestSessionStorage(),
+			users:            usersDB,
+			apiTokens:        tokens,
+			publicDashboard:  newPublicDashboard(c),
+		})
+	}
+
+	disabled := newMiddleware(&httpPublicDashboardConfig{
+		Token:   "",
+		Enabled: false,
+	})
+	open := newMiddleware(&httpPublicDashboardConfig{
+		Token:   "",
+		Enabled: true,
+	})
+	protected := newMiddleware(&httpPublicDashboardConfig{
+		Token:   testToken,
+		Enabled: true,
+	})
+
+	testCases := []struct {
+		mw         *authMiddlewareDefault
+		name       string
+		method     string
+		target     string
+		wantCode   int
+		wantCalled bool
+	}{{
+		mw:         disabled,
+		name:       "disabled_stats",
+		method:     http.MethodGet,
+		target:     publicDashboardAPIPath,
+		wantCode:   http.StatusUnauthorized,
+		wantCalled: false,
+	}, {
+		mw:         disabled,
+		name:       "disabled_page",
+		method:     http.MethodGet,
+		target:     "/dashboard.html",
+		wantCode:   http.StatusUnauthorized,
+		wantCalled: false,
+	}, {
+		mw:         open,
+		name:       "open_stats",
+		method:     http.MethodGet,
+		target:     publicDashboardAPIPath,
+		wantCode:   http.StatusOK,
+		wantCalled: true,
+	}, {
+		mw:         open,
+		name:       "open_page",
+		method:     http.MethodGet,
+		target:     "/dashboard.html",
+		wantCode:   http.StatusOK,
+		wantCalled: true,
+	}, {
+		mw:         open,
+		name:       "open_script",
+		method:     http.MethodGet,
+		target:     "/dashboard.0123abcd.js",
+		wantCode:   http.StatusOK,
+		wantCalled: true,
+	}, {
+		mw:         open,
+		name:       "open_full_stats",
+		method:     http.MethodGet,
+		target:     "/control/stats",
+		wantCode:   http.StatusUnauthorized,
+		wantCalled: false,
+	}, {
+		mw:         open,
+		name:       "open_querylog",
+		method:     http.MethodGet,
+		target:     "/control/querylog",
+		wantCode:   http.StatusUnauthorized,
+		wantCalled: false,
+	}, {
+		mw:         open,
+		name:       "open_post",
+		method:     http.MethodPost,
+		target:     publicDashboardAPIPath,
+		wantCode:   http.StatusUnauthorized,
+		wantCalled: false,
+	}, {
+		mw:         protected,
+		name:       "protected_no_token",
+		method:     http.MethodGet,
+		target:     publicDashboardAPIPath,
+		wantCode:   http.StatusUnauthorized,
+		wantCalled: false,
+	}, {
+		mw:         protected,
+		name:       "protected_bad_token",
+		method:     http.MethodGet,
+		target:     publicDashboardAPIPath + "?token=bad",
+		wantCode:   http.StatusUnauthorized,
+		wantCalled: false,
+	}, {
+		mw:         protected,
+		name:       "protected_token",
+		method:     http.MethodGet,
+		target:     publicDashboardAPIPath + "?token=" + testToken,
+		wantCode:   http.StatusOK,
+		wantCalled: true,
+	}, {
+		mw:         protected,
+		name:       "protected_page",
+		method:     http.MethodGet,
+		target:     "/dashboard.html",
+		wantCode:   http.StatusOK,
+		wantCalled: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+
+			h := &testAuthHandler{}
+			w := httptest.NewRecorder()
+			tc.mw.Wrap(h).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Equal(t, tc.wantCalled, h.called)
+		})
+	}
+}
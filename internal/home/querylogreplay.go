@@ -0,0 +1,65 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghslog"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// replayQueryLog replays the query log files of the parsed configuration
+// against the DNS server from opts.  baseLogger must not be nil.
+func replayQueryLog(
+	ctx context.Context,
+	baseLogger *slog.Logger,
+	opts options,
+	workDir string,
+) (err error) {
+	_, querylogDir, err := checkStatsAndQuerylogDirs(config, workDir)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	ups, err := upstream.AddressToUpstream(opts.replayTarget, &upstream.Options{
+		Logger:  aghslog.NewForUpstream(baseLogger, aghslog.UpstreamTypeTest),
+		Timeout: time.Duration(config.DNS.UpstreamTimeout),
+	})
+	if err != nil {
+		return fmt.Errorf("creating upstream: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, ups.Close()) }()
+
+	l := baseLogger.With(slogutil.KeyPrefix, "querylog_replay")
+	l.InfoContext(ctx, "replaying query log", "target", opts.replayTarget, "dir", querylogDir)
+
+	start := time.Now()
+	res, err := querylog.Replay(ctx, &querylog.ReplayConfig{
+		Logger:   l,
+		Upstream: ups,
+		BaseDir:  querylogDir,
+		Since:    opts.replaySince,
+		Until:    opts.replayUntil,
+		Pace:     opts.replayPace,
+	})
+	if err != nil {
+		return fmt.Errorf("replaying: %w", err)
+	}
+
+	l.InfoContext(
+		ctx,
+		"replayed query log",
+		"sent", res.Sent,
+		"failed", res.Failed,
+		"rcode_mismatched", res.Mismatched,
+		"elapsed", time.Since(start),
+	)
+
+	return nil
+}
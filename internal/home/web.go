@@ -70,6 +70,18 @@ type webAPIConfig struct {
 	// be nil.
 	auth *auth
 
+	// auditLog is the log of the changes of the configuration.  It's nil if
+	// the audit log is disabled.
+	auditLog *auditLog
+
+	// openAPI is the OpenAPI specification of the HTTP API.  It's nil if the
+	// specification isn't available.
+	openAPI *openAPISpec
+
+	// accessMw restricts the access to the web interface and the HTTP API.
+	// It must not be nil.
+	accessMw *webAccessMiddleware
+
 	// mux is the default *http.ServeMux, the same as [globalContext.mux].  It
 	// must not be nil.
 	mux *http.ServeMux
@@ -161,6 +173,14 @@ type webAPI struct {
 	// auth stores web user information and handles authentication.
 	auth *auth
 
+	// auditLog is the log of the changes of the configuration.  It's nil if
+	// the audit log is disabled.
+	auditLog *auditLog
+
+	// openAPI is the OpenAPI specification of the HTTP API.  It's nil if the
+	// specification isn't available.
+	openAPI *openAPISpec
+
 	// httpsServer is the server that handles HTTPS traffic.  If it is not nil,
 	// [Web.http3Server] must also not be nil.
 	httpsServer httpsServer
@@ -185,6 +205,8 @@ func newWebAPI(ctx context.Context, conf *webAPIConfig) (w *webAPI) {
 		baseLogger:   conf.baseLogger,
 		tlsManager:   conf.tlsManager,
 		auth:         conf.auth,
+		auditLog:     conf.auditLog,
+		openAPI:      conf.openAPI,
 		startTime:    time.Now(),
 	}
 
@@ -280,7 +302,7 @@ func (web *webAPI) start(ctx context.Context) {
 		// Create a new instance, because the Web is not usable after Shutdown.
 		web.httpServer = &http.Server{
 			Addr:              web.conf.BindAddr.String(),
-			Handler:           web.auth.middleware().Wrap(hdlr),
+			Handler:           web.conf.accessMw.Wrap(web.auth.middleware().Wrap(hdlr)),
 			ReadTimeout:       web.conf.ReadTimeout,
 			ReadHeaderTimeout: web.conf.ReadHeaderTimeout,
 			WriteTimeout:      web.conf.WriteTimeout,
@@ -364,7 +386,7 @@ func (web *webAPI) serveTLS(ctx context.Context) (next bool) {
 
 	web.httpsServer.server = &http.Server{
 		Addr:    addr,
-		Handler: web.auth.middleware().Wrap(hdlr),
+		Handler: web.conf.accessMw.Wrap(web.auth.middleware().Wrap(hdlr)),
 		TLSConfig: &tls.Config{
 			Certificates: []tls.Certificate{web.httpsServer.cert},
 			RootCAs:      web.tlsManager.rootCerts,
@@ -428,7 +450,9 @@ func (web *webAPI) mustStartHTTP3(ctx context.Context, address string) {
 			CipherSuites: web.tlsManager.customCipherIDs,
 			MinVersion:   tls.VersionTLS12,
 		},
-		Handler: web.auth.middleware().Wrap(withMiddlewares(web.conf.mux, limitRequestBody)),
+		Handler: web.conf.accessMw.Wrap(
+			web.auth.middleware().Wrap(withMiddlewares(web.conf.mux, limitRequestBody)),
+		),
 	}
 
 	web.logger.DebugContext(ctx, "starting http/3 server")
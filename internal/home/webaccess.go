@@ -0,0 +1,247 @@
+package home
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/netutil/httputil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// apiRateMaxClients is the maximum number of the clients tracked by
+// [apiRateLimiter].
+const apiRateMaxClients = 1024
+
+// apiRateWindow is the number of the requests of a client within a second.
+type apiRateWindow struct {
+	// sec is the Unix time of the second.
+	sec int64
+
+	num uint
+}
+
+// apiRateLimiter limits the number of the requests to the HTTP API per second
+// from a single client.
+type apiRateLimiter struct {
+	clock timeutil.Clock
+
+	// mu protects windows.
+	mu      *sync.Mutex
+	windows map[netip.Addr]apiRateWindow
+
+	rps uint
+}
+
+// newAPIRateLimiter returns a new properly initialized *apiRateLimiter.  rps
+// must be positive.
+func newAPIRateLimiter(clock timeutil.Clock, rps uint) (l *apiRateLimiter) {
+	return &apiRateLimiter{
+		clock:   clock,
+		mu:      &sync.Mutex{},
+		windows: map[netip.Addr]apiRateWindow{},
+		rps:     rps,
+	}
+}
+
+// allow returns true if the request from ip fits into the limit.
+func (l *apiRateLimiter) allow(ip netip.Addr) (ok bool) {
+	sec := l.clock.Now().Unix()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.windows[ip]
+	if !ok && len(l.windows) >= apiRateMaxClients {
+		l.evictLocked(sec)
+	}
+
+	if w.sec != sec {
+		w = apiRateWindow{sec: sec}
+	}
+
+	w.num++
+	l.windows[ip] = w
+
+	return w.num <= l.rps
+}
+
+// evictLocked removes the windows of the previous seconds.  If all windows
+// belong to sec, it removes an arbitrary one, so that the number of the tracked
+// clients never exceeds [apiRateMaxClients].  l.mu must be locked.
+func (l *apiRateLimiter) evictLocked(sec int64) {
+	for addr, w := range l.windows {
+		if w.sec != sec {
+			delete(l.windows, addr)
+		}
+	}
+
+	if len(l.windows) < apiRateMaxClients {
+		return
+	}
+
+	for addr := range l.windows {
+		delete(l.windows, addr)
+
+		return
+	}
+}
+
+// webAccessMiddlewareConfig is the configuration structure for
+// [webAccessMiddleware].
+type webAccessMiddlewareConfig struct {
+	// logger is used to log the rejected requests.  It must not be nil.
+	logger *slog.Logger
+
+	// clock is used to count the requests.  It must not be nil.
+	clock timeutil.Clock
+
+	// trustedProxies are the subnets of the reverse proxies, the headers of
+	// the requests from which are used to get the addresses of the clients.
+	// It must not be nil.
+	trustedProxies netutil.SubnetSet
+
+	// dohPaths are the additional paths of DNS-over-HTTPS, besides
+	// "/dns-query".
+	dohPaths []string
+
+	// conf is the configuration of the protection.  If it's nil, all requests
+	// are allowed.
+	conf *httpManagementConfig
+}
+
+// webAccessMiddleware restricts the access to the web interface and the HTTP
+// API by the addresses of the clients and limits the rate of the requests to
+// the HTTP API.  DNS-over-HTTPS and the mobile configuration profiles aren't
+// restricted.
+type webAccessMiddleware struct {
+	logger         *slog.Logger
+	trustedProxies netutil.SubnetSet
+	dohPaths       []string
+
+	// allowed is nil if all clients are allowed.
+	allowed netutil.SubnetSet
+
+	// limiter is nil if the rate of the requests isn't limited.
+	limiter *apiRateLimiter
+}
+
+// newWebAccessMiddleware returns a new properly initialized
+// *webAccessMiddleware.  c must not be nil.
+func newWebAccessMiddleware(c *webAccessMiddlewareConfig) (mw *webAccessMiddleware) {
+	mw = &webAccessMiddleware{
+		logger:         c.logger,
+		trustedProxies: c.trustedProxies,
+		dohPaths:       []string{"/dns-query"},
+	}
+
+	for _, p := range c.dohPaths {
+		mw.dohPaths = append(mw.dohPaths, "/"+strings.TrimPrefix(p, "/"))
+	}
+
+	if c.conf == nil {
+		return mw
+	}
+
+	if len(c.conf.AllowedClients) > 0 {
+		mw.allowed = netutil.SliceSubnetSet(netutil.UnembedPrefixes(c.conf.AllowedClients))
+	}
+
+	if c.conf.RateLimit > 0 {
+		mw.limiter = newAPIRateLimiter(c.clock, c.conf.RateLimit)
+	}
+
+	return mw
+}
+
+// type check
+var _ httputil.Middleware = (*webAccessMiddleware)(nil)
+
+// Wrap implements the [httputil.Middleware] interface for *webAccessMiddleware.
+func (mw *webAccessMiddleware) Wrap(h http.Handler) (wrapped http.Handler) {
+	if mw.allowed == nil && mw.limiter == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if !mw.isManagementPath(p) {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		ctx := r.Context()
+		ip, ok := mw.clientIP(ctx, r)
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusBadRequest)
+		case !mw.isAllowed(ip):
+			mw.logger.InfoContext(ctx, "management access denied", "client_ip", ip, "path", p)
+			http.Error(w, "access denied", http.StatusForbidden)
+		case mw.limiter != nil && strings.HasPrefix(p, "/control/") && !mw.limiter.allow(ip):
+			mw.logger.DebugContext(ctx, "api rate limit exceeded", "client_ip", ip, "path", p)
+			w.Header().Set(httphdr.RetryAfter, "1")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// clientIP returns the address of the client of r.  The headers of r are only
+// used if it's been sent by a trusted proxy, see [webAPI.handleLogin].
+func (mw *webAccessMiddleware) clientIP(
+	ctx context.Context,
+	r *http.Request,
+) (ip netip.Addr, ok bool) {
+	ipStr, err := netutil.SplitHost(r.RemoteAddr)
+	if err == nil {
+		ip, err = netip.ParseAddr(ipStr)
+	}
+
+	if err != nil {
+		mw.logger.DebugContext(ctx, "bad remote address", "addr", r.RemoteAddr)
+
+		return netip.Addr{}, false
+	}
+
+	ip = ip.Unmap()
+	if !mw.trustedProxies.Contains(ip) {
+		return ip, true
+	}
+
+	realAddr, err := realIP(r)
+	if err != nil {
+		return ip, true
+	}
+
+	return realAddr.Unmap(), true
+}
+
+// isAllowed returns true if the client with ip is allowed to access the web
+// interface and the HTTP API.
+func (mw *webAccessMiddleware) isAllowed(ip netip.Addr) (ok bool) {
+	return mw.allowed == nil || ip.IsLoopback() || mw.allowed.Contains(ip)
+}
+
+// isManagementPath returns true if p is the path of the web interface or the
+// HTTP API, as opposed to DNS-over-HTTPS and the mobile configuration profiles.
+func (mw *webAccessMiddleware) isManagementPath(p string) (ok bool) {
+	if strings.HasPrefix(p, "/apple/") {
+		return false
+	}
+
+	for _, doh := range mw.dohPaths {
+		if p == doh || strings.HasPrefix(p, doh+"/") {
+			return false
+		}
+	}
+
+	return true
+}
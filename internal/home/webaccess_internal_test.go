@@ -0,0 +1,194 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHandlerOK is an HTTP handler, which always responds with 200 OK.
+var testHandlerOK = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestWebAccessMiddleware_allowlist(t *testing.T) {
+	t.Parallel()
+
+	proxy := netip.MustParsePrefix("192.0.2.0/24")
+	mw := newWebAccessMiddleware(&webAccessMiddlewareConfig{
+		logger:         testLogger,
+		clock:          timeutil.SystemClock{},
+		trustedProxies: proxy,
+		dohPaths:       []string{"custom-doh"},
+		conf: &httpManagementConfig{
+			AllowedClients: []netutil.Prefix{{
+				Prefix: netip.MustParsePrefix("198.51.100.0/24"),
+			}},
+		},
+	})
+
+	h := mw.Wrap(testHandlerOK)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		path       string
+		wantCode   int
+	}{{
+		name:       "allowed",
+		remoteAddr: "198.51.100.1:1234",
+		realIP:     "",
+		path:       "/control/status",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "denied",
+		remoteAddr: "203.0.113.1:1234",
+		realIP:     "",
+		path:       "/control/status",
+		wantCode:   http.StatusForbidden,
+	}, {
+		name:       "denied_ui",
+		remoteAddr: "203.0.113.1:1234",
+		realIP:     "",
+		path:       "/login.html",
+		wantCode:   http.StatusForbidden,
+	}, {
+		name:       "loopback",
+		remoteAddr: "127.0.0.1:1234",
+		realIP:     "",
+		path:       "/control/status",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "doh",
+		remoteAddr: "203.0.113.1:1234",
+		realIP:     "",
+		path:       "/dns-query/client-1",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "custom_doh",
+		remoteAddr: "203.0.113.1:1234",
+		realIP:     "",
+		path:       "/custom-doh",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "mobileconfig",
+		remoteAddr: "203.0.113.1:1234",
+		realIP:     "",
+		path:       "/apple/doh.mobileconfig",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "trusted_proxy_allowed",
+		remoteAddr: "192.0.2.1:1234",
+		realIP:     "198.51.100.2",
+		path:       "/control/status",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "trusted_proxy_denied",
+		remoteAddr: "192.0.2.1:1234",
+		realIP:     "203.0.113.2",
+		path:       "/control/status",
+		wantCode:   http.StatusForbidden,
+	}, {
+		name:       "untrusted_proxy",
+		remoteAddr: "203.0.113.1:1234",
+		realIP:     "198.51.100.2",
+		path:       "/control/status",
+		wantCode:   http.StatusForbidden,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.realIP != "" {
+				r.Header.Set(httphdr.XRealIP, tc.realIP)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+		})
+	}
+}
+
+func TestWebAccessMiddleware_rateLimit(t *testing.T) {
+	t.Parallel()
+
+	const rps = 2
+
+	now := time.Unix(1_000_000, 0)
+	mw := newWebAccessMiddleware(&webAccessMiddlewareConfig{
+		logger: testLogger,
+		clock: &faketime.Clock{
+			OnNow: func() (n time.Time) { return now },
+		},
+		trustedProxies: netutil.SliceSubnetSet(nil),
+		conf: &httpManagementConfig{
+			RateLimit: rps,
+		},
+	})
+
+	h := mw.Wrap(testHandlerOK)
+
+	// serve returns the status code of the response to the request to path
+	// from the client with the given address.
+	serve := func(remoteAddr, path string) (code int) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = remoteAddr
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	const (
+		client = "198.51.100.1:1234"
+		other  = "198.51.100.2:1234"
+	)
+
+	for range rps {
+		assert.Equal(t, http.StatusOK, serve(client, "/control/status"))
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, serve(client, "/control/status"))
+	assert.Equal(t, http.StatusOK, serve(client, "/index.html"))
+	assert.Equal(t, http.StatusOK, serve(other, "/control/status"))
+
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, serve(client, "/control/status"))
+}
+
+func TestAPIRateLimiter_allow_maxClients(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1_000_000, 0)
+	l := newAPIRateLimiter(&faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	}, 1)
+
+	ip := netip.MustParseAddr("2001:db8::")
+	for range apiRateMaxClients + 1 {
+		assert.True(t, l.allow(ip))
+
+		ip = ip.Next()
+	}
+
+	assert.Len(t, l.windows, apiRateMaxClients)
+
+	now = now.Add(time.Second)
+	assert.True(t, l.allow(ip))
+	assert.Len(t, l.windows, 1)
+}
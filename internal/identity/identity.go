@@ -0,0 +1,62 @@
+// Package identity implements the resolving of the IP addresses of the clients
+// to the identities of their users and computers using external identity
+// sources, such as directory services.
+package identity
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+)
+
+// Identity is the identity of the user and the computer behind an IP address.
+// Any of the fields may be empty.
+type Identity struct {
+	// User is the name of the user logged in on the computer.
+	User string `json:"user,omitempty"`
+
+	// Computer is the name of the computer.
+	Computer string `json:"computer,omitempty"`
+
+	// Groups are the names of the directory groups, which the user or the
+	// computer are members of.
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Clone returns a deep copy of id.
+func (id *Identity) Clone() (c *Identity) {
+	if id == nil {
+		return nil
+	}
+
+	return &Identity{
+		User:     id.User,
+		Computer: id.Computer,
+		Groups:   slices.Clone(id.Groups),
+	}
+}
+
+// isEmpty returns true if id contains no information.
+func (id *Identity) isEmpty() (ok bool) {
+	return id.User == "" && id.Computer == "" && len(id.Groups) == 0
+}
+
+// Interface resolves the IP addresses of the clients to their identities.
+type Interface interface {
+	// Identity returns the known identity of the client with the IP address
+	// ip.  If the identity isn't known yet or has expired, it's looked up in
+	// the background, so that the method never blocks on the identity source.
+	// id is nil if there is no known identity.  It must be safe for concurrent
+	// use.
+	Identity(ctx context.Context, ip netip.Addr) (id *Identity)
+}
+
+// Empty is the [Interface] implementation that does nothing.
+type Empty struct{}
+
+// type check
+var _ Interface = Empty{}
+
+// Identity implements the [Interface] interface for Empty.  It always returns
+// nil.
+func (Empty) Identity(_ context.Context, _ netip.Addr) (id *Identity) { return nil }
@@ -0,0 +1,217 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/bluele/gcache"
+)
+
+const (
+	// maxRespSize is the maximum size of the response of a REST identity
+	// source.
+	maxRespSize = 64 * 1024
+
+	// maxPendingLookups is the maximum number of concurrent lookups.  The IP
+	// addresses, which are requested while there are more lookups, are looked
+	// up on the next request.
+	maxPendingLookups = 16
+
+	// queryKeyIP is the name of the query parameter containing the IP address
+	// to look up.
+	queryKeyIP = "ip"
+)
+
+// RESTConfig is the configuration of a [REST] identity source.
+type RESTConfig struct {
+	// Logger is used to log the lookups.  It must not be nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used to request the identities.  It must not be nil.
+	HTTPClient *http.Client
+
+	// URL is the URL of the identity source.  The IP address to look up is
+	// added to it as the "ip" query parameter.  It must not be nil.
+	URL *url.URL
+
+	// Timeout is the timeout of a single lookup.  It must be positive.
+	Timeout time.Duration
+
+	// CacheTTL is the duration, during which a looked up identity is used
+	// without looking it up again.  It must be positive.
+	CacheTTL time.Duration
+
+	// CacheSize is the maximum number of cached identities.  It must be
+	// positive.
+	CacheSize int
+}
+
+// REST is the [Interface] implementation, which looks up the identities using
+// an HTTP API, for example a bridge to a directory service, such as LDAP or
+// Active Directory.  The API must respond to the GET requests with the
+// JSON-encoded [Identity] or with the status 404 Not Found, if the identity is
+// unknown.
+type REST struct {
+	logger     *slog.Logger
+	httpClient *http.Client
+	url        *url.URL
+
+	// cache maps the IP addresses to *cacheItem values.
+	cache gcache.Cache
+
+	// mu protects pending.
+	mu *sync.Mutex
+
+	// pending are the IP addresses, which are being looked up.
+	pending map[netip.Addr]struct{}
+
+	timeout  time.Duration
+	cacheTTL time.Duration
+}
+
+// cacheItem is a looked up identity.
+type cacheItem struct {
+	// id is the identity.  It's empty if the identity is unknown.
+	id *Identity
+
+	// expiry is the time after which the identity is looked up again.
+	expiry time.Time
+}
+
+// NewREST returns a new properly initialized *REST.  c must not be nil and
+// must be valid.
+func NewREST(c *RESTConfig) (r *REST) {
+	return &REST{
+		logger:     c.Logger,
+		httpClient: c.HTTPClient,
+		url:        c.URL,
+		cache:      gcache.New(c.CacheSize).LRU().Build(),
+		mu:         &sync.Mutex{},
+		pending:    map[netip.Addr]struct{}{},
+		timeout:    c.Timeout,
+		cacheTTL:   c.CacheTTL,
+	}
+}
+
+// type check
+var _ Interface = (*REST)(nil)
+
+// Identity implements the [Interface] interface for *REST.  It returns the
+// previously looked up identity while looking up the expired one again.
+func (r *REST) Identity(ctx context.Context, ip netip.Addr) (id *Identity) {
+	var expired bool
+	v, err := r.cache.Get(ip)
+	if err == nil {
+		item := v.(*cacheItem)
+		id, expired = item.id, time.Now().After(item.expiry)
+	}
+
+	if id == nil || expired {
+		r.schedule(ctx, ip)
+	}
+
+	if id == nil || id.isEmpty() {
+		return nil
+	}
+
+	return id.Clone()
+}
+
+// schedule starts looking up the identity of ip in the background, unless it's
+// already being looked up or there are too many lookups.
+func (r *REST) schedule(ctx context.Context, ip netip.Addr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.pending[ip]; ok || len(r.pending) >= maxPendingLookups {
+		return
+	}
+
+	r.pending[ip] = struct{}{}
+
+	go r.lookupAndCache(context.WithoutCancel(ctx), ip)
+}
+
+// lookupAndCache looks up the identity of ip and caches it.  The unknown
+// identities and the failed lookups are cached as empty identities, so that
+// the identity source isn't requested on each DNS query.  It is intended to be
+// used as a goroutine.
+func (r *REST) lookupAndCache(ctx context.Context, ip netip.Addr) {
+	defer slogutil.RecoverAndLog(ctx, r.logger)
+
+	defer func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.pending, ip)
+	}()
+
+	id, err := r.lookup(ctx, ip)
+	if err != nil {
+		r.logger.DebugContext(ctx, "looking up identity", "ip", ip, slogutil.KeyError, err)
+
+		id = &Identity{}
+	}
+
+	err = r.cache.Set(ip, &cacheItem{
+		id:     id,
+		expiry: time.Now().Add(r.cacheTTL),
+	})
+	if err != nil {
+		r.logger.DebugContext(ctx, "adding item to cache", "key", ip, slogutil.KeyError, err)
+	}
+}
+
+// lookup requests the identity of ip from the identity source.  id is empty if
+// the identity is unknown.
+func (r *REST) lookup(ctx context.Context, ip netip.Addr) (id *Identity, err error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	u := *r.url
+	q := u.Query()
+	q.Set(queryKeyIP, ip.String())
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+
+	req.Header.Set(httphdr.Accept, "application/json")
+
+	// #nosec G704 -- Trust the URL explicitly given by the user.
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Go on.
+	case http.StatusNotFound:
+		return &Identity{}, nil
+	default:
+		return nil, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	id = &Identity{}
+	err = json.NewDecoder(ioutil.LimitReader(resp.Body, maxRespSize)).Decode(id)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,82 @@
+package identity_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/identity"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+func TestREST_Identity(t *testing.T) {
+	var (
+		ipKnown   = netip.MustParseAddr("192.168.1.2")
+		ipUnknown = netip.MustParseAddr("192.168.1.3")
+	)
+
+	var reqNum atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqNum.Add(1)
+
+		if r.URL.Query().Get("ip") != ipKnown.String() {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"user":"alice","computer":"pc-1","groups":["staff"]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/identity")
+	require.NoError(t, err)
+
+	r := identity.NewREST(&identity.RESTConfig{
+		Logger:     slogutil.NewDiscardLogger(),
+		HTTPClient: srv.Client(),
+		URL:        u,
+		Timeout:    testTimeout,
+		CacheTTL:   time.Hour,
+		CacheSize:  10,
+	})
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	t.Run("known", func(t *testing.T) {
+		want := &identity.Identity{
+			User:     "alice",
+			Computer: "pc-1",
+			Groups:   []string{"staff"},
+		}
+
+		require.EventuallyWithT(t, func(ct *assert.CollectT) {
+			assert.Equal(ct, want, r.Identity(ctx, ipKnown))
+		}, testTimeout, testTimeout/10)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		prevNum := reqNum.Load()
+
+		assert.Nil(t, r.Identity(ctx, ipUnknown))
+
+		require.EventuallyWithT(t, func(ct *assert.CollectT) {
+			assert.Equal(ct, prevNum+1, reqNum.Load())
+		}, testTimeout, testTimeout/10)
+
+		// The unknown identity is either being looked up or cached, so it
+		// isn't requested again.
+		assert.Nil(t, r.Identity(ctx, ipUnknown))
+		assert.Equal(t, prevNum+1, reqNum.Load())
+	})
+}
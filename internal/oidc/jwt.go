@@ -0,0 +1,293 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// clockSkew is the allowed difference between the clocks of AdGuard Home and
+// the identity provider.
+const clockSkew = 1 * time.Minute
+
+// jwks is a JSON Web Key Set.
+type jwks struct {
+	Keys []*jwk `json:"keys"`
+}
+
+// jwk is a public JSON Web Key.  Only the RSA and the EC keys are supported.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// N and E are the modulus and the exponent of an RSA key.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// Crv, X, and Y are the curve and the coordinates of an EC key.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwtHeader is the header of a JSON Web Signature.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// sigAlg is a supported JSON Web Signature algorithm.
+type sigAlg struct {
+	hash crypto.Hash
+	kty  string
+	crv  string
+	pss  bool
+}
+
+// sigAlgs are the supported JSON Web Signature algorithms.
+var sigAlgs = map[string]sigAlg{
+	"RS256": {hash: crypto.SHA256, kty: "RSA"},
+	"RS384": {hash: crypto.SHA384, kty: "RSA"},
+	"RS512": {hash: crypto.SHA512, kty: "RSA"},
+	"PS256": {hash: crypto.SHA256, kty: "RSA", pss: true},
+	"PS384": {hash: crypto.SHA384, kty: "RSA", pss: true},
+	"PS512": {hash: crypto.SHA512, kty: "RSA", pss: true},
+	"ES256": {hash: crypto.SHA256, kty: "EC", crv: "P-256"},
+	"ES384": {hash: crypto.SHA384, kty: "EC", crv: "P-384"},
+	"ES512": {hash: crypto.SHA512, kty: "EC", crv: "P-521"},
+}
+
+// curves are the supported elliptic curves of the EC keys.
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// verify verifies the signature and the claims of the ID token and returns
+// the claims.
+func (p *Provider) verify(token string, keys *jwks, nonce string) (c Claims, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("got %d parts, want 3", len(parts))
+	}
+
+	hdr := &jwtHeader{}
+	err = decodeSegment(parts[0], hdr)
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	alg, ok := sigAlgs[hdr.Alg]
+	if !ok {
+		return nil, fmt.Errorf("header: alg: %w: %q", errors.ErrBadEnumValue, hdr.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+
+	err = verifySignature(keys, hdr, alg, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	c = Claims{}
+	err = decodeSegment(parts[1], &c)
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+
+	err = p.validateClaims(c, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+
+	return c, nil
+}
+
+// decodeSegment decodes the base64url-encoded JSON segment of a token into v.
+func decodeSegment(seg string, v any) (err error) {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	// Don't wrap the error, since it's informative enough as is.
+	return json.Unmarshal(b, v)
+}
+
+// verifySignature verifies sig of the signed data with the first key from keys
+// suitable for hdr, which does so.
+func verifySignature(keys *jwks, hdr *jwtHeader, alg sigAlg, signed, sig []byte) (err error) {
+	h := alg.hash.New()
+	_, _ = h.Write(signed)
+	hashed := h.Sum(nil)
+
+	var errs []error
+	for _, k := range keys.Keys {
+		if !k.suits(hdr, alg) {
+			continue
+		}
+
+		err = k.verify(alg, hashed, sig)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, fmt.Errorf("key %q: %w", k.Kid, err))
+	}
+
+	if len(errs) == 0 {
+		return fmt.Errorf("no key %q for alg %q", hdr.Kid, hdr.Alg)
+	}
+
+	return fmt.Errorf("signature: %w", errors.Join(errs...))
+}
+
+// suits returns true if k can be used to verify the signature with the given
+// header and algorithm.
+func (k *jwk) suits(hdr *jwtHeader, alg sigAlg) (ok bool) {
+	switch {
+	case k == nil, k.Kty != alg.kty, k.Use != "" && k.Use != "sig":
+		return false
+	case k.Alg != "" && k.Alg != hdr.Alg:
+		return false
+	case hdr.Kid != "" && k.Kid != hdr.Kid:
+		return false
+	default:
+		return alg.crv == "" || k.Crv == alg.crv
+	}
+}
+
+// verify verifies the signature of the hashed data with k.
+func (k *jwk) verify(alg sigAlg, hashed, sig []byte) (err error) {
+	if k.Kty == "EC" {
+		return k.verifyEC(hashed, sig)
+	}
+
+	pub, err := k.rsaKey()
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	if alg.pss {
+		return rsa.VerifyPSS(pub, alg.hash, hashed, sig, nil)
+	}
+
+	return rsa.VerifyPKCS1v15(pub, alg.hash, hashed, sig)
+}
+
+// rsaKey returns the RSA public key of k.
+func (k *jwk) rsaKey() (pub *rsa.PublicKey, err error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	}
+
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 || exp.Int64() < 3 {
+		return nil, fmt.Errorf("e: bad exponent %s", exp)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exp.Int64()),
+	}, nil
+}
+
+// verifyEC verifies the signature of the hashed data with the EC key k.
+func (k *jwk) verifyEC(hashed, sig []byte) (err error) {
+	curve, ok := curves[k.Crv]
+	if !ok {
+		return fmt.Errorf("crv: %w: %q", errors.ErrBadEnumValue, k.Crv)
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return fmt.Errorf("x: %w", err)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return fmt.Errorf("y: %w", err)
+	}
+
+	if len(x) != size || len(y) != size {
+		return fmt.Errorf("coordinates: got lengths %d and %d, want %d", len(x), len(y), size)
+	}
+
+	pub, err := ecdsa.ParseUncompressedPublicKey(curve, slices.Concat([]byte{4}, x, y))
+	if err != nil {
+		return fmt.Errorf("parsing key: %w", err)
+	}
+
+	if len(sig) != 2*size {
+		return fmt.Errorf("got signature length %d, want %d", len(sig), 2*size)
+	}
+
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+	if !ecdsa.Verify(pub, hashed, r, s) {
+		return errors.Error("ecdsa verification error")
+	}
+
+	return nil
+}
+
+// validateClaims returns an error if the standard claims of the ID token are
+// invalid for the login with the given nonce.
+func (p *Provider) validateClaims(c Claims, nonce string) (err error) {
+	iss, _ := c.String("iss")
+	if strings.TrimSuffix(iss, "/") != strings.TrimSuffix(p.issuer, "/") {
+		return fmt.Errorf("iss: got %q, want %q", iss, p.issuer)
+	}
+
+	aud := c.Strings("aud")
+	if !slices.Contains(aud, p.clientID) {
+		return fmt.Errorf("aud: %q does not contain %q", aud, p.clientID)
+	}
+
+	if azp, ok := c.String("azp"); ok && azp != p.clientID {
+		return fmt.Errorf("azp: got %q, want %q", azp, p.clientID)
+	}
+
+	exp, ok := c["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("exp: %w", errors.ErrNoValue)
+	}
+
+	now := p.clock.Now()
+	if now.Add(-clockSkew).After(time.Unix(int64(exp), 0)) {
+		return errors.Error("exp: token expired")
+	}
+
+	if got, _ := c.String("nonce"); got != nonce {
+		return errors.Error("nonce: mismatch")
+	}
+
+	return nil
+}
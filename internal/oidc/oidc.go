@@ -0,0 +1,343 @@
+// Package oidc implements the authorization code flow of OpenID Connect with
+// PKCE for logging in the web users through an external identity provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// maxRespSize is the maximum size of a response of the identity provider.
+const maxRespSize = 1024 * 1024
+
+// discoveryPath is the path of the OpenID Provider configuration document
+// relative to the issuer URL.
+const discoveryPath = ".well-known/openid-configuration"
+
+// DefaultScopes are the scopes requested when none are configured.
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+// Config is the configuration of a [Provider].
+type Config struct {
+	// Logger is used for logging the operation of the provider.  It must not
+	// be nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used to request the identity provider.  It must not be
+	// nil.
+	HTTPClient *http.Client
+
+	// Clock is used to check the validity period of the ID tokens.  It must
+	// not be nil.
+	Clock timeutil.Clock
+
+	// IssuerURL is the URL of the issuer, which must be equal to the "iss"
+	// claim of the ID tokens.  It must not be nil.
+	IssuerURL *url.URL
+
+	// ClientID is the ID of AdGuard Home registered at the identity provider.
+	// It must not be empty.
+	ClientID string
+
+	// ClientSecret is the secret of the client.  It may be empty for public
+	// clients.
+	ClientSecret string
+
+	// Scopes are the requested scopes.  If empty, [DefaultScopes] are used.
+	Scopes []string
+}
+
+// Claims are the claims of a verified ID token.
+type Claims map[string]any
+
+// String returns the string value of the claim with the given name.  ok is
+// false if there is no such claim or it's not a string.
+func (c Claims) String(name string) (s string, ok bool) {
+	s, ok = c[name].(string)
+
+	return s, ok
+}
+
+// Strings returns the values of the claim with the given name, which is either
+// an array of strings or a single string.  The values of other types are
+// ignored.
+func (c Claims) Strings(name string) (ss []string) {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		for _, elem := range v {
+			if s, ok := elem.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+	}
+
+	return ss
+}
+
+// Provider is the OpenID Connect relying party for a single identity
+// provider.
+type Provider struct {
+	logger       *slog.Logger
+	httpClient   *http.Client
+	clock        timeutil.Clock
+	issuer       string
+	discoveryURL string
+	clientID     string
+	clientSecret string
+	scope        string
+
+	// mu protects meta.  meta is retrieved on the first use, so that an
+	// unavailable identity provider doesn't prevent the start.
+	mu   *sync.Mutex
+	meta *metadata
+}
+
+// New returns a new properly initialized *Provider.  c must not be nil.
+func New(c *Config) (p *Provider, err error) {
+	switch {
+	case c.IssuerURL == nil:
+		return nil, fmt.Errorf("issuer url: %w", errors.ErrNoValue)
+	case c.ClientID == "":
+		return nil, fmt.Errorf("client id: %w", errors.ErrEmptyValue)
+	}
+
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	} else if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	return &Provider{
+		logger:       c.Logger,
+		httpClient:   c.HTTPClient,
+		clock:        c.Clock,
+		issuer:       c.IssuerURL.String(),
+		discoveryURL: c.IssuerURL.JoinPath(discoveryPath).String(),
+		clientID:     c.ClientID,
+		clientSecret: c.ClientSecret,
+		scope:        strings.Join(scopes, " "),
+		mu:           &sync.Mutex{},
+	}, nil
+}
+
+// metadata is the part of the OpenID Provider configuration document used by
+// the relying party.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// metadata returns the configuration of the identity provider, retrieving it
+// if necessary.
+func (p *Provider) metadata(ctx context.Context) (m *metadata, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	m = &metadata{}
+	err = p.getJSON(ctx, p.discoveryURL, m)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	switch {
+	case strings.TrimSuffix(m.Issuer, "/") != strings.TrimSuffix(p.issuer, "/"):
+		return nil, fmt.Errorf("discovery: issuer %q, want %q", m.Issuer, p.issuer)
+	case m.AuthorizationEndpoint == "":
+		return nil, fmt.Errorf("discovery: authorization endpoint: %w", errors.ErrEmptyValue)
+	case m.TokenEndpoint == "":
+		return nil, fmt.Errorf("discovery: token endpoint: %w", errors.ErrEmptyValue)
+	case m.JWKSURI == "":
+		return nil, fmt.Errorf("discovery: jwks uri: %w", errors.ErrEmptyValue)
+	}
+
+	p.meta = m
+
+	return m, nil
+}
+
+// Flow contains the per-login secrets of the authorization code flow, which
+// must be kept by the relying party until the callback.
+type Flow struct {
+	// State is the opaque value binding the callback to the login request.
+	State string
+
+	// Nonce is the value binding the ID token to the login request.
+	Nonce string
+
+	// Verifier is the PKCE code verifier.
+	Verifier string
+}
+
+// NewFlow returns the new random secrets of a login.
+func NewFlow() (f *Flow) {
+	return &Flow{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString(),
+	}
+}
+
+// randomString returns a random URL-safe string with 256 bits of entropy.
+func randomString() (s string) {
+	b := make([]byte, 32)
+
+	// Don't check the error, since [rand.Read] never fails.
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// AuthURL returns the URL of the authorization endpoint for a new login with
+// the secrets from f, after which the identity provider redirects the user
+// agent to redirectURL.
+func (p *Provider) AuthURL(ctx context.Context, f *Flow, redirectURL string) (u string, err error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return "", err
+	}
+
+	authURL, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("authorization endpoint: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(f.Verifier))
+
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", p.scope)
+	q.Set("state", f.State)
+	q.Set("nonce", f.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	authURL.RawQuery = q.Encode()
+
+	return authURL.String(), nil
+}
+
+// tokenResponse is the response of the token endpoint.
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+// Exchange exchanges the authorization code from the callback of the login
+// with the secrets from f for the ID token and returns its verified claims.
+func (p *Provider) Exchange(
+	ctx context.Context,
+	f *Flow,
+	code string,
+	redirectURL string,
+) (c Claims, err error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {f.Verifier},
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		m.TokenEndpoint,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("making token request: %w", err)
+	}
+
+	req.Header.Set(httphdr.ContentType, "application/x-www-form-urlencoded")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	tr := &tokenResponse{}
+	err = p.doJSON(req, tr)
+	if err != nil {
+		return nil, fmt.Errorf("token: %w", err)
+	}
+
+	if tr.IDToken == "" {
+		return nil, fmt.Errorf("token: id token: %w", errors.ErrEmptyValue)
+	}
+
+	keys := &jwks{}
+	err = p.getJSON(ctx, m.JWKSURI, keys)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	c, err = p.verify(tr.IDToken, keys, f.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w", err)
+	}
+
+	return c, nil
+}
+
+// getJSON requests u and decodes the JSON response into v.
+func (p *Provider) getJSON(ctx context.Context, u string, v any) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("making request: %w", err)
+	}
+
+	// Don't wrap the error, since it's informative enough as is.
+	return p.doJSON(req, v)
+}
+
+// doJSON sends req and decodes the JSON response into v.
+func (p *Provider) doJSON(req *http.Request, v any) (err error) {
+	req.Header.Set(httphdr.Accept, "application/json")
+
+	// #nosec G704 -- Trust the URLs of the issuer explicitly given by the user.
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	err = json.NewDecoder(ioutil.LimitReader(resp.Body, maxRespSize)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	return nil
+}
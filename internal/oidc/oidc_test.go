@@ -0,0 +1,354 @@
+package oidc_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/oidc"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/testutil/faketime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// Common values for tests.
+const (
+	testClientID     = "adguard-home"
+	testClientSecret = "secret"
+	testCode         = "auth-code"
+	testRedirectURL  = "https://adguard.example/control/login/oidc/callback"
+)
+
+// testNow is the current time for tests.
+var testNow = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// b64 returns the base64url encoding of b.
+func b64(b []byte) (s string) {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// testIdP is the identity provider for tests.
+type testIdP struct {
+	tb     testing.TB
+	srv    *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	// claims are the claims of the issued ID token.
+	claims map[string]any
+
+	// alg is the signature algorithm of the issued ID token.
+	alg string
+
+	// verifier is the PKCE code verifier expected by the token endpoint.
+	verifier string
+
+	// tamper, if true, makes the signature of the issued ID token invalid.
+	tamper bool
+}
+
+// newTestIdP returns a new running *testIdP.
+func newTestIdP(tb testing.TB) (idp *testIdP) {
+	tb.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(tb, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(tb, err)
+
+	idp = &testIdP{
+		tb:     tb,
+		rsaKey: rsaKey,
+		ecKey:  ecKey,
+		alg:    "RS256",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.handleDiscovery)
+	mux.HandleFunc("POST /token", idp.handleToken)
+	mux.HandleFunc("GET /jwks", idp.handleJWKS)
+
+	idp.srv = httptest.NewServer(mux)
+	tb.Cleanup(idp.srv.Close)
+
+	return idp
+}
+
+// writeJSON writes v to w as JSON.
+func (idp *testIdP) writeJSON(w http.ResponseWriter, v any) {
+	err := json.NewEncoder(w).Encode(v)
+	require.NoError(idp.tb, err)
+}
+
+// handleDiscovery serves the OpenID Provider configuration document.
+func (idp *testIdP) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	idp.writeJSON(w, map[string]string{
+		"issuer":                 idp.srv.URL,
+		"authorization_endpoint": idp.srv.URL + "/authorize",
+		"token_endpoint":         idp.srv.URL + "/token",
+		"jwks_uri":               idp.srv.URL + "/jwks",
+	})
+}
+
+// handleJWKS serves the public keys.
+func (idp *testIdP) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	ecPub, err := idp.ecKey.PublicKey.Bytes()
+	require.NoError(idp.tb, err)
+
+	idp.writeJSON(w, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "rsa",
+			"use": "sig",
+			"n":   b64(idp.rsaKey.N.Bytes()),
+			"e":   b64(big.NewInt(int64(idp.rsaKey.E)).Bytes()),
+		}, {
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   b64(ecPub[1:33]),
+			"y":   b64(ecPub[33:]),
+		}},
+	})
+}
+
+// handleToken serves the token endpoint.
+func (idp *testIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	require.True(idp.tb, ok)
+	require.Equal(idp.tb, testClientID, user)
+	require.Equal(idp.tb, testClientSecret, pass)
+
+	require.NoError(idp.tb, r.ParseForm())
+	require.Equal(idp.tb, "authorization_code", r.PostForm.Get("grant_type"))
+	require.Equal(idp.tb, testCode, r.PostForm.Get("code"))
+	require.Equal(idp.tb, testRedirectURL, r.PostForm.Get("redirect_uri"))
+	require.Equal(idp.tb, idp.verifier, r.PostForm.Get("code_verifier"))
+
+	idp.writeJSON(w, map[string]string{
+		"access_token": "access",
+		"id_token":     idp.sign(),
+	})
+}
+
+// sign returns the ID token with idp.claims signed with idp.alg.
+func (idp *testIdP) sign() (token string) {
+	kid := "rsa"
+	if idp.alg == "ES256" {
+		kid = "ec"
+	}
+
+	hdr, err := json.Marshal(map[string]string{"alg": idp.alg, "kid": kid, "typ": "JWT"})
+	require.NoError(idp.tb, err)
+
+	payload, err := json.Marshal(idp.claims)
+	require.NoError(idp.tb, err)
+
+	signed := b64(hdr) + "." + b64(payload)
+	hashed := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	if idp.alg == "ES256" {
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, idp.ecKey, hashed[:])
+		require.NoError(idp.tb, err)
+
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	} else {
+		sig, err = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, hashed[:])
+		require.NoError(idp.tb, err)
+	}
+
+	if idp.tamper {
+		sig[0] ^= 0xff
+	}
+
+	return signed + "." + b64(sig)
+}
+
+// newTestProvider returns a new *oidc.Provider for idp.
+func newTestProvider(tb testing.TB, idp *testIdP) (p *oidc.Provider) {
+	tb.Helper()
+
+	u, err := url.Parse(idp.srv.URL)
+	require.NoError(tb, err)
+
+	p, err = oidc.New(&oidc.Config{
+		Logger:     slogutil.NewDiscardLogger(),
+		HTTPClient: idp.srv.Client(),
+		Clock: &faketime.Clock{
+			OnNow: func() (now time.Time) { return testNow },
+		},
+		IssuerURL:    u,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		Scopes:       []string{"profile", "groups"},
+	})
+	require.NoError(tb, err)
+
+	return p
+}
+
+func TestProvider_AuthURL(t *testing.T) {
+	idp := newTestIdP(t)
+	p := newTestProvider(t, idp)
+	f := oidc.NewFlow()
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	got, err := p.AuthURL(ctx, f, testRedirectURL)
+	require.NoError(t, err)
+
+	u, err := url.Parse(got)
+	require.NoError(t, err)
+
+	challenge := sha256.Sum256([]byte(f.Verifier))
+
+	assert.Equal(t, "/authorize", u.Path)
+	assert.Equal(t, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURL},
+		"scope":                 {"openid profile groups"},
+		"state":                 {f.State},
+		"nonce":                 {f.Nonce},
+		"code_challenge":        {b64(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}, u.Query())
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	idp := newTestIdP(t)
+	p := newTestProvider(t, idp)
+
+	validClaims := func(f *oidc.Flow) (c map[string]any) {
+		return map[string]any{
+			"iss":                idp.srv.URL,
+			"aud":                []string{testClientID},
+			"exp":                testNow.Add(time.Hour).Unix(),
+			"nonce":              f.Nonce,
+			"preferred_username": "alice",
+			"groups":             []string{"admins", "staff"},
+		}
+	}
+
+	testCases := []struct {
+		modify     func(c map[string]any)
+		name       string
+		alg        string
+		wantErrMsg string
+	}{{
+		modify:     func(_ map[string]any) {},
+		name:       "rsa",
+		alg:        "RS256",
+		wantErrMsg: "",
+	}, {
+		modify:     func(_ map[string]any) {},
+		name:       "ec",
+		alg:        "ES256",
+		wantErrMsg: "",
+	}, {
+		modify:     func(c map[string]any) { c["nonce"] = "other" },
+		name:       "bad_nonce",
+		alg:        "RS256",
+		wantErrMsg: "verifying id token: claims: nonce: mismatch",
+	}, {
+		modify:     func(c map[string]any) { c["aud"] = "other" },
+		name:       "bad_aud",
+		alg:        "RS256",
+		wantErrMsg: `verifying id token: claims: aud: ["other"] does not contain "adguard-home"`,
+	}, {
+		modify:     func(c map[string]any) { c["exp"] = testNow.Add(-time.Hour).Unix() },
+		name:       "expired",
+		alg:        "RS256",
+		wantErrMsg: "verifying id token: claims: exp: token expired",
+	}, {
+		modify:     func(_ map[string]any) {},
+		name:       "bad_alg",
+		alg:        "none",
+		wantErrMsg: `verifying id token: header: alg: bad enum value: "none"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := oidc.NewFlow()
+			idp.verifier = f.Verifier
+			idp.alg = tc.alg
+			idp.claims = validClaims(f)
+			tc.modify(idp.claims)
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			c, err := p.Exchange(ctx, f, testCode, testRedirectURL)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg != "" {
+				return
+			}
+
+			name, ok := c.String("preferred_username")
+			require.True(t, ok)
+
+			assert.Equal(t, "alice", name)
+			assert.Equal(t, []string{"admins", "staff"}, c.Strings("groups"))
+		})
+	}
+
+	t.Run("bad_signature", func(t *testing.T) {
+		f := oidc.NewFlow()
+		idp.verifier = f.Verifier
+		idp.alg = "RS256"
+		idp.claims = validClaims(f)
+		idp.tamper = true
+		t.Cleanup(func() { idp.tamper = false })
+
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		_, err := p.Exchange(ctx, f, testCode, testRedirectURL)
+		testutil.AssertErrorMsg(
+			t,
+			`verifying id token: signature: key "rsa": crypto/rsa: verification error`,
+			err,
+		)
+	})
+}
+
+func TestNew_errors(t *testing.T) {
+	u := &url.URL{Scheme: "https", Host: "idp.example"}
+
+	testCases := []struct {
+		conf       *oidc.Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &oidc.Config{ClientID: testClientID},
+		name:       "no_issuer",
+		wantErrMsg: "issuer url: no value",
+	}, {
+		conf:       &oidc.Config{IssuerURL: u},
+		name:       "no_client_id",
+		wantErrMsg: "client id: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := oidc.New(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
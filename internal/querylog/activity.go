@@ -0,0 +1,344 @@
+package querylog
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+const (
+	// defaultActivityRange is the default duration of the client activity
+	// timeline.
+	defaultActivityRange = timeutil.Day
+
+	// defaultActivityInterval is the default duration of a single bucket of
+	// the client activity timeline.
+	defaultActivityInterval = time.Hour
+
+	// maxActivityBuckets is the maximum number of buckets in the client
+	// activity timeline.
+	maxActivityBuckets = 1_000
+
+	// defaultActivityTop is the default number of the top domain names in the
+	// client activity.
+	defaultActivityTop = 10
+
+	// maxActivityTop is the maximum number of the top domain names in the
+	// client activity.
+	maxActivityTop = 100
+)
+
+// activityParams are the parameters of the client activity timeline.
+type activityParams struct {
+	// start is the beginning of the timeline, inclusive.
+	start time.Time
+
+	// end is the end of the timeline, exclusive.
+	end time.Time
+
+	// client is the IP address, the ClientID, or the name of the client.
+	client string
+
+	// interval is the duration of a single bucket.
+	interval time.Duration
+
+	// top is the number of the top domain names.
+	top int
+}
+
+// parseActivityParams parses the parameters of the client activity timeline
+// from the query string q.  now is used for the default end of the timeline.
+func parseActivityParams(
+	client string,
+	q url.Values,
+	now time.Time,
+) (p *activityParams, err error) {
+	if client == "" {
+		return nil, fmt.Errorf("client: %w", errors.ErrEmptyValue)
+	}
+
+	p = &activityParams{
+		end:      now,
+		client:   client,
+		interval: defaultActivityInterval,
+		top:      defaultActivityTop,
+	}
+
+	if v := q.Get("end"); v != "" {
+		p.end, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("end: %w", err)
+		}
+	}
+
+	p.start = p.end.Add(-defaultActivityRange)
+	if v := q.Get("start"); v != "" {
+		p.start, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("start: %w", err)
+		}
+	}
+
+	if v := q.Get("interval"); v != "" {
+		p.interval, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("interval: %w", err)
+		}
+	}
+
+	if v := q.Get("top"); v != "" {
+		p.top, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("top: %w", err)
+		}
+	}
+
+	return p, p.validate()
+}
+
+// validate returns an error if p is invalid.
+func (p *activityParams) validate() (err error) {
+	switch {
+	case !p.start.Before(p.end):
+		return fmt.Errorf("start: must be before end %s", p.end.Format(time.RFC3339))
+	case p.interval <= 0:
+		return fmt.Errorf("interval: %w", errors.ErrNotPositive)
+	case p.numBuckets() > maxActivityBuckets:
+		return fmt.Errorf(
+			"interval: too many buckets %d, must be no more than %d",
+			p.numBuckets(),
+			maxActivityBuckets,
+		)
+	case p.top < 0 || p.top > maxActivityTop:
+		return fmt.Errorf("top: must be between 0 and %d, got %d", maxActivityTop, p.top)
+	default:
+		return nil
+	}
+}
+
+// numBuckets returns the number of buckets in the timeline.  The last bucket
+// may be shorter than the interval.
+func (p *activityParams) numBuckets() (n int) {
+	d := p.end.Sub(p.start)
+
+	return int((d + p.interval - 1) / p.interval)
+}
+
+// activityBucketJSON is a single bucket of the client activity timeline.
+type activityBucketJSON struct {
+	// Time is the beginning of the bucket.
+	Time time.Time `json:"time"`
+
+	// Queries is the number of the queries of the client within the bucket.
+	Queries uint64 `json:"queries"`
+
+	// Blocked is the number of the blocked queries of the client within the
+	// bucket.
+	Blocked uint64 `json:"blocked"`
+}
+
+// activityDomainJSON is a domain name requested by the client.
+type activityDomainJSON struct {
+	// Name is the requested domain name.
+	Name string `json:"name"`
+
+	// Count is the number of the requests of the domain name.
+	Count uint64 `json:"count"`
+}
+
+// activityJSON is the response of the GET /control/clients/{id}/activity HTTP
+// API.
+type activityJSON struct {
+	// Start is the beginning of the timeline.
+	Start time.Time `json:"start"`
+
+	// End is the end of the timeline.
+	End time.Time `json:"end"`
+
+	// Buckets are the buckets of the timeline in chronological order.
+	Buckets []*activityBucketJSON `json:"buckets"`
+
+	// TopDomains are the domain names requested by the client most often.
+	TopDomains []*activityDomainJSON `json:"top_domains"`
+
+	// TopBlockedDomains are the blocked domain names requested by the client
+	// most often.
+	TopBlockedDomains []*activityDomainJSON `json:"top_blocked_domains"`
+
+	// Interval is the duration of a single bucket.
+	Interval aghhttp.JSONDuration `json:"interval"`
+
+	// Queries is the total number of the queries of the client.
+	Queries uint64 `json:"num_queries"`
+
+	// Blocked is the total number of the blocked queries of the client.
+	Blocked uint64 `json:"num_blocked"`
+}
+
+// activityWriter is an [exportWriter] that aggregates the entries into the
+// client activity timeline.
+type activityWriter struct {
+	params         *activityParams
+	buckets        []*activityBucketJSON
+	domains        map[string]uint64
+	blockedDomains map[string]uint64
+}
+
+// newActivityWriter returns a new *activityWriter with empty buckets for
+// params.  params must be valid.
+func newActivityWriter(params *activityParams) (w *activityWriter) {
+	buckets := make([]*activityBucketJSON, params.numBuckets())
+	for i := range buckets {
+		buckets[i] = &activityBucketJSON{
+			Time: params.start.Add(time.Duration(i) * params.interval),
+		}
+	}
+
+	return &activityWriter{
+		params:         params,
+		buckets:        buckets,
+		domains:        map[string]uint64{},
+		blockedDomains: map[string]uint64{},
+	}
+}
+
+// type check
+var _ exportWriter = (*activityWriter)(nil)
+
+// writeEntry implements the [exportWriter] interface for *activityWriter.  err
+// is always nil.
+func (w *activityWriter) writeEntry(_ context.Context, e *logEntry) (err error) {
+	if e.Time.Before(w.params.start) || !e.Time.Before(w.params.end) {
+		return nil
+	}
+
+	b := w.buckets[e.Time.Sub(w.params.start)/w.params.interval]
+	b.Queries++
+	w.domains[e.QHost]++
+
+	if isBlocked(e.Result.Reason) {
+		b.Blocked++
+		w.blockedDomains[e.QHost]++
+	}
+
+	return nil
+}
+
+// flush implements the [exportWriter] interface for *activityWriter.  err is
+// always nil.
+func (w *activityWriter) flush() (err error) {
+	return nil
+}
+
+// isBlocked returns true if the request with the filtering reason has been
+// blocked, the same way as in the statistics.
+func isBlocked(reason filtering.Reason) (ok bool) {
+	return reason.In(
+		filtering.FilteredBlockList,
+		filtering.FilteredBlockedService,
+		filtering.FilteredInvalid,
+		filtering.FilteredParental,
+		filtering.FilteredSafeBrowsing,
+	)
+}
+
+// toJSON returns the client activity aggregated by w.
+func (w *activityWriter) toJSON() (resp *activityJSON) {
+	resp = &activityJSON{
+		Start:             w.params.start,
+		End:               w.params.end,
+		Buckets:           w.buckets,
+		TopDomains:        topDomains(w.domains, w.params.top),
+		TopBlockedDomains: topDomains(w.blockedDomains, w.params.top),
+		Interval:          aghhttp.JSONDuration(w.params.interval),
+	}
+
+	for _, b := range w.buckets {
+		resp.Queries += b.Queries
+		resp.Blocked += b.Blocked
+	}
+
+	return resp
+}
+
+// topDomains returns at most n domain names from counts with the most
+// requests.  The domain names with the same number of requests are sorted
+// alphabetically.
+func topDomains(counts map[string]uint64, n int) (top []*activityDomainJSON) {
+	names := slices.SortedFunc(maps.Keys(counts), func(a, b string) (res int) {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+
+	top = make([]*activityDomainJSON, 0, min(n, len(names)))
+	for _, name := range names[:min(n, len(names))] {
+		top = append(top, &activityDomainJSON{
+			Name:  name,
+			Count: counts[name],
+		})
+	}
+
+	return top
+}
+
+// handleClientActivity is the handler for the GET
+// /control/clients/{id}/activity HTTP API.  id is the IP address, the
+// ClientID, or the name of the client.
+func (l *queryLog) handleClientActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	now := time.Now()
+	params, err := parseActivityParams(r.PathValue("id"), r.URL.Query(), now)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l.logger, r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	aw := newActivityWriter(params)
+
+	// Include the entries at the exact start, since newerThan is exclusive.
+	sp := &searchParams{
+		newerThan: params.start.Add(-1),
+		searchCriteria: []searchCriterion{{
+			criterionType: ctClient,
+			value:         params.client,
+		}},
+		sortBy: sortFieldTime,
+	}
+
+	// Don't seek the files, if the timeline ends in the future, since seeking
+	// skips the newest entry then.  The newer entries are skipped by aw.
+	if params.end.Before(now) {
+		sp.olderThan = params.end
+	}
+
+	l.confMu.RLock()
+	defer l.confMu.RUnlock()
+
+	err = l.export(ctx, sp, aw)
+	if err != nil {
+		aghhttp.ErrorAndLog(
+			ctx,
+			l.logger,
+			r,
+			w,
+			http.StatusInternalServerError,
+			"getting client activity: %s",
+			err,
+		)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, l.logger, w, r, aw.toJSON())
+}
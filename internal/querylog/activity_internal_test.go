@@ -0,0 +1,150 @@
+package querylog
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLog_HandleClientActivity(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Logger:      slogutil.NewDiscardLogger(),
+		Anonymizer:  aghnet.NewIPMut(nil),
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	clientIP := net.IPv4(192, 0, 2, 1)
+	answer := net.IPv4(203, 0, 113, 1)
+
+	addEntry(l, "file.example.org", answer, clientIP)
+	require.NoError(t, l.flushLogBuffer(ctx))
+
+	addEntry(l, "memory.example.org", answer, clientIP)
+	addEntry(l, "memory.example.org", answer, clientIP)
+	addEntry(l, "other.example.org", answer, net.IPv4(192, 0, 2, 2))
+
+	l.Add(&AddParams{
+		Question: &dns.Msg{
+			Question: []dns.Question{{
+				Name:   "blocked.example.org.",
+				Qtype:  dns.TypeA,
+				Qclass: dns.ClassINET,
+			}},
+		},
+		Result: &filtering.Result{
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		},
+		ClientIP: clientIP,
+	})
+
+	now := time.Now()
+	q := url.Values{
+		"start":    []string{now.Add(-time.Hour).Format(time.RFC3339Nano)},
+		"end":      []string{now.Add(time.Hour).Format(time.RFC3339Nano)},
+		"interval": []string{"1h"},
+		"top":      []string{"2"},
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/control/clients/192.0.2.1/activity?"+q.Encode(), nil)
+	r.SetPathValue("id", clientIP.String())
+
+	w := httptest.NewRecorder()
+	l.handleClientActivity(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	resp := &activityJSON{}
+	err = json.NewDecoder(w.Body).Decode(resp)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(4), resp.Queries)
+	assert.Equal(t, uint64(1), resp.Blocked)
+	assert.Equal(t, aghhttp.JSONDuration(time.Hour), resp.Interval)
+
+	require.Len(t, resp.Buckets, 2)
+
+	assert.Equal(t, uint64(4), resp.Buckets[0].Queries)
+	assert.Equal(t, uint64(1), resp.Buckets[0].Blocked)
+	assert.Equal(t, uint64(0), resp.Buckets[1].Queries)
+
+	assert.Equal(t, []*activityDomainJSON{{
+		Name:  "memory.example.org",
+		Count: 2,
+	}, {
+		Name:  "blocked.example.org",
+		Count: 1,
+	}}, resp.TopDomains)
+	assert.Equal(t, []*activityDomainJSON{{
+		Name:  "blocked.example.org",
+		Count: 1,
+	}}, resp.TopBlockedDomains)
+}
+
+func TestParseActivityParams(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		query      url.Values
+		name       string
+		client     string
+		wantErrMsg string
+	}{{
+		query:      url.Values{},
+		name:       "default",
+		client:     "client",
+		wantErrMsg: "",
+	}, {
+		query:      url.Values{},
+		name:       "no_client",
+		client:     "",
+		wantErrMsg: "client: empty value",
+	}, {
+		query:      url.Values{"start": []string{"2026-01-02T00:00:00Z"}},
+		name:       "start_after_end",
+		client:     "client",
+		wantErrMsg: "start: must be before end 2026-01-01T00:00:00Z",
+	}, {
+		query:      url.Values{"interval": []string{"0s"}},
+		name:       "zero_interval",
+		client:     "client",
+		wantErrMsg: "interval: not positive",
+	}, {
+		query:      url.Values{"interval": []string{"1m"}},
+		name:       "too_many_buckets",
+		client:     "client",
+		wantErrMsg: "interval: too many buckets 1440, must be no more than 1000",
+	}, {
+		query:      url.Values{"top": []string{"1000"}},
+		name:       "too_many_top",
+		client:     "client",
+		wantErrMsg: "top: must be between 0 and 100, got 1000",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseActivityParams(tc.client, tc.query, now)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -8,11 +8,14 @@ import (
 	"io"
 	"net"
 	"net/netip"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/geoip"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/threatfeed"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/urlfilter/rules"
@@ -137,6 +140,16 @@ var logEntryHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
+	"Stale": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(bool)
+		if !ok {
+			return nil
+		}
+
+		ent.Stale = v
+
+		return nil
+	},
 	"AD": func(t json.Token, ent *logEntry) error {
 		v, ok := t.(bool)
 		if !ok {
@@ -147,6 +160,71 @@ var logEntryHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
+	"DO": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(bool)
+		if !ok {
+			return nil
+		}
+
+		ent.DNSSECOK = v
+
+		return nil
+	},
+	"RC": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(string)
+		if !ok {
+			return nil
+		}
+
+		ent.RCode = v
+
+		return nil
+	},
+	"ReqSize": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(json.Number)
+		if !ok {
+			return nil
+		}
+
+		i, err := v.Int64()
+		if err != nil {
+			return err
+		}
+
+		ent.ReqSize = int(i)
+
+		return nil
+	},
+	"RespSize": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(json.Number)
+		if !ok {
+			return nil
+		}
+
+		i, err := v.Int64()
+		if err != nil {
+			return err
+		}
+
+		ent.RespSize = int(i)
+
+		return nil
+	},
+	"ECSScope": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(json.Number)
+		if !ok {
+			return nil
+		}
+
+		i, err := strconv.ParseUint(v.String(), 10, 8)
+		if err != nil {
+			return err
+		}
+
+		ent.ECSScope = uint8(i)
+
+		return nil
+	},
 	"Upstream": func(t json.Token, ent *logEntry) error {
 		v, ok := t.(string)
 		if !ok {
@@ -157,6 +235,36 @@ var logEntryHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
+	"UpstreamRTT": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(json.Number)
+		if !ok {
+			return nil
+		}
+
+		i, err := v.Int64()
+		if err != nil {
+			return err
+		}
+
+		ent.UpstreamRTT = time.Duration(i)
+
+		return nil
+	},
+	"CacheTTL": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(json.Number)
+		if !ok {
+			return nil
+		}
+
+		i, err := strconv.ParseUint(v.String(), 10, 32)
+		if err != nil {
+			return err
+		}
+
+		ent.CacheTTL = uint32(i)
+
+		return nil
+	},
 	"Elapsed": func(t json.Token, ent *logEntry) error {
 		v, ok := t.(json.Number)
 		if !ok {
@@ -497,6 +605,45 @@ func (l *queryLog) decodeResultDNSRewriteResult(
 	}
 }
 
+// decodeResultThreat decodes the threat-feed indicator of the result.
+func (l *queryLog) decodeResultThreat(ctx context.Context, dec *json.Decoder, ent *logEntry) {
+	ind := &threatfeed.Indicator{}
+	err := dec.Decode(ind)
+	if err != nil {
+		l.logger.DebugContext(ctx, "decoding result threat", slogutil.KeyError, err)
+
+		return
+	}
+
+	ent.Result.Threat = ind
+}
+
+// decodeResultGeo decodes the geo-blocking match of the result.
+func (l *queryLog) decodeResultGeo(ctx context.Context, dec *json.Decoder, ent *logEntry) {
+	m := &geoip.Match{}
+	err := dec.Decode(m)
+	if err != nil {
+		l.logger.DebugContext(ctx, "decoding result geo", slogutil.KeyError, err)
+
+		return
+	}
+
+	ent.Result.Geo = m
+}
+
+// decodeResultTrace decodes the decision trace of the result.
+func (l *queryLog) decodeResultTrace(ctx context.Context, dec *json.Decoder, ent *logEntry) {
+	var trace []*filtering.TraceStep
+	err := dec.Decode(&trace)
+	if err != nil {
+		l.logger.DebugContext(ctx, "decoding result trace", slogutil.KeyError, err)
+
+		return
+	}
+
+	ent.Result.Trace = trace
+}
+
 // translateResult converts some fields of the ent.Result to the format
 // consistent with current implementation.
 func translateResult(ent *logEntry) {
@@ -701,6 +848,12 @@ func (l *queryLog) resultDecHandler(
 		l.decodeResultRules(ctx, dec, ent)
 	case "DNSRewriteResult":
 		l.decodeResultDNSRewriteResult(ctx, dec, ent)
+	case "Threat":
+		l.decodeResultThreat(ctx, dec, ent)
+	case "Geo":
+		l.decodeResultGeo(ctx, dec, ent)
+	case "Trace":
+		l.decodeResultTrace(ctx, dec, ent)
 	default:
 		ok = false
 	}
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/geoip"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/threatfeed"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/testutil"
@@ -44,7 +46,15 @@ func TestQueryLog_DecodeLogEntry_success(t *testing.T) {
 		`"ECS":"1.2.3.0/24",` +
 		`"Answer":"` + ansStr + `",` +
 		`"Cached":true,` +
+		`"Stale":true,` +
 		`"AD":true,` +
+		`"DO":true,` +
+		`"RC":"NOERROR",` +
+		`"ReqSize":42,` +
+		`"RespSize":58,` +
+		`"ECSScope":24,` +
+		`"UpstreamRTT":537429,` +
+		`"CacheTTL":300,` +
 		`"Result":{` +
 		`"IsFiltered":true,` +
 		`"Reason":3,` +
@@ -53,6 +63,10 @@ func TestQueryLog_DecodeLogEntry_success(t *testing.T) {
 		`{"FilterListID":43,"Text":"||an2.yandex.ru","IP":"127.0.0.3"}],` +
 		`"CanonName":"example.com",` +
 		`"ServiceName":"example.org",` +
+		`"Threat":{"feed":"urlhaus","category":"malware_download","confidence":80},` +
+		`"Geo":{"addr":"192.0.2.1","country":"DE","asn":64500,"blocked":true},` +
+		`"Trace":[{"Name":"rewrites"},` +
+		`{"Name":"filtering","Rules":[{"FilterListID":42,"Text":"||an.yandex.ru"}],"Reason":3}],` +
 		`"DNSRewriteResult":{"RCode":0,"Response":{"1":["127.0.0.2"]}}},` +
 		`"Upstream":"https://some.upstream",` +
 		`"Elapsed":837429}`
@@ -69,7 +83,28 @@ func TestQueryLog_DecodeLogEntry_success(t *testing.T) {
 		},
 		CanonName:   "example.com",
 		ServiceName: "example.org",
-		IPList:      []netip.Addr{netip.AddrFrom4([4]byte{127, 0, 0, 2})},
+		Threat: &threatfeed.Indicator{
+			Feed:       "urlhaus",
+			Category:   "malware_download",
+			Confidence: 80,
+		},
+		Geo: &geoip.Match{
+			Addr:    netip.MustParseAddr("192.0.2.1"),
+			Country: "DE",
+			ASN:     64500,
+			Blocked: true,
+		},
+		Trace: []*filtering.TraceStep{{
+			Name: "rewrites",
+		}, {
+			Name: "filtering",
+			Rules: []*filtering.ResultRule{{
+				FilterListID: 42,
+				Text:         "||an.yandex.ru",
+			}},
+			Reason: filtering.FilteredBlockList,
+		}},
+		IPList: []netip.Addr{netip.AddrFrom4([4]byte{127, 0, 0, 2})},
 		Rules: []*filtering.ResultRule{{
 			FilterListID: 42,
 			Text:         "||an.yandex.ru",
@@ -97,7 +132,15 @@ func TestQueryLog_DecodeLogEntry_success(t *testing.T) {
 		Result:            result,
 		Upstream:          "https://some.upstream",
 		Elapsed:           837429,
+		RCode:             "NOERROR",
+		ReqSize:           42,
+		RespSize:          58,
+		ECSScope:          24,
+		UpstreamRTT:       537429,
+		CacheTTL:          300,
 		AuthenticatedData: true,
+		Stale:             true,
+		DNSSECOK:          true,
 	}
 
 	got := &logEntry{}
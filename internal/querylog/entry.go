@@ -4,6 +4,7 @@ import (
 	"context"
 	"log/slog"
 	"net"
+	"slices"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
@@ -40,8 +41,36 @@ type logEntry struct {
 
 	Elapsed time.Duration
 
+	// UpstreamRTT is the time spent for the exchange with the upstream server,
+	// if any.  Unlike Elapsed, it doesn't include the local processing.
+	UpstreamRTT time.Duration `json:",omitempty"`
+
+	// CacheTTL is the remaining TTL of the cached answer in seconds.  It's
+	// only set when Cached is true.
+	CacheTTL uint32 `json:",omitempty"`
+
+	// RCode is the textual representation of the response code of the answer,
+	// if any.
+	RCode string `json:"RC,omitempty"`
+
+	// ReqSize is the size of the request message in bytes.
+	ReqSize int `json:",omitempty"`
+
+	// RespSize is the size of the answer message in bytes, if any.
+	RespSize int `json:",omitempty"`
+
+	// ECSScope is the scope prefix length of the EDNS Client-Subnet option of
+	// the answer, if any.
+	ECSScope uint8 `json:",omitempty"`
+
 	Cached            bool `json:",omitempty"`
 	AuthenticatedData bool `json:"AD,omitempty"`
+
+	// Stale shows if the expired response has been served.
+	Stale bool `json:",omitempty"`
+
+	// DNSSECOK shows if the request had the DNSSEC OK (DO) bit set.
+	DNSSECOK bool `json:"DO,omitempty"`
 }
 
 // shallowClone returns a shallow clone of e.
@@ -73,6 +102,77 @@ func (e *logEntry) addResponse(ctx context.Context, l *slog.Logger, resp *dns.Ms
 	}
 }
 
+// rcode returns the textual representation of the response code of e's answer.
+// ok is false if there is no valid answer.
+func (e *logEntry) rcode() (rcode string, ok bool) {
+	if e.RCode != "" {
+		return e.RCode, true
+	}
+
+	// Older entries don't have the response code stored separately, so try
+	// to get it from the answer.
+	if len(e.Answer) == 0 {
+		return "", false
+	}
+
+	msg := &dns.Msg{}
+	if err := msg.Unpack(e.Answer); err != nil {
+		return "", false
+	}
+
+	return dns.RcodeToString[msg.Rcode], true
+}
+
+// addRequestData adds the data about the request message req to e.
+func (e *logEntry) addRequestData(req *dns.Msg) {
+	e.ReqSize = req.Len()
+	if o := req.IsEdns0(); o != nil {
+		e.DNSSECOK = o.Do()
+	}
+}
+
+// addResponseData adds the data about the response message resp to e, if resp
+// is not nil.
+func (e *logEntry) addResponseData(resp *dns.Msg) {
+	if resp == nil {
+		return
+	}
+
+	e.RCode = dns.RcodeToString[resp.Rcode]
+	e.RespSize = resp.Len()
+
+	o := resp.IsEdns0()
+	if o == nil {
+		return
+	}
+
+	for _, opt := range o.Option {
+		if subnet, ok := opt.(*dns.EDNS0_SUBNET); ok {
+			e.ECSScope = subnet.SourceScope
+
+			return
+		}
+	}
+}
+
+// minTTL returns the minimum TTL of the answer and authority records of resp,
+// if any.
+func minTTL(resp *dns.Msg) (ttl uint32) {
+	if resp == nil {
+		return 0
+	}
+
+	found := false
+	for _, rr := range slices.Concat(resp.Answer, resp.Ns) {
+		if rrTTL := rr.Header().Ttl; !found || rrTTL < ttl {
+			ttl = rrTTL
+			found = true
+		}
+	}
+
+	return ttl
+}
+
 // parseDNSRewriteResultIPs fills logEntry's DNSRewriteResult response records
 // with the IP addresses parsed from the raw strings.
 func (e *logEntry) parseDNSRewriteResultIPs() {
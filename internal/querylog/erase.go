@@ -0,0 +1,208 @@
+package querylog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// eraseClientReq is the JSON structure for the request body of the POST
+// /control/querylog/erase_client HTTP API.
+type eraseClientReq struct {
+	// Client is the IP address or the ClientID of the client, entries of which
+	// must be removed.
+	Client string `json:"client"`
+}
+
+// eraseClientResp is the JSON structure for the response body of the POST
+// /control/querylog/erase_client HTTP API.
+type eraseClientResp struct {
+	// Deleted is the number of removed entries.
+	Deleted uint `json:"deleted"`
+}
+
+// handleQueryLogEraseClient is the handler for the POST
+// /control/querylog/erase_client HTTP API.
+func (l *queryLog) handleQueryLogEraseClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	req := &eraseClientReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l.logger, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	id := strings.TrimSpace(req.Client)
+	if id == "" {
+		aghhttp.ErrorAndLog(ctx, l.logger, r, w, http.StatusBadRequest, "client: %s", errors.ErrEmptyValue)
+
+		return
+	}
+
+	n, err := l.eraseClient(ctx, id)
+	if err != nil {
+		aghhttp.ErrorAndLog(
+			ctx,
+			l.logger,
+			r,
+			w,
+			http.StatusInternalServerError,
+			"erasing client entries: %s",
+			err,
+		)
+
+		return
+	}
+
+	l.logger.InfoContext(ctx, "erased client entries", "count", n)
+
+	aghhttp.WriteJSONResponseOK(ctx, l.logger, w, r, &eraseClientResp{Deleted: n})
+}
+
+// clientMatcher returns true if the textual representations of the IP address
+// and the ClientID of an entry belong to the client.
+type clientMatcher func(ip, clientID string) (ok bool)
+
+// newClientMatcher returns a clientMatcher for the client with the given IP
+// address or ClientID.
+func newClientMatcher(id string) (m clientMatcher) {
+	addr, err := netip.ParseAddr(id)
+	if err != nil {
+		return func(_, clientID string) (ok bool) {
+			return clientID == id
+		}
+	}
+
+	addr = addr.Unmap()
+
+	return func(ip, clientID string) (ok bool) {
+		if clientID == id {
+			return true
+		}
+
+		entAddr, parseErr := netip.ParseAddr(ip)
+
+		return parseErr == nil && entAddr.Unmap() == addr
+	}
+}
+
+// eraseClient removes all entries of the client with the IP address or the
+// ClientID id from the memory buffer and the log files.  n is the number of
+// removed entries.
+func (l *queryLog) eraseClient(ctx context.Context, id string) (n uint, err error) {
+	match := newClientMatcher(id)
+
+	l.fileFlushLock.Lock()
+	defer l.fileFlushLock.Unlock()
+
+	n = l.eraseClientFromBuffer(match)
+
+	l.fileWriteLock.Lock()
+	defer l.fileWriteLock.Unlock()
+
+	var errs []error
+	for _, path := range []string{l.logFile + ".1", l.logFile} {
+		var fileN uint
+		fileN, err = l.eraseClientFromFile(path, match)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("file %q: %w", path, err))
+		}
+
+		n += fileN
+	}
+
+	l.logger.DebugContext(ctx, "erased client entries", "count", n)
+
+	return n, errors.Join(errs...)
+}
+
+// eraseClientFromBuffer removes the entries matched by match from the memory
+// buffer.  n is the number of removed entries.
+func (l *queryLog) eraseClientFromBuffer(match clientMatcher) (n uint) {
+	l.bufferLock.Lock()
+	defer l.bufferLock.Unlock()
+
+	kept := make([]*logEntry, 0, l.buffer.Len())
+	l.buffer.Range(func(e *logEntry) (cont bool) {
+		if match(e.IP.String(), e.ClientID) {
+			n++
+		} else {
+			kept = append(kept, e)
+		}
+
+		return true
+	})
+
+	if n == 0 {
+		return 0
+	}
+
+	l.buffer.Clear()
+	for _, e := range kept {
+		l.buffer.Push(e)
+	}
+
+	return n
+}
+
+// eraseClientFromFile rewrites the log file at path without the entries
+// matched by match.  n is the number of removed entries.  It's not an error if
+// the file doesn't exist.  l.fileWriteLock is expected to be locked.
+func (l *queryLog) eraseClientFromFile(path string, match clientMatcher) (n uint, err error) {
+	// #nosec G304 -- Trust the path, since it's the query log file path.
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("opening: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	tmpFile, err := aghrenameio.NewPendingFile(path, aghos.DefaultPermFile)
+	if err != nil {
+		return 0, fmt.Errorf("creating temp file: %w", err)
+	}
+	defer func() { err = aghrenameio.WithDeferredCleanup(err, tmpFile) }()
+
+	w := bufio.NewWriter(tmpFile)
+	r := bufio.NewReader(f)
+	for {
+		var line string
+		line, err = r.ReadString('\n')
+		if line != "" {
+			if match(readJSONValue(line, `"IP":"`), readJSONValue(line, `"CID":"`)) {
+				n++
+			} else if _, wErr := w.WriteString(line); wErr != nil {
+				return 0, fmt.Errorf("writing: %w", wErr)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("reading: %w", err)
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return 0, fmt.Errorf("flushing: %w", err)
+	}
+
+	return n, nil
+}
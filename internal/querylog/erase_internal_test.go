@@ -0,0 +1,107 @@
+package querylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLog_HandleQueryLogEraseClient(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Logger:      slogutil.NewDiscardLogger(),
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	var (
+		ip1 = net.IPv4(192, 0, 2, 1)
+		ip2 = net.IPv4(192, 0, 2, 2)
+	)
+
+	const clientID = "cli1"
+
+	add := func(ip net.IP, cid string) {
+		q := &dns.Msg{}
+		q.SetQuestion("example.org.", dns.TypeA)
+
+		l.Add(&AddParams{
+			Question: q,
+			ClientIP: ip,
+			ClientID: cid,
+		})
+	}
+
+	// Older file.
+	add(ip1, "")
+	add(ip2, "")
+	require.NoError(t, l.flushLogBuffer(ctx))
+	require.NoError(t, l.rotate(ctx))
+
+	// Newer file.
+	add(ip1, clientID)
+	add(ip2, "")
+	require.NoError(t, l.flushLogBuffer(ctx))
+
+	// Memory buffer.
+	add(ip1, "")
+	add(ip2, clientID)
+
+	erase := func(t *testing.T, client string) (code int, resp *eraseClientResp) {
+		t.Helper()
+
+		b, mErr := json.Marshal(&eraseClientReq{Client: client})
+		require.NoError(t, mErr)
+
+		r := httptest.NewRequest(http.MethodPost, "/control/querylog/erase_client", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+
+		l.handleQueryLogEraseClient(w, r)
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+
+		resp = &eraseClientResp{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+
+		return w.Code, resp
+	}
+
+	code, resp := erase(t, ip1.String())
+	require.Equal(t, http.StatusOK, code)
+
+	assert.Equal(t, uint(3), resp.Deleted)
+
+	entries, _ := l.search(ctx, newSearchParams())
+	require.Len(t, entries, 3)
+
+	for _, e := range entries {
+		assert.True(t, e.IP.Equal(ip2))
+	}
+
+	code, resp = erase(t, clientID)
+	require.Equal(t, http.StatusOK, code)
+
+	assert.Equal(t, uint(1), resp.Deleted)
+
+	entries, _ = l.search(ctx, newSearchParams())
+	assert.Len(t, entries, 2)
+
+	code, _ = erase(t, " ")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
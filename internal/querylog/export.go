@@ -0,0 +1,393 @@
+package querylog
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// exportFormat is the format of the exported query log.
+type exportFormat string
+
+// Valid export formats.
+const (
+	exportFormatCSV    exportFormat = "csv"
+	exportFormatNDJSON exportFormat = "ndjson"
+)
+
+// newExportFormat validates that s is a valid export format and returns it as
+// an exportFormat.  An empty s means [exportFormatNDJSON].
+func newExportFormat(s string) (f exportFormat, err error) {
+	switch f = exportFormat(s); f {
+	case "":
+		return exportFormatNDJSON, nil
+	case exportFormatCSV, exportFormatNDJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf(
+			"invalid format %q: should be one of %q",
+			s,
+			[]exportFormat{exportFormatCSV, exportFormatNDJSON},
+		)
+	}
+}
+
+// contentType returns the value of the Content-Type header for f.
+func (f exportFormat) contentType() (ct string) {
+	if f == exportFormatCSV {
+		return "text/csv"
+	}
+
+	return "application/x-ndjson"
+}
+
+// contentDisposition returns the value of the Content-Disposition header for
+// f.
+func (f exportFormat) contentDisposition() (cd string) {
+	return fmt.Sprintf("attachment; filename=querylog.%s", f)
+}
+
+// exportWriter writes exported query log entries.
+type exportWriter interface {
+	// writeEntry writes a single entry.  e must not be nil.
+	writeEntry(ctx context.Context, e *logEntry) (err error)
+
+	// flush writes any buffered data to the underlying writer.
+	flush() (err error)
+}
+
+// newExportWriter returns a new exportWriter for the format.  All arguments
+// must not be nil.
+func (l *queryLog) newExportWriter(
+	f exportFormat,
+	w io.Writer,
+	anonFunc aghnet.IPMutFunc,
+) (ew exportWriter) {
+	if f == exportFormatCSV {
+		return &csvExportWriter{
+			l:        l,
+			w:        csv.NewWriter(w),
+			anonFunc: anonFunc,
+		}
+	}
+
+	return &ndjsonExportWriter{
+		l:        l,
+		enc:      json.NewEncoder(w),
+		anonFunc: anonFunc,
+	}
+}
+
+// ndjsonExportWriter is an [exportWriter] that writes entries as
+// newline-delimited JSON objects of the same structure as the ones returned by
+// the GET /control/querylog HTTP API.
+type ndjsonExportWriter struct {
+	l        *queryLog
+	enc      *json.Encoder
+	anonFunc aghnet.IPMutFunc
+}
+
+// type check
+var _ exportWriter = (*ndjsonExportWriter)(nil)
+
+// writeEntry implements the [exportWriter] interface for *ndjsonExportWriter.
+func (w *ndjsonExportWriter) writeEntry(ctx context.Context, e *logEntry) (err error) {
+	return w.enc.Encode(w.l.entryToJSON(ctx, e, w.anonFunc))
+}
+
+// flush implements the [exportWriter] interface for *ndjsonExportWriter.  err
+// is always nil, since the encoder doesn't buffer.
+func (w *ndjsonExportWriter) flush() (err error) {
+	return nil
+}
+
+// csvExportHeader is the header row of the CSV export.
+var csvExportHeader = []string{
+	"time",
+	"client",
+	"client_id",
+	"client_name",
+	"client_proto",
+	"question_name",
+	"question_type",
+	"question_class",
+	"status",
+	"reason",
+	"rule",
+	"filter_id",
+	"service_name",
+	"upstream",
+	"elapsed_ms",
+	"cached",
+}
+
+// csvExportWriter is an [exportWriter] that writes entries as CSV records
+// with [csvExportHeader] columns.
+type csvExportWriter struct {
+	l        *queryLog
+	w        *csv.Writer
+	anonFunc aghnet.IPMutFunc
+
+	// headerWritten is true if the header row has already been written.
+	headerWritten bool
+}
+
+// type check
+var _ exportWriter = (*csvExportWriter)(nil)
+
+// writeEntry implements the [exportWriter] interface for *csvExportWriter.
+func (w *csvExportWriter) writeEntry(ctx context.Context, e *logEntry) (err error) {
+	err = w.writeHeader()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	ip := slices.Clone(e.IP)
+	w.anonFunc(ip)
+
+	var name string
+	if e.client != nil && ip.Equal(e.IP) {
+		name = e.client.Name
+	}
+
+	status, _ := e.rcode()
+
+	var rule, filterID string
+	if len(e.Result.Rules) > 0 {
+		if r := e.Result.Rules[0]; len(r.Text) > 0 {
+			rule = r.Text
+			filterID = strconv.FormatUint(uint64(r.FilterListID), 10)
+		}
+	}
+
+	return w.w.Write([]string{
+		e.Time.Format(time.RFC3339Nano),
+		ip.String(),
+		e.ClientID,
+		name,
+		string(e.ClientProto),
+		e.QHost,
+		e.QType,
+		e.QClass,
+		status,
+		e.Result.Reason.String(),
+		rule,
+		filterID,
+		e.Result.ServiceName,
+		e.Upstream,
+		strconv.FormatFloat(e.Elapsed.Seconds()*1000, 'f', -1, 64),
+		strconv.FormatBool(e.Cached),
+	})
+}
+
+// writeHeader writes the header row, unless it has already been written.
+func (w *csvExportWriter) writeHeader() (err error) {
+	if w.headerWritten {
+		return nil
+	}
+
+	err = w.w.Write(csvExportHeader)
+	if err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	w.headerWritten = true
+
+	return nil
+}
+
+// flush implements the [exportWriter] interface for *csvExportWriter.  It
+// also writes the header row, if there were no entries written.
+func (w *csvExportWriter) flush() (err error) {
+	err = w.writeHeader()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	w.w.Flush()
+
+	return w.w.Error()
+}
+
+// handleQueryLogExport is the handler for the GET /control/querylog/export
+// HTTP API.
+func (l *queryLog) handleQueryLogExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params, format, err := l.parseExportParams(ctx, r)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l.logger, r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, format.contentType())
+	h.Set(httphdr.ContentDisposition, format.contentDisposition())
+	h.Set(httphdr.Server, aghhttp.UserAgent())
+
+	ew := l.newExportWriter(format, w, l.anonymizer.Load())
+
+	// The response may already be partially written, so only log the error.
+	err = l.export(ctx, params, ew)
+	if err != nil {
+		l.logger.ErrorContext(ctx, "exporting query log", slogutil.KeyError, err)
+	}
+}
+
+// parseExportParams parses the search parameters and the export format from
+// the HTTP request's query string.  Unlike the search API, the number of
+// exported entries is not limited unless the limit parameter is set.
+func (l *queryLog) parseExportParams(
+	ctx context.Context,
+	r *http.Request,
+) (p *searchParams, f exportFormat, err error) {
+	p, err = l.parseSearchParams(ctx, r)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, "", err
+	}
+
+	q := r.URL.Query()
+	if !q.Has("limit") {
+		p.limit = 0
+	}
+
+	p.offset = 0
+	p.maxFileScanEntries = 0
+
+	newerThan := q.Get("newer_than")
+	if newerThan != "" {
+		p.newerThan, err = time.Parse(time.RFC3339Nano, newerThan)
+		if err != nil {
+			return nil, "", fmt.Errorf("newer_than: %w", err)
+		}
+	}
+
+	f, err = newExportFormat(q.Get("format"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return p, f, nil
+}
+
+// export writes the log entries matching params from the memory buffer and the
+// log files into ew, newest first.  A non-positive params.limit means that the
+// number of entries is unlimited.  l.confMu is only locked while searching the
+// memory buffer and while reading each file entry, so that the export, which
+// may take a long time, doesn't block the configuration updates and the logging
+// of new entries.
+func (l *queryLog) export(ctx context.Context, params *searchParams, ew exportWriter) (err error) {
+	defer func() { err = errors.WithDeferred(err, ew.flush()) }()
+
+	cache := clientCache{}
+	memEntries := l.exportMemory(ctx, params, cache)
+
+	n := 0
+	for _, e := range memEntries {
+		if params.limit > 0 && n >= params.limit {
+			return nil
+		}
+
+		err = ew.writeEntry(ctx, e)
+		if err != nil {
+			return fmt.Errorf("writing memory entry: %w", err)
+		}
+
+		n++
+	}
+
+	r, err := l.setQLogReader(ctx, params.olderThan)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	} else if r == nil {
+		return nil
+	}
+
+	defer func() { err = errors.WithDeferred(err, r.Close()) }()
+
+	return l.exportFiles(ctx, r, params, cache, ew, n)
+}
+
+// exportMemory returns the log entries matching params from the memory buffer.
+func (l *queryLog) exportMemory(
+	ctx context.Context,
+	params *searchParams,
+	cache clientCache,
+) (entries []*logEntry) {
+	l.confMu.RLock()
+	defer l.confMu.RUnlock()
+
+	entries, _ = l.searchMemory(ctx, params, cache)
+
+	return entries
+}
+
+// exportFiles writes the log entries matching params from r into ew.  n is the
+// number of entries that have already been written.
+func (l *queryLog) exportFiles(
+	ctx context.Context,
+	r *qLogReader,
+	params *searchParams,
+	cache clientCache,
+	ew exportWriter,
+	n int,
+) (err error) {
+	newerThanNano := params.newerThan.UnixNano()
+	for params.limit <= 0 || n < params.limit {
+		e, ts, rErr := l.exportNextEntry(ctx, r, params, cache)
+		if rErr == io.EOF {
+			return nil
+		} else if rErr != nil {
+			l.logger.ErrorContext(ctx, "reading next entry for export", slogutil.KeyError, rErr)
+		}
+
+		// The files are read from newer to older entries, so there is no need
+		// to read further.
+		if !params.newerThan.IsZero() && ts != 0 && ts <= newerThanNano {
+			return nil
+		}
+
+		if e == nil {
+			continue
+		}
+
+		err = ew.writeEntry(ctx, e)
+		if err != nil {
+			return fmt.Errorf("writing file entry: %w", err)
+		}
+
+		n++
+	}
+
+	return nil
+}
+
+// exportNextEntry reads the next log entry from r the same way
+// [queryLog.readNextEntry] does, but with l.confMu locked for reading.
+func (l *queryLog) exportNextEntry(
+	ctx context.Context,
+	r *qLogReader,
+	params *searchParams,
+	cache clientCache,
+) (e *logEntry, ts int64, err error) {
+	l.confMu.RLock()
+	defer l.confMu.RUnlock()
+
+	return l.readNextEntry(ctx, r, params, cache)
+}
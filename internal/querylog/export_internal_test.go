@@ -0,0 +1,187 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLog_HandleQueryLogExport(t *testing.T) {
+	var l *queryLog
+
+	// lookups and unlockedLookups are the numbers of all client lookups and of
+	// the ones made without l.confMu locked, which the ignored domains of the
+	// configuration require.
+	var lookups, unlockedLookups atomic.Int32
+
+	l, err := newQueryLog(Config{
+		Logger: slogutil.NewDiscardLogger(),
+		FindClient: func(_ []string) (c *Client, err error) {
+			lookups.Add(1)
+			if l.confMu.TryLock() {
+				l.confMu.Unlock()
+				unlockedLookups.Add(1)
+			}
+
+			return nil, nil
+		},
+		Anonymizer:  aghnet.NewIPMut(nil),
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	addEntry(l, "file.example.org", net.IPv4(192, 0, 2, 1), net.IPv4(203, 0, 113, 1))
+	require.NoError(t, l.flushLogBuffer(ctx))
+
+	addEntry(l, "memory.example.org", net.IPv4(192, 0, 2, 2), net.IPv4(203, 0, 113, 2))
+	addEntry(l, "other.example.com", net.IPv4(192, 0, 2, 3), net.IPv4(203, 0, 113, 3))
+
+	testCases := []struct {
+		name      string
+		query     string
+		wantCT    string
+		wantHosts []string
+	}{{
+		name:      "ndjson_all",
+		query:     "",
+		wantCT:    "application/x-ndjson",
+		wantHosts: []string{"other.example.com", "memory.example.org", "file.example.org"},
+	}, {
+		name:      "ndjson_search",
+		query:     "search=example.org",
+		wantCT:    "application/x-ndjson",
+		wantHosts: []string{"memory.example.org", "file.example.org"},
+	}, {
+		name:      "ndjson_limit",
+		query:     "limit=2",
+		wantCT:    "application/x-ndjson",
+		wantHosts: []string{"other.example.com", "memory.example.org"},
+	}, {
+		name:      "csv_all",
+		query:     "format=csv",
+		wantCT:    "text/csv",
+		wantHosts: []string{"other.example.com", "memory.example.org", "file.example.org"},
+	}, {
+		name:      "csv_client",
+		query:     "format=csv&search=%22203.0.113.1%22",
+		wantCT:    "text/csv",
+		wantHosts: []string{"file.example.org"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/control/querylog/export?"+tc.query, nil)
+			w := httptest.NewRecorder()
+
+			l.handleQueryLogExport(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			assert.Equal(t, tc.wantCT, w.Header().Get(httphdr.ContentType))
+
+			var hosts []string
+			if tc.wantCT == "text/csv" {
+				records, rErr := csv.NewReader(w.Body).ReadAll()
+				require.NoError(t, rErr)
+				require.NotEmpty(t, records)
+
+				assert.Equal(t, csvExportHeader, records[0])
+				for _, rec := range records[1:] {
+					hosts = append(hosts, rec[5])
+				}
+			} else {
+				s := bufio.NewScanner(w.Body)
+				for s.Scan() {
+					var e struct {
+						Question struct {
+							Name string `json:"name"`
+						} `json:"question"`
+					}
+
+					require.NoError(t, json.Unmarshal(s.Bytes(), &e))
+
+					hosts = append(hosts, e.Question.Name)
+				}
+
+				require.NoError(t, s.Err())
+			}
+
+			assert.Equal(t, tc.wantHosts, hosts)
+		})
+	}
+
+	t.Run("unlocked_write", func(t *testing.T) {
+		lookups.Store(0)
+		unlockedLookups.Store(0)
+
+		r := httptest.NewRequest(http.MethodGet, "/control/querylog/export", nil)
+		w := &lockCheckWriter{
+			ResponseRecorder: httptest.NewRecorder(),
+			mu:               l.confMu,
+		}
+
+		l.handleQueryLogExport(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.True(t, w.written)
+		assert.False(t, w.locked)
+
+		// Three entries from three different clients, one of them from the
+		// file.
+		assert.Equal(t, int32(3), lookups.Load())
+		assert.Zero(t, unlockedLookups.Load())
+	})
+
+	t.Run("bad_format", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/control/querylog/export?format=xml", nil)
+		w := httptest.NewRecorder()
+
+		l.handleQueryLogExport(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+// lockCheckWriter is an [http.ResponseWriter] that checks if mu is locked when
+// the response body is written.
+type lockCheckWriter struct {
+	*httptest.ResponseRecorder
+
+	mu *sync.RWMutex
+
+	// written is true if the body has been written.
+	written bool
+
+	// locked is true if mu has been locked during any of the writes.
+	locked bool
+}
+
+// Write implements the [http.ResponseWriter] interface for *lockCheckWriter.
+func (w *lockCheckWriter) Write(b []byte) (n int, err error) {
+	w.written = true
+	if w.mu.TryLock() {
+		w.mu.Unlock()
+	} else {
+		w.locked = true
+	}
+
+	return w.ResponseRecorder.Write(b)
+}
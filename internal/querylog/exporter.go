@@ -0,0 +1,179 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/service"
+)
+
+// exporter sends query log entries to an external storage.
+type exporter interface {
+	// Interface starts and stops the exporter.  Shutdown must send all the
+	// pending data.
+	service.Interface
+
+	// export queues the entry for sending.  It must not block for long.  e must
+	// not be nil and must not be modified.  anonFunc is used to anonymize the
+	// IP address of the client and must not be nil.
+	export(ctx context.Context, e *logEntry, anonFunc aghnet.IPMutFunc)
+}
+
+// newExporters returns the exporters enabled in conf.  All arguments must not
+// be nil.
+func newExporters(logger *slog.Logger, conf *Config) (exps []exporter, err error) {
+	if conf.InfluxDB == nil && conf.Loki == nil {
+		return nil, nil
+	}
+
+	if conf.HTTPClient == nil {
+		return nil, fmt.Errorf("http client: %w", errors.ErrNoValue)
+	}
+
+	if conf.InfluxDB != nil {
+		var e *influxDBExporter
+		e, err = newInfluxDBExporter(
+			logger.With("exporter", "influxdb"),
+			conf.HTTPClient,
+			conf.InfluxDB,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("influxdb: %w", err)
+		}
+
+		exps = append(exps, e)
+	}
+
+	if conf.Loki != nil {
+		var e *lokiExporter
+		e, err = newLokiExporter(logger.With("exporter", "loki"), conf.HTTPClient, conf.Loki)
+		if err != nil {
+			return nil, fmt.Errorf("loki: %w", err)
+		}
+
+		exps = append(exps, e)
+	}
+
+	return exps, nil
+}
+
+// periodicFlush calls flush every ivl until done is closed.
+func periodicFlush(
+	ctx context.Context,
+	logger *slog.Logger,
+	ivl time.Duration,
+	done <-chan struct{},
+	flush func(ctx context.Context) (err error),
+) {
+	defer slogutil.RecoverAndLog(ctx, logger)
+
+	ticker := time.NewTicker(ivl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := flush(ctx)
+			if err != nil {
+				logger.ErrorContext(ctx, "flushing", slogutil.KeyError, err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// maxExportErrRespLen is the maximum length of the response body read from the
+// remote storage in case of an error.
+const maxExportErrRespLen = 1024
+
+// postData sends body to the remote storage using c.  hdr is added to the
+// request headers.  It returns an error if the response status isn't 2xx.
+func postData(
+	ctx context.Context,
+	c *http.Client,
+	u string,
+	hdr http.Header,
+	body []byte,
+) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	respBody, err := io.ReadAll(ioutil.LimitReader(resp.Body, maxExportErrRespLen))
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	return fmt.Errorf(
+		"unexpected status %d: %q",
+		resp.StatusCode,
+		bytes.TrimSpace(respBody),
+	)
+}
+
+// newExportHeader returns the common headers for requests to the remote
+// storages with the given content type.
+func newExportHeader(contentType string) (h http.Header) {
+	return http.Header{
+		httphdr.ContentType: []string{contentType},
+	}
+}
+
+// isBlocked returns true if the request has been blocked by the filtering.
+func (e *logEntry) isBlocked() (ok bool) {
+	return e.Result.IsFiltered && e.Result.Reason.In(
+		filtering.FilteredBlockList,
+		filtering.FilteredBlockedService,
+		filtering.FilteredInvalid,
+		filtering.FilteredParental,
+		filtering.FilteredSafeBrowsing,
+	)
+}
+
+// anonymized returns a shallow clone of e with the IP address of the client
+// processed by anonFunc.  anonFunc must not be nil.
+func (e *logEntry) anonymized(anonFunc aghnet.IPMutFunc) (clone *logEntry) {
+	clone = e.shallowClone()
+	clone.IP = slices.Clone(e.IP)
+	anonFunc(clone.IP)
+
+	return clone
+}
+
+// entryClient returns the identifier of the client of the entry: its ClientID,
+// if any, or its IP address.
+func (e *logEntry) entryClient() (c string) {
+	if e.ClientID != "" {
+		return e.ClientID
+	}
+
+	return e.IP.String()
+}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
@@ -19,6 +20,7 @@ import (
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
 	"golang.org/x/net/idna"
 )
 
@@ -63,7 +65,15 @@ type getConfigResp struct {
 // Register web handlers
 func (l *queryLog) initWeb() {
 	l.conf.HTTPReg.Register(http.MethodGet, "/control/querylog", l.handleQueryLog)
+	l.conf.HTTPReg.Register(http.MethodGet, "/control/querylog/export", l.handleQueryLogExport)
+	l.conf.HTTPReg.Register(http.MethodGet, "/control/querylog/stream", l.handleQueryLogStream)
+	l.conf.HTTPReg.Register(http.MethodGet, "/control/querylog/ws", l.handleQueryLogWebSocket)
 	l.conf.HTTPReg.Register(http.MethodPost, "/control/querylog_clear", l.handleQueryLogClear)
+	l.conf.HTTPReg.Register(
+		http.MethodPost,
+		"/control/querylog/erase_client",
+		l.handleQueryLogEraseClient,
+	)
 	l.conf.HTTPReg.Register(http.MethodGet, "/control/querylog/config", l.handleGetQueryLogConfig)
 	l.conf.HTTPReg.Register(
 		http.MethodPut,
@@ -73,6 +83,11 @@ func (l *queryLog) initWeb() {
 
 	// Deprecated handlers.
 	l.conf.HTTPReg.Register(http.MethodGet, "/control/querylog_info", l.handleQueryLogInfo)
+	l.conf.HTTPReg.Register(
+		http.MethodGet,
+		"/control/clients/{id}/activity",
+		l.handleClientActivity,
+	)
 	l.conf.HTTPReg.Register(http.MethodPost, "/control/querylog_config", l.handleQueryLogConfig)
 }
 
@@ -379,11 +394,20 @@ func (l *queryLog) parseSearchCriterion(
 		if !slices.Contains(filteringStatusValues, val) {
 			return false, sc, fmt.Errorf("invalid value %s", val)
 		}
+	case ctDomain:
+		return l.parseDomainCriterion(ctx, val, strict)
+	case ctUpstream:
+		// Go on.
+	case ctRCode:
+		val = strings.ToUpper(val)
+		if _, ok = dns.StringToRcode[val]; !ok {
+			return false, sc, fmt.Errorf("invalid response code %q", val)
+		}
 	default:
 		return false, sc, fmt.Errorf(
 			"invalid criterion type %v: should be one of %v",
 			ct,
-			[]criterionType{ctTerm, ctFilteringStatus},
+			[]criterionType{ctTerm, ctFilteringStatus, ctDomain, ctUpstream, ctRCode, ctClient},
 		)
 	}
 
@@ -397,6 +421,39 @@ func (l *queryLog) parseSearchCriterion(
 	return true, sc, nil
 }
 
+// parseDomainCriterion parses a search criterion of type [ctDomain].  If val is
+// enclosed in slashes, it's parsed as a case-insensitive regular expression.
+func (l *queryLog) parseDomainCriterion(
+	ctx context.Context,
+	val string,
+	strict bool,
+) (ok bool, sc searchCriterion, err error) {
+	sc = searchCriterion{
+		criterionType: ctDomain,
+		value:         val,
+		strict:        strict,
+	}
+
+	if !strict && len(val) > 2 && val[0] == '/' && val[len(val)-1] == '/' {
+		sc.re, err = regexp.Compile("(?i)" + val[1:len(val)-1])
+		if err != nil {
+			return false, sc, fmt.Errorf("parsing domain regexp: %w", err)
+		}
+
+		return true, sc, nil
+	}
+
+	loweredVal := strings.ToLower(val)
+	asciiVal, err := idna.ToASCII(loweredVal)
+	if err != nil {
+		l.logger.DebugContext(ctx, "converting to ascii", "value", val, slogutil.KeyError, err)
+	} else if asciiVal != loweredVal {
+		sc.asciiVal = asciiVal
+	}
+
+	return true, sc, nil
+}
+
 // parseSearchParams parses search parameters from the HTTP request's query
 // string.
 func (l *queryLog) parseSearchParams(
@@ -437,6 +494,15 @@ func (l *queryLog) parseSearchParams(
 	}, {
 		urlField: "response_status",
 		ct:       ctFilteringStatus,
+	}, {
+		urlField: "domain",
+		ct:       ctDomain,
+	}, {
+		urlField: "upstream",
+		ct:       ctUpstream,
+	}, {
+		urlField: "rcode",
+		ct:       ctRCode,
 	}} {
 		var ok bool
 		var c searchCriterion
@@ -450,5 +516,10 @@ func (l *queryLog) parseSearchParams(
 		}
 	}
 
+	p.sortBy, err = newSortField(q.Get("sort"))
+	if err != nil {
+		return nil, err
+	}
+
 	return p, nil
 }
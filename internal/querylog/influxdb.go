@@ -0,0 +1,360 @@
+package querylog
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+)
+
+// InfluxDBConfig is the configuration of the exporter of the query log entries
+// in InfluxDB line protocol.
+type InfluxDBConfig struct {
+	// URL is the URL of the write endpoint of InfluxDB including the query
+	// parameters, such as the organization and the bucket or the database.  It
+	// must not be nil.
+	URL *url.URL
+
+	// Token, if not empty, is sent in the Authorization header.
+	Token string
+
+	// Measurement is the name of the measurement.  If it's empty,
+	// [DefaultInfluxDBMeasurement] is used.
+	Measurement string
+
+	// FlushIvl is the interval between sending the data.  It must be positive.
+	FlushIvl time.Duration
+
+	// Aggregate, if true, makes the exporter send a single point per each
+	// client, upstream, and blocked status per FlushIvl instead of a point per
+	// each query.
+	Aggregate bool
+}
+
+// DefaultInfluxDBMeasurement is the default name of the InfluxDB measurement.
+const DefaultInfluxDBMeasurement = "adguardhome_query"
+
+// maxInfluxDBPendingLines is the maximum number of lines waiting to be sent to
+// InfluxDB, including the ones that have failed to be sent and are retried.
+// The lines above that are dropped.
+const maxInfluxDBPendingLines = 100_000
+
+// influxDBAggKey is the key of an aggregated InfluxDB point.
+type influxDBAggKey struct {
+	client   string
+	upstream string
+	blocked  bool
+}
+
+// influxDBAggValue is the value of an aggregated InfluxDB point.
+type influxDBAggValue struct {
+	elapsed time.Duration
+	count   uint64
+}
+
+// influxDBExporter is an [exporter] that sends the entries to InfluxDB in line
+// protocol.
+type influxDBExporter struct {
+	logger *slog.Logger
+	client *http.Client
+	header http.Header
+	done   chan struct{}
+
+	// mu protects lines, numLines, numDropped, aggregates, and isStopped.
+	mu *sync.Mutex
+
+	// lines are the pending lines, including the lines of the aggregates that
+	// have failed to be sent.
+	lines      *bytes.Buffer
+	aggregates map[influxDBAggKey]*influxDBAggValue
+
+	// url is the URL of the write endpoint.
+	url         string
+	measurement string
+
+	flushIvl   time.Duration
+	numLines   uint
+	numDropped uint
+	aggregate  bool
+
+	// isStopped is true if the exporter has been shut down.
+	isStopped bool
+}
+
+// newInfluxDBExporter returns a new properly initialized *influxDBExporter.
+// All arguments must not be nil.
+func newInfluxDBExporter(
+	logger *slog.Logger,
+	client *http.Client,
+	conf *InfluxDBConfig,
+) (e *influxDBExporter, err error) {
+	if conf.FlushIvl <= 0 {
+		return nil, fmt.Errorf("flush interval: %w: %s", errors.ErrNotPositive, conf.FlushIvl)
+	}
+
+	header := newExportHeader("text/plain; charset=utf-8")
+	if conf.Token != "" {
+		header.Set(httphdr.Authorization, "Token "+conf.Token)
+	}
+
+	return &influxDBExporter{
+		logger:      logger,
+		client:      client,
+		header:      header,
+		done:        make(chan struct{}),
+		mu:          &sync.Mutex{},
+		lines:       &bytes.Buffer{},
+		aggregates:  map[influxDBAggKey]*influxDBAggValue{},
+		url:         conf.URL.String(),
+		measurement: cmp.Or(conf.Measurement, DefaultInfluxDBMeasurement),
+		flushIvl:    conf.FlushIvl,
+		aggregate:   conf.Aggregate,
+	}, nil
+}
+
+// type check
+var _ exporter = (*influxDBExporter)(nil)
+
+// Start implements the [exporter] interface for *influxDBExporter.
+func (e *influxDBExporter) Start(ctx context.Context) (err error) {
+	go periodicFlush(ctx, e.logger, e.flushIvl, e.done, e.flush)
+
+	return nil
+}
+
+// Shutdown implements the [exporter] interface for *influxDBExporter.
+func (e *influxDBExporter) Shutdown(ctx context.Context) (err error) {
+	e.mu.Lock()
+	isStopped := e.isStopped
+	e.isStopped = true
+	e.mu.Unlock()
+
+	if !isStopped {
+		close(e.done)
+	}
+
+	return e.flush(ctx)
+}
+
+// export implements the [exporter] interface for *influxDBExporter.
+func (e *influxDBExporter) export(
+	_ context.Context,
+	ent *logEntry,
+	anonFunc aghnet.IPMutFunc,
+) {
+	ent = ent.anonymized(anonFunc)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.aggregate {
+		k := influxDBAggKey{
+			client:   ent.entryClient(),
+			upstream: ent.Upstream,
+			blocked:  ent.isBlocked(),
+		}
+
+		v := e.aggregates[k]
+		if v == nil {
+			v = &influxDBAggValue{}
+			e.aggregates[k] = v
+		}
+
+		v.count++
+		v.elapsed += ent.Elapsed
+
+		return
+	}
+
+	if e.numLines >= maxInfluxDBPendingLines {
+		e.numDropped++
+
+		return
+	}
+
+	e.writeEntryLine(e.lines, ent)
+	e.numLines++
+}
+
+// flush sends the pending data to InfluxDB.
+func (e *influxDBExporter) flush(ctx context.Context) (err error) {
+	body, n, dropped := e.takePending(time.Now())
+	if dropped > 0 {
+		e.logger.WarnContext(ctx, "dropped points", "count", dropped)
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	err = postData(ctx, e.client, e.url, e.header, body)
+	if err != nil {
+		e.requeue(body, n)
+
+		return fmt.Errorf("sending %d points: %w", n, err)
+	}
+
+	e.logger.DebugContext(ctx, "sent points", "count", n)
+
+	return nil
+}
+
+// requeue returns the n lines in body, which have failed to be sent, to the
+// pending ones, so that those are sent with the next flush.  The lines that
+// don't fit into [maxInfluxDBPendingLines] are dropped.
+func (e *influxDBExporter) requeue(body []byte, n uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.numLines+n > maxInfluxDBPendingLines {
+		e.numDropped += n
+
+		return
+	}
+
+	lines := bytes.NewBuffer(body)
+	_, _ = lines.Write(e.lines.Bytes())
+
+	e.lines = lines
+	e.numLines += n
+}
+
+// takePending returns the pending lines and resets them.  now is used as the
+// timestamp of aggregated points.
+func (e *influxDBExporter) takePending(now time.Time) (body []byte, n, dropped uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	dropped, e.numDropped = e.numDropped, 0
+
+	if e.aggregate {
+		// Start with the requeued lines, if any.
+		buf := bytes.NewBuffer(bytes.Clone(e.lines.Bytes()))
+		n, e.numLines = e.numLines, 0
+		e.lines.Reset()
+
+		keys := make([]influxDBAggKey, 0, len(e.aggregates))
+		for k := range e.aggregates {
+			keys = append(keys, k)
+		}
+
+		// Sort the keys to make the output stable.
+		slices.SortFunc(keys, func(a, b influxDBAggKey) (res int) {
+			return cmp.Or(
+				strings.Compare(a.client, b.client),
+				strings.Compare(a.upstream, b.upstream),
+				cmpBool(a.blocked, b.blocked),
+			)
+		})
+
+		for _, k := range keys {
+			e.writeAggLine(buf, k, e.aggregates[k], now)
+		}
+
+		clear(e.aggregates)
+
+		return buf.Bytes(), n + uint(len(keys)), dropped
+	}
+
+	body, n = bytes.Clone(e.lines.Bytes()), e.numLines
+	e.lines.Reset()
+	e.numLines = 0
+
+	return body, n, dropped
+}
+
+// cmpBool compares booleans with false being less than true.
+func cmpBool(a, b bool) (res int) {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// writeEntryLine writes a line protocol point for a single entry into buf.
+func (e *influxDBExporter) writeEntryLine(buf *bytes.Buffer, ent *logEntry) {
+	rcode, _ := ent.rcode()
+
+	buf.WriteString(influxDBMeasurementEscaper.Replace(e.measurement))
+	writeInfluxDBTag(buf, "blocked", strconv.FormatBool(ent.isBlocked()))
+	writeInfluxDBTag(buf, "client", ent.entryClient())
+	writeInfluxDBTag(buf, "qtype", ent.QType)
+	writeInfluxDBTag(buf, "rcode", rcode)
+	writeInfluxDBTag(buf, "upstream", ent.Upstream)
+
+	buf.WriteString(" cached=")
+	buf.WriteString(strconv.FormatBool(ent.Cached))
+	buf.WriteString(`,domain="`)
+	buf.WriteString(influxDBFieldEscaper.Replace(ent.QHost))
+	buf.WriteByte('"')
+	buf.WriteString(",elapsed_ms=")
+	buf.WriteString(strconv.FormatFloat(ent.Elapsed.Seconds()*1000, 'f', -1, 64))
+
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(ent.Time.UnixNano(), 10))
+	buf.WriteByte('\n')
+}
+
+// writeAggLine writes a line protocol point for an aggregate into buf.
+func (e *influxDBExporter) writeAggLine(
+	buf *bytes.Buffer,
+	k influxDBAggKey,
+	v *influxDBAggValue,
+	now time.Time,
+) {
+	avg := v.elapsed.Seconds() * 1000 / float64(v.count)
+
+	buf.WriteString(influxDBMeasurementEscaper.Replace(e.measurement))
+	writeInfluxDBTag(buf, "blocked", strconv.FormatBool(k.blocked))
+	writeInfluxDBTag(buf, "client", k.client)
+	writeInfluxDBTag(buf, "upstream", k.upstream)
+
+	buf.WriteString(" count=")
+	buf.WriteString(strconv.FormatUint(v.count, 10))
+	buf.WriteString("i,elapsed_ms_avg=")
+	buf.WriteString(strconv.FormatFloat(avg, 'f', -1, 64))
+
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(now.UnixNano(), 10))
+	buf.WriteByte('\n')
+}
+
+var (
+	// influxDBMeasurementEscaper escapes the measurement names.
+	influxDBMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", "")
+
+	// influxDBTagEscaper escapes the tag keys and values.
+	influxDBTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", "")
+
+	// influxDBFieldEscaper escapes the string field values.
+	influxDBFieldEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", "")
+)
+
+// writeInfluxDBTag writes a tag into buf.  Tags with empty values are skipped,
+// since those aren't allowed by the line protocol.
+func writeInfluxDBTag(buf *bytes.Buffer, key, val string) {
+	if val == "" {
+		return
+	}
+
+	buf.WriteByte(',')
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	buf.WriteString(influxDBTagEscaper.Replace(val))
+}
@@ -0,0 +1,211 @@
+package querylog
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestInfluxDBServer returns a URL of a test InfluxDB server, which sends
+// the bodies of the requests to the returned channel.
+func newTestInfluxDBServer(t *testing.T) (u *url.URL, bodies <-chan string) {
+	t.Helper()
+
+	ch := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Token secret", r.Header.Get(httphdr.Authorization))
+
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		ch <- string(b)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/api/v2/write?bucket=test")
+	require.NoError(t, err)
+
+	return u, ch
+}
+
+func TestQueryLog_influxDB(t *testing.T) {
+	q := &dns.Msg{}
+	q.SetQuestion("example.org.", dns.TypeA)
+
+	blocked := &filtering.Result{
+		IsFiltered: true,
+		Reason:     filtering.FilteredBlockList,
+	}
+
+	testCases := []struct {
+		anonFunc  aghnet.IPMutFunc
+		name      string
+		aggregate bool
+		want      []string
+	}{{
+		anonFunc:  nil,
+		name:      "per_query",
+		aggregate: false,
+		want: []string{
+			`m\ q,blocked=false,client=192.0.2.1,qtype=A,upstream=tls://dns.example cached=false,` +
+				`domain="example.org",elapsed_ms=10 `,
+			`m\ q,blocked=true,client=cli1,qtype=A cached=false,domain="example.org",elapsed_ms=20 `,
+			`m\ q,blocked=false,client=192.0.2.1,qtype=A,upstream=tls://dns.example cached=false,` +
+				`domain="example.org",elapsed_ms=30 `,
+		},
+	}, {
+		anonFunc:  nil,
+		name:      "aggregate",
+		aggregate: true,
+		want: []string{
+			`m\ q,blocked=false,client=192.0.2.1,upstream=tls://dns.example count=2i,elapsed_ms_avg=20 `,
+			`m\ q,blocked=true,client=cli1 count=1i,elapsed_ms_avg=20 `,
+		},
+	}, {
+		anonFunc:  AnonymizeIP,
+		name:      "per_query_anonymized",
+		aggregate: false,
+		want: []string{
+			`m\ q,blocked=false,client=192.0.0.0,qtype=A,upstream=tls://dns.example cached=false,` +
+				`domain="example.org",elapsed_ms=10 `,
+			`m\ q,blocked=true,client=cli1,qtype=A cached=false,domain="example.org",elapsed_ms=20 `,
+			`m\ q,blocked=false,client=192.0.0.0,qtype=A,upstream=tls://dns.example cached=false,` +
+				`domain="example.org",elapsed_ms=30 `,
+		},
+	}, {
+		anonFunc:  AnonymizeIP,
+		name:      "aggregate_anonymized",
+		aggregate: true,
+		want: []string{
+			`m\ q,blocked=false,client=192.0.0.0,upstream=tls://dns.example count=2i,elapsed_ms_avg=20 `,
+			`m\ q,blocked=true,client=cli1 count=1i,elapsed_ms_avg=20 `,
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, bodies := newTestInfluxDBServer(t)
+
+			l, err := newQueryLog(Config{
+				Logger:      slogutil.NewDiscardLogger(),
+				HTTPClient:  http.DefaultClient,
+				Anonymizer:  aghnet.NewIPMut(tc.anonFunc),
+				Enabled:     true,
+				RotationIvl: timeutil.Day,
+				MemSize:     100,
+				BaseDir:     t.TempDir(),
+				InfluxDB: &InfluxDBConfig{
+					URL:         u,
+					Token:       "secret",
+					Measurement: "m q",
+					FlushIvl:    time.Hour,
+					Aggregate:   tc.aggregate,
+				},
+			})
+			require.NoError(t, err)
+
+			l.Add(&AddParams{
+				Question: q,
+				ClientIP: net.IPv4(192, 0, 2, 1),
+				Upstream: "tls://dns.example",
+				Elapsed:  10 * time.Millisecond,
+			})
+			l.Add(&AddParams{
+				Question: q,
+				ClientIP: net.IPv4(192, 0, 2, 2),
+				ClientID: "cli1",
+				Result:   blocked,
+				Elapsed:  20 * time.Millisecond,
+			})
+			l.Add(&AddParams{
+				Question: q,
+				ClientIP: net.IPv4(192, 0, 2, 1),
+				Upstream: "tls://dns.example",
+				Elapsed:  30 * time.Millisecond,
+			})
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			require.NoError(t, l.Shutdown(ctx))
+
+			body, _ := testutil.RequireReceive(t, bodies, testTimeout)
+			lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+			require.Len(t, lines, len(tc.want))
+
+			for i, line := range lines {
+				// Strip the timestamp.
+				line = line[:strings.LastIndexByte(line, ' ')+1]
+				assert.Equal(t, tc.want[i], line)
+			}
+		})
+	}
+}
+
+func TestInfluxDBExporter_flushRetry(t *testing.T) {
+	codes := make(chan int, 2)
+	codes <- http.StatusInternalServerError
+	codes <- http.StatusNoContent
+
+	bodies := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		bodies <- string(b)
+
+		w.WriteHeader(<-codes)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	e, err := newInfluxDBExporter(slogutil.NewDiscardLogger(), http.DefaultClient, &InfluxDBConfig{
+		URL:      u,
+		FlushIvl: time.Hour,
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, e.Start(ctx))
+
+	ent := &logEntry{
+		IP:    net.IPv4(192, 0, 2, 1),
+		QHost: "first.example",
+		QType: "A",
+	}
+	e.export(ctx, ent, AnonymizeIP)
+
+	err = e.flush(ctx)
+	require.Error(t, err)
+
+	failed, _ := testutil.RequireReceive(t, bodies, testTimeout)
+
+	ent.QHost = "second.example"
+	e.export(ctx, ent, AnonymizeIP)
+
+	require.NoError(t, e.Shutdown(ctx))
+
+	retried, _ := testutil.RequireReceive(t, bodies, testTimeout)
+	assert.True(t, strings.HasPrefix(retried, failed))
+	assert.Contains(t, retried, `domain="second.example"`)
+
+	// Make sure that repeated shutdowns don't panic.
+	require.NoError(t, e.Shutdown(ctx))
+}
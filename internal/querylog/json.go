@@ -63,6 +63,7 @@ func (l *queryLog) entryToJSON(
 		"client":       entIP,
 		"client_proto": entry.ClientProto,
 		"cached":       entry.Cached,
+		"dnssec_ok":    entry.DNSSECOK,
 		"upstream":     entry.Upstream,
 		"question":     question,
 		"rules":        resultRulesToJSONRules(entry.Result.Rules),
@@ -78,6 +79,36 @@ func (l *queryLog) entryToJSON(
 
 	if entry.ReqECS != "" {
 		jsonEntry["ecs"] = entry.ReqECS
+		jsonEntry["ecs_scope"] = entry.ECSScope
+	}
+
+	if entry.UpstreamRTT > 0 {
+		jsonEntry["upstream_rtt_ms"] = strconv.FormatFloat(
+			entry.UpstreamRTT.Seconds()*1000,
+			'f',
+			-1,
+			64,
+		)
+	}
+
+	if entry.Cached {
+		jsonEntry["cache_ttl"] = entry.CacheTTL
+	}
+
+	if entry.Stale {
+		jsonEntry["stale"] = true
+	}
+
+	if entry.ReqSize > 0 {
+		jsonEntry["request_size"] = entry.ReqSize
+	}
+
+	if entry.RespSize > 0 {
+		jsonEntry["response_size"] = entry.RespSize
+	}
+
+	if entry.RCode != "" {
+		jsonEntry["status"] = entry.RCode
 	}
 
 	if len(entry.Result.Rules) > 0 {
@@ -91,6 +122,27 @@ func (l *queryLog) entryToJSON(
 		jsonEntry["service_name"] = entry.Result.ServiceName
 	}
 
+	if t := entry.Result.Threat; t != nil {
+		jsonEntry["threat"] = jobject{
+			"feed":       t.Feed,
+			"category":   t.Category,
+			"confidence": t.Confidence,
+		}
+	}
+
+	if g := entry.Result.Geo; g != nil {
+		jsonEntry["geo"] = jobject{
+			"addr":    g.Addr,
+			"country": g.Country,
+			"asn":     g.ASN,
+			"blocked": g.Blocked,
+		}
+	}
+
+	if len(entry.Result.Trace) > 0 {
+		jsonEntry["trace"] = resultTraceToJSON(entry.Result.Trace)
+	}
+
 	l.setMsgData(ctx, entry, jsonEntry)
 	l.setOrigAns(ctx, entry, jsonEntry)
 
@@ -185,6 +237,20 @@ func resultRulesToJSONRules(rules []*filtering.ResultRule) (jsonRules []jobject)
 	return jsonRules
 }
 
+// resultTraceToJSON converts the decision trace steps into their JSON form.
+func resultTraceToJSON(trace []*filtering.TraceStep) (jsonTrace []jobject) {
+	jsonTrace = make([]jobject, len(trace))
+	for i, step := range trace {
+		jsonTrace[i] = jobject{
+			"name":   step.Name,
+			"reason": step.Reason.String(),
+			"rules":  resultRulesToJSONRules(step.Rules),
+		}
+	}
+
+	return jsonTrace
+}
+
 type dnsAnswer struct {
 	Type  string `json:"type"`
 	Value string `json:"value"`
@@ -0,0 +1,358 @@
+package querylog
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// LokiLabel is the name of a label of the query log streams pushed to Loki.
+type LokiLabel string
+
+// Valid Loki labels.  Note that [LokiLabelClient] creates a separate stream for
+// each client, so it should only be used with a small number of clients.
+const (
+	LokiLabelBlocked  LokiLabel = "blocked"
+	LokiLabelClient   LokiLabel = "client"
+	LokiLabelHostname LokiLabel = "hostname"
+	LokiLabelQType    LokiLabel = "qtype"
+	LokiLabelUpstream LokiLabel = "upstream"
+)
+
+// lokiLabelValues are all valid Loki labels.
+var lokiLabelValues = []LokiLabel{
+	LokiLabelBlocked,
+	LokiLabelClient,
+	LokiLabelHostname,
+	LokiLabelQType,
+	LokiLabelUpstream,
+}
+
+// NewLokiLabel validates that s is a valid Loki label and returns it as a
+// LokiLabel.
+func NewLokiLabel(s string) (l LokiLabel, err error) {
+	l = LokiLabel(s)
+	if !slices.Contains(lokiLabelValues, l) {
+		return "", fmt.Errorf("label %q: %w: should be one of %q", s, errors.ErrBadEnumValue, lokiLabelValues)
+	}
+
+	return l, nil
+}
+
+// LokiConfig is the configuration of the exporter of the query log entries to
+// Grafana Loki.
+type LokiConfig struct {
+	// URL is the URL of the push API endpoint of Loki, usually ending with
+	// "/loki/api/v1/push".  It must not be nil.
+	URL *url.URL
+
+	// Username and Password, if Username is not empty, are used for the basic
+	// authentication.
+	Username string
+	Password string
+
+	// TenantID, if not empty, is sent in the X-Scope-OrgID header.
+	TenantID string
+
+	// Hostname is the value of the [LokiLabelHostname] label.
+	Hostname string
+
+	// Labels are the labels attached to the streams.  The entries are grouped
+	// into streams by the values of those.  It must not contain duplicates.
+	Labels []LokiLabel
+
+	// FlushIvl is the interval between pushing the data.  It must be positive.
+	FlushIvl time.Duration
+}
+
+// maxLokiPendingLines is the maximum number of lines waiting to be pushed to
+// Loki, including the ones that have failed to be pushed and are retried.  The
+// lines above that are dropped.
+const maxLokiPendingLines = 100_000
+
+// lokiPushReq is the JSON structure for the request body of the Loki push API.
+type lokiPushReq struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+// lokiStream is a single stream of the Loki push API request.
+type lokiStream struct {
+	// Stream are the labels of the stream.
+	Stream map[LokiLabel]string `json:"stream"`
+
+	// Values are the pairs of the timestamp in nanoseconds and the log line.
+	Values [][2]string `json:"values"`
+}
+
+// lokiExporter is an [exporter] that pushes the entries to Grafana Loki.  The
+// log lines have the same format as the lines of the query log file.
+type lokiExporter struct {
+	logger *slog.Logger
+	client *http.Client
+	header http.Header
+	done   chan struct{}
+
+	// mu protects streams, numLines, numDropped, and isStopped.
+	mu *sync.Mutex
+
+	// streams are the pending streams by their label selectors.
+	streams map[string]*lokiStream
+
+	// url is the URL of the push API endpoint.
+	url      string
+	hostname string
+	labels   []LokiLabel
+
+	flushIvl   time.Duration
+	numLines   uint
+	numDropped uint
+
+	// isStopped is true if the exporter has been shut down.
+	isStopped bool
+}
+
+// newLokiExporter returns a new properly initialized *lokiExporter.  All
+// arguments must not be nil.
+func newLokiExporter(
+	logger *slog.Logger,
+	client *http.Client,
+	conf *LokiConfig,
+) (e *lokiExporter, err error) {
+	if conf.FlushIvl <= 0 {
+		return nil, fmt.Errorf("flush interval: %w: %s", errors.ErrNotPositive, conf.FlushIvl)
+	}
+
+	for i, l := range conf.Labels {
+		if slices.Contains(conf.Labels[:i], l) {
+			return nil, fmt.Errorf("labels: at index %d: %w: %q", i, errors.ErrDuplicated, l)
+		}
+	}
+
+	header := newExportHeader("application/json")
+	if conf.TenantID != "" {
+		header.Set("X-Scope-OrgID", conf.TenantID)
+	}
+
+	if conf.Username != "" {
+		creds := base64.StdEncoding.EncodeToString([]byte(conf.Username + ":" + conf.Password))
+		header.Set(httphdr.Authorization, "Basic "+creds)
+	}
+
+	return &lokiExporter{
+		logger:   logger,
+		client:   client,
+		header:   header,
+		done:     make(chan struct{}),
+		mu:       &sync.Mutex{},
+		streams:  map[string]*lokiStream{},
+		url:      conf.URL.String(),
+		hostname: conf.Hostname,
+		labels:   slices.Clone(conf.Labels),
+		flushIvl: conf.FlushIvl,
+	}, nil
+}
+
+// type check
+var _ exporter = (*lokiExporter)(nil)
+
+// Start implements the [exporter] interface for *lokiExporter.
+func (e *lokiExporter) Start(ctx context.Context) (err error) {
+	go periodicFlush(ctx, e.logger, e.flushIvl, e.done, e.flush)
+
+	return nil
+}
+
+// Shutdown implements the [exporter] interface for *lokiExporter.
+func (e *lokiExporter) Shutdown(ctx context.Context) (err error) {
+	e.mu.Lock()
+	isStopped := e.isStopped
+	e.isStopped = true
+	e.mu.Unlock()
+
+	if !isStopped {
+		close(e.done)
+	}
+
+	return e.flush(ctx)
+}
+
+// export implements the [exporter] interface for *lokiExporter.
+func (e *lokiExporter) export(ctx context.Context, ent *logEntry, anonFunc aghnet.IPMutFunc) {
+	ent = ent.anonymized(anonFunc)
+
+	line, err := json.Marshal(ent)
+	if err != nil {
+		e.logger.ErrorContext(ctx, "encoding entry", slogutil.KeyError, err)
+
+		return
+	}
+
+	labels := e.entryLabels(ent)
+	sel := lokiSelector(e.labels, labels)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.numLines >= maxLokiPendingLines {
+		e.numDropped++
+
+		return
+	}
+
+	s := e.streams[sel]
+	if s == nil {
+		s = &lokiStream{
+			Stream: labels,
+		}
+		e.streams[sel] = s
+	}
+
+	s.Values = append(s.Values, [2]string{
+		strconv.FormatInt(ent.Time.UnixNano(), 10),
+		string(line),
+	})
+	e.numLines++
+}
+
+// entryLabels returns the values of the configured labels for the entry.
+// Labels with empty values are omitted.
+func (e *lokiExporter) entryLabels(ent *logEntry) (labels map[LokiLabel]string) {
+	labels = make(map[LokiLabel]string, len(e.labels))
+	for _, l := range e.labels {
+		var v string
+		switch l {
+		case LokiLabelBlocked:
+			v = strconv.FormatBool(ent.isBlocked())
+		case LokiLabelClient:
+			v = ent.entryClient()
+		case LokiLabelHostname:
+			v = e.hostname
+		case LokiLabelQType:
+			v = ent.QType
+		case LokiLabelUpstream:
+			v = ent.Upstream
+		}
+
+		if v != "" {
+			labels[l] = v
+		}
+	}
+
+	return labels
+}
+
+// lokiSelector returns a string uniquely identifying the set of label values.
+// order is the order of the labels.
+func lokiSelector(order []LokiLabel, labels map[LokiLabel]string) (sel string) {
+	b := &strings.Builder{}
+	for _, l := range order {
+		v, ok := labels[l]
+		if !ok {
+			continue
+		}
+
+		b.WriteString(string(l))
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(v))
+		b.WriteByte(',')
+	}
+
+	return b.String()
+}
+
+// flush pushes the pending streams to Loki.
+func (e *lokiExporter) flush(ctx context.Context) (err error) {
+	req, n, dropped := e.takePending()
+	if dropped > 0 {
+		e.logger.WarnContext(ctx, "dropped lines", "count", dropped)
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding request: %w", err)
+	}
+
+	err = postData(ctx, e.client, e.url, e.header, body)
+	if err != nil {
+		e.requeue(req, n)
+
+		return fmt.Errorf("pushing %d lines: %w", n, err)
+	}
+
+	e.logger.DebugContext(ctx, "pushed lines", "count", n)
+
+	return nil
+}
+
+// requeue returns the n lines of req, which have failed to be pushed, to the
+// pending streams, so that those are pushed with the next flush.  The lines
+// that don't fit into [maxLokiPendingLines] are dropped.
+func (e *lokiExporter) requeue(req *lokiPushReq, n uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.numLines+n > maxLokiPendingLines {
+		e.numDropped += n
+
+		return
+	}
+
+	for _, s := range req.Streams {
+		sel := lokiSelector(e.labels, s.Stream)
+		if pending := e.streams[sel]; pending != nil {
+			// Keep the older lines first.
+			s.Values = append(s.Values, pending.Values...)
+		}
+
+		e.streams[sel] = s
+	}
+
+	e.numLines += n
+}
+
+// takePending returns the pending streams and resets them.
+func (e *lokiExporter) takePending() (req *lokiPushReq, n, dropped uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	dropped, e.numDropped = e.numDropped, 0
+	n, e.numLines = e.numLines, 0
+
+	sels := make([]string, 0, len(e.streams))
+	for sel := range e.streams {
+		sels = append(sels, sel)
+	}
+
+	// Sort the selectors to make the output stable.
+	slices.Sort(sels)
+
+	req = &lokiPushReq{
+		Streams: make([]*lokiStream, 0, len(sels)),
+	}
+
+	for _, sel := range sels {
+		req.Streams = append(req.Streams, e.streams[sel])
+	}
+
+	clear(e.streams)
+
+	return req, n, dropped
+}
@@ -0,0 +1,223 @@
+package querylog
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLokiServer returns a URL of a test Loki server, which sends the
+// decoded push requests to the returned channel.
+func newTestLokiServer(t *testing.T) (u *url.URL, reqs <-chan *lokiPushReq) {
+	t.Helper()
+
+	ch := make(chan *lokiPushReq, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "pass", pass)
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+
+		req := &lokiPushReq{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		ch <- req
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/loki/api/v1/push")
+	require.NoError(t, err)
+
+	return u, ch
+}
+
+// newTestLokiQueryLog returns a query log that exports the entries to the Loki
+// at u using anonFunc to anonymize the clients.
+func newTestLokiQueryLog(t *testing.T, u *url.URL, anonFunc aghnet.IPMutFunc) (l *queryLog) {
+	t.Helper()
+
+	l, err := newQueryLog(Config{
+		Logger:      slogutil.NewDiscardLogger(),
+		HTTPClient:  http.DefaultClient,
+		Anonymizer:  aghnet.NewIPMut(anonFunc),
+		Enabled:     true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+		Loki: &LokiConfig{
+			URL:      u,
+			Username: "user",
+			Password: "pass",
+			TenantID: "tenant",
+			Hostname: "host",
+			Labels:   []LokiLabel{LokiLabelHostname, LokiLabelClient, LokiLabelBlocked},
+			FlushIvl: time.Hour,
+		},
+	})
+	require.NoError(t, err)
+
+	return l
+}
+
+func TestQueryLog_loki(t *testing.T) {
+	u, reqs := newTestLokiServer(t)
+	l := newTestLokiQueryLog(t, u, nil)
+
+	q := &dns.Msg{}
+	q.SetQuestion("example.org.", dns.TypeA)
+
+	l.Add(&AddParams{
+		Question: q,
+		ClientIP: net.IPv4(192, 0, 2, 1),
+	})
+	l.Add(&AddParams{
+		Question: q,
+		ClientIP: net.IPv4(192, 0, 2, 1),
+		Result: &filtering.Result{
+			IsFiltered: true,
+			Reason:     filtering.FilteredBlockList,
+		},
+	})
+	l.Add(&AddParams{
+		Question: q,
+		ClientIP: net.IPv4(192, 0, 2, 1),
+	})
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, l.Shutdown(ctx))
+
+	req, _ := testutil.RequireReceive(t, reqs, testTimeout)
+	require.Len(t, req.Streams, 2)
+
+	wantLabels := []map[LokiLabel]string{{
+		LokiLabelBlocked:  "false",
+		LokiLabelClient:   "192.0.2.1",
+		LokiLabelHostname: "host",
+	}, {
+		LokiLabelBlocked:  "true",
+		LokiLabelClient:   "192.0.2.1",
+		LokiLabelHostname: "host",
+	}}
+
+	for i, s := range req.Streams {
+		assert.Equal(t, wantLabels[i], s.Stream)
+	}
+
+	require.Len(t, req.Streams[0].Values, 2)
+	require.Len(t, req.Streams[1].Values, 1)
+
+	var ent logEntry
+	require.NoError(t, json.Unmarshal([]byte(req.Streams[1].Values[0][1]), &ent))
+
+	assert.Equal(t, "example.org", ent.QHost)
+	assert.True(t, ent.Result.IsFiltered)
+}
+
+func TestQueryLog_lokiAnonymized(t *testing.T) {
+	u, reqs := newTestLokiServer(t)
+	l := newTestLokiQueryLog(t, u, AnonymizeIP)
+
+	q := &dns.Msg{}
+	q.SetQuestion("example.org.", dns.TypeA)
+
+	l.Add(&AddParams{
+		Question: q,
+		ClientIP: net.IPv4(192, 0, 2, 1),
+	})
+	l.Add(&AddParams{
+		Question: q,
+		ClientIP: net.IPv4(192, 0, 2, 2),
+	})
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, l.Shutdown(ctx))
+
+	req, _ := testutil.RequireReceive(t, reqs, testTimeout)
+	require.Len(t, req.Streams, 1)
+
+	s := req.Streams[0]
+	assert.Equal(t, "192.0.0.0", s.Stream[LokiLabelClient])
+	require.Len(t, s.Values, 2)
+
+	for _, v := range s.Values {
+		var ent logEntry
+		require.NoError(t, json.Unmarshal([]byte(v[1]), &ent))
+
+		assert.Equal(t, net.IPv4(192, 0, 0, 0).To4(), ent.IP.To4())
+	}
+}
+
+func TestLokiExporter_flushRetry(t *testing.T) {
+	codes := make(chan int, 2)
+	codes <- http.StatusInternalServerError
+	codes <- http.StatusNoContent
+
+	reqs := make(chan *lokiPushReq, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &lokiPushReq{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		reqs <- req
+
+		w.WriteHeader(<-codes)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	e, err := newLokiExporter(slogutil.NewDiscardLogger(), http.DefaultClient, &LokiConfig{
+		URL:      u,
+		Labels:   []LokiLabel{LokiLabelQType},
+		FlushIvl: time.Hour,
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, e.Start(ctx))
+
+	ent := &logEntry{
+		IP:    net.IPv4(192, 0, 2, 1),
+		QHost: "first.example",
+		QType: "A",
+	}
+	e.export(ctx, ent, AnonymizeIP)
+
+	err = e.flush(ctx)
+	require.Error(t, err)
+
+	_, _ = testutil.RequireReceive(t, reqs, testTimeout)
+
+	ent.QHost = "second.example"
+	e.export(ctx, ent, AnonymizeIP)
+
+	require.NoError(t, e.Shutdown(ctx))
+
+	req, _ := testutil.RequireReceive(t, reqs, testTimeout)
+	require.Len(t, req.Streams, 1)
+
+	values := req.Streams[0].Values
+	require.Len(t, values, 2)
+
+	assert.Contains(t, values[0][1], "first.example")
+	assert.Contains(t, values[1][1], "second.example")
+
+	// Make sure that repeated shutdowns don't panic.
+	require.NoError(t, e.Shutdown(ctx))
+}
@@ -36,6 +36,10 @@ type queryLog struct {
 
 	findClient func(ids []string) (c *Client, err error)
 
+	// exporters send the entries to the external storages.  They must not be
+	// modified after the query log is created.
+	exporters []exporter
+
 	// buffer contains recent log entries.  The entries in this buffer must not
 	// be modified.
 	buffer *container.RingBuffer[*logEntry]
@@ -50,6 +54,10 @@ type queryLog struct {
 	fileFlushLock sync.Mutex
 	fileWriteLock sync.Mutex
 
+	// stream distributes the new entries among the subscribers of the live
+	// stream.
+	stream *streamHub
+
 	flushPending bool
 }
 
@@ -93,6 +101,13 @@ func (l *queryLog) Start(ctx context.Context) (err error) {
 
 	go l.periodicRotate(ctx)
 
+	for _, e := range l.exporters {
+		err = e.Start(ctx)
+		if err != nil {
+			return fmt.Errorf("starting exporter: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -101,15 +116,22 @@ func (l *queryLog) Shutdown(ctx context.Context) (err error) {
 	l.confMu.RLock()
 	defer l.confMu.RUnlock()
 
+	var errs []error
 	if l.conf.FileEnabled {
 		err = l.flushLogBuffer(ctx)
 		if err != nil {
-			// Don't wrap the error because it's informative enough as is.
-			return err
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	for _, e := range l.exporters {
+		err = e.Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shutting down exporter: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func checkInterval(ivl time.Duration) (ok bool) {
@@ -199,16 +221,24 @@ func newLogEntry(ctx context.Context, logger *slog.Logger, params *AddParams) (e
 
 		IP: params.ClientIP,
 
-		Elapsed: params.Elapsed,
+		Elapsed:     params.Elapsed,
+		UpstreamRTT: params.UpstreamRTT,
 
 		Cached:            params.Cached,
 		AuthenticatedData: params.AuthenticatedData,
+		Stale:             params.Stale,
 	}
 
 	if params.ReqECS != nil {
 		entry.ReqECS = params.ReqECS.String()
 	}
 
+	entry.addRequestData(params.Question)
+	entry.addResponseData(params.Answer)
+	if params.Cached {
+		entry.CacheTTL = minTTL(params.Answer)
+	}
+
 	entry.addResponse(ctx, logger, params.Answer, false)
 	entry.addResponse(ctx, logger, params.OrigAnswer, true)
 
@@ -246,6 +276,11 @@ func (l *queryLog) Add(params *AddParams) {
 	}
 
 	entry := newLogEntry(ctx, l.logger, params)
+	for _, e := range l.exporters {
+		e.export(ctx, entry, l.anonymizer.Load())
+	}
+
+	l.stream.publish(entry)
 
 	l.bufferLock.Lock()
 	defer l.bufferLock.Unlock()
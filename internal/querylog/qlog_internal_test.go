@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
@@ -397,3 +398,73 @@ func assertLogEntry(tb testing.TB, entry *logEntry, host string, answer, client
 	a := testutil.RequireTypeAssert[*dns.A](tb, msg.Answer[0])
 	assert.Equal(tb, answer, a.A.To16())
 }
+
+func TestNewLogEntry_msgData(t *testing.T) {
+	req := &dns.Msg{}
+	req.SetQuestion("example.org.", dns.TypeA)
+	req.SetEdns0(dns.DefaultMsgSize, true)
+
+	resp := &dns.Msg{}
+	resp.SetRcode(req, dns.RcodeNameError)
+	resp.SetEdns0(dns.DefaultMsgSize, true)
+
+	opt := resp.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: 24,
+		SourceScope:   16,
+		Address:       net.IPv4(192, 0, 2, 0),
+	})
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	e := newLogEntry(ctx, slogutil.NewDiscardLogger(), &AddParams{
+		Question: req,
+		Answer:   resp,
+		Result:   &filtering.Result{},
+		ClientIP: net.IP{1, 2, 3, 4},
+	})
+
+	assert.True(t, e.DNSSECOK)
+	assert.Equal(t, "NXDOMAIN", e.RCode)
+	assert.Equal(t, req.Len(), e.ReqSize)
+	assert.Equal(t, resp.Len(), e.RespSize)
+	assert.Equal(t, uint8(16), e.ECSScope)
+}
+
+func TestNewLogEntry_cacheTTL(t *testing.T) {
+	req := &dns.Msg{}
+	req.SetQuestion("example.org.", dns.TypeA)
+
+	resp := (&dns.Msg{}).SetReply(req)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeA, Ttl: 120},
+		A:   net.IPv4(192, 0, 2, 1),
+	}, &dns.A{
+		Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeA, Ttl: 60},
+		A:   net.IPv4(192, 0, 2, 2),
+	}}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	logger := slogutil.NewDiscardLogger()
+
+	e := newLogEntry(ctx, logger, &AddParams{
+		Question: req,
+		Answer:   resp,
+		Result:   &filtering.Result{},
+		ClientIP: net.IP{1, 2, 3, 4},
+		Cached:   true,
+	})
+	assert.Equal(t, uint32(60), e.CacheTTL)
+	assert.Zero(t, e.UpstreamRTT)
+
+	e = newLogEntry(ctx, logger, &AddParams{
+		Question:    req,
+		Answer:      resp,
+		Result:      &filtering.Result{},
+		ClientIP:    net.IP{1, 2, 3, 4},
+		UpstreamRTT: time.Second,
+	})
+	assert.Zero(t, e.CacheTTL)
+	assert.Equal(t, time.Second, e.UpstreamRTT)
+}
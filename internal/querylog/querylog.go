@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"net/http"
 	"path/filepath"
 	"sync"
 	"time"
@@ -58,6 +59,18 @@ type Config struct {
 	// FindClient returns client information by their IDs.
 	FindClient func(ids []string) (c *Client, err error)
 
+	// HTTPClient is used to send the entries to the external storages.  It
+	// must not be nil if any of those is configured.
+	HTTPClient *http.Client
+
+	// InfluxDB is the configuration of the InfluxDB exporter.  If it's nil,
+	// the entries aren't sent to InfluxDB.
+	InfluxDB *InfluxDBConfig
+
+	// Loki is the configuration of the Grafana Loki exporter.  If it's nil,
+	// the entries aren't pushed to Loki.
+	Loki *LokiConfig
+
 	// BaseDir is the base directory for log files.
 	BaseDir string
 
@@ -111,9 +124,17 @@ type AddParams struct {
 	// Elapsed is the time spent for processing the request.
 	Elapsed time.Duration
 
+	// UpstreamRTT is the time spent for the exchange with the upstream server
+	// that resolved the request, if any.  It's zero for cached responses.
+	UpstreamRTT time.Duration
+
 	// Cached indicates if the response is served from cache.
 	Cached bool
 
+	// Stale indicates if the expired response is served, because the upstreams
+	// have failed or haven't responded in time.
+	Stale bool
+
 	// AuthenticatedData shows if the response had the AD bit set.
 	AuthenticatedData bool
 }
@@ -166,6 +187,8 @@ func newQueryLog(conf Config) (l *queryLog, err error) {
 		logFile: filepath.Join(conf.BaseDir, queryLogFileName),
 
 		anonymizer: conf.Anonymizer,
+
+		stream: newStreamHub(),
 	}
 
 	*l.conf = conf
@@ -175,5 +198,10 @@ func newQueryLog(conf Config) (l *queryLog, err error) {
 		return nil, fmt.Errorf("unsupported interval: %w", err)
 	}
 
+	l.exporters, err = newExporters(conf.Logger, &conf)
+	if err != nil {
+		return nil, fmt.Errorf("exporters: %w", err)
+	}
+
 	return l, nil
 }
@@ -101,6 +101,9 @@ func (l *queryLog) flushToFile(ctx context.Context, b *bytes.Buffer) (err error)
 }
 
 func (l *queryLog) rotate(ctx context.Context) error {
+	l.fileWriteLock.Lock()
+	defer l.fileWriteLock.Unlock()
+
 	from := l.logFile
 	to := l.logFile + ".1"
 
@@ -0,0 +1,265 @@
+package querylog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/miekg/dns"
+)
+
+// ReplayConfig is the configuration for replaying the query log.
+type ReplayConfig struct {
+	// Logger is used for logging the replay.  It must not be nil.
+	Logger *slog.Logger
+
+	// Upstream is the resolver the queries are sent to.  It must not be nil.
+	Upstream upstream.Upstream
+
+	// BaseDir is the directory containing the log files.
+	BaseDir string
+
+	// Since, if not zero, is the time of the oldest replayed entry.
+	Since time.Time
+
+	// Until, if not zero, is the time of the newest replayed entry.
+	Until time.Time
+
+	// Pace, if true, makes the queries sent with the same intervals as the
+	// original ones.  Otherwise, those are sent as fast as possible.
+	Pace bool
+}
+
+// ReplayResult contains the numbers of the replayed queries.
+type ReplayResult struct {
+	// Sent is the number of sent queries.
+	Sent uint64
+
+	// Failed is the number of queries, sending of which failed.
+	Failed uint64
+
+	// Mismatched is the number of queries, responses to which have a response
+	// code different from the logged one.
+	Mismatched uint64
+}
+
+// maxReplayInflight is the maximum number of queries being exchanged with the
+// upstream at the same time during the replay.
+const maxReplayInflight = 64
+
+// maxReplayLineLen is the maximum length of a line of a log file read during
+// the replay.
+const maxReplayLineLen = 1024 * 1024
+
+// Replay reads the entries of the query log files in conf.BaseDir within the
+// configured time range, oldest first, and sends their questions to
+// conf.Upstream.  conf must not be nil.
+func Replay(ctx context.Context, conf *ReplayConfig) (res *ReplayResult, err error) {
+	// Only the logger of the query log is used for decoding the entries.
+	r := &replayer{
+		logger:   conf.Logger,
+		qlog:     &queryLog{logger: conf.Logger},
+		ups:      conf.Upstream,
+		since:    conf.Since,
+		until:    conf.Until,
+		pace:     conf.Pace,
+		sem:      make(chan struct{}, maxReplayInflight),
+		wg:       &sync.WaitGroup{},
+		sent:     &atomic.Uint64{},
+		failed:   &atomic.Uint64{},
+		mismatch: &atomic.Uint64{},
+	}
+
+	logFile := filepath.Join(conf.BaseDir, queryLogFileName)
+
+	var errs []error
+	for _, path := range []string{logFile + ".1", logFile} {
+		err = r.replayFile(ctx, path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("file %q: %w", path, err))
+		}
+	}
+
+	r.wg.Wait()
+
+	return &ReplayResult{
+		Sent:       r.sent.Load(),
+		Failed:     r.failed.Load(),
+		Mismatched: r.mismatch.Load(),
+	}, errors.Join(errs...)
+}
+
+// replayer replays the query log entries.
+type replayer struct {
+	logger *slog.Logger
+	qlog   *queryLog
+	ups    upstream.Upstream
+
+	// sem limits the number of queries in flight.
+	sem chan struct{}
+	wg  *sync.WaitGroup
+
+	sent     *atomic.Uint64
+	failed   *atomic.Uint64
+	mismatch *atomic.Uint64
+
+	since time.Time
+	until time.Time
+
+	// start is the time of the start of the replay and first is the time of
+	// the first replayed entry.  Those are only used if pace is true.
+	start time.Time
+	first time.Time
+
+	pace bool
+}
+
+// replayFile replays the entries of the log file at path, which are written
+// oldest first.  It's not an error if the file doesn't exist.
+func (r *replayer) replayFile(ctx context.Context, path string) (err error) {
+	// #nosec G304 -- Trust the path, since it's the query log file path.
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("opening: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, maxReplayLineLen)
+	for s.Scan() {
+		ent := &logEntry{}
+		r.qlog.decodeLogEntry(ctx, ent, s.Text())
+
+		if ent.QHost == "" || (!r.since.IsZero() && ent.Time.Before(r.since)) {
+			continue
+		}
+
+		if !r.until.IsZero() && ent.Time.After(r.until) {
+			// The entries are sorted by time, so there is no need to read
+			// further.
+			return nil
+		}
+
+		err = r.replayEntry(ctx, ent)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+	}
+
+	return s.Err()
+}
+
+// replayEntry sends the question of ent to the upstream asynchronously.  err is
+// only returned if ctx is done.
+func (r *replayer) replayEntry(ctx context.Context, ent *logEntry) (err error) {
+	if r.pace {
+		err = r.wait(ctx, ent.Time)
+		if err != nil {
+			return err
+		}
+	}
+
+	select {
+	case r.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() { <-r.sem }()
+		defer slogutil.RecoverAndLog(ctx, r.logger)
+
+		r.exchange(ctx, ent)
+	}()
+
+	return nil
+}
+
+// wait waits until the time of sending the query of the entry logged at t
+// comes, keeping the original intervals between the queries.
+func (r *replayer) wait(ctx context.Context, t time.Time) (err error) {
+	if r.first.IsZero() {
+		r.first, r.start = t, time.Now()
+
+		return nil
+	}
+
+	d := t.Sub(r.first) - time.Since(r.start)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// exchange sends the question of ent to the upstream and updates the
+// counters.
+func (r *replayer) exchange(ctx context.Context, ent *logEntry) {
+	req := newReplayRequest(ent)
+
+	r.sent.Add(1)
+	resp, err := r.ups.Exchange(req)
+	if err != nil {
+		r.failed.Add(1)
+		r.logger.DebugContext(ctx, "exchanging", "host", ent.QHost, slogutil.KeyError, err)
+
+		return
+	}
+
+	if want, ok := ent.rcode(); ok && dns.RcodeToString[resp.Rcode] != want {
+		r.mismatch.Add(1)
+		r.logger.DebugContext(
+			ctx,
+			"rcode mismatch",
+			"host", ent.QHost,
+			"qtype", ent.QType,
+			"logged", want,
+			"got", dns.RcodeToString[resp.Rcode],
+		)
+	}
+}
+
+// newReplayRequest returns a new DNS request with the question of ent.
+func newReplayRequest(ent *logEntry) (req *dns.Msg) {
+	qtype, ok := dns.StringToType[ent.QType]
+	if !ok {
+		qtype = dns.TypeA
+	}
+
+	qclass, ok := dns.StringToClass[ent.QClass]
+	if !ok {
+		qclass = dns.ClassINET
+	}
+
+	req = (&dns.Msg{}).SetQuestion(dns.Fqdn(ent.QHost), qtype)
+	req.Question[0].Qclass = qclass
+	if ent.DNSSECOK {
+		req.SetEdns0(dns.DefaultMsgSize, true)
+	}
+
+	return req
+}
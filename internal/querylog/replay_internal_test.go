@@ -0,0 +1,104 @@
+package querylog
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	baseDir := t.TempDir()
+
+	l, err := newQueryLog(Config{
+		Logger:      slogutil.NewDiscardLogger(),
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     baseDir,
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	hosts := []string{"old.example", "first.example", "second.example"}
+	for i, host := range hosts {
+		q := &dns.Msg{}
+		q.SetQuestion(dns.Fqdn(host), dns.TypeAAAA)
+
+		ans := (&dns.Msg{}).SetRcode(q, dns.RcodeNameError)
+
+		l.Add(&AddParams{
+			Question: q,
+			Answer:   ans,
+			ClientIP: net.IPv4(192, 0, 2, 1),
+		})
+
+		if i == 0 {
+			require.NoError(t, l.flushLogBuffer(ctx))
+			require.NoError(t, l.rotate(ctx))
+		}
+	}
+
+	require.NoError(t, l.flushLogBuffer(ctx))
+
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+
+	ups := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		q := req.Question[0]
+		assert.Equal(t, dns.TypeAAAA, q.Qtype)
+
+		got = append(got, q.Name)
+
+		resp = (&dns.Msg{}).SetReply(req)
+		if q.Name == "second.example." {
+			resp.Rcode = dns.RcodeNameError
+		}
+
+		return resp, nil
+	})
+
+	t.Run("all", func(t *testing.T) {
+		got = nil
+
+		res, rErr := Replay(ctx, &ReplayConfig{
+			Logger:   slogutil.NewDiscardLogger(),
+			Upstream: ups,
+			BaseDir:  baseDir,
+		})
+		require.NoError(t, rErr)
+
+		assert.Equal(t, &ReplayResult{Sent: 3, Failed: 0, Mismatched: 2}, res)
+		assert.ElementsMatch(t, []string{"old.example.", "first.example.", "second.example."}, got)
+	})
+
+	t.Run("since", func(t *testing.T) {
+		got = nil
+
+		res, rErr := Replay(ctx, &ReplayConfig{
+			Logger:   slogutil.NewDiscardLogger(),
+			Upstream: ups,
+			BaseDir:  baseDir,
+			Since:    time.Now().Add(time.Hour),
+		})
+		require.NoError(t, rErr)
+
+		assert.Equal(t, &ReplayResult{}, res)
+		assert.Empty(t, got)
+	})
+}
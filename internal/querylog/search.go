@@ -1,6 +1,7 @@
 package querylog
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
@@ -168,6 +169,14 @@ func (l *queryLog) finalizeSearchResults(
 		oldest = entries[len(entries)-1].Time
 	}
 
+	if params.sortBy == sortFieldElapsed {
+		// Only sort the found page so that the pagination by time keeps
+		// working.
+		slices.SortStableFunc(entries, func(a, b *logEntry) (res int) {
+			return -cmp.Compare(a.Elapsed, b.Elapsed)
+		})
+	}
+
 	return entries, oldest
 }
 
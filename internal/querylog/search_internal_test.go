@@ -2,6 +2,8 @@ package querylog
 
 import (
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -100,3 +102,98 @@ func TestQueryLog_Search_findClient(t *testing.T) {
 
 	assert.Equal(t, knownClientName, gotClient.Name)
 }
+
+func TestQueryLog_Search_advanced(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Logger:      slogutil.NewDiscardLogger(),
+		BaseDir:     t.TempDir(),
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		Enabled:     true,
+		FileEnabled: true,
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	addWithRcode := func(host, upstream string, rcode int, elapsed time.Duration) {
+		q := &dns.Msg{}
+		q.SetQuestion(host, dns.TypeA)
+
+		a := &dns.Msg{}
+		a.SetRcode(q, rcode)
+
+		l.Add(&AddParams{
+			Question: q,
+			Answer:   a,
+			Upstream: upstream,
+			ClientIP: net.IP{1, 2, 3, 4},
+			Elapsed:  elapsed,
+		})
+	}
+
+	addWithRcode("a.corp.example.", "tls://dns.corp.example", dns.RcodeNameError, time.Second)
+	addWithRcode("b.corp.example.", "https://dns.public.example", dns.RcodeNameError, time.Millisecond)
+	require.NoError(t, l.flushLogBuffer(ctx))
+
+	addWithRcode("c.corp.example.", "tls://dns.corp.example", dns.RcodeSuccess, 2*time.Second)
+	addWithRcode("corp.example.org.", "tls://dns.corp.example", dns.RcodeNameError, 3*time.Second)
+
+	testCases := []struct {
+		query     string
+		name      string
+		wantErr   bool
+		wantHosts []string
+	}{{
+		query:     "domain=corp.example&rcode=nxdomain",
+		name:      "substring_rcode",
+		wantHosts: []string{"corp.example.org", "b.corp.example", "a.corp.example"},
+	}, {
+		query:     "domain=/%5C.corp%5C.example$/&rcode=NXDOMAIN&upstream=dns.corp",
+		name:      "regexp_rcode_upstream",
+		wantHosts: []string{"a.corp.example"},
+	}, {
+		query:     "domain=%22c.corp.example%22",
+		name:      "strict",
+		wantHosts: []string{"c.corp.example"},
+	}, {
+		query:     "upstream=tls://dns.corp.example&sort=elapsed",
+		name:      "sort_elapsed",
+		wantHosts: []string{"corp.example.org", "c.corp.example", "a.corp.example"},
+	}, {
+		query:   "rcode=BADRCODE",
+		name:    "bad_rcode",
+		wantErr: true,
+	}, {
+		query:   "domain=/(/",
+		name:    "bad_regexp",
+		wantErr: true,
+	}, {
+		query:   "sort=name",
+		name:    "bad_sort",
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/control/querylog?"+tc.query, nil)
+			params, pErr := l.parseSearchParams(ctx, r)
+			if tc.wantErr {
+				assert.Error(t, pErr)
+
+				return
+			}
+
+			require.NoError(t, pErr)
+
+			entries, _ := l.search(ctx, params)
+
+			hosts := make([]string, 0, len(entries))
+			for _, e := range entries {
+				hosts = append(hosts, e.QHost)
+			}
+
+			assert.Equal(t, tc.wantHosts, hosts)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"regexp"
 	"strings"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
@@ -21,6 +22,16 @@ const (
 	//
 	// See (*searchCriterion).ctFilteringStatusCase for details.
 	ctFilteringStatus
+	// ctDomain is for searching by the domain name only.  It supports IDNAs
+	// and regular expressions enclosed in slashes.
+	ctDomain
+	// ctUpstream is for searching by the address of the upstream server.
+	ctUpstream
+	// ctRCode is for searching by the response code, e.g. "NXDOMAIN".
+	ctRCode
+	// ctClient is for searching by the client's IP address, the client's ID,
+	// or the client's name exactly, ignoring the case.
+	ctClient
 )
 
 const (
@@ -47,6 +58,10 @@ var filteringStatusValues = []string{
 
 // searchCriterion is a search criterion that is used to match a record.
 type searchCriterion struct {
+	// re, if not nil, is the regular expression the domain name must match.
+	// It is only used with [ctDomain].
+	re *regexp.Regexp
+
 	value         string
 	asciiVal      string
 	criterionType criterionType
@@ -111,9 +126,23 @@ func (c *searchCriterion) quickMatch(
 		}
 
 		return ctDomainOrClientCaseNonStrict(c.value, c.asciiVal, clientID, name, host, ip)
-	case ctFilteringStatus:
-		// Go on, as we currently don't do quick matches against
-		// filtering statuses.
+	case ctDomain:
+		return c.matchDomain(readJSONValue(line, `"QH":"`))
+	case ctUpstream:
+		return c.matchString(readJSONValue(line, `"Upstream":"`))
+	case ctClient:
+		ip := readJSONValue(line, `"IP":"`)
+		clientID := readJSONValue(line, `"CID":"`)
+
+		var name string
+		if cli := findClient(ctx, logger, clientID, ip); cli != nil {
+			name = cli.Name
+		}
+
+		return c.matchClient(clientID, ip, name)
+	case ctFilteringStatus, ctRCode:
+		// Go on, as we currently don't do quick matches against filtering
+		// statuses and response codes.
 		return true
 	default:
 		return true
@@ -127,11 +156,61 @@ func (c *searchCriterion) match(entry *logEntry) bool {
 		return c.ctDomainOrClientCase(entry)
 	case ctFilteringStatus:
 		return c.ctFilteringStatusCase(entry.Result.Reason, entry.Result.IsFiltered)
+	case ctDomain:
+		return c.matchDomain(entry.QHost)
+	case ctUpstream:
+		return c.matchString(entry.Upstream)
+	case ctRCode:
+		rcode, ok := entry.rcode()
+
+		return ok && rcode == c.value
+	case ctClient:
+		var name string
+		if entry.client != nil {
+			name = entry.client.Name
+		}
+
+		return c.matchClient(entry.ClientID, entry.IP.String(), name)
 	}
 
 	return false
 }
 
+// matchDomain returns true if host matches the criterion of type [ctDomain].
+func (c *searchCriterion) matchDomain(host string) (ok bool) {
+	if c.re != nil {
+		return c.re.MatchString(host)
+	}
+
+	if c.asciiVal != "" {
+		if c.strict && strings.EqualFold(host, c.asciiVal) {
+			return true
+		} else if !c.strict && stringutil.ContainsFold(host, c.asciiVal) {
+			return true
+		}
+	}
+
+	return c.matchString(host)
+}
+
+// matchString returns true if s is equal to the criterion value in the strict
+// mode or contains it otherwise, ignoring the case.
+func (c *searchCriterion) matchString(s string) (ok bool) {
+	if c.strict {
+		return strings.EqualFold(s, c.value)
+	}
+
+	return stringutil.ContainsFold(s, c.value)
+}
+
+// matchClient returns true if any of the client's ClientID, IP address, or
+// name is equal to the criterion value of type [ctClient], ignoring the case.
+func (c *searchCriterion) matchClient(clientID, ip, name string) (ok bool) {
+	return strings.EqualFold(clientID, c.value) ||
+		strings.EqualFold(ip, c.value) ||
+		strings.EqualFold(name, c.value)
+}
+
 func (c *searchCriterion) ctDomainOrClientCase(e *logEntry) bool {
 	clientID := e.ClientID
 	host := e.QHost
@@ -2,20 +2,58 @@ package querylog
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"time"
 )
 
+// sortField is the field by which the search results are sorted.
+type sortField string
+
+// Valid sort fields.
+const (
+	// sortFieldTime sorts the results by time, newest first.
+	sortFieldTime sortField = "time"
+
+	// sortFieldElapsed sorts the results by the processing time, slowest
+	// first.
+	sortFieldElapsed sortField = "elapsed"
+)
+
+// newSortField validates that s is a valid sort field and returns it as a
+// sortField.  An empty s means [sortFieldTime].
+func newSortField(s string) (f sortField, err error) {
+	switch f = sortField(s); f {
+	case "":
+		return sortFieldTime, nil
+	case sortFieldTime, sortFieldElapsed:
+		return f, nil
+	default:
+		return "", fmt.Errorf(
+			"invalid sort field %q: should be one of %q",
+			s,
+			[]sortField{sortFieldTime, sortFieldElapsed},
+		)
+	}
+}
+
 // searchParams represent the search query sent by the client.
 type searchParams struct {
 	// olderThen represents a parameter for entries that are older than this
 	// parameter value.  If not set, disregard it and return any value.
 	olderThan time.Time
 
+	// newerThan represents a parameter for entries that are newer than this
+	// parameter value.  If not set, disregard it and return any value.
+	newerThan time.Time
+
 	// searchCriteria is a list of search criteria that we use to get filter
 	// results.
 	searchCriteria []searchCriterion
 
+	// sortBy is the field by which the found entries are sorted.
+	sortBy sortField
+
 	// offset for the search.
 	offset int
 
@@ -33,6 +71,8 @@ func newSearchParams() *searchParams {
 		// default max log entries to return
 		limit: 500,
 
+		sortBy: sortFieldTime,
+
 		// by default, we scan up to 50k entries at once
 		maxFileScanEntries: 50000,
 	}
@@ -70,6 +110,11 @@ func (s *searchParams) match(entry *logEntry) bool {
 		return false
 	}
 
+	if !s.newerThan.IsZero() && !entry.Time.After(s.newerThan) {
+		// Ignore entries older than what was requested.
+		return false
+	}
+
 	for _, c := range s.searchCriteria {
 		if !c.match(entry) {
 			return false
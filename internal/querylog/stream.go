@@ -0,0 +1,345 @@
+package querylog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// streamWindow is the number of seconds, within which the rolling counters of
+// the live stream are calculated.
+const streamWindow = 60
+
+// streamCountersIvl is the interval between sending the rolling counters to a
+// subscriber of the live stream.
+const streamCountersIvl = 1 * time.Second
+
+// streamSubBufSize is the number of entries buffered for a single subscriber
+// of the live stream.  The entries, which don't fit into the buffer, are
+// dropped.
+const streamSubBufSize = 256
+
+// Names of the events of the live stream.
+const (
+	streamEventEntry    = "entry"
+	streamEventCounters = "counters"
+)
+
+// streamBucket is the data of the rolling counters for a single second.
+type streamBucket struct {
+	// sec is the Unix time of the second, to which the data belongs.
+	sec int64
+
+	queries    uint64
+	blocked    uint64
+	cached     uint64
+	elapsedSum time.Duration
+}
+
+// streamSub is a single subscriber of the live stream.
+type streamSub struct {
+	// entries receives the new entries.  It's never closed.
+	entries chan *logEntry
+
+	// dropped is the number of entries, which didn't fit into entries.  It's
+	// protected by [streamHub.mu].
+	dropped uint64
+}
+
+// streamHub distributes the new entries among the subscribers of the live
+// stream and maintains the rolling counters.
+type streamHub struct {
+	// mu protects subs, buckets, and the dropped fields of the subscribers.
+	mu *sync.Mutex
+
+	subs    map[*streamSub]struct{}
+	buckets [streamWindow]streamBucket
+}
+
+// newStreamHub returns a new properly initialized *streamHub.
+func newStreamHub() (h *streamHub) {
+	return &streamHub{
+		mu:   &sync.Mutex{},
+		subs: map[*streamSub]struct{}{},
+	}
+}
+
+// subscribe adds a new subscriber to the hub.  sub must be unsubscribed when
+// it's no longer used.
+func (h *streamHub) subscribe() (sub *streamSub) {
+	sub = &streamSub{
+		entries: make(chan *logEntry, streamSubBufSize),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// unsubscribe removes sub from the hub.
+func (h *streamHub) unsubscribe(sub *streamSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs, sub)
+}
+
+// publish adds e to the rolling counters and sends it to the subscribers
+// without blocking.  e must not be nil and must not be modified.
+func (h *streamHub) publish(e *logEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sec := e.Time.Unix()
+	b := &h.buckets[sec%streamWindow]
+	if b.sec != sec {
+		*b = streamBucket{sec: sec}
+	}
+
+	b.queries++
+	b.elapsedSum += e.Elapsed
+	if e.isBlocked() {
+		b.blocked++
+	}
+
+	if e.Cached {
+		b.cached++
+	}
+
+	for sub := range h.subs {
+		select {
+		case sub.entries <- e:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// streamCounters are the rolling counters of the live stream.
+type streamCounters struct {
+	// NumQueries is the number of the logged queries within the window.
+	NumQueries uint64 `json:"num_queries"`
+
+	// NumBlocked is the number of the blocked queries within the window.
+	NumBlocked uint64 `json:"num_blocked"`
+
+	// NumCached is the number of the queries answered from the cache within
+	// the window.
+	NumCached uint64 `json:"num_cached"`
+
+	// NumDropped is the number of the entries, which haven't been sent to the
+	// subscriber since it has been too slow to receive them.
+	NumDropped uint64 `json:"num_dropped"`
+
+	// AvgProcessingTime is the average processing time of the queries within
+	// the window in seconds.
+	AvgProcessingTime float64 `json:"avg_processing_time"`
+
+	// Window is the duration of the window in seconds.
+	Window uint32 `json:"window"`
+}
+
+// counters returns the rolling counters for the window ending at now as well
+// as the number of entries dropped for sub.
+func (h *streamHub) counters(now time.Time, sub *streamSub) (c *streamCounters) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c = &streamCounters{
+		NumDropped: sub.dropped,
+		Window:     streamWindow,
+	}
+
+	nowSec := now.Unix()
+	var elapsedSum time.Duration
+	for _, b := range h.buckets {
+		if b.sec <= nowSec-streamWindow || b.sec > nowSec {
+			continue
+		}
+
+		c.NumQueries += b.queries
+		c.NumBlocked += b.blocked
+		c.NumCached += b.cached
+		elapsedSum += b.elapsedSum
+	}
+
+	if c.NumQueries > 0 {
+		c.AvgProcessingTime = elapsedSum.Seconds() / float64(c.NumQueries)
+	}
+
+	return c
+}
+
+// handleQueryLogStream is the handler for the GET /control/querylog/stream
+// HTTP API.  It streams the new log entries matching the search parameters
+// and the rolling counters as server-sent events until the client disconnects.
+func (l *queryLog) handleQueryLogStream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params, err := l.parseStreamParams(ctx, r)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l.logger, r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	// The stream is long-lived, so disable the write timeout of the server.
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		l.logger.DebugContext(ctx, "resetting write deadline", slogutil.KeyError, err)
+	}
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, "text/event-stream")
+	h.Set(httphdr.CacheControl, "no-cache")
+	h.Set(httphdr.Server, aghhttp.UserAgent())
+
+	w.WriteHeader(http.StatusOK)
+
+	err = rc.Flush()
+	if err != nil {
+		l.logger.ErrorContext(ctx, "flushing stream", slogutil.KeyError, err)
+
+		return
+	}
+
+	sub := l.stream.subscribe()
+	defer l.stream.unsubscribe(sub)
+
+	err = l.serveStream(ctx, sub, params, func(event string, data any) (sendErr error) {
+		sendErr = writeStreamEvent(w, event, data)
+		if sendErr != nil {
+			return sendErr
+		}
+
+		return rc.Flush()
+	})
+	if err != nil {
+		l.logger.DebugContext(ctx, "streaming query log", slogutil.KeyError, err)
+	}
+}
+
+// parseStreamParams parses the search parameters of the live stream from the
+// HTTP request's query string.  In addition to the parameters of the search, it
+// supports the "client" parameter, which is matched exactly against the
+// client's IP address, ClientID, or name.
+func (l *queryLog) parseStreamParams(
+	ctx context.Context,
+	r *http.Request,
+) (params *searchParams, err error) {
+	params, err = l.parseSearchParams(ctx, r)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	// Only the new entries are streamed.
+	params.olderThan = time.Time{}
+
+	if c := r.URL.Query().Get("client"); c != "" {
+		params.searchCriteria = append(params.searchCriteria, searchCriterion{
+			criterionType: ctClient,
+			value:         c,
+		})
+	}
+
+	return params, nil
+}
+
+// streamSendFunc sends a single event of the live stream with data encoded as
+// JSON to the subscriber.
+type streamSendFunc func(event string, data any) (err error)
+
+// serveStream sends the entries received by sub and matching params as well as
+// the rolling counters with send until ctx is canceled.  All arguments must
+// not be nil.
+func (l *queryLog) serveStream(
+	ctx context.Context,
+	sub *streamSub,
+	params *searchParams,
+	send streamSendFunc,
+) (err error) {
+	ticker := time.NewTicker(streamCountersIvl)
+	defer ticker.Stop()
+
+	for {
+		var event string
+		var data any
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-sub.entries:
+			obj := l.streamEntry(ctx, e, params, l.anonymizer.Load())
+			if obj == nil {
+				continue
+			}
+
+			event, data = streamEventEntry, obj
+		case now := <-ticker.C:
+			event, data = streamEventCounters, l.stream.counters(now, sub)
+		}
+
+		err = send(event, data)
+		if err != nil {
+			return fmt.Errorf("sending %s event: %w", event, err)
+		}
+	}
+}
+
+// streamEntry returns the JSON object of the entry for the live stream or nil
+// if the entry doesn't match params.  entry must not be nil.
+func (l *queryLog) streamEntry(
+	ctx context.Context,
+	entry *logEntry,
+	params *searchParams,
+	anonFunc aghnet.IPMutFunc,
+) (obj jobject) {
+	// A shallow clone is enough, since only the client field is modified.
+	e := entry.shallowClone()
+
+	var err error
+	e.client, err = l.client(e.ClientID, e.IP.String(), clientCache{})
+	if err != nil {
+		l.logger.ErrorContext(
+			ctx,
+			"enriching stream record",
+			"client_ip", e.IP,
+			"client_id", e.ClientID,
+			slogutil.KeyError, err,
+		)
+
+		// Go on and try to match anyway.
+	}
+
+	if !params.match(e) {
+		return nil
+	}
+
+	return l.entryToJSON(ctx, e, anonFunc)
+}
+
+// writeStreamEvent writes a single server-sent event with data encoded as JSON
+// to w.
+func writeStreamEvent(w io.Writer, event string, data any) (err error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding: %w", err)
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+
+	return err
+}
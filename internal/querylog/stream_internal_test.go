@@ -0,0 +1,199 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamHub(t *testing.T) {
+	h := newStreamHub()
+	sub := h.subscribe()
+
+	now := time.Unix(1_000_000, 0)
+	blocked := filtering.Result{
+		Reason:     filtering.FilteredBlockList,
+		IsFiltered: true,
+	}
+
+	h.publish(&logEntry{Time: now.Add(-2 * streamWindow * time.Second)})
+	h.publish(&logEntry{Time: now.Add(-time.Second), Elapsed: 10 * time.Millisecond})
+	h.publish(&logEntry{Time: now, Result: blocked, Elapsed: 20 * time.Millisecond})
+	h.publish(&logEntry{Time: now, Cached: true, Elapsed: 30 * time.Millisecond})
+
+	require.Len(t, sub.entries, 4)
+
+	c := h.counters(now, sub)
+	assert.Equal(t, uint64(3), c.NumQueries)
+	assert.Equal(t, uint64(1), c.NumBlocked)
+	assert.Equal(t, uint64(1), c.NumCached)
+	assert.Equal(t, uint64(0), c.NumDropped)
+	assert.InDelta(t, 0.02, c.AvgProcessingTime, 1e-9)
+
+	for range streamSubBufSize {
+		h.publish(&logEntry{Time: now})
+	}
+
+	c = h.counters(now, sub)
+	assert.Equal(t, uint64(4), c.NumDropped)
+
+	h.unsubscribe(sub)
+	assert.Empty(t, h.subs)
+}
+
+func TestQueryLog_HandleQueryLogStream(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Logger:      slogutil.NewDiscardLogger(),
+		Anonymizer:  aghnet.NewIPMut(nil),
+		Enabled:     true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(l.handleQueryLogStream))
+	t.Cleanup(srv.Close)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		srv.URL+"/control/querylog/stream?search=example.org",
+		nil,
+	)
+	require.NoError(t, err)
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, resp.Body.Close)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get(httphdr.ContentType))
+
+	// Make sure the handler has subscribed before adding the entries.
+	require.Eventually(t, func() (ok bool) {
+		l.stream.mu.Lock()
+		defer l.stream.mu.Unlock()
+
+		return len(l.stream.subs) == 1
+	}, testTimeout, testTimeout/10)
+
+	addEntry(l, "other.example.com", net.IPv4(192, 0, 2, 1), net.IPv4(203, 0, 113, 1))
+	addEntry(l, "live.example.org", net.IPv4(192, 0, 2, 2), net.IPv4(203, 0, 113, 2))
+
+	var event string
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		line := s.Text()
+		if ev, ok := strings.CutPrefix(line, "event: "); ok {
+			event = ev
+
+			continue
+		}
+
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || event != streamEventEntry {
+			continue
+		}
+
+		var e struct {
+			Question struct {
+				Name string `json:"name"`
+			} `json:"question"`
+		}
+
+		require.NoError(t, json.Unmarshal([]byte(data), &e))
+
+		assert.Equal(t, "live.example.org", e.Question.Name)
+
+		return
+	}
+
+	t.Fatalf("no entry event: %v", s.Err())
+}
+
+func TestQueryLog_HandleQueryLogWebSocket(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Logger:      slogutil.NewDiscardLogger(),
+		Anonymizer:  aghnet.NewIPMut(nil),
+		Enabled:     true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(l.handleQueryLogWebSocket))
+	t.Cleanup(srv.Close)
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") +
+		"/control/querylog/ws?client=203.0.113.2&domain=example"
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u, nil)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, conn.Close)
+	testutil.CleanupAndRequireSuccess(t, resp.Body.Close)
+
+	// Make sure the handler has subscribed before adding the entries.
+	require.Eventually(t, func() (ok bool) {
+		l.stream.mu.Lock()
+		defer l.stream.mu.Unlock()
+
+		return len(l.stream.subs) == 1
+	}, testTimeout, testTimeout/10)
+
+	addEntry(l, "first.example.com", net.IPv4(192, 0, 2, 1), net.IPv4(203, 0, 113, 1))
+	addEntry(l, "second.example.org", net.IPv4(192, 0, 2, 2), net.IPv4(203, 0, 113, 2))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(testTimeout)))
+
+	for {
+		var msg struct {
+			Data struct {
+				Question struct {
+					Name string `json:"name"`
+				} `json:"question"`
+			} `json:"data"`
+			Type string `json:"type"`
+		}
+
+		require.NoError(t, conn.ReadJSON(&msg))
+		if msg.Type != streamEventEntry {
+			continue
+		}
+
+		assert.Equal(t, "second.example.org", msg.Data.Question.Name)
+
+		break
+	}
+
+	require.NoError(t, conn.WriteMessage(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+	))
+
+	// Make sure the handler unsubscribes after the client disconnects.
+	require.Eventually(t, func() (ok bool) {
+		l.stream.mu.Lock()
+		defer l.stream.mu.Unlock()
+
+		return len(l.stream.subs) == 0
+	}, testTimeout, testTimeout/10)
+}
@@ -0,0 +1,115 @@
+package querylog
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/gorilla/websocket"
+)
+
+// wsWriteTimeout is the timeout of writing a single message to a WebSocket
+// subscriber of the live stream.
+const wsWriteTimeout = 10 * time.Second
+
+// wsReadLimit is the maximum size of a message from a WebSocket subscriber of
+// the live stream.  The subscribers aren't expected to send anything but the
+// control messages.
+const wsReadLimit = 512
+
+// wsMessage is a message of the live stream sent over a WebSocket connection.
+type wsMessage struct {
+	// Data is the entry or the rolling counters depending on Type.
+	Data any `json:"data"`
+
+	// Type is the name of the event, either [streamEventEntry] or
+	// [streamEventCounters].
+	Type string `json:"type"`
+}
+
+// handleQueryLogWebSocket is the handler for the GET /control/querylog/ws HTTP
+// API.  It streams the new log entries matching the search parameters and the
+// rolling counters as JSON messages over a WebSocket connection until the
+// client disconnects.
+func (l *queryLog) handleQueryLogWebSocket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params, err := l.parseStreamParams(ctx, r)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l.logger, r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	// The zero value of the upgrader only accepts the requests from the same
+	// origin, which prevents the cross-site WebSocket hijacking.
+	upgrader := &websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, http.Header{
+		httphdr.Server: {aghhttp.UserAgent()},
+	})
+	if err != nil {
+		// The upgrader has already responded with an HTTP error.
+		l.logger.DebugContext(ctx, "upgrading to websocket", slogutil.KeyError, err)
+
+		return
+	}
+	defer func() {
+		err = errors.WithDeferred(err, conn.Close())
+		if err != nil {
+			l.logger.DebugContext(ctx, "streaming query log over websocket", slogutil.KeyError, err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The connection has been hijacked, so reset the deadlines of the server
+	// and detect the disconnection of the client by reading.
+	err = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return
+	}
+
+	conn.SetReadLimit(wsReadLimit)
+
+	go l.readWebSocket(ctx, conn, cancel)
+
+	sub := l.stream.subscribe()
+	defer l.stream.unsubscribe(sub)
+
+	err = l.serveStream(ctx, sub, params, func(event string, data any) (sendErr error) {
+		sendErr = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if sendErr != nil {
+			return sendErr
+		}
+
+		return conn.WriteJSON(&wsMessage{
+			Data: data,
+			Type: event,
+		})
+	})
+}
+
+// readWebSocket reads and discards the messages from conn, which makes the
+// control messages processed, until an error occurs, and then calls cancel.
+// It is intended to be used as a goroutine.
+func (l *queryLog) readWebSocket(
+	ctx context.Context,
+	conn *websocket.Conn,
+	cancel context.CancelFunc,
+) {
+	defer slogutil.RecoverAndLog(ctx, l.logger)
+	defer cancel()
+
+	for {
+		_, _, err := conn.NextReader()
+		if err != nil {
+			l.logger.DebugContext(ctx, "websocket closed", slogutil.KeyError, err)
+
+			return
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// ubusNullSession is the ID of the unauthenticated ubus session, which is used
+// to log in.
+const ubusNullSession = "00000000000000000000000000000000"
+
+// openWrt is the [fetcher] for the ubus JSON-RPC API of OpenWrt.  The user must
+// have the access to the "luci-rpc" ubus object, for example with the default
+// "root" user.
+type openWrt struct {
+	httpClient *http.Client
+	url        string
+	username   string
+	password   string
+}
+
+// newOpenWrt returns a new *openWrt.  c must not be nil.
+func newOpenWrt(c *Config) (f *openWrt) {
+	return &openWrt{
+		httpClient: c.HTTPClient,
+		url:        c.URL.JoinPath("ubus").String(),
+		username:   c.Username,
+		password:   c.Password,
+	}
+}
+
+// type check
+var _ fetcher = (*openWrt)(nil)
+
+// ubusDHCPLeases is the result of the "getDHCPLeases" method of the "luci-rpc"
+// ubus object.
+type ubusDHCPLeases struct {
+	DHCPLeases []*ubusDHCPLease `json:"dhcp_leases"`
+
+	DHCP6Leases []*ubusDHCPLease `json:"dhcp6_leases"`
+}
+
+// ubusDHCPLease is a DHCP lease of OpenWrt.
+type ubusDHCPLease struct {
+	Hostname string `json:"hostname"`
+
+	// IPAddr is the IPv4 address of the DHCP lease.
+	IPAddr string `json:"ipaddr"`
+
+	// IP6Addr is the IPv6 address of the DHCPv6 lease.
+	IP6Addr string `json:"ip6addr"`
+
+	MACAddr string `json:"macaddr"`
+}
+
+// ubusHostHint is a host known to OpenWrt from its DHCP leases, network
+// neighborhood, and configuration.
+type ubusHostHint struct {
+	Name string `json:"name"`
+
+	IPAddrs []string `json:"ipaddrs"`
+
+	IP6Addrs []string `json:"ip6addrs"`
+}
+
+// fetch implements the [fetcher] interface for *openWrt.  The clients from the
+// DHCP leases precede the ones from the host hints, so their names take
+// precedence.
+func (f *openWrt) fetch(ctx context.Context) (cs []Client, err error) {
+	sess, err := f.login(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("logging in: %w", err)
+	}
+
+	leases := &ubusDHCPLeases{}
+	err = f.call(ctx, sess, "luci-rpc", "getDHCPLeases", leases)
+	if err != nil {
+		return nil, fmt.Errorf("getting dhcp leases: %w", err)
+	}
+
+	for _, l := range leases.DHCPLeases {
+		cs = append(cs, parseClient(l.IPAddr, l.MACAddr, l.Hostname))
+	}
+
+	for _, l := range leases.DHCP6Leases {
+		cs = append(cs, parseClient(l.IP6Addr, l.MACAddr, l.Hostname))
+	}
+
+	hints := map[string]*ubusHostHint{}
+	err = f.call(ctx, sess, "luci-rpc", "getHostHints", &hints)
+	if err != nil {
+		return nil, fmt.Errorf("getting host hints: %w", err)
+	}
+
+	for mac, h := range hints {
+		for _, ip := range slices.Concat(h.IPAddrs, h.IP6Addrs) {
+			cs = append(cs, parseClient(ip, mac, h.Name))
+		}
+	}
+
+	return cs, nil
+}
+
+// ubusSession is the result of the "login" method of the "session" ubus
+// object.
+type ubusSession struct {
+	ID string `json:"ubus_rpc_session"`
+}
+
+// login returns the ID of a new ubus session.
+func (f *openWrt) login(ctx context.Context) (sess string, err error) {
+	args := map[string]string{
+		"username": f.username,
+		"password": f.password,
+	}
+
+	s := &ubusSession{}
+	err = f.do(ctx, []any{ubusNullSession, "session", "login", args}, s)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return "", err
+	} else if s.ID == "" {
+		return "", fmt.Errorf("session: %w", errors.ErrEmptyValue)
+	}
+
+	return s.ID, nil
+}
+
+// call calls the method of the ubus object obj without arguments within the
+// session sess and decodes the result into res.
+func (f *openWrt) call(ctx context.Context, sess, obj, method string, res any) (err error) {
+	return f.do(ctx, []any{sess, obj, method, struct{}{}}, res)
+}
+
+// ubusRequest is a JSON-RPC request of the ubus API.
+type ubusRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+	ID      int    `json:"id"`
+}
+
+// ubusResponse is a JSON-RPC response of the ubus API.  Result contains the
+// ubus status code followed by the data, if any.
+type ubusResponse struct {
+	Error *ubusError `json:"error"`
+
+	Result []json.RawMessage `json:"result"`
+}
+
+// ubusError is a JSON-RPC error of the ubus API.
+type ubusError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// do sends the "call" JSON-RPC request with params and decodes the data of the
+// result into res.
+func (f *openWrt) do(ctx context.Context, params []any, res any) (err error) {
+	req := &ubusRequest{
+		JSONRPC: "2.0",
+		Method:  "call",
+		Params:  params,
+		ID:      1,
+	}
+
+	resp := &ubusResponse{}
+	err = doJSON(ctx, f.httpClient, http.MethodPost, f.url, req, resp)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	if resp.Error != nil {
+		return fmt.Errorf("rpc error %d: %s", resp.Error.Code, resp.Error.Message)
+	} else if len(resp.Result) == 0 {
+		return fmt.Errorf("result: %w", errors.ErrNoValue)
+	}
+
+	var code int
+	err = json.Unmarshal(resp.Result[0], &code)
+	if err != nil {
+		return fmt.Errorf("decoding status code: %w", err)
+	} else if code != 0 {
+		// See the ubus_msg_status enumeration in libubus.
+		return fmt.Errorf("ubus status code %d", code)
+	} else if len(resp.Result) < 2 {
+		return fmt.Errorf("result data: %w", errors.ErrNoValue)
+	}
+
+	err = json.Unmarshal(resp.Result[1], res)
+	if err != nil {
+		return fmt.Errorf("decoding result data: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,270 @@
+// Package router implements the retrieval of the clients known to the upstream
+// router, such as its DHCP leases and wireless clients, when AdGuard Home isn't
+// the DHCP server of the network.
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/service"
+)
+
+// maxRespSize is the maximum size of a response of the API of a router.
+const maxRespSize = 8 * 1024 * 1024
+
+// Interface retrieves the clients known to a router.
+type Interface interface {
+	// Refresher requests the clients from the router and updates the stored
+	// data.  It must be safe for concurrent use.
+	service.Refresher
+
+	// Clients returns the last set of the clients of the router.  Both the
+	// method and it's result must be safe for concurrent use.
+	Clients() (cs []Client)
+}
+
+// Empty is the [Interface] implementation that does nothing.
+type Empty struct{}
+
+// type check
+var _ Interface = Empty{}
+
+// Refresh implements the [Interface] interface for Empty.  It does nothing and
+// always returns nil error.
+func (Empty) Refresh(_ context.Context) (err error) { return nil }
+
+// Clients implements the [Interface] interface for Empty.  It always returns
+// nil.
+func (Empty) Clients() (cs []Client) { return nil }
+
+// Client is a client known to a router.
+type Client struct {
+	// MAC is the hardware address of the client, if any.
+	MAC net.HardwareAddr
+
+	// IP is the address of the client.
+	IP netip.Addr
+
+	// Name is the hostname of the client, if any.
+	Name string
+}
+
+// Type is the type of the API of a router.
+type Type string
+
+// Supported router types.
+const (
+	// TypeOpenWrt is the ubus JSON-RPC API of OpenWrt with LuCI.
+	TypeOpenWrt Type = "openwrt"
+
+	// TypeUniFi is the API of the UniFi Network controller.
+	TypeUniFi Type = "unifi"
+
+	// TypeUniFiOS is the API of the UniFi Network application on a UniFi OS
+	// console, such as UniFi Dream Machine.
+	TypeUniFiOS Type = "unifi_os"
+)
+
+// Config is the configuration of a [Router].
+type Config struct {
+	// Logger is used for logging the retrieval.  It must not be nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used to request the API of the router.  It must not be
+	// nil.
+	HTTPClient *http.Client
+
+	// URL is the base URL of the API of the router, for example
+	// "http://192.168.1.1".  It must not be nil.
+	URL *url.URL
+
+	// Type is the type of the API of the router.
+	Type Type
+
+	// Username is the name of the user of the API.
+	Username string
+
+	// Password is the password of the user of the API.
+	Password string
+
+	// Site is the name of the UniFi site.  It's only used with [TypeUniFi] and
+	// [TypeUniFiOS].  If empty, "default" is used.
+	Site string
+}
+
+// fetcher requests the clients from the API of a router.
+type fetcher interface {
+	// fetch returns the clients known to the router.
+	fetch(ctx context.Context) (cs []Client, err error)
+}
+
+// Router is the [Interface] implementation, which requests the clients from the
+// API of a router.
+type Router struct {
+	logger  *slog.Logger
+	fetcher fetcher
+
+	// mu protects clients.
+	mu      *sync.Mutex
+	clients []Client
+}
+
+// type check
+var _ Interface = (*Router)(nil)
+
+// New returns a new properly initialized *Router.  c must not be nil.
+func New(c *Config) (r *Router, err error) {
+	var f fetcher
+	switch c.Type {
+	case TypeOpenWrt:
+		f = newOpenWrt(c)
+	case TypeUniFi, TypeUniFiOS:
+		f, err = newUniFi(c)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf(
+			"type: %w: %q, should be one of %q",
+			errors.ErrBadEnumValue,
+			c.Type,
+			[]Type{TypeOpenWrt, TypeUniFi, TypeUniFiOS},
+		)
+	}
+
+	return &Router{
+		logger:  c.Logger,
+		fetcher: f,
+		mu:      &sync.Mutex{},
+	}, nil
+}
+
+// Refresh implements the [Interface] interface for *Router.  The stored
+// clients are kept if err is not nil.
+func (r *Router) Refresh(ctx context.Context) (err error) {
+	cs, err := r.fetcher.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching clients: %w", err)
+	}
+
+	cs = compact(cs)
+
+	r.logger.DebugContext(ctx, "fetched router clients", "count", len(cs))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clients = cs
+
+	return nil
+}
+
+// Clients implements the [Interface] interface for *Router.
+func (r *Router) Clients() (cs []Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.clients)
+}
+
+// compact sorts cs by the IP addresses and merges the clients with the same IP
+// address, so that the first known name and hardware address are used.  The
+// clients with invalid IP addresses are removed.
+func compact(cs []Client) (res []Client) {
+	cs = slices.DeleteFunc(cs, func(c Client) (ok bool) { return !c.IP.IsValid() })
+	slices.SortStableFunc(cs, func(a, b Client) (n int) { return a.IP.Compare(b.IP) })
+
+	for _, c := range cs {
+		if i := len(res) - 1; i >= 0 && res[i].IP == c.IP {
+			prev := &res[i]
+			if prev.Name == "" {
+				prev.Name = c.Name
+			}
+
+			if prev.MAC == nil {
+				prev.MAC = c.MAC
+			}
+
+			continue
+		}
+
+		res = append(res, c)
+	}
+
+	return res
+}
+
+// doJSON sends the request with the JSON-encoded reqBody, if not nil, to u and
+// decodes the JSON response into respBody.
+func doJSON(
+	ctx context.Context,
+	hc *http.Client,
+	method string,
+	u string,
+	reqBody any,
+	respBody any,
+) (err error) {
+	var body io.Reader
+	if reqBody != nil {
+		var b []byte
+		b, err = json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("making request: %w", err)
+	}
+
+	req.Header.Set(httphdr.Accept, "application/json")
+	if body != nil {
+		req.Header.Set(httphdr.ContentType, "application/json")
+	}
+
+	// #nosec G704 -- Trust the URL explicitly given by the user.
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	err = json.NewDecoder(ioutil.LimitReader(resp.Body, maxRespSize)).Decode(respBody)
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	return nil
+}
+
+// parseClient returns the client with the IP address ip, the hardware address
+// mac, and the name.  The invalid addresses are ignored.
+func parseClient(ip, mac, name string) (c Client) {
+	c.IP, _ = netip.ParseAddr(ip)
+	c.MAC, _ = net.ParseMAC(mac)
+	c.Name = name
+
+	return c
+}
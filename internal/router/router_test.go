@@ -0,0 +1,167 @@
+package router_test
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/router"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// Common test values.
+const (
+	testUsername = "user"
+	testPassword = "pass"
+	testSession  = "0123456789abcdef0123456789abcdef"
+)
+
+// newTestRouter returns a new *router.Router of the type typ for the API
+// served by h.
+func newTestRouter(t *testing.T, typ router.Type, h http.Handler) (r *router.Router) {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	r, err = router.New(&router.Config{
+		Logger:     slogutil.NewDiscardLogger(),
+		HTTPClient: srv.Client(),
+		URL:        u,
+		Type:       typ,
+		Username:   testUsername,
+		Password:   testPassword,
+	})
+	require.NoError(t, err)
+
+	return r
+}
+
+func TestRouter_Refresh_openWrt(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ubus", r.URL.Path)
+
+		req := &struct {
+			Params []json.RawMessage `json:"params"`
+		}{}
+		err := json.NewDecoder(r.Body).Decode(req)
+		require.NoError(t, err)
+		require.Len(t, req.Params, 4)
+
+		var sess, obj, method string
+		require.NoError(t, json.Unmarshal(req.Params[0], &sess))
+		require.NoError(t, json.Unmarshal(req.Params[1], &obj))
+		require.NoError(t, json.Unmarshal(req.Params[2], &method))
+
+		var res string
+		switch {
+		case obj == "session" && method == "login":
+			res = `[0,{"ubus_rpc_session":"` + testSession + `"}]`
+		case sess != testSession:
+			res = `[6]`
+		case method == "getDHCPLeases":
+			res = `[0,{"dhcp_leases":[{"hostname":"laptop","ipaddr":"192.168.1.10",` +
+				`"macaddr":"aa:bb:cc:00:00:01"}],"dhcp6_leases":[]}]`
+		case method == "getHostHints":
+			res = `[0,{"aa:bb:cc:00:00:01":{"name":"other","ipaddrs":["192.168.1.10"]},` +
+				`"aa:bb:cc:00:00:02":{"ipaddrs":["192.168.1.20"],"ip6addrs":["fd00::20"]}}]`
+		default:
+			res = `[3]`
+		}
+
+		_, _ = io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":`+res+`}`)
+	})
+
+	r := newTestRouter(t, router.TypeOpenWrt, h)
+
+	err := r.Refresh(testutil.ContextWithTimeout(t, testTimeout))
+	require.NoError(t, err)
+
+	assert.Equal(t, []router.Client{{
+		MAC:  net.HardwareAddr{0xAA, 0xBB, 0xCC, 0x00, 0x00, 0x01},
+		IP:   netip.MustParseAddr("192.168.1.10"),
+		Name: "laptop",
+	}, {
+		MAC:  net.HardwareAddr{0xAA, 0xBB, 0xCC, 0x00, 0x00, 0x02},
+		IP:   netip.MustParseAddr("192.168.1.20"),
+		Name: "",
+	}, {
+		MAC:  net.HardwareAddr{0xAA, 0xBB, 0xCC, 0x00, 0x00, 0x02},
+		IP:   netip.MustParseAddr("fd00::20"),
+		Name: "",
+	}}, r.Clients())
+}
+
+func TestRouter_Refresh_uniFi(t *testing.T) {
+	const cookieName = "unifises"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
+		creds := map[string]string{}
+		err := json.NewDecoder(r.Body).Decode(&creds)
+		require.NoError(t, err)
+
+		if creds["username"] != testUsername || creds["password"] != testPassword {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: cookieName, Value: testSession, Path: "/"})
+		_, _ = io.WriteString(w, `{"meta":{"rc":"ok"},"data":[]}`)
+	})
+	mux.HandleFunc("GET /api/s/default/stat/sta", func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(cookieName)
+		if err != nil || c.Value != testSession {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		_, _ = io.WriteString(w, `{"meta":{"rc":"ok"},"data":[`+
+			`{"mac":"aa:bb:cc:00:00:02","ip":"192.168.1.20","hostname":"phone","name":"Alice's phone"},`+
+			`{"mac":"aa:bb:cc:00:00:01","ip":"192.168.1.10","hostname":"laptop"},`+
+			`{"mac":"aa:bb:cc:00:00:03"}]}`)
+	})
+
+	r := newTestRouter(t, router.TypeUniFi, mux)
+
+	err := r.Refresh(testutil.ContextWithTimeout(t, testTimeout))
+	require.NoError(t, err)
+
+	assert.Equal(t, []router.Client{{
+		MAC:  net.HardwareAddr{0xAA, 0xBB, 0xCC, 0x00, 0x00, 0x01},
+		IP:   netip.MustParseAddr("192.168.1.10"),
+		Name: "laptop",
+	}, {
+		MAC:  net.HardwareAddr{0xAA, 0xBB, 0xCC, 0x00, 0x00, 0x02},
+		IP:   netip.MustParseAddr("192.168.1.20"),
+		Name: "Alice's phone",
+	}}, r.Clients())
+}
+
+func TestNew_badType(t *testing.T) {
+	_, err := router.New(&router.Config{
+		Type: "snmp",
+	})
+	testutil.AssertErrorMsg(
+		t,
+		`type: bad enum value: "snmp", should be one of ["openwrt" "unifi" "unifi_os"]`,
+		err,
+	)
+}
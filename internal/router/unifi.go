@@ -0,0 +1,109 @@
+package router
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// defaultUniFiSite is the name of the default UniFi site.
+const defaultUniFiSite = "default"
+
+// uniFi is the [fetcher] for the API of the UniFi Network controller or
+// application.  A read-only local account is enough.
+type uniFi struct {
+	httpClient *http.Client
+	loginURL   string
+	staURL     string
+	username   string
+	password   string
+}
+
+// newUniFi returns a new *uniFi, which uses a copy of c.HTTPClient with its own
+// cookie jar to keep the session.  c must not be nil.
+func newUniFi(c *Config) (f *uniFi, err error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating cookie jar: %w", err)
+	}
+
+	hc := *c.HTTPClient
+	hc.Jar = jar
+
+	loginPath, apiURL := "/api/login", c.URL
+	if c.Type == TypeUniFiOS {
+		loginPath, apiURL = "/api/auth/login", c.URL.JoinPath("proxy", "network")
+	}
+
+	site := cmp.Or(c.Site, defaultUniFiSite)
+
+	return &uniFi{
+		httpClient: &hc,
+		loginURL:   c.URL.JoinPath(loginPath).String(),
+		staURL:     apiURL.JoinPath("api", "s", site, "stat", "sta").String(),
+		username:   c.Username,
+		password:   c.Password,
+	}, nil
+}
+
+// type check
+var _ fetcher = (*uniFi)(nil)
+
+// uniFiStations is the response of the "stat/sta" UniFi API.
+type uniFiStations struct {
+	Meta *uniFiMeta `json:"meta"`
+
+	Data []*uniFiStation `json:"data"`
+}
+
+// uniFiMeta is the metadata of a response of the UniFi API.
+type uniFiMeta struct {
+	// RC is the result code, "ok" or "error".
+	RC string `json:"rc"`
+
+	Msg string `json:"msg"`
+}
+
+// uniFiStation is a connected client of the UniFi network, either wired or
+// wireless.
+type uniFiStation struct {
+	// Name is the alias of the client given by the administrator, if any.
+	Name string `json:"name"`
+
+	Hostname string `json:"hostname"`
+
+	IP string `json:"ip"`
+
+	MAC string `json:"mac"`
+}
+
+// fetch implements the [fetcher] interface for *uniFi.  The aliases of the
+// clients take precedence over their hostnames.
+func (f *uniFi) fetch(ctx context.Context) (cs []Client, err error) {
+	creds := map[string]string{
+		"username": f.username,
+		"password": f.password,
+	}
+
+	err = doJSON(ctx, f.httpClient, http.MethodPost, f.loginURL, creds, &json.RawMessage{})
+	if err != nil {
+		return nil, fmt.Errorf("logging in: %w", err)
+	}
+
+	stas := &uniFiStations{}
+	err = doJSON(ctx, f.httpClient, http.MethodGet, f.staURL, nil, stas)
+	if err != nil {
+		return nil, fmt.Errorf("getting clients: %w", err)
+	} else if stas.Meta != nil && stas.Meta.RC != "ok" {
+		return nil, fmt.Errorf("getting clients: result code %q: %s", stas.Meta.RC, stas.Meta.Msg)
+	}
+
+	for _, s := range stas.Data {
+		cs = append(cs, parseClient(s.IP, s.MAC, cmp.Or(s.Name, s.Hostname)))
+	}
+
+	return cs, nil
+}
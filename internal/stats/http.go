@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -38,6 +39,9 @@ type StatsResp struct {
 	TopClients []topAddrs `json:"top_clients"`
 	TopBlocked []topAddrs `json:"top_blocked_domains"`
 
+	TopBlockedServices   []topAddrs `json:"top_blocked_services"`
+	TopBlockedCategories []topAddrs `json:"top_blocked_categories"`
+
 	TopUpstreamsResponses []topAddrs      `json:"top_upstreams_responses"`
 	TopUpstreamsAvgTime   []topAddrsFloat `json:"top_upstreams_avg_time"`
 
@@ -47,17 +51,80 @@ type StatsResp struct {
 	ReplacedSafebrowsing []uint64 `json:"replaced_safebrowsing"`
 	ReplacedParental     []uint64 `json:"replaced_parental"`
 
+	CacheHits   []uint64 `json:"cache_hits"`
+	CacheMisses []uint64 `json:"cache_misses"`
+	StaleHits   []uint64 `json:"stale_hits"`
+
 	NumDNSQueries           uint64 `json:"num_dns_queries"`
 	NumBlockedFiltering     uint64 `json:"num_blocked_filtering"`
 	NumReplacedSafebrowsing uint64 `json:"num_replaced_safebrowsing"`
 	NumReplacedSafesearch   uint64 `json:"num_replaced_safesearch"`
 	NumReplacedParental     uint64 `json:"num_replaced_parental"`
+	NumCacheHits            uint64 `json:"num_cache_hits"`
+	NumCacheMisses          uint64 `json:"num_cache_misses"`
+	NumStaleHits            uint64 `json:"num_stale_hits"`
 
 	AvgProcessingTime float64 `json:"avg_processing_time"`
 }
 
 // handleStats is the handler for the GET /control/stats HTTP API.
 func (s *StatsCtx) handleStats(w http.ResponseWriter, r *http.Request) {
+	resp, ok := s.dataForRequest(w, r)
+	if ok {
+		aghhttp.WriteJSONResponseOK(r.Context(), s.logger, w, r, resp)
+	}
+}
+
+// publicStatsResp is a response to the GET /control/stats/public.  It only
+// contains the aggregate numbers and must never contain any domain names,
+// client addresses, or upstreams.
+type publicStatsResp struct {
+	TimeUnits string `json:"time_units"`
+
+	DNSQueries []uint64 `json:"dns_queries"`
+
+	BlockedFiltering     []uint64 `json:"blocked_filtering"`
+	ReplacedSafebrowsing []uint64 `json:"replaced_safebrowsing"`
+	ReplacedParental     []uint64 `json:"replaced_parental"`
+
+	NumDNSQueries           uint64 `json:"num_dns_queries"`
+	NumBlockedFiltering     uint64 `json:"num_blocked_filtering"`
+	NumReplacedSafebrowsing uint64 `json:"num_replaced_safebrowsing"`
+	NumReplacedSafesearch   uint64 `json:"num_replaced_safesearch"`
+	NumReplacedParental     uint64 `json:"num_replaced_parental"`
+
+	AvgProcessingTime float64 `json:"avg_processing_time"`
+}
+
+// handleStatsPublic is the handler for the GET /control/stats/public HTTP API.
+// The access to it is controlled by the web module.
+func (s *StatsCtx) handleStatsPublic(w http.ResponseWriter, r *http.Request) {
+	resp, ok := s.dataForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(r.Context(), s.logger, w, r, &publicStatsResp{
+		TimeUnits:               resp.TimeUnits,
+		DNSQueries:              resp.DNSQueries,
+		BlockedFiltering:        resp.BlockedFiltering,
+		ReplacedSafebrowsing:    resp.ReplacedSafebrowsing,
+		ReplacedParental:        resp.ReplacedParental,
+		NumDNSQueries:           resp.NumDNSQueries,
+		NumBlockedFiltering:     resp.NumBlockedFiltering,
+		NumReplacedSafebrowsing: resp.NumReplacedSafebrowsing,
+		NumReplacedSafesearch:   resp.NumReplacedSafesearch,
+		NumReplacedParental:     resp.NumReplacedParental,
+		AvgProcessingTime:       resp.AvgProcessingTime,
+	})
+}
+
+// dataForRequest returns the statistics for the interval requested by r.  If
+// ok is false, the error has already been written to w.
+func (s *StatsCtx) dataForRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+) (resp *StatsResp, ok bool) {
 	start := time.Now()
 
 	ctx := r.Context()
@@ -77,10 +144,10 @@ func (s *StatsCtx) handleStats(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
 
-		return
+		return nil, false
 	}
 
-	resp, ok := s.getData(uint32(limit.Hours()))
+	resp, ok = s.getData(uint32(limit.Hours()))
 
 	l.DebugContext(ctx, "prepared data", "elapsed", time.Since(start))
 
@@ -90,12 +157,296 @@ func (s *StatsCtx) handleStats(w http.ResponseWriter, r *http.Request) {
 		const msg = "Couldn't get statistics data"
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, msg)
 
+		return nil, false
+	}
+
+	return resp, true
+}
+
+// queryKeyClient is the key of the query parameter that contains the client,
+// which statistics are requested.
+const queryKeyClient = "client"
+
+// clientsStatsResp is a response to the GET /control/stats/clients.
+type clientsStatsResp struct {
+	TimeUnits string `json:"time_units"`
+
+	// Clients are the statistics of the clients sorted by the number of
+	// requests in descending order.
+	Clients []*clientStats `json:"clients"`
+}
+
+// clientStats is the hourly statistics of a single client.  The elements of
+// the slices correspond to the hours of the requested interval, the oldest
+// first.
+type clientStats struct {
+	// Name is the client's primary ID.
+	Name string `json:"name"`
+
+	// DNSQueries is the number of requests.
+	DNSQueries []uint64 `json:"dns_queries"`
+
+	// Blocked is the number of filtered requests.
+	Blocked []uint64 `json:"blocked"`
+
+	// AvgProcessingTime is the average processing time of the requests in
+	// seconds.
+	AvgProcessingTime []float64 `json:"avg_processing_time"`
+
+	// NumDNSQueries is the total number of requests.
+	NumDNSQueries uint64 `json:"num_dns_queries"`
+
+	// NumBlocked is the total number of filtered requests.
+	NumBlocked uint64 `json:"num_blocked"`
+}
+
+// handleStatsClients is the handler for the GET /control/stats/clients HTTP
+// API.
+func (s *StatsCtx) handleStatsClients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := s.logger
+
+	var limit time.Duration
+	func() {
+		s.confMu.RLock()
+		defer s.confMu.RUnlock()
+
+		limit = s.limit
+	}()
+
+	q := r.URL.Query()
+	limit, err := parseRecent(q.Get(queryKeyRecent), limit)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	hours := uint32(limit.Hours())
+	if hours == 0 {
+		aghhttp.WriteJSONResponseOK(ctx, l, w, r, &clientsStatsResp{
+			TimeUnits: timeUnitsHours,
+			Clients:   []*clientStats{},
+		})
+
+		return
+	}
+
+	units, _ := s.loadUnits(hours)
+	if units == nil {
+		const msg = "Couldn't get statistics data"
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, msg)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, s.clientsDataFromUnits(units, q.Get(queryKeyClient)))
+}
+
+// handleStatsUpstreams is the handler for the GET /control/stats/upstreams
+// HTTP API.
+func (s *StatsCtx) handleStatsUpstreams(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := s.logger
+
+	var limit time.Duration
+	func() {
+		s.confMu.RLock()
+		defer s.confMu.RUnlock()
+
+		limit = s.limit
+	}()
+
+	limit, err := parseRecent(r.URL.Query().Get(queryKeyRecent), limit)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	hours := uint32(limit.Hours())
+	if hours == 0 {
+		aghhttp.WriteJSONResponseOK(ctx, l, w, r, upstreamsDataFromUnits(nil))
+
+		return
+	}
+
+	units, _ := s.loadUnits(hours)
+	if units == nil {
+		const msg = "Couldn't get statistics data"
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, msg)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, upstreamsDataFromUnits(units))
+}
+
+// Keys of the query parameters of the GET /control/stats/range HTTP API.
+const (
+	queryKeyFrom   = "from"
+	queryKeyTo     = "to"
+	queryKeyBucket = "bucket"
+)
+
+// statsRangeResp is a response to the GET /control/stats/range.  The elements
+// of the per-bucket slices correspond to the buckets, the oldest first.
+type statsRangeResp struct {
+	// From is the start of the first bucket.
+	From time.Time `json:"from"`
+
+	// BucketSize is the duration of a bucket in milliseconds.
+	BucketSize int64 `json:"bucket_size"`
+
+	TopQueried []topAddrs `json:"top_queried_domains"`
+	TopClients []topAddrs `json:"top_clients"`
+	TopBlocked []topAddrs `json:"top_blocked_domains"`
+
+	TopBlockedServices   []topAddrs `json:"top_blocked_services"`
+	TopBlockedCategories []topAddrs `json:"top_blocked_categories"`
+
+	TopUpstreamsResponses []topAddrs      `json:"top_upstreams_responses"`
+	TopUpstreamsAvgTime   []topAddrsFloat `json:"top_upstreams_avg_time"`
+
+	DNSQueries []uint64 `json:"dns_queries"`
+
+	BlockedFiltering     []uint64 `json:"blocked_filtering"`
+	ReplacedSafebrowsing []uint64 `json:"replaced_safebrowsing"`
+	ReplacedParental     []uint64 `json:"replaced_parental"`
+
+	CacheHits   []uint64 `json:"cache_hits"`
+	CacheMisses []uint64 `json:"cache_misses"`
+	StaleHits   []uint64 `json:"stale_hits"`
+
+	NumDNSQueries           uint64 `json:"num_dns_queries"`
+	NumBlockedFiltering     uint64 `json:"num_blocked_filtering"`
+	NumReplacedSafebrowsing uint64 `json:"num_replaced_safebrowsing"`
+	NumReplacedSafesearch   uint64 `json:"num_replaced_safesearch"`
+	NumReplacedParental     uint64 `json:"num_replaced_parental"`
+	NumCacheHits            uint64 `json:"num_cache_hits"`
+	NumCacheMisses          uint64 `json:"num_cache_misses"`
+	NumStaleHits            uint64 `json:"num_stale_hits"`
+
+	AvgProcessingTime float64 `json:"avg_processing_time"`
+}
+
+// handleStatsRange is the handler for the GET /control/stats/range HTTP API.
+func (s *StatsCtx) handleStatsRange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := s.logger
+
+	var limit time.Duration
+	func() {
+		s.confMu.RLock()
+		defer s.confMu.RUnlock()
+
+		limit = s.limit
+	}()
+
+	longTermLimit := time.Duration(s.longTermDays) * timeutil.Day
+	sr, err := parseStatsRange(r.URL.Query(), limit, longTermLimit)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	var units []*unitDB
+	if firstID := timeToUnitID(sr.from); sr.unit == timeutil.Day {
+		firstID /= hoursInDay
+		units = s.loadDaysRange(firstID, firstID+sr.length-1)
+	} else {
+		units = s.loadUnitsRange(firstID, firstID+sr.length-1)
+	}
+
+	if units == nil {
+		const msg = "Couldn't get statistics data"
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, msg)
+
 		return
 	}
 
+	resp := s.rangeDataFromUnits(units, sr)
 	aghhttp.WriteJSONResponseOK(ctx, l, w, r, resp)
 }
 
+// statsRange is the parsed time range of the GET /control/stats/range HTTP API.
+type statsRange struct {
+	// from is the start of the range truncated to unit.
+	from time.Time
+
+	// unit is the duration of a single unit of the range, either an hour or a
+	// day.
+	unit time.Duration
+
+	// length is the length of the range in units.
+	length uint32
+
+	// bucketLen is the length of a bucket in units.
+	bucketLen uint32
+}
+
+// parseStatsRange parses and validates the time range parameters.  The range
+// must not be longer than limit, unless the bucket is a multiple of a day, in
+// which case the range is split into days and must not be longer than the
+// greatest of limit and longTermLimit.
+func parseStatsRange(q url.Values, limit, longTermLimit time.Duration) (sr *statsRange, err error) {
+	from, err := time.Parse(time.RFC3339, q.Get(queryKeyFrom))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", queryKeyFrom, err)
+	}
+
+	to, err := time.Parse(time.RFC3339, q.Get(queryKeyTo))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", queryKeyTo, err)
+	}
+
+	if !to.After(from) {
+		return nil, fmt.Errorf("%s: must be after %s", queryKeyTo, queryKeyFrom)
+	}
+
+	bucketMs := millisecondsInHour
+	if bucket := q.Get(queryKeyBucket); bucket != "" {
+		bucketMs, err = strconv.ParseInt(bucket, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: parsing interval: %s", queryKeyBucket, err)
+		}
+
+		if bucketMs < millisecondsInHour || bucketMs%millisecondsInHour != 0 {
+			return nil, fmt.Errorf("%s: must be a positive multiple of 1 hour", queryKeyBucket)
+		}
+	}
+
+	unit, unitName := time.Hour, "hours"
+	if bucketMs%timeutil.Day.Milliseconds() == 0 {
+		unit, unitName = timeutil.Day, "days"
+		limit = max(limit, longTermLimit)
+	}
+
+	from = from.Truncate(unit)
+	length := int64((to.Sub(from) + unit - 1) / unit)
+
+	err = validate.InRange("range "+unitName, length, 1, int64(limit/unit))
+	if err != nil {
+		// Don't wrap the error since it's already informative enough as is.
+		return nil, err
+	}
+
+	bucketLen := bucketMs / unit.Milliseconds()
+	err = validate.InRange(queryKeyBucket, bucketMs, millisecondsInHour, length*unit.Milliseconds())
+	if err != nil {
+		// Don't wrap the error since it's already informative enough as is.
+		return nil, err
+	}
+
+	return &statsRange{
+		from:      from,
+		unit:      unit,
+		length:    uint32(length),
+		bucketLen: uint32(bucketLen),
+	}, nil
+}
+
 // parseRecent parses and validates the value of the recent URL parameter.  If
 // the parameter is empty, the original limit is returned.
 func parseRecent(recent string, limit time.Duration) (parsedLimit time.Duration, err error) {
@@ -300,6 +651,10 @@ func (s *StatsCtx) handleStatsReset(w http.ResponseWriter, r *http.Request) {
 // initWeb registers the handlers for web endpoints of statistics module.
 func (s *StatsCtx) initWeb() {
 	s.httpReg.Register(http.MethodGet, "/control/stats", s.handleStats)
+	s.httpReg.Register(http.MethodGet, "/control/stats/clients", s.handleStatsClients)
+	s.httpReg.Register(http.MethodGet, "/control/stats/range", s.handleStatsRange)
+	s.httpReg.Register(http.MethodGet, "/control/stats/upstreams", s.handleStatsUpstreams)
+	s.httpReg.Register(http.MethodGet, "/control/stats/public", s.handleStatsPublic)
 	s.httpReg.Register(http.MethodPost, "/control/stats_reset", s.handleStatsReset)
 	s.httpReg.Register(http.MethodGet, "/control/stats/config", s.handleGetStatsConfig)
 	s.httpReg.Register(http.MethodPut, "/control/stats/config/update", s.handlePutStatsConfig)
@@ -239,3 +239,215 @@ func TestStatsCtx_handleStats(t *testing.T) {
 		})
 	}
 }
+
+func TestStatsCtx_handleStatsPublic(t *testing.T) {
+	s := newTestStatsCtx(t, Config{
+		Enabled: true,
+	})
+
+	s.Start()
+	defer testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	populateTestData(t, s)
+
+	req := httptest.NewRequest(http.MethodGet, "/control/stats/public", nil)
+	rw := httptest.NewRecorder()
+
+	s.handleStatsPublic(rw, req)
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	body := rw.Body.String()
+	assert.NotContains(t, body, TestDomain1)
+	assert.NotContains(t, body, TestDomain2)
+	assert.NotContains(t, body, netutil.IPv4Localhost().String())
+
+	ans := publicStatsResp{}
+	err := json.Unmarshal(rw.Body.Bytes(), &ans)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(2), ans.NumDNSQueries)
+	assert.Equal(t, "hours", ans.TimeUnits)
+	assert.NotEmpty(t, ans.DNSQueries)
+}
+
+func TestStatsCtx_handleStatsClients(t *testing.T) {
+	const (
+		cli1 = "192.0.2.1"
+		cli2 = "192.0.2.2"
+	)
+
+	const curID = 1000
+	s := newTestStatsCtx(t, Config{
+		UnitID:  func() (id uint32) { return curID },
+		Enabled: true,
+	})
+
+	s.Start()
+	defer testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	oldUnit := &unitDB{
+		NResult:        make([]uint64, resultLast),
+		Clients:        []countPair{{Name: cli1, Count: 2}},
+		ClientsBlocked: []countPair{{Name: cli1, Count: 1}},
+		ClientsTimeSum: []countPair{{Name: cli1, Count: 4_000}},
+		NTotal:         2,
+	}
+
+	db := s.db.Load()
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	require.NoError(t, s.flushUnitToDB(oldUnit, tx, curID-1))
+	require.NoError(t, finishTxn(tx, true))
+
+	for _, e := range []*Entry{{
+		Client:         cli1,
+		Domain:         TestDomain1,
+		ProcessingTime: time.Millisecond,
+		Result:         RNotFiltered,
+	}, {
+		Client:         cli2,
+		Domain:         TestDomain1,
+		ProcessingTime: 3 * time.Millisecond,
+		Result:         RFiltered,
+	}} {
+		s.Update(e)
+	}
+
+	get := func(t *testing.T, query string) (resp *clientsStatsResp) {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/control/stats/clients?"+query, nil)
+		rw := httptest.NewRecorder()
+
+		s.handleStatsClients(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		resp = &clientsStatsResp{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+
+		return resp
+	}
+
+	t.Run("all", func(t *testing.T) {
+		resp := get(t, "")
+		require.Len(t, resp.Clients, 2)
+
+		assert.Equal(t, timeUnitsHours, resp.TimeUnits)
+
+		c1, c2 := resp.Clients[0], resp.Clients[1]
+		require.Equal(t, cli1, c1.Name)
+		require.Equal(t, cli2, c2.Name)
+
+		require.Len(t, c1.DNSQueries, 24)
+
+		assert.Equal(t, uint64(3), c1.NumDNSQueries)
+		assert.Equal(t, uint64(1), c1.NumBlocked)
+		assert.Equal(t, []uint64{2, 1}, c1.DNSQueries[22:])
+		assert.Equal(t, []uint64{1, 0}, c1.Blocked[22:])
+		assert.InDeltaSlice(t, []float64{0.002, 0.001}, c1.AvgProcessingTime[22:], 1e-9)
+
+		assert.Equal(t, uint64(1), c2.NumDNSQueries)
+		assert.Equal(t, uint64(1), c2.NumBlocked)
+	})
+
+	t.Run("client", func(t *testing.T) {
+		resp := get(t, "client="+cli2)
+		require.Len(t, resp.Clients, 1)
+
+		assert.Equal(t, cli2, resp.Clients[0].Name)
+	})
+
+	t.Run("recent", func(t *testing.T) {
+		resp := get(t, fmt.Sprintf("recent=%d", time.Hour.Milliseconds()))
+		require.Len(t, resp.Clients, 2)
+
+		assert.Equal(t, []uint64{1}, resp.Clients[0].DNSQueries)
+	})
+}
+
+func TestStatsCtx_handleStatsRange(t *testing.T) {
+	const curID = 1000
+	s := newTestStatsCtx(t, Config{
+		UnitID:  func() (id uint32) { return curID },
+		Enabled: true,
+	})
+
+	s.Start()
+	defer testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	db := s.db.Load()
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	for id, n := range map[uint32]uint64{curID - 3: 1, curID - 2: 2, curID - 1: 4} {
+		res := make([]uint64, resultLast)
+		res[RFiltered] = 1
+
+		require.NoError(t, s.flushUnitToDB(&unitDB{NResult: res, NTotal: n}, tx, id))
+	}
+
+	require.NoError(t, finishTxn(tx, true))
+
+	s.Update(&Entry{
+		Client: "192.0.2.1",
+		Domain: TestDomain1,
+		Result: RNotFiltered,
+	})
+
+	unitTime := func(id uint32) (formatted string) {
+		return time.Unix(int64(id)*3600, 0).UTC().Format(time.RFC3339)
+	}
+
+	get := func(t *testing.T, query string, wantCode int) (resp *statsRangeResp) {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/control/stats/range?"+query, nil)
+		rw := httptest.NewRecorder()
+
+		s.handleStatsRange(rw, req)
+		require.Equal(t, wantCode, rw.Code)
+
+		if wantCode != http.StatusOK {
+			return nil
+		}
+
+		resp = &statsRangeResp{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+
+		return resp
+	}
+
+	t.Run("hours", func(t *testing.T) {
+		q := fmt.Sprintf("from=%s&to=%s", unitTime(curID-3), unitTime(curID+1))
+		resp := get(t, q, http.StatusOK)
+
+		assert.Equal(t, time.Hour.Milliseconds(), resp.BucketSize)
+		assert.Equal(t, []uint64{1, 2, 4, 1}, resp.DNSQueries)
+		assert.Equal(t, []uint64{1, 1, 1, 0}, resp.BlockedFiltering)
+		assert.Equal(t, uint64(8), resp.NumDNSQueries)
+		assert.Equal(t, uint64(3), resp.NumBlockedFiltering)
+	})
+
+	t.Run("buckets", func(t *testing.T) {
+		q := fmt.Sprintf(
+			"from=%s&to=%s&bucket=%d",
+			unitTime(curID-3),
+			unitTime(curID),
+			(2 * time.Hour).Milliseconds(),
+		)
+		resp := get(t, q, http.StatusOK)
+
+		assert.Equal(t, []uint64{3, 4}, resp.DNSQueries)
+		assert.Equal(t, uint64(7), resp.NumDNSQueries)
+	})
+
+	t.Run("bad_range", func(t *testing.T) {
+		get(t, fmt.Sprintf("from=%s&to=%s", unitTime(curID), unitTime(curID-1)), http.StatusBadRequest)
+	})
+
+	t.Run("bad_bucket", func(t *testing.T) {
+		q := fmt.Sprintf("from=%s&to=%s&bucket=1000", unitTime(curID-1), unitTime(curID))
+		get(t, q, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,261 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"go.etcd.io/bbolt"
+)
+
+// hoursInDay is the number of hourly units in a daily unit.
+const hoursInDay = 24
+
+// maxLongTermIvl is the maximum retention interval of the long-term
+// statistics.
+const maxLongTermIvl = 10 * 365 * timeutil.Day
+
+// dailyBucketName is the name of the database bucket containing the daily
+// units of the long-term statistics.  The keys within it are the IDs of the
+// days encoded the same way as the names of the hourly buckets.
+var dailyBucketName = []byte("daily")
+
+// validateLongTermIvl returns an error if ivl isn't a valid retention interval
+// of the long-term statistics.
+func validateLongTermIvl(ivl time.Duration) (err error) {
+	switch {
+	case ivl < timeutil.Day:
+		return errors.Error("less than a day")
+	case ivl > maxLongTermIvl:
+		return errors.Error("more than ten years")
+	case ivl%timeutil.Day != 0:
+		return errors.Error("not a multiple of a day")
+	default:
+		return nil
+	}
+}
+
+// merge adds the data from udb to u.  udb must not be nil.
+func (u *unit) merge(udb *unitDB) {
+	u.nTotal += udb.NTotal
+	u.timeSum += uint64(udb.TimeAvg) * udb.NTotal
+	u.cacheHits += udb.CacheHits
+	u.cacheMisses += udb.CacheMisses
+	u.staleHits += udb.StaleHits
+
+	for i, n := range udb.NResult[:min(len(udb.NResult), len(u.nResult))] {
+		u.nResult[i] += n
+	}
+
+	addPairs(u.domains, udb.Domains)
+	addPairs(u.blockedDomains, udb.BlockedDomains)
+	addPairs(u.blockedServices, udb.BlockedServices)
+	addPairs(u.blockedCategories, udb.BlockedCategories)
+	addPairs(u.clients, udb.Clients)
+	addPairs(u.clientsBlocked, udb.ClientsBlocked)
+	addPairs(u.clientsTimeSum, udb.ClientsTimeSum)
+	addPairs(u.upstreamsResponses, udb.UpstreamsResponses)
+	addPairs(u.upstreamsTimeSum, udb.UpstreamsTimeSum)
+	addPairs(u.upstreamsErrors, udb.UpstreamsErrors)
+
+	for _, hp := range udb.UpstreamsLatency {
+		h := u.upstreamsLatency[hp.Name]
+		if h == nil {
+			h = make([]uint64, len(latencyBounds)+1)
+			u.upstreamsLatency[hp.Name] = h
+		}
+
+		for i, n := range hp.Counts[:min(len(hp.Counts), len(h))] {
+			h[i] += n
+		}
+	}
+}
+
+// addPairs adds the counts of pairs to m.
+func addPairs(m map[string]uint64, pairs []countPair) {
+	for _, p := range pairs {
+		m[p.Name] += p.Count
+	}
+}
+
+// loadDailyUnit loads the daily unit with the given ID from bkt.  udb is nil if
+// there is no such unit.
+func (s *StatsCtx) loadDailyUnit(bkt *bbolt.Bucket, dayID uint32) (udb *unitDB) {
+	data := bkt.Get(idToUnitName(dayID))
+	if data == nil {
+		return nil
+	}
+
+	udb = &unitDB{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(udb)
+	if err != nil {
+		s.logger.Error("gob decode daily unit", "day_id", dayID, slogutil.KeyError, err)
+
+		return nil
+	}
+
+	return udb
+}
+
+// downsampleUnit merges the hourly unit with the given ID into the daily unit
+// of the long-term statistics.  It does nothing if there is no such hourly
+// unit.
+func (s *StatsCtx) downsampleUnit(tx *bbolt.Tx, id uint32) (err error) {
+	hourly := s.loadUnitFromDB(tx, id)
+	if hourly == nil {
+		return nil
+	}
+
+	bkt, err := tx.CreateBucketIfNotExists(dailyBucketName)
+	if err != nil {
+		return fmt.Errorf("creating daily bucket: %w", err)
+	}
+
+	dayID := id / hoursInDay
+	day := newUnit(dayID)
+	day.deserialize(s.loadDailyUnit(bkt, dayID))
+	day.merge(hourly)
+
+	buf := &bytes.Buffer{}
+	err = gob.NewEncoder(buf).Encode(day.serialize())
+	if err != nil {
+		return fmt.Errorf("encoding daily unit: %w", err)
+	}
+
+	err = bkt.Put(idToUnitName(dayID), buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("putting daily unit: %w", err)
+	}
+
+	s.logger.Debug("downsampled unit", "id", id, "day_id", dayID)
+
+	return nil
+}
+
+// deleteOldDailyUnits deletes the daily units with IDs less than firstDayID.
+func (s *StatsCtx) deleteOldDailyUnits(tx *bbolt.Tx, firstDayID uint32) (err error) {
+	bkt := tx.Bucket(dailyBucketName)
+	if bkt == nil {
+		return nil
+	}
+
+	var keys [][]byte
+	c := bkt.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		dayID, ok := unitNameToID(k)
+		if ok && dayID >= firstDayID {
+			break
+		}
+
+		keys = append(keys, slices.Clone(k))
+	}
+
+	for _, k := range keys {
+		err = bkt.Delete(k)
+		if err != nil {
+			return fmt.Errorf("deleting daily unit: %w", err)
+		}
+	}
+
+	if len(keys) > 0 {
+		s.logger.Debug("deleted daily units", "count", len(keys))
+	}
+
+	return nil
+}
+
+// deleteUnit deletes the hourly unit with the given ID.  If the long-term
+// statistics are enabled, the unit is downsampled first and the daily units,
+// which are too old, are deleted.  The errors of the downsampling are only
+// logged, so that those don't prevent the rotation of the hourly units.
+func (s *StatsCtx) deleteUnit(tx *bbolt.Tx, id uint32) (err error) {
+	if s.longTermDays != 0 {
+		s.downsample(tx, id)
+	}
+
+	return tx.DeleteBucket(idToUnitName(id))
+}
+
+// downsample merges the hourly unit with the given ID into the long-term
+// statistics and deletes the daily units, which are too old.
+func (s *StatsCtx) downsample(tx *bbolt.Tx, id uint32) {
+	err := s.downsampleUnit(tx, id)
+	if err != nil {
+		s.logger.Error("downsampling unit", "id", id, slogutil.KeyError, err)
+	}
+
+	dayID := id / hoursInDay
+	if dayID < s.longTermDays {
+		return
+	}
+
+	err = s.deleteOldDailyUnits(tx, dayID-s.longTermDays+1)
+	if err != nil {
+		s.logger.Error("deleting old daily units", slogutil.KeyError, err)
+	}
+}
+
+// loadDaysRange returns the daily units with IDs from firstDayID to lastDayID
+// inclusive.  Each of them contains the downsampled data as well as the data
+// of the hourly units of the day, which are still stored.  units is nil if the
+// database isn't open.  firstDayID must not be greater than lastDayID.
+func (s *StatsCtx) loadDaysRange(firstDayID, lastDayID uint32) (units []*unitDB) {
+	db := s.db.Load()
+	if db == nil {
+		return nil
+	}
+
+	// Use writable transaction to ensure any ongoing writable transaction is
+	// taken into account.
+	tx, err := db.Begin(true)
+	if err != nil {
+		s.logger.Error("opening transaction", slogutil.KeyError, err)
+
+		return nil
+	}
+
+	s.currMu.RLock()
+	defer s.currMu.RUnlock()
+
+	cur := s.curr
+	bkt := tx.Bucket(dailyBucketName)
+
+	units = make([]*unitDB, 0, lastDayID-firstDayID+1)
+	for dayID := firstDayID; ; dayID++ {
+		day := newUnit(dayID)
+		if bkt != nil {
+			day.deserialize(s.loadDailyUnit(bkt, dayID))
+		}
+
+		for id := dayID * hoursInDay; id < (dayID+1)*hoursInDay; id++ {
+			var hourly *unitDB
+			if cur != nil && cur.id == id {
+				hourly = cur.serialize()
+			} else {
+				hourly = s.loadUnitFromDB(tx, id)
+			}
+
+			if hourly != nil {
+				day.merge(hourly)
+			}
+		}
+
+		units = append(units, day.serialize())
+
+		if dayID == lastDayID {
+			break
+		}
+	}
+
+	err = finishTxn(tx, false)
+	if err != nil {
+		s.logger.Error("finishing transaction", slogutil.KeyError, err)
+	}
+
+	return units
+}
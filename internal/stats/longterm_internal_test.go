@@ -0,0 +1,131 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsCtx_longTerm(t *testing.T) {
+	const (
+		curDay = 100
+		curID  = curDay*hoursInDay + 5
+	)
+
+	s := newTestStatsCtx(t, Config{
+		UnitID:        func() (id uint32) { return curID },
+		Limit:         timeutil.Day,
+		LongTermLimit: 3 * timeutil.Day,
+		Enabled:       true,
+	})
+
+	s.Start()
+	defer testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	s.Update(&Entry{
+		Client: "192.0.2.1",
+		Domain: TestDomain1,
+		Result: RNotFiltered,
+	})
+
+	newUnitDB := func(n uint64) (udb *unitDB) {
+		return &unitDB{
+			NResult: make([]uint64, resultLast),
+			Clients: []countPair{{Name: "192.0.2.1", Count: n}},
+			NTotal:  n,
+		}
+	}
+
+	db := s.db.Load()
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	hourly := []struct {
+		id uint32
+		n  uint64
+	}{
+		{id: 96 * hoursInDay, n: 5},
+		{id: 97*hoursInDay + 1, n: 1},
+		{id: 97*hoursInDay + 2, n: 2},
+		{id: 99*hoursInDay + 3, n: 7},
+	}
+
+	for _, h := range hourly {
+		require.NoError(t, s.flushUnitToDB(newUnitDB(h.n), tx, h.id))
+		require.NoError(t, s.deleteUnit(tx, h.id))
+	}
+
+	// This one is still within the hourly statistics.
+	require.NoError(t, s.flushUnitToDB(newUnitDB(4), tx, 99*hoursInDay+20))
+	require.NoError(t, finishTxn(tx, true))
+
+	t.Run("days", func(t *testing.T) {
+		units := s.loadDaysRange(96, curDay)
+		require.Len(t, units, 5)
+
+		got := make([]uint64, 0, len(units))
+		for _, u := range units {
+			got = append(got, u.NTotal)
+		}
+
+		// The 96th day is deleted as too old.
+		assert.Equal(t, []uint64{0, 3, 0, 11, 1}, got)
+		assert.Equal(t, []countPair{{Name: "192.0.2.1", Count: 3}}, units[1].Clients)
+	})
+
+	dayTime := func(day int64) (formatted string) {
+		return time.Unix(day*int64(timeutil.Day/time.Second), 0).UTC().Format(time.RFC3339)
+	}
+
+	t.Run("range", func(t *testing.T) {
+		q := fmt.Sprintf(
+			"from=%s&to=%s&bucket=%d",
+			dayTime(98),
+			dayTime(curDay+1),
+			(2 * timeutil.Day).Milliseconds(),
+		)
+
+		req := httptest.NewRequest(http.MethodGet, "/control/stats/range?"+q, nil)
+		rw := httptest.NewRecorder()
+
+		s.handleStatsRange(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		resp := &statsRangeResp{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+
+		assert.Equal(t, (2 * timeutil.Day).Milliseconds(), resp.BucketSize)
+		assert.Equal(t, []uint64{11, 1}, resp.DNSQueries)
+		assert.Equal(t, uint64(12), resp.NumDNSQueries)
+	})
+
+	t.Run("too_long", func(t *testing.T) {
+		q := fmt.Sprintf(
+			"from=%s&to=%s&bucket=%d",
+			dayTime(97),
+			dayTime(curDay+1),
+			timeutil.Day.Milliseconds(),
+		)
+
+		req := httptest.NewRequest(http.MethodGet, "/control/stats/range?"+q, nil)
+		rw := httptest.NewRecorder()
+
+		s.handleStatsRange(rw, req)
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+}
+
+func TestValidateLongTermIvl(t *testing.T) {
+	assert.NoError(t, validateLongTermIvl(365*timeutil.Day))
+	assert.Error(t, validateLongTermIvl(time.Hour))
+	assert.Error(t, validateLongTermIvl(36*time.Hour))
+	assert.Error(t, validateLongTermIvl(11*365*timeutil.Day))
+}
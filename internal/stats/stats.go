@@ -3,12 +3,14 @@
 package stats
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/netip"
 	"os"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -77,9 +79,19 @@ type Config struct {
 	// interface.
 	Filename string
 
+	// StatsD, if not nil, is the configuration of the emission of the metrics
+	// to StatsD.
+	StatsD *StatsDConfig
+
 	// Limit is an upper limit for collecting statistics.
 	Limit time.Duration
 
+	// LongTermLimit, if not zero, is the retention interval of the long-term
+	// statistics.  The hourly units older than Limit are downsampled into the
+	// daily ones, which are kept for LongTermLimit.  It must be a multiple of
+	// a day.
+	LongTermLimit time.Duration
+
 	// Enabled tells if the statistics are enabled.
 	Enabled bool
 }
@@ -130,6 +142,9 @@ type StatsCtx struct {
 	// configModifier is used to update the global configuration.
 	configModifier agh.ConfigModifier
 
+	// statsd, if not nil, sends the metrics of each entry to StatsD.
+	statsd *statsDEmitter
+
 	// confMu protects ignored, limit, and enabled.
 	confMu *sync.RWMutex
 
@@ -146,6 +161,10 @@ type StatsCtx struct {
 	// limit is an upper limit for collecting statistics.
 	limit time.Duration
 
+	// longTermDays is the retention interval of the long-term statistics in
+	// days.  If it's zero, the long-term statistics are disabled.
+	longTermDays uint32
+
 	// enabled tells if the statistics are enabled.
 	enabled bool
 }
@@ -164,6 +183,13 @@ func New(conf Config) (s *StatsCtx, err error) {
 		return nil, errors.Error("should count client is unspecified")
 	}
 
+	if conf.LongTermLimit != 0 {
+		err = validateLongTermIvl(conf.LongTermLimit)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported long-term interval: %w", err)
+		}
+	}
+
 	s = &StatsCtx{
 		logger:         conf.Logger,
 		currMu:         &sync.RWMutex{},
@@ -175,6 +201,7 @@ func New(conf Config) (s *StatsCtx, err error) {
 		ignored:           conf.Ignored,
 		shouldCountClient: conf.ShouldCountClient,
 		limit:             conf.Limit,
+		longTermDays:      uint32(conf.LongTermLimit / timeutil.Day),
 		enabled:           conf.Enabled,
 	}
 
@@ -182,6 +209,13 @@ func New(conf Config) (s *StatsCtx, err error) {
 		s.unitIDGen = conf.UnitID
 	}
 
+	if conf.StatsD != nil {
+		s.statsd, err = newStatsDEmitter(s.logger.With("emitter", "statsd"), conf.StatsD)
+		if err != nil {
+			return nil, fmt.Errorf("statsd: %w", err)
+		}
+	}
+
 	// TODO(e.burkov):  Move the code below to the Start method.
 
 	err = s.openDB()
@@ -240,6 +274,10 @@ func (s *StatsCtx) Start() {
 	s.initWeb()
 
 	go s.periodicFlush()
+
+	if s.statsd != nil {
+		go s.statsd.periodicFlush()
+	}
 }
 
 // Close implements the [io.Closer] interface for *StatsCtx.
@@ -248,6 +286,11 @@ func (s *StatsCtx) Close() (err error) {
 	if db == nil {
 		return nil
 	}
+
+	if s.statsd != nil {
+		defer func() { err = errors.WithDeferred(err, s.statsd.close()) }()
+	}
+
 	defer func() {
 		cerr := db.Close()
 		if cerr == nil {
@@ -274,17 +317,23 @@ func (s *StatsCtx) Close() (err error) {
 // Update implements the [Interface] interface for *StatsCtx.  e must not be
 // nil.
 func (s *StatsCtx) Update(e *Entry) {
-	s.confMu.Lock()
-	defer s.confMu.Unlock()
+	err := e.validate()
+	if err != nil {
+		s.logger.Debug("validating entry", slogutil.KeyError, err)
 
-	if !s.enabled || s.limit == 0 {
 		return
 	}
 
-	err := e.validate()
-	if err != nil {
-		s.logger.Debug("validating entry", slogutil.KeyError, err)
+	if s.statsd != nil {
+		// The metrics are sent regardless of the statistics being enabled,
+		// since those are configured separately.
+		s.statsd.emit(e)
+	}
 
+	s.confMu.Lock()
+	defer s.confMu.Unlock()
+
+	if !s.enabled || s.limit == 0 {
 		return
 	}
 
@@ -354,23 +403,19 @@ func (s *StatsCtx) deleteOldUnits(tx *bbolt.Tx, firstID uint32) (deleted int) {
 	// bizarre solution.
 	const errStop errors.Error = "stop iteration"
 
+	// Collect the names first, since the buckets are modified while
+	// downsampling.
+	var names [][]byte
 	walk := func(name []byte, _ *bbolt.Bucket) (err error) {
 		nameID, ok := unitNameToID(name)
 		if ok && nameID >= firstID {
 			return errStop
 		}
 
-		err = tx.DeleteBucket(name)
-		if err != nil {
-			s.logger.Debug("deleting bucket", slogutil.KeyError, err)
-
-			return nil
+		if !bytes.Equal(name, dailyBucketName) {
+			names = append(names, slices.Clone(name))
 		}
 
-		s.logger.Debug("deleted unit", "name_id", nameID, "name", fmt.Sprintf("%x", name))
-
-		deleted++
-
 		return nil
 	}
 
@@ -379,6 +424,25 @@ func (s *StatsCtx) deleteOldUnits(tx *bbolt.Tx, firstID uint32) (deleted int) {
 		s.logger.Debug("deleting units", slogutil.KeyError, err)
 	}
 
+	for _, name := range names {
+		nameID, ok := unitNameToID(name)
+		if ok && len(name) == bucketNameLen {
+			err = s.deleteUnit(tx, nameID)
+		} else {
+			err = tx.DeleteBucket(name)
+		}
+
+		if err != nil {
+			s.logger.Debug("deleting bucket", slogutil.KeyError, err)
+
+			continue
+		}
+
+		s.logger.Debug("deleted unit", "name_id", nameID, "name", fmt.Sprintf("%x", name))
+
+		deleted++
+	}
+
 	return deleted
 }
 
@@ -467,7 +531,7 @@ func (s *StatsCtx) flushDB(id, limit uint32, ptr *unit) (cont bool, sleepFor tim
 		isCommitable = false
 	}
 
-	delErr := tx.DeleteBucket(idToUnitName(id - limit))
+	delErr := s.deleteUnit(tx, id-limit)
 
 	if delErr != nil {
 		// TODO(e.burkov):  Improve the algorithm of deleting the oldest bucket
@@ -619,6 +683,57 @@ func (s *StatsCtx) loadUnits(limit uint32) (units []*unitDB, curID uint32) {
 	return units, curID
 }
 
+// loadUnitsRange returns the units with IDs from firstID to lastID inclusive.
+// The units missing from the database are returned empty.  units is nil if the
+// database isn't open.  firstID must not be greater than lastID.
+func (s *StatsCtx) loadUnitsRange(firstID, lastID uint32) (units []*unitDB) {
+	db := s.db.Load()
+	if db == nil {
+		return nil
+	}
+
+	// Use writable transaction to ensure any ongoing writable transaction is
+	// taken into account.
+	tx, err := db.Begin(true)
+	if err != nil {
+		s.logger.Error("opening transaction", slogutil.KeyError, err)
+
+		return nil
+	}
+
+	s.currMu.RLock()
+	defer s.currMu.RUnlock()
+
+	cur := s.curr
+
+	units = make([]*unitDB, 0, lastID-firstID+1)
+	for id := firstID; ; id++ {
+		var u *unitDB
+		if cur != nil && cur.id == id {
+			u = cur.serialize()
+		} else {
+			u = s.loadUnitFromDB(tx, id)
+		}
+
+		if u == nil {
+			u = &unitDB{NResult: make([]uint64, resultLast)}
+		}
+
+		units = append(units, u)
+
+		if id == lastID {
+			break
+		}
+	}
+
+	err = finishTxn(tx, false)
+	if err != nil {
+		s.logger.Error("finishing transaction", slogutil.KeyError, err)
+	}
+
+	return units
+}
+
 // ShouldCount returns true if request for the host should be counted.
 func (s *StatsCtx) ShouldCount(host string, _, _ uint16, ids []string) bool {
 	s.confMu.RLock()
@@ -21,6 +21,9 @@ import (
 // testLogger is the common logger for tests.
 var testLogger = slogutil.NewDiscardLogger()
 
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
 // newTestStatsCtx returns StatsCtx initialised with given values.  All empty
 // values from c will be replaced with defaults.
 func newTestStatsCtx(tb testing.TB, c Config) (s *StatsCtx) {
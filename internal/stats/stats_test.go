@@ -77,10 +77,14 @@ func TestStats(t *testing.T) {
 	t.Run("data", func(t *testing.T) {
 		const reqDomain = "domain"
 		const respUpstream = "upstream"
+		const blockedSvc = "youtube"
+		const blockedCat = "video"
 
 		entries := []*stats.Entry{{
 			Domain:         reqDomain,
 			Client:         cliIPStr,
+			BlockedService: blockedSvc,
+			Category:       blockedCat,
 			Result:         stats.RFiltered,
 			ProcessingTime: time.Microsecond * 123456,
 			UpstreamStats: []*proxy.UpstreamStatistics{{
@@ -103,6 +107,8 @@ func TestStats(t *testing.T) {
 			TopQueried:            []map[string]uint64{0: {reqDomain: 1}},
 			TopClients:            []map[string]uint64{0: {cliIPStr: 2}},
 			TopBlocked:            []map[string]uint64{0: {reqDomain: 1}},
+			TopBlockedServices:    []map[string]uint64{0: {blockedSvc: 1}},
+			TopBlockedCategories:  []map[string]uint64{0: {blockedCat: 1}},
 			TopUpstreamsResponses: []map[string]uint64{0: {respUpstream: 2}},
 			TopUpstreamsAvgTime:   []map[string]float64{0: {respUpstream: 0.222222}},
 			DNSQueries: []uint64{
@@ -121,11 +127,26 @@ func TestStats(t *testing.T) {
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 			},
+			CacheHits: []uint64{
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			CacheMisses: []uint64{
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
+			},
+			StaleHits: []uint64{
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+			},
 			NumDNSQueries:           2,
 			NumBlockedFiltering:     1,
 			NumReplacedSafebrowsing: 0,
 			NumReplacedSafesearch:   0,
 			NumReplacedParental:     0,
+			NumCacheHits:            0,
+			NumCacheMisses:          2,
+			NumStaleHits:            0,
 			AvgProcessingTime:       0.123456,
 		}
 
@@ -157,12 +178,17 @@ func TestStats(t *testing.T) {
 			TopQueried:            []map[string]uint64{},
 			TopClients:            []map[string]uint64{},
 			TopBlocked:            []map[string]uint64{},
+			TopBlockedServices:    []map[string]uint64{},
+			TopBlockedCategories:  []map[string]uint64{},
 			TopUpstreamsResponses: []map[string]uint64{},
 			TopUpstreamsAvgTime:   []map[string]float64{},
 			DNSQueries:            _24zeroes[:],
 			BlockedFiltering:      _24zeroes[:],
 			ReplacedSafebrowsing:  _24zeroes[:],
 			ReplacedParental:      _24zeroes[:],
+			CacheHits:             _24zeroes[:],
+			CacheMisses:           _24zeroes[:],
+			StaleHits:             _24zeroes[:],
 		}
 
 		req = httptest.NewRequest(http.MethodGet, "/control/stats", nil)
@@ -0,0 +1,328 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// StatsDTagFormat is the format of the tags of the metrics sent to StatsD.
+type StatsDTagFormat string
+
+// Valid StatsD tag formats.
+const (
+	// StatsDTagFormatNone means that the metrics are sent without tags.
+	StatsDTagFormatNone StatsDTagFormat = "none"
+
+	// StatsDTagFormatDogStatsD is the DogStatsD format, for example:
+	//
+	//	adguardhome.queries:1|c|#result:filtered
+	StatsDTagFormatDogStatsD StatsDTagFormat = "dogstatsd"
+
+	// StatsDTagFormatInfluxDB is the format of the StatsD input of Telegraf,
+	// for example:
+	//
+	//	adguardhome.queries,result=filtered:1|c
+	StatsDTagFormatInfluxDB StatsDTagFormat = "influxdb"
+
+	// StatsDTagFormatGraphite is the format of the tagged Graphite metrics,
+	// for example:
+	//
+	//	adguardhome.queries;result=filtered:1|c
+	StatsDTagFormatGraphite StatsDTagFormat = "graphite"
+)
+
+// statsDTagFormatValues are all valid StatsD tag formats.
+var statsDTagFormatValues = []StatsDTagFormat{
+	StatsDTagFormatNone,
+	StatsDTagFormatDogStatsD,
+	StatsDTagFormatInfluxDB,
+	StatsDTagFormatGraphite,
+}
+
+// NewStatsDTagFormat validates that s is a valid tag format and returns it as a
+// StatsDTagFormat.
+func NewStatsDTagFormat(s string) (f StatsDTagFormat, err error) {
+	f = StatsDTagFormat(s)
+	if !slices.Contains(statsDTagFormatValues, f) {
+		return "", fmt.Errorf(
+			"tag format %q: %w: should be one of %q",
+			s,
+			errors.ErrBadEnumValue,
+			statsDTagFormatValues,
+		)
+	}
+
+	return f, nil
+}
+
+// StatsDConfig is the configuration of the emission of the metrics to StatsD.
+type StatsDConfig struct {
+	// Addr is the address of the StatsD server in the host:port format.
+	Addr string
+
+	// Prefix, if not empty, is prepended to the names of the metrics with a
+	// dot.
+	Prefix string
+
+	// TagFormat is the format of the tags of the metrics.
+	TagFormat StatsDTagFormat
+
+	// FlushIvl is the interval between sending the buffered metrics.  It must
+	// be positive.
+	FlushIvl time.Duration
+}
+
+// maxStatsDPacketSize is the maximum size of a single UDP packet sent to
+// StatsD.  It's chosen to fit into the common Ethernet MTU.
+const maxStatsDPacketSize = 1432
+
+// Names of the metrics sent to StatsD.
+const (
+	statsDMetricQueries           = "queries"
+	statsDMetricProcessingTime    = "processing_time"
+	statsDMetricUpstreamResponses = "upstream.responses"
+	statsDMetricUpstreamErrors    = "upstream.errors"
+	statsDMetricUpstreamTime      = "upstream.time"
+)
+
+// Types of the metrics sent to StatsD.
+const (
+	statsDTypeCounter = "c"
+	statsDTypeTiming  = "ms"
+)
+
+// statsDResultNames are the values of the result tag of the metrics by the
+// result of the request.
+var statsDResultNames = [resultLast]string{
+	RNotFiltered:  "not_filtered",
+	RFiltered:     "filtered",
+	RSafeBrowsing: "safe_browsing",
+	RSafeSearch:   "safe_search",
+	RParental:     "parental",
+}
+
+// statsDTagReplacer replaces the characters having a special meaning in any
+// of the supported formats.
+var statsDTagReplacer = strings.NewReplacer(
+	",", "_",
+	":", "_",
+	"|", "_",
+	"#", "_",
+	"=", "_",
+	";", "_",
+	" ", "_",
+	"\n", "_",
+)
+
+// statsDTag is a single tag of a StatsD metric.
+type statsDTag struct {
+	key   string
+	value string
+}
+
+// statsDEmitter buffers the metrics and sends them to StatsD over UDP.
+type statsDEmitter struct {
+	logger *slog.Logger
+	conn   net.Conn
+	done   chan struct{}
+
+	// mu protects buf.
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+
+	prefix    string
+	tagFormat StatsDTagFormat
+	flushIvl  time.Duration
+}
+
+// newStatsDEmitter returns a new properly initialized *statsDEmitter.  All
+// arguments must not be nil.
+func newStatsDEmitter(logger *slog.Logger, conf *StatsDConfig) (e *statsDEmitter, err error) {
+	if conf.FlushIvl <= 0 {
+		return nil, fmt.Errorf("flush interval: %w: %s", errors.ErrNotPositive, conf.FlushIvl)
+	}
+
+	_, err = NewStatsDTagFormat(string(conf.TagFormat))
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", conf.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing: %w", err)
+	}
+
+	prefix := conf.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	return &statsDEmitter{
+		logger:    logger,
+		conn:      conn,
+		done:      make(chan struct{}),
+		mu:        &sync.Mutex{},
+		buf:       &bytes.Buffer{},
+		prefix:    prefix,
+		tagFormat: conf.TagFormat,
+		flushIvl:  conf.FlushIvl,
+	}, nil
+}
+
+// emit buffers the metrics of ent.  ent must be valid.
+func (e *statsDEmitter) emit(ent *Entry) {
+	resTag := statsDTag{key: "result", value: statsDResultNames[ent.Result]}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.write(statsDMetricQueries, 1, statsDTypeCounter, resTag)
+	e.write(
+		statsDMetricProcessingTime,
+		ent.ProcessingTime.Milliseconds(),
+		statsDTypeTiming,
+		resTag,
+	)
+
+	for _, s := range ent.UpstreamStats {
+		if s.IsCached {
+			continue
+		}
+
+		upsTag := statsDTag{key: "upstream", value: s.Address}
+		if s.Error != nil {
+			e.write(statsDMetricUpstreamErrors, 1, statsDTypeCounter, upsTag)
+
+			continue
+		}
+
+		e.write(statsDMetricUpstreamResponses, 1, statsDTypeCounter, upsTag)
+		e.write(
+			statsDMetricUpstreamTime,
+			s.QueryDuration.Milliseconds(),
+			statsDTypeTiming,
+			upsTag,
+		)
+	}
+}
+
+// write appends a line of the metric to the buffer, sending the buffer first
+// if the line doesn't fit into the packet.  e.mu is expected to be locked.
+func (e *statsDEmitter) write(name string, val int64, typ string, tags ...statsDTag) {
+	line := e.formatLine(name, val, typ, tags)
+	if e.buf.Len() > 0 && e.buf.Len()+1+len(line) > maxStatsDPacketSize {
+		e.send()
+	}
+
+	if e.buf.Len() > 0 {
+		e.buf.WriteByte('\n')
+	}
+
+	e.buf.WriteString(line)
+}
+
+// formatLine returns a line of the metric in the configured format.
+func (e *statsDEmitter) formatLine(name string, val int64, typ string, tags []statsDTag) (line string) {
+	b := &strings.Builder{}
+	b.WriteString(e.prefix)
+	b.WriteString(name)
+
+	switch e.tagFormat {
+	case StatsDTagFormatInfluxDB:
+		writeStatsDTags(b, tags, ",", "=", ",")
+	case StatsDTagFormatGraphite:
+		writeStatsDTags(b, tags, ";", "=", ";")
+	}
+
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatInt(val, 10))
+	b.WriteByte('|')
+	b.WriteString(typ)
+
+	if e.tagFormat == StatsDTagFormatDogStatsD && len(tags) > 0 {
+		b.WriteString("|#")
+		writeStatsDTags(b, tags, "", ":", ",")
+	}
+
+	return b.String()
+}
+
+// writeStatsDTags writes tags to b.  start is written before the first tag,
+// kvSep separates the key and the value, and sep separates the tags.
+func writeStatsDTags(b *strings.Builder, tags []statsDTag, start, kvSep, sep string) {
+	for i, t := range tags {
+		if i == 0 {
+			b.WriteString(start)
+		} else {
+			b.WriteString(sep)
+		}
+
+		b.WriteString(t.key)
+		b.WriteString(kvSep)
+		b.WriteString(statsDTagReplacer.Replace(t.value))
+	}
+}
+
+// send sends the buffered metrics and resets the buffer.  e.mu is expected to
+// be locked.
+func (e *statsDEmitter) send() {
+	if e.buf.Len() == 0 {
+		return
+	}
+
+	_, err := e.conn.Write(e.buf.Bytes())
+	if err != nil {
+		// Don't log at the error level, since the StatsD server may be
+		// unavailable for a while.
+		e.logger.Debug("sending metrics to statsd", slogutil.KeyError, err)
+	}
+
+	e.buf.Reset()
+}
+
+// flush sends the buffered metrics.
+func (e *statsDEmitter) flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.send()
+}
+
+// periodicFlush sends the buffered metrics every flush interval until e is
+// closed.
+func (e *statsDEmitter) periodicFlush() {
+	defer slogutil.RecoverAndLog(context.TODO(), e.logger)
+
+	ticker := time.NewTicker(e.flushIvl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.flush()
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// close stops the periodic flushing, sends the buffered metrics, and closes
+// the connection.
+func (e *statsDEmitter) close() (err error) {
+	close(e.done)
+	e.flush()
+
+	return e.conn.Close()
+}
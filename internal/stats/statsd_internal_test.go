@@ -0,0 +1,117 @@
+package stats
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsCtx_statsD(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, pc.Close)
+
+	testCases := []struct {
+		name      string
+		tagFormat StatsDTagFormat
+		want      []string
+	}{{
+		name:      "none",
+		tagFormat: StatsDTagFormatNone,
+		want: []string{
+			"agh.queries:1|c",
+			"agh.processing_time:12|ms",
+			"agh.upstream.responses:1|c",
+			"agh.upstream.time:3|ms",
+			"agh.upstream.errors:1|c",
+		},
+	}, {
+		name:      "dogstatsd",
+		tagFormat: StatsDTagFormatDogStatsD,
+		want: []string{
+			"agh.queries:1|c|#result:filtered",
+			"agh.processing_time:12|ms|#result:filtered",
+			"agh.upstream.responses:1|c|#upstream:tls_//dns.example",
+			"agh.upstream.time:3|ms|#upstream:tls_//dns.example",
+			"agh.upstream.errors:1|c|#upstream:1.2.3.4_53",
+		},
+	}, {
+		name:      "influxdb",
+		tagFormat: StatsDTagFormatInfluxDB,
+		want: []string{
+			"agh.queries,result=filtered:1|c",
+			"agh.processing_time,result=filtered:12|ms",
+			"agh.upstream.responses,upstream=tls_//dns.example:1|c",
+			"agh.upstream.time,upstream=tls_//dns.example:3|ms",
+			"agh.upstream.errors,upstream=1.2.3.4_53:1|c",
+		},
+	}, {
+		name:      "graphite",
+		tagFormat: StatsDTagFormatGraphite,
+		want: []string{
+			"agh.queries;result=filtered:1|c",
+			"agh.processing_time;result=filtered:12|ms",
+			"agh.upstream.responses;upstream=tls_//dns.example:1|c",
+			"agh.upstream.time;upstream=tls_//dns.example:3|ms",
+			"agh.upstream.errors;upstream=1.2.3.4_53:1|c",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStatsCtx(t, Config{
+				Enabled: true,
+				StatsD: &StatsDConfig{
+					Addr:      pc.LocalAddr().String(),
+					Prefix:    "agh",
+					TagFormat: tc.tagFormat,
+					FlushIvl:  time.Hour,
+				},
+			})
+
+			s.Update(&Entry{
+				Client:         "192.0.2.1",
+				Domain:         TestDomain1,
+				Result:         RFiltered,
+				ProcessingTime: 12 * time.Millisecond,
+				UpstreamStats: []*proxy.UpstreamStatistics{{
+					Address:       "tls://dns.example",
+					QueryDuration: 3 * time.Millisecond,
+				}, {
+					Address: "1.2.3.4:53",
+					Error:   errors.New("test error"),
+				}, {
+					Address:  "cached.example",
+					IsCached: true,
+				}},
+			})
+
+			require.NoError(t, s.Close())
+
+			buf := make([]byte, maxStatsDPacketSize)
+			require.NoError(t, pc.SetReadDeadline(time.Now().Add(testTimeout)))
+
+			n, _, err := pc.ReadFrom(buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, strings.Split(string(buf[:n]), "\n"))
+		})
+	}
+}
+
+func TestNewStatsDTagFormat(t *testing.T) {
+	f, err := NewStatsDTagFormat("dogstatsd")
+	require.NoError(t, err)
+
+	assert.Equal(t, StatsDTagFormatDogStatsD, f)
+
+	_, err = NewStatsDTagFormat("bad")
+	assert.Error(t, err)
+}
@@ -25,6 +25,13 @@ const (
 
 	// maxUpstreams is the max number of top upstreams to return.
 	maxUpstreams = 100
+
+	// maxBlockedServices is the max number of top blocked services to return.
+	maxBlockedServices = 100
+
+	// maxBlockedCategories is the max number of top blocked categories to
+	// return.
+	maxBlockedCategories = 100
 )
 
 // UnitIDGenFunc is the signature of a function that generates a unique ID for
@@ -53,6 +60,12 @@ const (
 	resultLast = RParental + 1
 )
 
+// Blocking categories for the requests not blocked by a blocked service.
+const (
+	CategorySafeBrowsing = "safe_browsing"
+	CategoryParental     = "parental"
+)
+
 // Entry is a statistics data entry.
 type Entry struct {
 	// Clients is the client's primary ID.
@@ -67,12 +80,25 @@ type Entry struct {
 	// fallback DNS servers.  Don't modify items in the slice.
 	UpstreamStats []*proxy.UpstreamStatistics
 
+	// BlockedService is the ID of the blocked service the request has been
+	// blocked by.  It's empty unless Result is [RFiltered].
+	BlockedService string
+
+	// Category is the category of the blocking, such as the group of the
+	// blocked service or [CategorySafeBrowsing].  It's empty if the request
+	// hasn't been blocked by a service, safe browsing, or parental control.
+	Category string
+
 	// Result is the result of processing the request.
 	Result Result
 
 	// ProcessingTime is the duration of the request processing from the start
 	// of the request including timeouts.
 	ProcessingTime time.Duration
+
+	// Stale is true if the request has been answered with the expired
+	// response.
+	Stale bool
 }
 
 // validate returns an error if entry is not valid.
@@ -100,9 +126,24 @@ type unit struct {
 	// been blocked.
 	blockedDomains map[string]uint64
 
+	// blockedServices stores the number of requests blocked by each blocked
+	// service.
+	blockedServices map[string]uint64
+
+	// blockedCategories stores the number of requests blocked within each
+	// blocking category.
+	blockedCategories map[string]uint64
+
 	// clients stores the number of requests from each client.
 	clients map[string]uint64
 
+	// clientsBlocked stores the number of blocked requests from each client.
+	clientsBlocked map[string]uint64
+
+	// clientsTimeSum stores the sum of processing time in microseconds of the
+	// requests from each client.
+	clientsTimeSum map[string]uint64
+
 	// upstreamsResponses stores the number of responses from each upstream.
 	upstreamsResponses map[string]uint64
 
@@ -110,6 +151,13 @@ type unit struct {
 	// microseconds to each upstream.
 	upstreamsTimeSum map[string]uint64
 
+	// upstreamsErrors stores the number of failed queries to each upstream.
+	upstreamsErrors map[string]uint64
+
+	// upstreamsLatency stores the histogram of durations of successful queries
+	// to each upstream.  See [latencyBounds].
+	upstreamsLatency map[string][]uint64
+
 	// nResult stores the number of requests grouped by it's result.
 	nResult []uint64
 
@@ -123,6 +171,17 @@ type unit struct {
 	// nTotal stores the total number of requests.
 	nTotal uint64
 
+	// cacheHits stores the number of requests answered from the DNS cache.
+	cacheHits uint64
+
+	// cacheMisses stores the number of requests forwarded to the upstreams
+	// without a cached response.
+	cacheMisses uint64
+
+	// staleHits stores the number of requests answered with the expired
+	// responses.
+	staleHits uint64
+
 	// timeSum stores the sum of processing time in microseconds of each request
 	// written by the unit.
 	timeSum uint64
@@ -133,9 +192,15 @@ func newUnit(id uint32) (u *unit) {
 	return &unit{
 		domains:            map[string]uint64{},
 		blockedDomains:     map[string]uint64{},
+		blockedServices:    map[string]uint64{},
+		blockedCategories:  map[string]uint64{},
 		clients:            map[string]uint64{},
+		clientsBlocked:     map[string]uint64{},
+		clientsTimeSum:     map[string]uint64{},
 		upstreamsResponses: map[string]uint64{},
 		upstreamsTimeSum:   map[string]uint64{},
+		upstreamsErrors:    map[string]uint64{},
+		upstreamsLatency:   map[string][]uint64{},
 		nResult:            make([]uint64, resultLast),
 		id:                 id,
 	}
@@ -162,9 +227,25 @@ type unitDB struct {
 	// BlockedDomains is the number of requests blocked for each domain name.
 	BlockedDomains []countPair
 
+	// BlockedServices is the number of requests blocked by each blocked
+	// service.
+	BlockedServices []countPair
+
+	// BlockedCategories is the number of requests blocked within each blocking
+	// category.
+	BlockedCategories []countPair
+
 	// Clients is the number of requests from each client.
 	Clients []countPair
 
+	// ClientsBlocked is the number of blocked requests from each client in
+	// Clients.
+	ClientsBlocked []countPair
+
+	// ClientsTimeSum is the sum of processing time in microseconds of the
+	// requests from each client in Clients.
+	ClientsTimeSum []countPair
+
 	// UpstreamsResponses is the number of responses from each upstream.
 	UpstreamsResponses []countPair
 
@@ -172,9 +253,26 @@ type unitDB struct {
 	// responses from each upstream.
 	UpstreamsTimeSum []countPair
 
+	// UpstreamsErrors is the number of failed queries to each upstream.
+	UpstreamsErrors []countPair
+
+	// UpstreamsLatency is the histogram of processing time of responses from
+	// each upstream in UpstreamsResponses.
+	UpstreamsLatency []histogramPair
+
 	// NTotal is the total number of requests.
 	NTotal uint64
 
+	// CacheHits is the number of requests answered from the DNS cache.
+	CacheHits uint64
+
+	// CacheMisses is the number of requests forwarded to the upstreams without
+	// a cached response.
+	CacheMisses uint64
+
+	// StaleHits is the number of requests answered with the expired responses.
+	StaleHits uint64
+
 	// TimeAvg is the average of processing times in microseconds of all the
 	// requests in the unit.
 	TimeAvg uint32
@@ -182,9 +280,15 @@ type unitDB struct {
 
 // newUnitID is the default UnitIDGenFunc that generates the unique id hourly.
 func newUnitID() (id uint32) {
+	return timeToUnitID(time.Now())
+}
+
+// timeToUnitID returns the ID of the unit generated by [newUnitID] for the hour
+// containing t.
+func timeToUnitID(t time.Time) (id uint32) {
 	const secsInHour = int64(time.Hour / time.Second)
 
-	return uint32(time.Now().Unix() / secsInHour)
+	return uint32(t.Unix() / secsInHour)
 }
 
 func finishTxn(tx *bbolt.Tx, commit bool) (err error) {
@@ -244,6 +348,18 @@ func convertMapToSlice(m map[string]uint64, maxVal int) (s []countPair) {
 	return s[:min(maxVal, len(s))]
 }
 
+// pairsForNames returns the values from m for the names of pairs.  Zero values
+// are omitted.
+func pairsForNames(m map[string]uint64, pairs []countPair) (s []countPair) {
+	for _, p := range pairs {
+		if v := m[p.Name]; v != 0 {
+			s = append(s, countPair{Name: p.Name, Count: v})
+		}
+	}
+
+	return s
+}
+
 func convertSliceToMap(a []countPair) (m map[string]uint64) {
 	m = map[string]uint64{}
 	for _, it := range a {
@@ -261,14 +377,26 @@ func (u *unit) serialize() (udb *unitDB) {
 		timeAvg = uint32(u.timeSum / u.nTotal)
 	}
 
+	clients := convertMapToSlice(u.clients, maxClients)
+	upstreams := convertMapToSlice(u.upstreamsResponses, maxUpstreams)
+
 	return &unitDB{
 		NTotal:             u.nTotal,
 		NResult:            append([]uint64{}, u.nResult...),
 		Domains:            convertMapToSlice(u.domains, maxDomains),
 		BlockedDomains:     convertMapToSlice(u.blockedDomains, maxDomains),
-		Clients:            convertMapToSlice(u.clients, maxClients),
-		UpstreamsResponses: convertMapToSlice(u.upstreamsResponses, maxUpstreams),
+		BlockedServices:    convertMapToSlice(u.blockedServices, maxBlockedServices),
+		BlockedCategories:  convertMapToSlice(u.blockedCategories, maxBlockedCategories),
+		Clients:            clients,
+		ClientsBlocked:     pairsForNames(u.clientsBlocked, clients),
+		ClientsTimeSum:     pairsForNames(u.clientsTimeSum, clients),
+		UpstreamsResponses: upstreams,
 		UpstreamsTimeSum:   convertMapToSlice(u.upstreamsTimeSum, maxUpstreams),
+		UpstreamsErrors:    convertMapToSlice(u.upstreamsErrors, maxUpstreams),
+		UpstreamsLatency:   histogramsForNames(u.upstreamsLatency, upstreams),
+		CacheHits:          u.cacheHits,
+		CacheMisses:        u.cacheMisses,
+		StaleHits:          u.staleHits,
 		TimeAvg:            timeAvg,
 	}
 }
@@ -308,10 +436,19 @@ func (u *unit) deserialize(udb *unitDB) {
 	copy(u.nResult, udb.NResult)
 	u.domains = convertSliceToMap(udb.Domains)
 	u.blockedDomains = convertSliceToMap(udb.BlockedDomains)
+	u.blockedServices = convertSliceToMap(udb.BlockedServices)
+	u.blockedCategories = convertSliceToMap(udb.BlockedCategories)
 	u.clients = convertSliceToMap(udb.Clients)
+	u.clientsBlocked = convertSliceToMap(udb.ClientsBlocked)
+	u.clientsTimeSum = convertSliceToMap(udb.ClientsTimeSum)
 	u.upstreamsResponses = convertSliceToMap(udb.UpstreamsResponses)
 	u.upstreamsTimeSum = convertSliceToMap(udb.UpstreamsTimeSum)
+	u.upstreamsErrors = convertSliceToMap(udb.UpstreamsErrors)
+	u.upstreamsLatency = convertHistogramsToMap(udb.UpstreamsLatency)
 	u.timeSum = uint64(udb.TimeAvg) * udb.NTotal
+	u.cacheHits = udb.CacheHits
+	u.cacheMisses = udb.CacheMisses
+	u.staleHits = udb.StaleHits
 }
 
 // add adds new data to u.  It's safe for concurrent use.
@@ -321,21 +458,57 @@ func (u *unit) add(e *Entry) {
 		u.domains[e.Domain]++
 	} else {
 		u.blockedDomains[e.Domain]++
+		u.clientsBlocked[e.Client]++
+	}
+
+	if e.BlockedService != "" {
+		u.blockedServices[e.BlockedService]++
+	}
+
+	if e.Category != "" {
+		u.blockedCategories[e.Category]++
 	}
 
 	u.clients[e.Client]++
 	pt := uint64(e.ProcessingTime.Microseconds())
 	u.timeSum += pt
+	u.clientsTimeSum[e.Client] += pt
 	u.nTotal++
 
+	if len(e.UpstreamStats) > 0 {
+		if e.UpstreamStats[0].IsCached {
+			u.cacheHits++
+		} else {
+			u.cacheMisses++
+		}
+	}
+
+	if e.Stale {
+		u.staleHits++
+	}
+
 	for _, s := range e.UpstreamStats {
-		if s.IsCached || s.Error != nil {
+		if s.IsCached {
 			continue
 		}
 
 		addr := s.Address
+		if s.Error != nil {
+			u.upstreamsErrors[addr]++
+
+			continue
+		}
+
 		u.upstreamsResponses[addr]++
 		u.upstreamsTimeSum[addr] += uint64(s.QueryDuration.Microseconds())
+
+		hist := u.upstreamsLatency[addr]
+		if hist == nil {
+			hist = make([]uint64, len(latencyBounds)+1)
+			u.upstreamsLatency[addr] = hist
+		}
+
+		hist[latencyBucket(s.QueryDuration)]++
 	}
 }
 
@@ -415,12 +588,17 @@ func (s *StatsCtx) getData(limit uint32) (resp *StatsResp, ok bool) {
 			TimeUnits: "days",
 
 			TopBlocked:            []topAddrs{},
+			TopBlockedServices:    []topAddrs{},
+			TopBlockedCategories:  []topAddrs{},
 			TopClients:            []topAddrs{},
 			TopQueried:            []topAddrs{},
 			TopUpstreamsResponses: []topAddrs{},
 			TopUpstreamsAvgTime:   []topAddrsFloat{},
 
 			BlockedFiltering:     []uint64{},
+			CacheHits:            []uint64{},
+			CacheMisses:          []uint64{},
+			StaleHits:            []uint64{},
 			DNSQueries:           []uint64{},
 			ReplacedParental:     []uint64{},
 			ReplacedSafebrowsing: []uint64{},
@@ -437,6 +615,15 @@ func (s *StatsCtx) getData(limit uint32) (resp *StatsResp, ok bool) {
 
 // dataFromUnits collects and returns the statistics data.
 func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp) {
+	resp = s.summarizeUnits(units)
+	s.fillCollectedStats(resp, units, curID)
+
+	return resp
+}
+
+// summarizeUnits returns the statistics data with the top and the total
+// counters of units filled.
+func (s *StatsCtx) summarizeUnits(units []*unitDB) (resp *StatsResp) {
 	topUpstreamsResponses, topUpstreamsAvgTime := topUpstreamsPairs(units)
 
 	resp = &StatsResp{
@@ -445,10 +632,20 @@ func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp
 		TopUpstreamsResponses: topUpstreamsResponses,
 		TopUpstreamsAvgTime:   topUpstreamsAvgTime,
 		TopClients:            topsCollector(units, maxClients, nil, topClientPairs(s)),
+		TopBlockedServices: topsCollector(
+			units,
+			maxBlockedServices,
+			nil,
+			func(u *unitDB) (pairs []countPair) { return u.BlockedServices },
+		),
+		TopBlockedCategories: topsCollector(
+			units,
+			maxBlockedCategories,
+			nil,
+			func(u *unitDB) (pairs []countPair) { return u.BlockedCategories },
+		),
 	}
 
-	s.fillCollectedStats(resp, units, curID)
-
 	// Total counters:
 	sum := unitDB{
 		NResult: make([]uint64, resultLast),
@@ -464,6 +661,9 @@ func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp
 		sum.NResult[RSafeBrowsing] += u.NResult[RSafeBrowsing]
 		sum.NResult[RSafeSearch] += u.NResult[RSafeSearch]
 		sum.NResult[RParental] += u.NResult[RParental]
+		sum.CacheHits += u.CacheHits
+		sum.CacheMisses += u.CacheMisses
+		sum.StaleHits += u.StaleHits
 	}
 
 	resp.NumDNSQueries = sum.NTotal
@@ -471,6 +671,9 @@ func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp
 	resp.NumReplacedSafebrowsing = sum.NResult[RSafeBrowsing]
 	resp.NumReplacedSafesearch = sum.NResult[RSafeSearch]
 	resp.NumReplacedParental = sum.NResult[RParental]
+	resp.NumCacheHits = sum.CacheHits
+	resp.NumCacheMisses = sum.CacheMisses
+	resp.NumStaleHits = sum.StaleHits
 
 	if timeN != 0 {
 		resp.AvgProcessingTime = microsecondsToSeconds(float64(sum.TimeAvg / timeN))
@@ -494,6 +697,9 @@ func (s *StatsCtx) fillCollectedStats(data *StatsResp, units []*unitDB, curID ui
 	data.BlockedFiltering = make([]uint64, size)
 	data.ReplacedSafebrowsing = make([]uint64, size)
 	data.ReplacedParental = make([]uint64, size)
+	data.CacheHits = make([]uint64, size)
+	data.CacheMisses = make([]uint64, size)
+	data.StaleHits = make([]uint64, size)
 
 	if data.TimeUnits == timeUnitsDays {
 		s.fillCollectedStatsDaily(data, units, curID, size)
@@ -506,6 +712,9 @@ func (s *StatsCtx) fillCollectedStats(data *StatsResp, units []*unitDB, curID ui
 		data.BlockedFiltering[i] += u.NResult[RFiltered]
 		data.ReplacedSafebrowsing[i] += u.NResult[RSafeBrowsing]
 		data.ReplacedParental[i] += u.NResult[RParental]
+		data.CacheHits[i] += u.CacheHits
+		data.CacheMisses[i] += u.CacheMisses
+		data.StaleHits[i] += u.StaleHits
 	}
 }
 
@@ -533,6 +742,9 @@ func (s *StatsCtx) fillCollectedStatsDaily(
 		data.BlockedFiltering[day] += u.NResult[RFiltered]
 		data.ReplacedSafebrowsing[day] += u.NResult[RSafeBrowsing]
 		data.ReplacedParental[day] += u.NResult[RParental]
+		data.CacheHits[day] += u.CacheHits
+		data.CacheMisses[day] += u.CacheMisses
+		data.StaleHits[day] += u.StaleHits
 	}
 }
 
@@ -629,3 +841,111 @@ func prepareTopUpstreamsAvgTime(
 
 	return topUpstreamsAvgTime
 }
+
+// clientsDataFromUnits returns the hourly statistics of at most maxClients
+// clients with the most requests in units.  If client is not empty, only the
+// statistics of that client are returned.
+func (s *StatsCtx) clientsDataFromUnits(units []*unitDB, client string) (resp *clientsStatsResp) {
+	totals := map[string]uint64{}
+	for _, u := range units {
+		for _, cp := range topClientPairs(s)(u) {
+			if client == "" || cp.Name == client {
+				totals[cp.Name] += cp.Count
+			}
+		}
+	}
+
+	resp = &clientsStatsResp{
+		TimeUnits: timeUnitsHours,
+		Clients:   []*clientStats{},
+	}
+
+	byName := map[string]*clientStats{}
+	for _, cp := range convertMapToSlice(totals, maxClients) {
+		cs := &clientStats{
+			Name:              cp.Name,
+			DNSQueries:        make([]uint64, len(units)),
+			Blocked:           make([]uint64, len(units)),
+			AvgProcessingTime: make([]float64, len(units)),
+			NumDNSQueries:     cp.Count,
+		}
+
+		byName[cp.Name] = cs
+		resp.Clients = append(resp.Clients, cs)
+	}
+
+	for i, u := range units {
+		for _, cp := range u.Clients {
+			if cs := byName[cp.Name]; cs != nil {
+				cs.DNSQueries[i] = cp.Count
+			}
+		}
+
+		for _, cp := range u.ClientsBlocked {
+			if cs := byName[cp.Name]; cs != nil {
+				cs.Blocked[i] = cp.Count
+				cs.NumBlocked += cp.Count
+			}
+		}
+
+		for _, cp := range u.ClientsTimeSum {
+			if cs := byName[cp.Name]; cs != nil && cs.DNSQueries[i] != 0 {
+				avg := float64(cp.Count) / float64(cs.DNSQueries[i])
+				cs.AvgProcessingTime[i] = microsecondsToSeconds(avg)
+			}
+		}
+	}
+
+	return resp
+}
+
+// rangeDataFromUnits returns the statistics data of units split into the
+// buckets of the parsed range.  The last bucket may contain fewer units.  sr
+// must not be nil.
+func (s *StatsCtx) rangeDataFromUnits(units []*unitDB, sr *statsRange) (resp *statsRangeResp) {
+	sum := s.summarizeUnits(units)
+
+	bucketLen := int(sr.bucketLen)
+	size := (len(units) + bucketLen - 1) / bucketLen
+	resp = &statsRangeResp{
+		From:                    sr.from,
+		BucketSize:              int64(bucketLen) * sr.unit.Milliseconds(),
+		TopQueried:              sum.TopQueried,
+		TopClients:              sum.TopClients,
+		TopBlocked:              sum.TopBlocked,
+		TopBlockedServices:      sum.TopBlockedServices,
+		TopBlockedCategories:    sum.TopBlockedCategories,
+		TopUpstreamsResponses:   sum.TopUpstreamsResponses,
+		TopUpstreamsAvgTime:     sum.TopUpstreamsAvgTime,
+		DNSQueries:              make([]uint64, size),
+		BlockedFiltering:        make([]uint64, size),
+		ReplacedSafebrowsing:    make([]uint64, size),
+		ReplacedParental:        make([]uint64, size),
+		CacheHits:               make([]uint64, size),
+		CacheMisses:             make([]uint64, size),
+		StaleHits:               make([]uint64, size),
+		NumDNSQueries:           sum.NumDNSQueries,
+		NumBlockedFiltering:     sum.NumBlockedFiltering,
+		NumReplacedSafebrowsing: sum.NumReplacedSafebrowsing,
+		NumReplacedSafesearch:   sum.NumReplacedSafesearch,
+		NumReplacedParental:     sum.NumReplacedParental,
+		NumCacheHits:            sum.NumCacheHits,
+		NumCacheMisses:          sum.NumCacheMisses,
+		NumStaleHits:            sum.NumStaleHits,
+		AvgProcessingTime:       sum.AvgProcessingTime,
+	}
+
+	for i, u := range units {
+		b := i / bucketLen
+
+		resp.DNSQueries[b] += u.NTotal
+		resp.BlockedFiltering[b] += u.NResult[RFiltered]
+		resp.ReplacedSafebrowsing[b] += u.NResult[RSafeBrowsing]
+		resp.ReplacedParental[b] += u.NResult[RParental]
+		resp.CacheHits[b] += u.CacheHits
+		resp.CacheMisses[b] += u.CacheMisses
+		resp.StaleHits[b] += u.StaleHits
+	}
+
+	return resp
+}
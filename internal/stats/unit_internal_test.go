@@ -2,7 +2,10 @@ package stats
 
 import (
 	"testing"
+	"time"
 
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -17,13 +20,19 @@ func TestUnit_Deserialize(t *testing.T) {
 		want: unit{
 			domains:            map[string]uint64{},
 			blockedDomains:     map[string]uint64{},
+			blockedServices:    map[string]uint64{},
+			blockedCategories:  map[string]uint64{},
 			clients:            map[string]uint64{},
+			clientsBlocked:     map[string]uint64{},
+			clientsTimeSum:     map[string]uint64{},
 			nResult:            []uint64{0, 0, 0, 0, 0, 0},
 			id:                 0,
 			nTotal:             0,
 			timeSum:            0,
 			upstreamsResponses: map[string]uint64{},
 			upstreamsTimeSum:   map[string]uint64{},
+			upstreamsErrors:    map[string]uint64{},
+			upstreamsLatency:   map[string][]uint64{},
 		},
 		db: &unitDB{
 			NResult:            []uint64{0, 0, 0, 0, 0, 0},
@@ -44,9 +53,21 @@ func TestUnit_Deserialize(t *testing.T) {
 			blockedDomains: map[string]uint64{
 				"example.net": 1,
 			},
+			blockedServices: map[string]uint64{
+				"youtube": 1,
+			},
+			blockedCategories: map[string]uint64{
+				"video": 1,
+			},
 			clients: map[string]uint64{
 				"127.0.0.1": 2,
 			},
+			clientsBlocked: map[string]uint64{
+				"127.0.0.1": 1,
+			},
+			clientsTimeSum: map[string]uint64{
+				"127.0.0.1": 246912,
+			},
 			nResult: []uint64{0, 1, 1, 0, 0, 0},
 			id:      0,
 			nTotal:  2,
@@ -57,6 +78,12 @@ func TestUnit_Deserialize(t *testing.T) {
 			upstreamsTimeSum: map[string]uint64{
 				"1.2.3.4": 246912,
 			},
+			upstreamsErrors: map[string]uint64{
+				"1.2.3.4": 1,
+			},
+			upstreamsLatency: map[string][]uint64{
+				"1.2.3.4": {0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0},
+			},
 		},
 		db: &unitDB{
 			NResult: []uint64{0, 1, 1, 0, 0, 0},
@@ -66,9 +93,21 @@ func TestUnit_Deserialize(t *testing.T) {
 			BlockedDomains: []countPair{{
 				"example.net", 1,
 			}},
+			BlockedServices: []countPair{{
+				"youtube", 1,
+			}},
+			BlockedCategories: []countPair{{
+				"video", 1,
+			}},
 			Clients: []countPair{{
 				"127.0.0.1", 2,
 			}},
+			ClientsBlocked: []countPair{{
+				"127.0.0.1", 1,
+			}},
+			ClientsTimeSum: []countPair{{
+				"127.0.0.1", 246912,
+			}},
 			NTotal:  2,
 			TimeAvg: 123456,
 			UpstreamsResponses: []countPair{{
@@ -77,6 +116,12 @@ func TestUnit_Deserialize(t *testing.T) {
 			UpstreamsTimeSum: []countPair{{
 				"1.2.3.4", 246912,
 			}},
+			UpstreamsErrors: []countPair{{
+				"1.2.3.4", 1,
+			}},
+			UpstreamsLatency: []histogramPair{{
+				"1.2.3.4", []uint64{0, 0, 0, 0, 0, 0, 0, 2},
+			}},
 		},
 	}}
 
@@ -175,3 +220,32 @@ func TestTopUpstreamsPairs(t *testing.T) {
 		})
 	}
 }
+
+func TestUnit_add_cache(t *testing.T) {
+	u := newUnit(0)
+
+	for _, us := range [][]*proxy.UpstreamStatistics{{{
+		Address:  "1.2.3.4:53",
+		IsCached: true,
+	}}, {{
+		Address:       "1.2.3.4:53",
+		QueryDuration: time.Millisecond,
+	}}, {{
+		Address: "1.2.3.4:53",
+		Error:   errors.Error("test error"),
+	}}, nil} {
+		u.add(&Entry{
+			Client:        "127.0.0.1",
+			Domain:        "example.com",
+			Result:        RNotFiltered,
+			UpstreamStats: us,
+			Stale:         len(us) > 0 && us[0].Error != nil,
+		})
+	}
+
+	udb := u.serialize()
+	assert.Equal(t, uint64(4), udb.NTotal)
+	assert.Equal(t, uint64(1), udb.CacheHits)
+	assert.Equal(t, uint64(2), udb.CacheMisses)
+	assert.Equal(t, uint64(1), udb.StaleHits)
+}
@@ -0,0 +1,218 @@
+package stats
+
+import (
+	"slices"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the buckets of the upstream latency
+// histograms.  The last bucket of a histogram, which isn't listed here,
+// contains the durations above the last bound.
+//
+// NOTE: Only append to this list, as the histograms are stored in the
+// database.
+var latencyBounds = []time.Duration{
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+// latencyBucket returns the index of the histogram bucket for d.
+func latencyBucket(d time.Duration) (i int) {
+	i, _ = slices.BinarySearch(latencyBounds, d)
+
+	return i
+}
+
+// histogramPair is a single name-histogram pair for serializing statistics
+// data into the database.
+type histogramPair struct {
+	Name   string
+	Counts []uint64
+}
+
+// histogramsForNames returns the histograms from m for the names of pairs in
+// the same order.
+func histogramsForNames(m map[string][]uint64, pairs []countPair) (s []histogramPair) {
+	for _, p := range pairs {
+		if h := m[p.Name]; h != nil {
+			s = append(s, histogramPair{Name: p.Name, Counts: slices.Clone(h)})
+		}
+	}
+
+	return s
+}
+
+// convertHistogramsToMap converts the slice of histogram pairs to a map.  The
+// histograms stored with fewer buckets are extended.
+func convertHistogramsToMap(a []histogramPair) (m map[string][]uint64) {
+	m = make(map[string][]uint64, len(a))
+	for _, hp := range a {
+		h := make([]uint64, max(len(latencyBounds)+1, len(hp.Counts)))
+		copy(h, hp.Counts)
+		m[hp.Name] = h
+	}
+
+	return m
+}
+
+// upstreamsStatsResp is a response to the GET /control/stats/upstreams.
+type upstreamsStatsResp struct {
+	// Upstreams are the statistics of the upstreams sorted by the number of
+	// responses in descending order.
+	Upstreams []*upstreamStats `json:"upstreams"`
+
+	// LatencyBounds are the upper bounds of the buckets of the latency
+	// histograms in seconds.  The last bucket of a histogram has no upper
+	// bound.
+	LatencyBounds []float64 `json:"latency_bounds"`
+}
+
+// upstreamStats is the statistics of a single upstream.  The durations are in
+// seconds.
+type upstreamStats struct {
+	// Name is the address of the upstream.
+	Name string `json:"name"`
+
+	// LatencyHistogram is the number of responses within each bucket of
+	// [upstreamsStatsResp.LatencyBounds].
+	LatencyHistogram []uint64 `json:"latency_histogram"`
+
+	// NumResponses is the number of successful queries.
+	NumResponses uint64 `json:"num_responses"`
+
+	// NumErrors is the number of failed queries.
+	NumErrors uint64 `json:"num_errors"`
+
+	// ErrorRate is the ratio of the failed queries to all queries.
+	ErrorRate float64 `json:"error_rate"`
+
+	// AvgTime is the average duration of the successful queries.
+	AvgTime float64 `json:"avg_time"`
+
+	// P50, P90, and P99 are the estimated percentiles of the duration of the
+	// successful queries.
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// upstreamsDataFromUnits returns the statistics of at most maxUpstreams
+// upstreams with the most queries in units.
+func upstreamsDataFromUnits(units []*unitDB) (resp *upstreamsStatsResp) {
+	queries := map[string]uint64{}
+	byName := map[string]*upstreamStats{}
+	timeSums := map[string]uint64{}
+
+	get := func(name string) (us *upstreamStats) {
+		us = byName[name]
+		if us == nil {
+			us = &upstreamStats{
+				Name:             name,
+				LatencyHistogram: make([]uint64, len(latencyBounds)+1),
+			}
+			byName[name] = us
+		}
+
+		return us
+	}
+
+	for _, u := range units {
+		for _, cp := range u.UpstreamsResponses {
+			get(cp.Name).NumResponses += cp.Count
+			queries[cp.Name] += cp.Count
+		}
+
+		for _, cp := range u.UpstreamsErrors {
+			get(cp.Name).NumErrors += cp.Count
+			queries[cp.Name] += cp.Count
+		}
+
+		for _, cp := range u.UpstreamsTimeSum {
+			timeSums[cp.Name] += cp.Count
+		}
+
+		for _, hp := range u.UpstreamsLatency {
+			h := get(hp.Name).LatencyHistogram
+			for i, n := range hp.Counts[:min(len(hp.Counts), len(h))] {
+				h[i] += n
+			}
+		}
+	}
+
+	resp = &upstreamsStatsResp{
+		Upstreams:     []*upstreamStats{},
+		LatencyBounds: make([]float64, 0, len(latencyBounds)),
+	}
+
+	for _, b := range latencyBounds {
+		resp.LatencyBounds = append(resp.LatencyBounds, b.Seconds())
+	}
+
+	for _, cp := range convertMapToSlice(queries, maxUpstreams) {
+		us := byName[cp.Name]
+		us.ErrorRate = float64(us.NumErrors) / float64(cp.Count)
+		if us.NumResponses != 0 {
+			avg := float64(timeSums[cp.Name]) / float64(us.NumResponses)
+			us.AvgTime = microsecondsToSeconds(avg)
+		}
+
+		us.P50 = histogramPercentile(us.LatencyHistogram, 0.50)
+		us.P90 = histogramPercentile(us.LatencyHistogram, 0.90)
+		us.P99 = histogramPercentile(us.LatencyHistogram, 0.99)
+
+		resp.Upstreams = append(resp.Upstreams, us)
+	}
+
+	return resp
+}
+
+// histogramPercentile returns the estimated p-th percentile in seconds of the
+// durations in the histogram h.  The value is interpolated linearly within the
+// bucket.  The values within the last, unbounded, bucket are estimated as the
+// last bound.  p must be in the (0, 1] range.
+func histogramPercentile(h []uint64, p float64) (sec float64) {
+	var total uint64
+	for _, n := range h {
+		total += n
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	rank := p * float64(total)
+
+	var cum uint64
+	for i, n := range h {
+		if float64(cum+n) < rank {
+			cum += n
+
+			continue
+		}
+
+		if i >= len(latencyBounds) {
+			break
+		}
+
+		var lower float64
+		if i > 0 {
+			lower = latencyBounds[i-1].Seconds()
+		}
+
+		upper := latencyBounds[i].Seconds()
+
+		return lower + (upper-lower)*(rank-float64(cum))/float64(n)
+	}
+
+	return latencyBounds[len(latencyBounds)-1].Seconds()
+}
@@ -0,0 +1,117 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	testCases := []struct {
+		name string
+		hist []uint64
+		p    float64
+		want float64
+	}{{
+		name: "empty",
+		hist: make([]uint64, len(latencyBounds)+1),
+		p:    0.5,
+		want: 0,
+	}, {
+		name: "first_bucket",
+		hist: []uint64{4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		p:    0.5,
+		want: 0.0005,
+	}, {
+		name: "interpolated",
+		hist: []uint64{0, 0, 0, 10, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		p:    0.9,
+		want: 0.0095,
+	}, {
+		name: "overflow",
+		hist: []uint64{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9},
+		p:    0.99,
+		want: 5,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.want, histogramPercentile(tc.hist, tc.p), 1e-9)
+		})
+	}
+}
+
+func TestStatsCtx_handleStatsUpstreams(t *testing.T) {
+	const (
+		upsFast = "tls://fast.example"
+		upsSlow = "https://slow.example/dns-query"
+	)
+
+	s := newTestStatsCtx(t, Config{
+		Enabled: true,
+	})
+
+	s.Start()
+	defer testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	for range 3 {
+		s.Update(&Entry{
+			Client: "192.0.2.1",
+			Domain: TestDomain1,
+			Result: RNotFiltered,
+			UpstreamStats: []*proxy.UpstreamStatistics{{
+				Address: upsSlow,
+				Error:   errors.New("test error"),
+			}, {
+				Address:       upsFast,
+				QueryDuration: 3 * time.Millisecond,
+			}},
+		})
+	}
+
+	s.Update(&Entry{
+		Client: "192.0.2.1",
+		Domain: TestDomain1,
+		Result: RNotFiltered,
+		UpstreamStats: []*proxy.UpstreamStatistics{{
+			Address:       upsSlow,
+			QueryDuration: 300 * time.Millisecond,
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/control/stats/upstreams", nil)
+	rw := httptest.NewRecorder()
+
+	s.handleStatsUpstreams(rw, req)
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	resp := &upstreamsStatsResp{}
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), resp))
+	require.Len(t, resp.Upstreams, 2)
+
+	assert.Len(t, resp.LatencyBounds, len(latencyBounds))
+
+	slow, fast := resp.Upstreams[0], resp.Upstreams[1]
+	require.Equal(t, upsSlow, slow.Name)
+	require.Equal(t, upsFast, fast.Name)
+
+	assert.Equal(t, uint64(1), slow.NumResponses)
+	assert.Equal(t, uint64(3), slow.NumErrors)
+	assert.InDelta(t, 0.75, slow.ErrorRate, 1e-9)
+	assert.InDelta(t, 0.3, slow.AvgTime, 1e-9)
+	assert.Equal(t, uint64(1), slow.LatencyHistogram[latencyBucket(300*time.Millisecond)])
+
+	assert.Equal(t, uint64(3), fast.NumResponses)
+	assert.Zero(t, fast.NumErrors)
+	assert.Zero(t, fast.ErrorRate)
+	assert.InDelta(t, 0.003, fast.AvgTime, 1e-9)
+	assert.InDelta(t, 0.00497, fast.P99, 1e-9)
+}
@@ -0,0 +1,117 @@
+package vpn
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/ioutil"
+)
+
+// maxRespSize is the maximum size of a response of the Tailscale API.
+const maxRespSize = 8 * 1024 * 1024
+
+// defaultTailnet is the name of the default tailnet of the API access token.
+const defaultTailnet = "-"
+
+// tailscale is the [fetcher] for the API of the Tailscale coordination server.
+// The API access token must be allowed to read the devices.
+type tailscale struct {
+	httpClient *http.Client
+	url        string
+	apiKey     string
+}
+
+// newTailscale returns a new *tailscale.  c must not be nil.
+func newTailscale(c *Config) (f *tailscale, err error) {
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("api key: %w", errors.ErrEmptyValue)
+	}
+
+	u := c.URL
+	if u == nil {
+		u, err = url.Parse(defaultTailscaleURL)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	tailnet := cmp.Or(c.Tailnet, defaultTailnet)
+
+	return &tailscale{
+		httpClient: c.HTTPClient,
+		url:        u.JoinPath("api", "v2", "tailnet", tailnet, "devices").String(),
+		apiKey:     c.APIKey,
+	}, nil
+}
+
+// type check
+var _ fetcher = (*tailscale)(nil)
+
+// tailscaleDevices is the response of the "devices" Tailscale API.
+type tailscaleDevices struct {
+	Devices []*tailscaleDevice `json:"devices"`
+}
+
+// tailscaleDevice is a device of a tailnet.
+type tailscaleDevice struct {
+	// Name is the MagicDNS name of the device, for example
+	// "laptop.example.ts.net".  Its first label is the name of the machine,
+	// which can be changed by the administrator.
+	Name string `json:"name"`
+
+	// Hostname is the hostname of the device reported by its operating system.
+	Hostname string `json:"hostname"`
+
+	// Addresses are the tunnel addresses of the device.
+	Addresses []string `json:"addresses"`
+}
+
+// fetch implements the [fetcher] interface for *tailscale.
+func (f *tailscale) fetch(ctx context.Context) (ps []Peer, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+
+	req.Header.Set(httphdr.Accept, "application/json")
+	req.Header.Set(httphdr.Authorization, "Bearer "+f.apiKey)
+
+	// #nosec G704 -- Trust the URL explicitly given by the user.
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	devs := &tailscaleDevices{}
+	err = json.NewDecoder(ioutil.LimitReader(resp.Body, maxRespSize)).Decode(devs)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	for _, d := range devs.Devices {
+		machine, _, _ := strings.Cut(d.Name, ".")
+		name := cmp.Or(machine, d.Hostname)
+		for _, addr := range d.Addresses {
+			ip, parseErr := netip.ParseAddr(addr)
+			if parseErr == nil {
+				ps = append(ps, Peer{IP: ip, Name: name})
+			}
+		}
+	}
+
+	return ps, nil
+}
@@ -0,0 +1,180 @@
+// Package vpn implements the retrieval of the peers of a VPN, such as
+// WireGuard or Tailscale, to map their tunnel addresses to their names.
+package vpn
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/service"
+)
+
+// Interface retrieves the peers of a VPN.
+type Interface interface {
+	// Refresher reads the peers of the VPN and updates the stored data.  It
+	// must be safe for concurrent use.
+	service.Refresher
+
+	// Peers returns the last set of the peers of the VPN.  Both the method and
+	// it's result must be safe for concurrent use.
+	Peers() (ps []Peer)
+}
+
+// Empty is the [Interface] implementation that does nothing.
+type Empty struct{}
+
+// type check
+var _ Interface = Empty{}
+
+// Refresh implements the [Interface] interface for Empty.  It does nothing and
+// always returns nil error.
+func (Empty) Refresh(_ context.Context) (err error) { return nil }
+
+// Peers implements the [Interface] interface for Empty.  It always returns nil.
+func (Empty) Peers() (ps []Peer) { return nil }
+
+// Peer is a tunnel address of a VPN peer.  A peer with several addresses is
+// represented by several Peers with the same name.
+type Peer struct {
+	// IP is the tunnel address of the peer.
+	IP netip.Addr
+
+	// Name is the name of the peer.  It's never empty.
+	Name string
+}
+
+// Type is the type of a VPN.
+type Type string
+
+// Supported VPN types.
+const (
+	// TypeWireGuard is the wg-quick configuration file of a WireGuard
+	// interface.
+	TypeWireGuard Type = "wireguard"
+
+	// TypeTailscale is the API of the Tailscale coordination server.
+	TypeTailscale Type = "tailscale"
+)
+
+// defaultTailscaleURL is the base URL of the Tailscale API used by default.
+const defaultTailscaleURL = "https://api.tailscale.com"
+
+// Config is the configuration of a [Source].
+type Config struct {
+	// Logger is used for logging the retrieval.  It must not be nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used to request the Tailscale API.  It must not be nil if
+	// Type is [TypeTailscale].
+	HTTPClient *http.Client
+
+	// URL is the base URL of the Tailscale API.  If nil, the official API of
+	// Tailscale is used.
+	URL *url.URL
+
+	// Type is the type of the VPN.
+	Type Type
+
+	// ConfigFile is the path to the wg-quick configuration file of the
+	// WireGuard interface.  It must not be empty if Type is [TypeWireGuard].
+	ConfigFile string
+
+	// Tailnet is the name of the Tailscale network.  If empty, "-", which is
+	// the default tailnet of the API key, is used.
+	Tailnet string
+
+	// APIKey is the Tailscale API access token.  It must not be empty if Type
+	// is [TypeTailscale].
+	APIKey string
+}
+
+// fetcher reads the peers of a VPN.
+type fetcher interface {
+	// fetch returns the peers of the VPN.
+	fetch(ctx context.Context) (ps []Peer, err error)
+}
+
+// Source is the [Interface] implementation, which reads the peers from the
+// configuration or the API of a VPN.
+type Source struct {
+	logger  *slog.Logger
+	fetcher fetcher
+
+	// mu protects peers.
+	mu    *sync.Mutex
+	peers []Peer
+}
+
+// type check
+var _ Interface = (*Source)(nil)
+
+// New returns a new properly initialized *Source.  c must not be nil.
+func New(c *Config) (s *Source, err error) {
+	var f fetcher
+	switch c.Type {
+	case TypeWireGuard:
+		if c.ConfigFile == "" {
+			return nil, fmt.Errorf("config file: %w", errors.ErrEmptyValue)
+		}
+
+		f = &wireGuard{
+			path: c.ConfigFile,
+		}
+	case TypeTailscale:
+		f, err = newTailscale(c)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf(
+			"type: %w: %q, should be one of %q",
+			errors.ErrBadEnumValue,
+			c.Type,
+			[]Type{TypeWireGuard, TypeTailscale},
+		)
+	}
+
+	return &Source{
+		logger:  c.Logger,
+		fetcher: f,
+		mu:      &sync.Mutex{},
+	}, nil
+}
+
+// Refresh implements the [Interface] interface for *Source.  The stored peers
+// are kept if err is not nil.
+func (s *Source) Refresh(ctx context.Context) (err error) {
+	ps, err := s.fetcher.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching peers: %w", err)
+	}
+
+	ps = slices.DeleteFunc(ps, func(p Peer) (ok bool) { return !p.IP.IsValid() || p.Name == "" })
+	slices.SortStableFunc(ps, func(a, b Peer) (n int) { return a.IP.Compare(b.IP) })
+	ps = slices.CompactFunc(ps, func(a, b Peer) (ok bool) { return a.IP == b.IP })
+
+	s.logger.DebugContext(ctx, "fetched vpn peers", "count", len(ps))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.peers = ps
+
+	return nil
+}
+
+// Peers implements the [Interface] interface for *Source.
+func (s *Source) Peers() (ps []Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.peers)
+}
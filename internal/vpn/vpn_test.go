@@ -0,0 +1,156 @@
+package vpn_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/vpn"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testWireGuardConf is the WireGuard configuration file for tests.
+const testWireGuardConf = `[Interface]
+# Name = server
+PrivateKey = cGxhY2Vob2xkZXJwbGFjZWhvbGRlcnBsYWNlaG9sZGU=
+Address = 10.8.0.1/24, fd00::1/64
+
+[Peer]
+# Name = phone
+PublicKey = cGhvbmVwaG9uZXBob25lcGhvbmVwaG9uZXBob25lcGg=
+AllowedIPs = 10.8.0.2/32, fd00::2/128
+
+[Peer]
+#name: laptop
+PublicKey = bGFwdG9wbGFwdG9wbGFwdG9wbGFwdG9wbGFwdG9wbGE=
+AllowedIPs = 10.8.0.3/32, 192.168.10.0/24
+
+[Peer]
+PublicKey = dW5uYW1lZHVubmFtZWR1bm5hbWVkdW5uYW1lZHVubm4=
+AllowedIPs = 10.8.0.4/32
+`
+
+func TestSource_Refresh_wireGuard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wg0.conf")
+	err := os.WriteFile(path, []byte(testWireGuardConf), 0o600)
+	require.NoError(t, err)
+
+	s, err := vpn.New(&vpn.Config{
+		Logger:     slogutil.NewDiscardLogger(),
+		Type:       vpn.TypeWireGuard,
+		ConfigFile: path,
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, s.Refresh(ctx))
+
+	assert.Equal(t, []vpn.Peer{{
+		IP:   netip.MustParseAddr("10.8.0.2"),
+		Name: "phone",
+	}, {
+		IP:   netip.MustParseAddr("10.8.0.3"),
+		Name: "laptop",
+	}, {
+		IP:   netip.MustParseAddr("fd00::2"),
+		Name: "phone",
+	}}, s.Peers())
+
+	t.Run("keep_on_error", func(t *testing.T) {
+		require.NoError(t, os.Remove(path))
+
+		ctx = testutil.ContextWithTimeout(t, testTimeout)
+		assert.Error(t, s.Refresh(ctx))
+		assert.Len(t, s.Peers(), 3)
+	})
+}
+
+func TestSource_Refresh_tailscale(t *testing.T) {
+	const (
+		apiKey  = "tskey-api-test"
+		tailnet = "example.com"
+	)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/tailnet/example.com/devices", r.URL.Path)
+		require.Equal(t, "Bearer "+apiKey, r.Header.Get("Authorization"))
+
+		_, _ = w.Write([]byte(`{"devices":[{
+			"name": "laptop.tail1234.ts.net",
+			"hostname": "Johns-MacBook",
+			"addresses": ["100.64.0.2", "fd7a:115c:a1e0::2"]
+		}, {
+			"name": "",
+			"hostname": "phone",
+			"addresses": ["100.64.0.3", "bad"]
+		}]}`))
+	})
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	s, err := vpn.New(&vpn.Config{
+		Logger:     slogutil.NewDiscardLogger(),
+		HTTPClient: srv.Client(),
+		URL:        u,
+		Type:       vpn.TypeTailscale,
+		Tailnet:    tailnet,
+		APIKey:     apiKey,
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, s.Refresh(ctx))
+
+	assert.Equal(t, []vpn.Peer{{
+		IP:   netip.MustParseAddr("100.64.0.2"),
+		Name: "laptop",
+	}, {
+		IP:   netip.MustParseAddr("100.64.0.3"),
+		Name: "phone",
+	}, {
+		IP:   netip.MustParseAddr("fd7a:115c:a1e0::2"),
+		Name: "laptop",
+	}}, s.Peers())
+}
+
+func TestNew_errors(t *testing.T) {
+	testCases := []struct {
+		conf       *vpn.Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &vpn.Config{Type: "openvpn"},
+		name:       "bad_type",
+		wantErrMsg: `type: bad enum value: "openvpn", should be one of ["wireguard" "tailscale"]`,
+	}, {
+		conf:       &vpn.Config{Type: vpn.TypeWireGuard},
+		name:       "no_config_file",
+		wantErrMsg: "config file: empty value",
+	}, {
+		conf:       &vpn.Config{Type: vpn.TypeTailscale},
+		name:       "no_api_key",
+		wantErrMsg: "api key: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := vpn.New(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
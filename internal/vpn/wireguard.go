@@ -0,0 +1,125 @@
+package vpn
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// wireGuard is the [fetcher] for the wg-quick configuration file of a WireGuard
+// interface.  The names of the peers are taken from the "# Name = ..." or
+// "# Name: ..." comments within the [Peer] sections, which are written by most
+// of the WireGuard management tools.  Only the single-address allowed IPs of
+// the peers are used, since the wider ones are routed networks behind the
+// peers.
+type wireGuard struct {
+	path string
+}
+
+// type check
+var _ fetcher = (*wireGuard)(nil)
+
+// fetch implements the [fetcher] interface for *wireGuard.
+func (f *wireGuard) fetch(_ context.Context) (ps []Peer, err error) {
+	// #nosec G304 -- Trust the path explicitly given by the user.
+	file, err := os.Open(f.path)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, file.Close()) }()
+
+	return parseWireGuard(file)
+}
+
+// wireGuardPeer is a [Peer] section of a WireGuard configuration file.
+type wireGuardPeer struct {
+	name string
+	ips  []netip.Addr
+}
+
+// parseWireGuard parses the peers from the WireGuard configuration file read
+// from r.
+func parseWireGuard(r io.Reader) (ps []Peer, err error) {
+	var peer *wireGuardPeer
+	flush := func() {
+		if peer == nil || peer.name == "" {
+			return
+		}
+
+		for _, ip := range peer.ips {
+			ps = append(ps, Peer{IP: ip, Name: peer.name})
+		}
+	}
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			flush()
+			peer = nil
+			if strings.EqualFold(line, "[Peer]") {
+				peer = &wireGuardPeer{}
+			}
+
+			continue
+		} else if peer == nil {
+			continue
+		}
+
+		err = peer.parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	flush()
+
+	return ps, nil
+}
+
+// parseLine parses a line of the [Peer] section.
+func (p *wireGuardPeer) parseLine(line string) (err error) {
+	if comment, ok := strings.CutPrefix(line, "#"); ok {
+		key, val, found := strings.Cut(comment, "=")
+		if !found {
+			key, val, found = strings.Cut(comment, ":")
+		}
+
+		if found && strings.EqualFold(strings.TrimSpace(key), "name") {
+			p.name = strings.TrimSpace(val)
+		}
+
+		return nil
+	}
+
+	key, val, found := strings.Cut(line, "=")
+	if !found || !strings.EqualFold(strings.TrimSpace(key), "AllowedIPs") {
+		return nil
+	}
+
+	for s := range strings.SplitSeq(val, ",") {
+		var pref netip.Prefix
+		pref, err = netip.ParsePrefix(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("allowed ips: %w", err)
+		}
+
+		if pref.IsSingleIP() {
+			p.ips = append(p.ips, pref.Addr())
+		}
+	}
+
+	return nil
+}
@@ -12,11 +12,11 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/home"
 )
 
-// Embed the prebuilt client here since we strive to keep .go files inside the
-// internal directory and the embed package is unable to embed files located
-// outside of the same or underlying directory.
+// Embed the prebuilt client and the OpenAPI specification here since we strive
+// to keep .go files inside the internal directory and the embed package is
+// unable to embed files located outside of the same or underlying directory.
 
-//go:embed build
+//go:embed build openapi/openapi.yaml
 var clientBuildFS embed.FS
 
 func main() {